@@ -0,0 +1,53 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"time"
+)
+
+// UpdateAck acknowledges that an instance applied an update of a flag. Updaters configured to acknowledge updates
+// (e.g. `watcher.WithAcks`) write one under `<ack path>/<flag name>/<instance ID>` after applying each update, so
+// push tooling can block until a quorum of instances confirmed a change, see `watcher.WaitForAcks`.
+type UpdateAck struct {
+	Instance string `json:"instance"`
+	Flag     string `json:"flag"`
+	// Index is the etcd index (or revision) of the applied update.
+	Index uint64 `json:"index"`
+	// Checksum is the `ValueChecksum` of the value as written to the backend, e.g. still signed or encrypted, so that
+	// writers can match acks to their writes without parsing the value.
+	Checksum string    `json:"checksum"`
+	Time     time.Time `json:"time"`
+}
+
+// ValueChecksum returns the checksum of `value` recorded in UpdateAcks.
+func ValueChecksum(value string) string {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ParseUpdateAck parses the value of an ack key, as produced by `UpdateAck.Encode`.
+func ParseUpdateAck(value string) (*UpdateAck, error) {
+	ack := &UpdateAck{}
+	if err := json.Unmarshal([]byte(value), ack); err != nil {
+		return nil, err
+	}
+	return ack, nil
+}
+
+// Encode returns the value of the ack key.
+func (a *UpdateAck) Encode() string {
+	out, _ := json.Marshal(a)
+	return string(out)
+}
+
+// Confirms tells whether the ack confirms the update of flag `name` at `index` (or a later one) with a value of
+// `checksum`. An empty `checksum` matches any value.
+func (a *UpdateAck) Confirms(name string, index uint64, checksum string) bool {
+	return a.Flag == name && a.Index >= index && (checksum == "" || a.Checksum == checksum || a.Index > index)
+}
@@ -0,0 +1,29 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateAck_EncodeAndConfirms(t *testing.T) {
+	ack := &flagz.UpdateAck{Instance: "frontend-1", Flag: "some_flag", Index: 10, Checksum: flagz.ValueChecksum("v1"),
+		Time: time.Unix(1000, 0).UTC()}
+	parsed, err := flagz.ParseUpdateAck(ack.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, ack, parsed)
+
+	assert.True(t, ack.Confirms("some_flag", 10, flagz.ValueChecksum("v1")))
+	assert.True(t, ack.Confirms("some_flag", 10, ""), "empty checksums must match any value")
+	assert.True(t, ack.Confirms("some_flag", 9, flagz.ValueChecksum("v0")), "later updates must confirm earlier ones")
+	assert.False(t, ack.Confirms("some_flag", 10, flagz.ValueChecksum("v2")), "other values must not confirm")
+	assert.False(t, ack.Confirms("some_flag", 11, ""), "earlier updates must not confirm later ones")
+	assert.False(t, ack.Confirms("other_flag", 10, ""))
+	assert.NotEqual(t, flagz.ValueChecksum("v1"), flagz.ValueChecksum("v2"))
+}
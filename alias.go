@@ -0,0 +1,83 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"sync"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	aliasesMu sync.RWMutex
+	aliases   = make(map[*flag.FlagSet]map[string]*flagAlias)
+)
+
+// flagAlias is an old name of a renamed flag.
+type flagAlias struct {
+	newName string
+	logger  Logger
+	warned  bool
+}
+
+// AliasFlag makes `oldName` an alias of the flag `newName` of `flagSet`, so that values arriving under the old name
+// of a renamed flag (e.g. from etcd keys, the command line or the status endpoint) are applied to the renamed flag,
+// without coordinating the rename with every writer of every backend. The first use of each alias logs a deprecation
+// warning to `logger`, unless it is nil.
+//
+// Aliases are resolved by the normalization of names of `flagSet` (see `FlagSet.SetNormalizeFunc`), wrapping the
+// current normalization; calling `SetNormalizeFunc` later drops them. It fails if `oldName` is a flag of `flagSet`.
+func AliasFlag(flagSet *flag.FlagSet, oldName string, newName string, logger Logger) error {
+	if flagSet.Lookup(oldName) != nil {
+		return fmt.Errorf("flagz: can't alias %v to %v, it is a flag itself", oldName, newName)
+	}
+	aliasesMu.Lock()
+	setAliases, installed := aliases[flagSet]
+	if !installed {
+		setAliases = make(map[string]*flagAlias)
+		aliases[flagSet] = setAliases
+	}
+	setAliases[oldName] = &flagAlias{newName: newName, logger: logger}
+	aliasesMu.Unlock()
+	if !installed {
+		// outside of the lock, as SetNormalizeFunc normalizes the names of all flags.
+		normalize := flagSet.GetNormalizeFunc()
+		flagSet.SetNormalizeFunc(func(f *flag.FlagSet, name string) flag.NormalizedName {
+			if newName, ok := resolveAlias(f, name); ok {
+				name = newName
+			}
+			return normalize(f, name)
+		})
+	}
+	return nil
+}
+
+// FlagAliases returns the aliases of flags of `flagSet` registered with `AliasFlag`, keyed by their old names.
+func FlagAliases(flagSet *flag.FlagSet) map[string]string {
+	aliasesMu.RLock()
+	defer aliasesMu.RUnlock()
+	out := make(map[string]string, len(aliases[flagSet]))
+	for oldName, alias := range aliases[flagSet] {
+		out[oldName] = alias.newName
+	}
+	return out
+}
+
+func resolveAlias(flagSet *flag.FlagSet, name string) (string, bool) {
+	aliasesMu.RLock()
+	alias, ok := aliases[flagSet][name]
+	aliasesMu.RUnlock()
+	if !ok {
+		return "", false
+	}
+	aliasesMu.Lock()
+	warn := !alias.warned
+	alias.warned = true
+	aliasesMu.Unlock()
+	if warn && alias.logger != nil {
+		alias.logger.Printf("flagz: flag=%v is deprecated, applying it to its new name flag=%v", name, alias.newName)
+	}
+	return alias.newName, true
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAliasFlag_AppliesOldNameToRenamedFlag(t *testing.T) {
+	set := flag.NewFlagSet("alias", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "cache_size", 1, "size of the cache")
+	logger := &recordingLogger{}
+	require.NoError(t, flagz.AliasFlag(set, "cache_entries", "cache_size", logger))
+	assert.Equal(t, map[string]string{"cache_entries": "cache_size"}, flagz.FlagAliases(set))
+
+	require.NoError(t, set.Parse([]string{"--cache_entries=2"}), "the command line must accept old names")
+	assert.EqualValues(t, 2, dynInt.Get())
+
+	assert.Equal(t, set.Lookup("cache_size"), set.Lookup("cache_entries"), "lookups of old names must find the flag")
+	require.NoError(t, flagz.SetFlagFromSource(set, "cache_entries", "3", "etcd"))
+	assert.EqualValues(t, 3, dynInt.Get(), "updates under old names must be applied")
+	assert.Equal(t, "etcd", flagz.FlagSource(set.Lookup("cache_size")))
+	require.Len(t, logger.lines, 1, "only the first use of an alias must be warned about")
+	assert.Contains(t, logger.lines[0], "flag=cache_entries is deprecated")
+}
+
+func TestAliasFlag_KeepsExistingNormalization(t *testing.T) {
+	set := flag.NewFlagSet("alias", flag.ContinueOnError)
+	set.SetNormalizeFunc(func(f *flag.FlagSet, name string) flag.NormalizedName {
+		return flag.NormalizedName(strings.Replace(name, "-", "_", -1))
+	})
+	dynInt := flagz.DynInt64(set, "cache_size", 1, "size of the cache")
+	require.NoError(t, flagz.AliasFlag(set, "cache_entries", "cache_size", &testingLog{T: t}))
+	require.NoError(t, set.Set("cache-size", "4"))
+	assert.EqualValues(t, 4, dynInt.Get(), "the previous normalization must still apply")
+	require.NoError(t, set.Set("cache_entries", "5"))
+	assert.EqualValues(t, 5, dynInt.Get())
+}
+
+func TestAliasFlag_RejectsExistingFlags(t *testing.T) {
+	set := flag.NewFlagSet("alias", flag.ContinueOnError)
+	flagz.DynInt64(set, "cache_size", 1, "size of the cache")
+	flagz.DynInt64(set, "cache_entries", 1, "entries of the cache")
+	assert.Error(t, flagz.AliasFlag(set, "cache_entries", "cache_size", nil))
+}
@@ -0,0 +1,63 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// AuditRecord describes a single flag change made through one of the flagz endpoints, attributing it to whoever
+// made it.
+type AuditRecord struct {
+	Time     time.Time
+	FlagName string
+	OldValue string
+	NewValue string
+	// Actor identifies who made the change, e.g. the authenticated user or the caller's network address.
+	Actor string
+	// Source is the endpoint the change was made through, e.g. "endpoint" or "grpc".
+	Source string
+}
+
+// AuditSink receives the records of all flag changes made through the flagz endpoints, e.g. to persist them in a
+// compliance log. An error returned by the sink is logged, but doesn't revert the change.
+type AuditSink interface {
+	Audit(record AuditRecord) error
+}
+
+// AuditSinkFunc allows the use of ordinary functions as an AuditSink.
+type AuditSinkFunc func(record AuditRecord) error
+
+// Audit calls f(record).
+func (f AuditSinkFunc) Audit(record AuditRecord) error {
+	return f(record)
+}
+
+// NewLogAuditSink returns an AuditSink that writes every record to `logger`.
+func NewLogAuditSink(logger Logger) AuditSink {
+	return AuditSinkFunc(func(r AuditRecord) error {
+		logger.Printf("flagz: audit: flag=%v changed from=%q to=%q by actor=%v through source=%v at=%v",
+			r.FlagName, r.OldValue, r.NewValue, r.Actor, r.Source, r.Time.Format(time.RFC3339))
+		return nil
+	})
+}
+
+// NewAuditRecord creates the record of changing `f` from `oldValue` to its current value. Values of flags marked as
+// secret are redacted.
+func NewAuditRecord(f *flag.Flag, oldValue string, actor string, source string) AuditRecord {
+	newValue := f.Value.String()
+	if IsFlagSecret(f) {
+		oldValue, newValue = RedactedValue, RedactedValue
+	}
+	return AuditRecord{
+		Time:     time.Now(),
+		FlagName: f.Name,
+		OldValue: oldValue,
+		NewValue: newValue,
+		Actor:    actor,
+		Source:   source,
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAuditRecord_RedactsSecrets(t *testing.T) {
+	set := flag.NewFlagSet("audit", flag.ContinueOnError)
+	flagz.DynString(set, "some_string", "old", "")
+	flagz.DynString(set, "some_password", "old", "")
+	flagz.MarkFlagSecret(set.Lookup("some_password"))
+	set.Set("some_string", "new")
+	set.Set("some_password", "new")
+
+	record := flagz.NewAuditRecord(set.Lookup("some_string"), "old", "alice", "endpoint")
+	assert.Equal(t, "old", record.OldValue)
+	assert.Equal(t, "new", record.NewValue)
+	assert.Equal(t, "alice", record.Actor)
+	assert.False(t, record.Time.IsZero())
+
+	secret := flagz.NewAuditRecord(set.Lookup("some_password"), "old", "alice", "endpoint")
+	assert.Equal(t, flagz.RedactedValue, secret.OldValue, "secret values must be redacted")
+	assert.Equal(t, flagz.RedactedValue, secret.NewValue, "secret values must be redacted")
+}
+
+func TestLogAuditSink(t *testing.T) {
+	logger := &recordingLogger{}
+	err := flagz.NewLogAuditSink(logger).Audit(flagz.AuditRecord{FlagName: "some_string", Actor: "alice"})
+	assert.NoError(t, err)
+	assert.Contains(t, logger.lines[0], "flag=some_string")
+	assert.Contains(t, logger.lines[0], "actor=alice")
+}
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
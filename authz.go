@@ -0,0 +1,40 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+)
+
+// WriteRequest describes a change of a flag proposed through one of the flagz endpoints.
+type WriteRequest struct {
+	// Actor identifies the caller, e.g. the authenticated user or the caller's network address, as returned by the
+	// `WithActor` function of the endpoint.
+	Actor    string
+	FlagName string
+	// Value is the proposed value. It isn't redacted for flags marked as secret, so it must not be logged for them.
+	Value string
+	// Source is the endpoint the change is proposed through, e.g. "endpoint" or "grpc".
+	Source string
+	// Unpin is set for requests clearing the pin of the flag (see `PinFlag`), whose Value is the held update that
+	// unpinning applies, or empty if there is none.
+	Unpin bool
+}
+
+// WriteAuthorizer decides whether proposed flag changes may be made, e.g. by checking per-flag permissions of the
+// actor in a central policy. The same WriteAuthorizer can be used by the HTTP `StatusEndpoint` and the gRPC
+// `FlagzService`, so that all write surfaces enforce the same rules.
+//
+// Returning an error rejects the change, and the error's message is returned to the caller.
+type WriteAuthorizer interface {
+	AuthorizeWrite(ctx context.Context, req WriteRequest) error
+}
+
+// WriteAuthorizerFunc allows the use of ordinary functions as a WriteAuthorizer.
+type WriteAuthorizerFunc func(ctx context.Context, req WriteRequest) error
+
+// AuthorizeWrite calls f(ctx, req).
+func (f WriteAuthorizerFunc) AuthorizeWrite(ctx context.Context, req WriteRequest) error {
+	return f(ctx, req)
+}
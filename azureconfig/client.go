@@ -0,0 +1,190 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package azureconfig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+const (
+	apiVersion = "1.0"
+)
+
+var (
+	// ErrNotModified is returned by `Client.GetSetting` when the setting's etag still matches `ifNoneMatch`.
+	ErrNotModified = fmt.Errorf("setting not modified")
+	// ErrNotFound is returned by `Client.GetSetting` when the setting doesn't exist.
+	ErrNotFound = fmt.Errorf("setting not found")
+)
+
+// Setting is a single key-value of the App Configuration store.
+type Setting struct {
+	Key         string `json:"key"`
+	Label       string `json:"label"`
+	Value       string `json:"value"`
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+}
+
+// Client is the subset of the App Configuration data plane used by the Updater.
+type Client interface {
+	// ListSettings returns all settings whose key starts with `keyPrefix` and that have the given `label`.
+	ListSettings(ctx context.Context, keyPrefix string, label string) ([]*Setting, error)
+	// GetSetting returns a single setting, ErrNotModified if its etag equals `ifNoneMatch` or ErrNotFound.
+	GetSetting(ctx context.Context, key string, label string, ifNoneMatch string) (*Setting, error)
+}
+
+// restClient talks to the App Configuration REST API authenticating with an access key (HMAC-SHA256).
+type restClient struct {
+	endpoint   *url.URL
+	credential string
+	secret     []byte
+	httpClient *http.Client
+}
+
+// NewClientFromConnectionString creates a REST Client from an App Configuration connection string of the form
+// `Endpoint=https://<name>.azconfig.io;Id=<id>;Secret=<secret>`, as shown under "Access keys" in the Azure portal.
+func NewClientFromConnectionString(connectionString string, httpClient *http.Client) (Client, error) {
+	parts := map[string]string{}
+	for _, part := range strings.Split(connectionString, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) == 2 {
+			parts[kv[0]] = kv[1]
+		}
+	}
+	if parts["Endpoint"] == "" || parts["Id"] == "" || parts["Secret"] == "" {
+		return nil, fmt.Errorf("flagz: connection string must contain Endpoint, Id and Secret")
+	}
+	endpoint, err := url.Parse(parts["Endpoint"])
+	if err != nil {
+		return nil, fmt.Errorf("flagz: bad endpoint in connection string: %v", err)
+	}
+	secret, err := base64.StdEncoding.DecodeString(parts["Secret"])
+	if err != nil {
+		return nil, fmt.Errorf("flagz: secret in connection string is not base64: %v", err)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &restClient{endpoint: endpoint, credential: parts["Id"], secret: secret, httpClient: httpClient}, nil
+}
+
+type listResponse struct {
+	Items    []*Setting `json:"items"`
+	NextLink string     `json:"@nextLink"`
+}
+
+func (c *restClient) ListSettings(ctx context.Context, keyPrefix string, label string) ([]*Setting, error) {
+	query := url.Values{}
+	query.Set("key", keyPrefix+"*")
+	query.Set("label", labelFilter(label))
+	query.Set("api-version", apiVersion)
+	next := "/kv?" + query.Encode()
+	settings := []*Setting{}
+	for next != "" {
+		resp, err := c.do(ctx, next, "")
+		if err != nil {
+			return nil, err
+		}
+		page := &listResponse{}
+		err = decodeResponse(resp, page)
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, page.Items...)
+		next = page.NextLink
+	}
+	return settings, nil
+}
+
+func (c *restClient) GetSetting(ctx context.Context, key string, label string, ifNoneMatch string) (*Setting, error) {
+	query := url.Values{}
+	query.Set("label", labelFilter(label))
+	query.Set("api-version", apiVersion)
+	resp, err := c.do(ctx, "/kv/"+url.PathEscape(key)+"?"+query.Encode(), ifNoneMatch)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, ErrNotModified
+	} else if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	setting := &Setting{}
+	if err := decodeResponse(resp, setting); err != nil {
+		return nil, err
+	}
+	return setting, nil
+}
+
+func (c *restClient) do(ctx context.Context, pathAndQuery string, ifNoneMatch string) (*http.Response, error) {
+	reqURL, err := c.endpoint.Parse(pathAndQuery)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.microsoft.appconfig.kvset+json, application/problem+json")
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", `"`+ifNoneMatch+`"`)
+	}
+	c.sign(req)
+	return ctxhttp.Do(ctx, c.httpClient, req)
+}
+
+// sign adds the HMAC-SHA256 authentication headers required by App Configuration access keys.
+func (c *restClient) sign(req *http.Request) {
+	date := time.Now().UTC().Format(http.TimeFormat)
+	emptyHash := sha256.Sum256(nil)
+	contentHash := base64.StdEncoding.EncodeToString(emptyHash[:])
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.URL.RequestURI(),
+		date + ";" + req.URL.Host + ";" + contentHash,
+	}, "\n")
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req.Header.Set("x-ms-date", date)
+	req.Header.Set("x-ms-content-sha256", contentHash)
+	req.Header.Set("Authorization", fmt.Sprintf("HMAC-SHA256 Credential=%s&SignedHeaders=x-ms-date;host;x-ms-content-sha256&Signature=%s",
+		c.credential, signature))
+}
+
+func decodeResponse(resp *http.Response, into interface{}) error {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("app configuration returned %v: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, into)
+}
+
+// labelFilter maps the empty label onto the REST API's null-label filter.
+func labelFilter(label string) string {
+	if label == "" {
+		return "\x00"
+	}
+	return label
+}
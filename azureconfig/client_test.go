@@ -0,0 +1,62 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package azureconfig_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mwitkow/go-flagz/azureconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestRestClient_ListsAllPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "HMAC-SHA256 Credential=someid&"),
+			"requests must be signed with the credential")
+		assert.NotEmpty(t, req.Header.Get("x-ms-date"), "requests must carry the signed date")
+		if req.URL.Query().Get("after") == "" {
+			assert.Equal(t, "svc:*", req.URL.Query().Get("key"), "key filter must match the prefix")
+			resp.Write([]byte(`{"items": [{"key": "svc:a", "value": "1", "etag": "e1"}], "@nextLink": "/kv?after=svc:a"}`))
+		} else {
+			resp.Write([]byte(`{"items": [{"key": "svc:b", "value": "2", "etag": "e2"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := azureconfig.NewClientFromConnectionString("Endpoint="+server.URL+";Id=someid;Secret=c2VjcmV0", nil)
+	require.NoError(t, err, "connection string must parse")
+	settings, err := client.ListSettings(context.Background(), "svc:", "")
+	require.NoError(t, err, "listing must succeed")
+	require.Len(t, settings, 2, "settings from all pages must be returned")
+	assert.Equal(t, "svc:b", settings[1].Key)
+}
+
+func TestRestClient_GetSettingNotModified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("If-None-Match") == `"e1"` {
+			resp.WriteHeader(http.StatusNotModified)
+			return
+		}
+		resp.Write([]byte(`{"key": "svc:Sentinel", "value": "1", "etag": "e1"}`))
+	}))
+	defer server.Close()
+
+	client, err := azureconfig.NewClientFromConnectionString("Endpoint="+server.URL+";Id=someid;Secret=c2VjcmV0", nil)
+	require.NoError(t, err, "connection string must parse")
+	setting, err := client.GetSetting(context.Background(), "svc:Sentinel", "", "")
+	require.NoError(t, err, "get must succeed")
+	assert.Equal(t, "e1", setting.ETag)
+	_, err = client.GetSetting(context.Background(), "svc:Sentinel", "", "e1")
+	assert.Equal(t, azureconfig.ErrNotModified, err, "matching etags must yield ErrNotModified")
+}
+
+func TestNewClientFromConnectionString_RejectsIncomplete(t *testing.T) {
+	_, err := azureconfig.NewClientFromConnectionString("Endpoint=https://foo.azconfig.io;Id=someid", nil)
+	assert.Error(t, err, "a connection string without a secret must be rejected")
+}
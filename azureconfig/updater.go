@@ -0,0 +1,243 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package azureconfig provides an Updater that syncs FlagSet state with an Azure App Configuration store.
+
+package azureconfig
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultSentinelKey     = "Sentinel"
+	defaultRefreshInterval = 30 * time.Second
+	requestTimeout         = 10 * time.Second
+)
+
+// Minimum logger interface needed.
+// Default "log" and "logrus" should support these.
+type loggerCompatible interface {
+	Printf(format string, v ...interface{})
+}
+
+// Updater syncs App Configuration settings starting with a key prefix into a given FlagSet.
+//
+// It follows the store's recommended refresh model: only a single sentinel key is polled, and all settings are
+// re-read when its etag changes. Writers therefore update the sentinel key after they are done changing flag
+// settings, which also makes multi-flag changes apply together.
+type Updater struct {
+	*flagz.UpdaterTracker
+	flagSet         *flag.FlagSet
+	logger          loggerCompatible
+	client          Client
+	keyPrefix       string
+	label           string
+	sentinelKey     string
+	refreshInterval time.Duration
+
+	// lifecycle serializes the lifecycle transitions, see `flagz.UpdaterState`.
+	lifecycle sync.Mutex
+	cancel    context.CancelFunc
+	// done is closed when the polling go routine exits.
+	done chan struct{}
+
+	mu           sync.Mutex
+	sentinelETag string
+	lastETags    map[string]string
+	refresh      chan struct{}
+}
+
+// New constructs a new Updater which maps settings `<keyPrefix><flag_name>` onto flags.
+func New(flagSet *flag.FlagSet, client Client, keyPrefix string, logger loggerCompatible) *Updater {
+	return &Updater{
+		UpdaterTracker:  flagz.NewUpdaterTracker(),
+		flagSet:         flagSet,
+		logger:          logger,
+		client:          client,
+		keyPrefix:       keyPrefix,
+		sentinelKey:     keyPrefix + defaultSentinelKey,
+		refreshInterval: defaultRefreshInterval,
+		lastETags:       make(map[string]string),
+		refresh:         make(chan struct{}, 1),
+	}
+}
+
+// WithLabel selects the label of the settings (e.g. an environment name). Defaults to the empty label.
+func (u *Updater) WithLabel(label string) *Updater {
+	u.label = label
+	return u
+}
+
+// WithSentinelKey sets the full key of the sentinel setting. Defaults to `<keyPrefix>Sentinel`.
+func (u *Updater) WithSentinelKey(key string) *Updater {
+	u.sentinelKey = key
+	return u
+}
+
+// WithRefreshInterval sets how often the sentinel key is polled. Defaults to 30s.
+func (u *Updater) WithRefreshInterval(interval time.Duration) *Updater {
+	u.refreshInterval = interval
+	return u
+}
+
+// Initialize reads all settings of the prefix and sets all flags (dynamic and static) into the FlagSet.
+func (u *Updater) Initialize() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.CheckTransition(flagz.UpdaterInitialized); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, err := u.checkSentinel(); err != nil {
+		return fmt.Errorf("flagz: reading sentinel key: %v", err)
+	}
+	if err := u.readAll(context.Background(), false /* dynamicOnly */); err != nil {
+		return err
+	}
+	return u.Transition(flagz.UpdaterInitialized)
+}
+
+// Start kicks off the go routine that polls the sentinel key and re-reads settings when it changes.
+func (u *Updater) Start() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.Transition(flagz.UpdaterWatching); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
+	u.done = make(chan struct{})
+	go u.pollForUpdates(ctx, u.done)
+	return nil
+}
+
+// Stop stops the auto-updating go-routine and waits for it to exit. Stopping an Updater that isn't polling is a no-op.
+func (u *Updater) Stop() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if u.State() != flagz.UpdaterWatching {
+		return nil
+	}
+	u.cancel()
+	<-u.done
+	return u.Transition(flagz.UpdaterStopped)
+}
+
+// Refresh asks the polling go-routine to check the sentinel key immediately, e.g. from an Event Grid push
+// notification handler.
+func (u *Updater) Refresh() {
+	select {
+	case u.refresh <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
+}
+
+func (u *Updater) pollForUpdates(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	u.logger.Printf("flagz: app configuration poller started")
+	ticker := time.NewTicker(u.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-u.refresh:
+		case <-ctx.Done():
+			u.logger.Printf("flagz: app configuration poller exited")
+			return
+		}
+		u.mu.Lock()
+		changed, err := u.checkSentinel()
+		if err != nil {
+			u.logger.Printf("flagz: failed checking sentinel key %v: %v", u.sentinelKey, err)
+		} else if changed {
+			u.logger.Printf("flagz: sentinel key %v changed, re-reading settings", u.sentinelKey)
+			if err = u.readAll(ctx, true /* dynamicOnly */); err != nil {
+				u.logger.Printf("flagz: app configuration reload yielded errors: %v", err.Error())
+			}
+		}
+		u.RecordSync(err)
+		u.mu.Unlock()
+	}
+}
+
+// checkSentinel returns whether the sentinel key changed since last checked. Must be called under `mu`.
+func (u *Updater) checkSentinel() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	setting, err := u.client.GetSetting(ctx, u.sentinelKey, u.label, u.sentinelETag)
+	if err == ErrNotModified || err == ErrNotFound {
+		// a missing sentinel means writers haven't signalled any change yet.
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	u.sentinelETag = setting.ETag
+	u.RecordRevision(setting.ETag)
+	return true, nil
+}
+
+// readAll applies all settings whose etag changed since they were last applied. Must be called under `mu`.
+func (u *Updater) readAll(ctx context.Context, dynamicOnly bool) error {
+	listCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	settings, err := u.client.ListSettings(listCtx, u.keyPrefix, u.label)
+	if err != nil {
+		return fmt.Errorf("flagz: listing app configuration settings: %v", err)
+	}
+	errs := &flagz.FlagErrors{Source: "app configuration"}
+	for _, setting := range settings {
+		if setting.Key == u.sentinelKey {
+			continue
+		}
+		if last, ok := u.lastETags[setting.Key]; ok && last == setting.ETag {
+			continue
+		}
+		flagName := strings.TrimPrefix(setting.Key, u.keyPrefix)
+		err := u.setFlag(ctx, flagName, setting.Value, dynamicOnly)
+		shownValue := flagz.RedactFlagValue(u.flagSet.Lookup(flagName), setting.Value)
+		if errors.Is(err, flagz.ErrFlagNotDynamic) && dynamicOnly {
+			u.logger.Printf("flagz: ignoring updating flag=%v, because of: %v", flagName, err)
+			continue
+		} else if errors.Is(err, flagz.ErrFlagPinned) {
+			// held until the flag is unpinned, which applies it.
+			u.logger.Printf("flagz: holding update of pinned flag=%v until it is unpinned", flagName)
+			u.lastETags[setting.Key] = setting.ETag
+			continue
+		} else if err != nil {
+			errs.Add(flagName, err)
+			if dynamicOnly {
+				u.RecordUpdate(flagName, shownValue, err)
+			}
+			continue
+		}
+		u.lastETags[setting.Key] = setting.ETag
+		if dynamicOnly {
+			u.logger.Printf("flagz: updated flag=%v to value=%v at etag=%v", flagName, shownValue, setting.ETag)
+			u.RecordUpdate(flagName, shownValue, nil)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+func (u *Updater) setFlag(ctx context.Context, flagName string, value string, dynamicOnly bool) error {
+	flag := u.flagSet.Lookup(flagName)
+	if flag == nil {
+		return flagz.ErrFlagNotFound
+	}
+	if dynamicOnly && !flagz.IsFlagDynamic(flag) {
+		return flagz.ErrFlagNotDynamic
+	}
+	// do not call flag.Value.Set, instead go through flagSet.Set (via SetFlagFromSource) to change "changed" state.
+	return flagz.SetFlagFromSourceCtx(ctx, u.flagSet, flagName, value, "azureconfig")
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package azureconfig_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/azureconfig"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+const (
+	prefix = "testsvc:"
+)
+
+type updaterTestSuite struct {
+	suite.Suite
+
+	store *fakeStore
+
+	flagSet   *flag.FlagSet
+	staticInt *int32
+	dynInt    *flagz.DynInt64Value
+
+	updater *azureconfig.Updater
+}
+
+func (s *updaterTestSuite) SetupTest() {
+	s.store = &fakeStore{settings: map[string]*azureconfig.Setting{}}
+	s.store.put(prefix+"some_int", "1234")
+	s.store.put(prefix+"some_dynint", "10001")
+	s.store.put("othersvc:some_dynint", "999")
+
+	s.flagSet = flag.NewFlagSet("updater_test", flag.ContinueOnError)
+	s.dynInt = flagz.DynInt64(s.flagSet, "some_dynint", 1, "dynamic int for testing")
+	s.staticInt = s.flagSet.Int32("some_int", 1, "static int for testing")
+
+	s.updater = azureconfig.New(s.flagSet, s.store, prefix, &testingLog{T: s.T()}).WithRefreshInterval(10 * time.Second)
+}
+
+func (s *updaterTestSuite) TearDownTest() {
+	s.updater.Stop()
+	time.Sleep(50 * time.Millisecond)
+}
+
+func (s *updaterTestSuite) TestInitializeSetsValues() {
+	require.NoError(s.T(), s.updater.Initialize(), "initialize should not return errors on good flags")
+	assert.EqualValues(s.T(), 1234, *s.staticInt, "staticInt should be set from the store")
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "dynInt should be set from its prefixed key only")
+}
+
+func (s *updaterTestSuite) TestInitializeFailsOnUnknownFlag() {
+	s.store.put(prefix+"unknown_flag", "1")
+	require.Error(s.T(), s.updater.Initialize(), "initialize should complain about unknown flags")
+}
+
+func (s *updaterTestSuite) TestChangesApplyOnlyAfterSentinelUpdate() {
+	require.NoError(s.T(), s.updater.Initialize())
+	require.NoError(s.T(), s.updater.Start())
+
+	s.store.put(prefix+"some_dynint", "20002")
+	s.updater.Refresh()
+	time.Sleep(100 * time.Millisecond)
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "changes must not be applied until the sentinel changes")
+
+	s.store.put(prefix+"Sentinel", "1")
+	s.updater.Refresh()
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, 20002,
+		func() interface{} { return s.dynInt.Get() },
+		"some_dynint value should change after the sentinel was updated")
+}
+
+var _ flagz.Updater = &azureconfig.Updater{}
+
+func TestUpdaterSuite(t *testing.T) {
+	suite.Run(t, &updaterTestSuite{})
+}
+
+// fakeStore is an in-memory Client, using a global counter for etags.
+type fakeStore struct {
+	mu       sync.Mutex
+	etag     int
+	settings map[string]*azureconfig.Setting
+}
+
+func (f *fakeStore) put(key string, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.etag++
+	f.settings[key] = &azureconfig.Setting{Key: key, Value: value, ETag: fmt.Sprintf("etag%d", f.etag)}
+}
+
+func (f *fakeStore) ListSettings(ctx context.Context, keyPrefix string, label string) ([]*azureconfig.Setting, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ret := []*azureconfig.Setting{}
+	for key, setting := range f.settings {
+		if strings.HasPrefix(key, keyPrefix) {
+			ret = append(ret, setting)
+		}
+	}
+	return ret, nil
+}
+
+func (f *fakeStore) GetSetting(ctx context.Context, key string, label string, ifNoneMatch string) (*azureconfig.Setting, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	setting, ok := f.settings[key]
+	if !ok {
+		return nil, azureconfig.ErrNotFound
+	}
+	if setting.ETag == ifNoneMatch {
+		return nil, azureconfig.ErrNotModified
+	}
+	return setting, nil
+}
+
+type assertFunc func(expected, actual interface{}) bool
+type getter func() interface{}
+
+// eventually tries a given Assert function 5 times over the period of time.
+func eventually(t *testing.T, duration time.Duration,
+	af assertFunc, expected interface{}, actual getter, msgFmt string, msgArgs ...interface{}) {
+	increment := duration / 5
+	for i := 0; i < 5; i++ {
+		time.Sleep(increment)
+		if af(expected, actual()) {
+			return
+		}
+	}
+	t.Fatalf(msgFmt, msgArgs...)
+}
+
+// Abstraction that allows us to pass the *testing.T as a logger to the updater.
+type testingLog struct {
+	T *testing.T
+}
+
+func (tl *testingLog) Printf(format string, v ...interface{}) {
+	tl.T.Logf(format+"\n", v...)
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package breadcrumbs records the recent changes of flags and annotates traces and error reports with them, as
+// OpenTelemetry span events and Sentry breadcrumbs, so that a regression can be tied to a flag flipped shortly before.
+
+package breadcrumbs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+)
+
+const (
+	// DefaultCapacity is the number of changes kept by a Recorder by default.
+	DefaultCapacity = 100
+	// DefaultWindow is the default age of the changes annotating traces and error reports.
+	DefaultWindow = 5 * time.Minute
+)
+
+// Change is a single change of a flag.
+type Change struct {
+	Time     time.Time
+	FlagName string
+	// Value is the new value of the flag, redacted for secrets.
+	Value string
+	// Source is where the change came from, e.g. "etcd" or "endpoint".
+	Source string
+	// Revision is the backend-specific revision of the change, if any.
+	Revision string
+	// Actor is who made the change, if known, see `flagz.AuditRecord`.
+	Actor string
+}
+
+// Recorder keeps the most recent changes of flags in a ring buffer. It is safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	changes []Change
+	next    int
+	full    bool
+}
+
+// NewRecorder constructs a Recorder keeping the last `capacity` changes, or DefaultCapacity if it isn't positive.
+func NewRecorder(capacity int) *Recorder {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Recorder{changes: make([]Change, capacity)}
+}
+
+// Record adds `change`, dropping the oldest change if the Recorder is full. A zero Time is set to the current time.
+func (r *Recorder) Record(change Change) {
+	if change.Time.IsZero() {
+		change.Time = time.Now()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.changes[r.next] = change
+	r.next = (r.next + 1) % len(r.changes)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Recent returns the changes made within `window` before now, oldest first.
+func (r *Recorder) Recent(window time.Duration) []Change {
+	cutoff := time.Now().Add(-window)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ordered []Change
+	if r.full {
+		ordered = append(ordered, r.changes[r.next:]...)
+	}
+	ordered = append(ordered, r.changes[:r.next]...)
+	recent := []Change{}
+	for _, change := range ordered {
+		if !change.Time.Before(cutoff) {
+			recent = append(recent, change)
+		}
+	}
+	return recent
+}
+
+// WatchUpdater records the flags successfully updated by `updater` until `ctx` is done, consuming its `Events`, which
+// therefore must have no other consumer. Rejected updates aren't recorded, as they didn't change anything.
+func (r *Recorder) WatchUpdater(ctx context.Context, updater flagz.Updater, source string) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-updater.Events():
+				if event.Err != nil {
+					continue
+				}
+				r.Record(Change{
+					Time:     event.Time,
+					FlagName: event.FlagName,
+					Value:    event.Value,
+					Source:   source,
+					Revision: event.Revision,
+				})
+			}
+		}
+	}()
+}
+
+// AuditSink returns a `flagz.AuditSink` recording the changes made through the flagz endpoints and passing them on to
+// `next` (if not nil), to be set on the endpoints with `WithAuditSink`.
+func (r *Recorder) AuditSink(next flagz.AuditSink) flagz.AuditSink {
+	return flagz.AuditSinkFunc(func(record flagz.AuditRecord) error {
+		r.Record(Change{
+			Time:     record.Time,
+			FlagName: record.FlagName,
+			Value:    record.NewValue,
+			Source:   record.Source,
+			Actor:    record.Actor,
+		})
+		if next != nil {
+			return next.Audit(record)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package breadcrumbs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/breadcrumbs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_KeepsTheLastChanges(t *testing.T) {
+	r := breadcrumbs.NewRecorder(2)
+	r.Record(breadcrumbs.Change{FlagName: "a"})
+	r.Record(breadcrumbs.Change{FlagName: "b"})
+	r.Record(breadcrumbs.Change{FlagName: "c"})
+	recent := r.Recent(time.Minute)
+	require.Len(t, recent, 2, "the oldest changes must be dropped")
+	assert.Equal(t, "b", recent[0].FlagName, "changes must be ordered oldest first")
+	assert.Equal(t, "c", recent[1].FlagName)
+	assert.False(t, recent[1].Time.IsZero(), "changes must be timestamped")
+}
+
+func TestRecorder_RecentIsWindowed(t *testing.T) {
+	r := breadcrumbs.NewRecorder(0)
+	r.Record(breadcrumbs.Change{FlagName: "old", Time: time.Now().Add(-time.Hour)})
+	r.Record(breadcrumbs.Change{FlagName: "new", Time: time.Now().Add(-30 * time.Second)})
+	recent := r.Recent(breadcrumbs.DefaultWindow)
+	require.Len(t, recent, 1)
+	assert.Equal(t, "new", recent[0].FlagName)
+	assert.Empty(t, breadcrumbs.NewRecorder(0).Recent(time.Minute))
+}
+
+func TestRecorder_WatchUpdater(t *testing.T) {
+	r := breadcrumbs.NewRecorder(0)
+	updater := &fakeUpdater{UpdaterTracker: flagz.NewUpdaterTracker()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.WatchUpdater(ctx, updater, "etcd")
+	updater.RecordRevision("42")
+	updater.RecordUpdate("bad_flag", "nope", errors.New("bad value"))
+	updater.RecordUpdate("some_flag", "1", nil)
+	require.Eventually(t, func() bool { return len(r.Recent(time.Minute)) == 1 }, time.Second, time.Millisecond,
+		"only applied updates must be recorded")
+	change := r.Recent(time.Minute)[0]
+	assert.Equal(t, "some_flag", change.FlagName)
+	assert.Equal(t, "etcd", change.Source)
+	assert.Equal(t, "42", change.Revision)
+}
+
+func TestRecorder_AuditSink(t *testing.T) {
+	r := breadcrumbs.NewRecorder(0)
+	var passedOn []flagz.AuditRecord
+	sink := r.AuditSink(flagz.AuditSinkFunc(func(record flagz.AuditRecord) error {
+		passedOn = append(passedOn, record)
+		return nil
+	}))
+	record := flagz.AuditRecord{Time: time.Now(), FlagName: "some_flag", NewValue: "2", Actor: "alice",
+		Source: "endpoint"}
+	require.NoError(t, sink.Audit(record))
+	assert.Len(t, passedOn, 1, "records must be passed on to the next sink")
+	recent := r.Recent(time.Minute)
+	require.Len(t, recent, 1)
+	assert.Equal(t, "alice", recent[0].Actor)
+	assert.NoError(t, r.AuditSink(nil).Audit(record))
+}
+
+type fakeUpdater struct {
+	*flagz.UpdaterTracker
+}
+
+func (f *fakeUpdater) Initialize() error { return nil }
+func (f *fakeUpdater) Start() error      { return nil }
+func (f *fakeUpdater) Stop() error       { return nil }
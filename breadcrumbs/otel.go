@@ -0,0 +1,59 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package breadcrumbs
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanEventName is the name of the span events of changes.
+const SpanEventName = "flagz.change"
+
+// AnnotateSpan adds a SpanEventName event to `span` for every change made within `window`, timestamped with the time
+// of the change and carrying its flag, value, source and revision.
+func (r *Recorder) AnnotateSpan(span trace.Span, window time.Duration) {
+	for _, change := range r.Recent(window) {
+		span.AddEvent(SpanEventName, trace.WithTimestamp(change.Time), trace.WithAttributes(
+			attribute.String("flagz.flag", change.FlagName),
+			attribute.String("flagz.value", change.Value),
+			attribute.String("flagz.source", change.Source),
+			attribute.String("flagz.revision", change.Revision),
+			attribute.String("flagz.age", time.Since(change.Time).Round(time.Millisecond).String()),
+		))
+	}
+}
+
+// SpanProcessor returns an OpenTelemetry SpanProcessor annotating the local root spans (those of requests entering the
+// process) with the changes made within `window` before they start, see `AnnotateSpan`. Register it with
+// `sdktrace.WithSpanProcessor`.
+func (r *Recorder) SpanProcessor(window time.Duration) sdktrace.SpanProcessor {
+	return &spanProcessor{recorder: r, window: window}
+}
+
+type spanProcessor struct {
+	recorder *Recorder
+	window   time.Duration
+}
+
+func (p *spanProcessor) OnStart(parent context.Context, span sdktrace.ReadWriteSpan) {
+	if span.Parent().IsValid() && !span.Parent().IsRemote() {
+		return
+	}
+	p.recorder.AnnotateSpan(span, p.window)
+}
+
+func (p *spanProcessor) OnEnd(span sdktrace.ReadOnlySpan) {}
+
+func (p *spanProcessor) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (p *spanProcessor) ForceFlush(ctx context.Context) error {
+	return nil
+}
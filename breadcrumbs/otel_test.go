@@ -0,0 +1,40 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package breadcrumbs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz/breadcrumbs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRecorder_SpanProcessorAnnotatesRootSpans(t *testing.T) {
+	r := breadcrumbs.NewRecorder(0)
+	changed := time.Now().Add(-30 * time.Second)
+	r.Record(breadcrumbs.Change{Time: changed, FlagName: "some_flag", Value: "true", Source: "etcd"})
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(r.SpanProcessor(time.Minute)),
+		sdktrace.WithSpanProcessor(spans))
+	tracer := provider.Tracer("test")
+	ctx, root := tracer.Start(context.Background(), "request")
+	_, child := tracer.Start(ctx, "query")
+	child.End()
+	root.End()
+
+	ended := spans.Ended()
+	require.Len(t, ended, 2)
+	assert.Empty(t, ended[0].Events(), "child spans must not be annotated")
+	events := ended[1].Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, breadcrumbs.SpanEventName, events[0].Name)
+	assert.True(t, changed.Equal(events[0].Time), "events must carry the time of the change")
+	assert.Contains(t, events[0].Attributes, attribute.String("flagz.flag", "some_flag"))
+}
@@ -0,0 +1,56 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package breadcrumbs
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// SentryCategory is the category of the Sentry breadcrumbs of changes.
+const SentryCategory = "flagz"
+
+// SentryBreadcrumbs returns a Sentry breadcrumb for every change made within `window`, oldest first.
+func (r *Recorder) SentryBreadcrumbs(window time.Duration) []*sentry.Breadcrumb {
+	changes := r.Recent(window)
+	breadcrumbs := make([]*sentry.Breadcrumb, 0, len(changes))
+	for _, change := range changes {
+		data := map[string]interface{}{"flag": change.FlagName, "value": change.Value, "source": change.Source}
+		if change.Revision != "" {
+			data["revision"] = change.Revision
+		}
+		if change.Actor != "" {
+			data["actor"] = change.Actor
+		}
+		breadcrumbs = append(breadcrumbs, &sentry.Breadcrumb{
+			Type:      "info",
+			Category:  SentryCategory,
+			Message:   fmt.Sprintf("flag %v changed to %v", change.FlagName, change.Value),
+			Data:      data,
+			Level:     sentry.LevelInfo,
+			Timestamp: change.Time,
+		})
+	}
+	return breadcrumbs
+}
+
+// SentryEventProcessor returns a Sentry EventProcessor adding the breadcrumbs of the changes made within `window` to
+// every reported event, in time order with its other breadcrumbs. Unlike breadcrumbs added when flags change, they
+// aren't pushed out by the breadcrumb limit of the scope. Set it with `sentry.Scope.AddEventProcessor`.
+func (r *Recorder) SentryEventProcessor(window time.Duration) sentry.EventProcessor {
+	return func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+		breadcrumbs := r.SentryBreadcrumbs(window)
+		if len(breadcrumbs) == 0 {
+			return event
+		}
+		event.Breadcrumbs = append(event.Breadcrumbs, breadcrumbs...)
+		sort.SliceStable(event.Breadcrumbs, func(i, j int) bool {
+			return event.Breadcrumbs[i].Timestamp.Before(event.Breadcrumbs[j].Timestamp)
+		})
+		return event
+	}
+}
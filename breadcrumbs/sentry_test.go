@@ -0,0 +1,34 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package breadcrumbs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/mwitkow/go-flagz/breadcrumbs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_SentryEventProcessor(t *testing.T) {
+	r := breadcrumbs.NewRecorder(0)
+	now := time.Now()
+	r.Record(breadcrumbs.Change{Time: now.Add(-30 * time.Second), FlagName: "some_flag", Value: "true",
+		Source: "endpoint", Actor: "alice"})
+	event := &sentry.Event{Breadcrumbs: []*sentry.Breadcrumb{
+		{Message: "earlier", Timestamp: now.Add(-time.Minute)},
+		{Message: "later", Timestamp: now.Add(-time.Second)},
+	}}
+	event = r.SentryEventProcessor(time.Minute)(event, nil)
+	require.Len(t, event.Breadcrumbs, 3)
+	crumb := event.Breadcrumbs[1]
+	assert.Equal(t, breadcrumbs.SentryCategory, crumb.Category, "breadcrumbs must be ordered by time")
+	assert.Equal(t, "flag some_flag changed to true", crumb.Message)
+	assert.Equal(t, "alice", crumb.Data["actor"])
+	assert.NotContains(t, crumb.Data, "revision", "unknown revisions must be left out")
+
+	assert.Len(t, breadcrumbs.NewRecorder(0).SentryEventProcessor(time.Minute)(&sentry.Event{}, nil).Breadcrumbs, 0)
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+const (
+	// CanaryValuePrefix marks values only meant for a percentage of the instances, followed by the JSON of a
+	// CanaryValue, e.g. `canary:{"percentage":10,"value":"true","otherwise":"false"}`.
+	CanaryValuePrefix = "canary:"
+
+	// canarySalt is the same for all flags, so that canaries of the same percentage go to the same instances.
+	canarySalt = "flagz-canary"
+)
+
+// ErrNotInCanary is returned by `CanaryFlagValue` for instances outside of the canary of a value without an Otherwise.
+// Updaters ignore the value on those instances, keeping the current one.
+var ErrNotInCanary = errors.New("instance is not in the canary of the value")
+
+// CanaryValue is a flag value applied by a Percentage of the instances, decided by a stable hash of their instance
+// IDs, so risky changes can soak on a subset of the fleet before a follow-up write promotes them to all instances.
+// Raising the Percentage keeps the instances already in the canary in it.
+type CanaryValue struct {
+	Percentage float64 `json:"percentage"`
+	Value      string  `json:"value"`
+	// Otherwise is applied by instances outside of the canary, e.g. so that they start with it after a restart. If
+	// empty, they keep their current value.
+	Otherwise string `json:"otherwise,omitempty"`
+}
+
+// IsCanaryValue tells whether `value` carries a CanaryValue.
+func IsCanaryValue(value string) bool {
+	return strings.HasPrefix(value, CanaryValuePrefix)
+}
+
+// ParseCanaryValue parses a value with the `CanaryValuePrefix`, as produced by `CanaryValue.Encode`.
+func ParseCanaryValue(value string) (*CanaryValue, error) {
+	if !IsCanaryValue(value) {
+		return nil, fmt.Errorf("canary value must start with %q", CanaryValuePrefix)
+	}
+	canary := &CanaryValue{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(value, CanaryValuePrefix)), canary); err != nil {
+		return nil, fmt.Errorf("parsing canary value: %v", err)
+	}
+	if err := validPercentage(canary.Percentage); err != nil {
+		return nil, fmt.Errorf("canary value: %v", err)
+	}
+	return canary, nil
+}
+
+// Encode returns the value to write to a backend for the CanaryValue.
+func (c *CanaryValue) Encode() (string, error) {
+	if err := validPercentage(c.Percentage); err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return CanaryValuePrefix + string(out), nil
+}
+
+// InCanary tells whether the instance `instanceID` is among the Percentage of instances applying the Value.
+func (c *CanaryValue) InCanary(instanceID string) bool {
+	return percentageBucket(canarySalt, instanceID) < uint64(math.Round(c.Percentage*percentageBuckets/100))
+}
+
+// CanaryFlagValue returns the value instance `instanceID` should apply for `value` if it has the `CanaryValuePrefix`,
+// or ErrNotInCanary if it should keep its current one, and `value` itself otherwise.
+func CanaryFlagValue(instanceID string, value string) (string, error) {
+	if !IsCanaryValue(value) {
+		return value, nil
+	}
+	canary, err := ParseCanaryValue(value)
+	if err != nil {
+		return "", err
+	}
+	if canary.InCanary(instanceID) {
+		return canary.Value, nil
+	}
+	if canary.Otherwise != "" {
+		return canary.Otherwise, nil
+	}
+	return "", ErrNotInCanary
+}
+
+// DefaultInstanceID is the instance ID used by Updaters to decide whether they are in the canary of a value, unless
+// set otherwise (e.g. `watcher.WithInstanceID`). It is the host name, e.g. the pod name in Kubernetes.
+func DefaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
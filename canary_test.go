@@ -0,0 +1,71 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func canaryInstances(canary *flagz.CanaryValue) map[string]bool {
+	out := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		instance := fmt.Sprintf("frontend-%d", i)
+		if canary.InCanary(instance) {
+			out[instance] = true
+		}
+	}
+	return out
+}
+
+func TestCanaryValue_SelectsStablePercentageOfInstances(t *testing.T) {
+	ten := canaryInstances(&flagz.CanaryValue{Percentage: 10})
+	assert.InDelta(t, 100, len(ten), 30, "about 10% of instances must be in the canary")
+	fifty := canaryInstances(&flagz.CanaryValue{Percentage: 50})
+	for instance := range ten {
+		assert.True(t, fifty[instance], "instances must stay in growing canaries")
+	}
+	assert.Empty(t, canaryInstances(&flagz.CanaryValue{Percentage: 0}))
+	assert.Len(t, canaryInstances(&flagz.CanaryValue{Percentage: 100}), 1000)
+}
+
+func TestCanaryFlagValue(t *testing.T) {
+	canary := &flagz.CanaryValue{Percentage: 50, Value: "new"}
+	encoded, err := canary.Encode()
+	require.NoError(t, err)
+	assert.True(t, flagz.IsCanaryValue(encoded))
+	var in, out string
+	for instance := range canaryInstances(&flagz.CanaryValue{Percentage: 100}) {
+		if canary.InCanary(instance) {
+			in = instance
+		} else {
+			out = instance
+		}
+	}
+
+	value, err := flagz.CanaryFlagValue(in, encoded)
+	require.NoError(t, err)
+	assert.Equal(t, "new", value, "instances in the canary must apply the value")
+	_, err = flagz.CanaryFlagValue(out, encoded)
+	assert.Equal(t, flagz.ErrNotInCanary, err, "instances outside of the canary must keep their value")
+
+	canary.Otherwise = "old"
+	encoded, err = canary.Encode()
+	require.NoError(t, err)
+	value, err = flagz.CanaryFlagValue(out, encoded)
+	require.NoError(t, err)
+	assert.Equal(t, "old", value, "instances outside of the canary must apply otherwise if set")
+
+	value, err = flagz.CanaryFlagValue(out, "plain")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", value, "values without the prefix must be passed through")
+	for _, input := range []string{`canary:{"percentage": 101, "value": "x"}`, `canary:10:x`} {
+		_, err := flagz.CanaryFlagValue(in, input)
+		assert.Error(t, err, "value %v must be rejected", input)
+	}
+}
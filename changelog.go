@@ -0,0 +1,186 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// ReplaySource is the source recorded by `Replay` for the values it sets, see `FlagSource`.
+const ReplaySource = "replay"
+
+// DefaultChangeLogCapacity is the number of entries kept in memory by a ChangeLog by default.
+const DefaultChangeLogCapacity = 1000
+
+var changeLog atomic.Value // holds a *ChangeLog, nil for none.
+
+// ChangeLogEntry is a single applied change of a dynamic flag, as recorded by a ChangeLog.
+type ChangeLogEntry struct {
+	// Index is the position of the change in the ChangeLog, starting at 1.
+	Index    uint64    `json:"index"`
+	Time     time.Time `json:"time"`
+	FlagName string    `json:"flag"`
+	// Value is the value of the flag after the change, RedactedValue for secrets.
+	Value string `json:"value"`
+	// Source is where the change came from, see `SetFlagFromSource`.
+	Source string `json:"source"`
+	// Revision and Key are the backend-specific revision and key of the change, e.g. the etcd index and key, if the
+	// Updater passed them in the UpdateInfo of `SetFlagFromSourceCtx`.
+	Revision string `json:"revision,omitempty"`
+	Key      string `json:"key,omitempty"`
+}
+
+// ChangeLog is an append-only log of the changes of dynamic flags applied through `SetFlagFromSource` (i.e. by all
+// Updaters, the flagz endpoints and `LoadFromFile`), recorded once it is installed with `SetChangeLog`. Together with
+// `Replay` it allows for time-travel debugging of incidents triggered by configuration: the sequence of changes of an
+// instance can be reapplied, up to any point in time, to a FlagSet of a repro environment.
+//
+// The last entries are kept in memory, and all of them are written as JSON lines to the writer set with `WithWriter`,
+// e.g. a file opened for appending, which `ReadChangeLog` reads back. It is safe for concurrent use.
+type ChangeLog struct {
+	mu       sync.Mutex
+	capacity int
+	entries  []ChangeLogEntry
+	index    uint64
+	writer   io.Writer
+	logger   Logger
+}
+
+// NewChangeLog constructs a ChangeLog keeping the last `capacity` entries in memory, or DefaultChangeLogCapacity if it
+// isn't positive.
+func NewChangeLog(capacity int) *ChangeLog {
+	if capacity <= 0 {
+		capacity = DefaultChangeLogCapacity
+	}
+	return &ChangeLog{capacity: capacity}
+}
+
+// WithWriter makes the ChangeLog write all its entries to `writer` as JSON lines, logging failures to `logger`.
+func (l *ChangeLog) WithWriter(writer io.Writer, logger Logger) *ChangeLog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.writer = writer
+	l.logger = logger
+	return l
+}
+
+// Record appends the change of flag `f` to its current value by `info.Source`, at the revision and key of `info`.
+func (l *ChangeLog) Record(f *flag.Flag, info UpdateInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.index++
+	entry := ChangeLogEntry{
+		Index:    l.index,
+		Time:     time.Now(),
+		FlagName: f.Name,
+		Value:    RedactFlagValue(f, f.Value.String()),
+		Source:   info.Source,
+		Revision: info.Revision,
+		Key:      info.Key,
+	}
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > l.capacity {
+		l.entries = l.entries[len(l.entries)-l.capacity:]
+	}
+	if l.writer == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err == nil {
+		_, err = l.writer.Write(append(line, '\n'))
+	}
+	if err != nil && l.logger != nil {
+		l.logger.Printf("flagz: failed writing change log entry of flag=%v: %v", f.Name, err)
+	}
+}
+
+// Entries returns the entries kept in memory, oldest first.
+func (l *ChangeLog) Entries() []ChangeLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]ChangeLogEntry(nil), l.entries...)
+}
+
+// SetChangeLog makes `log` record the changes of all dynamic flags applied through `SetFlagFromSource`. A nil `log`
+// stops recording.
+func SetChangeLog(log *ChangeLog) {
+	changeLog.Store(log)
+}
+
+// recordChange records the change of `f` by `source` in the ChangeLog set with `SetChangeLog`, if any, along with the
+// UpdateInfo carried by `ctx`. Flags of the shadow FlagSets of a Coordinator are skipped, as the values it applies are
+// recorded on its FlagSet.
+func recordChange(ctx context.Context, f *flag.Flag, source string) {
+	log, _ := changeLog.Load().(*ChangeLog)
+	if log == nil || !IsFlagDynamic(f) {
+		return
+	}
+	if _, shadow := f.Value.(*shadowValue); shadow {
+		return
+	}
+	info, _ := UpdateInfoFromContext(ctx)
+	info.Source = source
+	log.Record(f, info)
+}
+
+// ReadChangeLog reads the entries written by a ChangeLog `WithWriter`.
+func ReadChangeLog(reader io.Reader) ([]ChangeLogEntry, error) {
+	entries := []ChangeLogEntry{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := ChangeLogEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("flagz: decoding change log entry at line %d: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("flagz: reading change log: %v", err)
+	}
+	return entries, nil
+}
+
+// Replay reapplies `entries` to `flagSet` in order, up to the ones recorded at `until` (all of them if it is zero),
+// leaving its dynamic flags as they were on the recording instance at that time, provided that they started from the
+// same values.
+//
+// All entries are applied, even if some fail; their failures (including entries of unknown or static flags) are
+// returned as a `*FlagErrors`. Redacted values of secret flags are skipped.
+func Replay(flagSet *flag.FlagSet, entries []ChangeLogEntry, until time.Time) error {
+	errs := &FlagErrors{Source: ReplaySource}
+	for _, entry := range entries {
+		if !until.IsZero() && entry.Time.After(until) {
+			break
+		}
+		f := flagSet.Lookup(entry.FlagName)
+		if f == nil {
+			errs.Add(entry.FlagName, ErrFlagNotFound)
+			continue
+		}
+		if !IsFlagDynamic(f) {
+			errs.Add(entry.FlagName, ErrFlagNotDynamic)
+			continue
+		}
+		if IsFlagSecret(f) && entry.Value == RedactedValue {
+			continue
+		}
+		if err := SetFlagFromSource(flagSet, entry.FlagName, entry.Value, ReplaySource); err != nil {
+			errs.Add(entry.FlagName, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
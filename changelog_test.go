@@ -0,0 +1,135 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeLog_RecordsAndReplaysChanges(t *testing.T) {
+	set := flag.NewFlagSet("recorded", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_int", 1, "Some int")
+	flagz.DynString(set, "some_string", "foo", "Some string")
+	set.Int("some_static_int", 1, "Some static int")
+
+	out := &bytes.Buffer{}
+	changeLog := flagz.NewChangeLog(0).WithWriter(out, &testingLog{t})
+	flagz.SetChangeLog(changeLog)
+	defer flagz.SetChangeLog(nil)
+
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_int", "2", "etcd"))
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_string", "bar", "endpoint"))
+	require.Error(t, flagz.SetFlagFromSource(set, "some_int", "notanint", "etcd"))
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_static_int", "2", "etcd"))
+	midpoint := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_int", "3", "etcd"))
+
+	entries := changeLog.Entries()
+	require.Len(t, entries, 3, "only applied changes of dynamic flags must be recorded")
+	assert.Equal(t, uint64(1), entries[0].Index)
+	assert.Equal(t, "some_int", entries[0].FlagName)
+	assert.Equal(t, "2", entries[0].Value)
+	assert.Equal(t, "etcd", entries[0].Source)
+	assert.Equal(t, uint64(3), entries[2].Index)
+
+	read, err := flagz.ReadChangeLog(out)
+	require.NoError(t, err)
+	assert.Equal(t, len(entries), len(read), "all entries must be written")
+	flagz.SetChangeLog(nil)
+
+	repro := flag.NewFlagSet("repro", flag.ContinueOnError)
+	reproInt := flagz.DynInt64(repro, "some_int", 1, "Some int")
+	reproString := flagz.DynString(repro, "some_string", "foo", "Some string")
+	require.NoError(t, flagz.Replay(repro, read, midpoint))
+	assert.Equal(t, int64(2), reproInt.Get(), "changes after the point in time must not be replayed")
+	assert.Equal(t, "bar", reproString.Get())
+	assert.Equal(t, flagz.ReplaySource, flagz.FlagSource(repro.Lookup("some_int")))
+	require.NoError(t, flagz.Replay(repro, read, time.Time{}))
+	assert.Equal(t, int64(3), reproInt.Get(), "all changes must be replayed without a point in time")
+}
+
+func TestChangeLog_KeepsLastEntriesInMemory(t *testing.T) {
+	set := flag.NewFlagSet("recorded", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_int", 1, "Some int")
+	changeLog := flagz.NewChangeLog(2)
+	for _, value := range []string{"2", "3", "4"} {
+		require.NoError(t, set.Set("some_int", value))
+		changeLog.Record(set.Lookup("some_int"), flagz.UpdateInfo{Source: "etcd"})
+	}
+	entries := changeLog.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "3", entries[0].Value)
+	assert.Equal(t, uint64(3), entries[1].Index, "indices must keep counting past dropped entries")
+}
+
+func TestChangeLog_RecordsBackendRevisions(t *testing.T) {
+	set := flag.NewFlagSet("recorded", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_int", 1, "Some int")
+	changeLog := flagz.NewChangeLog(0)
+	flagz.SetChangeLog(changeLog)
+	defer flagz.SetChangeLog(nil)
+
+	ctx := flagz.NewUpdateContext(context.Background(),
+		flagz.UpdateInfo{FlagName: "some_int", Source: "etcd", Key: "/flagz/some_int", Revision: "42"})
+	require.NoError(t, flagz.SetFlagFromSourceCtx(ctx, set, "some_int", "2", "etcd"))
+	entries := changeLog.Entries()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "42", entries[0].Revision, "the revision of the backend must be recorded")
+	assert.Equal(t, "/flagz/some_int", entries[0].Key)
+}
+
+func TestChangeLog_RecordsAppliedValuesOfCoordinators(t *testing.T) {
+	set := flag.NewFlagSet("coordinator", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_dynint", 1, "dynamic int")
+	c := flagz.NewCoordinator(set, &testingLog{T: t})
+	file := addStaticUpdater(t, c, "file", 10, nil)
+	etcd := addStaticUpdater(t, c, "etcd", 20, nil)
+	require.NoError(t, c.Initialize())
+	require.NoError(t, c.Start())
+	defer c.Stop()
+	changeLog := flagz.NewChangeLog(0)
+	flagz.SetChangeLog(changeLog)
+	defer flagz.SetChangeLog(nil)
+
+	ctx := flagz.NewUpdateContext(context.Background(), flagz.UpdateInfo{FlagName: "some_dynint", Revision: "42"})
+	require.NoError(t, flagz.SetFlagFromSourceCtx(ctx, etcd.flagSet, "some_dynint", "2", "etcd"))
+	require.NoError(t, file.push("some_dynint", "3"))
+	entries := changeLog.Entries()
+	require.Len(t, entries, 1, "changes must be recorded once, and shadowed values not at all")
+	assert.Equal(t, "2", entries[0].Value)
+	assert.Equal(t, "etcd", entries[0].Source)
+	assert.Equal(t, "42", entries[0].Revision, "revisions must be passed on by the Coordinator")
+}
+
+func TestReplay_ReportsFailures(t *testing.T) {
+	set := flag.NewFlagSet("repro", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_int", 1, "Some int")
+	set.Int("some_static_int", 1, "Some static int")
+	secret := flagz.DynSecret(set, "some_secret", "hunter2", "Some secret")
+	err := flagz.Replay(set, []flagz.ChangeLogEntry{
+		{Index: 1, FlagName: "no_such_flag", Value: "1"},
+		{Index: 2, FlagName: "some_static_int", Value: "2"},
+		{Index: 3, FlagName: "some_int", Value: "notanint"},
+		{Index: 4, FlagName: "some_secret", Value: flagz.RedactedValue},
+	}, time.Time{})
+	require.Error(t, err)
+	errs, ok := err.(*flagz.FlagErrors)
+	require.True(t, ok, "failures must be returned as FlagErrors")
+	assert.Len(t, errs.Errors, 3)
+	assert.Equal(t, "hunter2", secret.Get(), "redacted values must be skipped")
+}
+
+func TestReadChangeLog_RejectsMalformedLines(t *testing.T) {
+	_, err := flagz.ReadChangeLog(bytes.NewBufferString("{\"index\": 1}\nnotjson\n"))
+	assert.Error(t, err)
+}
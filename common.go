@@ -3,22 +3,164 @@
 
 package flagz
 
-import flag "github.com/spf13/pflag"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
 
 const (
-	dynamicMarker = "__is_dynamic"
+	dynamicMarker   = "__is_dynamic"
+	secretMarker    = "__is_secret"
+	lockedMarker    = "__is_write_locked"
+	immutableMarker = "__is_immutable"
+
+	// RedactedValue replaces the values of secret flags wherever flag values are exposed.
+	RedactedValue = "[REDACTED]"
+)
+
+var (
+	dynamicFlagsMu sync.RWMutex
+	dynamicFlags   = make(map[*flag.Flag]struct{})
 )
 
 // MarkFlagDynamic marks the flag as Dynamic and changeable at runtime.
+// The mark is kept in a registry that is safe for concurrent use, and mirrored in the flag's annotations.
 func MarkFlagDynamic(f *flag.Flag) {
+	dynamicFlagsMu.Lock()
+	defer dynamicFlagsMu.Unlock()
 	if f.Annotations == nil {
 		f.Annotations = make(map[string][]string)
 	}
 	f.Annotations[dynamicMarker] = []string{}
+	dynamicFlags[f] = struct{}{}
 }
 
 // IsFlagDynamic returns whether the given Flag has been created in a Dynamic mode.
+// It is safe to call concurrently with `MarkFlagDynamic` and doesn't read the flag's annotations.
 func IsFlagDynamic(f *flag.Flag) bool {
-	_, ok := f.Annotations[dynamicMarker]
+	dynamicFlagsMu.RLock()
+	_, ok := dynamicFlags[f]
+	dynamicFlagsMu.RUnlock()
+	return ok
+}
+
+// DynamicFlags returns the dynamic flags of `flagSet`, in lexicographical order.
+func DynamicFlags(flagSet *flag.FlagSet) []*flag.Flag {
+	ret := []*flag.Flag{}
+	dynamicFlagsMu.RLock()
+	defer dynamicFlagsMu.RUnlock()
+	flagSet.VisitAll(func(f *flag.Flag) {
+		if _, ok := dynamicFlags[f]; ok {
+			ret = append(ret, f)
+		}
+	})
+	return ret
+}
+
+// MarkFlagSecret marks the flag as holding a secret (e.g. a password or API key), so that its value is redacted from
+// debug and monitoring outputs.
+func MarkFlagSecret(f *flag.Flag) {
+	if f.Annotations == nil {
+		f.Annotations = make(map[string][]string)
+	}
+	f.Annotations[secretMarker] = []string{}
+}
+
+// IsFlagSecret returns whether the given Flag has been marked as holding a secret.
+func IsFlagSecret(f *flag.Flag) bool {
+	_, ok := f.Annotations[secretMarker]
+	return ok
+}
+
+// MarkFlagWriteLocked prevents changing the flag through the flagz endpoints (HTTP `SetFlag` and gRPC), e.g. for flags
+// that are only safe to change through reviewed configuration. Updaters still apply their values.
+func MarkFlagWriteLocked(f *flag.Flag) {
+	if f.Annotations == nil {
+		f.Annotations = make(map[string][]string)
+	}
+	f.Annotations[lockedMarker] = []string{}
+}
+
+// IsFlagWriteLocked returns whether the given Flag has been marked as write locked.
+func IsFlagWriteLocked(f *flag.Flag) bool {
+	_, ok := f.Annotations[lockedMarker]
+	return ok
+}
+
+// MarkFlagImmutable makes the flag immutable, e.g. for data directories that must never change after startup. It
+// takes at most one value besides its default, from the command line or else the first one set through
+// `SetFlagFromSource` (e.g. by an Updater on `Initialize`); later changes to other values, from any Updater or the
+// flagz endpoints, are rejected with ErrFlagImmutable. Re-applying its current value succeeds, also in another format
+// of scalar types, e.g. "1000ms" of a duration of "1s".
+func MarkFlagImmutable(f *flag.Flag) {
+	if f.Annotations == nil {
+		f.Annotations = make(map[string][]string)
+	}
+	f.Annotations[immutableMarker] = []string{}
+}
+
+// IsFlagImmutable returns whether the given Flag has been marked as immutable.
+func IsFlagImmutable(f *flag.Flag) bool {
+	_, ok := f.Annotations[immutableMarker]
 	return ok
 }
+
+// RedactFlagValue returns `value` to be shown as the value of `f`, which is RedactedValue for flags marked as secret.
+// Use it wherever values get logged or exposed, e.g. `flagz.RedactFlagValue(flagSet.Lookup(name), value)`; a nil `f`
+// (unknown flag) returns `value` as is.
+func RedactFlagValue(f *flag.Flag, value string) string {
+	if f != nil && IsFlagSecret(f) {
+		return RedactedValue
+	}
+	return value
+}
+
+// lastChanger is implemented by dynamic values that know when they were last set.
+type lastChanger interface {
+	LastChanged() time.Time
+}
+
+// dynChangeTime is embedded in dynamic values to keep track of the time of their last successful `Set`.
+// It must be the first field of the embedding struct, so that its int64 is 64-bit aligned for atomic access.
+type dynChangeTime struct {
+	unixNanos int64
+}
+
+func (c *dynChangeTime) markChanged() {
+	atomic.StoreInt64(&c.unixNanos, time.Now().UnixNano())
+}
+
+// LastChanged returns the time the value was last successfully set, or a zero Time if it was never set.
+func (c *dynChangeTime) LastChanged() time.Time {
+	nanos := atomic.LoadInt64(&c.unixNanos)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// StringCache keeps the serialized form of the value stored at one pointer. Dynamic values (including the ones in
+// sub-packages) never modify a stored value and store a new pointer on every `Set`, so the pointer identifies the
+// version of the value. The zero StringCache is empty and ready to use.
+type StringCache struct {
+	entry unsafe.Pointer // *stringCacheEntry
+}
+
+type stringCacheEntry struct {
+	valuePtr unsafe.Pointer
+	out      string
+}
+
+// Get returns the cached serialized form of the value at `valuePtr`, calling `marshal` on a cache miss.
+func (c *StringCache) Get(valuePtr unsafe.Pointer, marshal func() string) string {
+	if e := (*stringCacheEntry)(atomic.LoadPointer(&c.entry)); e != nil && e.valuePtr == valuePtr {
+		return e.out
+	}
+	out := marshal()
+	atomic.StorePointer(&c.entry, unsafe.Pointer(&stringCacheEntry{valuePtr: valuePtr, out: out}))
+	return out
+}
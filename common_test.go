@@ -0,0 +1,73 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynamicFlags_ListsOnlyDynamicFlagsOfTheSet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynString(set, "some_dyn_b", "foo", "Use it or lose it")
+	DynInt64(set, "some_dyn_a", 1, "Use it or lose it")
+	set.String("some_static", "foo", "Use it or lose it")
+	otherSet := flag.NewFlagSet("other", flag.ContinueOnError)
+	DynString(otherSet, "some_dyn_c", "foo", "Use it or lose it")
+
+	names := []string{}
+	for _, f := range DynamicFlags(set) {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"some_dyn_a", "some_dyn_b"}, names)
+	assert.False(t, IsFlagDynamic(set.Lookup("some_static")))
+	assert.Contains(t, set.Lookup("some_dyn_a").Annotations, dynamicMarker, "the mark must be mirrored in annotations")
+}
+
+func TestIsFlagDynamic_IsSafeForConcurrentUse(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	for i := 0; i < 10; i++ {
+		set.String(fmt.Sprintf("flag_%d", i), "", "Use it or lose it")
+	}
+	// the first VisitAll sorts the flags of the FlagSet, which isn't safe for concurrent use.
+	DynamicFlags(set)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		f := set.Lookup(fmt.Sprintf("flag_%d", i))
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			MarkFlagDynamic(f)
+		}()
+		go func() {
+			defer wg.Done()
+			IsFlagDynamic(f)
+			DynamicFlags(set)
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, DynamicFlags(set), 10)
+}
+
+func TestStringCache_MarshalsOncePerValuePointer(t *testing.T) {
+	cache := &StringCache{}
+	first, second := "first", "second"
+	calls := 0
+	marshal := func(value *string) func() string {
+		return func() string {
+			calls++
+			return *value
+		}
+	}
+	assert.Equal(t, "first", cache.Get(unsafe.Pointer(&first), marshal(&first)))
+	assert.Equal(t, "first", cache.Get(unsafe.Pointer(&first), marshal(&first)))
+	assert.Equal(t, 1, calls, "the same pointer must hit the cache")
+	assert.Equal(t, "second", cache.Get(unsafe.Pointer(&second), marshal(&second)))
+	assert.Equal(t, 2, calls, "a new pointer must be marshalled")
+}
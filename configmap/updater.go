@@ -6,10 +6,14 @@
 package configmap
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/fsnotify/fsnotify"
 	flag "github.com/spf13/pflag"
@@ -22,10 +26,9 @@ const (
 )
 
 
-var (
-	errFlagNotDynamic = fmt.Errorf("flag is not dynamic")
-	errFlagNotFound = fmt.Errorf("flag not found")
-)
+func init() {
+	flagz.RegisterUpdater("configmap", newFromURL)
+}
 
 // Minimum logger interface needed.
 // Default "log" and "logrus" should support these.
@@ -34,13 +37,17 @@ type loggerCompatible interface {
 }
 
 type Updater struct {
-	started bool
+	*flagz.UpdaterTracker
 	dirPath string
 	watcher *fsnotify.Watcher
 	flagSet *flag.FlagSet
 	logger  loggerCompatible
-	done    chan bool
 
+	// lifecycle serializes the lifecycle transitions, see `flagz.UpdaterState`.
+	lifecycle sync.Mutex
+	cancel    context.CancelFunc
+	// done is closed when the watching go routine exits.
+	done chan struct{}
 }
 
 func New(flagSet *flag.FlagSet, dirPath string, logger loggerCompatible) (*Updater, error) {
@@ -49,6 +56,7 @@ func New(flagSet *flag.FlagSet, dirPath string, logger loggerCompatible) (*Updat
 		return nil, fmt.Errorf("flagz: error initializing fsnotify watcher.")
 	}
 	return &Updater{
+		UpdaterTracker: flagz.NewUpdaterTracker(),
 		flagSet: flagSet,
 		logger:  logger,
 		dirPath: dirPath,
@@ -57,81 +65,90 @@ func New(flagSet *flag.FlagSet, dirPath string, logger loggerCompatible) (*Updat
 }
 
 func (u *Updater) Initialize() error {
-	if u.started {
-		return fmt.Errorf("flagz: already initialized updater.")
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.CheckTransition(flagz.UpdaterInitialized); err != nil {
+		return err
 	}
-	return u.readAll(/* allowNonDynamic */ false)
+	if err := u.readAll(context.Background(), false /* dynamicOnly */); err != nil {
+		return err
+	}
+	return u.Transition(flagz.UpdaterInitialized)
 }
 
 // Start kicks off the go routine that watches the directory for updates of values.
 func (u *Updater) Start() error {
-	if u.started {
-		return fmt.Errorf("flagz: updater already started.")
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.Transition(flagz.UpdaterWatching); err != nil {
+		return err
 	}
 	u.watcher.Add(path.Join(u.dirPath, "..")) // add parent in case the dirPath is a symlink itself
 	u.watcher.Add(u.dirPath) // add the dir itself.
 
-	u.done = make(chan bool)
-	go u.watchForUpdates()
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
+	u.done = make(chan struct{})
+	go u.watchForUpdates(ctx, u.done)
 	return nil
 }
 
-// Stops the auto-updating go-routine.
+// Stop stops the auto-updating go-routine and waits for it to exit. Stopping an Updater that isn't watching is a no-op.
 func (u *Updater) Stop() error {
-	if !u.started {
-		return fmt.Errorf("flagz: not updating")
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if u.State() != flagz.UpdaterWatching {
+		return nil
 	}
-	u.done <- true
+	u.cancel()
+	<-u.done
 	u.watcher.Remove(u.dirPath)
-	return nil
+	return u.Transition(flagz.UpdaterStopped)
 }
 
-func (u *Updater) readAll(dynamicOnly bool) error {
+func (u *Updater) readAll(ctx context.Context, dynamicOnly bool) error {
 	files, err := ioutil.ReadDir(u.dirPath)
 	if err != nil {
 		return fmt.Errorf("flagz: updater initialization: %v", err)
 	}
-	errorStrings := []string{}
+	errs := &flagz.FlagErrors{Source: "directory"}
 	for _, f := range files {
 		if strings.HasPrefix(path.Base(f.Name()), "..") {
 			// skip random ConfigMap internals
 			continue
 		}
 		fullPath := path.Join(u.dirPath, f.Name())
-		if err := u.readFlagFile(fullPath, dynamicOnly); err != nil {
-			if err == errFlagNotDynamic && dynamicOnly {
+		if err := u.readFlagFile(ctx, fullPath, dynamicOnly); err != nil {
+			if (errors.Is(err, flagz.ErrFlagNotDynamic) && dynamicOnly) || errors.Is(err, flagz.ErrFlagPinned) {
 				// ignore
 			} else {
-				errorStrings = append(errorStrings, fmt.Sprintf("flag %v: %v", f.Name(), err.Error()))
+				errs.Add(f.Name(), err)
 			}
 		}
 	}
-	if len(errorStrings) > 0 {
-		return fmt.Errorf("encountered %d errors while parsing flags from directory  \n  %v",
-			len(errorStrings), strings.Join(errorStrings, "\n"))
-	}
-	return nil
+	return errs.ErrorOrNil()
 }
 
 
-func (u *Updater) readFlagFile(fullPath string, dynamicOnly bool) error {
+func (u *Updater) readFlagFile(ctx context.Context, fullPath string, dynamicOnly bool) error {
 	flagName := path.Base(fullPath)
 	flag := u.flagSet.Lookup(flagName)
 	if flag == nil {
-		return errFlagNotFound
+		return flagz.ErrFlagNotFound
 	}
 	if dynamicOnly && !flagz.IsFlagDynamic(flag) {
-		return errFlagNotDynamic
+		return flagz.ErrFlagNotDynamic
 	}
 	content, err := ioutil.ReadFile(fullPath)
 	if err != nil {
 		return err
 	}
-	// do not call flag.Value.Set, instead go through flagSet.Set to change "changed" state.
-	return u.flagSet.Set(flagName, string(content))
+	// do not call flag.Value.Set, instead go through flagSet.Set (via SetFlagFromSource) to change "changed" state.
+	return flagz.SetFlagFromSourceCtx(ctx, u.flagSet, flagName, string(content), "configmap")
 }
 
-func (u *Updater) watchForUpdates() {
+func (u *Updater) watchForUpdates(ctx context.Context, done chan struct{}) {
+	defer close(done)
 	u.logger.Printf("starting watching")
 	for {
 		select {
@@ -142,23 +159,33 @@ func (u *Updater) watchForUpdates() {
 				case fsnotify.Create:
 					u.watcher.Add(u.dirPath)
 					u.logger.Printf("flagz: Re-reading flags after ConfigMap update.")
-					if err := u.readAll(/* dynamicOnly */ true); err != nil {
+					err := u.readAll(ctx, true /* dynamicOnly */)
+					if err != nil {
 						u.logger.Printf("flagz: directory reload yielded errors: %v", err.Error())
 					}
+					u.RecordSync(err)
 				case fsnotify.Remove:
 				}
 
 			} else if strings.HasPrefix(event.Name, u.dirPath) && !isK8sInternalDirectory(event.Name) {
 				switch event.Op {
 				case fsnotify.Create, fsnotify.Write, fsnotify.Rename:
-					if err := u.readFlagFile(event.Name, true); err != nil {
-						flagName := path.Base(event.Name)
+					flagName := path.Base(event.Name)
+					if err := u.readFlagFile(ctx, event.Name, true); errors.Is(err, flagz.ErrFlagPinned) {
+						u.logger.Printf("flagz: holding update of pinned flag=%v until it is unpinned", flagName)
+					} else if err != nil {
 						u.logger.Printf("flagz: failed setting flag %s: %v", flagName, err.Error())
+						if !errors.Is(err, flagz.ErrFlagNotDynamic) && !errors.Is(err, flagz.ErrFlagNotFound) {
+							u.RecordUpdate(flagName, "", err)
+						}
+					} else {
+						f := u.flagSet.Lookup(flagName)
+						u.RecordUpdate(flagName, flagz.RedactFlagValue(f, f.Value.String()), nil)
 					}
 				}
 			}
 
-		case <-u.done:
+		case <-ctx.Done():
 			return
 		}
 	}
@@ -167,4 +194,9 @@ func (u *Updater) watchForUpdates() {
 func isK8sInternalDirectory(filePath string) bool {
 	basePath := path.Base(filePath)
 	return strings.HasPrefix(basePath, k8sInternalsPrefix)
-}
\ No newline at end of file
+}
+
+// newFromURL constructs an Updater from a `configmap:///path/to/mounted/dir` URL.
+func newFromURL(flagSet *flag.FlagSet, source *url.URL, logger flagz.Logger) (flagz.Updater, error) {
+	return New(flagSet, source.Path, logger)
+}
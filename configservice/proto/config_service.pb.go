@@ -0,0 +1,523 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: config_service.proto
+
+package flagz_configservice
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type WatchFlagsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Name of the service whose flags are requested.
+	Service string `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+	// Identifier of the instance, e.g. the hostname.
+	Instance string `protobuf:"bytes,2,opt,name=instance,proto3" json:"instance,omitempty"`
+	// Revision of the last FlagUpdate applied by the client, empty if none.
+	LastRevision string `protobuf:"bytes,3,opt,name=last_revision,json=lastRevision,proto3" json:"last_revision,omitempty"`
+	// Outcome of applying a FlagUpdate. Unset on the first request of a stream.
+	Ack           *Ack `protobuf:"bytes,4,opt,name=ack,proto3" json:"ack,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchFlagsRequest) Reset() {
+	*x = WatchFlagsRequest{}
+	mi := &file_config_service_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchFlagsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchFlagsRequest) ProtoMessage() {}
+
+func (x *WatchFlagsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_config_service_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchFlagsRequest.ProtoReflect.Descriptor instead.
+func (*WatchFlagsRequest) Descriptor() ([]byte, []int) {
+	return file_config_service_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *WatchFlagsRequest) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *WatchFlagsRequest) GetInstance() string {
+	if x != nil {
+		return x.Instance
+	}
+	return ""
+}
+
+func (x *WatchFlagsRequest) GetLastRevision() string {
+	if x != nil {
+		return x.LastRevision
+	}
+	return ""
+}
+
+func (x *WatchFlagsRequest) GetAck() *Ack {
+	if x != nil {
+		return x.Ack
+	}
+	return nil
+}
+
+type Ack struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Revision of the FlagUpdate being acknowledged.
+	Revision string `protobuf:"bytes,1,opt,name=revision,proto3" json:"revision,omitempty"`
+	// Flags that failed to apply, e.g. due to parsing or validation errors.
+	Errors        []*FlagError `protobuf:"bytes,2,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ack) Reset() {
+	*x = Ack{}
+	mi := &file_config_service_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ack) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ack) ProtoMessage() {}
+
+func (x *Ack) ProtoReflect() protoreflect.Message {
+	mi := &file_config_service_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ack.ProtoReflect.Descriptor instead.
+func (*Ack) Descriptor() ([]byte, []int) {
+	return file_config_service_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Ack) GetRevision() string {
+	if x != nil {
+		return x.Revision
+	}
+	return ""
+}
+
+func (x *Ack) GetErrors() []*FlagError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+type FlagError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlagError) Reset() {
+	*x = FlagError{}
+	mi := &file_config_service_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlagError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlagError) ProtoMessage() {}
+
+func (x *FlagError) ProtoReflect() protoreflect.Message {
+	mi := &file_config_service_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlagError.ProtoReflect.Descriptor instead.
+func (*FlagError) Descriptor() ([]byte, []int) {
+	return file_config_service_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *FlagError) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FlagError) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type FlagUpdate struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Opaque revision of the flag state after this update.
+	Revision string `protobuf:"bytes,1,opt,name=revision,proto3" json:"revision,omitempty"`
+	// If true, `values` hold all flag values of the service, otherwise only the changed ones.
+	FullSnapshot  bool         `protobuf:"varint,2,opt,name=full_snapshot,json=fullSnapshot,proto3" json:"full_snapshot,omitempty"`
+	Values        []*FlagValue `protobuf:"bytes,3,rep,name=values,proto3" json:"values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlagUpdate) Reset() {
+	*x = FlagUpdate{}
+	mi := &file_config_service_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlagUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlagUpdate) ProtoMessage() {}
+
+func (x *FlagUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_config_service_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlagUpdate.ProtoReflect.Descriptor instead.
+func (*FlagUpdate) Descriptor() ([]byte, []int) {
+	return file_config_service_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *FlagUpdate) GetRevision() string {
+	if x != nil {
+		return x.Revision
+	}
+	return ""
+}
+
+func (x *FlagUpdate) GetFullSnapshot() bool {
+	if x != nil {
+		return x.FullSnapshot
+	}
+	return false
+}
+
+func (x *FlagUpdate) GetValues() []*FlagValue {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+type FlagValue struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlagValue) Reset() {
+	*x = FlagValue{}
+	mi := &file_config_service_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlagValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlagValue) ProtoMessage() {}
+
+func (x *FlagValue) ProtoReflect() protoreflect.Message {
+	mi := &file_config_service_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlagValue.ProtoReflect.Descriptor instead.
+func (*FlagValue) Descriptor() ([]byte, []int) {
+	return file_config_service_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *FlagValue) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FlagValue) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+var File_config_service_proto protoreflect.FileDescriptor
+
+const file_config_service_proto_rawDesc = "" +
+	"\n" +
+	"\x14config_service.proto\x12\x13flagz.configservice\"\x9a\x01\n" +
+	"\x11WatchFlagsRequest\x12\x18\n" +
+	"\aservice\x18\x01 \x01(\tR\aservice\x12\x1a\n" +
+	"\binstance\x18\x02 \x01(\tR\binstance\x12#\n" +
+	"\rlast_revision\x18\x03 \x01(\tR\flastRevision\x12*\n" +
+	"\x03ack\x18\x04 \x01(\v2\x18.flagz.configservice.AckR\x03ack\"Y\n" +
+	"\x03Ack\x12\x1a\n" +
+	"\brevision\x18\x01 \x01(\tR\brevision\x126\n" +
+	"\x06errors\x18\x02 \x03(\v2\x1e.flagz.configservice.FlagErrorR\x06errors\"5\n" +
+	"\tFlagError\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\x85\x01\n" +
+	"\n" +
+	"FlagUpdate\x12\x1a\n" +
+	"\brevision\x18\x01 \x01(\tR\brevision\x12#\n" +
+	"\rfull_snapshot\x18\x02 \x01(\bR\ffullSnapshot\x126\n" +
+	"\x06values\x18\x03 \x03(\v2\x1e.flagz.configservice.FlagValueR\x06values\"5\n" +
+	"\tFlagValue\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value2j\n" +
+	"\rConfigService\x12Y\n" +
+	"\n" +
+	"WatchFlags\x12&.flagz.configservice.WatchFlagsRequest\x1a\x1f.flagz.configservice.FlagUpdate(\x010\x01BEZCgithub.com/mwitkow/go-flagz/configservice/proto;flagz_configserviceb\x06proto3"
+
+var (
+	file_config_service_proto_rawDescOnce sync.Once
+	file_config_service_proto_rawDescData []byte
+)
+
+func file_config_service_proto_rawDescGZIP() []byte {
+	file_config_service_proto_rawDescOnce.Do(func() {
+		file_config_service_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_config_service_proto_rawDesc), len(file_config_service_proto_rawDesc)))
+	})
+	return file_config_service_proto_rawDescData
+}
+
+var file_config_service_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_config_service_proto_goTypes = []any{
+	(*WatchFlagsRequest)(nil), // 0: flagz.configservice.WatchFlagsRequest
+	(*Ack)(nil),               // 1: flagz.configservice.Ack
+	(*FlagError)(nil),         // 2: flagz.configservice.FlagError
+	(*FlagUpdate)(nil),        // 3: flagz.configservice.FlagUpdate
+	(*FlagValue)(nil),         // 4: flagz.configservice.FlagValue
+}
+var file_config_service_proto_depIdxs = []int32{
+	1, // 0: flagz.configservice.WatchFlagsRequest.ack:type_name -> flagz.configservice.Ack
+	2, // 1: flagz.configservice.Ack.errors:type_name -> flagz.configservice.FlagError
+	4, // 2: flagz.configservice.FlagUpdate.values:type_name -> flagz.configservice.FlagValue
+	0, // 3: flagz.configservice.ConfigService.WatchFlags:input_type -> flagz.configservice.WatchFlagsRequest
+	3, // 4: flagz.configservice.ConfigService.WatchFlags:output_type -> flagz.configservice.FlagUpdate
+	4, // [4:5] is the sub-list for method output_type
+	3, // [3:4] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_config_service_proto_init() }
+func file_config_service_proto_init() {
+	if File_config_service_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_config_service_proto_rawDesc), len(file_config_service_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_config_service_proto_goTypes,
+		DependencyIndexes: file_config_service_proto_depIdxs,
+		MessageInfos:      file_config_service_proto_msgTypes,
+	}.Build()
+	File_config_service_proto = out.File
+	file_config_service_proto_goTypes = nil
+	file_config_service_proto_depIdxs = nil
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// ConfigServiceClient is the client API for ConfigService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type ConfigServiceClient interface {
+	// WatchFlags streams flag values of a service.
+	// The client opens the stream with a WatchFlagsRequest identifying itself. The server replies with a FlagUpdate
+	// holding a full snapshot of the flag values, followed by incremental FlagUpdates whenever values change.
+	// The client reports the outcome of applying each FlagUpdate by sending further WatchFlagsRequests with `ack` set.
+	WatchFlags(ctx context.Context, opts ...grpc.CallOption) (ConfigService_WatchFlagsClient, error)
+}
+
+type configServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewConfigServiceClient(cc grpc.ClientConnInterface) ConfigServiceClient {
+	return &configServiceClient{cc}
+}
+
+func (c *configServiceClient) WatchFlags(ctx context.Context, opts ...grpc.CallOption) (ConfigService_WatchFlagsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_ConfigService_serviceDesc.Streams[0], "/flagz.configservice.ConfigService/WatchFlags", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &configServiceWatchFlagsClient{stream}
+	return x, nil
+}
+
+type ConfigService_WatchFlagsClient interface {
+	Send(*WatchFlagsRequest) error
+	Recv() (*FlagUpdate, error)
+	grpc.ClientStream
+}
+
+type configServiceWatchFlagsClient struct {
+	grpc.ClientStream
+}
+
+func (x *configServiceWatchFlagsClient) Send(m *WatchFlagsRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *configServiceWatchFlagsClient) Recv() (*FlagUpdate, error) {
+	m := new(FlagUpdate)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ConfigServiceServer is the server API for ConfigService service.
+type ConfigServiceServer interface {
+	// WatchFlags streams flag values of a service.
+	// The client opens the stream with a WatchFlagsRequest identifying itself. The server replies with a FlagUpdate
+	// holding a full snapshot of the flag values, followed by incremental FlagUpdates whenever values change.
+	// The client reports the outcome of applying each FlagUpdate by sending further WatchFlagsRequests with `ack` set.
+	WatchFlags(ConfigService_WatchFlagsServer) error
+}
+
+// UnimplementedConfigServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedConfigServiceServer struct {
+}
+
+func (*UnimplementedConfigServiceServer) WatchFlags(ConfigService_WatchFlagsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchFlags not implemented")
+}
+
+func RegisterConfigServiceServer(s *grpc.Server, srv ConfigServiceServer) {
+	s.RegisterService(&_ConfigService_serviceDesc, srv)
+}
+
+func _ConfigService_WatchFlags_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ConfigServiceServer).WatchFlags(&configServiceWatchFlagsServer{stream})
+}
+
+type ConfigService_WatchFlagsServer interface {
+	Send(*FlagUpdate) error
+	Recv() (*WatchFlagsRequest, error)
+	grpc.ServerStream
+}
+
+type configServiceWatchFlagsServer struct {
+	grpc.ServerStream
+}
+
+func (x *configServiceWatchFlagsServer) Send(m *FlagUpdate) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *configServiceWatchFlagsServer) Recv() (*WatchFlagsRequest, error) {
+	m := new(WatchFlagsRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _ConfigService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "flagz.configservice.ConfigService",
+	HandlerType: (*ConfigServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchFlags",
+			Handler:       _ConfigService_WatchFlags_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "config_service.proto",
+}
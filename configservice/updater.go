@@ -0,0 +1,284 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package configservice provides an Updater that receives flag values pushed by a central configuration service over
+// a gRPC stream, see `proto/config_service.proto` for the protocol.
+
+package configservice
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	pb "github.com/mwitkow/go-flagz/configservice/proto"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultInitTimeout = 10 * time.Second
+	minBackoff         = 100 * time.Millisecond
+	maxBackoff         = 30 * time.Second
+)
+
+// Minimum logger interface needed.
+// Default "log" and "logrus" should support these.
+type loggerCompatible interface {
+	Printf(format string, v ...interface{})
+}
+
+// Updater syncs flag values streamed from a ConfigService into a given FlagSet.
+//
+// The watching go-routine keeps the `WatchFlags` stream open, and re-establishes it with exponential backoff and
+// jitter whenever it breaks, so the ConfigService can be restarted without affecting the clients.
+type Updater struct {
+	*flagz.UpdaterTracker
+	flagSet     *flag.FlagSet
+	logger      loggerCompatible
+	client      pb.ConfigServiceClient
+	service     string
+	instance    string
+	initTimeout time.Duration
+
+	// lifecycle serializes the lifecycle transitions, see `flagz.UpdaterState`.
+	lifecycle sync.Mutex
+	context   context.Context
+	cancel    context.CancelFunc
+	// done is closed when the watching go routine exits.
+	done chan struct{}
+
+	mu         sync.Mutex
+	revision   string
+	lastValues map[string]string
+}
+
+// New constructs a new Updater that watches the flags of `serviceName` over `conn`.
+func New(flagSet *flag.FlagSet, conn grpc.ClientConnInterface, serviceName string, logger loggerCompatible) (*Updater, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("flagz: cannot determine instance name: %v", err)
+	}
+	u := &Updater{
+		UpdaterTracker: flagz.NewUpdaterTracker(),
+		flagSet:        flagSet,
+		logger:         logger,
+		client:         pb.NewConfigServiceClient(conn),
+		service:        serviceName,
+		instance:       hostname,
+		initTimeout:    defaultInitTimeout,
+		lastValues:     make(map[string]string),
+	}
+	u.context, u.cancel = context.WithCancel(context.Background())
+	return u, nil
+}
+
+// WithInstance overrides the instance identifier reported to the ConfigService. Defaults to the hostname.
+func (u *Updater) WithInstance(instance string) *Updater {
+	u.instance = instance
+	return u
+}
+
+// WithInitTimeout sets how long Initialize waits for the initial snapshot. Defaults to 10s.
+func (u *Updater) WithInitTimeout(timeout time.Duration) *Updater {
+	u.initTimeout = timeout
+	return u
+}
+
+// Initialize fetches the initial snapshot from the ConfigService and sets all flags (dynamic and static) into FlagSet.
+func (u *Updater) Initialize() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.CheckTransition(flagz.UpdaterInitialized); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ctx, cancel := context.WithTimeout(u.context, u.initTimeout)
+	defer cancel()
+	stream, err := u.openStream(ctx, "")
+	if err != nil {
+		return fmt.Errorf("flagz: initial config service read: %v", err)
+	}
+	update, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("flagz: initial config service read: %v", err)
+	}
+	if !update.FullSnapshot {
+		return fmt.Errorf("flagz: config service did not start the stream with a full snapshot")
+	}
+	flagErrors := u.apply(update, false /* dynamicOnly */)
+	u.ack(stream, update, flagErrors)
+	stream.CloseSend()
+	if err := flagErrors.ErrorOrNil(); err != nil {
+		return err
+	}
+	return u.Transition(flagz.UpdaterInitialized)
+}
+
+// Start kicks off the go routine that syncs dynamic flags from the ConfigService to FlagSet.
+// After a `Stop` it can be called again, to continue watching from the last applied revision.
+func (u *Updater) Start() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.Transition(flagz.UpdaterWatching); err != nil {
+		return err
+	}
+	u.context, u.cancel = context.WithCancel(context.Background())
+	u.done = make(chan struct{})
+	go u.watchForUpdates(u.done)
+	return nil
+}
+
+// Stop stops the auto-updating go-routine and waits for it to exit. Stopping an Updater that isn't watching is a no-op.
+func (u *Updater) Stop() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if u.State() != flagz.UpdaterWatching {
+		return nil
+	}
+	u.logger.Printf("flagz: stopping")
+	u.cancel()
+	<-u.done
+	return u.Transition(flagz.UpdaterStopped)
+}
+
+// Revision returns the revision of the last FlagUpdate applied from the ConfigService.
+func (u *Updater) Revision() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.revision
+}
+
+func (u *Updater) watchForUpdates(done chan struct{}) {
+	defer close(done)
+	u.logger.Printf("flagz: config service watcher started")
+	backoff := minBackoff
+	for {
+		received, err := u.watchStream()
+		if u.context.Err() != nil {
+			break
+		}
+		if received {
+			backoff = minBackoff
+		}
+		u.logger.Printf("flagz: config service stream broken, reconnecting in %v: %v", backoff, err)
+		u.RecordSync(err)
+		randOffset := time.Duration(rand.Int63n(int64(backoff/2) + 1))
+		select {
+		case <-time.After(backoff + randOffset):
+		case <-u.context.Done():
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	u.logger.Printf("flagz: config service watcher exited")
+}
+
+// watchStream runs a single `WatchFlags` stream until it breaks, returning whether any update was received on it.
+func (u *Updater) watchStream() (bool, error) {
+	stream, err := u.openStream(u.context, u.Revision())
+	if err != nil {
+		return false, err
+	}
+	received := false
+	for {
+		update, err := stream.Recv()
+		if err == io.EOF {
+			return received, fmt.Errorf("stream closed by server")
+		} else if err != nil {
+			return received, err
+		}
+		if !received {
+			u.RecordSync(nil)
+		}
+		received = true
+		u.mu.Lock()
+		flagErrors := u.apply(update, true /* dynamicOnly */)
+		u.mu.Unlock()
+		if err := u.ack(stream, update, flagErrors); err != nil {
+			return received, err
+		}
+	}
+}
+
+func (u *Updater) openStream(ctx context.Context, lastRevision string) (pb.ConfigService_WatchFlagsClient, error) {
+	stream, err := u.client.WatchFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := &pb.WatchFlagsRequest{Service: u.service, Instance: u.instance, LastRevision: lastRevision}
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (u *Updater) ack(stream pb.ConfigService_WatchFlagsClient, update *pb.FlagUpdate, flagErrors *flagz.FlagErrors) error {
+	ackErrors := []*pb.FlagError{}
+	for _, e := range flagErrors.Errors {
+		ackErrors = append(ackErrors, &pb.FlagError{Name: e.Flag, Error: e.Err.Error()})
+	}
+	req := &pb.WatchFlagsRequest{
+		Service:      u.service,
+		Instance:     u.instance,
+		LastRevision: update.Revision,
+		Ack:          &pb.Ack{Revision: update.Revision, Errors: ackErrors},
+	}
+	return stream.Send(req)
+}
+
+// apply sets the values of the update that differ from what was previously applied. Must be called under `mu`.
+func (u *Updater) apply(update *pb.FlagUpdate, dynamicOnly bool) *flagz.FlagErrors {
+	u.RecordRevision(update.Revision)
+	flagErrors := &flagz.FlagErrors{Source: "config service"}
+	for _, v := range update.Values {
+		if last, ok := u.lastValues[v.Name]; ok && last == v.Value {
+			continue
+		}
+		err := u.setFlag(v.Name, v.Value, dynamicOnly)
+		shownValue := flagz.RedactFlagValue(u.flagSet.Lookup(v.Name), v.Value)
+		if errors.Is(err, flagz.ErrFlagNotDynamic) && dynamicOnly {
+			u.logger.Printf("flagz: ignoring updating flag=%v at revision=%v, because of: %v", v.Name, update.Revision, err)
+			continue
+		} else if errors.Is(err, flagz.ErrFlagPinned) {
+			// held until the flag is unpinned, which applies it.
+			u.logger.Printf("flagz: holding update of pinned flag=%v until it is unpinned", v.Name)
+			u.lastValues[v.Name] = v.Value
+			continue
+		} else if err != nil {
+			u.logger.Printf("flagz: failed updating flag=%v at revision=%v, because of: %v", v.Name, update.Revision, err)
+			flagErrors.Add(v.Name, err)
+			if dynamicOnly {
+				u.RecordUpdate(v.Name, shownValue, err)
+			}
+			continue
+		}
+		u.lastValues[v.Name] = v.Value
+		if dynamicOnly {
+			u.logger.Printf("flagz: updated flag=%v to value=%v at revision=%v", v.Name, shownValue, update.Revision)
+			u.RecordUpdate(v.Name, shownValue, nil)
+		}
+	}
+	u.revision = update.Revision
+	return flagErrors
+}
+
+func (u *Updater) setFlag(flagName string, value string, onlyDynamic bool) error {
+	flag := u.flagSet.Lookup(flagName)
+	if flag == nil {
+		return flagz.ErrFlagNotFound
+	}
+	if onlyDynamic && !flagz.IsFlagDynamic(flag) {
+		return flagz.ErrFlagNotDynamic
+	}
+	// do not call flag.Value.Set, instead go through flagSet.Set (via SetFlagFromSource) to change "changed" state.
+	return flagz.SetFlagFromSourceCtx(u.context, u.flagSet, flagName, value, "configservice")
+}
@@ -0,0 +1,257 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package configservice_test
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/configservice"
+	pb "github.com/mwitkow/go-flagz/configservice/proto"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type updaterTestSuite struct {
+	suite.Suite
+
+	server     *grpc.Server
+	fakeServer *fakeConfigService
+	conn       *grpc.ClientConn
+
+	flagSet   *flag.FlagSet
+	staticInt *int32
+	dynInt    *flagz.DynInt64Value
+
+	updater *configservice.Updater
+}
+
+func (s *updaterTestSuite) SetupTest() {
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(s.T(), err, "must be able to allocate a port for the fake config service")
+	s.fakeServer = newFakeConfigService(map[string]string{"some_int": "1234", "some_dynint": "10001"})
+	s.server = grpc.NewServer()
+	pb.RegisterConfigServiceServer(s.server, s.fakeServer)
+	go s.server.Serve(listener)
+
+	s.conn, err = grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(s.T(), err, "must be able to dial the fake config service")
+
+	s.flagSet = flag.NewFlagSet("updater_test", flag.ContinueOnError)
+	s.dynInt = flagz.DynInt64(s.flagSet, "some_dynint", 1, "dynamic int for testing")
+	s.staticInt = s.flagSet.Int32("some_int", 1, "static int for testing")
+
+	s.updater, err = configservice.New(s.flagSet, s.conn, "test_service", &testingLog{T: s.T()})
+	require.NoError(s.T(), err, "creating an updater must not fail")
+	s.updater.WithInstance("test_instance")
+}
+
+func (s *updaterTestSuite) TearDownTest() {
+	s.updater.Stop()
+	s.conn.Close()
+	s.server.Stop()
+	time.Sleep(100 * time.Millisecond)
+}
+
+func (s *updaterTestSuite) TestInitializeSetsValues() {
+	require.NoError(s.T(), s.updater.Initialize(), "initialize should not return errors on good flags")
+	assert.EqualValues(s.T(), 1234, *s.staticInt, "staticInt should be set from the snapshot")
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "dynInt should be set from the snapshot")
+	assert.Equal(s.T(), "rev1", s.updater.Revision(), "revision of the snapshot should be recorded")
+}
+
+func (s *updaterTestSuite) TestInitializeFailsOnBadValues() {
+	s.fakeServer.set("some_int", "not_an_int")
+	require.Error(s.T(), s.updater.Initialize(), "initialize should return errors on bad flags")
+}
+
+func (s *updaterTestSuite) TestDynamicUpdatesPropagateAndAreAcked() {
+	require.NoError(s.T(), s.updater.Initialize())
+	require.NoError(s.T(), s.updater.Start())
+	s.waitForWatchStream()
+	s.fakeServer.push(&pb.FlagUpdate{Revision: "rev2", Values: []*pb.FlagValue{
+		{Name: "some_dynint", Value: "20002"},
+		{Name: "some_int", Value: "4321"},
+	}})
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, 20002,
+		func() interface{} { return s.dynInt.Get() },
+		"some_dynint value should change to the pushed value")
+	assert.EqualValues(s.T(), 1234, *s.staticInt, "static flags must not be updated dynamically")
+
+	s.fakeServer.push(&pb.FlagUpdate{Revision: "rev3", Values: []*pb.FlagValue{{Name: "some_dynint", Value: "bad"}}})
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, 1,
+		func() interface{} { return len(s.fakeServer.ackErrors("rev3")) },
+		"bad values must be reported back in the ack")
+	assert.EqualValues(s.T(), 20002, s.dynInt.Get(), "bad values must not be applied")
+}
+
+func (s *updaterTestSuite) TestReconnectsAfterStreamBreaks() {
+	require.NoError(s.T(), s.updater.Initialize())
+	require.NoError(s.T(), s.updater.Start())
+	s.waitForWatchStream()
+	s.fakeServer.set("some_dynint", "30003")
+	s.fakeServer.breakStreams()
+	eventually(s.T(), 2*time.Second,
+		assert.ObjectsAreEqualValues, 30003,
+		func() interface{} { return s.dynInt.Get() },
+		"the snapshot of the re-established stream should be applied")
+}
+
+func (s *updaterTestSuite) waitForWatchStream() {
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, 1,
+		func() interface{} { return s.fakeServer.watchStreams() },
+		"the updater should open a watch stream after Start")
+}
+
+var _ flagz.Updater = &configservice.Updater{}
+
+func TestUpdaterSuite(t *testing.T) {
+	suite.Run(t, &updaterTestSuite{})
+}
+
+// fakeConfigService serves a snapshot to every new stream and forwards pushed updates to the open ones.
+type fakeConfigService struct {
+	mu       sync.Mutex
+	values   map[string]string
+	revision int
+	streams  map[chan *pb.FlagUpdate]chan error
+	watchers int
+	acks     map[string][]*pb.FlagError
+}
+
+func newFakeConfigService(values map[string]string) *fakeConfigService {
+	return &fakeConfigService{
+		values:   values,
+		revision: 1,
+		streams:  make(map[chan *pb.FlagUpdate]chan error),
+		acks:     make(map[string][]*pb.FlagError),
+	}
+}
+
+func (f *fakeConfigService) WatchFlags(stream pb.ConfigService_WatchFlagsServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	updates := make(chan *pb.FlagUpdate, 10)
+	broken := make(chan error, 1)
+	f.mu.Lock()
+	snapshot := &pb.FlagUpdate{Revision: fmt.Sprintf("rev%d", f.revision), FullSnapshot: true}
+	for name, value := range f.values {
+		snapshot.Values = append(snapshot.Values, &pb.FlagValue{Name: name, Value: value})
+	}
+	f.streams[updates] = broken
+	if req.LastRevision != "" {
+		f.watchers++
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.streams, updates)
+		if req.LastRevision != "" {
+			f.watchers--
+		}
+		f.mu.Unlock()
+	}()
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			if req.Ack != nil {
+				f.mu.Lock()
+				f.acks[req.Ack.Revision] = req.Ack.Errors
+				f.mu.Unlock()
+			}
+		}
+	}()
+	if err := stream.Send(snapshot); err != nil {
+		return err
+	}
+	for {
+		select {
+		case update := <-updates:
+			if err := stream.Send(update); err != nil {
+				return err
+			}
+		case err := <-broken:
+			return err
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (f *fakeConfigService) set(name string, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[name] = value
+	f.revision++
+}
+
+func (f *fakeConfigService) push(update *pb.FlagUpdate) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for updates := range f.streams {
+		updates <- update
+	}
+}
+
+func (f *fakeConfigService) breakStreams() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, broken := range f.streams {
+		broken <- fmt.Errorf("stream broken for testing")
+	}
+}
+
+// watchStreams returns the number of open streams that resumed from a revision, i.e. weren't opened by Initialize.
+func (f *fakeConfigService) watchStreams() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.watchers
+}
+
+func (f *fakeConfigService) ackErrors(revision string) []*pb.FlagError {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.acks[revision]
+}
+
+type assertFunc func(expected, actual interface{}) bool
+type getter func() interface{}
+
+// eventually tries a given Assert function 5 times over the period of time.
+func eventually(t *testing.T, duration time.Duration,
+	af assertFunc, expected interface{}, actual getter, msgFmt string, msgArgs ...interface{}) {
+	increment := duration / 5
+	for i := 0; i < 5; i++ {
+		time.Sleep(increment)
+		if af(expected, actual()) {
+			return
+		}
+	}
+	t.Fatalf(msgFmt, msgArgs...)
+}
+
+// Abstraction that allows us to pass the *testing.T as a logger to the updater.
+type testingLog struct {
+	T *testing.T
+}
+
+func (tl *testingLog) Printf(format string, v ...interface{}) {
+	tl.T.Logf(format+"\n", v...)
+}
@@ -0,0 +1,296 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+const maxConflicts = 100
+
+// Conflict is a value of a flag that lost against the value of a source of higher priority, see `Coordinator`.
+type Conflict struct {
+	Time     time.Time
+	FlagName string
+	// Winner is the name of the source whose value is applied, and WinnerValue that value.
+	Winner      string
+	WinnerValue string
+	// Loser is the name of the source whose value isn't applied, and LoserValue that value.
+	Loser      string
+	LoserValue string
+}
+
+// SourceValue is the value of a flag in one of the sources of a Coordinator.
+type SourceValue struct {
+	Source   string
+	Priority int
+	Value    string
+	// Applied is true for the value of the source of the highest priority, the current value of the flag.
+	Applied bool
+}
+
+// Coordinator owns several Updaters (e.g. a config file, etcd and HTTP overrides) syncing the same FlagSet, and
+// mediates their writes by the priority of their sources: each flag takes the value of the source of the highest
+// priority that set it, and values of lower priority are kept aside and reported as Conflicts. Without it, Updaters
+// call `Set` on the same FlagSet blindly, and the last write wins.
+//
+// Each Updater syncs a shadow FlagSet with the flags of the FlagSet at the time it is added, so all flags must be
+// defined before. Shadowed values are accepted, so that Updaters don't roll them back, and validated only when they
+// are applied. The Coordinator is an Updater itself, initializing its Updaters from the highest priority down so that
+// shadowed values never reach the flags.
+type Coordinator struct {
+	*UpdaterTracker
+	flagSet *flag.FlagSet
+	logger  Logger
+
+	mu        sync.Mutex
+	sources   []*coordinatedSource
+	values    map[string]map[*coordinatedSource]string
+	conflicts []Conflict
+}
+
+// coordinatedSource is an Updater of a Coordinator, with the shadow FlagSet it syncs.
+type coordinatedSource struct {
+	name     string
+	priority int
+	updater  Updater
+	flagSet  *flag.FlagSet
+}
+
+// NewCoordinator constructs a Coordinator of Updaters syncing `flagSet`, logging conflicts to `logger`.
+func NewCoordinator(flagSet *flag.FlagSet, logger Logger) *Coordinator {
+	return &Coordinator{
+		UpdaterTracker: NewUpdaterTracker(),
+		flagSet:        flagSet,
+		logger:         logger,
+		values:         make(map[string]map[*coordinatedSource]string),
+	}
+}
+
+// AddUpdater adds the Updater constructed by `newUpdater` for the shadow FlagSet it is given, as the source `name` (the
+// source recorded by `SetFlagFromSource`) of `priority`, higher priorities winning. Sources must have distinct names
+// and priorities, and be added before `Initialize`.
+func (c *Coordinator) AddUpdater(name string, priority int,
+	newUpdater func(flagSet *flag.FlagSet) (Updater, error)) error {
+	source := &coordinatedSource{name: name, priority: priority}
+	source.flagSet = c.shadowFlagSet(source)
+	// outside of `mu`, as the Updater may set flags already.
+	updater, err := newUpdater(source.flagSet)
+	if err != nil {
+		return err
+	}
+	source.updater = updater
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.State() != UpdaterNew {
+		return fmt.Errorf("flagz: updaters must be added before the coordinator is initialized")
+	}
+	for _, s := range c.sources {
+		if s.name == name || s.priority == priority {
+			return fmt.Errorf("flagz: source %v of priority %d conflicts with source %v of priority %d", name, priority,
+				s.name, s.priority)
+		}
+	}
+	c.sources = append(c.sources, source)
+	// highest priority first.
+	sort.Slice(c.sources, func(i, j int) bool { return c.sources[i].priority > c.sources[j].priority })
+	return nil
+}
+
+func (c *Coordinator) shadowFlagSet(source *coordinatedSource) *flag.FlagSet {
+	shadow := flag.NewFlagSet(c.flagSet.Name()+"/"+source.name, flag.ContinueOnError)
+	c.flagSet.VisitAll(func(f *flag.Flag) {
+		annotations := make(map[string][]string, len(f.Annotations))
+		for key, value := range f.Annotations {
+			annotations[key] = value
+		}
+		shadowFlag := &flag.Flag{
+			Name:        f.Name,
+			Usage:       f.Usage,
+			DefValue:    f.DefValue,
+			Annotations: annotations,
+			Value:       &shadowValue{coordinator: c, source: source, flag: f},
+		}
+		shadow.AddFlag(shadowFlag)
+		if IsFlagDynamic(f) {
+			MarkFlagDynamic(shadowFlag)
+		}
+	})
+	return shadow
+}
+
+// Initialize initializes all Updaters, from the highest priority down, returning the first error.
+func (c *Coordinator) Initialize() error {
+	if err := c.CheckTransition(UpdaterInitialized); err != nil {
+		return err
+	}
+	for _, source := range c.sourcesSnapshot() {
+		if err := source.updater.Initialize(); err != nil {
+			return fmt.Errorf("flagz: initializing source %v: %v", source.name, err)
+		}
+	}
+	return c.Transition(UpdaterInitialized)
+}
+
+// Start starts all Updaters, stopping the started ones if any of them fails to start.
+func (c *Coordinator) Start() error {
+	if err := c.CheckTransition(UpdaterWatching); err != nil {
+		return err
+	}
+	sources := c.sourcesSnapshot()
+	for i, source := range sources {
+		if err := source.updater.Start(); err != nil {
+			for _, started := range sources[:i] {
+				started.updater.Stop()
+			}
+			return fmt.Errorf("flagz: starting source %v: %v", source.name, err)
+		}
+	}
+	return c.Transition(UpdaterWatching)
+}
+
+// Stop stops all Updaters, returning the first error.
+func (c *Coordinator) Stop() error {
+	if c.State() != UpdaterWatching {
+		return nil
+	}
+	var firstErr error
+	for _, source := range c.sourcesSnapshot() {
+		if err := source.updater.Stop(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("flagz: stopping source %v: %v", source.name, err)
+		}
+	}
+	if err := c.Transition(UpdaterStopped); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// Conflicts returns the most recent conflicts between sources, oldest first.
+func (c *Coordinator) Conflicts() []Conflict {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Conflict(nil), c.conflicts...)
+}
+
+// SourceValues returns the values of flag `name` in all sources that set it, from the highest priority down. Values of
+// secrets are redacted.
+func (c *Coordinator) SourceValues(name string) []SourceValue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.flagSet.Lookup(name)
+	values := []SourceValue{}
+	for _, source := range c.sources {
+		if value, ok := c.values[name][source]; ok {
+			values = append(values, SourceValue{
+				Source:   source.name,
+				Priority: source.priority,
+				Value:    RedactFlagValue(f, value),
+				Applied:  len(values) == 0,
+			})
+		}
+	}
+	return values
+}
+
+func (c *Coordinator) sourcesSnapshot() []*coordinatedSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*coordinatedSource(nil), c.sources...)
+}
+
+// set mediates `source` setting flag `f` to `value`, applying it unless a source of higher priority set the flag. The
+// UpdateInfo of `ctx`, e.g. the revision of the update, is passed on to the FlagSet.
+func (c *Coordinator) set(ctx context.Context, source *coordinatedSource, f *flag.Flag, value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	winner := c.winner(f.Name)
+	if winner != nil && winner.priority > source.priority {
+		c.values[f.Name][source] = value
+		c.addConflict(f, winner, c.values[f.Name][winner], source, value)
+		return nil
+	}
+	// Values held by pins are tracked like applied ones, since unpinning applies them.
+	err := SetFlagFromSourceCtx(ctx, c.flagSet, f.Name, value, source.name)
+	held := errors.Is(err, ErrFlagPinned)
+	if err != nil && !held {
+		if c.State() == UpdaterWatching {
+			c.RecordUpdate(f.Name, RedactFlagValue(f, value), err)
+		}
+		return err
+	}
+	if c.values[f.Name] == nil {
+		c.values[f.Name] = make(map[*coordinatedSource]string)
+	}
+	c.values[f.Name][source] = value
+	for _, loser := range c.sources {
+		if loserValue, ok := c.values[f.Name][loser]; ok && loser.priority < source.priority && loserValue != value {
+			c.addConflict(f, source, value, loser, loserValue)
+			break
+		}
+	}
+	if c.State() == UpdaterWatching && !held {
+		c.RecordUpdate(f.Name, RedactFlagValue(f, value), nil)
+	}
+	return err
+}
+
+// winner returns the source of the highest priority that set flag `name`, or nil. Must be called with `mu` held.
+func (c *Coordinator) winner(name string) *coordinatedSource {
+	for _, source := range c.sources {
+		if _, ok := c.values[name][source]; ok {
+			return source
+		}
+	}
+	return nil
+}
+
+// addConflict records and logs a conflict. Must be called with `mu` held.
+func (c *Coordinator) addConflict(f *flag.Flag, winner *coordinatedSource, winnerValue string,
+	loser *coordinatedSource, loserValue string) {
+	conflict := Conflict{
+		Time:        time.Now(),
+		FlagName:    f.Name,
+		Winner:      winner.name,
+		WinnerValue: RedactFlagValue(f, winnerValue),
+		Loser:       loser.name,
+		LoserValue:  RedactFlagValue(f, loserValue),
+	}
+	c.logger.Printf("flagz: conflict on flag=%v: value=%v of source=%v shadows value=%v of source=%v", f.Name,
+		conflict.WinnerValue, winner.name, conflict.LoserValue, loser.name)
+	c.conflicts = append(c.conflicts, conflict)
+	if len(c.conflicts) > maxConflicts {
+		c.conflicts = c.conflicts[len(c.conflicts)-maxConflicts:]
+	}
+}
+
+// shadowValue is the value of a flag in the shadow FlagSet of a source, passing writes to the Coordinator.
+type shadowValue struct {
+	coordinator *Coordinator
+	source      *coordinatedSource
+	flag        *flag.Flag
+}
+
+func (v *shadowValue) Set(value string) error {
+	ctx, ok := updateContext(v)
+	if !ok {
+		ctx = context.Background()
+	}
+	return v.coordinator.set(ctx, v.source, v.flag, value)
+}
+
+func (v *shadowValue) String() string {
+	return v.flag.Value.String()
+}
+
+func (v *shadowValue) Type() string {
+	return v.flag.Value.Type()
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticUpdater sets its values on Initialize, and `push`es more while watching.
+type staticUpdater struct {
+	*flagz.UpdaterTracker
+	flagSet *flag.FlagSet
+	values  map[string]string
+}
+
+func (u *staticUpdater) Initialize() error {
+	for name, value := range u.values {
+		if err := u.flagSet.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *staticUpdater) Start() error { return nil }
+func (u *staticUpdater) Stop() error  { return nil }
+
+func (u *staticUpdater) push(name string, value string) error {
+	return u.flagSet.Set(name, value)
+}
+
+func addStaticUpdater(t *testing.T, c *flagz.Coordinator, name string, priority int,
+	values map[string]string) *staticUpdater {
+	var updater *staticUpdater
+	require.NoError(t, c.AddUpdater(name, priority, func(flagSet *flag.FlagSet) (flagz.Updater, error) {
+		updater = &staticUpdater{UpdaterTracker: flagz.NewUpdaterTracker(), flagSet: flagSet, values: values}
+		return updater, nil
+	}))
+	return updater
+}
+
+func TestCoordinator_AppliesValuesByPriority(t *testing.T) {
+	set := flag.NewFlagSet("coordinator", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 1, "dynamic int")
+	dynString := flagz.DynString(set, "some_dynstring", "default", "dynamic string")
+	c := flagz.NewCoordinator(set, &testingLog{T: t})
+	file := addStaticUpdater(t, c, "file", 10, map[string]string{"some_dynint": "2", "some_dynstring": "file"})
+	etcd := addStaticUpdater(t, c, "etcd", 20, map[string]string{"some_dynint": "3"})
+	require.NoError(t, c.Initialize())
+	require.NoError(t, c.Start())
+	defer c.Stop()
+
+	assert.EqualValues(t, 3, dynInt.Get(), "the source of the highest priority must win")
+	assert.Equal(t, "file", dynString.Get(), "flags not set by higher priorities must get lower ones")
+	assert.Equal(t, "etcd", flagz.FlagSource(set.Lookup("some_dynint")))
+	assert.Equal(t, []flagz.SourceValue{
+		{Source: "etcd", Priority: 20, Value: "3", Applied: true},
+		{Source: "file", Priority: 10, Value: "2"},
+	}, c.SourceValues("some_dynint"))
+	conflicts := c.Conflicts()
+	require.Len(t, conflicts, 1, "shadowed values must be reported")
+	assert.Equal(t, "etcd", conflicts[0].Winner)
+	assert.Equal(t, "2", conflicts[0].LoserValue)
+
+	require.NoError(t, file.push("some_dynint", "4"), "shadowed values must be accepted")
+	assert.EqualValues(t, 3, dynInt.Get(), "shadowed values must not be applied")
+	assert.Len(t, c.Conflicts(), 2)
+
+	require.NoError(t, etcd.push("some_dynint", "5"))
+	assert.EqualValues(t, 5, dynInt.Get())
+	assert.Error(t, etcd.push("some_dynint", "nope"), "bad values of the winning source must be rejected")
+	event := <-c.Events()
+	assert.Equal(t, "5", event.Value, "applied values must be published")
+	event = <-c.Events()
+	assert.Error(t, event.Err, "rejected values must be published")
+}
+
+func TestCoordinator_RejectsClashingSources(t *testing.T) {
+	set := flag.NewFlagSet("coordinator", flag.ContinueOnError)
+	c := flagz.NewCoordinator(set, &testingLog{T: t})
+	addStaticUpdater(t, c, "file", 10, nil)
+	newUpdater := func(flagSet *flag.FlagSet) (flagz.Updater, error) {
+		return &staticUpdater{UpdaterTracker: flagz.NewUpdaterTracker(), flagSet: flagSet}, nil
+	}
+	assert.Error(t, c.AddUpdater("file", 20, newUpdater), "names must be distinct")
+	assert.Error(t, c.AddUpdater("etcd", 10, newUpdater), "priorities must be distinct")
+	require.NoError(t, c.Initialize())
+	assert.Error(t, c.AddUpdater("etcd", 20, newUpdater), "sources must be added before initializing")
+}
+
+func TestCoordinator_HoldsValuesOfPinnedFlags(t *testing.T) {
+	set := flag.NewFlagSet("coordinator", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 1, "dynamic int")
+	c := flagz.NewCoordinator(set, &testingLog{T: t})
+	etcd := addStaticUpdater(t, c, "etcd", 20, nil)
+	require.NoError(t, c.Initialize())
+	require.NoError(t, c.Start())
+	defer c.Stop()
+
+	flagz.PinFlag(set.Lookup("some_dynint"))
+	err := etcd.push("some_dynint", "2")
+	assert.True(t, errors.Is(err, flagz.ErrFlagPinned), "held values must be reported as pinned through the shadow flag")
+	assert.EqualValues(t, 1, dynInt.Get(), "values of pinned flags must be held")
+	assert.Zero(t, c.Status().UpdateErrors, "held values must not count as rejected")
+	assert.Equal(t, []flagz.SourceValue{{Source: "etcd", Priority: 20, Value: "2", Applied: true}},
+		c.SourceValues("some_dynint"), "held values must be kept for unpinning")
+
+	require.NoError(t, flagz.UnpinFlag(set, "some_dynint"))
+	assert.EqualValues(t, 2, dynInt.Get(), "unpinning must apply the held value")
+	assert.Zero(t, c.Status().UpdateErrors)
+}
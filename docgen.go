@@ -0,0 +1,169 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DocsSubcommand is the first argument that makes `RunDocsSubcommand` print the flag reference, e.g.
+// `myserver flagz-docs --format=html > flags.html`.
+const DocsSubcommand = "flagz-docs"
+
+// DocFormat is the output format of `WriteFlagReference`.
+type DocFormat string
+
+const (
+	// MarkdownDocs renders the flag reference as a Markdown table.
+	MarkdownDocs DocFormat = "markdown"
+	// HTMLDocs renders the flag reference as an HTML page.
+	HTMLDocs DocFormat = "html"
+)
+
+// flagReference is a row of the flag reference.
+type flagReference struct {
+	Name     string
+	Type     string
+	Default  string
+	Dynamic  bool
+	Usage    string
+	Details  string
+	Format   string
+	Examples []string
+	Tags     []string
+}
+
+// WriteFlagReference writes the documentation of all flags of `flagSet` to `w`: their names, types, defaults, whether
+// they are dynamic, usage strings, long-form docs (see `SetFlagDocs`), format hints, examples and tags, in the order of
+// their names. Defaults of secret flags are redacted.
+//
+// The output only depends on the definitions of flags, so it can be generated by `go generate` or in CI to keep the
+// per-service flag references in sync with the code.
+func WriteFlagReference(w io.Writer, flagSet *flag.FlagSet, format DocFormat) error {
+	refs := []*flagReference{}
+	flagSet.VisitAll(func(f *flag.Flag) {
+		ref := &flagReference{
+			Name:    f.Name,
+			Type:    f.Value.Type(),
+			Default: RedactFlagValue(f, f.DefValue),
+			Dynamic: IsFlagDynamic(f),
+			Usage:   f.Usage,
+			Format:  FlagFormatHint(f),
+		}
+		if docs := GetFlagDocs(f); docs != nil {
+			ref.Details = docs.Details
+			ref.Examples = docs.Examples
+		}
+		for key, values := range f.Annotations {
+			if strings.HasPrefix(key, "__") {
+				continue
+			}
+			if len(values) == 0 {
+				ref.Tags = append(ref.Tags, key)
+			} else {
+				ref.Tags = append(ref.Tags, key+"="+strings.Join(values, ","))
+			}
+		}
+		sort.Strings(ref.Tags)
+		refs = append(refs, ref)
+	})
+	switch format {
+	case MarkdownDocs:
+		return writeMarkdownReference(w, refs)
+	case HTMLDocs:
+		return htmlReferenceTemplate.Execute(w, refs)
+	}
+	return fmt.Errorf("flagz: unknown doc format %q", format)
+}
+
+// RunDocsSubcommand writes the flag reference of `flagSet` to `w` if `args` (e.g. `os.Args[1:]`) start with
+// `DocsSubcommand`, returning whether they did, so that binaries can document their own flags:
+//
+//	if ok, err := flagz.RunDocsSubcommand(flagSet, os.Args[1:], os.Stdout); ok {
+//		...exit with err...
+//	}
+//
+// The subcommand accepts a `--format` of "markdown" (the default) or "html".
+func RunDocsSubcommand(flagSet *flag.FlagSet, args []string, w io.Writer) (bool, error) {
+	if len(args) == 0 || args[0] != DocsSubcommand {
+		return false, nil
+	}
+	docsFlags := flag.NewFlagSet(DocsSubcommand, flag.ContinueOnError)
+	docsFlags.SetOutput(w)
+	format := docsFlags.String("format", string(MarkdownDocs), "format of the flag reference, markdown or html")
+	if err := docsFlags.Parse(args[1:]); err != nil {
+		return true, err
+	}
+	return true, WriteFlagReference(w, flagSet, DocFormat(*format))
+}
+
+func writeMarkdownReference(w io.Writer, refs []*flagReference) error {
+	buf := &bytes.Buffer{}
+	buf.WriteString("| Name | Type | Default | Dynamic | Usage | Tags |\n")
+	buf.WriteString("|------|------|---------|---------|-------|------|\n")
+	for _, ref := range refs {
+		dynamic := "no"
+		if ref.Dynamic {
+			dynamic = "yes"
+		}
+		usage := markdownCell(ref.Usage)
+		if ref.Details != "" {
+			usage += "<br>" + markdownCell(ref.Details)
+		}
+		if ref.Format != "" {
+			usage += "<br>Format: " + markdownCell(ref.Format)
+		}
+		if len(ref.Examples) > 0 {
+			examples := make([]string, len(ref.Examples))
+			for i, example := range ref.Examples {
+				examples[i] = "`" + markdownCell(example) + "`"
+			}
+			usage += "<br>Examples: " + strings.Join(examples, ", ")
+		}
+		tags := make([]string, len(ref.Tags))
+		for i, tag := range ref.Tags {
+			tags[i] = "`" + markdownCell(tag) + "`"
+		}
+		fmt.Fprintf(buf, "| `%s` | %s | `%s` | %s | %s | %s |\n", ref.Name, markdownCell(ref.Type),
+			markdownCell(ref.Default), dynamic, usage, strings.Join(tags, " "))
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// markdownCell escapes `s` to stay within a cell of a Markdown table.
+func markdownCell(s string) string {
+	s = strings.Replace(s, "|", `\|`, -1)
+	return strings.Replace(s, "\n", "<br>", -1)
+}
+
+var htmlReferenceTemplate = template.Must(template.New("reference").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Flags</title></head>
+<body>
+<table>
+<tr><th>Name</th><th>Type</th><th>Default</th><th>Dynamic</th><th>Usage</th><th>Tags</th></tr>
+{{- range . }}
+<tr>
+  <td><code>{{ .Name }}</code></td>
+  <td>{{ .Type }}</td>
+  <td><code>{{ .Default }}</code></td>
+  <td>{{ if .Dynamic }}yes{{ else }}no{{ end }}</td>
+  <td>{{ .Usage }}{{ if .Details }}<p>{{ .Details }}</p>{{ end }}
+    {{- if .Format }}<p>Format: {{ .Format }}</p>{{ end }}
+    {{- if .Examples }}<p>Examples: {{ range .Examples }}<code>{{ . }}</code> {{ end }}</p>{{ end }}</td>
+  <td>{{ range .Tags }}<code>{{ . }}</code> {{ end }}</td>
+</tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
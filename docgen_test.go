@@ -0,0 +1,63 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func docgenFlagSet() *flag.FlagSet {
+	set := flag.NewFlagSet("docgen", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_dynint", 5, "Retries | per request")
+	flagz.DynSecret(set, "some_secret", "hunter2", "API key")
+	set.Int32("some_int", 8080, "Port <to listen on>")
+	set.SetAnnotation("some_dynint", "owner", []string{"team-a"})
+	flagz.SetFlagDocs(set.Lookup("some_dynint"), flagz.FlagDocs{Details: "Raise with care."})
+	flagz.SetFlagExamples(set.Lookup("some_dynint"), "3", "10")
+	return set
+}
+
+func TestWriteFlagReference_Markdown(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, flagz.WriteFlagReference(buf, docgenFlagSet(), flagz.MarkdownDocs))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 5, "header, separator and a row per flag")
+	assert.Equal(t, "| `some_dynint` | dyn_int64 | `5` | yes | Retries \\| per request<br>Raise with care.<br>"+
+		"Format: integer like 42<br>Examples: `3`, `10` | `owner=team-a` |", lines[2])
+	assert.Equal(t, "| `some_int` | int32 | `8080` | no | Port <to listen on> |  |", lines[3])
+	assert.NotContains(t, buf.String(), "hunter2", "secret defaults must be redacted")
+	assert.Contains(t, lines[4], flagz.RedactedValue)
+}
+
+func TestWriteFlagReference_HTML(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, flagz.WriteFlagReference(buf, docgenFlagSet(), flagz.HTMLDocs))
+	assert.Contains(t, buf.String(), "<td><code>some_dynint</code></td>")
+	assert.Contains(t, buf.String(), "Port &lt;to listen on&gt;", "usage must be escaped")
+	assert.Contains(t, buf.String(), "<code>owner=team-a</code>")
+	assert.Contains(t, buf.String(), "<p>Format: integer like 42</p>")
+	assert.NotContains(t, buf.String(), "hunter2", "secret defaults must be redacted")
+
+	assert.Error(t, flagz.WriteFlagReference(buf, docgenFlagSet(), flagz.DocFormat("pdf")))
+}
+
+func TestRunDocsSubcommand(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ok, err := flagz.RunDocsSubcommand(docgenFlagSet(), []string{"--some_int=1"}, buf)
+	assert.False(t, ok, "other arguments must be left to the binary")
+	assert.NoError(t, err)
+	assert.Empty(t, buf.String())
+
+	ok, err = flagz.RunDocsSubcommand(docgenFlagSet(), []string{flagz.DocsSubcommand, "--format=html"}, buf)
+	assert.True(t, ok)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "<!DOCTYPE html>")
+}
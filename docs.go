@@ -0,0 +1,101 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	docDetailsMarker  = "__doc_details"
+	docExamplesMarker = "__doc_examples"
+	docLinksMarker    = "__doc_links"
+	docFormatMarker   = "__doc_format"
+)
+
+// FlagDocs is the long-form documentation of a flag, rendered by the status endpoint next to its usage string.
+type FlagDocs struct {
+	// Details explains what the flag does and what to consider before changing it.
+	Details string `json:"details,omitempty"`
+	// Examples are sample values of the flag.
+	Examples []string `json:"examples,omitempty"`
+	// Links point to further documentation, e.g. runbooks or design docs.
+	Links []string `json:"links,omitempty"`
+	// Format hints at the format of values, e.g. "duration like 250ms". Flags without one get the hint of their
+	// value, see `FlagFormatHint`.
+	Format string `json:"format,omitempty"`
+}
+
+// FormatHinter is implemented by flag values that know the format of their inputs, e.g. "duration like 250ms".
+type FormatHinter interface {
+	FormatHint() string
+}
+
+// SetFlagDocs attaches `docs` to the flag, replacing any previously set.
+func SetFlagDocs(f *flag.Flag, docs FlagDocs) {
+	if f.Annotations == nil {
+		f.Annotations = make(map[string][]string)
+	}
+	delete(f.Annotations, docDetailsMarker)
+	if docs.Details != "" {
+		f.Annotations[docDetailsMarker] = []string{docs.Details}
+	}
+	delete(f.Annotations, docFormatMarker)
+	if docs.Format != "" {
+		f.Annotations[docFormatMarker] = []string{docs.Format}
+	}
+	f.Annotations[docExamplesMarker] = docs.Examples
+	f.Annotations[docLinksMarker] = docs.Links
+}
+
+// GetFlagDocs returns the documentation attached to the flag with SetFlagDocs, or nil if there is none.
+func GetFlagDocs(f *flag.Flag) *FlagDocs {
+	docs := &FlagDocs{
+		Examples: f.Annotations[docExamplesMarker],
+		Links:    f.Annotations[docLinksMarker],
+	}
+	if details := f.Annotations[docDetailsMarker]; len(details) > 0 {
+		docs.Details = details[0]
+	}
+	if format := f.Annotations[docFormatMarker]; len(format) > 0 {
+		docs.Format = format[0]
+	}
+	if docs.Details == "" && len(docs.Examples) == 0 && len(docs.Links) == 0 && docs.Format == "" {
+		return nil
+	}
+	return docs
+}
+
+// SetFlagExamples sets the example values of the flag, keeping the rest of its docs.
+func SetFlagExamples(f *flag.Flag, examples ...string) {
+	docs := GetFlagDocs(f)
+	if docs == nil {
+		docs = &FlagDocs{}
+	}
+	docs.Examples = examples
+	SetFlagDocs(f, *docs)
+}
+
+// SetFlagFormatHint sets the format hint of the flag, overriding the one of its value and keeping the rest of its
+// docs.
+func SetFlagFormatHint(f *flag.Flag, format string) {
+	docs := GetFlagDocs(f)
+	if docs == nil {
+		docs = &FlagDocs{}
+	}
+	docs.Format = format
+	SetFlagDocs(f, *docs)
+}
+
+// FlagFormatHint returns the format hint of the flag set with `SetFlagFormatHint` (or `SetFlagDocs`), or else the
+// hint of its value if it is a FormatHinter, or an empty string.
+func FlagFormatHint(f *flag.Flag) string {
+	if format := f.Annotations[docFormatMarker]; len(format) > 0 && format[0] != "" {
+		return format[0]
+	}
+	if hinter, ok := f.Value.(FormatHinter); ok {
+		return hinter.FormatHint()
+	}
+	return ""
+}
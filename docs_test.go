@@ -0,0 +1,58 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagDocs(t *testing.T) {
+	set := flag.NewFlagSet("docs", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_int", 1, "Some int")
+	f := set.Lookup("some_int")
+	assert.Nil(t, flagz.GetFlagDocs(f), "undocumented flags must have no docs")
+
+	flagz.SetFlagDocs(f, flagz.FlagDocs{
+		Details:  "Controls the number of retries.",
+		Examples: []string{"0", "3"},
+		Links:    []string{"https://example.com/runbook"},
+	})
+	docs := flagz.GetFlagDocs(f)
+	require.NotNil(t, docs)
+	assert.Equal(t, "Controls the number of retries.", docs.Details)
+	assert.Equal(t, []string{"0", "3"}, docs.Examples)
+	assert.Equal(t, []string{"https://example.com/runbook"}, docs.Links)
+	assert.True(t, flagz.IsFlagDynamic(f), "docs must not clobber other annotations")
+
+	flagz.SetFlagDocs(f, flagz.FlagDocs{Examples: []string{"5"}})
+	assert.Equal(t, &flagz.FlagDocs{Examples: []string{"5"}}, flagz.GetFlagDocs(f), "docs must be replaced")
+}
+
+func TestFlagFormatHint(t *testing.T) {
+	set := flag.NewFlagSet("docs", flag.ContinueOnError)
+	flagz.DynDuration(set, "some_duration", time.Second, "Some duration")
+	flagz.DynString(set, "some_string", "", "Some string")
+	set.Int("some_static_int", 1, "Some int")
+	assert.Equal(t, "duration like 250ms or 1h30m", flagz.FlagFormatHint(set.Lookup("some_duration")),
+		"dynamic values must provide their hints")
+	assert.Equal(t, "", flagz.FlagFormatHint(set.Lookup("some_string")))
+	assert.Equal(t, "", flagz.FlagFormatHint(set.Lookup("some_static_int")))
+
+	f := set.Lookup("some_string")
+	flagz.SetFlagDocs(f, flagz.FlagDocs{Details: "Greeting shown to users."})
+	flagz.SetFlagFormatHint(f, "text up to 80 characters")
+	flagz.SetFlagExamples(f, "Hello", "Howdy")
+	assert.Equal(t, "text up to 80 characters", flagz.FlagFormatHint(f))
+	assert.Equal(t, &flagz.FlagDocs{
+		Details:  "Greeting shown to users.",
+		Examples: []string{"Hello", "Howdy"},
+		Format:   "text up to 80 characters",
+	}, flagz.GetFlagDocs(f), "setting examples and hints must keep the rest of the docs")
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// DumpSource is the source recorded by `LoadFromFile` for the values it sets, see `FlagSource`.
+const DumpSource = "dump"
+
+// FileFormat is the encoding of files written by `WriteToFile` and read by `LoadFromFile`.
+type FileFormat string
+
+const (
+	// JSONFormat encodes the flags as a JSON object of flag names to values.
+	JSONFormat FileFormat = "json"
+	// YAMLFormat encodes the flags as a YAML mapping of flag names to values.
+	YAMLFormat FileFormat = "yaml"
+)
+
+// WriteToFile writes the current values of all dynamic flags of `flagSet` to the file at `path`, e.g. to capture the
+// runtime state of an instance during an incident and replay it in a repro environment with `LoadFromFile`.
+//
+// Values of flags marked as secret are written as RedactedValue, and skipped by `LoadFromFile`.
+func WriteToFile(flagSet *flag.FlagSet, path string, format FileFormat) error {
+	values := make(map[string]string)
+	for _, f := range DynamicFlags(flagSet) {
+		values[f.Name] = RedactFlagValue(f, f.Value.String())
+	}
+	var out []byte
+	var err error
+	switch format {
+	case JSONFormat:
+		out, err = json.MarshalIndent(values, "", "  ")
+	case YAMLFormat:
+		out, err = yaml.Marshal(values)
+	default:
+		return fmt.Errorf("flagz: unknown file format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("flagz: encoding flags: %v", err)
+	}
+	return ioutil.WriteFile(path, out, 0600)
+}
+
+// LoadFromFile sets the dynamic flags of `flagSet` to the values in the file at `path`, as written by `WriteToFile`.
+//
+// All values are applied, even if some fail; their failures (including values of unknown or static flags) are
+// returned as a `*FlagErrors`. Redacted values of secret flags are skipped.
+func LoadFromFile(flagSet *flag.FlagSet, path string, format FileFormat) error {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]string)
+	switch format {
+	case JSONFormat:
+		err = json.Unmarshal(in, &values)
+	case YAMLFormat:
+		err = yaml.Unmarshal(in, &values)
+	default:
+		return fmt.Errorf("flagz: unknown file format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("flagz: decoding flags from %v: %v", path, err)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := &FlagErrors{Source: path}
+	for _, name := range names {
+		f := flagSet.Lookup(name)
+		if f == nil {
+			errs.Add(name, ErrFlagNotFound)
+			continue
+		}
+		if !IsFlagDynamic(f) {
+			errs.Add(name, ErrFlagNotDynamic)
+			continue
+		}
+		if IsFlagSecret(f) && values[name] == RedactedValue {
+			continue
+		}
+		if err := SetFlagFromSource(flagSet, name, values[name], DumpSource); err != nil {
+			errs.Add(name, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteToFile_RoundTripsDynamicFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dump_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, format := range []flagz.FileFormat{flagz.JSONFormat, flagz.YAMLFormat} {
+		source := flag.NewFlagSet("source", flag.ContinueOnError)
+		flagz.DynInt64(source, "some_dynint", 1, "dynamic int").Set("10001")
+		flagz.DynString(source, "some_dynstring", "default", "dynamic string").Set("incident: yes")
+		flagz.DynSecret(source, "some_secret", "default", "dynamic secret").Set("hunter2")
+		source.Int32("some_int", 1, "static int")
+		path := filepath.Join(dir, "flags."+string(format))
+		require.NoError(t, flagz.WriteToFile(source, path, format), "format %v", format)
+
+		content, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		assert.NotContains(t, string(content), "hunter2", "secrets must be redacted")
+		assert.NotContains(t, string(content), "some_int:", "static flags must not be dumped")
+
+		repro := flag.NewFlagSet("repro", flag.ContinueOnError)
+		dynInt := flagz.DynInt64(repro, "some_dynint", 1, "dynamic int")
+		dynString := flagz.DynString(repro, "some_dynstring", "default", "dynamic string")
+		secret := flagz.DynSecret(repro, "some_secret", "other", "dynamic secret")
+		require.NoError(t, flagz.LoadFromFile(repro, path, format), "format %v", format)
+		assert.EqualValues(t, 10001, dynInt.Get())
+		assert.Equal(t, "incident: yes", dynString.Get())
+		assert.Equal(t, "other", secret.Get(), "redacted secrets must be skipped")
+		assert.Equal(t, flagz.DumpSource, flagz.FlagSource(repro.Lookup("some_dynint")))
+	}
+}
+
+func TestLoadFromFile_ReturnsFlagErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dump_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "flags.json")
+	content := `{"some_dynint": "bad", "some_dynstring": "changed", "some_int": "2", "unknown": "1"}`
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	set := flag.NewFlagSet("repro", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_dynint", 1, "dynamic int")
+	dynString := flagz.DynString(set, "some_dynstring", "default", "dynamic string")
+	set.Int32("some_int", 1, "static int")
+	err = flagz.LoadFromFile(set, path, flagz.JSONFormat)
+	var flagErrs *flagz.FlagErrors
+	require.True(t, errors.As(err, &flagErrs))
+	assert.Len(t, flagErrs.Errors, 3)
+	assert.True(t, errors.Is(err, flagz.ErrFlagNotFound))
+	assert.True(t, errors.Is(err, flagz.ErrFlagNotDynamic))
+	assert.Equal(t, "changed", dynString.Get(), "valid values must be applied despite the failures")
+
+	assert.Error(t, flagz.LoadFromFile(set, path, flagz.FileFormat("toml")))
+}
@@ -0,0 +1,152 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynBool creates a `Flag` that represents `bool` which is safe to change dynamically at runtime.
+// As with static bool flags, `--name` without a value sets it to true.
+func DynBool(flagSet *flag.FlagSet, name string, value bool, usage string) *DynBoolValue {
+	return DynBoolP(flagSet, name, "", value, usage)
+}
+
+// DynBoolP is like DynBool, but accepts a shorthand letter that can be used after a single dash.
+func DynBoolP(flagSet *flag.FlagSet, name string, shorthand string, value bool, usage string) *DynBoolValue {
+	dynValue := &DynBoolValue{}
+	if value {
+		dynValue.val = 1
+	}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	flag.NoOptDefVal = "true"
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynBoolValue is a flag-related `bool` value wrapper.
+type DynBoolValue struct {
+	dynChangeTime
+	val uint32
+
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func(bool) error
+	validatorCtx    func(context.Context, bool) error
+	notifier        func(oldValue bool, newValue bool)
+	notifierCtx     func(ctx context.Context, oldValue bool, newValue bool)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the value in a thread-safe manner, with a single atomic load and no allocations.
+func (d *DynBoolValue) Get() bool {
+	return atomic.LoadUint32(&d.val) != 0
+}
+
+// Set updates the value from a string representation in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass an
+// optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynBoolValue) Set(input string) error {
+	val, err := strconv.ParseBool(input)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	var newBits uint32
+	if val {
+		newBits = 1
+	}
+	oldVal := atomic.SwapUint32(&d.val, newBits) != 0
+	d.markChanged()
+	if d.notifier != nil {
+		RunNotifier(func() { d.notifier(oldVal, val) })
+	}
+	if d.notifierCtx != nil {
+		notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+		RunNotifierCtx(d, d.notifierTimeout, notify)
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynBoolValue) WithValidator(validator func(bool) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynBoolValue) WithValidatorCtx(validator func(ctx context.Context, value bool) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `ValidateAll`.
+func (d *DynBoolValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynBoolValue) WithNotifier(notifier func(oldValue bool, newValue bool)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynBoolValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue bool, newValue bool),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// EnabledIn implements `FeatureFlag`, enabling the feature for all EvalContexts if the value is true.
+func (d *DynBoolValue) EnabledIn(ec *EvalContext) bool {
+	return d.Get()
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynBoolValue) Type() string {
+	return "dyn_bool"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynBoolValue) FormatHint() string {
+	return "true or false"
+}
+
+// String returns the canonical string representation of the type.
+func (d *DynBoolValue) String() string {
+	return strconv.FormatBool(d.Get())
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynBool_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynBool(set, "some_bool_1", true, "Use it or lose it")
+	assert.True(t, IsFlagDynamic(set.Lookup("some_bool_1")))
+	assert.Equal(t, true, dynFlag.Get(), "value must be default after create")
+	assert.NoError(t, set.Set("some_bool_1", "false"), "setting value must succeed")
+	assert.Equal(t, false, dynFlag.Get(), "value must be set after update")
+	assert.Equal(t, "false", dynFlag.String())
+	assert.Error(t, set.Set("some_bool_1", "maybe"), "non-bool values must be rejected")
+	assert.NoError(t, set.Parse([]string{"--some_bool_1"}), "flag without a value must parse")
+	assert.Equal(t, true, dynFlag.Get(), "flag without a value must set true")
+}
+
+func TestDynBool_FiresNotifier(t *testing.T) {
+	waitCh := make(chan bool, 1)
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynBool(set, "some_bool_1", false, "Use it or lose it").WithNotifier(func(oldVal bool, newVal bool) {
+		assert.False(t, oldVal, "old value in notify must match previous value")
+		assert.True(t, newVal, "new value in notify must match set value")
+		waitCh <- true
+	})
+	set.Set("some_bool_1", "true")
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "failed to trigger notifier")
+	case <-waitCh:
+	}
+}
+
+func TestDynBool_GetDoesNotAllocate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynBool(set, "some_bool_1", true, "Use it or lose it")
+	assert.EqualValues(t, 0, testing.AllocsPerRun(100, func() { value.Get() }))
+}
+
+func Benchmark_Bool_Dyn_Get(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynBool(set, "some_bool_1", true, "Use it or lose it")
+	set.Set("some_bool_1", "false")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		value.Get()
+	}
+}
+
+func Benchmark_Bool_Dyn_GetParallel(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynBool(set, "some_bool_1", true, "Use it or lose it")
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			value.Get()
+		}
+	})
+}
@@ -0,0 +1,273 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// CircuitBreakerConfig are the settings of a circuit breaker, the value of a `DynCircuitBreakerConfig` flag.
+type CircuitBreakerConfig struct {
+	// ErrorThreshold is the fraction of failed calls within the Window, in the (0, 1] range, that opens the breaker.
+	ErrorThreshold float64
+	// MinRequests is the number of calls within the Window below which the breaker doesn't open, so that a few
+	// failures in a quiet period don't trip it.
+	MinRequests int
+	// Window is the period over which the ratio of failures is computed.
+	Window time.Duration
+	// OpenDuration is how long the breaker stays open, rejecting calls, before it turns half-open.
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of calls let through while half-open; if they all succeed the breaker closes,
+	// and any failure opens it again.
+	HalfOpenProbes int
+}
+
+// CircuitBreakerReconfigurer is the contract for circuit breakers (or adapters of breaker libraries) that can apply
+// new settings in place, keeping their state, so that a `DynCircuitBreakerConfig` can reconfigure them at runtime.
+type CircuitBreakerReconfigurer interface {
+	// Reconfigure applies `config`, which is valid. It is called on the go-routine of `Set` of the flag, in the order
+	// of the changes, so it must not block.
+	Reconfigure(config CircuitBreakerConfig)
+}
+
+// circuitBreakerConfigJSON is the JSON form of a CircuitBreakerConfig, with durations like "10s".
+type circuitBreakerConfigJSON struct {
+	ErrorThreshold float64 `json:"error_threshold"`
+	MinRequests    int     `json:"min_requests,omitempty"`
+	Window         string  `json:"window"`
+	OpenDuration   string  `json:"open_duration"`
+	HalfOpenProbes int     `json:"half_open_probes"`
+}
+
+// DynCircuitBreakerConfig creates a `Flag` that represents a CircuitBreakerConfig, which is safe to change dynamically
+// at runtime. Values are JSON objects, e.g.
+//
+//	{"error_threshold": 0.5, "min_requests": 20, "window": "10s", "open_duration": "30s", "half_open_probes": 3}
+//
+// The breakers added with `AddBreaker` are reconfigured in place on every change.
+func DynCircuitBreakerConfig(flagSet *flag.FlagSet, name string, value CircuitBreakerConfig,
+	usage string) *DynCircuitBreakerConfigValue {
+	return DynCircuitBreakerConfigP(flagSet, name, "", value, usage)
+}
+
+// DynCircuitBreakerConfigP is like DynCircuitBreakerConfig, but accepts a shorthand letter that can be used after a
+// single dash.
+func DynCircuitBreakerConfigP(flagSet *flag.FlagSet, name string, shorthand string, value CircuitBreakerConfig,
+	usage string) *DynCircuitBreakerConfigValue {
+	dynValue := &DynCircuitBreakerConfigValue{ptr: unsafe.Pointer(&value)}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynCircuitBreakerConfigValue is a flag-related CircuitBreakerConfig value wrapper.
+type DynCircuitBreakerConfigValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer // *CircuitBreakerConfig
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`, and reconfiguring breakers.
+	breakers        map[*circuitBreakerEntry]struct{}
+	validator       func(CircuitBreakerConfig) error
+	validatorCtx    func(context.Context, CircuitBreakerConfig) error
+	notifier        func(oldValue CircuitBreakerConfig, newValue CircuitBreakerConfig)
+	notifierCtx     func(ctx context.Context, oldValue CircuitBreakerConfig, newValue CircuitBreakerConfig)
+	notifierTimeout time.Duration
+}
+
+// circuitBreakerEntry wraps an added breaker, so that the same breaker can be added and removed multiple times.
+type circuitBreakerEntry struct {
+	breaker CircuitBreakerReconfigurer
+}
+
+// Get retrieves the CircuitBreakerConfig in a thread-safe manner.
+func (d *DynCircuitBreakerConfigValue) Get() CircuitBreakerConfig {
+	return *(*CircuitBreakerConfig)(atomic.LoadPointer(&d.ptr))
+}
+
+// AddBreaker reconfigures `breaker` with the current value, and then with every new one until the returned function
+// is called, e.g. when the breaker is discarded. It is safe to call at any time.
+func (d *DynCircuitBreakerConfigValue) AddBreaker(breaker CircuitBreakerReconfigurer) (remove func()) {
+	entry := &circuitBreakerEntry{breaker: breaker}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.breakers == nil {
+		d.breakers = make(map[*circuitBreakerEntry]struct{})
+	}
+	d.breakers[entry] = struct{}{}
+	breaker.Reconfigure(d.Get())
+	return func() {
+		d.setMu.Lock()
+		defer d.setMu.Unlock()
+		delete(d.breakers, entry)
+	}
+}
+
+// Set updates the value from a JSON CircuitBreakerConfig in a thread-safe manner, and reconfigures the breakers added
+// with `AddBreaker`.
+// This operation may return an error if the provided `input` doesn't parse, has settings out of their range, or
+// doesn't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynCircuitBreakerConfigValue) Set(input string) error {
+	val, err := parseCircuitBreakerConfig(input)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
+	d.markChanged()
+	for entry := range d.breakers {
+		entry.breaker.Reconfigure(val)
+	}
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*CircuitBreakerConfig)(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set, in addition to the range checks of the
+// settings. Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynCircuitBreakerConfigValue) WithValidator(validator func(CircuitBreakerConfig) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynCircuitBreakerConfigValue) WithValidatorCtx(
+	validator func(ctx context.Context, value CircuitBreakerConfig) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the range checks and the validator, e.g. to make sure that the default
+// passes them. See `ValidateAll`.
+func (d *DynCircuitBreakerConfigValue) Validate() error {
+	if err := validCircuitBreakerConfig(d.Get()); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynCircuitBreakerConfigValue) WithNotifier(
+	notifier func(oldValue CircuitBreakerConfig, newValue CircuitBreakerConfig)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynCircuitBreakerConfigValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue CircuitBreakerConfig, newValue CircuitBreakerConfig),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynCircuitBreakerConfigValue) Type() string {
+	return "dyn_circuit_breaker_config"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynCircuitBreakerConfigValue) FormatHint() string {
+	return `JSON breaker config like {"error_threshold": 0.5, "window": "10s", "open_duration": "30s", ` +
+		`"half_open_probes": 3}`
+}
+
+// String returns the canonical JSON representation of the CircuitBreakerConfig.
+func (d *DynCircuitBreakerConfigValue) String() string {
+	val := d.Get()
+	out, err := json.Marshal(&circuitBreakerConfigJSON{
+		ErrorThreshold: val.ErrorThreshold,
+		MinRequests:    val.MinRequests,
+		Window:         val.Window.String(),
+		OpenDuration:   val.OpenDuration.String(),
+		HalfOpenProbes: val.HalfOpenProbes,
+	})
+	if err != nil {
+		return "ERR"
+	}
+	return string(out)
+}
+
+func parseCircuitBreakerConfig(input string) (CircuitBreakerConfig, error) {
+	wire := &circuitBreakerConfigJSON{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(input)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(wire); err != nil {
+		return CircuitBreakerConfig{}, err
+	}
+	config := CircuitBreakerConfig{
+		ErrorThreshold: wire.ErrorThreshold,
+		MinRequests:    wire.MinRequests,
+		HalfOpenProbes: wire.HalfOpenProbes,
+	}
+	var err error
+	if config.Window, err = time.ParseDuration(wire.Window); err != nil {
+		return CircuitBreakerConfig{}, fmt.Errorf("window: %v", err)
+	}
+	if config.OpenDuration, err = time.ParseDuration(wire.OpenDuration); err != nil {
+		return CircuitBreakerConfig{}, fmt.Errorf("open_duration: %v", err)
+	}
+	return config, validCircuitBreakerConfig(config)
+}
+
+func validCircuitBreakerConfig(config CircuitBreakerConfig) error {
+	if math.IsNaN(config.ErrorThreshold) || config.ErrorThreshold <= 0 || config.ErrorThreshold > 1 {
+		return fmt.Errorf("error threshold %v not in (0, 1] range", config.ErrorThreshold)
+	}
+	if config.MinRequests < 0 {
+		return fmt.Errorf("min requests %v must not be negative", config.MinRequests)
+	}
+	if config.Window <= 0 {
+		return fmt.Errorf("window %v must be positive", config.Window)
+	}
+	if config.OpenDuration <= 0 {
+		return fmt.Errorf("open duration %v must be positive", config.OpenDuration)
+	}
+	if config.HalfOpenProbes < 1 {
+		return fmt.Errorf("half-open probes %v must be at least 1", config.HalfOpenProbes)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var someBreakerConfig = CircuitBreakerConfig{
+	ErrorThreshold: 0.5,
+	MinRequests:    20,
+	Window:         10 * time.Second,
+	OpenDuration:   30 * time.Second,
+	HalfOpenProbes: 3,
+}
+
+type recordingBreaker struct {
+	configs []CircuitBreakerConfig
+}
+
+func (b *recordingBreaker) Reconfigure(config CircuitBreakerConfig) {
+	b.configs = append(b.configs, config)
+}
+
+func TestDynCircuitBreakerConfig_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynCircuitBreakerConfig(set, "some_breaker_1", someBreakerConfig, "Use it or lose it")
+	assert.Equal(t, someBreakerConfig, dynFlag.Get())
+	assert.Equal(t,
+		`{"error_threshold":0.5,"min_requests":20,"window":"10s","open_duration":"30s","half_open_probes":3}`,
+		dynFlag.String())
+
+	require.NoError(t, set.Set("some_breaker_1",
+		`{"error_threshold": 0.25, "window": "1m", "open_duration": "5s", "half_open_probes": 1}`))
+	assert.Equal(t, CircuitBreakerConfig{
+		ErrorThreshold: 0.25,
+		Window:         time.Minute,
+		OpenDuration:   5 * time.Second,
+		HalfOpenProbes: 1,
+	}, dynFlag.Get())
+}
+
+func TestDynCircuitBreakerConfig_RejectsBadConfigs(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynCircuitBreakerConfig(set, "some_breaker_1", someBreakerConfig, "Use it or lose it")
+	for _, input := range []string{
+		`not json`,
+		`{"error_threshold": 0.5, "window": "10s", "open_duration": "30s", "half_open_probes": 3, "extra": 1}`,
+		`{"error_threshold": 0, "window": "10s", "open_duration": "30s", "half_open_probes": 3}`,
+		`{"error_threshold": 1.5, "window": "10s", "open_duration": "30s", "half_open_probes": 3}`,
+		`{"error_threshold": 0.5, "window": "10", "open_duration": "30s", "half_open_probes": 3}`,
+		`{"error_threshold": 0.5, "window": "-1s", "open_duration": "30s", "half_open_probes": 3}`,
+		`{"error_threshold": 0.5, "window": "10s", "half_open_probes": 3}`,
+		`{"error_threshold": 0.5, "window": "10s", "open_duration": "30s", "half_open_probes": 0}`,
+		`{"error_threshold": 0.5, "min_requests": -1, "window": "10s", "open_duration": "30s", "half_open_probes": 3}`,
+	} {
+		err := dynFlag.Set(input)
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr), "value %v must be rejected", input)
+	}
+	assert.Equal(t, someBreakerConfig, dynFlag.Get(), "rejected values must not be applied")
+}
+
+func TestDynCircuitBreakerConfig_ReconfiguresBreakers(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynCircuitBreakerConfig(set, "some_breaker_1", someBreakerConfig, "Use it or lose it")
+	dynFlag.WithValidator(func(config CircuitBreakerConfig) error {
+		if config.HalfOpenProbes > 10 {
+			return errors.New("too many probes")
+		}
+		return nil
+	})
+	breaker, other := &recordingBreaker{}, &recordingBreaker{}
+	dynFlag.AddBreaker(breaker)
+	remove := dynFlag.AddBreaker(other)
+	require.Equal(t, []CircuitBreakerConfig{someBreakerConfig}, breaker.configs, "breakers must start in sync")
+
+	changed := `{"error_threshold": 0.9, "window": "10s", "open_duration": "30s", "half_open_probes": 3}`
+	require.NoError(t, set.Set("some_breaker_1", changed))
+	require.Len(t, breaker.configs, 2)
+	assert.Equal(t, 0.9, breaker.configs[1].ErrorThreshold)
+	assert.Len(t, other.configs, 2)
+
+	remove()
+	assert.Error(t, set.Set("some_breaker_1",
+		`{"error_threshold": 0.9, "window": "10s", "open_duration": "30s", "half_open_probes": 11}`))
+	require.NoError(t, set.Set("some_breaker_1",
+		`{"error_threshold": 0.1, "window": "10s", "open_duration": "30s", "half_open_probes": 3}`))
+	assert.Len(t, breaker.configs, 3, "rejected values must not reconfigure breakers")
+	assert.Len(t, other.configs, 2, "removed breakers must not be reconfigured")
+}
+
+func TestDynCircuitBreakerConfig_ValidatesDefaults(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynCircuitBreakerConfig(set, "some_breaker_1", CircuitBreakerConfig{}, "Use it or lose it")
+	assert.Error(t, dynFlag.Validate(), "zero defaults must not validate")
+	require.NoError(t, dynFlag.Set(
+		`{"error_threshold": 0.5, "window": "10s", "open_duration": "30s", "half_open_probes": 3}`))
+	assert.NoError(t, dynFlag.Validate())
+}
@@ -0,0 +1,464 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// maxCORSMaxAge is the longest MaxAgeSeconds of a CORSConfig, as browsers cap the caching of preflights at a day.
+const maxCORSMaxAge = 24 * 60 * 60
+
+// CORSConfig is the document of a `DynCORSConfig` flag, e.g.
+//
+//	{
+//	  "allowed_origins": ["https://app.example.com", "https://*.example.org"],
+//	  "allowed_methods": ["GET", "POST", "DELETE"],
+//	  "allowed_headers": ["Authorization", "Content-Type"],
+//	  "max_age_seconds": 600
+//	}
+type CORSConfig struct {
+	// AllowedOrigins are exact origins (scheme, host and optional port, like `https://app.example.com:8443`), origins
+	// with a `*.` wildcard in front of the host matching all of its subdomains, or a single `*` allowing any origin.
+	// Cross-origin requests are denied if it is empty.
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
+	// AllowedMethods of cross-origin requests, defaulting to GET, HEAD and POST.
+	AllowedMethods []string `json:"allowed_methods,omitempty"`
+	// AllowedHeaders of cross-origin requests besides the CORS-safelisted ones, or a single `*` allowing any.
+	AllowedHeaders []string `json:"allowed_headers,omitempty"`
+	// ExposedHeaders are the response headers that scripts of allowed origins may read.
+	ExposedHeaders []string `json:"exposed_headers,omitempty"`
+	// AllowCredentials allows cookies and authorization in cross-origin requests. It can't be combined with wildcards
+	// of any origin or header.
+	AllowCredentials bool `json:"allow_credentials,omitempty"`
+	// MaxAgeSeconds is how long browsers may cache the results of preflight requests, up to a day.
+	MaxAgeSeconds int `json:"max_age_seconds,omitempty"`
+}
+
+// DynCORSConfig creates a `Flag` that represents the CORS policy of an HTTP server, which is safe to change
+// dynamically at runtime, e.g. to allow new origins without a deploy. Values are JSON CORSConfigs, which are strictly
+// validated and compiled by `Set`; serve them with `Handler`. A nil `value` denies all cross-origin requests.
+func DynCORSConfig(flagSet *flag.FlagSet, name string, value *CORSConfig, usage string) *DynCORSConfigValue {
+	return DynCORSConfigP(flagSet, name, "", value, usage)
+}
+
+// DynCORSConfigP is like DynCORSConfig, but accepts a shorthand letter that can be used after a single dash.
+func DynCORSConfigP(flagSet *flag.FlagSet, name string, shorthand string, value *CORSConfig,
+	usage string) *DynCORSConfigValue {
+	if value == nil {
+		value = &CORSConfig{}
+	}
+	compiled, err := compileCORSConfig(value)
+	if err != nil {
+		// an invalid default denies all cross-origin requests, and is reported by `Validate`.
+		compiled = &compiledCORSConfig{source: value}
+	}
+	dynValue := &DynCORSConfigValue{ptr: unsafe.Pointer(compiled), defaultErr: err}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynCORSConfigValue is a flag-related CORSConfig value wrapper.
+type DynCORSConfigValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer // *compiledCORSConfig
+	defaultErr      error          // of compiling the default, returned by `Validate` until the first `Set`.
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`.
+	validator       func(*CORSConfig) error
+	validatorCtx    func(context.Context, *CORSConfig) error
+	notifier        func(oldValue *CORSConfig, newValue *CORSConfig)
+	notifierCtx     func(ctx context.Context, oldValue *CORSConfig, newValue *CORSConfig)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the CORSConfig in a thread-safe manner. It must not be modified.
+func (d *DynCORSConfigValue) Get() *CORSConfig {
+	return d.load().source
+}
+
+// AllowsOrigin tells whether the current CORSConfig allows cross-origin requests from `origin`, the value of an
+// `Origin` header.
+func (d *DynCORSConfigValue) AllowsOrigin(origin string) bool {
+	return d.load().allowsOrigin(origin)
+}
+
+// Handler returns a middleware applying the CORSConfig current at the time of each request to `next`: it answers
+// preflight requests itself, denying disallowed ones with 403 Forbidden, and adds the CORS headers to the responses
+// of `next` to allowed cross-origin requests. Requests of disallowed origins are passed on without them, for browsers
+// to block their responses.
+func (d *DynCORSConfigValue) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		config := d.load()
+		header := resp.Header()
+		origin := req.Header.Get("Origin")
+		requestedMethod := req.Header.Get("Access-Control-Request-Method")
+		preflight := req.Method == http.MethodOptions && origin != "" && requestedMethod != ""
+		if !config.anyOrigin {
+			header.Add("Vary", "Origin")
+		}
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			requestedHeaders := req.Header.Get("Access-Control-Request-Headers")
+			if !config.allowsOrigin(origin) || !config.allowsMethod(requestedMethod) ||
+				!config.allowsHeaders(requestedHeaders) {
+				http.Error(resp, "flagz: CORS preflight request denied", http.StatusForbidden)
+				return
+			}
+			config.writeAllowOrigin(header, origin)
+			header.Set("Access-Control-Allow-Methods", requestedMethod)
+			if requestedHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", requestedHeaders)
+			}
+			if config.source.MaxAgeSeconds > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(config.source.MaxAgeSeconds))
+			}
+			resp.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if origin != "" && config.allowsOrigin(origin) {
+			config.writeAllowOrigin(header, origin)
+			if len(config.source.ExposedHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(config.source.ExposedHeaders, ", "))
+			}
+		}
+		next.ServeHTTP(resp, req)
+	})
+}
+
+// Set updates the value from a JSON CORSConfig in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, isn't a valid CORSConfig, or doesn't pass
+// an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynCORSConfigValue) Set(input string) error {
+	config := &CORSConfig{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(input)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return &ParseError{Err: err}
+	}
+	compiled, err := compileCORSConfig(config)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(config); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, config) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(compiled))
+	d.defaultErr = nil
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := (*compiledCORSConfig)(oldPtr).source
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, config) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, config) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set, in addition to the structural checks of the
+// CORSConfig. Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynCORSConfigValue) WithValidator(validator func(*CORSConfig) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynCORSConfigValue) WithValidatorCtx(validator func(ctx context.Context, value *CORSConfig) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the structural checks and the validator, e.g. to make sure that the
+// default passes them. See `ValidateAll`.
+func (d *DynCORSConfigValue) Validate() error {
+	d.setMu.Lock()
+	defaultErr := d.defaultErr
+	d.setMu.Unlock()
+	if defaultErr != nil {
+		return &ValidationError{Err: defaultErr}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynCORSConfigValue) WithNotifier(notifier func(oldValue *CORSConfig, newValue *CORSConfig)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynCORSConfigValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue *CORSConfig, newValue *CORSConfig), timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynCORSConfigValue) Type() string {
+	return "dyn_cors_config"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynCORSConfigValue) FormatHint() string {
+	return `JSON CORS config like {"allowed_origins": ["https://app.example.com"]}`
+}
+
+// JSONSchema returns the JSON Schema of the inputs, see `JSONSchemaProvider`.
+func (d *DynCORSConfigValue) JSONSchema() map[string]interface{} {
+	schema := GoTypeJSONSchema(reflect.TypeOf(CORSConfig{}))
+	schema["$schema"] = jsonSchemaDraft
+	return schema
+}
+
+// String returns the canonical JSON representation of the CORSConfig.
+func (d *DynCORSConfigValue) String() string {
+	out, err := json.Marshal(d.Get())
+	if err != nil {
+		return "ERR"
+	}
+	return string(out)
+}
+
+func (d *DynCORSConfigValue) load() *compiledCORSConfig {
+	return (*compiledCORSConfig)(atomic.LoadPointer(&d.ptr))
+}
+
+// compiledCORSConfig is a validated CORSConfig with its lists turned into sets.
+type compiledCORSConfig struct {
+	source      *CORSConfig
+	anyOrigin   bool
+	origins     map[string]struct{}
+	subdomains  []corsSubdomains
+	methods     map[string]struct{}
+	anyHeader   bool
+	headers     map[string]struct{} // lowercase.
+	credentials bool
+}
+
+// corsSubdomains matches the origins of the subdomains of `suffix`, e.g. ".example.org", with `scheme` and `port`.
+type corsSubdomains struct {
+	scheme string
+	suffix string
+	port   string
+}
+
+func compileCORSConfig(config *CORSConfig) (*compiledCORSConfig, error) {
+	compiled := &compiledCORSConfig{
+		source:      config,
+		origins:     make(map[string]struct{}),
+		methods:     make(map[string]struct{}),
+		headers:     make(map[string]struct{}),
+		credentials: config.AllowCredentials,
+	}
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			compiled.anyOrigin = true
+			continue
+		}
+		scheme, host, port, err := parseCORSOrigin(origin)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(host, "*.") {
+			compiled.subdomains = append(compiled.subdomains, corsSubdomains{scheme: scheme, suffix: host[1:], port: port})
+			continue
+		}
+		key := corsOriginKey(scheme, host, port)
+		if _, ok := compiled.origins[key]; ok {
+			return nil, fmt.Errorf("duplicate allowed origin %q", origin)
+		}
+		compiled.origins[key] = struct{}{}
+	}
+	if compiled.anyOrigin && len(config.AllowedOrigins) > 1 {
+		return nil, fmt.Errorf("allowed origin * can't be combined with other origins")
+	}
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	for _, method := range methods {
+		if !isHTTPToken(method) || strings.ToUpper(method) != method {
+			return nil, fmt.Errorf("allowed method %q must be an uppercase HTTP method", method)
+		}
+		if _, ok := compiled.methods[method]; ok {
+			return nil, fmt.Errorf("duplicate allowed method %q", method)
+		}
+		compiled.methods[method] = struct{}{}
+	}
+	for _, header := range config.AllowedHeaders {
+		if header == "*" {
+			compiled.anyHeader = true
+			continue
+		}
+		if !isHTTPToken(header) {
+			return nil, fmt.Errorf("allowed header %q is not a valid header name", header)
+		}
+		if _, ok := compiled.headers[strings.ToLower(header)]; ok {
+			return nil, fmt.Errorf("duplicate allowed header %q", header)
+		}
+		compiled.headers[strings.ToLower(header)] = struct{}{}
+	}
+	if compiled.anyHeader && len(config.AllowedHeaders) > 1 {
+		return nil, fmt.Errorf("allowed header * can't be combined with other headers")
+	}
+	for _, header := range config.ExposedHeaders {
+		if !isHTTPToken(header) {
+			return nil, fmt.Errorf("exposed header %q is not a valid header name", header)
+		}
+	}
+	if config.AllowCredentials && (compiled.anyOrigin || compiled.anyHeader) {
+		return nil, fmt.Errorf("credentials can't be allowed with wildcard origins or headers")
+	}
+	if config.MaxAgeSeconds < 0 || config.MaxAgeSeconds > maxCORSMaxAge {
+		return nil, fmt.Errorf("max age of %v seconds must be between 0 and %v", config.MaxAgeSeconds, maxCORSMaxAge)
+	}
+	return compiled, nil
+}
+
+// parseCORSOrigin splits an allowed origin into its lowercase scheme, host and port, which is empty if it is the
+// default of the scheme.
+func parseCORSOrigin(origin string) (scheme string, host string, port string, err error) {
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return "", "", "", fmt.Errorf("allowed origin %q must be like https://host[:port]", origin)
+	}
+	if parsed.Path != "" || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil {
+		return "", "", "", fmt.Errorf("allowed origin %q must not have a path, query, fragment or user", origin)
+	}
+	scheme = strings.ToLower(parsed.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", "", "", fmt.Errorf("allowed origin %q must be http or https", origin)
+	}
+	host, port = strings.ToLower(parsed.Hostname()), parsed.Port()
+	if strings.Contains(strings.TrimPrefix(host, "*."), "*") || host == "*." {
+		return "", "", "", fmt.Errorf("allowed origin %q may only have a wildcard in front of the host", origin)
+	}
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	return scheme, host, port, nil
+}
+
+func corsOriginKey(scheme string, host string, port string) string {
+	if port == "" {
+		return scheme + "://" + host
+	}
+	return scheme + "://" + host + ":" + port
+}
+
+func (c *compiledCORSConfig) allowsOrigin(origin string) bool {
+	if c.anyOrigin {
+		return origin != ""
+	}
+	if origin == "" || origin == "null" {
+		return false
+	}
+	scheme, host, port, err := parseCORSOrigin(origin)
+	if err != nil {
+		return false
+	}
+	if _, ok := c.origins[corsOriginKey(scheme, host, port)]; ok {
+		return true
+	}
+	for _, subdomains := range c.subdomains {
+		if subdomains.scheme == scheme && subdomains.port == port && strings.HasSuffix(host, subdomains.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiledCORSConfig) allowsMethod(method string) bool {
+	_, ok := c.methods[method]
+	return ok
+}
+
+// allowsHeaders tells whether all headers of an `Access-Control-Request-Headers` list are allowed.
+func (c *compiledCORSConfig) allowsHeaders(requested string) bool {
+	if c.anyHeader || requested == "" {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if _, ok := c.headers[header]; !ok && header != "" && !corsSafelistedHeaders[header] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *compiledCORSConfig) writeAllowOrigin(header http.Header, origin string) {
+	if c.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if c.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// corsSafelistedHeaders are the request headers that cross-origin requests may always carry.
+var corsSafelistedHeaders = map[string]bool{
+	"accept":           true,
+	"accept-language":  true,
+	"content-language": true,
+	"content-type":     true,
+}
+
+// isHTTPToken tells whether `s` is a valid HTTP token, e.g. a method or header name.
+func isHTTPToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
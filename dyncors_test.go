@@ -0,0 +1,158 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const someCORSConfig = `{
+  "allowed_origins": ["https://app.example.com", "https://*.example.org:8443"],
+  "allowed_methods": ["GET", "PUT"],
+  "allowed_headers": ["Authorization", "X-Request-Id"],
+  "exposed_headers": ["X-Trace-Id"],
+  "allow_credentials": true,
+  "max_age_seconds": 600
+}`
+
+func corsRequest(method string, origin string, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(method, "http://api.example.com/things", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+func TestDynCORSConfig_MatchesOrigins(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynCORSConfig(set, "some_cors_1", nil, "Use it or lose it")
+	assert.False(t, dynFlag.AllowsOrigin("https://app.example.com"), "nil defaults must deny all origins")
+	require.NoError(t, set.Set("some_cors_1", someCORSConfig))
+
+	assert.True(t, dynFlag.AllowsOrigin("https://app.example.com"))
+	assert.True(t, dynFlag.AllowsOrigin("https://APP.example.com:443"), "origins must be compared canonically")
+	assert.True(t, dynFlag.AllowsOrigin("https://eu.api.example.org:8443"), "subdomains must match wildcards")
+	assert.False(t, dynFlag.AllowsOrigin("https://example.org:8443"), "wildcards must only match subdomains")
+	assert.False(t, dynFlag.AllowsOrigin("https://eu.example.org"), "ports must match")
+	assert.False(t, dynFlag.AllowsOrigin("http://app.example.com"), "schemes must match")
+	assert.False(t, dynFlag.AllowsOrigin("https://app.example.com.evil.com"))
+	assert.False(t, dynFlag.AllowsOrigin("null"))
+	assert.Equal(t, 600, dynFlag.Get().MaxAgeSeconds)
+}
+
+func TestDynCORSConfig_HandlerAppliesLatestValue(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynCORSConfig(set, "some_cors_1", &CORSConfig{AllowedOrigins: []string{"https://old.example.com"}},
+		"Use it or lose it")
+	calls := 0
+	handler := dynFlag.Handler(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) { calls++ }))
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := serve(corsRequest(http.MethodGet, "https://old.example.com", nil))
+	assert.Equal(t, "https://old.example.com", resp.Header().Get("Access-Control-Allow-Origin"))
+	require.NoError(t, set.Set("some_cors_1", someCORSConfig))
+	resp = serve(corsRequest(http.MethodGet, "https://old.example.com", nil))
+	assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"), "the latest value must apply")
+	assert.Equal(t, 2, calls, "requests of disallowed origins must still be passed on")
+
+	resp = serve(corsRequest(http.MethodGet, "https://app.example.com", nil))
+	assert.Equal(t, "https://app.example.com", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", resp.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Trace-Id", resp.Header().Get("Access-Control-Expose-Headers"))
+	assert.Contains(t, resp.Header()["Vary"], "Origin")
+
+	preflight := map[string]string{
+		"Access-Control-Request-Method":  "PUT",
+		"Access-Control-Request-Headers": "authorization, content-type",
+	}
+	resp = serve(corsRequest(http.MethodOptions, "https://app.example.com", preflight))
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Equal(t, "PUT", resp.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "authorization, content-type", resp.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", resp.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, 3, calls, "preflights must not be passed on")
+
+	preflightCode := func(origin string) int {
+		return serve(corsRequest(http.MethodOptions, origin, preflight)).Code
+	}
+	preflight["Access-Control-Request-Method"] = "DELETE"
+	assert.Equal(t, http.StatusForbidden, preflightCode("https://app.example.com"), "methods must be allowed")
+	preflight["Access-Control-Request-Method"] = "GET"
+	preflight["Access-Control-Request-Headers"] = "x-other"
+	assert.Equal(t, http.StatusForbidden, preflightCode("https://app.example.com"), "headers must be allowed")
+	delete(preflight, "Access-Control-Request-Headers")
+	assert.Equal(t, http.StatusForbidden, preflightCode("https://other.example.com"), "origins must be allowed")
+}
+
+func TestDynCORSConfig_AllowsAnyOrigin(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynCORSConfig(set, "some_cors_1", &CORSConfig{AllowedOrigins: []string{"*"}}, "Use it or lose it")
+	resp := httptest.NewRecorder()
+	req := corsRequest(http.MethodGet, "https://any.example.com", nil)
+	dynFlag.Handler(http.NotFoundHandler()).ServeHTTP(resp, req)
+	assert.Equal(t, "*", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, resp.Header()["Vary"], "responses to any origin don't vary by origin")
+}
+
+func TestDynCORSConfig_RejectsInvalidConfigs(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynCORSConfig(set, "some_cors_1", nil, "Use it or lose it")
+	for _, input := range []string{
+		`not json`,
+		`{"allowed_originz": []}`,
+		`{"allowed_origins": ["app.example.com"]}`,
+		`{"allowed_origins": ["https://app.example.com/"]}`,
+		`{"allowed_origins": ["https://app.example.com/path"]}`,
+		`{"allowed_origins": ["ftp://app.example.com"]}`,
+		`{"allowed_origins": ["https://app.*.example.com"]}`,
+		`{"allowed_origins": ["https://app.example.com", "https://APP.example.com:443"]}`,
+		`{"allowed_origins": ["*", "https://app.example.com"]}`,
+		`{"allowed_origins": ["*"], "allow_credentials": true}`,
+		`{"allowed_methods": ["get"]}`,
+		`{"allowed_methods": ["GET", "GET"]}`,
+		`{"allowed_headers": ["X Bad"]}`,
+		`{"exposed_headers": ["X:Bad"]}`,
+		`{"max_age_seconds": -1}`,
+		`{"max_age_seconds": 86401}`,
+	} {
+		err := dynFlag.Set(input)
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr), "value %v must be rejected", input)
+	}
+	assert.Empty(t, dynFlag.Get().AllowedOrigins, "rejected values must not be applied")
+}
+
+func TestDynCORSConfig_ValidatesDefaults(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynCORSConfig(set, "some_cors_1", &CORSConfig{AllowedOrigins: []string{"app.example.com"}},
+		"Use it or lose it")
+	assert.Error(t, dynFlag.Validate(), "invalid defaults must not validate")
+	assert.False(t, dynFlag.AllowsOrigin("https://app.example.com"), "invalid defaults must deny all origins")
+	require.NoError(t, dynFlag.Set(`{"allowed_origins": ["https://app.example.com"]}`))
+	assert.NoError(t, dynFlag.Validate())
+	assert.Equal(t, `{"allowed_origins":["https://app.example.com"]}`, dynFlag.String())
+}
+
+func TestDynCORSConfig_Notifier(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynCORSConfig(set, "some_cors_1", nil, "Use it or lose it")
+	origins := make(chan []string, 1)
+	dynFlag.WithNotifier(func(oldValue *CORSConfig, newValue *CORSConfig) { origins <- newValue.AllowedOrigins })
+	require.NoError(t, set.Set("some_cors_1", `{"allowed_origins": ["https://app.example.com"]}`))
+	assert.Equal(t, []string{"https://app.example.com"}, <-origins)
+}
@@ -4,7 +4,9 @@
 package flagz
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -13,22 +15,34 @@ import (
 
 // DynDuration creates a `Flag` that represents `time.Duration` which is safe to change dynamically at runtime.
 func DynDuration(flagSet *flag.FlagSet, name string, value time.Duration, usage string) *DynDurationValue {
-	dynValue := &DynDurationValue{ptr: (*int64)(&value)}
-	flag := flagSet.VarPF(dynValue, name, "", usage)
+	return DynDurationP(flagSet, name, "", value, usage)
+}
+
+// DynDurationP is like DynDuration, but accepts a shorthand letter that can be used after a single dash.
+func DynDurationP(flagSet *flag.FlagSet, name string, shorthand string, value time.Duration,
+	usage string) *DynDurationValue {
+	dynValue := &DynDurationValue{val: int64(value)}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
 	MarkFlagDynamic(flag)
 	return dynValue
 }
 
 // DynDurationValue is a flag-related `time.Duration` value wrapper.
 type DynDurationValue struct {
-	ptr       *int64
-	validator func(time.Duration) error
-	notifier  func(oldValue time.Duration, newValue time.Duration)
+	dynChangeTime
+	val int64 // follows the int64 of dynChangeTime, so it is 64-bit aligned for atomics.
+
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func(time.Duration) error
+	validatorCtx    func(context.Context, time.Duration) error
+	notifier        func(oldValue time.Duration, newValue time.Duration)
+	notifierCtx     func(ctx context.Context, oldValue time.Duration, newValue time.Duration)
+	notifierTimeout time.Duration
 }
 
-// Get retrieves the value in a thread-safe manner.
+// Get retrieves the value in a thread-safe manner, with a single atomic load and no allocations.
 func (d *DynDurationValue) Get() time.Duration {
-	return (time.Duration)(atomic.LoadInt64(d.ptr))
+	return (time.Duration)(atomic.LoadInt64(&d.val))
 }
 
 // Set updates the value from a string representation in a thread-safe manner.
@@ -38,16 +52,32 @@ func (d *DynDurationValue) Get() time.Duration {
 func (d *DynDurationValue) Set(input string) error {
 	v, err := time.ParseDuration(input)
 	if err != nil {
-		return err
+		return &ParseError{Err: err}
 	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
 	if d.validator != nil {
 		if err := d.validator(v); err != nil {
-			return err
+			return &ValidationError{Err: err}
 		}
 	}
-	oldPtr := atomic.SwapInt64(d.ptr, (int64)(v))
-	if d.notifier != nil {
-		go d.notifier((time.Duration)(oldPtr), v)
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, v) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapInt64(&d.val, (int64)(v))
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := (time.Duration)(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, v) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, v) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
 	}
 	return nil
 }
@@ -59,17 +89,53 @@ func (d *DynDurationValue) WithValidator(validator func(time.Duration) error) {
 	d.validator = validator
 }
 
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynDurationValue) WithValidatorCtx(validator func(ctx context.Context, value time.Duration) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `ValidateAll`.
+func (d *DynDurationValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
 // WithNotifier adds a function is called every time a new value is successfully set.
-// Each notifier is executed in a new go-routine.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
 func (d *DynDurationValue) WithNotifier(notifier func(oldValue time.Duration, newValue time.Duration)) {
 	d.notifier = notifier
 }
 
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynDurationValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue time.Duration, newValue time.Duration), timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
 // Type is an indicator of what this flag represents.
 func (d *DynDurationValue) Type() string {
 	return "dyn_duration"
 }
 
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynDurationValue) FormatHint() string {
+	return "duration like 250ms or 1h30m"
+}
+
 // String represents the canonical representation of the type.
 func (d *DynDurationValue) String() string {
 	return fmt.Sprintf("%v", d.Get())
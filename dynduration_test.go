@@ -59,10 +59,28 @@ func TestDynDuration_FiresNotifier(t *testing.T) {
 	}
 }
 
+func TestDynDuration_GetDoesNotAllocate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynDuration(set, "some_duration_1", 5*time.Second, "Use it or lose it")
+	assert.EqualValues(t, 0, testing.AllocsPerRun(100, func() { value.Get() }))
+}
+
+func Benchmark_Duration_Dyn_GetParallel(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynDuration(set, "some_duration_1", 5*time.Second, "Use it or lose it")
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			value.Get()
+		}
+	})
+}
+
 func Benchmark_Duration_Dyn_Get(b *testing.B) {
 	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
 	value := DynDuration(set, "some_duration_1", 5*time.Second, "Use it or lose it")
 	set.Set("some_duration_1", "10s")
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		value.Get().Nanoseconds()
 	}
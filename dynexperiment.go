@@ -0,0 +1,275 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// ExperimentVariant is a named arm of an experiment, assigned to a share of keys proportional to its Weight.
+type ExperimentVariant struct {
+	Name   string
+	Weight float64
+}
+
+// DynExperiment creates a `Flag` that represents the weighted variants of an A/B experiment, which is safe to change
+// dynamically at runtime. Values are comma-separated `name:weight` pairs, e.g. `control:90,treatment:10`.
+//
+// Keys (e.g. users) are assigned to variants by weighted rendezvous hashing salted with the flag name, so assignments
+// are sticky: re-weighting variants only moves keys into the variants that gained weight, and adding a variant only
+// moves keys into it.
+func DynExperiment(flagSet *flag.FlagSet, name string, value []ExperimentVariant, usage string) *DynExperimentValue {
+	return DynExperimentP(flagSet, name, "", value, usage)
+}
+
+// DynExperimentP is like DynExperiment, but accepts a shorthand letter that can be used after a single dash.
+func DynExperimentP(flagSet *flag.FlagSet, name string, shorthand string, value []ExperimentVariant,
+	usage string) *DynExperimentValue {
+	dynValue := &DynExperimentValue{ptr: unsafe.Pointer(&value), salt: name, bucketBy: UserIDAttribute}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynExperimentValue is a flag-related experiment value wrapper.
+type DynExperimentValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer
+	salt            string
+	bucketBy        string
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func([]ExperimentVariant) error
+	validatorCtx    func(context.Context, []ExperimentVariant) error
+	notifier        func(oldValue []ExperimentVariant, newValue []ExperimentVariant)
+	notifierCtx     func(ctx context.Context, oldValue []ExperimentVariant, newValue []ExperimentVariant)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the variants in a thread-safe manner. They must not be modified.
+func (d *DynExperimentValue) Get() []ExperimentVariant {
+	p := (*[]ExperimentVariant)(atomic.LoadPointer(&d.ptr))
+	return *p
+}
+
+// Assign returns the name of the variant `key` is assigned to, or an empty string if no variant has a positive weight.
+func (d *DynExperimentValue) Assign(key string) string {
+	assigned, best := "", 0.0
+	for _, variant := range d.Get() {
+		if variant.Weight <= 0 {
+			continue
+		}
+		if score := rendezvousScore(d.salt, variant, key); assigned == "" || score > best {
+			assigned, best = variant.Name, score
+		}
+	}
+	return assigned
+}
+
+// VariantIn returns the variant assigned to the EvalContext, bucketed by its user ID (see `WithBucketBy`). Unknown
+// callers, without the attribute, get the first variant, which is conventionally the control.
+func (d *DynExperimentValue) VariantIn(ec *EvalContext) string {
+	key := ec.Attribute(d.bucketBy)
+	if key == "" {
+		if variants := d.Get(); len(variants) > 0 {
+			return variants[0].Name
+		}
+		return ""
+	}
+	return d.Assign(key)
+}
+
+// Set updates the value from a string representation in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, has duplicate variants or no variant with
+// a positive weight, or the resulting value doesn't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynExperimentValue) Set(input string) error {
+	val, err := parseExperimentVariants(input)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	if err := validExperimentVariants(val); err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*[]ExperimentVariant)(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithSalt replaces the flag name as the salt of the hash of keys. Changing it reshuffles the assignments of all keys,
+// e.g. to start a new experiment with the same variants. It must be called before the flag is used.
+func (d *DynExperimentValue) WithSalt(salt string) *DynExperimentValue {
+	d.salt = salt
+	return d
+}
+
+// WithBucketBy sets the attribute of EvalContexts that `VariantIn` buckets by, e.g. `TenantAttribute` to assign whole
+// tenants to variants. Defaults to `UserIDAttribute`. It must be called before the flag is used.
+func (d *DynExperimentValue) WithBucketBy(attribute string) *DynExperimentValue {
+	d.bucketBy = attribute
+	return d
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynExperimentValue) WithValidator(validator func([]ExperimentVariant) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynExperimentValue) WithValidatorCtx(validator func(ctx context.Context, value []ExperimentVariant) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the structural checks of `Set` and the validator, e.g. to make sure that
+// the default passes them. See `ValidateAll`.
+func (d *DynExperimentValue) Validate() error {
+	if err := validExperimentVariants(d.Get()); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynExperimentValue) WithNotifier(notifier func(oldValue []ExperimentVariant, newValue []ExperimentVariant)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynExperimentValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue []ExperimentVariant, newValue []ExperimentVariant),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynExperimentValue) Type() string {
+	return "dyn_experiment"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynExperimentValue) FormatHint() string {
+	return "weighted variants like control:90,treatment:10"
+}
+
+// String returns the canonical string representation of the type.
+func (d *DynExperimentValue) String() string {
+	variants := d.Get()
+	pairs := make([]string, 0, len(variants))
+	for _, variant := range variants {
+		pairs = append(pairs, fmt.Sprintf("%v:%v", variant.Name, variant.Weight))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func parseExperimentVariants(input string) ([]ExperimentVariant, error) {
+	var variants []ExperimentVariant
+	for _, pair := range strings.Split(input, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		idx := strings.LastIndex(pair, ":")
+		if idx < 0 {
+			return nil, fmt.Errorf("variant %q must be in name:weight form", pair)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(pair[idx+1:]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("variant %q: %v", pair, err)
+		}
+		variants = append(variants, ExperimentVariant{Name: strings.TrimSpace(pair[:idx]), Weight: weight})
+	}
+	return variants, nil
+}
+
+func validExperimentVariants(variants []ExperimentVariant) error {
+	seen := make(map[string]struct{}, len(variants))
+	total := 0.0
+	for _, variant := range variants {
+		if variant.Name == "" {
+			return fmt.Errorf("variants must be named")
+		}
+		if _, ok := seen[variant.Name]; ok {
+			return fmt.Errorf("duplicate variant %v", variant.Name)
+		}
+		seen[variant.Name] = struct{}{}
+		if math.IsNaN(variant.Weight) || math.IsInf(variant.Weight, 0) || variant.Weight < 0 {
+			return fmt.Errorf("variant %v has invalid weight %v", variant.Name, variant.Weight)
+		}
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return fmt.Errorf("at least one variant must have a positive weight")
+	}
+	return nil
+}
+
+// rendezvousScore is the weighted rendezvous hashing score of `variant` for `key`; keys are assigned to the variant
+// with the highest score, which is proportional to the weight.
+func rendezvousScore(salt string, variant ExperimentVariant, key string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(salt))
+	h.Write([]byte{0})
+	h.Write([]byte(variant.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	// the high bits of FNV barely depend on the last bytes, so they are mixed (as in splitmix64) before taking a
+	// uniform value in (0, 1) from the top 53 of them.
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	uniform := (float64(x>>11) + 0.5) / (1 << 53)
+	return variant.Weight / -math.Log(uniform)
+}
@@ -0,0 +1,92 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynExperiment_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynExperiment(set, "some_experiment_1", []ExperimentVariant{{"control", 1}}, "Use it or lose it")
+	assert.Equal(t, []ExperimentVariant{{"control", 1}}, dynFlag.Get(), "value must be default after create")
+	assert.NoError(t, set.Set("some_experiment_1", "control:90, treatment:10"), "setting value must succeed")
+	assert.Equal(t, []ExperimentVariant{{"control", 90}, {"treatment", 10}}, dynFlag.Get(), "value must be set after update")
+	assert.Equal(t, "control:90,treatment:10", dynFlag.String())
+	assert.True(t, IsFlagDynamic(set.Lookup("some_experiment_1")))
+}
+
+func TestDynExperiment_RejectsInvalidVariants(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynExperiment(set, "some_experiment_1", []ExperimentVariant{{"control", 1}}, "Use it or lose it")
+	for _, input := range []string{"", "control", "control:ten", "control:1,control:2", ":1", "control:-1", "control:0,treatment:0"} {
+		err := dynFlag.Set(input)
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr), "value %v must be rejected", input)
+	}
+	empty := DynExperiment(set, "some_experiment_2", nil, "Use it or lose it")
+	assert.Error(t, empty.Validate(), "defaults without variants must not validate")
+	assert.Equal(t, "", empty.Assign("user-1"))
+}
+
+func experimentAssignments(dynFlag *DynExperimentValue) map[string]string {
+	out := map[string]string{}
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		out[key] = dynFlag.Assign(key)
+	}
+	return out
+}
+
+func experimentCounts(assignments map[string]string) map[string]int {
+	out := map[string]int{}
+	for _, variant := range assignments {
+		out[variant]++
+	}
+	return out
+}
+
+func TestDynExperiment_AssignmentsAreWeightedAndSticky(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynExperiment(set, "some_experiment_1", nil, "Use it or lose it")
+	require.NoError(t, dynFlag.Set("control:50,treatment:50"))
+	before := experimentAssignments(dynFlag)
+	assert.InDelta(t, 5000, experimentCounts(before)["treatment"], 250, "variants must get shares proportional to weights")
+	assert.Equal(t, before, experimentAssignments(dynFlag), "keys must keep their assignments")
+
+	require.NoError(t, dynFlag.Set("control:25,treatment:75"))
+	reweighted := experimentAssignments(dynFlag)
+	assert.InDelta(t, 7500, experimentCounts(reweighted)["treatment"], 250)
+	for key, variant := range before {
+		if variant == "treatment" {
+			assert.Equal(t, "treatment", reweighted[key], "keys must only move into variants that gained weight")
+		}
+	}
+
+	require.NoError(t, dynFlag.Set("control:25,treatment:75,holdout:100"))
+	added := experimentAssignments(dynFlag)
+	assert.InDelta(t, 5000, experimentCounts(added)["holdout"], 250)
+	for key, variant := range added {
+		if variant != "holdout" {
+			assert.Equal(t, reweighted[key], variant, "keys must only move into added variants")
+		}
+	}
+}
+
+func TestDynExperiment_VariantIn(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynExperiment(set, "some_experiment_1", []ExperimentVariant{{"control", 0}, {"treatment", 1}}, "Use it or lose it")
+	assert.Equal(t, "treatment", dynFlag.VariantIn(&EvalContext{UserID: "user-1"}))
+	assert.Equal(t, "control", dynFlag.VariantIn(nil), "unknown callers must get the first variant")
+
+	dynFlag.WithBucketBy(TenantAttribute)
+	assert.Equal(t, "control", dynFlag.VariantIn(&EvalContext{UserID: "user-1"}))
+	assert.Equal(t, "treatment", dynFlag.VariantIn(&EvalContext{Tenant: "acme"}))
+}
@@ -0,0 +1,270 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynFeatureMatrix creates a `Flag` that represents many boolean feature gates by name, which is safe to change
+// dynamically at runtime, so that dozens of simple gates don't need dozens of flags (and keys in the backend). Values
+// are JSON objects like `{"new_checkout": true, "dark_mode": false}`, and features missing from them are disabled.
+func DynFeatureMatrix(flagSet *flag.FlagSet, name string, value map[string]bool,
+	usage string) *DynFeatureMatrixValue {
+	return DynFeatureMatrixP(flagSet, name, "", value, usage)
+}
+
+// DynFeatureMatrixP is like DynFeatureMatrix, but accepts a shorthand letter that can be used after a single dash.
+func DynFeatureMatrixP(flagSet *flag.FlagSet, name string, shorthand string, value map[string]bool,
+	usage string) *DynFeatureMatrixValue {
+	if value == nil {
+		value = map[string]bool{}
+	}
+	dynValue := &DynFeatureMatrixValue{ptr: unsafe.Pointer(&value)}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynFeatureMatrixValue is a flag-related `map[string]bool` value wrapper.
+type DynFeatureMatrixValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer // *map[string]bool
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`.
+	known           map[string]struct{}
+	validator       func(map[string]bool) error
+	validatorCtx    func(context.Context, map[string]bool) error
+	notifier        func(oldValue map[string]bool, newValue map[string]bool)
+	notifierCtx     func(ctx context.Context, oldValue map[string]bool, newValue map[string]bool)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the value in a thread-safe manner. It must not be modified.
+func (d *DynFeatureMatrixValue) Get() map[string]bool {
+	return *(*map[string]bool)(atomic.LoadPointer(&d.ptr))
+}
+
+// Enabled tells whether the feature `name` is enabled. Features missing from the value are disabled.
+func (d *DynFeatureMatrixValue) Enabled(name string) bool {
+	return d.Get()[name]
+}
+
+// Feature returns a FeatureFlag of the feature `name`, enabled for all EvalContexts if it is enabled in the current
+// value, e.g. to combine it with `AllOf` and evaluate it with `Enabled`.
+func (d *DynFeatureMatrixValue) Feature(name string) FeatureFlag {
+	return FeatureFlagFunc(func(*EvalContext) bool { return d.Enabled(name) })
+}
+
+// WithKnownFeatures restricts the names of the features to `names`, so that values with misspelled ones (which would
+// silently stay disabled) are rejected by `Set` and `Validate`.
+func (d *DynFeatureMatrixValue) WithKnownFeatures(names ...string) *DynFeatureMatrixValue {
+	d.known = make(map[string]struct{}, len(names))
+	for _, name := range names {
+		d.known[name] = struct{}{}
+	}
+	return d
+}
+
+// Set updates the value from a JSON object of feature names to booleans in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, has empty, duplicate or unknown (see
+// `WithKnownFeatures`) names, or doesn't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynFeatureMatrixValue) Set(input string) error {
+	val, err := parseFeatureMatrix(input)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if err := d.checkKnown(val); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*map[string]bool)(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynFeatureMatrixValue) WithValidator(validator func(map[string]bool) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynFeatureMatrixValue) WithValidatorCtx(validator func(ctx context.Context, value map[string]bool) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the known features and the validator, e.g. to make sure that the default
+// passes them. See `ValidateAll`.
+func (d *DynFeatureMatrixValue) Validate() error {
+	if err := d.checkKnown(d.Get()); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function that is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynFeatureMatrixValue) WithNotifier(notifier func(oldValue map[string]bool, newValue map[string]bool)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynFeatureMatrixValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue map[string]bool, newValue map[string]bool), timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynFeatureMatrixValue) Type() string {
+	return "dyn_feature_matrix"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynFeatureMatrixValue) FormatHint() string {
+	return `JSON object of features like {"new_checkout": true, "dark_mode": false}`
+}
+
+// JSONSchema returns the JSON Schema of the inputs, see `JSONSchemaProvider`.
+func (d *DynFeatureMatrixValue) JSONSchema() map[string]interface{} {
+	schema := map[string]interface{}{
+		"$schema":              jsonSchemaDraft,
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": "boolean"},
+	}
+	if d.known != nil {
+		names := make([]string, 0, len(d.known))
+		for name := range d.known {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		schema["propertyNames"] = map[string]interface{}{"enum": names}
+	}
+	return schema
+}
+
+// String returns the canonical JSON representation of the value, with the features sorted by name.
+func (d *DynFeatureMatrixValue) String() string {
+	out, err := json.Marshal(d.Get())
+	if err != nil {
+		return "ERR"
+	}
+	return string(out)
+}
+
+func (d *DynFeatureMatrixValue) checkKnown(value map[string]bool) error {
+	if d.known == nil {
+		return nil
+	}
+	for name := range value {
+		if _, ok := d.known[name]; !ok {
+			return fmt.Errorf("unknown feature %q", name)
+		}
+	}
+	return nil
+}
+
+func parseFeatureMatrix(input string) (map[string]bool, error) {
+	matrix := map[string]bool{}
+	err := decodeJSONObject(input, "feature", func(name string, decoder *json.Decoder) error {
+		var enabled *bool
+		if err := decoder.Decode(&enabled); err != nil {
+			return err
+		}
+		if enabled == nil {
+			return fmt.Errorf("must be true or false, not null")
+		}
+		matrix[name] = *enabled
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matrix, nil
+}
+
+// decodeJSONObject decodes the JSON object `input` token by token, calling `decodeMember` to decode the value of each
+// member, as decoding it into a map would silently keep the last of duplicate names. The `noun` of the names is used
+// in errors.
+func decodeJSONObject(input string, noun string, decodeMember func(name string, decoder *json.Decoder) error) error {
+	decoder := json.NewDecoder(strings.NewReader(input))
+	if token, err := decoder.Token(); err != nil {
+		return err
+	} else if token != json.Delim('{') {
+		return fmt.Errorf("value must be a JSON object, not %v", token)
+	}
+	seen := map[string]struct{}{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		name := token.(string) // object keys are always strings.
+		if name == "" {
+			return fmt.Errorf("%v names must not be empty", noun)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("duplicate %v %q", noun, name)
+		}
+		seen[name] = struct{}{}
+		if err := decodeMember(name, decoder); err != nil {
+			return fmt.Errorf("%v %q: %v", noun, name, err)
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after the JSON object")
+	}
+	return nil
+}
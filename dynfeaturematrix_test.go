@@ -0,0 +1,75 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynFeatureMatrix_SetAndEnabled(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynFeatureMatrix(set, "some_features_1", map[string]bool{"dark_mode": true}, "Use it or lose it")
+	assert.True(t, dynFlag.Enabled("dark_mode"))
+	assert.False(t, dynFlag.Enabled("new_checkout"), "missing features must be disabled")
+
+	require.NoError(t, set.Set("some_features_1", `{"new_checkout": true, "dark_mode": false}`))
+	assert.Equal(t, map[string]bool{"new_checkout": true, "dark_mode": false}, dynFlag.Get())
+	assert.True(t, dynFlag.Enabled("new_checkout"))
+	assert.False(t, dynFlag.Enabled("dark_mode"))
+	assert.Equal(t, `{"dark_mode":false,"new_checkout":true}`, dynFlag.String())
+}
+
+func TestDynFeatureMatrix_RejectsBadValues(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynFeatureMatrix(set, "some_features_1", map[string]bool{"dark_mode": true}, "Use it or lose it")
+	for _, input := range []string{
+		`not json`,
+		`["dark_mode"]`,
+		`{"dark_mode": "true"}`,
+		`{"dark_mode": 1}`,
+		`{"dark_mode": null}`,
+		`{"": true}`,
+		`{"dark_mode": true, "dark_mode": false}`,
+		`{"dark_mode": true`,
+		`{"dark_mode": true} {}`,
+	} {
+		err := dynFlag.Set(input)
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr), "value %v must be rejected", input)
+	}
+	assert.Equal(t, map[string]bool{"dark_mode": true}, dynFlag.Get(), "rejected values must not be applied")
+}
+
+func TestDynFeatureMatrix_WithKnownFeaturesRejectsTypos(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynFeatureMatrix(set, "some_features_1", map[string]bool{"dark_mod": true}, "Use it or lose it").
+		WithKnownFeatures("dark_mode", "new_checkout")
+	assert.Error(t, dynFlag.Validate(), "defaults with unknown features must not validate")
+
+	err := set.Set("some_features_1", `{"new_chekout": true}`)
+	var validationErr *ValidationError
+	assert.True(t, errors.As(err, &validationErr), "unknown features must be rejected")
+	require.NoError(t, set.Set("some_features_1", `{"new_checkout": true}`))
+	assert.NoError(t, dynFlag.Validate())
+	assert.Equal(t, map[string]interface{}{"enum": []string{"dark_mode", "new_checkout"}},
+		dynFlag.JSONSchema()["propertyNames"])
+}
+
+func TestDynFeatureMatrix_FeatureFollowsLatestValue(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynFeatureMatrix(set, "some_features_1", nil, "Use it or lose it")
+	feature := dynFlag.Feature("new_checkout")
+	ctx := WithEvalContext(context.Background(), &EvalContext{UserID: "someone"})
+	assert.False(t, Enabled(ctx, feature))
+
+	require.NoError(t, set.Set("some_features_1", `{"new_checkout": true}`))
+	assert.True(t, Enabled(ctx, feature))
+	assert.True(t, Enabled(context.Background(), feature), "the feature must be enabled for unknown callers too")
+}
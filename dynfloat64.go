@@ -4,33 +4,46 @@
 package flagz
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"strconv"
+	"sync"
 	"sync/atomic"
-	"unsafe"
+	"time"
 
 	flag "github.com/spf13/pflag"
 )
 
 // DynFloat64 creates a `Flag` that represents `float64` which is safe to change dynamically at runtime.
 func DynFloat64(flagSet *flag.FlagSet, name string, value float64, usage string) *DynFloat64Value {
-	dynValue := &DynFloat64Value{ptr: unsafe.Pointer(&value)}
-	flag := flagSet.VarPF(dynValue, name, "", usage)
+	return DynFloat64P(flagSet, name, "", value, usage)
+}
+
+// DynFloat64P is like DynFloat64, but accepts a shorthand letter that can be used after a single dash.
+func DynFloat64P(flagSet *flag.FlagSet, name string, shorthand string, value float64, usage string) *DynFloat64Value {
+	dynValue := &DynFloat64Value{bits: math.Float64bits(value)}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
 	MarkFlagDynamic(flag)
 	return dynValue
 }
 
 // DynFloat64Value is a flag-related `float64` value wrapper.
 type DynFloat64Value struct {
-	ptr       unsafe.Pointer
-	validator func(float64) error
-	notifier  func(oldValue float64, newValue float64)
+	dynChangeTime
+	bits uint64 // IEEE 754 bits of the value, following dynChangeTime so it is 64-bit aligned for atomics.
+
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func(float64) error
+	validatorCtx    func(context.Context, float64) error
+	notifier        func(oldValue float64, newValue float64)
+	notifierCtx     func(ctx context.Context, oldValue float64, newValue float64)
+	notifierTimeout time.Duration
 }
 
-// Get retrieves the value in a thread-safe manner.
+// Get retrieves the value in a thread-safe manner, with a single atomic load and no allocations.
 func (d *DynFloat64Value) Get() float64 {
-	p := (*float64)(atomic.LoadPointer(&d.ptr))
-	return *p
+	return math.Float64frombits(atomic.LoadUint64(&d.bits))
 }
 
 // Set updates the value from a string representation in a thread-safe manner.
@@ -40,16 +53,32 @@ func (d *DynFloat64Value) Get() float64 {
 func (d *DynFloat64Value) Set(input string) error {
 	val, err := strconv.ParseFloat(input, 64)
 	if err != nil {
-		return err
+		return &ParseError{Err: err}
 	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
 	if d.validator != nil {
 		if err := d.validator(val); err != nil {
-			return err
+			return &ValidationError{Err: err}
 		}
 	}
-	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
-	if d.notifier != nil {
-		go d.notifier(*(*float64)(oldPtr), val)
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldBits := atomic.SwapUint64(&d.bits, math.Float64bits(val))
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := math.Float64frombits(oldBits)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
 	}
 	return nil
 }
@@ -61,17 +90,53 @@ func (d *DynFloat64Value) WithValidator(validator func(float64) error) {
 	d.validator = validator
 }
 
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynFloat64Value) WithValidatorCtx(validator func(ctx context.Context, value float64) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `ValidateAll`.
+func (d *DynFloat64Value) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
 // WithNotifier adds a function is called every time a new value is successfully set.
-// Each notifier is executed in a new go-routine.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
 func (d *DynFloat64Value) WithNotifier(notifier func(oldValue float64, newValue float64)) {
 	d.notifier = notifier
 }
 
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynFloat64Value) WithNotifierCtx(notifier func(ctx context.Context, oldValue float64, newValue float64),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
 // Type is an indicator of what this flag represents.
 func (d *DynFloat64Value) Type() string {
 	return "dyn_float64"
 }
 
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynFloat64Value) FormatHint() string {
+	return "number like 0.25"
+}
+
 // String returns the canonical string representation of the type.
 func (d *DynFloat64Value) String() string {
 	return fmt.Sprintf("%v", d.Get())
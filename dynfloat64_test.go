@@ -54,10 +54,28 @@ func TestDynFloat64_FiresNotifier(t *testing.T) {
 	}
 }
 
+func TestDynFloat64_GetDoesNotAllocate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynFloat64(set, "some_float_1", 13.37, "Use it or lose it")
+	assert.EqualValues(t, 0, testing.AllocsPerRun(100, func() { value.Get() }))
+}
+
+func Benchmark_Float64_Dyn_GetParallel(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynFloat64(set, "some_float_1", 13.37, "Use it or lose it")
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			value.Get()
+		}
+	})
+}
+
 func Benchmark_Float64_Dyn_Get(b *testing.B) {
 	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
 	value := DynFloat64(set, "some_float_1", 13.37, "Use it or lose it")
 	set.Set("some_float_1", "14.00")
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		x := value.Get()
 		x = x + 1
@@ -4,31 +4,45 @@
 package flagz
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	flag "github.com/spf13/pflag"
 )
 
 // DynInt64 creates a `Flag` that represents `int64` which is safe to change dynamically at runtime.
 func DynInt64(flagSet *flag.FlagSet, name string, value int64, usage string) *DynInt64Value {
-	dynValue := &DynInt64Value{ptr: &value}
-	flag := flagSet.VarPF(dynValue, name, "", usage)
+	return DynInt64P(flagSet, name, "", value, usage)
+}
+
+// DynInt64P is like DynInt64, but accepts a shorthand letter that can be used after a single dash.
+func DynInt64P(flagSet *flag.FlagSet, name string, shorthand string, value int64, usage string) *DynInt64Value {
+	dynValue := &DynInt64Value{val: value}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
 	MarkFlagDynamic(flag)
 	return dynValue
 }
 
 // DynInt64Value is a flag-related `int64` value wrapper.
 type DynInt64Value struct {
-	ptr       *int64
-	validator func(int64) error
-	notifier  func(oldValue int64, newValue int64)
+	dynChangeTime
+	val int64 // follows the int64 of dynChangeTime, so it is 64-bit aligned for atomics.
+
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func(int64) error
+	validatorCtx    func(context.Context, int64) error
+	notifier        func(oldValue int64, newValue int64)
+	notifierCtx     func(ctx context.Context, oldValue int64, newValue int64)
+	notifierTimeout time.Duration
 }
 
-// Get retrieves the value in a thread-safe manner.
+// Get retrieves the value in a thread-safe manner, with a single atomic load and no allocations.
 func (d *DynInt64Value) Get() int64 {
-	return atomic.LoadInt64(d.ptr)
+	return atomic.LoadInt64(&d.val)
 }
 
 // Set updates the value from a string representation in a thread-safe manner.
@@ -38,16 +52,29 @@ func (d *DynInt64Value) Get() int64 {
 func (d *DynInt64Value) Set(input string) error {
 	val, err := strconv.ParseInt(input, 0, 64)
 	if err != nil {
-		return err
+		return &ParseError{Err: err}
 	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
 	if d.validator != nil {
 		if err := d.validator(val); err != nil {
-			return err
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
 		}
 	}
-	oldVal := atomic.SwapInt64(d.ptr, val)
+	oldVal := atomic.SwapInt64(&d.val, val)
+	d.markChanged()
 	if d.notifier != nil {
-		go d.notifier(oldVal, val)
+		RunNotifier(func() { d.notifier(oldVal, val) })
+	}
+	if d.notifierCtx != nil {
+		notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+		RunNotifierCtx(d, d.notifierTimeout, notify)
 	}
 	return nil
 }
@@ -59,17 +86,53 @@ func (d *DynInt64Value) WithValidator(validator func(int64) error) {
 	d.validator = validator
 }
 
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynInt64Value) WithValidatorCtx(validator func(ctx context.Context, value int64) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `ValidateAll`.
+func (d *DynInt64Value) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
 // WithNotifier adds a function is called every time a new value is successfully set.
-// Each notifier is executed in a new go-routine.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
 func (d *DynInt64Value) WithNotifier(notifier func(oldValue int64, newValue int64)) {
 	d.notifier = notifier
 }
 
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynInt64Value) WithNotifierCtx(notifier func(ctx context.Context, oldValue int64, newValue int64),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
 // Type is an indicator of what this flag represents.
 func (d *DynInt64Value) Type() string {
 	return "dyn_int64"
 }
 
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynInt64Value) FormatHint() string {
+	return "integer like 42"
+}
+
 // String returns the canonical string representation of the type.
 func (d *DynInt64Value) String() string {
 	return fmt.Sprintf("%v", d.Get())
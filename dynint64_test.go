@@ -4,6 +4,9 @@
 package flagz
 
 import (
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -26,6 +29,18 @@ func TestDynInt64_IsMarkedDynamic(t *testing.T) {
 	assert.True(t, IsFlagDynamic(set.Lookup("some_int_1")))
 }
 
+func TestDynInt64_TracksLastChanged(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 13371337, "Use it or lose it")
+	dynFlag.WithValidator(ValidateDynInt64Range(0, 2000))
+	assert.True(t, dynFlag.LastChanged().IsZero(), "value must not have a change time after create")
+	assert.Error(t, set.Set("some_int_1", "77007700"), "setting a rejected value must fail")
+	assert.True(t, dynFlag.LastChanged().IsZero(), "rejected values must not count as changes")
+	before := time.Now()
+	assert.NoError(t, set.Set("some_int_1", "1337"), "setting value must succeed")
+	assert.False(t, dynFlag.LastChanged().Before(before), "change time must be recorded on successful set")
+}
+
 func TestDynInt64_FiresValidators(t *testing.T) {
 	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
 	DynInt64(set, "some_int_1", 13371337, "Use it or lose it").WithValidator(ValidateDynInt64Range(0, 2000))
@@ -34,6 +49,30 @@ func TestDynInt64_FiresValidators(t *testing.T) {
 	assert.Error(t, set.Set("some_int_1", "2001"), "error from validator when value out of range")
 }
 
+func TestDynInt64_SerializesConcurrentSets(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 0, "Use it or lose it")
+	var inValidator, overlaps int32
+	dynFlag.WithValidator(func(int64) error {
+		if atomic.AddInt32(&inValidator, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(100 * time.Microsecond)
+		atomic.AddInt32(&inValidator, -1)
+		return nil
+	})
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, dynFlag.Set(strconv.Itoa(i)))
+		}(i)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 0, atomic.LoadInt32(&overlaps), "validators of concurrent sets must not interleave")
+}
+
 func TestDynInt64_FiresNotifier(t *testing.T) {
 	waitCh := make(chan bool, 1)
 	notifier := func(oldVal int64, newVal int64) {
@@ -52,10 +91,28 @@ func TestDynInt64_FiresNotifier(t *testing.T) {
 	}
 }
 
+func TestDynInt64_GetDoesNotAllocate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynInt64(set, "some_int_1", 13371337, "Use it or lose it")
+	assert.EqualValues(t, 0, testing.AllocsPerRun(100, func() { value.Get() }))
+}
+
+func Benchmark_Int64_Dyn_GetParallel(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynInt64(set, "some_int_1", 13371337, "Use it or lose it")
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			value.Get()
+		}
+	})
+}
+
 func Benchmark_Int64_Dyn_Get(b *testing.B) {
 	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
 	value := DynInt64(set, "some_int_1", 13371337, "Use it or lose it")
 	set.Set("some_int_1", "77007700")
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		x := value.Get()
 		x = x + 1
@@ -0,0 +1,265 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynInterpolatedString creates a `Flag` that represents a `string` composed of other values, which is safe to change
+// dynamically at runtime. Its values may contain `${name}` placeholders, replaced by the current value of flag `name`
+// of `flagSet`, or if there is no such flag, of environment variable `name`; `$$` stands for a single `$`. For
+// example, with a `--api_host` flag, a value of `https://${api_host}/v1` stays consistent when the host changes.
+//
+// The default `value` must be well-formed, and is checked by `Validate` once all flags are defined.
+func DynInterpolatedString(flagSet *flag.FlagSet, name string, value string, usage string) *DynInterpolatedStringValue {
+	return DynInterpolatedStringP(flagSet, name, "", value, usage)
+}
+
+// DynInterpolatedStringP is like DynInterpolatedString, but accepts a shorthand letter that can be used after a single
+// dash.
+func DynInterpolatedStringP(flagSet *flag.FlagSet, name string, shorthand string, value string,
+	usage string) *DynInterpolatedStringValue {
+	template, err := parseInterpolation(value)
+	if err != nil {
+		panic(fmt.Sprintf("DynInterpolatedString default of %v is malformed: %v", name, err))
+	}
+	dynValue := &DynInterpolatedStringValue{flagSet: flagSet, name: name, ptr: unsafe.Pointer(template)}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynInterpolatedStringValue is a flag-related interpolated `string` value wrapper.
+type DynInterpolatedStringValue struct {
+	dynChangeTime
+
+	flagSet         *flag.FlagSet
+	name            string
+	ptr             unsafe.Pointer // holds an *interpolationTemplate.
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`.
+	validator       func(string) error
+	validatorCtx    func(context.Context, string) error
+	notifier        func(oldValue string, newValue string)
+	notifierCtx     func(ctx context.Context, oldValue string, newValue string)
+	notifierTimeout time.Duration
+}
+
+// interpolationTemplate is a parsed value of a DynInterpolatedString.
+type interpolationTemplate struct {
+	raw      string
+	segments []interpolationSegment
+}
+
+// interpolationSegment is either a literal, or a placeholder referencing `ref`.
+type interpolationSegment struct {
+	literal string
+	ref     string
+}
+
+// Get retrieves the value with all placeholders resolved, in a thread-safe manner. Placeholders are resolved on every
+// call, so that the value reflects the current values of the flags and environment variables it references;
+// placeholders that no longer resolve (e.g. of unset environment variables) are replaced by an empty string.
+func (d *DynInterpolatedStringValue) Get() string {
+	template := d.template()
+	if len(template.segments) == 1 && template.segments[0].ref == "" {
+		return template.segments[0].literal
+	}
+	resolved, _ := d.resolve(template, []string{d.name})
+	return resolved
+}
+
+// Set updates the value from a string representation in a thread-safe manner.
+// This operation may return an error if the provided `input` is malformed, any of its placeholders doesn't resolve,
+// references a secret flag or creates a cycle of references, or the resolved value doesn't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynInterpolatedStringValue) Set(input string) error {
+	template, err := parseInterpolation(input)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	resolved, err := d.resolve(template, []string{d.name})
+	if err != nil {
+		return &ValidationError{Err: err}
+	}
+	if d.validator != nil {
+		if err := d.validator(resolved); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, resolved) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldVal := d.Get()
+	atomic.StorePointer(&d.ptr, unsafe.Pointer(template))
+	d.markChanged()
+	if d.notifier != nil {
+		RunNotifier(func() { d.notifier(oldVal, resolved) })
+	}
+	if d.notifierCtx != nil {
+		notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, resolved) }
+		RunNotifierCtx(d, d.notifierTimeout, notify)
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks resolved values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynInterpolatedStringValue) WithValidator(validator func(string) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynInterpolatedStringValue) WithValidatorCtx(validator func(ctx context.Context, value string) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks that the placeholders of the current value resolve, and the resolved value against the validator,
+// e.g. to make sure that the default passes them. See `ValidateAll`.
+func (d *DynInterpolatedStringValue) Validate() error {
+	resolved, err := d.resolve(d.template(), []string{d.name})
+	if err != nil {
+		return &ValidationError{Err: err}
+	}
+	if d.validator != nil {
+		if err := d.validator(resolved); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, resolved) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set, with the resolved values. It
+// isn't called when the values the placeholders reference change.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynInterpolatedStringValue) WithNotifier(notifier func(oldValue string, newValue string)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynInterpolatedStringValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue string, newValue string), timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynInterpolatedStringValue) Type() string {
+	return "dyn_interpolated_string"
+}
+
+// String represents the canonical representation of the type, the value with its placeholders unresolved, so that
+// dumps and other Updaters keep the references.
+func (d *DynInterpolatedStringValue) String() string {
+	return d.template().raw
+}
+
+// FormatHint describes the accepted inputs, see `FormatHinter`.
+func (d *DynInterpolatedStringValue) FormatHint() string {
+	return "string with ${flag_name} or ${ENV_VAR} placeholders"
+}
+
+func (d *DynInterpolatedStringValue) template() *interpolationTemplate {
+	return (*interpolationTemplate)(atomic.LoadPointer(&d.ptr))
+}
+
+// resolve replaces the placeholders of `template`, with `path` being the names of the flags being resolved, to detect
+// cycles. Placeholders that don't resolve are replaced by an empty string, and the first error is returned.
+func (d *DynInterpolatedStringValue) resolve(template *interpolationTemplate, path []string) (string, error) {
+	var firstErr error
+	out := &strings.Builder{}
+	for _, segment := range template.segments {
+		if segment.ref == "" {
+			out.WriteString(segment.literal)
+			continue
+		}
+		value, err := d.resolveRef(segment.ref, path)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		out.WriteString(value)
+	}
+	return out.String(), firstErr
+}
+
+func (d *DynInterpolatedStringValue) resolveRef(ref string, path []string) (string, error) {
+	f := d.flagSet.Lookup(ref)
+	if f == nil {
+		if value, ok := os.LookupEnv(ref); ok {
+			return value, nil
+		}
+		return "", fmt.Errorf("placeholder ${%v} is neither a flag nor a set environment variable", ref)
+	}
+	if IsFlagSecret(f) {
+		return "", fmt.Errorf("placeholder ${%v} references a secret flag", ref)
+	}
+	interpolated, ok := f.Value.(*DynInterpolatedStringValue)
+	if !ok {
+		return f.Value.String(), nil
+	}
+	for _, name := range path {
+		if name == ref {
+			return "", fmt.Errorf("cycle of references %v -> %v", strings.Join(path, " -> "), ref)
+		}
+	}
+	return interpolated.resolve(interpolated.template(), append(path, ref))
+}
+
+// parseInterpolation splits `raw` into literals and placeholders.
+func parseInterpolation(raw string) (*interpolationTemplate, error) {
+	template := &interpolationTemplate{raw: raw}
+	literal := &strings.Builder{}
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '$' || i+1 == len(raw) || (raw[i+1] != '$' && raw[i+1] != '{') {
+			literal.WriteByte(raw[i])
+			continue
+		}
+		if raw[i+1] == '$' {
+			literal.WriteByte('$')
+			i++
+			continue
+		}
+		end := strings.IndexByte(raw[i:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder at offset %d", i)
+		}
+		ref := raw[i+2 : i+end]
+		if ref == "" || strings.ContainsAny(ref, "${ \t\n") {
+			return nil, fmt.Errorf("bad placeholder ${%v} at offset %d", ref, i)
+		}
+		if literal.Len() > 0 {
+			template.segments = append(template.segments, interpolationSegment{literal: literal.String()})
+			literal.Reset()
+		}
+		template.segments = append(template.segments, interpolationSegment{ref: ref})
+		i += end
+	}
+	if literal.Len() > 0 || len(template.segments) == 0 {
+		template.segments = append(template.segments, interpolationSegment{literal: literal.String()})
+	}
+	return template, nil
+}
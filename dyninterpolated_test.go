@@ -0,0 +1,107 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynInterpolatedString_ResolvesFlagsAndEnvironment(t *testing.T) {
+	os.Setenv("FLAGZ_TEST_API_VERSION", "v1")
+	defer os.Unsetenv("FLAGZ_TEST_API_VERSION")
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynString(set, "api_host", "localhost", "API host")
+	set.Int("api_port", 8080, "API port")
+	dynFlag := DynInterpolatedString(set, "api_url", "https://${api_host}:${api_port}/${FLAGZ_TEST_API_VERSION}",
+		"API URL")
+	assert.Equal(t, "https://localhost:8080/v1", dynFlag.Get(), "placeholders of the default must be resolved")
+	assert.Equal(t, "https://${api_host}:${api_port}/${FLAGZ_TEST_API_VERSION}", dynFlag.String(),
+		"String must keep the placeholders")
+
+	require.NoError(t, set.Set("api_host", "example.com"))
+	assert.Equal(t, "https://example.com:8080/v1", dynFlag.Get(), "the value must follow its inputs")
+
+	require.NoError(t, set.Set("api_url", "$${api_host} costs $5 at ${api_host}"))
+	assert.Equal(t, "${api_host} costs $5 at example.com", dynFlag.Get(), "$$ must escape placeholders")
+}
+
+func TestDynInterpolatedString_RejectsBadValues(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynSecret(set, "some_secret", "hunter2", "Some secret")
+	dynFlag := DynInterpolatedString(set, "some_string", "something", "Use it or lose it")
+
+	var parseErr *ParseError
+	assert.True(t, errors.As(set.Set("some_string", "${unterminated"), &parseErr), "malformed values must fail to parse")
+	assert.True(t, errors.As(set.Set("some_string", "${}"), &parseErr), "empty placeholders must fail to parse")
+	var validationErr *ValidationError
+	assert.True(t, errors.As(set.Set("some_string", "${FLAGZ_TEST_NO_SUCH_VAR}"), &validationErr),
+		"unresolved placeholders must fail validation")
+	assert.True(t, errors.As(set.Set("some_string", "${some_secret}"), &validationErr),
+		"secrets must not be interpolated")
+	assert.Equal(t, "something", dynFlag.Get(), "rejected values must not be set")
+}
+
+func TestDynInterpolatedString_DetectsCycles(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynInterpolatedString(set, "a", "a", "A")
+	b := DynInterpolatedString(set, "b", "${a}-b", "B")
+	DynInterpolatedString(set, "c", "${b}-c", "C")
+	require.NoError(t, set.Set("a", "a2"))
+	assert.Equal(t, "a2-b", b.Get(), "values must resolve through other interpolated flags")
+
+	err := set.Set("a", "${c}")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "a -> c -> b -> a", "the cycle must be reported")
+	assert.Error(t, set.Set("a", "${a}"), "self references must be rejected")
+	assert.Equal(t, "a2-b", b.Get())
+}
+
+func TestDynInterpolatedString_ValidatesDefault(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInterpolatedString(set, "some_string", "${defined_later}", "Use it or lose it")
+	assert.Error(t, dynFlag.Validate(), "defaults referencing unknown flags must fail validation")
+	DynString(set, "defined_later", "foo", "Defined after")
+	assert.NoError(t, dynFlag.Validate())
+	assert.Panics(t, func() { DynInterpolatedString(set, "malformed", "${", "Malformed") })
+}
+
+func TestDynInterpolatedString_FiresValidatorsAndNotifier(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynString(set, "some_host", "localhost", "Some host")
+	dynFlag := DynInterpolatedString(set, "some_url", "http://${some_host}", "Some URL")
+	dynFlag.WithValidator(func(value string) error {
+		if !strings.HasPrefix(value, "https://") {
+			return fmt.Errorf("%v must be https", value)
+		}
+		return nil
+	})
+	waitCh := make(chan bool, 1)
+	dynFlag.WithNotifier(func(oldVal string, newVal string) {
+		assert.Equal(t, "http://localhost", oldVal, "old value in notify must be resolved")
+		assert.Equal(t, "https://localhost", newVal, "new value in notify must be resolved")
+		waitCh <- true
+	})
+	assert.Error(t, set.Set("some_url", "ftp://${some_host}"), "validators must check the resolved value")
+	require.NoError(t, set.Set("some_url", "https://${some_host}"))
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "failed to trigger notifier")
+	case <-waitCh:
+	}
+}
+
+func TestDynInterpolatedString_GetOfLiteralsDoesNotAllocate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynInterpolatedString(set, "some_string_1", "something", "Use it or lose it")
+	assert.EqualValues(t, 0, testing.AllocsPerRun(100, func() { value.Get() }))
+}
@@ -0,0 +1,290 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynIPAllowlist creates a `Flag` that represents an allowlist of IP addresses and CIDR ranges, which is safe to
+// change dynamically at runtime. Values are lists of entries like `10.0.0.0/8`, `192.168.1.7` or `2001:db8::/32`,
+// separated by commas or white space (so that large lists can have one entry per line), where `#` starts a comment
+// running to the end of the line.
+//
+// Entries are compiled into a binary trie by `Set`, so `Contains` takes at most one step per bit of the address,
+// regardless of the size of the allowlist.
+func DynIPAllowlist(flagSet *flag.FlagSet, name string, value []string, usage string) *DynIPAllowlistValue {
+	return DynIPAllowlistP(flagSet, name, "", value, usage)
+}
+
+// DynIPAllowlistP is like DynIPAllowlist, but accepts a shorthand letter that can be used after a single dash.
+func DynIPAllowlistP(flagSet *flag.FlagSet, name string, shorthand string, value []string,
+	usage string) *DynIPAllowlistValue {
+	compiled, err := compileIPAllowlist(value)
+	if err != nil {
+		// an invalid default allows no address, and is reported by `Validate`.
+		compiled, _ = compileIPAllowlist(nil)
+		compiled.entries = value
+	}
+	dynValue := &DynIPAllowlistValue{ptr: unsafe.Pointer(compiled), defaultErr: err}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynIPAllowlistValue is a flag-related IP allowlist value wrapper.
+type DynIPAllowlistValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer // *compiledIPAllowlist
+	defaultErr      error          // of compiling the default, returned by `Validate` until the first `Set`.
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`.
+	validator       func([]string) error
+	validatorCtx    func(context.Context, []string) error
+	notifier        func(oldValue []string, newValue []string)
+	notifierCtx     func(ctx context.Context, oldValue []string, newValue []string)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the entries of the allowlist in canonical form, e.g. `10.0.0.0/8` and `192.168.1.7` (or an invalid
+// default as given), in a thread-safe manner. They must not be modified.
+func (d *DynIPAllowlistValue) Get() []string {
+	return d.load().entries
+}
+
+// Contains tells whether `ip` is in any of the entries of the allowlist, in a thread-safe manner and without
+// allocations. IPv4-mapped IPv6 addresses match IPv4 entries.
+func (d *DynIPAllowlistValue) Contains(ip net.IP) bool {
+	return d.load().contains(ip)
+}
+
+// ContainsAddr is like `Contains` for an address in text form, either an IP or a `host:port` like the `RemoteAddr` of
+// an `http.Request`. Addresses that don't parse aren't contained.
+func (d *DynIPAllowlistValue) ContainsAddr(addr string) bool {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	return ip != nil && d.load().contains(ip)
+}
+
+// Set updates the value from a string representation in a thread-safe manner.
+// This operation may return an error if any entry of the provided `input` doesn't parse or is a CIDR range with bits
+// set after its prefix (e.g. `10.0.0.1/8`, usually a typo), or the entries don't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynIPAllowlistValue) Set(input string) error {
+	compiled, err := compileIPAllowlist(splitIPAllowlist(input))
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	val := compiled.entries
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(compiled))
+	d.defaultErr = nil
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := (*compiledIPAllowlist)(oldPtr).entries
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks the canonical entries of values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynIPAllowlistValue) WithValidator(validator func([]string) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynIPAllowlistValue) WithValidatorCtx(validator func(ctx context.Context, value []string) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks that the current value parses and passes the validator, e.g. to make sure that the default does.
+// See `ValidateAll`.
+func (d *DynIPAllowlistValue) Validate() error {
+	d.setMu.Lock()
+	defaultErr := d.defaultErr
+	d.setMu.Unlock()
+	if defaultErr != nil {
+		return &ValidationError{Err: defaultErr}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function that is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynIPAllowlistValue) WithNotifier(notifier func(oldValue []string, newValue []string)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynIPAllowlistValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue []string, newValue []string),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynIPAllowlistValue) Type() string {
+	return "dyn_ip_allowlist"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynIPAllowlistValue) FormatHint() string {
+	return "IPs and CIDRs separated by commas or lines, like 10.0.0.0/8,192.168.1.7"
+}
+
+// String returns the canonical string representation of the type, the canonical entries separated by commas.
+func (d *DynIPAllowlistValue) String() string {
+	return strings.Join(d.Get(), ",")
+}
+
+func (d *DynIPAllowlistValue) load() *compiledIPAllowlist {
+	return (*compiledIPAllowlist)(atomic.LoadPointer(&d.ptr))
+}
+
+// compiledIPAllowlist holds the entries of an allowlist in binary tries of IPv4 and IPv6 prefixes.
+type compiledIPAllowlist struct {
+	entries []string
+	v4      *ipTrieNode
+	v6      *ipTrieNode
+}
+
+// ipTrieNode is a node of a binary trie of prefixes, with the children continuing them with a 0 and 1 bit. Terminal
+// nodes end an entry, so their subtrees are never needed and not kept.
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	terminal bool
+}
+
+// splitIPAllowlist splits `input` into its entries, dropping comments.
+func splitIPAllowlist(input string) []string {
+	entries := []string{}
+	for _, line := range strings.Split(input, "\n") {
+		if comment := strings.IndexByte(line, '#'); comment >= 0 {
+			line = line[:comment]
+		}
+		entries = append(entries, strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		})...)
+	}
+	return entries
+}
+
+func compileIPAllowlist(entries []string) (*compiledIPAllowlist, error) {
+	compiled := &compiledIPAllowlist{entries: make([]string, 0, len(entries)), v4: &ipTrieNode{}, v6: &ipTrieNode{}}
+	for _, entry := range entries {
+		ip, bits, canonical, err := parseIPAllowlistEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		compiled.entries = append(compiled.entries, canonical)
+		root := compiled.v6
+		if len(ip) == net.IPv4len {
+			root = compiled.v4
+		}
+		root.insert(ip, bits)
+	}
+	return compiled, nil
+}
+
+// parseIPAllowlistEntry parses an IP or CIDR into its address (of 4 bytes for IPv4), prefix length and canonical form.
+func parseIPAllowlistEntry(entry string) (net.IP, int, string, error) {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, 0, "", fmt.Errorf("entry %q is neither an IP nor a CIDR", entry)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			return v4, 8 * net.IPv4len, v4.String(), nil
+		}
+		return ip, 8 * net.IPv6len, ip.String(), nil
+	}
+	ip, network, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("entry %q is neither an IP nor a CIDR", entry)
+	}
+	if !ip.Equal(network.IP) {
+		return nil, 0, "", fmt.Errorf("entry %q has bits set after its prefix, did you mean %v?", entry, network)
+	}
+	bits, _ := network.Mask.Size()
+	return network.IP, bits, network.String(), nil
+}
+
+// insert adds the prefix of the first `bits` bits of `ip`.
+func (n *ipTrieNode) insert(ip net.IP, bits int) {
+	for i := 0; i < bits; i++ {
+		if n.terminal {
+			return
+		}
+		bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+		if n.children[bit] == nil {
+			n.children[bit] = &ipTrieNode{}
+		}
+		n = n.children[bit]
+	}
+	n.terminal = true
+	n.children = [2]*ipTrieNode{}
+}
+
+func (c *compiledIPAllowlist) contains(ip net.IP) bool {
+	n := c.v6
+	if v4 := ip.To4(); v4 != nil {
+		ip, n = v4, c.v4
+	} else if len(ip) != net.IPv6len {
+		return false
+	}
+	for i := 0; i < 8*len(ip); i++ {
+		if n.terminal {
+			return true
+		}
+		n = n.children[(ip[i/8]>>(7-uint(i%8)))&1]
+		if n == nil {
+			return false
+		}
+	}
+	return n.terminal
+}
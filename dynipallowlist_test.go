@@ -0,0 +1,112 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynIPAllowlist_ContainsEntries(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynIPAllowlist(set, "some_allowlist_1", []string{"127.0.0.1"}, "Use it or lose it")
+	assert.True(t, dynFlag.ContainsAddr("127.0.0.1"))
+	assert.False(t, dynFlag.ContainsAddr("127.0.0.2"))
+
+	require.NoError(t, set.Set("some_allowlist_1", `
+# offices
+10.0.0.0/8, 192.168.1.7
+172.16.0.0/12 # vpn
+2001:db8::/32`))
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.7", "172.16.0.0/12", "2001:db8::/32"}, dynFlag.Get())
+	assert.Equal(t, "10.0.0.0/8,192.168.1.7,172.16.0.0/12,2001:db8::/32", dynFlag.String())
+
+	assert.True(t, dynFlag.Contains(net.ParseIP("10.255.0.1")))
+	assert.True(t, dynFlag.Contains(net.ParseIP("::ffff:10.1.2.3")), "IPv4-mapped addresses must match IPv4 entries")
+	assert.True(t, dynFlag.ContainsAddr("192.168.1.7:4321"), "host:port addresses must match")
+	assert.True(t, dynFlag.ContainsAddr("172.31.255.255"))
+	assert.True(t, dynFlag.ContainsAddr("[2001:db8:1::1]:443"))
+	assert.False(t, dynFlag.ContainsAddr("192.168.1.8"))
+	assert.False(t, dynFlag.ContainsAddr("172.32.0.0"))
+	assert.False(t, dynFlag.ContainsAddr("11.0.0.1"))
+	assert.False(t, dynFlag.ContainsAddr("2001:db9::1"))
+	assert.False(t, dynFlag.ContainsAddr("127.0.0.1"), "the old value must no longer apply")
+	assert.False(t, dynFlag.ContainsAddr("not-an-ip"))
+	assert.False(t, dynFlag.Contains(nil))
+}
+
+func TestDynIPAllowlist_HandlesOverlappingAndCatchAllEntries(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynIPAllowlist(set, "some_allowlist_1", nil, "Use it or lose it")
+	assert.False(t, dynFlag.ContainsAddr("10.0.0.1"), "empty allowlists must contain nothing")
+
+	require.NoError(t, dynFlag.Set("10.1.2.0/24,10.0.0.0/8,10.1.0.0/16"))
+	assert.True(t, dynFlag.ContainsAddr("10.200.0.1"), "broader entries must win regardless of order")
+	require.NoError(t, dynFlag.Set("0.0.0.0/0"))
+	assert.True(t, dynFlag.ContainsAddr("8.8.8.8"))
+	assert.False(t, dynFlag.ContainsAddr("::1"), "IPv4 catch-alls must not match IPv6 addresses")
+}
+
+func TestDynIPAllowlist_RejectsBadEntries(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynIPAllowlist(set, "some_allowlist_1", []string{"10.0.0.0/8"}, "Use it or lose it")
+	for _, input := range []string{"10.0.0.256", "10.0.0.0/33", "example.com", "10.0.0.1/8", "10.0.0.0/8,foo"} {
+		err := dynFlag.Set(input)
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr), "value %v must be rejected", input)
+	}
+	assert.Contains(t, dynFlag.Set("10.0.0.1/8").Error(), "did you mean 10.0.0.0/8?")
+	assert.Equal(t, []string{"10.0.0.0/8"}, dynFlag.Get(), "rejected values must not be applied")
+}
+
+func TestDynIPAllowlist_ValidatesDefaults(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynIPAllowlist(set, "some_allowlist_1", []string{"10.0.0.0/8", "bad"}, "Use it or lose it")
+	assert.Error(t, dynFlag.Validate(), "invalid defaults must not validate")
+	assert.False(t, dynFlag.ContainsAddr("10.0.0.1"), "invalid defaults must contain nothing")
+	require.NoError(t, dynFlag.Set("10.0.0.0/8"))
+	assert.NoError(t, dynFlag.Validate())
+}
+
+func TestDynIPAllowlist_ValidatorAndNotifier(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynIPAllowlist(set, "some_allowlist_1", nil, "Use it or lose it")
+	dynFlag.WithValidator(func(entries []string) error {
+		for _, entry := range entries {
+			if entry == "0.0.0.0/0" {
+				return fmt.Errorf("catch-all entries aren't allowed")
+			}
+		}
+		return nil
+	})
+	notified := make(chan []string, 1)
+	dynFlag.WithNotifier(func(oldValue []string, newValue []string) { notified <- newValue })
+	var validationErr *ValidationError
+	assert.True(t, errors.As(dynFlag.Set("0.0.0.0/0"), &validationErr))
+	require.NoError(t, dynFlag.Set("10.0.0.0/8"))
+	assert.Equal(t, []string{"10.0.0.0/8"}, <-notified)
+}
+
+func BenchmarkDynIPAllowlist_Contains(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynIPAllowlist(set, "some_allowlist_1", nil, "Use it or lose it")
+	entries := []string{}
+	for i := 0; i < 5000; i++ {
+		entries = append(entries, fmt.Sprintf("10.%d.%d.0/24", i/256, i%256))
+	}
+	require.NoError(b, dynFlag.Set(strings.Join(entries, "\n")))
+	ip := net.ParseIP("10.19.135.7").To4()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dynFlag.Contains(ip)
+	}
+}
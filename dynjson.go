@@ -4,9 +4,13 @@
 package flagz
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"reflect"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	flag "github.com/spf13/pflag"
@@ -16,27 +20,42 @@ import (
 // The `value` must be a pointer to a struct that is JSON (un)marshallable.
 // New values based on the default constructor of `value` type will be created on each update.
 func DynJSON(flagSet *flag.FlagSet, name string, value interface{}, usage string) *DynJSONValue {
+	return DynJSONP(flagSet, name, "", value, usage)
+}
+
+// DynJSONP is like DynJSON, but accepts a shorthand letter that can be used after a single dash.
+func DynJSONP(flagSet *flag.FlagSet, name string, shorthand string, value interface{}, usage string) *DynJSONValue {
 	reflectVal := reflect.ValueOf(value)
 	if reflectVal.Kind() != reflect.Ptr || reflectVal.Elem().Kind() != reflect.Struct {
 		panic("DynJSON value must be a pointer to a struct")
 	}
-	dynValue := &DynJSONValue{ptr: unsafe.Pointer(reflectVal.Pointer()), structType: reflectVal.Type().Elem()}
-	flag := flagSet.VarPF(dynValue, name, "", usage)
+	dynValue := &DynJSONValue{ptr: unsafe.Pointer(&storedJSON{value: value}), structType: reflectVal.Type().Elem()}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
 	MarkFlagDynamic(flag)
 	return dynValue
 }
 
 // DynJSONValue is a flag-related JSON struct value wrapper.
 type DynJSONValue struct {
-	structType reflect.Type
-	ptr        unsafe.Pointer
-	validator  func(interface{}) error
-	notifier   func(oldValue interface{}, newValue interface{})
+	dynChangeTime
+
+	structType      reflect.Type
+	ptr             unsafe.Pointer // *storedJSON
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`.
+	validator       func(interface{}) error
+	validatorCtx    func(context.Context, interface{}) error
+	notifier        func(oldValue interface{}, newValue interface{})
+	notifierCtx     func(ctx context.Context, oldValue interface{}, newValue interface{})
+	notifierTimeout time.Duration
+	maxSize         int
+
+	stringCache StringCache
+	prettyCache StringCache
 }
 
 // Get retrieves the value in its original JSON struct type in a thread-safe manner.
 func (d *DynJSONValue) Get() interface{} {
-	return d.unsafeToStoredType(atomic.LoadPointer(&d.ptr))
+	return (*storedJSON)(atomic.LoadPointer(&d.ptr)).value
 }
 
 // Set updates the value from a string representation in a thread-safe manner.
@@ -44,18 +63,37 @@ func (d *DynJSONValue) Get() interface{} {
 // optional validator.
 // If a notifier is set on the value, it will be invoked in a separate go-routine.
 func (d *DynJSONValue) Set(input string) error {
+	if d.maxSize > 0 && len(input) > d.maxSize {
+		return &ParseError{Err: fmt.Errorf("value of %d bytes exceeds the maximum of %d bytes", len(input), d.maxSize)}
+	}
 	someStruct := reflect.New(d.structType).Interface()
 	if err := json.Unmarshal([]byte(input), someStruct); err != nil {
-		return err
+		return &ParseError{Err: err}
 	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
 	if d.validator != nil {
 		if err := d.validator(someStruct); err != nil {
-			return err
+			return &ValidationError{Err: err}
 		}
 	}
-	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(reflect.ValueOf(someStruct).Pointer()))
-	if d.notifier != nil {
-		go d.notifier(d.unsafeToStoredType(oldPtr), someStruct)
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, someStruct) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&storedJSON{value: someStruct}))
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := (*storedJSON)(oldPtr).value
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, someStruct) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, someStruct) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
 	}
 	return nil
 }
@@ -67,37 +105,87 @@ func (d *DynJSONValue) WithValidator(validator func(interface{}) error) {
 	d.validator = validator
 }
 
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynJSONValue) WithValidatorCtx(validator func(ctx context.Context, value interface{}) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `ValidateAll`.
+func (d *DynJSONValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
 // WithNotifier adds a function is called every time a new value is successfully set.
-// Each notifier is executed in a new go-routine.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
 func (d *DynJSONValue) WithNotifier(notifier func(oldValue interface{}, newValue interface{})) {
 	d.notifier = notifier
 }
 
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynJSONValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue interface{}, newValue interface{}),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// WithMaxSize rejects inputs longer than `bytes` before they're parsed, protecting memory and parsing time from
+// accidentally huge values.
+func (d *DynJSONValue) WithMaxSize(bytes int) {
+	d.maxSize = bytes
+}
+
 // Type is an indicator of what this flag represents.
 func (d *DynJSONValue) Type() string {
 	return "dyn_json"
 }
 
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynJSONValue) FormatHint() string {
+	return "JSON object"
+}
+
 // PrettyString returns a nicely structured representation of the type.
 // In this case it returns a pretty-printed JSON.
+// The output is cached until the value changes.
 func (d *DynJSONValue) PrettyString() string {
-	out, err := json.MarshalIndent(d.Get(), "", "  ")
-	if err != nil {
-		return "ERR"
-	}
-	return string(out)
+	p := atomic.LoadPointer(&d.ptr)
+	return d.prettyCache.Get(p, func() string {
+		out, err := json.MarshalIndent((*storedJSON)(p).value, "", "  ")
+		if err != nil {
+			return "ERR"
+		}
+		return string(out)
+	})
 }
 
 // String returns the canonical string representation of the type.
+// The output is cached until the value changes.
 func (d *DynJSONValue) String() string {
-	out, err := json.Marshal(d.Get())
-	if err != nil {
-		return "ERR"
-	}
-	return string(out)
+	p := atomic.LoadPointer(&d.ptr)
+	return d.stringCache.Get(p, func() string {
+		out, err := json.Marshal((*storedJSON)(p).value)
+		if err != nil {
+			return "ERR"
+		}
+		return string(out)
+	})
 }
 
-func (d *DynJSONValue) unsafeToStoredType(p unsafe.Pointer) interface{} {
-	n := reflect.NewAt(d.structType, p)
-	return n.Interface()
+// storedJSON boxes the stored value, so that reads are an atomic pointer load without any reflection.
+type storedJSON struct {
+	value interface{}
 }
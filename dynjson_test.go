@@ -5,6 +5,7 @@ package flagz
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -42,6 +43,15 @@ func TestDynJSON_IsMarkedDynamic(t *testing.T) {
 	assert.True(t, IsFlagDynamic(set.Lookup("some_json_1")))
 }
 
+func TestDynJSON_RejectsOversizedInput(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynJSON(set, "some_json_1", defaultJSON, "Use it or lose it")
+	dynFlag.WithMaxSize(32)
+	assert.NoError(t, set.Set("some_json_1", `{"string": "short"}`), "small values must be accepted")
+	assert.Error(t, set.Set("some_json_1", `{"string": "`+strings.Repeat("x", 32)+`"}`), "oversized values must be rejected")
+	assert.Equal(t, "short", dynFlag.Get().(*outerJSON).FieldString, "value must not change after bad update")
+}
+
 func TestDynJSON_FiresValidators(t *testing.T) {
 	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
 
@@ -89,3 +99,42 @@ type outerJSON struct {
 type innerJSON struct {
 	FieldBool bool `json:"bool"`
 }
+
+type countingJSON struct {
+	Value string `json:"value"`
+}
+
+var countingJSONMarshals int
+
+func (c *countingJSON) MarshalJSON() ([]byte, error) {
+	countingJSONMarshals++
+	return []byte(fmt.Sprintf(`{"value": %q}`, c.Value)), nil
+}
+
+func TestDynJSON_CachesStringUntilChanged(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	countingJSONMarshals = 0
+	dynFlag := DynJSON(set, "some_json_1", &countingJSON{Value: "foo"}, "Use it or lose it")
+	assert.Equal(t, `{"value":"foo"}`, dynFlag.String())
+	assert.Equal(t, `{"value":"foo"}`, dynFlag.String())
+	assert.Equal(t, 1, countingJSONMarshals, "unchanged value must be marshalled once")
+
+	assert.NoError(t, dynFlag.Set(`{"value": "bar"}`))
+	assert.Equal(t, `{"value":"bar"}`, dynFlag.String(), "changed value must be marshalled again")
+	assert.Equal(t, 2, countingJSONMarshals)
+}
+
+func TestDynJSON_GetDoesNotAllocate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynJSON(set, "some_json_1", defaultJSON, "Use it or lose it")
+	assert.EqualValues(t, 0, testing.AllocsPerRun(100, func() { value.Get() }))
+}
+
+func Benchmark_JSON_Dyn_Get(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynJSON(set, "some_json_1", defaultJSON, "Use it or lose it")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = value.Get().(*outerJSON).FieldString
+	}
+}
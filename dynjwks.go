@@ -0,0 +1,436 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// minJWKRSABits is the smallest size of the RSA keys of a `DynJWKS`.
+const minJWKRSABits = 2048
+
+// ErrJWKNotFound is returned by `DynJWKSValue.Keyfunc` for tokens signed with keys that aren't in the key set, e.g.
+// new keys of the identity provider that haven't been propagated yet.
+var ErrJWKNotFound = errors.New("signing key not in the key set")
+
+// JSONWebKey is a public key of the JSON Web Key Set of a `DynJWKS` flag.
+type JSONWebKey struct {
+	// KeyID is the `kid` of the key, matched against the `kid` header of tokens.
+	KeyID string
+	// KeyType is the `kty` of the key: "RSA", "EC" or "OKP".
+	KeyType string
+	// Algorithm is the `alg` of the key, e.g. "RS256", or empty if any algorithm of its type is allowed.
+	Algorithm string
+	// Use is the `use` of the key, "sig" or "enc", or empty if it isn't restricted.
+	Use string
+	// Key is an `*rsa.PublicKey`, an `*ecdsa.PublicKey` or an `ed25519.PublicKey`.
+	Key crypto.PublicKey
+}
+
+// jwkJSON is the JSON form of a JSONWebKey (RFC 7517 and 7518), with the members of private keys so that they are
+// rejected.
+type jwkJSON struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	D         string `json:"d"`
+	P         string `json:"p"`
+	Q         string `json:"q"`
+	K         string `json:"k"`
+}
+
+// jwks is the value of a DynJWKSValue.
+type jwks struct {
+	keys []JSONWebKey
+	byID map[string]*JSONWebKey
+	text string // the compacted input.
+}
+
+// DynJWKS creates a `Flag` that represents a JSON Web Key Set (RFC 7517) of public keys verifying JWTs, which is safe
+// to change dynamically at runtime, so that key rotations of the identity provider propagate through flags instead of
+// ad-hoc fetchers. Values are key sets like `{"keys": [{"kty": "RSA", "kid": "2024-01", "n": "…", "e": "AQAB"}]}`,
+// validated on `Set`; verify tokens with `Keyfunc`. An empty `value` is an empty key set, which rejects all tokens.
+func DynJWKS(flagSet *flag.FlagSet, name string, value string, usage string) *DynJWKSValue {
+	return DynJWKSP(flagSet, name, "", value, usage)
+}
+
+// DynJWKSP is like DynJWKS, but accepts a shorthand letter that can be used after a single dash.
+func DynJWKSP(flagSet *flag.FlagSet, name string, shorthand string, value string, usage string) *DynJWKSValue {
+	set := &jwks{byID: map[string]*JSONWebKey{}}
+	var err error
+	if value != "" {
+		if parsed, parseErr := parseJWKS(value); parseErr == nil {
+			set = parsed
+		} else {
+			// an invalid default rejects all tokens, and is reported by `Validate`.
+			set.text, err = value, parseErr
+		}
+	}
+	dynValue := &DynJWKSValue{ptr: unsafe.Pointer(set), defaultErr: err}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynJWKSValue is a flag-related JSON Web Key Set value wrapper.
+type DynJWKSValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer // *jwks
+	defaultErr      error          // of parsing the default, returned by `Validate` until the first `Set`.
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`.
+	validator       func([]JSONWebKey) error
+	validatorCtx    func(context.Context, []JSONWebKey) error
+	notifier        func(oldValue []JSONWebKey, newValue []JSONWebKey)
+	notifierCtx     func(ctx context.Context, oldValue []JSONWebKey, newValue []JSONWebKey)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the keys in a thread-safe manner. They must not be modified.
+func (d *DynJWKSValue) Get() []JSONWebKey {
+	return d.load().keys
+}
+
+// Key returns the key with the KeyID `kid`, and whether there is one.
+func (d *DynJWKSValue) Key(kid string) (JSONWebKey, bool) {
+	key, ok := d.load().byID[kid]
+	if !ok {
+		return JSONWebKey{}, false
+	}
+	return *key, true
+}
+
+// Keyfunc returns the public key verifying a JWT with the `header`, from the key set current at the time of the call.
+// The key is picked by the `kid` of the header (which may be missing from the tokens of key sets of a single key), and
+// the `alg` of the header must be one of the signature algorithms of the key, so that e.g. HMAC algorithms can't be
+// used with public keys. Tokens of unknown keys are rejected with ErrJWKNotFound.
+// It adapts to the Keyfunc of JWT libraries by passing the header of the token, e.g. with github.com/golang-jwt/jwt:
+//
+//	jwt.Parse(input, func(token *jwt.Token) (interface{}, error) { return jwks.Keyfunc(token.Header) })
+func (d *DynJWKSValue) Keyfunc(header map[string]interface{}) (interface{}, error) {
+	set := d.load()
+	kid, _ := header["kid"].(string)
+	alg, _ := header["alg"].(string)
+	key, ok := set.byID[kid]
+	if kid == "" && len(set.keys) == 1 {
+		key, ok = &set.keys[0], true
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", ErrJWKNotFound, kid)
+	}
+	if key.Use == "enc" {
+		return nil, fmt.Errorf("key %q is an encryption key", kid)
+	}
+	if !jwkAllowsAlgorithm(key, alg) {
+		return nil, fmt.Errorf("algorithm %q is not allowed for key %q", alg, kid)
+	}
+	return key.Key, nil
+}
+
+// Set updates the value from a JSON Web Key Set in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, has no keys, keys without unique IDs,
+// private, symmetric or weak keys, or doesn't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynJWKSValue) Set(input string) error {
+	val, err := parseJWKS(input)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	if len(val.keys) == 0 {
+		// an empty key set rejects all tokens, which is never what a rotation means to do.
+		return &ParseError{Err: fmt.Errorf("key set must have at least one key")}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val.keys); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val.keys) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(val))
+	d.defaultErr = nil
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := (*jwks)(oldPtr).keys
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val.keys) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val.keys) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set, in addition to the checks of the keys, e.g. to
+// require the algorithms of the identity provider. Any error returned by the validator will lead to the value being
+// rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynJWKSValue) WithValidator(validator func([]JSONWebKey) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynJWKSValue) WithValidatorCtx(validator func(ctx context.Context, value []JSONWebKey) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks that the default parsed and the current value passes the validator. See `ValidateAll`.
+func (d *DynJWKSValue) Validate() error {
+	d.setMu.Lock()
+	defaultErr := d.defaultErr
+	d.setMu.Unlock()
+	if defaultErr != nil {
+		return &ValidationError{Err: defaultErr}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function that is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynJWKSValue) WithNotifier(notifier func(oldValue []JSONWebKey, newValue []JSONWebKey)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynJWKSValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue []JSONWebKey, newValue []JSONWebKey),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynJWKSValue) Type() string {
+	return "dyn_jwks"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynJWKSValue) FormatHint() string {
+	return `JSON Web Key Set of public keys like {"keys": [{"kty": "RSA", "kid": "...", "n": "...", "e": "AQAB"}]}`
+}
+
+// String returns the compacted JSON of the key set.
+func (d *DynJWKSValue) String() string {
+	return d.load().text
+}
+
+func (d *DynJWKSValue) load() *jwks {
+	return (*jwks)(atomic.LoadPointer(&d.ptr))
+}
+
+func parseJWKS(input string) (*jwks, error) {
+	wire := &struct {
+		Keys []json.RawMessage `json:"keys"`
+	}{}
+	if err := json.Unmarshal([]byte(input), wire); err != nil {
+		return nil, err
+	}
+	if wire.Keys == nil {
+		return nil, fmt.Errorf(`key set must have a "keys" array`)
+	}
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, []byte(input)); err != nil {
+		return nil, err
+	}
+	set := &jwks{byID: make(map[string]*JSONWebKey, len(wire.Keys)), text: compacted.String()}
+	for i, raw := range wire.Keys {
+		key, err := parseJWK(raw)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %v", i, err)
+		}
+		set.keys = append(set.keys, key)
+	}
+	for i := range set.keys {
+		if _, ok := set.byID[set.keys[i].KeyID]; ok {
+			return nil, fmt.Errorf("key %d: duplicate kid %q", i, set.keys[i].KeyID)
+		}
+		set.byID[set.keys[i].KeyID] = &set.keys[i]
+	}
+	return set, nil
+}
+
+func parseJWK(raw json.RawMessage) (JSONWebKey, error) {
+	wire := &jwkJSON{}
+	if err := json.Unmarshal(raw, wire); err != nil {
+		return JSONWebKey{}, err
+	}
+	if wire.D != "" || wire.P != "" || wire.Q != "" || wire.K != "" {
+		return JSONWebKey{}, fmt.Errorf("key %q holds private or symmetric key material, only public keys are allowed",
+			wire.KeyID)
+	}
+	if wire.KeyID == "" {
+		return JSONWebKey{}, fmt.Errorf("kid must be set, so that tokens can be matched to keys across rotations")
+	}
+	if wire.Use != "" && wire.Use != "sig" && wire.Use != "enc" {
+		return JSONWebKey{}, fmt.Errorf("use %q of key %q must be sig or enc", wire.Use, wire.KeyID)
+	}
+	key := JSONWebKey{KeyID: wire.KeyID, KeyType: wire.KeyType, Algorithm: wire.Algorithm, Use: wire.Use}
+	var err error
+	switch wire.KeyType {
+	case "RSA":
+		key.Key, err = parseRSAJWK(wire)
+	case "EC":
+		key.Key, err = parseECJWK(wire)
+	case "OKP":
+		key.Key, err = parseOKPJWK(wire)
+	default:
+		return JSONWebKey{}, fmt.Errorf("kty %q of key %q must be RSA, EC or OKP", wire.KeyType, wire.KeyID)
+	}
+	if err != nil {
+		return JSONWebKey{}, fmt.Errorf("key %q: %v", wire.KeyID, err)
+	}
+	if key.Algorithm != "" && !jwkAllowsAlgorithm(&key, key.Algorithm) {
+		return JSONWebKey{}, fmt.Errorf("alg %q doesn't apply to key %q", key.Algorithm, wire.KeyID)
+	}
+	return key, nil
+}
+
+func parseRSAJWK(wire *jwkJSON) (*rsa.PublicKey, error) {
+	n, err := decodeJWKBytes("n", wire.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeJWKBytes("e", wire.E)
+	if err != nil {
+		return nil, err
+	}
+	modulus := new(big.Int).SetBytes(n)
+	if modulus.BitLen() < minJWKRSABits {
+		return nil, fmt.Errorf("RSA key of %d bits is weaker than %d bits", modulus.BitLen(), minJWKRSABits)
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 || exponent.Bit(0) == 0 {
+		return nil, fmt.Errorf("invalid RSA exponent %v", exponent)
+	}
+	return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+}
+
+func parseECJWK(wire *jwkJSON) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	var ecdhCurve ecdh.Curve
+	switch wire.Curve {
+	case "P-256":
+		curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+	case "P-384":
+		curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+	case "P-521":
+		curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+	default:
+		return nil, fmt.Errorf("crv %q must be P-256, P-384 or P-521", wire.Curve)
+	}
+	x, err := decodeJWKBytes("x", wire.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeJWKBytes("y", wire.Y)
+	if err != nil {
+		return nil, err
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	if len(x) != size || len(y) != size {
+		return nil, fmt.Errorf("coordinates of %v must be %d bytes long", wire.Curve, size)
+	}
+	// crypto/ecdh checks that the point is on the curve.
+	point := append(append([]byte{4}, x...), y...)
+	if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("invalid %v point: %v", wire.Curve, err)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
+
+func parseOKPJWK(wire *jwkJSON) (ed25519.PublicKey, error) {
+	if wire.Curve != "Ed25519" {
+		return nil, fmt.Errorf("crv %q must be Ed25519", wire.Curve)
+	}
+	x, err := decodeJWKBytes("x", wire.X)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("Ed25519 key must be %d bytes long", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(x), nil
+}
+
+// decodeJWKBytes decodes the base64url `value` of the member `name` of a key.
+func decodeJWKBytes(name string, value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("%v must be set", name)
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%v is not base64url: %v", name, err)
+	}
+	return decoded, nil
+}
+
+// jwkAllowsAlgorithm tells whether tokens signed with `alg` can be verified with `key`.
+func jwkAllowsAlgorithm(key *JSONWebKey, alg string) bool {
+	if key.Algorithm != "" && key.Algorithm != alg {
+		return false
+	}
+	switch public := key.Key.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+			return true
+		}
+	case *ecdsa.PublicKey:
+		switch public.Curve {
+		case elliptic.P256():
+			return alg == "ES256"
+		case elliptic.P384():
+			return alg == "ES384"
+		case elliptic.P521():
+			return alg == "ES512"
+		}
+	case ed25519.PublicKey:
+		return alg == "EdDSA" || alg == "Ed25519"
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	someRSAKey, _   = rsa.GenerateKey(rand.Reader, 2048)
+	someECKey, _    = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	someEdKey, _, _ = ed25519.GenerateKey(rand.Reader)
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey, extra string) string {
+	return fmt.Sprintf(`{"kty": "RSA", "kid": %q, "n": %q, "e": %q%v}`, kid, b64(key.N.Bytes()),
+		b64(big.NewInt(int64(key.E)).Bytes()), extra)
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) string {
+	x, y := make([]byte, 32), make([]byte, 32)
+	return fmt.Sprintf(`{"kty": "EC", "kid": %q, "crv": "P-256", "x": %q, "y": %q}`, kid, b64(key.X.FillBytes(x)),
+		b64(key.Y.FillBytes(y)))
+}
+
+func edJWK(kid string, key ed25519.PublicKey) string {
+	return fmt.Sprintf(`{"kty": "OKP", "kid": %q, "crv": "Ed25519", "x": %q}`, kid, b64(key))
+}
+
+func keySet(keys ...string) string {
+	set := `{"keys": [`
+	for i, key := range keys {
+		if i > 0 {
+			set += ", "
+		}
+		set += key
+	}
+	return set + "]}"
+}
+
+func TestDynJWKS_KeyfuncReturnsKeysOfTokens(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynJWKS(set, "some_jwks_1", "", "Use it or lose it")
+	require.NoError(t, set.Set("some_jwks_1", keySet(
+		rsaJWK("rsa-1", &someRSAKey.PublicKey, `, "alg": "RS256", "use": "sig"`),
+		ecJWK("ec-1", &someECKey.PublicKey),
+		edJWK("ed-1", someEdKey))))
+	require.Len(t, dynFlag.Get(), 3)
+
+	key, err := dynFlag.Keyfunc(map[string]interface{}{"kid": "rsa-1", "alg": "RS256"})
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte("some token"))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, someRSAKey, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	assert.NoError(t, rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature),
+		"the key must verify signatures of the private key")
+
+	key, err = dynFlag.Keyfunc(map[string]interface{}{"kid": "ec-1", "alg": "ES256"})
+	require.NoError(t, err)
+	assert.True(t, key.(*ecdsa.PublicKey).Equal(&someECKey.PublicKey))
+	key, err = dynFlag.Keyfunc(map[string]interface{}{"kid": "ed-1", "alg": "EdDSA"})
+	require.NoError(t, err)
+	assert.True(t, key.(ed25519.PublicKey).Equal(someEdKey))
+	jwk, ok := dynFlag.Key("ec-1")
+	assert.True(t, ok)
+	assert.Equal(t, "EC", jwk.KeyType)
+}
+
+func TestDynJWKS_KeyfuncRejectsMismatchedTokens(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynJWKS(set, "some_jwks_1", keySet(
+		rsaJWK("rsa-1", &someRSAKey.PublicKey, `, "alg": "RS256"`),
+		rsaJWK("rsa-2", &someRSAKey.PublicKey, `, "use": "enc"`),
+		ecJWK("ec-1", &someECKey.PublicKey)), "Use it or lose it")
+	require.NoError(t, dynFlag.Validate())
+
+	_, err := dynFlag.Keyfunc(map[string]interface{}{"kid": "rsa-3", "alg": "RS256"})
+	assert.True(t, errors.Is(err, ErrJWKNotFound), "unknown keys must be reported")
+	_, err = dynFlag.Keyfunc(map[string]interface{}{"alg": "RS256"})
+	assert.True(t, errors.Is(err, ErrJWKNotFound), "tokens without kid must be rejected by sets of many keys")
+	for _, header := range []map[string]interface{}{
+		{"kid": "rsa-1", "alg": "HS256"},
+		{"kid": "rsa-1", "alg": "PS256"},
+		{"kid": "rsa-1", "alg": "none"},
+		{"kid": "rsa-1"},
+		{"kid": "rsa-2", "alg": "RS256"},
+		{"kid": "ec-1", "alg": "ES384"},
+		{"kid": "ec-1", "alg": "RS256"},
+	} {
+		_, err := dynFlag.Keyfunc(header)
+		assert.Error(t, err, "header %v must be rejected", header)
+	}
+}
+
+func TestDynJWKS_RejectsBadKeySets(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	good := keySet(edJWK("ed-1", someEdKey))
+	dynFlag := DynJWKS(set, "some_jwks_1", good, "Use it or lose it")
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	for _, input := range []string{
+		`not json`,
+		`{}`,
+		`{"keys": []}`,
+		keySet(rsaJWK("rsa-1", &someRSAKey.PublicKey, `, "d": "AQAB"`)),
+		keySet(`{"kty": "oct", "kid": "hmac-1", "k": "c2VjcmV0"}`),
+		keySet(rsaJWK("", &someRSAKey.PublicKey, "")),
+		keySet(edJWK("ed-1", someEdKey), edJWK("ed-1", someEdKey)),
+		keySet(rsaJWK("rsa-1", &weakKey.PublicKey, "")),
+		keySet(rsaJWK("rsa-1", &someRSAKey.PublicKey, `, "alg": "ES256"`)),
+		keySet(rsaJWK("rsa-1", &someRSAKey.PublicKey, `, "use": "sign"`)),
+		keySet(`{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": "` + b64(make([]byte, 32)) + `", "y": "` +
+			b64(make([]byte, 32)) + `"}`),
+		keySet(`{"kty": "EC", "kid": "ec-1", "crv": "secp256k1", "x": "AQAB", "y": "AQAB"}`),
+		keySet(`{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": "not base64!"}`),
+		keySet(`{"kty": "OKP", "kid": "ed-1", "crv": "X25519", "x": "` + b64(someEdKey) + `"}`),
+	} {
+		err := dynFlag.Set(input)
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr), "value %v must be rejected", input)
+	}
+	_, ok := dynFlag.Key("ed-1")
+	assert.True(t, ok, "rejected values must not be applied")
+}
+
+func TestDynJWKS_RotatesKeys(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynJWKS(set, "some_jwks_1", keySet(ecJWK("2024-01", &someECKey.PublicKey)), "Use it or lose it")
+	_, err := dynFlag.Keyfunc(map[string]interface{}{"alg": "ES256"})
+	assert.NoError(t, err, "tokens without kid must be matched to sets of a single key")
+
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	require.NoError(t, set.Set("some_jwks_1", keySet(ecJWK("2024-01", &someECKey.PublicKey),
+		ecJWK("2024-02", &newKey.PublicKey))))
+	_, err = dynFlag.Keyfunc(map[string]interface{}{"kid": "2024-01", "alg": "ES256"})
+	assert.NoError(t, err, "old keys must be kept during the rotation")
+	require.NoError(t, set.Set("some_jwks_1", keySet(ecJWK("2024-02", &newKey.PublicKey))))
+	_, err = dynFlag.Keyfunc(map[string]interface{}{"kid": "2024-01", "alg": "ES256"})
+	assert.True(t, errors.Is(err, ErrJWKNotFound), "retired keys must be rejected")
+	key, err := dynFlag.Keyfunc(map[string]interface{}{"kid": "2024-02", "alg": "ES256"})
+	require.NoError(t, err)
+	assert.True(t, key.(*ecdsa.PublicKey).Equal(&newKey.PublicKey))
+}
+
+func TestDynJWKS_Defaults(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	empty := DynJWKS(set, "some_jwks_1", "", "Use it or lose it")
+	assert.NoError(t, empty.Validate())
+	_, err := empty.Keyfunc(map[string]interface{}{"kid": "rsa-1", "alg": "RS256"})
+	assert.True(t, errors.Is(err, ErrJWKNotFound), "empty key sets must reject all tokens")
+
+	invalid := DynJWKS(set, "some_jwks_2", `{"keys": [{"kty": "oct"}]}`, "Use it or lose it")
+	assert.Error(t, invalid.Validate())
+	assert.Empty(t, invalid.Get())
+	assert.Equal(t, `{"keys": [{"kty": "oct"}]}`, invalid.String())
+	require.NoError(t, invalid.Set(` {"keys": [`+edJWK("ed-1", someEdKey)+`]} `))
+	assert.NoError(t, invalid.Validate())
+	assert.Equal(t, fmt.Sprintf(`{"keys":[{"kty":"OKP","kid":"ed-1","crv":"Ed25519","x":"%v"}]}`, b64(someEdKey)),
+		invalid.String())
+}
@@ -0,0 +1,232 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+const defaultRequiredConfirmations = 2
+
+// ErrKillSwitchUnconfirmed is returned (wrapped in a ValidationError) by the `Set` of a `DynKillSwitch` engaging it
+// without enough confirmations.
+var ErrKillSwitchUnconfirmed = errors.New("kill switch needs more confirmations")
+
+// DynKillSwitch creates a `Flag` that represents a kill switch guarded by confirmations, which is safe to change
+// dynamically at runtime. Engaging it (setting it to true) requires confirmations of distinct signers (see
+// `WithSigners` and `ConfirmKillSwitch`), so that a single fat-fingered write can't kill a feature globally, while
+// disengaging it only takes a plain `false`.
+//
+// Values are `false`, or `true` followed by comma-separated confirmations, e.g. `true,alice:<sig>,bob:<sig>`.
+func DynKillSwitch(flagSet *flag.FlagSet, name string, value bool, usage string) *DynKillSwitchValue {
+	return DynKillSwitchP(flagSet, name, "", value, usage)
+}
+
+// DynKillSwitchP is like DynKillSwitch, but accepts a shorthand letter that can be used after a single dash.
+func DynKillSwitchP(flagSet *flag.FlagSet, name string, shorthand string, value bool,
+	usage string) *DynKillSwitchValue {
+	dynValue := &DynKillSwitchValue{name: name, required: defaultRequiredConfirmations}
+	if value {
+		dynValue.val = 1
+	}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynKillSwitchValue is a flag-related kill switch value wrapper.
+type DynKillSwitchValue struct {
+	dynChangeTime
+	val uint32
+
+	name            string
+	signers         map[string][]byte
+	required        int
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func(bool) error
+	validatorCtx    func(context.Context, bool) error
+	notifier        func(oldValue bool, newValue bool)
+	notifierCtx     func(ctx context.Context, oldValue bool, newValue bool)
+	notifierTimeout time.Duration
+}
+
+// ConfirmKillSwitch returns the confirmation of `signer` for engaging the kill switch `name`, signed with the `key` of
+// the signer. Confirmations are specific to the flag, but not to a single write: anyone who saw them can engage the
+// kill switch again, until the keys of the signers are rotated.
+func ConfirmKillSwitch(name string, signer string, key []byte) string {
+	return signer + ":" + base64.RawURLEncoding.EncodeToString(killSwitchMAC(key, name, signer))
+}
+
+// Get retrieves whether the kill switch is engaged in a thread-safe manner, with a single atomic load and no
+// allocations.
+func (d *DynKillSwitchValue) Get() bool {
+	return atomic.LoadUint32(&d.val) != 0
+}
+
+// Set updates the value from a string representation in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, engages the kill switch without the
+// confirmations of enough distinct signers, or the resulting value doesn't pass an optional validator. Setting the
+// value the kill switch already has doesn't need confirmations, so that backends can re-read it.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynKillSwitchValue) Set(input string) error {
+	parts := strings.Split(input, ",")
+	val, err := strconv.ParseBool(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if val && !d.Get() {
+		if err := d.checkConfirmations(parts[1:]); err != nil {
+			return err
+		}
+	}
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	var newVal uint32
+	if val {
+		newVal = 1
+	}
+	oldVal := atomic.SwapUint32(&d.val, newVal) != 0
+	d.markChanged()
+	if d.notifier != nil {
+		RunNotifier(func() { d.notifier(oldVal, val) })
+	}
+	if d.notifierCtx != nil {
+		notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+		RunNotifierCtx(d, d.notifierTimeout, notify)
+	}
+	return nil
+}
+
+func (d *DynKillSwitchValue) checkConfirmations(confirmations []string) error {
+	signers := make(map[string]struct{})
+	keys := make(map[string]struct{})
+	for _, confirmation := range confirmations {
+		parts := strings.SplitN(strings.TrimSpace(confirmation), ":", 2)
+		if len(parts) != 2 {
+			return &ParseError{Err: fmt.Errorf("confirmation %q must be in signer:signature form", confirmation)}
+		}
+		signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			return &ParseError{Err: fmt.Errorf("confirmation of %v: %w", parts[0], ErrBadSignature)}
+		}
+		key, ok := d.signers[parts[0]]
+		if !ok {
+			return &ValidationError{Err: fmt.Errorf("confirmation of unknown signer %v", parts[0])}
+		}
+		if !hmac.Equal(signature, killSwitchMAC(key, d.name, parts[0])) {
+			return &ValidationError{Err: fmt.Errorf("confirmation of %v: %w", parts[0], ErrBadSignature)}
+		}
+		// signers sharing a key can't confirm independently of each other.
+		signers[parts[0]] = struct{}{}
+		keys[string(key)] = struct{}{}
+	}
+	confirmed := len(signers)
+	if len(keys) < confirmed {
+		confirmed = len(keys)
+	}
+	if confirmed < d.required {
+		return &ValidationError{Err: fmt.Errorf("%w: %v of %v", ErrKillSwitchUnconfirmed, confirmed, d.required)}
+	}
+	return nil
+}
+
+// WithSigners sets the keys of the signers whose confirmations engage the kill switch, by signer name. Without signers
+// the kill switch can't be engaged dynamically. It must be called before the flag is used.
+func (d *DynKillSwitchValue) WithSigners(signers map[string][]byte) *DynKillSwitchValue {
+	d.signers = signers
+	return d
+}
+
+// WithRequiredConfirmations sets the number of distinct signers that must confirm engaging the kill switch. Defaults
+// to 2. It must be called before the flag is used.
+func (d *DynKillSwitchValue) WithRequiredConfirmations(required int) *DynKillSwitchValue {
+	d.required = required
+	return d
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynKillSwitchValue) WithValidator(validator func(bool) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynKillSwitchValue) WithValidatorCtx(validator func(ctx context.Context, value bool) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it.
+// See `ValidateAll`.
+func (d *DynKillSwitchValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynKillSwitchValue) WithNotifier(notifier func(oldValue bool, newValue bool)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynKillSwitchValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue bool, newValue bool),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynKillSwitchValue) Type() string {
+	return "dyn_kill_switch"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynKillSwitchValue) FormatHint() string {
+	return "false, or true followed by confirmations like true,alice:<sig>,bob:<sig>"
+}
+
+// String returns the canonical string representation of the type, without any confirmations.
+func (d *DynKillSwitchValue) String() string {
+	return strconv.FormatBool(d.Get())
+}
+
+func killSwitchMAC(key []byte, name string, signer string) []byte {
+	// signer names don't contain NUL bytes either, see `flagValueMAC`.
+	return flagValueMAC(key, name, "true\x00"+signer)
+}
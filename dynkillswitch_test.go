@@ -0,0 +1,73 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var killSwitchSigners = map[string][]byte{
+	"alice": []byte("alice-key"),
+	"bob":   []byte("bob-key"),
+	"carol": []byte("carol-key"),
+	"dave":  []byte("alice-key"),
+}
+
+func confirmations(name string, signers ...string) string {
+	out := []string{"true"}
+	for _, signer := range signers {
+		out = append(out, ConfirmKillSwitch(name, signer, killSwitchSigners[signer]))
+	}
+	return strings.Join(out, ",")
+}
+
+func TestDynKillSwitch_EngagesOnlyWithTwoConfirmations(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynKillSwitch(set, "some_switch_1", false, "Use it or lose it").WithSigners(killSwitchSigners)
+	assert.True(t, IsFlagDynamic(set.Lookup("some_switch_1")))
+
+	for _, input := range []string{
+		"true",
+		confirmations("some_switch_1", "alice"),
+		confirmations("some_switch_1", "alice", "alice"),
+		confirmations("some_switch_1", "alice", "dave"),
+		confirmations("other_switch", "alice", "bob"),
+	} {
+		err := dynFlag.Set(input)
+		assert.True(t, errors.Is(err, ErrKillSwitchUnconfirmed) || errors.Is(err, ErrBadSignature),
+			"value %v must be rejected, got %v", input, err)
+		assert.False(t, dynFlag.Get(), "value %v must not engage the kill switch", input)
+	}
+	var validationErr *ValidationError
+	assert.True(t, errors.As(dynFlag.Set("true,mallory:c2ln"), &validationErr), "unknown signers must be rejected")
+	var parseErr *ParseError
+	assert.True(t, errors.As(dynFlag.Set("true,alice"), &parseErr), "malformed confirmations must be rejected")
+
+	require.NoError(t, set.Set("some_switch_1", confirmations("some_switch_1", "alice", "bob")))
+	assert.True(t, dynFlag.Get(), "two confirmations must engage the kill switch")
+	assert.Equal(t, "true", dynFlag.String(), "confirmations must not be shown")
+	assert.NoError(t, dynFlag.Set("true"), "setting the current value must not need confirmations")
+
+	require.NoError(t, dynFlag.Set("false"), "disengaging must not need confirmations")
+	assert.False(t, dynFlag.Get())
+}
+
+func TestDynKillSwitch_RequiredConfirmations(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynKillSwitch(set, "some_switch_1", false, "Use it or lose it").
+		WithSigners(killSwitchSigners).WithRequiredConfirmations(3)
+	assert.Error(t, dynFlag.Set(confirmations("some_switch_1", "alice", "bob")))
+	require.NoError(t, dynFlag.Set(confirmations("some_switch_1", "alice", "bob", "carol")))
+	assert.True(t, dynFlag.Get())
+
+	unsigned := DynKillSwitch(set, "some_switch_2", false, "Use it or lose it")
+	assert.Error(t, unsigned.Set(confirmations("some_switch_2", "alice", "bob")),
+		"kill switches without signers must not be engaged")
+}
@@ -0,0 +1,469 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Operators of the requirements of a LabelSelector.
+const (
+	labelEquals       = "="
+	labelNotEquals    = "!="
+	labelIn           = "in"
+	labelNotIn        = "notin"
+	labelExists       = "exists"
+	labelDoesNotExist = "!"
+	labelGreaterThan  = ">"
+	labelLessThan     = "<"
+)
+
+// LabelSelector is a parsed Kubernetes-style label selector, the value of a `DynLabelSelector` flag. It is a
+// comma-separated list of requirements that all have to be met by the labels it matches:
+//
+//	env=prod, tier!=frontend     the label is (or isn't, or is missing) a value; `==` is the same as `=`
+//	env in (prod,staging)        the label is one of the values
+//	env notin (dev)              the label isn't any of the values, or is missing
+//	canary, !legacy              the label exists, or doesn't exist
+//	replicas>2, replicas<10      the label is an integer greater or less than the value
+//
+// Keys and values follow the Kubernetes syntax of labels, e.g. `app.example.com/team`. The empty selector matches
+// all labels.
+type LabelSelector struct {
+	requirements []labelRequirement
+	matchNothing bool   // for invalid defaults of `DynLabelSelector`.
+	text         string // the canonical form.
+}
+
+type labelRequirement struct {
+	key      string
+	operator string
+	values   []string // sorted.
+	number   int64    // of labelGreaterThan and labelLessThan.
+}
+
+// ParseLabelSelector parses a LabelSelector like `env in (prod,staging), !canary`.
+func ParseLabelSelector(input string) (*LabelSelector, error) {
+	tokens, err := lexLabelSelector(input)
+	if err != nil {
+		return nil, err
+	}
+	selector := &LabelSelector{}
+	for len(tokens) > 0 {
+		requirement, rest, err := parseLabelRequirement(tokens)
+		if err != nil {
+			return nil, err
+		}
+		selector.requirements = append(selector.requirements, requirement)
+		if len(rest) > 0 {
+			if rest[0] != "," {
+				return nil, fmt.Errorf("expected a comma after requirement %v, got %q", requirement.String(), rest[0])
+			}
+			if rest = rest[1:]; len(rest) == 0 {
+				return nil, fmt.Errorf("expected a requirement after the trailing comma")
+			}
+		}
+		tokens = rest
+	}
+	texts := make([]string, 0, len(selector.requirements))
+	for _, requirement := range selector.requirements {
+		texts = append(texts, requirement.String())
+	}
+	selector.text = strings.Join(texts, ",")
+	return selector, nil
+}
+
+// Match tells whether `labels` meet all the requirements of the selector. It doesn't allocate.
+func (s *LabelSelector) Match(labels map[string]string) bool {
+	if s.matchNothing {
+		return false
+	}
+	for i := range s.requirements {
+		if !s.requirements[i].match(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the canonical form of the selector, with the values of sets sorted.
+func (s *LabelSelector) String() string {
+	return s.text
+}
+
+func (r *labelRequirement) match(labels map[string]string) bool {
+	value, ok := labels[r.key]
+	switch r.operator {
+	case labelEquals:
+		return ok && value == r.values[0]
+	case labelNotEquals:
+		return !ok || value != r.values[0]
+	case labelIn:
+		return ok && containsSorted(r.values, value)
+	case labelNotIn:
+		return !ok || !containsSorted(r.values, value)
+	case labelExists:
+		return ok
+	case labelDoesNotExist:
+		return !ok
+	case labelGreaterThan, labelLessThan:
+		if !ok {
+			return false
+		}
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+		return (r.operator == labelGreaterThan && number > r.number) ||
+			(r.operator == labelLessThan && number < r.number)
+	}
+	return false
+}
+
+func (r *labelRequirement) String() string {
+	switch r.operator {
+	case labelIn, labelNotIn:
+		return r.key + " " + r.operator + " (" + strings.Join(r.values, ",") + ")"
+	case labelExists:
+		return r.key
+	case labelDoesNotExist:
+		return "!" + r.key
+	case labelGreaterThan, labelLessThan:
+		return r.key + r.operator + strconv.FormatInt(r.number, 10)
+	}
+	return r.key + r.operator + r.values[0]
+}
+
+// DynLabelSelector creates a `Flag` that represents a LabelSelector, which is safe to change dynamically at runtime,
+// e.g. to scope which workloads a controller acts on. An invalid `value` matches no labels, and is reported by
+// `Validate`.
+func DynLabelSelector(flagSet *flag.FlagSet, name string, value string, usage string) *DynLabelSelectorValue {
+	return DynLabelSelectorP(flagSet, name, "", value, usage)
+}
+
+// DynLabelSelectorP is like DynLabelSelector, but accepts a shorthand letter that can be used after a single dash.
+func DynLabelSelectorP(flagSet *flag.FlagSet, name string, shorthand string, value string,
+	usage string) *DynLabelSelectorValue {
+	selector, err := ParseLabelSelector(value)
+	if err != nil {
+		selector = &LabelSelector{matchNothing: true, text: value}
+	}
+	dynValue := &DynLabelSelectorValue{ptr: unsafe.Pointer(selector), defaultErr: err}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynLabelSelectorValue is a flag-related LabelSelector value wrapper.
+type DynLabelSelectorValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer // *LabelSelector
+	defaultErr      error          // of parsing the default, returned by `Validate` until the first `Set`.
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`.
+	validator       func(*LabelSelector) error
+	validatorCtx    func(context.Context, *LabelSelector) error
+	notifier        func(oldValue *LabelSelector, newValue *LabelSelector)
+	notifierCtx     func(ctx context.Context, oldValue *LabelSelector, newValue *LabelSelector)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the LabelSelector in a thread-safe manner.
+func (d *DynLabelSelectorValue) Get() *LabelSelector {
+	return (*LabelSelector)(atomic.LoadPointer(&d.ptr))
+}
+
+// Match tells whether `labels` are matched by the current LabelSelector.
+func (d *DynLabelSelectorValue) Match(labels map[string]string) bool {
+	return d.Get().Match(labels)
+}
+
+// Set updates the value from a label selector expression in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass an
+// optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynLabelSelectorValue) Set(input string) error {
+	val, err := ParseLabelSelector(input)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(val))
+	d.defaultErr = nil
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := (*LabelSelector)(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set, e.g. to forbid selectors matching all labels.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynLabelSelectorValue) WithValidator(validator func(*LabelSelector) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynLabelSelectorValue) WithValidatorCtx(validator func(ctx context.Context, value *LabelSelector) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks that the default parsed and the current value passes the validator. See `ValidateAll`.
+func (d *DynLabelSelectorValue) Validate() error {
+	d.setMu.Lock()
+	defaultErr := d.defaultErr
+	d.setMu.Unlock()
+	if defaultErr != nil {
+		return &ValidationError{Err: defaultErr}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function that is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynLabelSelectorValue) WithNotifier(notifier func(oldValue *LabelSelector, newValue *LabelSelector)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynLabelSelectorValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue *LabelSelector, newValue *LabelSelector), timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynLabelSelectorValue) Type() string {
+	return "dyn_label_selector"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynLabelSelectorValue) FormatHint() string {
+	return "label selector like env in (prod,staging),!canary"
+}
+
+// String returns the canonical representation of the LabelSelector.
+func (d *DynLabelSelectorValue) String() string {
+	return d.Get().String()
+}
+
+// lexLabelSelector splits `input` into words (keys, operators named like `in` and values) and the punctuation of
+// label selectors, skipping white space.
+func lexLabelSelector(input string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == ',' || c == '>' || c == '<':
+			tokens = append(tokens, input[i:i+1])
+			i++
+		case c == '=' || c == '!':
+			if strings.HasPrefix(input[i:], "==") || strings.HasPrefix(input[i:], "!=") {
+				tokens = append(tokens, input[i:i+2])
+				i += 2
+			} else {
+				tokens = append(tokens, input[i:i+1])
+				i++
+			}
+		case isLabelChar(c) || c == '/':
+			start := i
+			for i < len(input) && (isLabelChar(input[i]) || input[i] == '/') {
+				i++
+			}
+			tokens = append(tokens, input[start:i])
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %v", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+// parseLabelRequirement parses the requirement at the start of `tokens`, returning the tokens after it.
+func parseLabelRequirement(tokens []string) (labelRequirement, []string, error) {
+	if tokens[0] == "!" {
+		if len(tokens) < 2 {
+			return labelRequirement{}, nil, fmt.Errorf("expected a key after !")
+		}
+		if err := validLabelKey(tokens[1]); err != nil {
+			return labelRequirement{}, nil, err
+		}
+		return labelRequirement{key: tokens[1], operator: labelDoesNotExist}, tokens[2:], nil
+	}
+	requirement := labelRequirement{key: tokens[0]}
+	if err := validLabelKey(requirement.key); err != nil {
+		return labelRequirement{}, nil, err
+	}
+	if len(tokens) == 1 || tokens[1] == "," {
+		requirement.operator = labelExists
+		return requirement, tokens[1:], nil
+	}
+	operator, rest := tokens[1], tokens[2:]
+	switch operator {
+	case "=", "==", "!=":
+		requirement.operator = labelEquals
+		if operator == "!=" {
+			requirement.operator = labelNotEquals
+		}
+		// the value may be empty, e.g. in `env=,tier=web`.
+		value := ""
+		if len(rest) > 0 && rest[0] != "," {
+			value, rest = rest[0], rest[1:]
+		}
+		if err := validLabelValue(value); err != nil {
+			return labelRequirement{}, nil, err
+		}
+		requirement.values = []string{value}
+	case labelIn, labelNotIn:
+		requirement.operator = operator
+		if len(rest) == 0 || rest[0] != "(" {
+			return labelRequirement{}, nil, fmt.Errorf("expected ( after %v %v", requirement.key, operator)
+		}
+		for rest = rest[1:]; ; rest = rest[1:] {
+			if len(rest) < 2 {
+				return labelRequirement{}, nil, fmt.Errorf("unterminated values of %v %v", requirement.key, operator)
+			}
+			if err := validLabelValue(rest[0]); err != nil || rest[0] == "" {
+				return labelRequirement{}, nil, fmt.Errorf("invalid value %q of %v %v", rest[0], requirement.key,
+					operator)
+			}
+			if !containsSorted(requirement.values, rest[0]) {
+				requirement.values = append(requirement.values, rest[0])
+				sort.Strings(requirement.values)
+			}
+			if rest = rest[1:]; rest[0] == ")" {
+				rest = rest[1:]
+				break
+			}
+			if rest[0] != "," {
+				return labelRequirement{}, nil, fmt.Errorf("expected , or ) in values of %v %v, got %q",
+					requirement.key, operator, rest[0])
+			}
+		}
+	case labelGreaterThan, labelLessThan:
+		requirement.operator = operator
+		if len(rest) == 0 {
+			return labelRequirement{}, nil, fmt.Errorf("expected an integer after %v%v", requirement.key, operator)
+		}
+		number, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil {
+			return labelRequirement{}, nil, fmt.Errorf("expected an integer after %v%v, got %q", requirement.key,
+				operator, rest[0])
+		}
+		requirement.number, rest = number, rest[1:]
+	default:
+		return labelRequirement{}, nil, fmt.Errorf("unknown operator %q after key %v", operator, requirement.key)
+	}
+	return requirement, rest, nil
+}
+
+// validLabelKey checks `key` against the Kubernetes syntax: a name of at most 63 characters, optionally prefixed by a
+// DNS subdomain and a slash.
+func validLabelKey(key string) error {
+	name := key
+	if i := strings.IndexByte(key, '/'); i >= 0 {
+		prefix := key[:i]
+		name = key[i+1:]
+		if prefix == "" || len(prefix) > 253 || !isDNSSubdomain(prefix) {
+			return fmt.Errorf("invalid prefix %q of key %q, it must be a DNS subdomain", prefix, key)
+		}
+	}
+	if name == "" || !isLabelName(name) {
+		return fmt.Errorf("invalid key %q, its name must be at most 63 alphanumeric, '-', '_' or '.' characters, "+
+			"starting and ending with an alphanumeric one", key)
+	}
+	return nil
+}
+
+// validLabelValue checks `value` against the Kubernetes syntax: empty, or like the name of a key.
+func validLabelValue(value string) error {
+	if value != "" && !isLabelName(value) {
+		return fmt.Errorf("invalid value %q, it must be at most 63 alphanumeric, '-', '_' or '.' characters, "+
+			"starting and ending with an alphanumeric one", value)
+	}
+	return nil
+}
+
+func isLabelName(name string) bool {
+	if len(name) > 63 || !isAlphanumeric(name[0]) || !isAlphanumeric(name[len(name)-1]) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isLabelChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDNSSubdomain(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if part == "" || !isAlphanumeric(part[0]) || !isAlphanumeric(part[len(part)-1]) {
+			return false
+		}
+		for i := 0; i < len(part); i++ {
+			if c := part[i]; !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isLabelChar(c byte) bool {
+	return isAlphanumeric(c) || c == '-' || c == '_' || c == '.'
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func containsSorted(sorted []string, value string) bool {
+	i := sort.SearchStrings(sorted, value)
+	return i < len(sorted) && sorted[i] == value
+}
@@ -0,0 +1,132 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabelSelector_Matches(t *testing.T) {
+	for _, tcase := range []struct {
+		selector string
+		labels   map[string]string
+		matches  bool
+	}{
+		{"", nil, true},
+		{"env=prod", map[string]string{"env": "prod"}, true},
+		{"env==prod", map[string]string{"env": "staging"}, false},
+		{"env=prod", nil, false},
+		{"env!=prod", map[string]string{"env": "staging"}, true},
+		{"env!=prod", nil, true},
+		{"env=", map[string]string{"env": ""}, true},
+		{"env in (prod, staging)", map[string]string{"env": "staging"}, true},
+		{"env in (prod,staging)", map[string]string{"env": "dev"}, false},
+		{"env in (prod,staging)", nil, false},
+		{"env notin (dev)", map[string]string{"env": "prod"}, true},
+		{"env notin (dev)", nil, true},
+		{"env notin (dev)", map[string]string{"env": "dev"}, false},
+		{"canary", map[string]string{"canary": ""}, true},
+		{"canary", nil, false},
+		{"!canary", map[string]string{"env": "prod"}, true},
+		{"!canary", map[string]string{"canary": "true"}, false},
+		{"replicas>2", map[string]string{"replicas": "3"}, true},
+		{"replicas>2", map[string]string{"replicas": "2"}, false},
+		{"replicas<2", map[string]string{"replicas": "many"}, false},
+		{"app.example.com/team=infra", map[string]string{"app.example.com/team": "infra"}, true},
+		{"env in (prod,staging), !canary", map[string]string{"env": "prod"}, true},
+		{"env in (prod,staging), !canary", map[string]string{"env": "prod", "canary": "yes"}, false},
+	} {
+		selector, err := ParseLabelSelector(tcase.selector)
+		require.NoError(t, err, "selector %q must parse", tcase.selector)
+		assert.Equal(t, tcase.matches, selector.Match(tcase.labels), "selector %q on %v", tcase.selector,
+			tcase.labels)
+	}
+}
+
+func TestParseLabelSelector_RejectsBadSelectors(t *testing.T) {
+	for _, input := range []string{
+		"env=prod,",
+		",env=prod",
+		"env prod",
+		"env in prod",
+		"env in (prod",
+		"env in ()",
+		"env in (prod,)",
+		"env=prod staging",
+		"env=(prod)",
+		"env===prod",
+		"replicas>two",
+		"!",
+		"-env=prod",
+		"env=prod-",
+		"Example.com/env=prod",
+		"a/b/c=prod",
+		"env=" + strings.Repeat("a", 64),
+		"env=pr*d",
+	} {
+		_, err := ParseLabelSelector(input)
+		assert.Error(t, err, "selector %q must be rejected", input)
+	}
+}
+
+func TestParseLabelSelector_String(t *testing.T) {
+	selector, err := ParseLabelSelector(" env  in (staging, prod,prod) , tier==web,!canary, replicas > 2,ready")
+	require.NoError(t, err)
+	assert.Equal(t, "env in (prod,staging),tier=web,!canary,replicas>2,ready", selector.String())
+	again, err := ParseLabelSelector(selector.String())
+	require.NoError(t, err)
+	assert.Equal(t, selector, again, "the canonical form must parse to the same selector")
+}
+
+func TestDynLabelSelector_SetAndMatch(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynLabelSelector(set, "some_selector_1", "env=prod", "Use it or lose it")
+	assert.True(t, dynFlag.Match(map[string]string{"env": "prod"}))
+
+	require.NoError(t, set.Set("some_selector_1", "env in (prod,staging),!canary"))
+	assert.True(t, dynFlag.Match(map[string]string{"env": "staging"}))
+	assert.Equal(t, "env in (prod,staging),!canary", dynFlag.String())
+
+	err := set.Set("some_selector_1", "env in (prod")
+	var parseErr *ParseError
+	assert.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, "env in (prod,staging),!canary", dynFlag.String(), "rejected values must not be applied")
+}
+
+func TestDynLabelSelector_InvalidDefaultMatchesNothing(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynLabelSelector(set, "some_selector_1", "env in (prod", "Use it or lose it")
+	assert.Error(t, dynFlag.Validate())
+	assert.False(t, dynFlag.Match(map[string]string{"env": "prod"}))
+	assert.Equal(t, "env in (prod", dynFlag.String())
+
+	dynFlag.WithValidator(func(selector *LabelSelector) error {
+		if selector.String() == "" {
+			return errors.New("the selector must not match everything")
+		}
+		return nil
+	})
+	assert.Error(t, set.Set("some_selector_1", ""))
+	require.NoError(t, set.Set("some_selector_1", "env=prod"))
+	assert.NoError(t, dynFlag.Validate())
+}
+
+func BenchmarkDynLabelSelector_Match(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynLabelSelector(set, "some_selector_1", "env in (prod,staging),tier!=frontend,!canary",
+		"Use it or lose it")
+	labels := map[string]string{"env": "prod", "tier": "backend", "app": "checkout"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if !dynFlag.Match(labels) {
+			b.Fatal("labels must match")
+		}
+	}
+}
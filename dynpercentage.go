@@ -0,0 +1,206 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// percentageBuckets is the number of buckets keys are hashed into, giving a resolution of 0.01%.
+const percentageBuckets = 10000
+
+// DynPercentage creates a `Flag` that represents a percentage of keys (e.g. users) for which a feature is enabled,
+// which is safe to change dynamically at runtime. Values are in the [0, 100] range, optionally followed by `%`.
+//
+// Keys are assigned to buckets by a stable hash salted with the flag name, so raising the percentage only ever enables
+// the feature for more keys, and each key keeps its answer for as long as the percentage doesn't change.
+func DynPercentage(flagSet *flag.FlagSet, name string, value float64, usage string) *DynPercentageValue {
+	return DynPercentageP(flagSet, name, "", value, usage)
+}
+
+// DynPercentageP is like DynPercentage, but accepts a shorthand letter that can be used after a single dash.
+func DynPercentageP(flagSet *flag.FlagSet, name string, shorthand string, value float64,
+	usage string) *DynPercentageValue {
+	dynValue := &DynPercentageValue{bits: math.Float64bits(value), salt: name, bucketBy: UserIDAttribute}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynPercentageValue is a flag-related percentage rollout value wrapper.
+type DynPercentageValue struct {
+	dynChangeTime
+	bits uint64 // IEEE 754 bits of the value, following dynChangeTime so it is 64-bit aligned for atomics.
+
+	salt            string
+	bucketBy        string
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func(float64) error
+	validatorCtx    func(context.Context, float64) error
+	notifier        func(oldValue float64, newValue float64)
+	notifierCtx     func(ctx context.Context, oldValue float64, newValue float64)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the percentage in a thread-safe manner, with a single atomic load and no allocations.
+func (d *DynPercentageValue) Get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&d.bits))
+}
+
+// EnabledFor tells whether the feature is enabled for `key`, i.e. whether the bucket of `key` falls within the
+// current percentage.
+func (d *DynPercentageValue) EnabledFor(key string) bool {
+	return percentageBucket(d.salt, key) < uint64(math.Round(d.Get()*percentageBuckets/100))
+}
+
+// EnabledIn implements `FeatureFlag`, bucketing EvalContexts by their user ID (see `WithBucketBy`). Unknown callers,
+// without the attribute, only have the feature enabled at 100%.
+func (d *DynPercentageValue) EnabledIn(ec *EvalContext) bool {
+	key := ec.Attribute(d.bucketBy)
+	if key == "" {
+		return d.Get() >= 100
+	}
+	return d.EnabledFor(key)
+}
+
+// Set updates the value from a string representation in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse or isn't in the [0, 100] range, or the
+// resulting value doesn't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynPercentageValue) Set(input string) error {
+	val, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(input), "%"), 64)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	if err := validPercentage(val); err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldBits := atomic.SwapUint64(&d.bits, math.Float64bits(val))
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := math.Float64frombits(oldBits)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithSalt replaces the flag name as the salt of the hash of keys. Flags sharing a salt enable features for the same
+// keys first, and changing it reshuffles which keys are enabled. It must be called before the flag is used.
+func (d *DynPercentageValue) WithSalt(salt string) *DynPercentageValue {
+	d.salt = salt
+	return d
+}
+
+// WithBucketBy sets the attribute of EvalContexts that `EnabledIn` buckets by, e.g. `TenantAttribute` to roll a
+// feature out to whole tenants at a time. Defaults to `UserIDAttribute`. It must be called before the flag is used.
+func (d *DynPercentageValue) WithBucketBy(attribute string) *DynPercentageValue {
+	d.bucketBy = attribute
+	return d
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynPercentageValue) WithValidator(validator func(float64) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynPercentageValue) WithValidatorCtx(validator func(ctx context.Context, value float64) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the [0, 100] range and the validator, e.g. to make sure that the default
+// passes them. See `ValidateAll`.
+func (d *DynPercentageValue) Validate() error {
+	if err := validPercentage(d.Get()); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynPercentageValue) WithNotifier(notifier func(oldValue float64, newValue float64)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynPercentageValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue float64, newValue float64),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynPercentageValue) Type() string {
+	return "dyn_percentage"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynPercentageValue) FormatHint() string {
+	return "percentage from 0 to 100 like 12.5 or 12.5%"
+}
+
+// String returns the canonical string representation of the type.
+func (d *DynPercentageValue) String() string {
+	return fmt.Sprintf("%v", d.Get())
+}
+
+func validPercentage(value float64) error {
+	if math.IsNaN(value) || value < 0 || value > 100 {
+		return fmt.Errorf("percentage %v not in [0, 100] range", value)
+	}
+	return nil
+}
+
+func percentageBucket(salt string, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(salt))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return h.Sum64() % percentageBuckets
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynPercentage_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynPercentage(set, "some_percentage_1", 5, "Use it or lose it")
+	assert.Equal(t, float64(5), dynFlag.Get(), "value must be default after create")
+	assert.NoError(t, set.Set("some_percentage_1", "12.5"), "setting value must succeed")
+	assert.Equal(t, float64(12.5), dynFlag.Get(), "value must be set after update")
+	assert.NoError(t, set.Set("some_percentage_1", "50%"), "values may have a percent sign")
+	assert.Equal(t, float64(50), dynFlag.Get())
+	assert.True(t, IsFlagDynamic(set.Lookup("some_percentage_1")))
+}
+
+func TestDynPercentage_RejectsValuesOutOfRange(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynPercentage(set, "some_percentage_1", 5, "Use it or lose it")
+	DynPercentage(set, "some_percentage_2", 101, "Use it or lose it")
+	for _, input := range []string{"-1", "100.1", "NaN", "ten"} {
+		err := set.Lookup("some_percentage_1").Value.Set(input)
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr), "value %v must be rejected", input)
+	}
+	assert.Error(t, set.Lookup("some_percentage_2").Value.(*DynPercentageValue).Validate(), "defaults out of range must not validate")
+}
+
+func TestDynPercentage_EnablesStableFractionOfKeys(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynPercentage(set, "some_percentage_1", 0, "Use it or lose it")
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("user-%d", i)
+	}
+	enabled := func() map[string]bool {
+		out := map[string]bool{}
+		for _, key := range keys {
+			if dynFlag.EnabledFor(key) {
+				out[key] = true
+			}
+		}
+		return out
+	}
+	assert.Empty(t, enabled(), "no keys must be enabled at 0%")
+
+	dynFlag.Set("10")
+	atTen := enabled()
+	assert.InDelta(t, 1000, len(atTen), 100, "about 10% of keys must be enabled")
+	assert.Equal(t, atTen, enabled(), "keys must keep their answers")
+
+	dynFlag.Set("30")
+	atThirty := enabled()
+	assert.InDelta(t, 3000, len(atThirty), 200, "about 30% of keys must be enabled")
+	for key := range atTen {
+		assert.True(t, atThirty[key], "raising the percentage must keep enabled keys enabled")
+	}
+
+	dynFlag.Set("100")
+	assert.Len(t, enabled(), len(keys), "all keys must be enabled at 100%")
+
+	other := DynPercentage(set, "some_percentage_2", 10, "Use it or lose it")
+	same := 0
+	for key := range atTen {
+		if other.EnabledFor(key) {
+			same++
+		}
+	}
+	assert.True(t, same < len(atTen)/2, "flags must enable different keys")
+	other.WithSalt("some_percentage_1")
+	for key := range atTen {
+		assert.True(t, other.EnabledFor(key), "flags sharing a salt must enable the same keys")
+	}
+}
+
+func TestDynPercentage_EnabledForDoesNotAllocate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynPercentage(set, "some_percentage_1", 50, "Use it or lose it")
+	assert.EqualValues(t, 0, testing.AllocsPerRun(100, func() { value.EnabledFor("user-1") }))
+}
@@ -0,0 +1,265 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynQuotaMap creates a `Flag` that represents numeric quotas by tenant (or customer) ID, which is safe to change
+// dynamically at runtime, so that quotas can be adjusted without restarts. Values are JSON objects like
+// `{"acme": 100, "globex": 2.5}` of non-negative quotas, replacing the whole map on `Set`; `Merge` changes only some
+// of the quotas.
+func DynQuotaMap(flagSet *flag.FlagSet, name string, value map[string]float64, usage string) *DynQuotaMapValue {
+	return DynQuotaMapP(flagSet, name, "", value, usage)
+}
+
+// DynQuotaMapP is like DynQuotaMap, but accepts a shorthand letter that can be used after a single dash.
+func DynQuotaMapP(flagSet *flag.FlagSet, name string, shorthand string, value map[string]float64,
+	usage string) *DynQuotaMapValue {
+	if value == nil {
+		value = map[string]float64{}
+	}
+	dynValue := &DynQuotaMapValue{ptr: unsafe.Pointer(&value)}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynQuotaMapValue is a flag-related `map[string]float64` value wrapper.
+type DynQuotaMapValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer // *map[string]float64
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set` and `Merge`.
+	known           map[string]struct{}
+	validator       func(map[string]float64) error
+	validatorCtx    func(context.Context, map[string]float64) error
+	notifier        func(oldValue map[string]float64, newValue map[string]float64)
+	notifierCtx     func(ctx context.Context, oldValue map[string]float64, newValue map[string]float64)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the value in a thread-safe manner. It must not be modified.
+func (d *DynQuotaMapValue) Get() map[string]float64 {
+	return *(*map[string]float64)(atomic.LoadPointer(&d.ptr))
+}
+
+// Quota returns the quota of `tenant`, and whether it has one.
+func (d *DynQuotaMapValue) Quota(tenant string) (float64, bool) {
+	quota, ok := d.Get()[tenant]
+	return quota, ok
+}
+
+// WithKnownTenants restricts the IDs of the tenants to `ids`, so that values with misspelled ones are rejected by
+// `Set`, `Merge` and `Validate`.
+func (d *DynQuotaMapValue) WithKnownTenants(ids ...string) *DynQuotaMapValue {
+	d.known = make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		d.known[id] = struct{}{}
+	}
+	return d
+}
+
+// Set updates the value from a JSON object of tenant IDs to quotas in a thread-safe manner, replacing all quotas.
+// This operation may return an error if the provided `input` doesn't parse, has empty, duplicate or unknown (see
+// `WithKnownTenants`) IDs or negative quotas, or doesn't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynQuotaMapValue) Set(input string) error {
+	val := map[string]float64{}
+	err := decodeJSONObject(input, "tenant", func(tenant string, decoder *json.Decoder) error {
+		quota, err := decodeQuota(decoder)
+		if err != nil {
+			return err
+		}
+		if quota == nil {
+			return fmt.Errorf("quota must be a number, not null")
+		}
+		val[tenant] = *quota
+		return nil
+	})
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	return d.store(val)
+}
+
+// Merge updates the value from a JSON merge patch (RFC 7386) in a thread-safe manner: the quotas of the tenants in
+// `patch` are set, or removed if they are null, and the others are kept, e.g. `{"acme": 200, "globex": null}`.
+// The merged value is checked like in `Set`.
+// Sources setting the flag, e.g. `watcher`, replace the merged value with the whole one they hold on their next
+// update, so patches should be applied to them too.
+func (d *DynQuotaMapValue) Merge(patch string) error {
+	quotas := map[string]*float64{}
+	err := decodeJSONObject(patch, "tenant", func(tenant string, decoder *json.Decoder) error {
+		quota, err := decodeQuota(decoder)
+		quotas[tenant] = quota
+		return err
+	})
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	old := d.Get()
+	val := make(map[string]float64, len(old)+len(quotas))
+	for tenant, quota := range old {
+		val[tenant] = quota
+	}
+	for tenant, quota := range quotas {
+		if quota == nil {
+			delete(val, tenant)
+		} else {
+			val[tenant] = *quota
+		}
+	}
+	return d.store(val)
+}
+
+// WithValidator adds a function that checks values before they're set, in addition to the checks of the quotas and
+// the known tenants, e.g. to cap quotas. Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynQuotaMapValue) WithValidator(validator func(map[string]float64) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynQuotaMapValue) WithValidatorCtx(validator func(ctx context.Context, value map[string]float64) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the checks of the quotas, the known tenants and the validator, e.g. to
+// make sure that the default passes them. See `ValidateAll`.
+func (d *DynQuotaMapValue) Validate() error {
+	for tenant, quota := range d.Get() {
+		if err := validQuota(quota); err != nil {
+			return &ValidationError{Err: fmt.Errorf("tenant %q: %v", tenant, err)}
+		}
+	}
+	if err := d.checkKnown(d.Get()); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function that is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynQuotaMapValue) WithNotifier(notifier func(oldValue map[string]float64, newValue map[string]float64)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynQuotaMapValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue map[string]float64, newValue map[string]float64),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynQuotaMapValue) Type() string {
+	return "dyn_quota_map"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynQuotaMapValue) FormatHint() string {
+	return `JSON object of quotas by tenant like {"acme": 100, "globex": 2.5}`
+}
+
+// String returns the canonical JSON representation of the value, with the tenants sorted by ID.
+func (d *DynQuotaMapValue) String() string {
+	out, err := json.Marshal(d.Get())
+	if err != nil {
+		return "ERR"
+	}
+	return string(out)
+}
+
+// store validates and stores `val`, with `setMu` held.
+func (d *DynQuotaMapValue) store(val map[string]float64) error {
+	if err := d.checkKnown(val); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*map[string]float64)(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+func (d *DynQuotaMapValue) checkKnown(value map[string]float64) error {
+	if d.known == nil {
+		return nil
+	}
+	for tenant := range value {
+		if _, ok := d.known[tenant]; !ok {
+			return fmt.Errorf("unknown tenant %q", tenant)
+		}
+	}
+	return nil
+}
+
+// decodeQuota decodes a quota, which is nil for a JSON null.
+func decodeQuota(decoder *json.Decoder) (*float64, error) {
+	var quota *float64
+	if err := decoder.Decode(&quota); err != nil {
+		return nil, err
+	}
+	if quota != nil {
+		if err := validQuota(*quota); err != nil {
+			return nil, err
+		}
+	}
+	return quota, nil
+}
+
+func validQuota(quota float64) error {
+	if math.IsNaN(quota) || math.IsInf(quota, 0) || quota < 0 {
+		return fmt.Errorf("quota %v must be a non-negative number", quota)
+	}
+	return nil
+}
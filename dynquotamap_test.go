@@ -0,0 +1,88 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynQuotaMap_SetAndQuota(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynQuotaMap(set, "some_quotas_1", map[string]float64{"acme": 10}, "Use it or lose it")
+	quota, ok := dynFlag.Quota("acme")
+	assert.True(t, ok)
+	assert.Equal(t, 10.0, quota)
+
+	require.NoError(t, set.Set("some_quotas_1", `{"globex": 2.5, "acme": 0}`))
+	assert.Equal(t, map[string]float64{"acme": 0, "globex": 2.5}, dynFlag.Get())
+	quota, ok = dynFlag.Quota("acme")
+	assert.True(t, ok, "zero quotas must be kept")
+	assert.Equal(t, 0.0, quota)
+	_, ok = dynFlag.Quota("initech")
+	assert.False(t, ok)
+	assert.Equal(t, `{"acme":0,"globex":2.5}`, dynFlag.String())
+}
+
+func TestDynQuotaMap_RejectsBadValues(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynQuotaMap(set, "some_quotas_1", map[string]float64{"acme": 10}, "Use it or lose it")
+	for _, input := range []string{
+		`not json`,
+		`{"acme": "10"}`,
+		`{"acme": -1}`,
+		`{"acme": null}`,
+		`{"acme": 1e400}`,
+		`{"": 1}`,
+		`{"acme": 1, "acme": 2}`,
+	} {
+		err := dynFlag.Set(input)
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr), "value %v must be rejected", input)
+	}
+	assert.Equal(t, map[string]float64{"acme": 10}, dynFlag.Get(), "rejected values must not be applied")
+}
+
+func TestDynQuotaMap_MergeChangesOnlyPatchedTenants(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynQuotaMap(set, "some_quotas_1", map[string]float64{"acme": 10, "globex": 20, "initech": 30},
+		"Use it or lose it")
+	notified := make(chan map[string]float64, 1)
+	dynFlag.WithNotifier(func(_ map[string]float64, newValue map[string]float64) { notified <- newValue })
+	old := dynFlag.Get()
+
+	require.NoError(t, dynFlag.Merge(`{"acme": 15, "globex": null, "hooli": 5, "umbrella": null}`))
+	assert.Equal(t, map[string]float64{"acme": 15, "initech": 30, "hooli": 5}, dynFlag.Get())
+	assert.Equal(t, map[string]float64{"acme": 10, "globex": 20, "initech": 30}, old, "old values must not change")
+	select {
+	case <-time.After(time.Second):
+		assert.Fail(t, "failed to trigger notifier")
+	case newValue := <-notified:
+		assert.Equal(t, dynFlag.Get(), newValue)
+	}
+
+	var parseErr *ParseError
+	assert.True(t, errors.As(dynFlag.Merge(`{"acme": -5}`), &parseErr))
+	assert.Equal(t, 15.0, dynFlag.Get()["acme"], "rejected patches must not be applied")
+}
+
+func TestDynQuotaMap_WithKnownTenantsRejectsTypos(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynQuotaMap(set, "some_quotas_1", map[string]float64{"acme": -1}, "Use it or lose it").
+		WithKnownTenants("acme", "globex")
+	assert.Error(t, dynFlag.Validate(), "defaults with negative quotas must not validate")
+
+	var validationErr *ValidationError
+	assert.True(t, errors.As(set.Set("some_quotas_1", `{"acmee": 1}`), &validationErr))
+	assert.True(t, errors.As(dynFlag.Merge(`{"globx": 1}`), &validationErr))
+	require.NoError(t, set.Set("some_quotas_1", `{"acme": 1}`))
+	require.NoError(t, dynFlag.Merge(`{"globex": 2}`))
+	assert.Equal(t, map[string]float64{"acme": 1, "globex": 2}, dynFlag.Get())
+	assert.NoError(t, dynFlag.Validate())
+}
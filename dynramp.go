@@ -0,0 +1,220 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// RampCurve is the shape of the transition of a `DynRamp` from its old value to a new one.
+type RampCurve int
+
+const (
+	// LinearRamp changes the value by the same amount in every moment of the ramp.
+	LinearRamp RampCurve = iota
+	// ExponentialRamp changes the value by the same factor in every moment of the ramp, e.g. doubling a rate limit
+	// as often when raising it from 100 to 1000 as from 1000 to 10000. Ramps across or from zero are linear.
+	ExponentialRamp
+)
+
+// DynRamp creates a `Flag` that represents a `float64` which is safe to change dynamically at runtime, and which
+// transitions gradually from its old value to a new one over the duration set with `WithRamp`, so that e.g. rate
+// limits and cache TTLs don't step-change across the entire fleet at once.
+//
+// The first `Set` (e.g. the initial read of an Updater) applies immediately, as a starting process has no old value
+// to transition from.
+func DynRamp(flagSet *flag.FlagSet, name string, value float64, usage string) *DynRampValue {
+	return DynRampP(flagSet, name, "", value, usage)
+}
+
+// DynRampP is like DynRamp, but accepts a shorthand letter that can be used after a single dash.
+func DynRampP(flagSet *flag.FlagSet, name string, shorthand string, value float64, usage string) *DynRampValue {
+	dynValue := &DynRampValue{now: time.Now}
+	dynValue.ptr = unsafe.Pointer(&rampState{from: value, to: value})
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynRampValue is a flag-related ramped `float64` value wrapper.
+type DynRampValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer // *rampState
+	duration        time.Duration
+	curve           RampCurve
+	now             func() time.Time
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	set             bool       // whether the value was set since creation, see `DynRamp`.
+	validator       func(float64) error
+	validatorCtx    func(context.Context, float64) error
+	notifier        func(oldValue float64, newValue float64)
+	notifierCtx     func(ctx context.Context, oldValue float64, newValue float64)
+	notifierTimeout time.Duration
+}
+
+// rampState is a transition from `from` to `to` over `duration` starting at `start`.
+type rampState struct {
+	from, to float64
+	start    time.Time
+	duration time.Duration
+	curve    RampCurve
+}
+
+// Get retrieves the current value of the ramp in a thread-safe manner, without allocations.
+func (d *DynRampValue) Get() float64 {
+	return d.load().at(d.now())
+}
+
+// Target retrieves the value the flag was last set to, which `Get` reaches at the end of the ramp.
+func (d *DynRampValue) Target() float64 {
+	return d.load().to
+}
+
+// Ramping tells whether the value is still transitioning to the Target.
+func (d *DynRampValue) Ramping() bool {
+	state := d.load()
+	return state.duration > 0 && d.now().Before(state.start.Add(state.duration))
+}
+
+// Set updates the value from a string representation in a thread-safe manner, starting a ramp from the current value.
+// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass an
+// optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine, once at the start of the ramp.
+func (d *DynRampValue) Set(input string) error {
+	val, err := strconv.ParseFloat(input, 64)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return &ParseError{Err: fmt.Errorf("value %v is not finite", val)}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	now := d.now()
+	old := d.load()
+	state := &rampState{from: old.at(now), to: val, start: now, curve: d.curve}
+	if d.set {
+		state.duration = d.duration
+	}
+	d.set = true
+	atomic.StorePointer(&d.ptr, unsafe.Pointer(state))
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := old.to
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithRamp sets the duration and curve of the transitions to new values. Without it, values change immediately.
+// It must be called before the flag is used.
+func (d *DynRampValue) WithRamp(duration time.Duration, curve RampCurve) *DynRampValue {
+	d.duration = duration
+	d.curve = curve
+	return d
+}
+
+// WithValidator adds a function that checks values before they're set. It checks the Targets, not the values in the
+// middle of a ramp. Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynRampValue) WithValidator(validator func(float64) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynRampValue) WithValidatorCtx(validator func(ctx context.Context, value float64) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the Target against the validator, e.g. to make sure that the default passes it.
+// See `ValidateAll`.
+func (d *DynRampValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Target()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Target()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set, with the old and new Targets.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynRampValue) WithNotifier(notifier func(oldValue float64, newValue float64)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynRampValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue float64, newValue float64),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynRampValue) Type() string {
+	return "dyn_ramp"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynRampValue) FormatHint() string {
+	return "number like 0.25"
+}
+
+// String returns the canonical string representation of the Target, i.e. the value the flag was set to.
+func (d *DynRampValue) String() string {
+	return fmt.Sprintf("%v", d.Target())
+}
+
+func (d *DynRampValue) load() *rampState {
+	return (*rampState)(atomic.LoadPointer(&d.ptr))
+}
+
+func (s *rampState) at(now time.Time) float64 {
+	if s.duration <= 0 || !now.Before(s.start.Add(s.duration)) {
+		return s.to
+	}
+	progress := float64(now.Sub(s.start)) / float64(s.duration)
+	if progress <= 0 {
+		return s.from
+	}
+	if s.curve == ExponentialRamp && s.from*s.to > 0 {
+		return s.from * math.Pow(s.to/s.from, progress)
+	}
+	return s.from + (s.to-s.from)*progress
+}
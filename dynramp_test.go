@@ -0,0 +1,86 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestRamp(t *testing.T, curve RampCurve) (*DynRampValue, *fakeClock) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	dynFlag := DynRamp(set, "some_ramp_1", 10, "Use it or lose it").WithRamp(10*time.Second, curve)
+	dynFlag.now = clock.now
+	assert.True(t, IsFlagDynamic(set.Lookup("some_ramp_1")))
+	return dynFlag, clock
+}
+
+func TestDynRamp_FirstSetAppliesImmediately(t *testing.T) {
+	dynFlag, _ := newTestRamp(t, LinearRamp)
+	assert.Equal(t, float64(10), dynFlag.Get(), "value must be default after create")
+	require.NoError(t, dynFlag.Set("100"))
+	assert.Equal(t, float64(100), dynFlag.Get(), "the first set must not ramp")
+	assert.False(t, dynFlag.Ramping())
+}
+
+func TestDynRamp_Linear(t *testing.T) {
+	dynFlag, clock := newTestRamp(t, LinearRamp)
+	require.NoError(t, dynFlag.Set("100"))
+	require.NoError(t, dynFlag.Set("200"))
+	assert.Equal(t, float64(100), dynFlag.Get(), "ramps must start from the old value")
+	assert.Equal(t, float64(200), dynFlag.Target())
+	assert.Equal(t, "200", dynFlag.String(), "the target must be shown")
+	assert.True(t, dynFlag.Ramping())
+
+	clock.t = clock.t.Add(2500 * time.Millisecond)
+	assert.InDelta(t, 125, dynFlag.Get(), 1e-9)
+	clock.t = clock.t.Add(2500 * time.Millisecond)
+	assert.InDelta(t, 150, dynFlag.Get(), 1e-9)
+
+	require.NoError(t, dynFlag.Set("50"), "ramps must be restartable midway")
+	assert.InDelta(t, 150, dynFlag.Get(), 1e-9, "new ramps must start from the current value")
+	clock.t = clock.t.Add(5 * time.Second)
+	assert.InDelta(t, 100, dynFlag.Get(), 1e-9)
+	clock.t = clock.t.Add(5 * time.Second)
+	assert.Equal(t, float64(50), dynFlag.Get())
+	assert.False(t, dynFlag.Ramping())
+}
+
+func TestDynRamp_Exponential(t *testing.T) {
+	dynFlag, clock := newTestRamp(t, ExponentialRamp)
+	require.NoError(t, dynFlag.Set("100"))
+	require.NoError(t, dynFlag.Set("10000"))
+	clock.t = clock.t.Add(5 * time.Second)
+	assert.InDelta(t, 1000, dynFlag.Get(), 1e-6, "exponential ramps must change by the same factor")
+
+	require.NoError(t, dynFlag.Set("-100"))
+	clock.t = clock.t.Add(5 * time.Second)
+	assert.InDelta(t, 450, dynFlag.Get(), 1e-6, "ramps across zero must be linear")
+}
+
+func TestDynRamp_RejectsInvalidValues(t *testing.T) {
+	dynFlag, _ := newTestRamp(t, LinearRamp)
+	assert.Error(t, dynFlag.Set("NaN"))
+	assert.Error(t, dynFlag.Set("fast"))
+	dynFlag.WithValidator(func(v float64) error {
+		if v > 1000 {
+			return assert.AnError
+		}
+		return nil
+	})
+	assert.Error(t, dynFlag.Set("1001"))
+	assert.Equal(t, float64(10), dynFlag.Get())
+	assert.NoError(t, dynFlag.Validate())
+}
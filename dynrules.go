@@ -0,0 +1,399 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// RuleSet is the document of a `DynRules` flag, e.g.
+//
+//	{
+//	  "rules": [
+//	    {"when": {"attribute": "tenant", "in": ["acme"]}, "enabled": true},
+//	    {"when": {"all": [{"attribute": "region", "in": ["eu"]}, {"attribute": "plan", "not_in": ["free"]}]},
+//	     "percentage": 25}
+//	  ],
+//	  "default": {"enabled": false}
+//	}
+//
+// The outcome of the first rule matching the EvalContext decides whether the feature is enabled for it, falling
+// through to the Default if none matches.
+type RuleSet struct {
+	Rules []Rule `json:"rules,omitempty"`
+	// Default is the outcome for EvalContexts that match none of the rules. It disables the feature if empty.
+	Default Outcome `json:"default"`
+	// Salt of the hash of percentage outcomes, defaulting to the flag name. See `DynPercentageValue.WithSalt`.
+	Salt string `json:"salt,omitempty"`
+}
+
+// Rule enables the feature (or a percentage of it) for EvalContexts matching its condition.
+type Rule struct {
+	// Name optionally identifies the rule, e.g. in the error messages of validation.
+	Name string    `json:"name,omitempty"`
+	When Condition `json:"when"`
+	Outcome
+}
+
+// Outcome of a Rule, either with Enabled for all of the matching EvalContexts, or a Percentage of them.
+type Outcome struct {
+	Enabled    *bool    `json:"enabled,omitempty"`
+	Percentage *float64 `json:"percentage,omitempty"`
+	// BucketBy is the attribute percentages bucket EvalContexts by, defaulting to the `UserIDAttribute`.
+	BucketBy string `json:"bucket_by,omitempty"`
+}
+
+// Condition matches EvalContexts either by Attribute (if its value is In or NotIn a list), or by All or Any of a list
+// of conditions.
+type Condition struct {
+	Attribute string      `json:"attribute,omitempty"`
+	In        []string    `json:"in,omitempty"`
+	NotIn     []string    `json:"not_in,omitempty"`
+	All       []Condition `json:"all,omitempty"`
+	Any       []Condition `json:"any,omitempty"`
+}
+
+// DynRules creates a `Flag` that represents a RuleSet targeting a feature at EvalContexts, which is safe to change
+// dynamically at runtime. Values are JSON RuleSets, which are validated and compiled by `Set`, so evaluating them with
+// `EnabledIn` is cheap. A nil `value` disables the feature for everyone.
+func DynRules(flagSet *flag.FlagSet, name string, value *RuleSet, usage string) *DynRulesValue {
+	return DynRulesP(flagSet, name, "", value, usage)
+}
+
+// DynRulesP is like DynRules, but accepts a shorthand letter that can be used after a single dash.
+func DynRulesP(flagSet *flag.FlagSet, name string, shorthand string, value *RuleSet, usage string) *DynRulesValue {
+	if value == nil {
+		value = &RuleSet{}
+	}
+	compiled, err := compileRuleSet(value, name)
+	if err != nil {
+		// an invalid default disables the feature for everyone, and is reported by `Validate`.
+		compiled = &compiledRuleSet{source: value, salt: name}
+	}
+	dynValue := &DynRulesValue{name: name, ptr: unsafe.Pointer(compiled), defaultErr: err}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynRulesValue is a flag-related RuleSet value wrapper.
+type DynRulesValue struct {
+	dynChangeTime
+
+	name            string
+	ptr             unsafe.Pointer // *compiledRuleSet
+	defaultErr      error          // of compiling the default, returned by `Validate` until the first `Set`.
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`.
+	validator       func(*RuleSet) error
+	validatorCtx    func(context.Context, *RuleSet) error
+	notifier        func(oldValue *RuleSet, newValue *RuleSet)
+	notifierCtx     func(ctx context.Context, oldValue *RuleSet, newValue *RuleSet)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the RuleSet in a thread-safe manner. It must not be modified.
+func (d *DynRulesValue) Get() *RuleSet {
+	return d.load().source
+}
+
+// EnabledIn implements `FeatureFlag`, evaluating the RuleSet for `ec`.
+func (d *DynRulesValue) EnabledIn(ec *EvalContext) bool {
+	return d.load().enabledIn(ec)
+}
+
+// Set updates the value from a JSON RuleSet in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, isn't a valid RuleSet, or doesn't pass
+// an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynRulesValue) Set(input string) error {
+	rules := &RuleSet{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(input)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(rules); err != nil {
+		return &ParseError{Err: err}
+	}
+	compiled, err := compileRuleSet(rules, d.name)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(rules); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, rules) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(compiled))
+	d.defaultErr = nil
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := (*compiledRuleSet)(oldPtr).source
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, rules) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, rules) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set, in addition to the structural checks of the
+// RuleSet. Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynRulesValue) WithValidator(validator func(*RuleSet) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynRulesValue) WithValidatorCtx(validator func(ctx context.Context, value *RuleSet) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the structural checks and the validator, e.g. to make sure that the
+// default passes them. See `ValidateAll`.
+func (d *DynRulesValue) Validate() error {
+	d.setMu.Lock()
+	defaultErr := d.defaultErr
+	d.setMu.Unlock()
+	if defaultErr != nil {
+		return &ValidationError{Err: defaultErr}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynRulesValue) WithNotifier(notifier func(oldValue *RuleSet, newValue *RuleSet)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynRulesValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue *RuleSet, newValue *RuleSet),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynRulesValue) Type() string {
+	return "dyn_rules"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynRulesValue) FormatHint() string {
+	return "JSON rule set"
+}
+
+// String returns the canonical JSON representation of the RuleSet.
+func (d *DynRulesValue) String() string {
+	out, err := json.Marshal(d.Get())
+	if err != nil {
+		return "ERR"
+	}
+	return string(out)
+}
+
+func (d *DynRulesValue) load() *compiledRuleSet {
+	return (*compiledRuleSet)(atomic.LoadPointer(&d.ptr))
+}
+
+// compiledRuleSet is a validated RuleSet with the lists of conditions turned into sets.
+type compiledRuleSet struct {
+	source       *RuleSet
+	salt         string
+	rules        []compiledRule
+	defaultServe compiledOutcome
+}
+
+type compiledRule struct {
+	when  *compiledCondition
+	serve compiledOutcome
+}
+
+type compiledOutcome struct {
+	enabled  bool
+	buckets  uint64 // of percentageBuckets enabled, if a percentage.
+	bucketBy string // empty if not a percentage.
+}
+
+type compiledCondition struct {
+	attribute string
+	in        map[string]struct{}
+	notIn     map[string]struct{}
+	all       []*compiledCondition
+	any       []*compiledCondition
+}
+
+func compileRuleSet(rules *RuleSet, name string) (*compiledRuleSet, error) {
+	compiled := &compiledRuleSet{source: rules, salt: rules.Salt}
+	if compiled.salt == "" {
+		compiled.salt = name
+	}
+	for i, rule := range rules.Rules {
+		ruleName := rule.Name
+		if ruleName == "" {
+			ruleName = fmt.Sprintf("#%d", i)
+		}
+		when, err := compileCondition(&rule.When)
+		if err != nil {
+			return nil, fmt.Errorf("rule %v: %v", ruleName, err)
+		}
+		serve, err := compileOutcome(&rule.Outcome, false)
+		if err != nil {
+			return nil, fmt.Errorf("rule %v: %v", ruleName, err)
+		}
+		compiled.rules = append(compiled.rules, compiledRule{when: when, serve: serve})
+	}
+	defaultServe, err := compileOutcome(&rules.Default, true)
+	if err != nil {
+		return nil, fmt.Errorf("default: %v", err)
+	}
+	compiled.defaultServe = defaultServe
+	return compiled, nil
+}
+
+func compileOutcome(outcome *Outcome, optional bool) (compiledOutcome, error) {
+	switch {
+	case outcome.Enabled != nil && outcome.Percentage != nil:
+		return compiledOutcome{}, fmt.Errorf("outcome must have either enabled or percentage, not both")
+	case outcome.Enabled != nil:
+		return compiledOutcome{enabled: *outcome.Enabled}, nil
+	case outcome.Percentage != nil:
+		if err := validPercentage(*outcome.Percentage); err != nil {
+			return compiledOutcome{}, err
+		}
+		bucketBy := outcome.BucketBy
+		if bucketBy == "" {
+			bucketBy = UserIDAttribute
+		}
+		buckets := uint64(math.Round(*outcome.Percentage * percentageBuckets / 100))
+		return compiledOutcome{buckets: buckets, bucketBy: bucketBy}, nil
+	case optional:
+		return compiledOutcome{}, nil
+	}
+	return compiledOutcome{}, fmt.Errorf("outcome must have enabled or percentage")
+}
+
+func compileCondition(condition *Condition) (*compiledCondition, error) {
+	kinds := 0
+	for _, present := range []bool{condition.Attribute != "", len(condition.All) > 0, len(condition.Any) > 0} {
+		if present {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, fmt.Errorf("condition must have exactly one of attribute, all or any")
+	}
+	compiled := &compiledCondition{attribute: condition.Attribute}
+	if condition.Attribute != "" {
+		if (len(condition.In) > 0) == (len(condition.NotIn) > 0) {
+			return nil, fmt.Errorf("condition on attribute %v must have either in or not_in", condition.Attribute)
+		}
+		compiled.in = stringSet(condition.In)
+		compiled.notIn = stringSet(condition.NotIn)
+		return compiled, nil
+	}
+	for i := range condition.All {
+		c, err := compileCondition(&condition.All[i])
+		if err != nil {
+			return nil, err
+		}
+		compiled.all = append(compiled.all, c)
+	}
+	for i := range condition.Any {
+		c, err := compileCondition(&condition.Any[i])
+		if err != nil {
+			return nil, err
+		}
+		compiled.any = append(compiled.any, c)
+	}
+	return compiled, nil
+}
+
+func stringSet(values []string) map[string]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+	out := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		out[value] = struct{}{}
+	}
+	return out
+}
+
+func (c *compiledRuleSet) enabledIn(ec *EvalContext) bool {
+	for _, rule := range c.rules {
+		if rule.when.matches(ec) {
+			return rule.serve.enabledIn(ec, c.salt)
+		}
+	}
+	return c.defaultServe.enabledIn(ec, c.salt)
+}
+
+func (o *compiledOutcome) enabledIn(ec *EvalContext, salt string) bool {
+	if o.bucketBy == "" {
+		return o.enabled
+	}
+	key := ec.Attribute(o.bucketBy)
+	if key == "" {
+		// unknown callers only have the feature enabled at 100%.
+		return o.buckets >= percentageBuckets
+	}
+	return percentageBucket(salt, key) < o.buckets
+}
+
+func (c *compiledCondition) matches(ec *EvalContext) bool {
+	switch {
+	case c.attribute != "" && c.in != nil:
+		_, ok := c.in[ec.Attribute(c.attribute)]
+		return ok
+	case c.attribute != "":
+		_, ok := c.notIn[ec.Attribute(c.attribute)]
+		return !ok
+	case c.all != nil:
+		for _, condition := range c.all {
+			if !condition.matches(ec) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, condition := range c.any {
+		if condition.matches(ec) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const someRules = `{
+  "rules": [
+    {"name": "beta tenants", "when": {"attribute": "tenant", "in": ["acme"]}, "enabled": true},
+    {"when": {"attribute": "tenant", "in": ["banned"]}, "enabled": false},
+    {"when": {"all": [{"attribute": "region", "in": ["eu"]}, {"attribute": "plan", "not_in": ["free"]}]},
+     "percentage": 100},
+    {"when": {"any": [{"attribute": "region", "in": ["us"]}, {"attribute": "plan", "in": ["pro"]}]},
+     "percentage": 0}
+  ],
+  "default": {"percentage": 50}
+}`
+
+func TestDynRules_EvaluatesRulesInOrder(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynRules(set, "some_rules_1", nil, "Use it or lose it")
+	assert.False(t, dynFlag.EnabledIn(&EvalContext{Tenant: "acme"}), "nil defaults must disable the feature")
+	require.NoError(t, set.Set("some_rules_1", someRules))
+
+	assert.True(t, dynFlag.EnabledIn(&EvalContext{Tenant: "acme", Region: "us"}), "the first matching rule must win")
+	assert.False(t, dynFlag.EnabledIn(&EvalContext{Tenant: "banned", Region: "eu"}))
+	pro, free := map[string]string{"plan": "pro"}, map[string]string{"plan": "free"}
+	assert.True(t, dynFlag.EnabledIn(&EvalContext{Region: "eu", Attributes: pro}), "all must match")
+	assert.False(t, dynFlag.EnabledIn(&EvalContext{Region: "asia", Attributes: pro}), "any must match")
+	assert.False(t, dynFlag.EnabledIn(&EvalContext{Region: "eu", Attributes: free}))
+	assert.False(t, dynFlag.EnabledIn(nil), "unknown callers must not fall into percentages below 100")
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		if dynFlag.EnabledIn(&EvalContext{UserID: fmt.Sprintf("user-%d", i)}) {
+			enabled++
+		}
+	}
+	assert.InDelta(t, 500, enabled, 60, "about half of the others must fall through to the default percentage")
+	assert.Equal(t, "beta tenants", dynFlag.Get().Rules[0].Name)
+}
+
+func TestDynRules_RejectsInvalidRuleSets(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynRules(set, "some_rules_1", nil, "Use it or lose it")
+	for _, input := range []string{
+		`not json`,
+		`{"rulez": []}`,
+		`{"rules": [{"when": {"attribute": "tenant", "in": ["a"]}}]}`,
+		`{"rules": [{"when": {"attribute": "tenant", "in": ["a"]}, "enabled": true, "percentage": 5}]}`,
+		`{"rules": [{"when": {"attribute": "tenant"}, "enabled": true}]}`,
+		`{"rules": [{"when": {"attribute": "tenant", "in": ["a"], "all": [{"attribute": "a", "in": ["b"]}]}, "enabled": true}]}`,
+		`{"rules": [{"when": {"all": [{"attribute": "region"}]}, "enabled": true}]}`,
+		`{"default": {"percentage": 101}}`,
+	} {
+		err := dynFlag.Set(input)
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr), "value %v must be rejected", input)
+	}
+	assert.Empty(t, dynFlag.Get().Rules, "rejected values must not be applied")
+}
+
+func TestDynRules_ValidatesDefaults(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	percentage := 200.0
+	defaults := &RuleSet{Default: Outcome{Percentage: &percentage}}
+	dynFlag := DynRules(set, "some_rules_1", defaults, "Use it or lose it")
+	assert.Error(t, dynFlag.Validate(), "invalid defaults must not validate")
+	assert.False(t, dynFlag.EnabledIn(&EvalContext{UserID: "user-1"}), "invalid defaults must disable the feature")
+	require.NoError(t, dynFlag.Set(`{"default": {"enabled": true}}`))
+	assert.NoError(t, dynFlag.Validate())
+	assert.True(t, dynFlag.EnabledIn(nil))
+	assert.Equal(t, `{"default":{"enabled":true}}`, dynFlag.String())
+}
+
+func TestDynRules_EnabledInDoesNotAllocate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynRules(set, "some_rules_1", nil, "Use it or lose it")
+	require.NoError(t, dynFlag.Set(someRules))
+	ec := &EvalContext{UserID: "user-1", Region: "eu", Attributes: map[string]string{"plan": "free"}}
+	assert.EqualValues(t, 0, testing.AllocsPerRun(100, func() { dynFlag.EnabledIn(ec) }))
+}
@@ -0,0 +1,269 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// SamplingRates are the fractions of events (e.g. traces or log lines) to sample, overall and per category.
+type SamplingRates struct {
+	// Overall is the rate of events of categories without a rate of their own, in the [0, 1] range.
+	Overall float64
+	// Categories are the rates of events of specific categories, e.g. span names or log levels, in the [0, 1] range.
+	Categories map[string]float64
+}
+
+// DynSamplingRate creates a `Flag` that represents SamplingRates, which is safe to change dynamically at runtime, so
+// that the volume of traces and logs can be dialed up during incidents without a deploy. Values are the overall rate
+// followed by comma-separated `category:rate` pairs, e.g. `0.01,checkout:0.5,healthz:0`.
+//
+// Samplers of tracers and loggers reading the latest rates on every event are in `flagzotel` and `flagzlog`; use
+// `Sample` and `SampleKey` for others.
+func DynSamplingRate(flagSet *flag.FlagSet, name string, value SamplingRates, usage string) *DynSamplingRateValue {
+	return DynSamplingRateP(flagSet, name, "", value, usage)
+}
+
+// DynSamplingRateP is like DynSamplingRate, but accepts a shorthand letter that can be used after a single dash.
+func DynSamplingRateP(flagSet *flag.FlagSet, name string, shorthand string, value SamplingRates,
+	usage string) *DynSamplingRateValue {
+	dynValue := &DynSamplingRateValue{ptr: unsafe.Pointer(&value), salt: name}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynSamplingRateValue is a flag-related SamplingRates value wrapper.
+type DynSamplingRateValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer // *SamplingRates
+	salt            string
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func(SamplingRates) error
+	validatorCtx    func(context.Context, SamplingRates) error
+	notifier        func(oldValue SamplingRates, newValue SamplingRates)
+	notifierCtx     func(ctx context.Context, oldValue SamplingRates, newValue SamplingRates)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the SamplingRates in a thread-safe manner. Their Categories must not be modified.
+func (d *DynSamplingRateValue) Get() SamplingRates {
+	return *(*SamplingRates)(atomic.LoadPointer(&d.ptr))
+}
+
+// Rate returns the current sampling rate of events of `category`, or the overall rate if it has none, without
+// allocations.
+func (d *DynSamplingRateValue) Rate(category string) float64 {
+	rates := (*SamplingRates)(atomic.LoadPointer(&d.ptr))
+	if rate, ok := rates.Categories[category]; ok {
+		return rate
+	}
+	return rates.Overall
+}
+
+// Sample tells whether to sample an event of `category`, at random with its current Rate.
+func (d *DynSamplingRateValue) Sample(category string) bool {
+	rate := d.Rate(category)
+	return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+}
+
+// SampleKey is like `Sample`, but deterministic for `key` (e.g. a request ID), so that all events of a key are sampled
+// together. Raising the rate only adds keys to the sampled ones. Keys are hashed with the flag name as salt.
+func (d *DynSamplingRateValue) SampleKey(category string, key string) bool {
+	return samplingUniform(d.salt, key) < d.Rate(category)
+}
+
+// Set updates the value from a string representation in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, has no overall rate, duplicate categories
+// or rates outside the [0, 1] range, or the resulting value doesn't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynSamplingRateValue) Set(input string) error {
+	val, err := parseSamplingRates(input)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*SamplingRates)(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithSalt replaces the flag name as the salt of the hash of keys of `SampleKey`. It must be called before the flag is
+// used.
+func (d *DynSamplingRateValue) WithSalt(salt string) *DynSamplingRateValue {
+	d.salt = salt
+	return d
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynSamplingRateValue) WithValidator(validator func(SamplingRates) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynSamplingRateValue) WithValidatorCtx(validator func(ctx context.Context, value SamplingRates) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the [0, 1] range and the validator, e.g. to make sure that the default
+// passes them. See `ValidateAll`.
+func (d *DynSamplingRateValue) Validate() error {
+	if err := validSamplingRates(d.Get()); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set, e.g. to reconfigure samplers
+// that don't read the rates on every event.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynSamplingRateValue) WithNotifier(notifier func(oldValue SamplingRates, newValue SamplingRates)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynSamplingRateValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue SamplingRates, newValue SamplingRates), timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynSamplingRateValue) Type() string {
+	return "dyn_sampling_rate"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynSamplingRateValue) FormatHint() string {
+	return "overall rate and category:rate pairs like 0.01,checkout:0.5"
+}
+
+// String returns the canonical string representation of the type, with the categories in alphabetical order.
+func (d *DynSamplingRateValue) String() string {
+	rates := d.Get()
+	categories := make([]string, 0, len(rates.Categories))
+	for category := range rates.Categories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	parts := []string{strconv.FormatFloat(rates.Overall, 'g', -1, 64)}
+	for _, category := range categories {
+		parts = append(parts, category+":"+strconv.FormatFloat(rates.Categories[category], 'g', -1, 64))
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseSamplingRates(input string) (SamplingRates, error) {
+	rates := SamplingRates{Categories: make(map[string]float64)}
+	hasOverall := false
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		category, rateText := "", part
+		if idx := strings.LastIndex(part, ":"); idx >= 0 {
+			category, rateText = strings.TrimSpace(part[:idx]), strings.TrimSpace(part[idx+1:])
+			if category == "" {
+				return SamplingRates{}, fmt.Errorf("rate %q must be in category:rate form", part)
+			}
+		}
+		rate, err := strconv.ParseFloat(rateText, 64)
+		if err != nil {
+			return SamplingRates{}, fmt.Errorf("rate %q: %v", part, err)
+		}
+		if category == "" {
+			if hasOverall {
+				return SamplingRates{}, fmt.Errorf("duplicate overall rate %q", part)
+			}
+			rates.Overall, hasOverall = rate, true
+			continue
+		}
+		if _, ok := rates.Categories[category]; ok {
+			return SamplingRates{}, fmt.Errorf("duplicate rate of category %v", category)
+		}
+		rates.Categories[category] = rate
+	}
+	if !hasOverall {
+		return SamplingRates{}, fmt.Errorf("the overall rate must be set, e.g. 0.01,%v", strings.TrimSpace(input))
+	}
+	return rates, validSamplingRates(rates)
+}
+
+func validSamplingRates(rates SamplingRates) error {
+	if math.IsNaN(rates.Overall) || rates.Overall < 0 || rates.Overall > 1 {
+		return fmt.Errorf("overall rate %v not in [0, 1] range", rates.Overall)
+	}
+	for category, rate := range rates.Categories {
+		if math.IsNaN(rate) || rate < 0 || rate > 1 {
+			return fmt.Errorf("rate %v of category %v not in [0, 1] range", rate, category)
+		}
+	}
+	return nil
+}
+
+// samplingUniform hashes `key` into a uniform value in [0, 1).
+func samplingUniform(salt string, key string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(salt))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	// mixed like in `rendezvousScore`, as the high bits of FNV barely depend on the last bytes.
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynSamplingRate_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynSamplingRate(set, "some_sampling_1", SamplingRates{Overall: 0.5}, "Use it or lose it")
+	assert.Equal(t, 0.5, dynFlag.Rate("checkout"))
+	require.NoError(t, set.Set("some_sampling_1", "0.01, healthz:0, checkout:0.5"))
+	assert.Equal(t, 0.01, dynFlag.Rate("search"), "categories without a rate must use the overall rate")
+	assert.Equal(t, 0.5, dynFlag.Rate("checkout"))
+	assert.Equal(t, 0.0, dynFlag.Rate("healthz"))
+	assert.Equal(t, "0.01,checkout:0.5,healthz:0", dynFlag.String())
+	assert.Equal(t, SamplingRates{Overall: 0.01, Categories: map[string]float64{"checkout": 0.5, "healthz": 0}},
+		dynFlag.Get())
+}
+
+func TestDynSamplingRate_RejectsBadRates(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynSamplingRate(set, "some_sampling_1", SamplingRates{Overall: 0.5}, "Use it or lose it")
+	for _, input := range []string{"", "checkout:0.5", "1.5", "-0.1", "NaN", "0.1,0.2", "0.1,a:0.1,a:0.2", "0.1,:0.2",
+		"0.1,a:b", "0.1,a:2"} {
+		err := dynFlag.Set(input)
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr), "value %q must be rejected", input)
+	}
+	assert.Equal(t, "0.5", dynFlag.String(), "rejected values must not be applied")
+}
+
+func TestDynSamplingRate_Samples(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynSamplingRate(set, "some_sampling_1", SamplingRates{Overall: 0.2}, "Use it or lose it")
+	sampled, sampledKeys := 0, 0
+	for i := 0; i < 1000; i++ {
+		if dynFlag.Sample("any") {
+			sampled++
+		}
+		if dynFlag.SampleKey("any", fmt.Sprintf("request-%d", i)) {
+			sampledKeys++
+		}
+	}
+	assert.InDelta(t, 200, sampled, 60)
+	assert.InDelta(t, 200, sampledKeys, 60)
+
+	assert.Equal(t, dynFlag.SampleKey("any", "request-7"), dynFlag.SampleKey("other", "request-7"),
+		"keys must be sampled consistently")
+	require.NoError(t, set.Set("some_sampling_1", "1,healthz:0"))
+	assert.True(t, dynFlag.Sample("any"))
+	assert.True(t, dynFlag.SampleKey("any", "request-7"))
+	assert.False(t, dynFlag.Sample("healthz"))
+	assert.False(t, dynFlag.SampleKey("healthz", "request-7"))
+}
+
+func TestDynSamplingRate_ValidatesDefaults(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynSamplingRate(set, "some_sampling_1", SamplingRates{Overall: 2}, "Use it or lose it")
+	assert.Error(t, dynFlag.Validate(), "invalid defaults must not validate")
+	require.NoError(t, dynFlag.Set("1"))
+	assert.NoError(t, dynFlag.Validate())
+}
+
+func TestDynSamplingRate_Notifier(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynSamplingRate(set, "some_sampling_1", SamplingRates{Overall: 0.1}, "Use it or lose it")
+	notified := make(chan [2]float64, 1)
+	dynFlag.WithNotifier(func(oldValue SamplingRates, newValue SamplingRates) {
+		notified <- [2]float64{oldValue.Overall, newValue.Overall}
+	})
+	require.NoError(t, set.Set("some_sampling_1", "0.9"))
+	assert.Equal(t, [2]float64{0.1, 0.9}, <-notified)
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DynSecret creates a `Flag` that represents a secret `string`, e.g. a credential, which is safe to change
+// dynamically at runtime. The flag is marked as secret (see `MarkFlagSecret`), and its `String` is always the
+// `RedactedValue`, so the plaintext is only ever held in memory and returned by `Get`.
+//
+// Store its values encrypted in the backend, and configure the Updater with a `Decrypter`, to rotate credentials
+// through the same pipeline as all other flags.
+func DynSecret(flagSet *flag.FlagSet, name string, value string, usage string) *DynSecretValue {
+	return DynSecretP(flagSet, name, "", value, usage)
+}
+
+// DynSecretP is like DynSecret, but accepts a shorthand letter that can be used after a single dash.
+func DynSecretP(flagSet *flag.FlagSet, name string, shorthand string, value string, usage string) *DynSecretValue {
+	dynValue := &DynSecretValue{ptr: unsafe.Pointer(&value)}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	MarkFlagSecret(flag)
+	return dynValue
+}
+
+// DynSecretValue is a flag-related secret `string` value wrapper.
+type DynSecretValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func(string) error
+	validatorCtx    func(context.Context, string) error
+	notifier        func(oldValue string, newValue string)
+	notifierCtx     func(ctx context.Context, oldValue string, newValue string)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the plaintext in a thread-safe manner.
+func (d *DynSecretValue) Get() string {
+	p := (*string)(atomic.LoadPointer(&d.ptr))
+	return *p
+}
+
+// Set updates the value in a thread-safe manner.
+// This operation may return an error if the value doesn't pass an optional validator. Errors of validators shouldn't
+// contain the value.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynSecretValue) Set(val string) error {
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*string)(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynSecretValue) WithValidator(validator func(string) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynSecretValue) WithValidatorCtx(validator func(ctx context.Context, value string) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `ValidateAll`.
+func (d *DynSecretValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set, e.g. to reconnect with rotated
+// credentials.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynSecretValue) WithNotifier(notifier func(oldValue string, newValue string)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynSecretValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue string, newValue string),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynSecretValue) Type() string {
+	return "dyn_secret"
+}
+
+// String always returns the `RedactedValue`, never the plaintext.
+func (d *DynSecretValue) String() string {
+	return RedactedValue
+}
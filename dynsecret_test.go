@@ -0,0 +1,48 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynSecret_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynSecret(set, "some_secret_1", "hunter2", "Use it or lose it")
+	assert.Equal(t, "hunter2", dynFlag.Get(), "value must be default after create")
+	assert.NoError(t, set.Set("some_secret_1", "correcthorse"), "setting value must succeed")
+	assert.Equal(t, "correcthorse", dynFlag.Get(), "value must be set after update")
+}
+
+func TestDynSecret_NeverShowsPlaintext(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynSecret(set, "some_secret_1", "hunter2", "Use it or lose it")
+	set.Set("some_secret_1", "correcthorse")
+	f := set.Lookup("some_secret_1")
+	assert.True(t, IsFlagDynamic(f))
+	assert.True(t, IsFlagSecret(f))
+	assert.Equal(t, RedactedValue, f.Value.String())
+	assert.Equal(t, RedactedValue, f.DefValue, "the default must not be shown in usage")
+	assert.False(t, strings.Contains(set.FlagUsages(), "hunter2"))
+}
+
+func TestDynSecret_FiresValidators(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynSecret(set, "some_secret_1", "hunter2", "Use it or lose it").WithValidator(func(value string) error {
+		if len(value) < 8 {
+			return errors.New("secret too short")
+		}
+		return nil
+	})
+	assert.NoError(t, set.Set("some_secret_1", "correcthorse"), "no error from validator when long enough")
+	err := SetFlagFromSource(set, "some_secret_1", "short", "test")
+	var validation *ValidationError
+	assert.True(t, errors.As(err, &validation), "error from validator when too short")
+	assert.NotContains(t, err.Error(), "short")
+}
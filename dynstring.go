@@ -4,9 +4,12 @@
 package flagz
 
 import (
+	"context"
 	"fmt"
 	"regexp"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	flag "github.com/spf13/pflag"
@@ -14,20 +17,31 @@ import (
 
 // DynString creates a `Flag` that represents `string` which is safe to change dynamically at runtime.
 func DynString(flagSet *flag.FlagSet, name string, value string, usage string) *DynStringValue {
+	return DynStringP(flagSet, name, "", value, usage)
+}
+
+// DynStringP is like DynString, but accepts a shorthand letter that can be used after a single dash.
+func DynStringP(flagSet *flag.FlagSet, name string, shorthand string, value string, usage string) *DynStringValue {
 	dynValue := &DynStringValue{ptr: unsafe.Pointer(&value)}
-	flag := flagSet.VarPF(dynValue, name, "", usage)
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
 	MarkFlagDynamic(flag)
 	return dynValue
 }
 
 // DynStringValue is a flag-related `time.Duration` value wrapper.
 type DynStringValue struct {
-	ptr       unsafe.Pointer
-	validator func(string) error
-	notifier  func(oldValue string, newValue string)
+	dynChangeTime
+
+	ptr             unsafe.Pointer
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func(string) error
+	validatorCtx    func(context.Context, string) error
+	notifier        func(oldValue string, newValue string)
+	notifierCtx     func(ctx context.Context, oldValue string, newValue string)
+	notifierTimeout time.Duration
 }
 
-// Get retrieves the value in a thread-safe manner.
+// Get retrieves the value in a thread-safe manner, with a single atomic load of the stored string and no allocations.
 func (d *DynStringValue) Get() string {
 	p := (*string)(atomic.LoadPointer(&d.ptr))
 	return *p
@@ -38,14 +52,30 @@ func (d *DynStringValue) Get() string {
 // optional validator.
 // If a notifier is set on the value, it will be invoked in a separate go-routine.
 func (d *DynStringValue) Set(val string) error {
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
 	if d.validator != nil {
 		if err := d.validator(val); err != nil {
-			return err
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
 		}
 	}
 	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
-	if d.notifier != nil {
-		go d.notifier(*(*string)(oldPtr), val)
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*string)(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
 	}
 	return nil
 }
@@ -57,12 +87,43 @@ func (d *DynStringValue) WithValidator(validator func(string) error) {
 	d.validator = validator
 }
 
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynStringValue) WithValidatorCtx(validator func(ctx context.Context, value string) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `ValidateAll`.
+func (d *DynStringValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
 // WithNotifier adds a function is called every time a new value is successfully set.
-// Each notifier is executed in a new go-routine.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
 func (d *DynStringValue) WithNotifier(notifier func(oldValue string, newValue string)) {
 	d.notifier = notifier
 }
 
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynStringValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue string, newValue string),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
 // Type is an indicator of what this flag represents.
 func (d *DynStringValue) Type() string {
 	return "dyn_string"
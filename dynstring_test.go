@@ -54,10 +54,28 @@ func TestDynString_FiresNotifier(t *testing.T) {
 	}
 }
 
+func TestDynString_GetDoesNotAllocate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynString(set, "some_string_1", "something", "Use it or lose it")
+	assert.EqualValues(t, 0, testing.AllocsPerRun(100, func() { value.Get() }))
+}
+
+func Benchmark_String_Dyn_GetParallel(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynString(set, "some_string_1", "something", "Use it or lose it")
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			value.Get()
+		}
+	})
+}
+
 func Benchmark_String_Dyn_Get(b *testing.B) {
 	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
 	value := DynString(set, "some_string_1", "something", "Use it or lose it")
 	set.Set("some_string_1", "else")
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		x := value.Get()
 		x = x + "foo"
@@ -4,10 +4,13 @@
 package flagz
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	flag "github.com/spf13/pflag"
@@ -16,18 +19,30 @@ import (
 // DynStringSet creates a `Flag` that represents `map[string]struct{}` which is safe to change dynamically at runtime.
 // Unlike `pflag.StringSlice`, consecutive sets don't append to the slice, but override it.
 func DynStringSet(flagSet *flag.FlagSet, name string, value []string, usage string) *DynStringSetValue {
+	return DynStringSetP(flagSet, name, "", value, usage)
+}
+
+// DynStringSetP is like DynStringSet, but accepts a shorthand letter that can be used after a single dash.
+func DynStringSetP(flagSet *flag.FlagSet, name string, shorthand string, value []string,
+	usage string) *DynStringSetValue {
 	set := buildStringSet(value)
 	dynValue := &DynStringSetValue{ptr: unsafe.Pointer(&set)}
-	flag := flagSet.VarPF(dynValue, name, "", usage)
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
 	MarkFlagDynamic(flag)
 	return dynValue
 }
 
 // DynStringSetValue is a flag-related `map[string]struct{}` value wrapper.
 type DynStringSetValue struct {
-	ptr       unsafe.Pointer
-	validator func(map[string]struct{}) error
-	notifier  func(oldValue map[string]struct{}, newValue map[string]struct{})
+	dynChangeTime
+
+	ptr             unsafe.Pointer
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func(map[string]struct{}) error
+	validatorCtx    func(context.Context, map[string]struct{}) error
+	notifier        func(oldValue map[string]struct{}, newValue map[string]struct{})
+	notifierCtx     func(ctx context.Context, oldValue map[string]struct{}, newValue map[string]struct{})
+	notifierTimeout time.Duration
 }
 
 // Get retrieves the value in a thread-safe manner.
@@ -43,17 +58,33 @@ func (d *DynStringSetValue) Get() map[string]struct{} {
 func (d *DynStringSetValue) Set(val string) error {
 	v, err := csv.NewReader(strings.NewReader(val)).Read()
 	if err != nil {
-		return err
+		return &ParseError{Err: err}
 	}
 	s := buildStringSet(v)
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
 	if d.validator != nil {
 		if err := d.validator(s); err != nil {
-			return err
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, s) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
 		}
 	}
 	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&s))
-	if d.notifier != nil {
-		go d.notifier(*(*map[string]struct{})(oldPtr), s)
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*map[string]struct{})(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, s) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, s) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
 	}
 	return nil
 }
@@ -72,17 +103,54 @@ func (d *DynStringSetValue) WithValidator(validator func(map[string]struct{}) er
 	d.validator = validator
 }
 
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynStringSetValue) WithValidatorCtx(validator func(ctx context.Context, value map[string]struct{}) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `ValidateAll`.
+func (d *DynStringSetValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
 // WithNotifier adds a function that is called every time a new value is successfully set.
 // Each notifier is executed asynchronously in a new go-routine.
 func (d *DynStringSetValue) WithNotifier(notifier func(oldValue map[string]struct{}, newValue map[string]struct{})) {
 	d.notifier = notifier
 }
 
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynStringSetValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue map[string]struct{}, newValue map[string]struct{}),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
 // Type is an indicator of what this flag represents.
 func (d *DynStringSetValue) Type() string {
 	return "dyn_stringslice"
 }
 
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynStringSetValue) FormatHint() string {
+	return "comma-separated list like a,b,c"
+}
+
 // String represents the canonical representation of the type.
 func (d *DynStringSetValue) String() string {
 	v := d.Get()
@@ -4,10 +4,13 @@
 package flagz
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	flag "github.com/spf13/pflag"
@@ -16,17 +19,29 @@ import (
 // DynStringSlice creates a `Flag` that represents `[]string` which is safe to change dynamically at runtime.
 // Unlike `pflag.StringSlice`, consecutive sets don't append to the slice, but override it.
 func DynStringSlice(flagSet *flag.FlagSet, name string, value []string, usage string) *DynStringSliceValue {
+	return DynStringSliceP(flagSet, name, "", value, usage)
+}
+
+// DynStringSliceP is like DynStringSlice, but accepts a shorthand letter that can be used after a single dash.
+func DynStringSliceP(flagSet *flag.FlagSet, name string, shorthand string, value []string,
+	usage string) *DynStringSliceValue {
 	dynValue := &DynStringSliceValue{ptr: unsafe.Pointer(&value)}
-	flag := flagSet.VarPF(dynValue, name, "", usage)
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
 	MarkFlagDynamic(flag)
 	return dynValue
 }
 
 // DynStringSliceValue is a flag-related `time.Duration` value wrapper.
 type DynStringSliceValue struct {
-	ptr       unsafe.Pointer
-	validator func([]string) error
-	notifier  func(oldValue []string, newValue []string)
+	dynChangeTime
+
+	ptr             unsafe.Pointer
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func([]string) error
+	validatorCtx    func(context.Context, []string) error
+	notifier        func(oldValue []string, newValue []string)
+	notifierCtx     func(ctx context.Context, oldValue []string, newValue []string)
+	notifierTimeout time.Duration
 }
 
 // Get retrieves the value in a thread-safe manner.
@@ -42,16 +57,32 @@ func (d *DynStringSliceValue) Get() []string {
 func (d *DynStringSliceValue) Set(val string) error {
 	v, err := csv.NewReader(strings.NewReader(val)).Read()
 	if err != nil {
-		return err
+		return &ParseError{Err: err}
 	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
 	if d.validator != nil {
 		if err := d.validator(v); err != nil {
-			return err
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, v) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
 		}
 	}
 	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&v))
-	if d.notifier != nil {
-		go d.notifier(*(*[]string)(oldPtr), v)
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*[]string)(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, v) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, v) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
 	}
 	return nil
 }
@@ -63,17 +94,53 @@ func (d *DynStringSliceValue) WithValidator(validator func([]string) error) {
 	d.validator = validator
 }
 
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynStringSliceValue) WithValidatorCtx(validator func(ctx context.Context, value []string) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `ValidateAll`.
+func (d *DynStringSliceValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
 // WithNotifier adds a function that is called every time a new value is successfully set.
 // Each notifier is executed asynchronously in a new go-routine.
 func (d *DynStringSliceValue) WithNotifier(notifier func(oldValue []string, newValue []string)) {
 	d.notifier = notifier
 }
 
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynStringSliceValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue []string, newValue []string),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
 // Type is an indicator of what this flag represents.
 func (d *DynStringSliceValue) Type() string {
 	return "dyn_stringslice"
 }
 
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynStringSliceValue) FormatHint() string {
+	return "comma-separated list like a,b,c"
+}
+
 // String represents the canonical representation of the type.
 func (d *DynStringSliceValue) String() string {
 	return fmt.Sprintf("%v", d.Get())
@@ -0,0 +1,355 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+	tlsClientAuths = map[string]tls.ClientAuthType{
+		"none":               tls.NoClientCert,
+		"request":            tls.RequestClientCert,
+		"require":            tls.RequireAnyClientCert,
+		"verify_if_given":    tls.VerifyClientCertIfGiven,
+		"require_and_verify": tls.RequireAndVerifyClientCert,
+	}
+)
+
+// TLSPolicy is the TLS policy of a server, the value of a `DynTLSPolicy` flag.
+type TLSPolicy struct {
+	// MinVersion is the minimum TLS version, e.g. `tls.VersionTLS12`.
+	MinVersion uint16
+	// MaxVersion is the maximum TLS version, or zero for the latest one supported.
+	MaxVersion uint16
+	// CipherSuites are the enabled cipher suites of TLS 1.0 to 1.2, from `tls.CipherSuites`, or nil for the defaults
+	// of crypto/tls. The cipher suites of TLS 1.3 aren't configurable.
+	CipherSuites []uint16
+	// ClientAuth is the policy of client certificates. Verifying them needs the ClientCAs of the base `tls.Config`.
+	ClientAuth tls.ClientAuthType
+}
+
+// tlsPolicyJSON is the JSON form of a TLSPolicy, with the names of the constants of crypto/tls.
+type tlsPolicyJSON struct {
+	MinVersion   string   `json:"min_version"`
+	MaxVersion   string   `json:"max_version,omitempty"`
+	CipherSuites []string `json:"cipher_suites,omitempty"`
+	ClientAuth   string   `json:"client_auth,omitempty"`
+}
+
+// DynTLSPolicy creates a `Flag` that represents a TLSPolicy, which is safe to change dynamically at runtime. Values are
+// JSON objects naming the constants of crypto/tls, e.g.
+//
+//	{"min_version": "1.2", "cipher_suites": ["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"],
+//	 "client_auth": "require_and_verify"}
+//
+// where `client_auth` is one of "none" (the default), "request", "require", "verify_if_given" and
+// "require_and_verify". Servers apply the latest policy to every handshake with `GetConfigForClient`.
+func DynTLSPolicy(flagSet *flag.FlagSet, name string, value TLSPolicy, usage string) *DynTLSPolicyValue {
+	return DynTLSPolicyP(flagSet, name, "", value, usage)
+}
+
+// DynTLSPolicyP is like DynTLSPolicy, but accepts a shorthand letter that can be used after a single dash.
+func DynTLSPolicyP(flagSet *flag.FlagSet, name string, shorthand string, value TLSPolicy,
+	usage string) *DynTLSPolicyValue {
+	dynValue := &DynTLSPolicyValue{ptr: unsafe.Pointer(&value)}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynTLSPolicyValue is a flag-related TLSPolicy value wrapper.
+type DynTLSPolicyValue struct {
+	dynChangeTime
+
+	ptr             unsafe.Pointer // *TLSPolicy
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`.
+	validator       func(TLSPolicy) error
+	validatorCtx    func(context.Context, TLSPolicy) error
+	notifier        func(oldValue TLSPolicy, newValue TLSPolicy)
+	notifierCtx     func(ctx context.Context, oldValue TLSPolicy, newValue TLSPolicy)
+	notifierTimeout time.Duration
+}
+
+// Get retrieves the TLSPolicy in a thread-safe manner. Its CipherSuites must not be modified.
+func (d *DynTLSPolicyValue) Get() TLSPolicy {
+	return *d.load()
+}
+
+// Config returns a copy of `base` (e.g. holding the certificates) with the current TLSPolicy applied.
+func (d *DynTLSPolicyValue) Config(base *tls.Config) *tls.Config {
+	return applyTLSPolicy(base, d.load())
+}
+
+// GetConfigForClient returns a function for the `GetConfigForClient` of the `tls.Config` of a server, applying the
+// TLSPolicy current at the time of each handshake to `base`, e.g.
+//
+//	server.TLSConfig = &tls.Config{GetConfigForClient: policy.GetConfigForClient(base)}
+//
+// The config of a policy is built once and reused for all handshakes until the policy changes, and the `base` must
+// not be modified after the call.
+func (d *DynTLSPolicyValue) GetConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	type cachedConfig struct {
+		policy *TLSPolicy
+		config *tls.Config
+	}
+	var cache unsafe.Pointer // *cachedConfig
+	return func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		policy := d.load()
+		if cached := (*cachedConfig)(atomic.LoadPointer(&cache)); cached != nil && cached.policy == policy {
+			return cached.config, nil
+		}
+		config := applyTLSPolicy(base, policy)
+		atomic.StorePointer(&cache, unsafe.Pointer(&cachedConfig{policy: policy, config: config}))
+		return config, nil
+	}
+}
+
+// Set updates the value from a JSON TLSPolicy in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, names unknown or insecure constants of
+// crypto/tls, sets cipher suites that don't apply to its versions, or doesn't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynTLSPolicyValue) Set(input string) error {
+	val, err := parseTLSPolicy(input)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
+	d.markChanged()
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*TLSPolicy)(oldPtr)
+		if d.notifier != nil {
+			RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set, in addition to the checks against the constants
+// of crypto/tls, e.g. to enforce a minimum version. Any error returned by the validator will lead to the value being
+// rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynTLSPolicyValue) WithValidator(validator func(TLSPolicy) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and UpdateInfo of the update (see `SetFlagFromSourceCtx`), e.g. for bounded external checks.
+func (d *DynTLSPolicyValue) WithValidatorCtx(validator func(ctx context.Context, value TLSPolicy) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the constants of crypto/tls and the validator, e.g. to make sure that the
+// default passes them. See `ValidateAll`.
+func (d *DynTLSPolicyValue) Validate() error {
+	if err := validTLSPolicy(d.Get()); err != nil {
+		return &ValidationError{Err: err}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := RunValidatorCtx(d, validate); err != nil {
+			return &ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `SetNotifierPool`.
+func (d *DynTLSPolicyValue) WithNotifier(notifier func(oldValue TLSPolicy, newValue TLSPolicy)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `RunNotifierCtx`.
+func (d *DynTLSPolicyValue) WithNotifierCtx(notifier func(ctx context.Context, oldValue TLSPolicy, newValue TLSPolicy),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynTLSPolicyValue) Type() string {
+	return "dyn_tls_policy"
+}
+
+// FormatHint describes the format of inputs of `Set`, see `FlagFormatHint`.
+func (d *DynTLSPolicyValue) FormatHint() string {
+	return `JSON TLS policy like {"min_version": "1.2", "client_auth": "require_and_verify"}`
+}
+
+// String returns the canonical JSON representation of the TLSPolicy.
+func (d *DynTLSPolicyValue) String() string {
+	policy := d.Get()
+	wire := &tlsPolicyJSON{
+		MinVersion: tlsVersionName(policy.MinVersion),
+		MaxVersion: tlsVersionName(policy.MaxVersion),
+		ClientAuth: tlsClientAuthName(policy.ClientAuth),
+	}
+	for _, id := range policy.CipherSuites {
+		wire.CipherSuites = append(wire.CipherSuites, tls.CipherSuiteName(id))
+	}
+	out, err := json.Marshal(wire)
+	if err != nil {
+		return "ERR"
+	}
+	return string(out)
+}
+
+func (d *DynTLSPolicyValue) load() *TLSPolicy {
+	return (*TLSPolicy)(atomic.LoadPointer(&d.ptr))
+}
+
+func applyTLSPolicy(base *tls.Config, policy *TLSPolicy) *tls.Config {
+	config := base.Clone()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	// the policy is applied by the returned config, which must not defer to the server's config again.
+	config.GetConfigForClient = nil
+	config.MinVersion = policy.MinVersion
+	config.MaxVersion = policy.MaxVersion
+	config.CipherSuites = policy.CipherSuites
+	config.ClientAuth = policy.ClientAuth
+	return config
+}
+
+func parseTLSPolicy(input string) (TLSPolicy, error) {
+	wire := &tlsPolicyJSON{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(input)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(wire); err != nil {
+		return TLSPolicy{}, err
+	}
+	policy := TLSPolicy{}
+	var ok bool
+	if policy.MinVersion, ok = tlsVersions[wire.MinVersion]; !ok {
+		return TLSPolicy{}, fmt.Errorf("min version %q must be one of 1.0, 1.1, 1.2 and 1.3", wire.MinVersion)
+	}
+	if wire.MaxVersion != "" {
+		if policy.MaxVersion, ok = tlsVersions[wire.MaxVersion]; !ok {
+			return TLSPolicy{}, fmt.Errorf("max version %q must be one of 1.0, 1.1, 1.2 and 1.3", wire.MaxVersion)
+		}
+	}
+	if wire.ClientAuth != "" {
+		if policy.ClientAuth, ok = tlsClientAuths[wire.ClientAuth]; !ok {
+			return TLSPolicy{}, fmt.Errorf("client auth %q must be one of none, request, require, "+
+				"verify_if_given and require_and_verify", wire.ClientAuth)
+		}
+	}
+	for _, name := range wire.CipherSuites {
+		id, err := tlsCipherSuiteID(name)
+		if err != nil {
+			return TLSPolicy{}, err
+		}
+		policy.CipherSuites = append(policy.CipherSuites, id)
+	}
+	return policy, validTLSPolicy(policy)
+}
+
+func validTLSPolicy(policy TLSPolicy) error {
+	if tlsVersionName(policy.MinVersion) == "" {
+		return fmt.Errorf("min version %#04x is not a TLS version", policy.MinVersion)
+	}
+	if policy.MaxVersion != 0 && tlsVersionName(policy.MaxVersion) == "" {
+		return fmt.Errorf("max version %#04x is not a TLS version", policy.MaxVersion)
+	}
+	if policy.MaxVersion != 0 && policy.MaxVersion < policy.MinVersion {
+		return fmt.Errorf("max version %v is below min version %v", tlsVersionName(policy.MaxVersion),
+			tlsVersionName(policy.MinVersion))
+	}
+	if tlsClientAuthName(policy.ClientAuth) == "" {
+		return fmt.Errorf("client auth %v is not a client auth type", policy.ClientAuth)
+	}
+	if len(policy.CipherSuites) > 0 && policy.MinVersion >= tls.VersionTLS13 {
+		return fmt.Errorf("cipher suites don't apply to TLS 1.3, which is the min version")
+	}
+	seen := make(map[uint16]struct{}, len(policy.CipherSuites))
+	for _, id := range policy.CipherSuites {
+		if _, err := tlsCipherSuiteID(tls.CipherSuiteName(id)); err != nil {
+			return err
+		}
+		if _, ok := seen[id]; ok {
+			return fmt.Errorf("duplicate cipher suite %v", tls.CipherSuiteName(id))
+		}
+		seen[id] = struct{}{}
+	}
+	return nil
+}
+
+// tlsCipherSuiteID returns the ID of the secure TLS 1.0 to 1.2 cipher suite `name`.
+func tlsCipherSuiteID(name string) (uint16, error) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			for _, version := range suite.SupportedVersions {
+				if version != tls.VersionTLS13 {
+					return suite.ID, nil
+				}
+			}
+			return 0, fmt.Errorf("cipher suite %v is of TLS 1.3, which isn't configurable", name)
+		}
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		if suite.Name == name {
+			return 0, fmt.Errorf("cipher suite %v is insecure", name)
+		}
+	}
+	return 0, fmt.Errorf("unknown cipher suite %q", name)
+}
+
+func tlsVersionName(version uint16) string {
+	for name, v := range tlsVersions {
+		if v == version {
+			return name
+		}
+	}
+	return ""
+}
+
+func tlsClientAuthName(clientAuth tls.ClientAuthType) string {
+	for name, c := range tlsClientAuths {
+		if c == clientAuth {
+			return name
+		}
+	}
+	return ""
+}
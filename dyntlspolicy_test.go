@@ -0,0 +1,97 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynTLSPolicy_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynTLSPolicy(set, "some_tls_1", TLSPolicy{MinVersion: tls.VersionTLS12}, "Use it or lose it")
+	assert.Equal(t, TLSPolicy{MinVersion: tls.VersionTLS12}, dynFlag.Get())
+	assert.Equal(t, `{"min_version":"1.2","client_auth":"none"}`, dynFlag.String())
+
+	require.NoError(t, set.Set("some_tls_1", `{"min_version": "1.2", "max_version": "1.3", `+
+		`"cipher_suites": ["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"], "client_auth": "require_and_verify"}`))
+	assert.Equal(t, TLSPolicy{
+		MinVersion:   tls.VersionTLS12,
+		MaxVersion:   tls.VersionTLS13,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}, dynFlag.Get())
+	assert.Equal(t, `{"min_version":"1.2","max_version":"1.3",`+
+		`"cipher_suites":["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"],"client_auth":"require_and_verify"}`,
+		dynFlag.String())
+}
+
+func TestDynTLSPolicy_RejectsBadPolicies(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynTLSPolicy(set, "some_tls_1", TLSPolicy{MinVersion: tls.VersionTLS12}, "Use it or lose it")
+	for _, input := range []string{
+		`not json`,
+		`{}`,
+		`{"min_version": "1.2", "extra": 1}`,
+		`{"min_version": "1.4"}`,
+		`{"min_version": "1.3", "max_version": "1.2"}`,
+		`{"min_version": "1.2", "client_auth": "always"}`,
+		`{"min_version": "1.2", "cipher_suites": ["TLS_FOO"]}`,
+		`{"min_version": "1.2", "cipher_suites": ["TLS_RSA_WITH_RC4_128_SHA"]}`,
+		`{"min_version": "1.2", "cipher_suites": ["TLS_AES_128_GCM_SHA256"]}`,
+		`{"min_version": "1.3", "cipher_suites": ["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"]}`,
+		`{"min_version": "1.2", "cipher_suites": ["TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", ` +
+			`"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"]}`,
+	} {
+		err := dynFlag.Set(input)
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr), "value %v must be rejected", input)
+	}
+	assert.Equal(t, TLSPolicy{MinVersion: tls.VersionTLS12}, dynFlag.Get(), "rejected values must not be applied")
+}
+
+func TestDynTLSPolicy_GetConfigForClientAppliesLatestPolicy(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynTLSPolicy(set, "some_tls_1", TLSPolicy{MinVersion: tls.VersionTLS12}, "Use it or lose it")
+	base := &tls.Config{ServerName: "example.com", ClientAuth: tls.RequestClientCert}
+	getConfig := dynFlag.GetConfigForClient(base)
+	base.GetConfigForClient = getConfig
+
+	config, err := getConfig(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", config.ServerName, "the base config must be kept")
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth, "the policy must override the base config")
+	assert.Nil(t, config.GetConfigForClient, "the config must not defer to the server's one again")
+	again, err := getConfig(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.True(t, config == again, "the config must be reused until the policy changes")
+
+	require.NoError(t, set.Set("some_tls_1", `{"min_version": "1.3", "client_auth": "require"}`))
+	config, err = getConfig(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+	assert.Equal(t, tls.RequireAnyClientCert, config.ClientAuth)
+	assert.Equal(t, tls.RequestClientCert, base.ClientAuth, "the base config must not be modified")
+}
+
+func TestDynTLSPolicy_ValidatesDefaults(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynTLSPolicy(set, "some_tls_1", TLSPolicy{}, "Use it or lose it")
+	assert.Error(t, dynFlag.Validate(), "defaults without a min version must not validate")
+	dynFlag.WithValidator(func(policy TLSPolicy) error {
+		if policy.MinVersion < tls.VersionTLS12 {
+			return errors.New("TLS 1.2 is the minimum")
+		}
+		return nil
+	})
+	assert.Error(t, dynFlag.Set(`{"min_version": "1.1"}`))
+	require.NoError(t, dynFlag.Set(`{"min_version": "1.2"}`))
+	assert.NoError(t, dynFlag.Validate())
+}
@@ -0,0 +1,176 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// EncryptedValuePrefix marks values stored encrypted in a backend, followed by the base64 of the ciphertext.
+const EncryptedValuePrefix = "enc:"
+
+// errMalformedCiphertext doesn't carry any details of the ciphertext, so it can be safely logged.
+var errMalformedCiphertext = errors.New("malformed ciphertext")
+
+// Decrypter decrypts values stored encrypted in a backend, e.g. through a KMS or with age.
+//
+// Updaters configured with a Decrypter (e.g. `watcher.WithDecrypter`) decrypt values with the `EncryptedValuePrefix`
+// before setting them, so the plaintext is only ever held in memory. Combine it with `DynSecret` to keep it out of
+// status pages and logs.
+type Decrypter interface {
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// DecrypterFunc adapts a function to the Decrypter interface.
+type DecrypterFunc func(ciphertext []byte) ([]byte, error)
+
+// Decrypt calls `f`.
+func (f DecrypterFunc) Decrypt(ciphertext []byte) ([]byte, error) {
+	return f(ciphertext)
+}
+
+// DecryptFlagValue returns the plaintext of `value` if it has the `EncryptedValuePrefix`, and `value` itself
+// otherwise, so that only the sensitive values need to be encrypted.
+func DecryptFlagValue(decrypter Decrypter, value string) (string, error) {
+	if !strings.HasPrefix(value, EncryptedValuePrefix) {
+		return value, nil
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedValuePrefix))
+	if err != nil {
+		return "", fmt.Errorf("decrypting value: %v", errMalformedCiphertext)
+	}
+	plaintext, err := decrypter.Decrypt(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("decrypting value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// AESGCM encrypts and decrypts values with a local AES-GCM key, for backends whose readers share a key.
+type AESGCM struct {
+	aead cipher.AEAD
+}
+
+// NewAESGCM constructs an AESGCM using `key`, of 16, 24 or 32 bytes.
+func NewAESGCM(key []byte) (*AESGCM, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCM{aead: aead}, nil
+}
+
+// Encrypt returns `plaintext` sealed with a random nonce, prepended to the ciphertext.
+func (a *AESGCM) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, a.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return a.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt opens a ciphertext produced by `Encrypt`.
+func (a *AESGCM) Decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < a.aead.NonceSize() {
+		return nil, errMalformedCiphertext
+	}
+	nonce, sealed := ciphertext[:a.aead.NonceSize()], ciphertext[a.aead.NonceSize():]
+	return a.aead.Open(nil, nonce, sealed, nil)
+}
+
+// EncryptFlagValue encrypts `value` with `a`, returning it with the `EncryptedValuePrefix` for storing in a backend.
+func (a *AESGCM) EncryptFlagValue(value string) (string, error) {
+	ciphertext, err := a.Encrypt([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	return EncryptedValuePrefix + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// EnvelopeDecrypter decrypts envelopes of a value encrypted with a data key, and of the data key encrypted
+// ("wrapped") by a key management service. Only the wrapped data key is sent to the KMS, so rotating the KMS key or
+// the credentials stored in flags doesn't require re-encrypting anything else.
+//
+// Envelopes consist of the big-endian uint16 length of the wrapped data key, the wrapped data key, and the AES-GCM
+// ciphertext of the value (see `AESGCM.Encrypt`). Unwrapped data keys are cached, as all values encrypted with the
+// same data key share its wrapped form.
+type EnvelopeDecrypter struct {
+	unwrapKey func(wrappedKey []byte) ([]byte, error)
+
+	mu    sync.Mutex
+	cache map[string]*AESGCM
+}
+
+// NewEnvelopeDecrypter constructs an EnvelopeDecrypter unwrapping data keys with `unwrapKey`, usually a call to the
+// Decrypt API of a KMS.
+func NewEnvelopeDecrypter(unwrapKey func(wrappedKey []byte) ([]byte, error)) *EnvelopeDecrypter {
+	return &EnvelopeDecrypter{unwrapKey: unwrapKey, cache: make(map[string]*AESGCM)}
+}
+
+// Decrypt opens an envelope produced by `SealEnvelope`.
+func (e *EnvelopeDecrypter) Decrypt(envelope []byte) ([]byte, error) {
+	if len(envelope) < 2 {
+		return nil, errMalformedCiphertext
+	}
+	keyLen := int(binary.BigEndian.Uint16(envelope))
+	if len(envelope) < 2+keyLen {
+		return nil, errMalformedCiphertext
+	}
+	wrappedKey, ciphertext := envelope[2:2+keyLen], envelope[2+keyLen:]
+	dataKey, err := e.dataKey(wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return dataKey.Decrypt(ciphertext)
+}
+
+func (e *EnvelopeDecrypter) dataKey(wrappedKey []byte) (*AESGCM, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if dataKey, ok := e.cache[string(wrappedKey)]; ok {
+		return dataKey, nil
+	}
+	key, err := e.unwrapKey(wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key: %w", err)
+	}
+	dataKey, err := NewAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	e.cache[string(wrappedKey)] = dataKey
+	return dataKey, nil
+}
+
+// SealEnvelope encrypts `value` with `dataKey`, returning the envelope of it and of `wrappedKey` (the data key
+// encrypted by a KMS) with the `EncryptedValuePrefix`, for storing in a backend read with an EnvelopeDecrypter.
+func SealEnvelope(wrappedKey []byte, dataKey []byte, value string) (string, error) {
+	if len(wrappedKey) > 0xffff {
+		return "", fmt.Errorf("wrapped data key of %d bytes is too long", len(wrappedKey))
+	}
+	a, err := NewAESGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := a.Encrypt([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	envelope := make([]byte, 2, 2+len(wrappedKey)+len(ciphertext))
+	binary.BigEndian.PutUint16(envelope, uint16(len(wrappedKey)))
+	envelope = append(append(envelope, wrappedKey...), ciphertext...)
+	return EncryptedValuePrefix + base64.StdEncoding.EncodeToString(envelope), nil
+}
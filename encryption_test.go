@@ -0,0 +1,62 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAESGCM_EncryptsFlagValues(t *testing.T) {
+	a, err := flagz.NewAESGCM(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	encrypted, err := a.EncryptFlagValue("hunter2")
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted, "hunter2")
+
+	value, err := flagz.DecryptFlagValue(a, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", value)
+
+	value, err = flagz.DecryptFlagValue(a, "plain")
+	require.NoError(t, err, "values without the prefix must be passed through")
+	assert.Equal(t, "plain", value)
+
+	other, err := flagz.NewAESGCM(bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+	_, err = flagz.DecryptFlagValue(other, encrypted)
+	assert.Error(t, err, "values encrypted with other keys must not decrypt")
+	_, err = flagz.DecryptFlagValue(a, flagz.EncryptedValuePrefix+"!!")
+	assert.Error(t, err, "malformed values must not decrypt")
+}
+
+func TestEnvelopeDecrypter_UnwrapsAndCachesDataKeys(t *testing.T) {
+	dataKey := bytes.Repeat([]byte{3}, 32)
+	unwraps := 0
+	decrypter := flagz.NewEnvelopeDecrypter(func(wrappedKey []byte) ([]byte, error) {
+		unwraps++
+		if string(wrappedKey) != "wrapped" {
+			return nil, errors.New("unknown key")
+		}
+		return dataKey, nil
+	})
+	for _, plaintext := range []string{"hunter2", "correcthorse"} {
+		sealed, err := flagz.SealEnvelope([]byte("wrapped"), dataKey, plaintext)
+		require.NoError(t, err)
+		value, err := flagz.DecryptFlagValue(decrypter, sealed)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, value)
+	}
+	assert.Equal(t, 1, unwraps, "data keys must be unwrapped once")
+
+	sealed, err := flagz.SealEnvelope([]byte("revoked"), dataKey, "hunter2")
+	require.NoError(t, err)
+	_, err = flagz.DecryptFlagValue(decrypter, sealed)
+	assert.Error(t, err, "envelopes of keys the KMS doesn't unwrap must not decrypt")
+}
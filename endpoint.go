@@ -5,11 +5,17 @@ package flagz
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"html/template"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
-	"text/template"
+	"time"
 
 	"fmt"
 
@@ -18,26 +24,347 @@ import (
 
 // StatusEndpoint is a collection of `http.HandlerFunc` that serve debug pages about a given `FlagSet.
 type StatusEndpoint struct {
-	flagSet *flag.FlagSet
+	flagSet        *flag.FlagSet
+	authorizer     SetAuthorizer
+	writeAuth      WriteAuthorizer
+	setPath        string
+	readOnlyFlag   string
+	auditSink      AuditSink
+	actor          func(req *http.Request) string
+	streamPath     string
+	streamInterval time.Duration
+	peerChecker    PeerChecker
+	peerClient     *http.Client
+	logger         Logger
 }
 
+const (
+	defaultStreamInterval = 1 * time.Second
+	defaultPeerTimeout    = 5 * time.Second
+
+	csrfCookieName = "flagz_csrf"
+	csrfFormField  = "csrf_token"
+	// CSRFHeader can be sent by non-browser clients of `SetFlag` instead of a CSRF token. Browsers don't allow
+	// cross-site requests to carry custom headers.
+	CSRFHeader = "X-Flagz-Request"
+)
+
+// SetAuthorizer decides whether the request `req` may change the flag `flagName` through `SetFlag`.
+// Returning an error rejects the change, and the error's message is returned to the caller.
+type SetAuthorizer func(req *http.Request, flagName string) error
+
 // NewStatusEndpoint creates a new debug `http.HandlerFunc` collection for a given `FlagSet`
 func NewStatusEndpoint(flagSet *flag.FlagSet) *StatusEndpoint {
-	return &StatusEndpoint{flagSet: flagSet}
+	return &StatusEndpoint{
+		flagSet:        flagSet,
+		streamInterval: defaultStreamInterval,
+		peerClient:     &http.Client{Timeout: defaultPeerTimeout},
+	}
+}
+
+// WithSetAuthorizer enables the `SetFlag` handler, allowing only the changes approved by `authorizer`.
+func (e *StatusEndpoint) WithSetAuthorizer(authorizer SetAuthorizer) *StatusEndpoint {
+	e.authorizer = authorizer
+	return e
+}
+
+// WithWriteAuthorizer enables the `SetFlag` handler, allowing only the changes approved by `authorizer` with the
+// actor (see `WithActor`), flag name and proposed value. If a `SetAuthorizer` is set as well, changes must pass both.
+func (e *StatusEndpoint) WithWriteAuthorizer(authorizer WriteAuthorizer) *StatusEndpoint {
+	e.writeAuth = authorizer
+	return e
+}
+
+// WithSetPath renders forms for changing dynamic flags on the HTML page, posting to the `SetFlag` handler registered
+// under `path`, e.g. `/debug/flagz/set`. The forms are only shown if `SetFlag` is enabled with `WithSetAuthorizer`.
+func (e *StatusEndpoint) WithSetPath(path string) *StatusEndpoint {
+	e.setPath = path
+	return e
+}
+
+// WithReadOnlyFlag makes `SetFlag` reject all changes while the boolean flag `name` of the FlagSet is true. Making it
+// a dynamic flag allows freezing the runtime configuration of all instances at once, e.g. for the time of an incident.
+// The read-only flag itself can't be changed through `SetFlag`.
+func (e *StatusEndpoint) WithReadOnlyFlag(name string) *StatusEndpoint {
+	e.readOnlyFlag = name
+	return e
+}
+
+// WithAuditSink records every change made through `SetFlag` to `sink`.
+func (e *StatusEndpoint) WithAuditSink(sink AuditSink) *StatusEndpoint {
+	e.auditSink = sink
+	return e
+}
+
+// WithActor sets the function identifying who made a change in the audit records and `WriteRequest`s, e.g. by reading
+// the user from the request's authentication. Defaults to the request's remote address.
+func (e *StatusEndpoint) WithActor(actor func(req *http.Request) string) *StatusEndpoint {
+	e.actor = actor
+	return e
+}
+
+// WithLogger logs the changes made through `SetFlag`, and failures of auditing them, to `logger`.
+func (e *StatusEndpoint) WithLogger(logger Logger) *StatusEndpoint {
+	e.logger = logger
+	return e
+}
+
+// WithStreamPath makes the HTML page of `ListFlags` and `ServeHTTP` live-update its values, by subscribing to the
+// `StreamChanges` handler registered under `path`, e.g. `/debug/flagz/stream`.
+func (e *StatusEndpoint) WithStreamPath(path string) *StatusEndpoint {
+	e.streamPath = path
+	return e
+}
+
+// WithStreamInterval sets how often `StreamChanges` checks the `FlagSet` for changes. Defaults to 1s.
+func (e *StatusEndpoint) WithStreamInterval(interval time.Duration) *StatusEndpoint {
+	e.streamInterval = interval
+	return e
+}
+
+// StreamChanges provides a `http.HandlerFunc` that pushes flag changes as they happen using server-sent events.
+// Each change is sent as a `flag_change` event with the JSON of the changed flag as its data, regardless of whether it
+// was changed by an Updater, through `SetFlag` or by user code. The same filtering URL query parameters as in
+// `ListFlags` are supported.
+func (e *StatusEndpoint) StreamChanges(resp http.ResponseWriter, req *http.Request) {
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		http.Error(resp, "flagz: streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(http.StatusOK)
+	fmt.Fprintf(resp, ": watching %d flags\n\n", len(e.collectFlags(req).Flags))
+	flusher.Flush()
+
+	lastValues := make(map[string]string)
+	for _, fj := range e.collectFlags(req).Flags {
+		lastValues[fj.Name] = fj.CurrentValue
+	}
+	ticker := time.NewTicker(e.streamInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-req.Context().Done():
+			return
+		}
+		for _, fj := range e.collectFlags(req).Flags {
+			if last, ok := lastValues[fj.Name]; ok && last == fj.CurrentValue {
+				continue
+			}
+			lastValues[fj.Name] = fj.CurrentValue
+			out, err := json.Marshal(fj)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(resp, "event: flag_change\ndata: %s\n\n", out); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// SetFlag provides a `http.HandlerFunc` (e.g. for `/debug/flagz/set`) that changes a dynamic flag of this instance.
+// It accepts POST requests with `name` and `value` form parameters, and responds with the JSON of the changed flag.
+// The handler rejects all requests unless enabled through `WithSetAuthorizer`. Values go through the flag's
+// validators, same as updates from any other source.
+//
+// To protect against cross-site request forgery, requests must either carry the `csrf_token` form field issued with
+// the HTML page, or the `X-Flagz-Request` header (see `CSRFHeader`). Flags marked with `MarkFlagWriteLocked` can't
+// be changed, nor can any flag while the `WithReadOnlyFlag` is set.
+//
+// With the `pin=true` form parameter the flag is pinned after being set, holding the values of Updaters until it is
+// unpinned by a request with `unpin=true` (and no value), which applies the last held value, see `PinFlag`.
+func (e *StatusEndpoint) SetFlag(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		http.Error(resp, "flagz: only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := req.FormValue("name")
+	if e.authorizer == nil && e.writeAuth == nil {
+		http.Error(resp, "flagz: setting flags is not enabled", http.StatusForbidden)
+		return
+	}
+	if !validCSRF(req) {
+		http.Error(resp, "flagz: missing or invalid CSRF token", http.StatusForbidden)
+		return
+	}
+	if e.isReadOnly() || (e.readOnlyFlag != "" && name == e.readOnlyFlag) {
+		http.Error(resp, "flagz: flags are read-only", http.StatusForbidden)
+		return
+	}
+	if e.authorizer != nil {
+		if err := e.authorizer(req, name); err != nil {
+			http.Error(resp, fmt.Sprintf("flagz: not authorized: %v", err), http.StatusForbidden)
+			return
+		}
+	}
+	f := e.flagSet.Lookup(name)
+	if f == nil {
+		http.Error(resp, fmt.Sprintf("flagz: flag %q not found", name), http.StatusNotFound)
+		return
+	}
+	if !IsFlagDynamic(f) {
+		http.Error(resp, fmt.Sprintf("flagz: flag %q is not dynamic", name), http.StatusBadRequest)
+		return
+	}
+	if IsFlagWriteLocked(f) {
+		http.Error(resp, fmt.Sprintf("flagz: flag %q is write locked", name), http.StatusForbidden)
+		return
+	}
+	if IsFlagImmutable(f) {
+		http.Error(resp, fmt.Sprintf("flagz: flag %q is immutable", name), http.StatusForbidden)
+		return
+	}
+	unpin := req.FormValue("unpin") == "true"
+	value := req.FormValue("value")
+	if unpin {
+		// unpinning applies the held update, which is what the write authorizer must approve.
+		held, _ := FlagHeldUpdate(f)
+		value = held.Value
+	}
+	if e.writeAuth != nil {
+		writeReq := WriteRequest{Actor: e.actorOf(req), FlagName: name, Value: value, Source: "endpoint", Unpin: unpin}
+		if err := e.writeAuth.AuthorizeWrite(req.Context(), writeReq); err != nil {
+			http.Error(resp, fmt.Sprintf("flagz: not authorized: %v", err), http.StatusForbidden)
+			return
+		}
+	}
+	if unpin {
+		e.unpinFlag(resp, req, f)
+		return
+	}
+	previous := f.Value.String()
+	// do not call flag.Value.Set, instead go through flagSet.Set (via SetFlagFromSource) to change "changed" state.
+	ctx := NewUpdateContext(req.Context(), UpdateInfo{FlagName: name, Source: "endpoint"})
+	if err := SetFlagFromSourceCtx(ctx, e.flagSet, name, value, "endpoint"); err != nil {
+		http.Error(resp, fmt.Sprintf("flagz: bad value for flag %q: %v", name, err), http.StatusBadRequest)
+		return
+	}
+	e.logf("flagz: flag=%v set to value=%v by %v through the status endpoint", name,
+		RedactFlagValue(f, f.Value.String()), e.actorOf(req))
+	if req.FormValue("pin") == "true" {
+		PinFlag(f)
+		e.logf("flagz: flag=%v pinned by %v through the status endpoint", name, e.actorOf(req))
+	}
+	e.auditChange(f, previous, req)
+	writeFlagJSON(resp, f)
+}
+
+// unpinFlag clears the pin of `f` and applies its held update, see `SetFlag`.
+func (e *StatusEndpoint) unpinFlag(resp http.ResponseWriter, req *http.Request, f *flag.Flag) {
+	previous := f.Value.String()
+	if err := UnpinFlag(e.flagSet, f.Name); err != nil {
+		http.Error(resp, fmt.Sprintf("flagz: unpinned flag %q, but its held value failed: %v", f.Name, err),
+			http.StatusConflict)
+		return
+	}
+	e.logf("flagz: flag=%v unpinned by %v through the status endpoint", f.Name, e.actorOf(req))
+	if f.Value.String() != previous {
+		e.auditChange(f, previous, req)
+	}
+	writeFlagJSON(resp, f)
+}
+
+func (e *StatusEndpoint) auditChange(f *flag.Flag, previous string, req *http.Request) {
+	if e.auditSink != nil {
+		if err := e.auditSink.Audit(NewAuditRecord(f, previous, e.actorOf(req), "endpoint")); err != nil {
+			e.logf("flagz: failed auditing change of flag=%v: %v", f.Name, err)
+		}
+	}
+}
+
+// logf logs to the Logger set with `WithLogger`, if any.
+func (e *StatusEndpoint) logf(format string, v ...interface{}) {
+	if e.logger != nil {
+		e.logger.Printf(format, v...)
+	}
+}
+
+func writeFlagJSON(resp http.ResponseWriter, f *flag.Flag) {
+	out, err := json.MarshalIndent(flagToJSON(f), "", "  ")
+	if err != nil {
+		resp.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Add("Content-Type", "application/json")
+	resp.WriteHeader(http.StatusOK)
+	resp.Write(out)
 }
 
 // ListFlags provides an HTML and JSON `http.HandlerFunc` that lists all Flags of a `FlagSet`.
-// Additional URL query parameters can be used such as `type=[dynamic,static]` or `only_changed=true`.
+// Additional URL query parameters can be used such as `type=[dynamic,static]`, `only_changed=true`,
+// `only_non_default=true`, `name=<substring>` or `tag=<annotation>`, and the flags can be ordered with
+// `sort=[name,type,changed,last_changed,source]`.
+// Machine-readable JSON is served to non-browser clients, or whenever `format=json` is requested.
 func (e *StatusEndpoint) ListFlags(resp http.ResponseWriter, req *http.Request) {
-	onlyChanged := req.URL.Query().Get("only_changed") != ""
-	onlyDynamic := req.URL.Query().Get("type") == "dynamic"
-	onlyStatic := req.URL.Query().Get("type") == "static"
+	flagSetJSON := e.collectFlags(req)
+	if requestIsBrowser(req) && req.URL.Query().Get("format") != "json" {
+		e.prepareSetForms(resp, req, flagSetJSON)
+		writeFlagsHTML(resp, flagSetJSON)
+	} else {
+		writeFlagsJSON(resp, flagSetJSON)
+	}
+}
+
+// ServeHTTP implements `http.Handler` serving the HTML status page of the `FlagSet`, e.g. under `/debug/flagz`.
+// Unlike `ListFlags` it renders HTML regardless of the `Accept` header, unless `format=json` is requested. The same
+// filtering URL query parameters are supported.
+func (e *StatusEndpoint) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	flagSetJSON := e.collectFlags(req)
+	if req.URL.Query().Get("format") == "json" {
+		writeFlagsJSON(resp, flagSetJSON)
+	} else {
+		e.prepareSetForms(resp, req, flagSetJSON)
+		writeFlagsHTML(resp, flagSetJSON)
+	}
+}
+
+// DiffFromDefaults provides a JSON `http.HandlerFunc` that lists only the flags whose current value differs from their
+// default, together with the source of each override (e.g. "etcd" or "endpoint"). Flags overridden from the command
+// line or by user code have no source.
+func (e *StatusEndpoint) DiffFromDefaults(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	query.Set("only_non_default", "true")
+	req.URL.RawQuery = query.Encode()
+	writeFlagsJSON(resp, e.collectFlags(req))
+}
+
+func (e *StatusEndpoint) collectFlags(req *http.Request) *flagSetJSON {
+	query := req.URL.Query()
+	filter := flagFilterJSON{
+		Name:           query.Get("name"),
+		Tag:            query.Get("tag"),
+		Type:           query.Get("type"),
+		OnlyChanged:    query.Get("only_changed") != "",
+		OnlyNonDefault: query.Get("only_non_default") != "",
+		Sort:           query.Get("sort"),
+	}
+	onlyChanged := filter.OnlyChanged
+	onlyNonDefault := filter.OnlyNonDefault
+	onlyDynamic := filter.Type == "dynamic"
+	onlyStatic := filter.Type == "static"
+	nameSubstring := strings.ToLower(filter.Name)
 
-	flagSetJSON := &flagSetJSON{}
+	flagSetJSON := &flagSetJSON{Filter: filter}
 	e.flagSet.VisitAll(func(f *flag.Flag) {
+		if nameSubstring != "" && !strings.Contains(strings.ToLower(f.Name), nameSubstring) {
+			return
+		}
+		if filter.Tag != "" {
+			if _, ok := f.Annotations[filter.Tag]; !ok || strings.HasPrefix(filter.Tag, "__") {
+				return
+			}
+		}
 		if onlyChanged && !f.Changed {
 			return
 		}
+		if onlyNonDefault && f.Value.String() == f.DefValue {
+			return
+		}
 		if onlyDynamic && !IsFlagDynamic(f) {
 			return
 		}
@@ -46,27 +373,118 @@ func (e *StatusEndpoint) ListFlags(resp http.ResponseWriter, req *http.Request)
 		}
 		flagSetJSON.Flags = append(flagSetJSON.Flags, flagToJSON(f))
 	})
+	sortFlagsJSON(flagSetJSON.Flags, filter.Sort)
 	flagSetJSON.ChecksumDynamic = fmt.Sprintf("%x", ChecksumFlagSet(e.flagSet, IsFlagDynamic))
 	flagSetJSON.ChecksumStatic = fmt.Sprintf("%x", ChecksumFlagSet(e.flagSet, func(f *flag.Flag) bool { return !IsFlagDynamic(f) }))
+	flagSetJSON.Checksum = fmt.Sprintf("%x", ChecksumFlagSet(e.flagSet, nil))
+	flagSetJSON.StreamPath = e.streamPath
+	return flagSetJSON
+}
 
-	if requestIsBrowser(req) && req.URL.Query().Get("format") != "json" {
-		resp.WriteHeader(http.StatusOK)
-		resp.Header().Add("Content-Type", "text/html")
-		if err := flagzListTemplate.Execute(resp, flagSetJSON); err != nil {
-			log.Fatalf("Bad template evaluation: %v", err)
-		}
+func (e *StatusEndpoint) isReadOnly() bool {
+	if e.readOnlyFlag == "" {
+		return false
+	}
+	f := e.flagSet.Lookup(e.readOnlyFlag)
+	if f == nil {
+		return false
+	}
+	readOnly, err := strconv.ParseBool(f.Value.String())
+	// a read-only flag that can't be understood errs on the safe side.
+	return err != nil || readOnly
+}
+
+// actorOf identifies who made the request, see `WithActor`.
+func (e *StatusEndpoint) actorOf(req *http.Request) string {
+	if e.actor != nil {
+		return e.actor(req)
+	}
+	return req.RemoteAddr
+}
+
+// prepareSetForms issues the CSRF token for the set forms of the HTML page, and marks the flags that can be changed.
+func (e *StatusEndpoint) prepareSetForms(resp http.ResponseWriter, req *http.Request, flagSetJSON *flagSetJSON) {
+	if (e.authorizer == nil && e.writeAuth == nil) || e.setPath == "" || e.isReadOnly() {
+		return
+	}
+	token := ""
+	if cookie, err := req.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+		token = cookie.Value
 	} else {
-		resp.Header().Add("Content-Type", "application/json")
-		out, err := json.MarshalIndent(&flagSetJSON, "", "  ")
-		if err != nil {
-			resp.WriteHeader(http.StatusInternalServerError)
+		raw := make([]byte, 16)
+		if _, err := rand.Read(raw); err != nil {
 			return
 		}
-		resp.WriteHeader(http.StatusOK)
-		resp.Write(out)
+		token = hex.EncodeToString(raw)
+		http.SetCookie(resp, &http.Cookie{Name: csrfCookieName, Value: token, Path: "/", HttpOnly: true})
+	}
+	flagSetJSON.SetPath = e.setPath
+	flagSetJSON.CSRFToken = token
+	for _, fj := range flagSetJSON.Flags {
+		f := e.flagSet.Lookup(fj.Name)
+		fj.IsSettable = fj.IsDynamic && !IsFlagWriteLocked(f) && !IsFlagImmutable(f) && fj.Name != e.readOnlyFlag
+	}
+}
+
+// validCSRF checks that the request carries the CSRF header, or the token matching its CSRF cookie (double-submit).
+func validCSRF(req *http.Request) bool {
+	if req.Header.Get(CSRFHeader) != "" {
+		return true
+	}
+	cookie, err := req.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.FormValue(csrfFormField))) == 1
+}
+
+// sortFlagsJSON orders the flags by `key`, keeping the by-name order of `VisitAll` for equal and unknown keys.
+func sortFlagsJSON(flags []*flagJSON, key string) {
+	var less func(a, b *flagJSON) bool
+	switch key {
+	case "type":
+		less = func(a, b *flagJSON) bool { return a.Type < b.Type }
+	case "changed":
+		less = func(a, b *flagJSON) bool { return a.IsChanged && !b.IsChanged }
+	case "last_changed":
+		// RFC3339 timestamps sort lexically, most recently changed go first.
+		less = func(a, b *flagJSON) bool { return a.LastChanged > b.LastChanged }
+	case "source":
+		less = func(a, b *flagJSON) bool { return a.Source > b.Source }
+	default:
+		return
+	}
+	sort.Stable(&flagsJSONSorter{flags: flags, less: less})
+}
+
+type flagsJSONSorter struct {
+	flags []*flagJSON
+	less  func(a, b *flagJSON) bool
+}
+
+func (s *flagsJSONSorter) Len() int           { return len(s.flags) }
+func (s *flagsJSONSorter) Swap(i, j int)      { s.flags[i], s.flags[j] = s.flags[j], s.flags[i] }
+func (s *flagsJSONSorter) Less(i, j int) bool { return s.less(s.flags[i], s.flags[j]) }
+
+func writeFlagsHTML(resp http.ResponseWriter, flagSetJSON *flagSetJSON) {
+	resp.Header().Add("Content-Type", "text/html")
+	resp.WriteHeader(http.StatusOK)
+	if err := flagzListTemplate.Execute(resp, flagSetJSON); err != nil {
+		log.Fatalf("Bad template evaluation: %v", err)
 	}
 }
 
+func writeFlagsJSON(resp http.ResponseWriter, flagSetJSON *flagSetJSON) {
+	resp.Header().Add("Content-Type", "application/json")
+	out, err := json.MarshalIndent(&flagSetJSON, "", "  ")
+	if err != nil {
+		resp.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp.WriteHeader(http.StatusOK)
+	resp.Write(out)
+}
+
 func requestIsBrowser(req *http.Request) bool {
 	return strings.Contains(req.Header.Get("Accept"), "html")
 }
@@ -87,20 +505,45 @@ var (
 	This page presents the configuration flags of this server (<a href="?format=json">JSON</a>).
 	</p>
 	<p>
-	You can easily filter only <a href="?only_changed=true"><span class="label label-primary">changed</span> flagz</a> or filter flags by type:
+	You can easily filter only <a href="?only_changed=true"><span class="label label-primary">changed</span> flagz</a>, the ones <a href="?only_non_default=true">differing from defaults</a> or filter flags by type:
 	</p>
 	<ul>
 	  <li><a href="?type=dynamic"><span class="label label-success">dynamic</span></a> - flags tweakable by etcd - checksum <code>{{ .ChecksumDynamic }}</code></li>
 	  <li><a href="?type=static"><span class="label label-default">static</span></a> - initialization-time only flags - checksum <code>{{ .ChecksumStatic }}</code></li>
 	</ul>
-
+	<p>
+	Checksum of all flags: <code>{{ .Checksum }}</code>
+	</p>
+	<form class="form-inline" method="GET" style="margin-bottom: 20px">
+	  <input type="text" class="form-control" name="name" placeholder="name contains" value="{{ .Filter.Name }}">
+	  <input type="text" class="form-control" name="tag" placeholder="tag" value="{{ .Filter.Tag }}">
+	  <select class="form-control" name="type">
+	    <option value="">all types</option>
+	    <option value="dynamic"{{ if eq .Filter.Type "dynamic" }} selected{{ end }}>dynamic</option>
+	    <option value="static"{{ if eq .Filter.Type "static" }} selected{{ end }}>static</option>
+	  </select>
+	  <label class="checkbox-inline"><input type="checkbox" name="only_changed" value="true"{{ if .Filter.OnlyChanged }} checked{{ end }}> changed</label>
+	  <label class="checkbox-inline"><input type="checkbox" name="only_non_default" value="true"{{ if .Filter.OnlyNonDefault }} checked{{ end }}> non-default</label>
+	  <select class="form-control" name="sort">
+	    <option value="name">sort by name</option>
+	    <option value="type"{{ if eq .Filter.Sort "type" }} selected{{ end }}>sort by type</option>
+	    <option value="changed"{{ if eq .Filter.Sort "changed" }} selected{{ end }}>changed first</option>
+	    <option value="last_changed"{{ if eq .Filter.Sort "last_changed" }} selected{{ end }}>recently changed first</option>
+	    <option value="source"{{ if eq .Filter.Sort "source" }} selected{{ end }}>sort by source</option>
+	  </select>
+	  <button type="submit" class="btn btn-default">Filter</button>
+	  <a href="?">reset</a>
+	</form>
+	<p>Showing {{ len .Flags }} flags.</p>
 
 
 	{{range $flag := .Flags }}
 		<div class="panel panel-default">
           <div class="panel-heading">
             <code>{{ $flag.Name }}</code>
+            <span class="label label-info">{{ $flag.Type }}</span>
             {{ if $flag.IsChanged }}<span class="label label-primary">changed</span>{{ end }}
+            {{ range $key, $values := $flag.Tags }}<a href="?tag={{ $key }}"><span class="label label-warning">{{ $key }}</span></a> {{ end }}
             {{ if $flag.IsDynamic }}
                 <span class="label label-success">dynamic</span>
             {{ else }}
@@ -112,35 +555,134 @@ var (
 		    <dl class="dl-horizontal" style="margin-bottom: 0px">
 			  <dt>Description</dt>
 			  <dd><small>{{ $flag.Description }}</small></dd>
+			  {{ with $flag.Docs }}
+			  {{ if .Details }}
+			  <dt>Details</dt>
+			  <dd><p style="white-space: pre-wrap">{{ .Details }}</p></dd>
+			  {{ end }}
+			  {{ if .Examples }}
+			  <dt>Examples</dt>
+			  <dd>{{ range $example := .Examples }}<code>{{ $example }}</code> {{ end }}</dd>
+			  {{ end }}
+			  {{ if .Links }}
+			  <dt>Links</dt>
+			  <dd>{{ range $link := .Links }}<a href="{{ $link }}">{{ $link }}</a><br>{{ end }}</dd>
+			  {{ end }}
+			  {{ end }}
+			  {{ if $flag.Format }}
+			  <dt>Format</dt>
+			  <dd><small>{{ $flag.Format }}</small></dd>
+			  {{ end }}
 			  <dt>Default</dt>
 			  <dd><pre style="font-size: 8pt">{{ $flag.DefaultValue }}</pre></dd>
 			  <dt>Current</dt>
-			  <dd><pre class="success" style="font-size: 8pt">{{ $flag.CurrentValue }}</pre></dd>
+			  <dd><pre class="success" style="font-size: 8pt" id="flagz-current-{{ $flag.Name }}">{{ $flag.CurrentValue }}</pre></dd>
+			  {{ if $flag.Schema }}
+			  <dt>Schema</dt>
+			  <dd><details><summary><small>JSON Schema</small></summary><pre style="font-size: 8pt">{{ printf "%s" $flag.Schema }}</pre></details></dd>
+			  {{ end }}
+			  {{ if $flag.Source }}
+			  <dt>Source</dt>
+			  <dd><small>{{ $flag.Source }}</small></dd>
+			  {{ end }}
+			  {{ if $flag.LastChanged }}
+			  <dt>Last changed</dt>
+			  <dd><small>{{ $flag.LastChanged }}</small></dd>
+			  {{ end }}
+			  {{ if $flag.Pinned }}
+			  <dt>Pinned</dt>
+			  <dd>
+			    <small>{{ with $flag.Held }}holding <code>{{ .Value }}</code> from {{ .Source }}{{ else }}no updates held{{ end }}</small>
+			    {{ if $flag.IsSettable }}
+			    <form class="form-inline" method="POST" action="{{ $.SetPath }}" style="display: inline">
+			      <input type="hidden" name="name" value="{{ $flag.Name }}">
+			      <input type="hidden" name="csrf_token" value="{{ $.CSRFToken }}">
+			      <input type="hidden" name="unpin" value="true">
+			      <button type="submit" class="btn btn-default btn-xs">Unpin</button>
+			    </form>
+			    {{ end }}
+			  </dd>
+			  {{ end }}
+			  {{ if $flag.IsSettable }}
+			  <dt>Set</dt>
+			  <dd>
+			    <form class="form-inline" method="POST" action="{{ $.SetPath }}">
+			      <input type="hidden" name="name" value="{{ $flag.Name }}">
+			      <input type="hidden" name="csrf_token" value="{{ $.CSRFToken }}">
+			      <input type="text" class="form-control input-sm" name="value">
+			      <label class="checkbox-inline"><input type="checkbox" name="pin" value="true"> Pin</label>
+			      <button type="submit" class="btn btn-warning btn-sm">Set</button>
+			    </form>
+			  </dd>
+			  {{ end }}
 		    </dl>
 		  </div>
 		</div>
 	{{end}}
 </div></div>
+{{ if .StreamPath }}
+<script>
+	new EventSource("{{ .StreamPath }}").addEventListener("flag_change", function(e) {
+		var f = JSON.parse(e.data);
+		var el = document.getElementById("flagz-current-" + f.name);
+		if (el) { el.textContent = f.current_value; }
+	});
+</script>
+{{ end }}
 </body>
 </html>
 `))
 )
 
 type flagSetJSON struct {
+	Checksum        string `json:"checksum"`
 	ChecksumStatic  string `json:"checksum_static"`
 	ChecksumDynamic string `json:"checksum_dynamic"`
+	StreamPath      string `json:"-"`
+	// Filter is the filtering requested, used to fill in the filter form of the HTML page.
+	Filter flagFilterJSON `json:"-"`
+	// SetPath and CSRFToken are used by the set forms of the HTML page.
+	SetPath   string `json:"-"`
+	CSRFToken string `json:"-"`
 
 	Flags []*flagJSON `json:"flags"`
 }
 
+type flagFilterJSON struct {
+	Name           string
+	Tag            string
+	Type           string
+	OnlyChanged    bool
+	OnlyNonDefault bool
+	Sort           string
+}
+
 type flagJSON struct {
 	Name         string `json:"name"`
 	Description  string `json:"description"`
 	CurrentValue string `json:"current_value"`
 	DefaultValue string `json:"default_value"`
+	Type         string `json:"type"`
+	// LastChanged is only known for dynamic flags that were set after creation.
+	LastChanged string `json:"last_changed,omitempty"`
+	// Source is where the current value came from, see `SetFlagFromSource`.
+	Source string `json:"source,omitempty"`
+	// Tags are the user annotations of the flag (see `FlagSet.SetAnnotation`), without the ones internal to flagz.
+	Tags map[string][]string `json:"tags,omitempty"`
+	// Docs is the long-form documentation of the flag, see `SetFlagDocs`.
+	Docs *FlagDocs `json:"docs,omitempty"`
+	// Format hints at the format of values, see `FlagFormatHint`.
+	Format string `json:"format,omitempty"`
+	// Schema is the JSON Schema of the inputs of flags with structured values, see `JSONSchemaProvider`.
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// Pinned marks flags pinned with `PinFlag`, and Held is the update held since, if any.
+	Pinned bool        `json:"pinned,omitempty"`
+	Held   *HeldUpdate `json:"held,omitempty"`
 
 	IsChanged bool `json:"is_changed"`
 	IsDynamic bool `json:"is_dynamic"`
+	// IsSettable marks the flags that get a set form on the HTML page.
+	IsSettable bool `json:"-"`
 }
 
 func flagToJSON(f *flag.Flag) *flagJSON {
@@ -149,10 +691,41 @@ func flagToJSON(f *flag.Flag) *flagJSON {
 		Description:  f.Usage,
 		CurrentValue: f.Value.String(),
 		DefaultValue: f.DefValue,
+		Type:         f.Value.Type(),
 		IsChanged:    f.Changed,
 		IsDynamic:    IsFlagDynamic(f),
+		Source:       FlagSource(f),
+		Docs:         GetFlagDocs(f),
+		Format:       FlagFormatHint(f),
+	}
+	for key, values := range f.Annotations {
+		if strings.HasPrefix(key, "__") {
+			continue
+		}
+		if fj.Tags == nil {
+			fj.Tags = make(map[string][]string)
+		}
+		fj.Tags[key] = values
+	}
+	if schema := FlagJSONSchema(f); schema != nil {
+		if out, err := json.MarshalIndent(schema, "", "  "); err == nil {
+			fj.Schema = out
+		}
+	}
+	if IsFlagPinned(f) {
+		fj.Pinned = true
+		if held, ok := FlagHeldUpdate(f); ok {
+			held.Value = RedactFlagValue(f, held.Value)
+			fj.Held = &held
+		}
+	}
+	if lc, ok := f.Value.(lastChanger); ok && !lc.LastChanged().IsZero() {
+		fj.LastChanged = lc.LastChanged().Format(time.RFC3339)
 	}
-	if strings.Contains(f.Value.Type(), "json") {
+	if IsFlagSecret(f) {
+		fj.CurrentValue = RedactedValue
+		fj.DefaultValue = RedactedValue
+	} else if strings.Contains(f.Value.Type(), "json") {
 		fj.CurrentValue = prettyPrintJSON(fj.CurrentValue)
 		fj.DefaultValue = prettyPrintJSON(fj.DefaultValue)
 	}
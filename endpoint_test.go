@@ -4,11 +4,17 @@
 package flagz
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	flag "github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
@@ -77,6 +83,38 @@ func (s *endpointTestSuite) TestReturnsOnlyStaticAndChanged() {
 	s.assertListContainsOnly([]string{"some_static_string"}, list)
 }
 
+func (s *endpointTestSuite) TestFiltersByNameSubstring() {
+	req, _ := http.NewRequest("GET", "/debug/flagz?name=DYN_S", nil)
+	list := s.processFlagSetJSONResponse(req)
+	s.assertListContainsOnly([]string{"some_dyn_stringslice"}, list)
+}
+
+func (s *endpointTestSuite) TestFiltersByTag() {
+	require.NoError(s.T(), s.flagSet.SetAnnotation("some_static_float", "owner", []string{"team-foo"}))
+	req, _ := http.NewRequest("GET", "/debug/flagz?tag=owner", nil)
+	s.assertListContainsOnly([]string{"some_static_float"}, s.processFlagSetJSONResponse(req))
+	req, _ = http.NewRequest("GET", "/debug/flagz?tag=__is_dynamic", nil)
+	s.assertListContainsOnly([]string{}, s.processFlagSetJSONResponse(req))
+}
+
+func (s *endpointTestSuite) TestSortsFlags() {
+	req, _ := http.NewRequest("GET", "/debug/flagz?sort=changed", nil)
+	list := s.processFlagSetJSONResponse(req)
+	require.Len(s.T(), list.Flags, 4)
+	assert.Equal(s.T(), "some_dyn_stringslice", list.Flags[0].Name, "changed flags must go first, in name order")
+	assert.Equal(s.T(), "some_static_string", list.Flags[1].Name, "changed flags must go first, in name order")
+	assert.Equal(s.T(), "some_dyn_json", list.Flags[2].Name, "unchanged flags must keep name order")
+}
+
+func (s *endpointTestSuite) TestHTMLFilterFormEscapesInput() {
+	req, _ := http.NewRequest("GET", "/debug/flagz?name=%3Cscript%3E&sort=type", nil)
+	resp := httptest.NewRecorder()
+	s.endpoint.ServeHTTP(resp, req)
+	assert.NotContains(s.T(), resp.Body.String(), "<script>", "filter input must be escaped")
+	assert.Contains(s.T(), resp.Body.String(), `value="type" selected`, "requested sorting must be preselected")
+	assert.Contains(s.T(), resp.Body.String(), "Showing 0 flags.")
+}
+
 func (s *endpointTestSuite) TestCorrectlyRepresentsResources() {
 	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
 	list := s.processFlagSetJSONResponse(req)
@@ -87,26 +125,108 @@ func (s *endpointTestSuite) TestCorrectlyRepresentsResources() {
 			Description:  "Some static int text",
 			CurrentValue: "3.14",
 			DefaultValue: "3.14",
+			Type:         "float32",
 			IsChanged:    false,
 			IsDynamic:    false,
 		},
 		findFlagInFlagSetJSON("some_static_float", list),
 		"must correctly represent a static unchanged flag",
 	)
+	dynFlag := findFlagInFlagSetJSON("some_dyn_stringslice", list)
+	require.NotEmpty(s.T(), dynFlag.LastChanged, "dynamic changed flag must have a last change time")
+	dynFlag.LastChanged = ""
 	assert.Equal(s.T(),
 		&flagJSON{
 			Name:         "some_dyn_stringslice",
 			Description:  "Some dynamic slice text",
 			CurrentValue: "[car star]",
 			DefaultValue: "[foo bar]",
+			Type:         "dyn_stringslice",
+			Format:       "comma-separated list like a,b,c",
 			IsChanged:    true,
 			IsDynamic:    true,
 		},
-		findFlagInFlagSetJSON("some_dyn_stringslice", list),
+		dynFlag,
 		"must correctly represent a dynamic changed flag",
 	)
 }
 
+func (s *endpointTestSuite) TestJSONIncludesTagsAndChecksums() {
+	require.NoError(s.T(), s.flagSet.SetAnnotation("some_dyn_json", "owner", []string{"team-foo"}))
+	req, _ := http.NewRequest("GET", "/debug/flagz?format=json", nil)
+	req.Header.Add("Accept", "text/html")
+	list := s.processFlagSetJSONResponse(req)
+
+	assert.NotEmpty(s.T(), list.Checksum, "overall checksum must be present")
+	assert.Equal(s.T(), map[string][]string{"owner": {"team-foo"}}, findFlagInFlagSetJSON("some_dyn_json", list).Tags,
+		"user annotations must be listed as tags, without flagz internal ones")
+	assert.Nil(s.T(), findFlagInFlagSetJSON("some_static_float", list).Tags, "untagged flags must have no tags")
+}
+
+func (s *endpointTestSuite) TestRedactsSecrets() {
+	DynString(s.flagSet, "some_dyn_password", "hunter2", "Some secret text")
+	MarkFlagSecret(s.flagSet.Lookup("some_dyn_password"))
+	req, _ := http.NewRequest("GET", "/debug/flagz?format=json", nil)
+	fj := findFlagInFlagSetJSON("some_dyn_password", s.processFlagSetJSONResponse(req))
+	assert.Equal(s.T(), RedactedValue, fj.CurrentValue, "secret values must be redacted")
+	assert.Equal(s.T(), RedactedValue, fj.DefaultValue, "secret defaults must be redacted")
+
+	req, _ = http.NewRequest("GET", "/debug/flagz", nil)
+	resp := httptest.NewRecorder()
+	s.endpoint.ServeHTTP(resp, req)
+	assert.NotContains(s.T(), resp.Body.String(), "hunter2", "secret values must not be shown on the page")
+}
+
+func (s *endpointTestSuite) TestRendersFlagDocs() {
+	SetFlagDocs(s.flagSet.Lookup("some_dyn_json"), FlagDocs{
+		Details:  "Safe to change <anytime>.",
+		Examples: []string{`{"string": "foo"}`},
+		Links:    []string{"https://example.com/runbook"},
+	})
+	req, _ := http.NewRequest("GET", "/debug/flagz?format=json", nil)
+	fj := findFlagInFlagSetJSON("some_dyn_json", s.processFlagSetJSONResponse(req))
+	require.NotNil(s.T(), fj.Docs, "docs must be listed in JSON")
+	assert.Equal(s.T(), "Safe to change <anytime>.", fj.Docs.Details)
+	assert.Nil(s.T(), findFlagInFlagSetJSON("some_static_float", s.processFlagSetJSONResponse(req)).Docs)
+
+	req, _ = http.NewRequest("GET", "/debug/flagz", nil)
+	resp := httptest.NewRecorder()
+	s.endpoint.ServeHTTP(resp, req)
+	assert.Contains(s.T(), resp.Body.String(), "Safe to change &lt;anytime&gt;.", "details must be rendered escaped")
+	assert.Contains(s.T(), resp.Body.String(), `<a href="https://example.com/runbook">`, "links must be rendered")
+}
+
+func (s *endpointTestSuite) TestListsJSONSchema() {
+	req, _ := http.NewRequest("GET", "/debug/flagz?format=json", nil)
+	list := s.processFlagSetJSONResponse(req)
+	fj := findFlagInFlagSetJSON("some_dyn_json", list)
+	require.NotEmpty(s.T(), fj.Schema, "structured flags must list their schema")
+	schema := map[string]interface{}{}
+	require.NoError(s.T(), json.Unmarshal(fj.Schema, &schema))
+	assert.Contains(s.T(), schema["properties"], "string")
+	assert.Empty(s.T(), findFlagInFlagSetJSON("some_static_float", list).Schema)
+
+	req, _ = http.NewRequest("GET", "/debug/flagz", nil)
+	resp := httptest.NewRecorder()
+	s.endpoint.ServeHTTP(resp, req)
+	assert.Contains(s.T(), resp.Body.String(), "JSON Schema", "schema must be rendered")
+}
+
+func (s *endpointTestSuite) TestDiffFromDefaultsListsOverrides() {
+	// setting the default value again marks the flag changed, but not different from its default.
+	s.flagSet.Set("some_static_float", "3.14")
+	require.NoError(s.T(), SetFlagFromSource(s.flagSet, "some_dyn_json", `{"string": "bar", "json": 1}`, "etcd"))
+	req, _ := http.NewRequest("GET", "/debug/flagz/diff", nil)
+	resp := httptest.NewRecorder()
+	s.endpoint.DiffFromDefaults(resp, req)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+	list := &flagSetJSON{}
+	require.NoError(s.T(), json.Unmarshal(resp.Body.Bytes(), list), "unmarshaling JSON response must succeed")
+	s.assertListContainsOnly([]string{"some_static_string", "some_dyn_stringslice", "some_dyn_json"}, list)
+	assert.Equal(s.T(), "etcd", findFlagInFlagSetJSON("some_dyn_json", list).Source, "source of the override must be listed")
+	assert.Equal(s.T(), "", findFlagInFlagSetJSON("some_static_string", list).Source)
+}
+
 func (s *endpointTestSuite) TestServesHTML() {
 	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
 	req.Header.Add("Accept", "application/xhtml+xml")
@@ -120,6 +240,277 @@ func (s *endpointTestSuite) TestServesHTML() {
 	assert.Contains(s.T(), out, "some_dyn_stringslice")
 }
 
+func (s *endpointTestSuite) TestServesHTMLEscapingValues() {
+	s.flagSet.Set("some_dyn_stringslice", "<script>alert(1)</script>")
+	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
+	resp := httptest.NewRecorder()
+	s.endpoint.ServeHTTP(resp, req)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+
+	out := resp.Body.String()
+	assert.NotContains(s.T(), out, "<script>alert(1)</script>", "values must not be rendered raw")
+	assert.Contains(s.T(), out, "&lt;script&gt;alert(1)&lt;/script&gt;", "values must be escaped")
+}
+
+func (s *endpointTestSuite) TestServeHTTPRendersStatusPage() {
+	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
+	resp := httptest.NewRecorder()
+	s.endpoint.ServeHTTP(resp, req)
+	require.Equal(s.T(), http.StatusOK, resp.Code, "status page request must return 200 OK")
+	require.Contains(s.T(), resp.Header().Get("Content-Type"), "html", "must render html without an Accept header")
+
+	out := resp.Body.String()
+	assert.Contains(s.T(), out, "dyn_stringslice", "must show flag types")
+	assert.Contains(s.T(), out, "Last changed", "must show last change times of changed dynamic flags")
+
+	req, _ = http.NewRequest("GET", "/debug/flagz?format=json", nil)
+	resp = httptest.NewRecorder()
+	s.endpoint.ServeHTTP(resp, req)
+	assert.Equal(s.T(), "application/json", resp.Header().Get("Content-Type"), "format=json must still be honoured")
+}
+
+func (s *endpointTestSuite) TestSetFlagDisabledByDefault() {
+	resp := s.postSetFlag("some_dyn_stringslice", "a,b")
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code, "setting must be rejected without an authorizer")
+	assert.Equal(s.T(), "[car star]", s.flagSet.Lookup("some_dyn_stringslice").Value.String(), "value must be unchanged")
+}
+
+func (s *endpointTestSuite) TestSetFlagAppliesAuthorizedChanges() {
+	s.endpoint.WithSetAuthorizer(func(req *http.Request, flagName string) error {
+		if req.Header.Get("X-Test-User") != "admin" {
+			return fmt.Errorf("only admins may set flags")
+		}
+		return nil
+	})
+	resp := s.postSetFlag("some_dyn_stringslice", "a,b")
+	require.Equal(s.T(), http.StatusOK, resp.Code, "authorized changes must succeed: %v", resp.Body.String())
+	fj := &flagJSON{}
+	require.NoError(s.T(), json.Unmarshal(resp.Body.Bytes(), fj), "response must be the JSON of the flag")
+	assert.Equal(s.T(), "[a b]", fj.CurrentValue)
+
+	assert.Equal(s.T(), http.StatusBadRequest, s.postSetFlag("some_static_string", "foo").Code, "static flags must be rejected")
+	assert.Equal(s.T(), http.StatusNotFound, s.postSetFlag("no_such_flag", "foo").Code, "unknown flags must be rejected")
+	assert.Equal(s.T(), http.StatusBadRequest, s.postSetFlag("some_dyn_json", "notjson").Code, "bad values must be rejected")
+
+	req, _ := http.NewRequest("POST", "/debug/flagz/set", strings.NewReader(url.Values{"name": {"some_dyn_stringslice"}, "value": {"c"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(CSRFHeader, "1")
+	unauthorized := httptest.NewRecorder()
+	s.endpoint.SetFlag(unauthorized, req)
+	assert.Equal(s.T(), http.StatusForbidden, unauthorized.Code, "changes denied by the authorizer must be rejected")
+
+	get, _ := http.NewRequest("GET", "/debug/flagz/set?name=some_dyn_stringslice&value=c", nil)
+	getResp := httptest.NewRecorder()
+	s.endpoint.SetFlag(getResp, get)
+	assert.Equal(s.T(), http.StatusMethodNotAllowed, getResp.Code, "only POST must be accepted")
+}
+
+func (s *endpointTestSuite) TestSetFlagPinsAndUnpins() {
+	logger := &endpointLogger{}
+	s.endpoint.WithSetAuthorizer(func(req *http.Request, flagName string) error { return nil }).WithLogger(logger)
+	resp := s.postSetFlagForm(url.Values{"name": {"some_dyn_stringslice"}, "value": {"a,b"}, "pin": {"true"}})
+	require.Equal(s.T(), http.StatusOK, resp.Code, "pinning changes must succeed: %v", resp.Body.String())
+	fj := &flagJSON{}
+	require.NoError(s.T(), json.Unmarshal(resp.Body.Bytes(), fj))
+	assert.True(s.T(), fj.Pinned, "the flag must be reported as pinned")
+
+	require.Equal(s.T(), ErrFlagPinned, SetFlagFromSource(s.flagSet, "some_dyn_stringslice", "c,d", "etcd"))
+	assert.Equal(s.T(), "[a b]", s.flagSet.Lookup("some_dyn_stringslice").Value.String(), "the pin must hold the value")
+	fj = flagToJSON(s.flagSet.Lookup("some_dyn_stringslice"))
+	require.NotNil(s.T(), fj.Held, "the held update must be reported")
+	assert.Equal(s.T(), "c,d", fj.Held.Value)
+
+	resp = s.postSetFlagForm(url.Values{"name": {"some_dyn_stringslice"}, "unpin": {"true"}})
+	require.Equal(s.T(), http.StatusOK, resp.Code, "unpinning must succeed: %v", resp.Body.String())
+	assert.Equal(s.T(), "[c d]", s.flagSet.Lookup("some_dyn_stringslice").Value.String(), "the held value must apply")
+	assert.False(s.T(), IsFlagPinned(s.flagSet.Lookup("some_dyn_stringslice")))
+	require.Len(s.T(), logger.lines, 3, "changes must be logged to the logger of the endpoint")
+	assert.Contains(s.T(), logger.lines[1], "flag=some_dyn_stringslice pinned")
+	assert.Contains(s.T(), logger.lines[2], "flag=some_dyn_stringslice unpinned")
+}
+
+type endpointTestKey struct{}
+
+func (s *endpointTestSuite) TestSetFlagPassesRequestContextToValidators() {
+	var info UpdateInfo
+	var user interface{}
+	s.flagSet.Lookup("some_dyn_stringslice").Value.(*DynStringSliceValue).WithValidatorCtx(
+		func(ctx context.Context, value []string) error {
+			info, _ = UpdateInfoFromContext(ctx)
+			user = ctx.Value(endpointTestKey{})
+			return nil
+		})
+	s.endpoint.WithSetAuthorizer(func(req *http.Request, flagName string) error { return nil })
+	form := url.Values{"name": {"some_dyn_stringslice"}, "value": {"a,b"}}
+	req, _ := http.NewRequest("POST", "/debug/flagz/set", strings.NewReader(form.Encode()))
+	req = req.WithContext(context.WithValue(req.Context(), endpointTestKey{}, "admin"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(CSRFHeader, "1")
+	resp := httptest.NewRecorder()
+	s.endpoint.SetFlag(resp, req)
+	require.Equal(s.T(), http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(s.T(), UpdateInfo{FlagName: "some_dyn_stringslice", Source: "endpoint"}, info)
+	assert.Equal(s.T(), "admin", user, "validators must get the context of the request")
+}
+
+func (s *endpointTestSuite) TestSetFlagRequiresCSRFToken() {
+	s.endpoint.WithSetAuthorizer(func(req *http.Request, flagName string) error { return nil }).WithSetPath("/debug/flagz/set")
+	page, _ := http.NewRequest("GET", "/debug/flagz", nil)
+	pageResp := httptest.NewRecorder()
+	s.endpoint.ServeHTTP(pageResp, page)
+	cookies := (&http.Response{Header: pageResp.Header()}).Cookies()
+	require.Len(s.T(), cookies, 1, "the page must issue a CSRF cookie")
+	assert.Contains(s.T(), pageResp.Body.String(), `name="csrf_token" value="`+cookies[0].Value+`"`, "set forms must carry the token")
+	assert.Contains(s.T(), pageResp.Body.String(), `action="/debug/flagz/set"`, "set forms must post to the set path")
+
+	post := func(token string) int {
+		form := url.Values{"name": {"some_dyn_stringslice"}, "value": {"a,b"}, "csrf_token": {token}}
+		req, _ := http.NewRequest("POST", "/debug/flagz/set", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookies[0])
+		resp := httptest.NewRecorder()
+		s.endpoint.SetFlag(resp, req)
+		return resp.Code
+	}
+	assert.Equal(s.T(), http.StatusForbidden, post(""), "form posts without a token must be rejected")
+	assert.Equal(s.T(), http.StatusForbidden, post("forged"), "form posts with a bad token must be rejected")
+	assert.Equal(s.T(), http.StatusOK, post(cookies[0].Value), "form posts with the issued token must succeed")
+}
+
+func (s *endpointTestSuite) TestSetFlagHonoursReadOnlyAndWriteLocks() {
+	readOnly := s.flagSet.Bool("flagz_read_only", false, "Some read-only switch")
+	s.endpoint.WithSetAuthorizer(func(req *http.Request, flagName string) error { return nil }).WithReadOnlyFlag("flagz_read_only")
+	MarkFlagWriteLocked(s.flagSet.Lookup("some_dyn_json"))
+	assert.Equal(s.T(), http.StatusForbidden, s.postSetFlag("some_dyn_json", `{}`).Code, "write locked flags must be rejected")
+	assert.Equal(s.T(), http.StatusForbidden, s.postSetFlag("flagz_read_only", "true").Code, "the read-only flag must not be settable")
+	assert.Equal(s.T(), http.StatusOK, s.postSetFlag("some_dyn_stringslice", "a,b").Code)
+
+	*readOnly = true
+	assert.Equal(s.T(), http.StatusForbidden, s.postSetFlag("some_dyn_stringslice", "c,d").Code, "changes must be rejected while read-only")
+	assert.Equal(s.T(), "[a b]", s.flagSet.Lookup("some_dyn_stringslice").Value.String(), "value must be unchanged")
+}
+
+func (s *endpointTestSuite) TestSetFlagRejectsImmutableFlags() {
+	s.endpoint.WithSetAuthorizer(func(req *http.Request, flagName string) error { return nil })
+	MarkFlagImmutable(s.flagSet.Lookup("some_dyn_json"))
+	assert.Equal(s.T(), http.StatusForbidden, s.postSetFlag("some_dyn_json", `{}`).Code, "immutable flags must be rejected")
+	assert.Equal(s.T(), http.StatusOK, s.postSetFlag("some_dyn_stringslice", "a,b").Code)
+}
+
+func (s *endpointTestSuite) TestSetFlagIsAudited() {
+	records := []AuditRecord{}
+	s.endpoint.WithSetAuthorizer(func(req *http.Request, flagName string) error { return nil }).
+		WithActor(func(req *http.Request) string { return req.Header.Get("X-Test-User") }).
+		WithAuditSink(AuditSinkFunc(func(r AuditRecord) error {
+			records = append(records, r)
+			return nil
+		}))
+	require.Equal(s.T(), http.StatusOK, s.postSetFlag("some_dyn_stringslice", "a,b").Code)
+	require.Equal(s.T(), http.StatusBadRequest, s.postSetFlag("some_dyn_json", "notjson").Code)
+	require.Len(s.T(), records, 1, "only applied changes must be audited")
+	assert.Equal(s.T(), "some_dyn_stringslice", records[0].FlagName)
+	assert.Equal(s.T(), "[car star]", records[0].OldValue)
+	assert.Equal(s.T(), "[a b]", records[0].NewValue)
+	assert.Equal(s.T(), "admin", records[0].Actor)
+	assert.Equal(s.T(), "endpoint", records[0].Source)
+}
+
+func (s *endpointTestSuite) TestSetFlagConsultsWriteAuthorizer() {
+	requests := []WriteRequest{}
+	s.endpoint.WithActor(func(req *http.Request) string { return req.Header.Get("X-Test-User") }).
+		WithWriteAuthorizer(WriteAuthorizerFunc(func(ctx context.Context, req WriteRequest) error {
+			requests = append(requests, req)
+			if req.Value != "a,b" {
+				return fmt.Errorf("only a,b is allowed")
+			}
+			return nil
+		}))
+	require.Equal(s.T(), http.StatusOK, s.postSetFlag("some_dyn_stringslice", "a,b").Code, "the write authorizer alone must enable SetFlag")
+	assert.Equal(s.T(), http.StatusForbidden, s.postSetFlag("some_dyn_stringslice", "c").Code, "rejected changes must not be applied")
+	assert.Equal(s.T(), "[a b]", s.flagSet.Lookup("some_dyn_stringslice").Value.String())
+	assert.Equal(s.T(), []WriteRequest{
+		{Actor: "admin", FlagName: "some_dyn_stringslice", Value: "a,b", Source: "endpoint"},
+		{Actor: "admin", FlagName: "some_dyn_stringslice", Value: "c", Source: "endpoint"},
+	}, requests)
+}
+
+func (s *endpointTestSuite) TestSetFlagConsultsWriteAuthorizerOnUnpin() {
+	requests := []WriteRequest{}
+	s.endpoint.WithActor(func(req *http.Request) string { return req.Header.Get("X-Test-User") }).
+		WithWriteAuthorizer(WriteAuthorizerFunc(func(ctx context.Context, req WriteRequest) error {
+			requests = append(requests, req)
+			if req.Unpin {
+				return fmt.Errorf("unpinning is not allowed")
+			}
+			return nil
+		}))
+	resp := s.postSetFlagForm(url.Values{"name": {"some_dyn_stringslice"}, "value": {"a,b"}, "pin": {"true"}})
+	require.Equal(s.T(), http.StatusOK, resp.Code, "pinning changes must succeed: %v", resp.Body.String())
+	require.Equal(s.T(), ErrFlagPinned, SetFlagFromSource(s.flagSet, "some_dyn_stringslice", "c,d", "etcd"))
+
+	resp = s.postSetFlagForm(url.Values{"name": {"some_dyn_stringslice"}, "unpin": {"true"}})
+	assert.Equal(s.T(), http.StatusForbidden, resp.Code, "unpins denied by the write authorizer must be rejected")
+	f := s.flagSet.Lookup("some_dyn_stringslice")
+	assert.True(s.T(), IsFlagPinned(f), "denied unpins must keep the pin")
+	assert.Equal(s.T(), "[a b]", f.Value.String(), "denied unpins must not apply the held value")
+	require.Len(s.T(), requests, 2)
+	assert.Equal(s.T(), WriteRequest{Actor: "admin", FlagName: "some_dyn_stringslice", Value: "c,d", Source: "endpoint",
+		Unpin: true}, requests[1], "the held value must be authorized")
+}
+
+func (s *endpointTestSuite) TestStreamChangesPushesEvents() {
+	s.endpoint.WithStreamInterval(10 * time.Millisecond)
+	server := httptest.NewServer(http.HandlerFunc(s.endpoint.StreamChanges))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?type=dynamic")
+	require.NoError(s.T(), err, "stream request must succeed")
+	defer resp.Body.Close()
+	require.Equal(s.T(), "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+	_, err = reader.ReadString('\n')
+	require.NoError(s.T(), err, "stream must start with a comment")
+
+	// set the value directly, as FlagSet.Set also updates the non thread-safe "changed" state.
+	require.NoError(s.T(), s.flagSet.Lookup("some_dyn_stringslice").Value.Set("new,value"))
+	event, err := reader.ReadString('\n')
+	for err == nil && !strings.HasPrefix(event, "event:") {
+		event, err = reader.ReadString('\n')
+	}
+	require.NoError(s.T(), err, "an event must be streamed after the change")
+	assert.Equal(s.T(), "event: flag_change\n", event)
+	data, err := reader.ReadString('\n')
+	require.NoError(s.T(), err)
+	fj := &flagJSON{}
+	require.NoError(s.T(), json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), fj), "event data must be flag JSON")
+	assert.Equal(s.T(), "some_dyn_stringslice", fj.Name, "the changed flag must be streamed")
+	assert.Equal(s.T(), "[new value]", fj.CurrentValue)
+}
+
+func (s *endpointTestSuite) TestHTMLSubscribesToStream() {
+	s.endpoint.WithStreamPath("/debug/flagz/stream")
+	req, _ := http.NewRequest("GET", "/debug/flagz", nil)
+	resp := httptest.NewRecorder()
+	s.endpoint.ServeHTTP(resp, req)
+	// html/template escapes the path as a JS string.
+	assert.Contains(s.T(), resp.Body.String(), `new EventSource("\/debug\/flagz\/stream")`,
+		"page must subscribe to the stream")
+}
+
+func (s *endpointTestSuite) postSetFlag(name string, value string) *httptest.ResponseRecorder {
+	return s.postSetFlagForm(url.Values{"name": {name}, "value": {value}})
+}
+
+func (s *endpointTestSuite) postSetFlagForm(form url.Values) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/debug/flagz/set", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Test-User", "admin")
+	req.Header.Set(CSRFHeader, "1")
+	resp := httptest.NewRecorder()
+	s.endpoint.SetFlag(resp, req)
+	return resp
+}
+
 func (s *endpointTestSuite) processFlagSetJSONResponse(req *http.Request) *flagSetJSON {
 	resp := httptest.NewRecorder()
 	s.endpoint.ListFlags(resp, req)
@@ -152,3 +543,11 @@ type testJSON struct {
 	SomeString string `json:"string"`
 	SomeInt    int32  `json:"json"`
 }
+
+type endpointLogger struct {
+	lines []string
+}
+
+func (l *endpointLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,172 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	// ErrFlagNotFound is returned by Updaters for values of flags that aren't in the FlagSet.
+	ErrFlagNotFound = fmt.Errorf("flag not found")
+	// ErrFlagNotDynamic is returned by Updaters for values of static flags received after initialization, which only
+	// take effect on restart.
+	ErrFlagNotDynamic = fmt.Errorf("flag is not dynamic")
+	// ErrNoValue is returned by Updaters for keys of the source that hold no value, e.g. etcd directories or deleted
+	// keys.
+	ErrNoValue = fmt.Errorf("no value")
+	// ErrFlagOverridden is returned by Updaters for global values of flags overridden on this instance, see
+	// `InstanceOverridesDir`. The global value is applied once the override is removed.
+	ErrFlagOverridden = fmt.Errorf("flag is overridden on this instance")
+	// ErrFlagImmutable is returned, wrapped in a ValidationError, for changes of flags marked with `MarkFlagImmutable`
+	// once they have a value.
+	ErrFlagImmutable = fmt.Errorf("flag is immutable")
+	// ErrFlagPinned is returned by `SetFlagFromSource` for values of pinned flags that are held instead of applied, see
+	// `PinFlag`. Updaters skip them, rather than reporting them as applied.
+	ErrFlagPinned = fmt.Errorf("flag is pinned, the value is held until it is unpinned")
+)
+
+// FlagErrorKind is the category of a FlagError.
+type FlagErrorKind int
+
+const (
+	// FlagErrorNotFound is the kind of errors of values for flags that aren't in the FlagSet.
+	FlagErrorNotFound FlagErrorKind = iota
+	// FlagErrorParse is the kind of errors of values that the flag couldn't parse.
+	FlagErrorParse
+	// FlagErrorValidation is the kind of errors of values rejected by the flag's validator.
+	FlagErrorValidation
+)
+
+func (k FlagErrorKind) String() string {
+	switch k {
+	case FlagErrorNotFound:
+		return "not-found"
+	case FlagErrorParse:
+		return "parse"
+	case FlagErrorValidation:
+		return "validation"
+	}
+	return fmt.Sprintf("FlagErrorKind(%d)", int(k))
+}
+
+// ParseError is returned by the `Set` of dynamic flags for values that can't be parsed, e.g. malformed or oversized
+// inputs.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of parsing the value.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned by the `Set` of dynamic flags for values rejected by their validator, telling them
+// apart from values that don't parse.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error returned by the validator.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// FlagError is the failure of setting a single flag from a source.
+type FlagError struct {
+	Flag string
+	Kind FlagErrorKind
+	Err  error
+}
+
+// NewFlagError categorizes the error of setting flag `name`, as returned by `SetFlagFromSource` or `FlagSet.Set`.
+// Errors that are neither ErrFlagNotFound nor a ValidationError (e.g. of flags that aren't dynamic values) are
+// categorized as parse errors.
+func NewFlagError(name string, err error) *FlagError {
+	kind := FlagErrorParse
+	var notExist *flag.NotExistError
+	var validation *ValidationError
+	if errors.Is(err, ErrFlagNotFound) || errors.As(err, &notExist) {
+		kind = FlagErrorNotFound
+	} else if errors.As(err, &validation) {
+		kind = FlagErrorValidation
+	}
+	return &FlagError{Flag: name, Kind: kind, Err: err}
+}
+
+func (e *FlagError) Error() string {
+	return fmt.Sprintf("flag %v: %v", e.Flag, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *FlagError) Unwrap() error {
+	return e.Err
+}
+
+// FlagErrors is returned by `Initialize` of Updaters (and other bulk reads) that failed to set some of the flags, after
+// setting all the others.
+//
+// It unwraps to all of its FlagErrors, so `errors.Is` and `errors.As` match any of them.
+type FlagErrors struct {
+	// Source describes where the flags were read from, e.g. "etcd".
+	Source string
+	Errors []*FlagError
+}
+
+// Add records the failure of setting flag `name`, see `NewFlagError`.
+func (e *FlagErrors) Add(name string, err error) {
+	e.Errors = append(e.Errors, NewFlagError(name, err))
+}
+
+// OfKind returns the FlagErrors of the given kinds, e.g. to fail startup only on validation errors.
+func (e *FlagErrors) OfKind(kinds ...FlagErrorKind) []*FlagError {
+	out := []*FlagError{}
+	for _, fe := range e.Errors {
+		for _, kind := range kinds {
+			if fe.Kind == kind {
+				out = append(out, fe)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// ErrorOrNil returns `e` if any errors were added, and nil otherwise.
+func (e *FlagErrors) ErrorOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *FlagErrors) Error() string {
+	errorStrings := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		errorStrings[i] = fe.Error()
+	}
+	return fmt.Sprintf("flagz: encountered %d errors while parsing flags from %v: \n  %v",
+		len(errorStrings), e.Source, strings.Join(errorStrings, "\n  "))
+}
+
+// Unwrap returns all the FlagErrors.
+func (e *FlagErrors) Unwrap() []error {
+	out := make([]error, len(e.Errors))
+	for i, fe := range e.Errors {
+		out[i] = fe
+	}
+	return out
+}
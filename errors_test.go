@@ -0,0 +1,69 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagErrors_CategorizesFailures(t *testing.T) {
+	set := flag.NewFlagSet("errors_test", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_int", 5, "dynamic int").WithValidator(flagz.ValidateDynInt64Range(0, 10))
+	flagz.DynString(set, "some_secret", "hunter2", "dynamic secret").WithValidator(func(string) error {
+		return errors.New("too short")
+	})
+	flagz.MarkFlagSecret(set.Lookup("some_secret"))
+
+	errs := &flagz.FlagErrors{Source: "test"}
+	assert.NoError(t, errs.ErrorOrNil(), "no errors were added")
+	errs.Add("some_int", flagz.SetFlagFromSource(set, "some_int", "not_a_number", "test"))
+	errs.Add("some_int", flagz.SetFlagFromSource(set, "some_int", "11", "test"))
+	errs.Add("no_such_flag", flagz.SetFlagFromSource(set, "no_such_flag", "1", "test"))
+	errs.Add("other_flag", flagz.ErrFlagNotFound)
+	errs.Add("some_secret", flagz.SetFlagFromSource(set, "some_secret", "x", "test"))
+
+	kinds := []flagz.FlagErrorKind{}
+	for _, e := range errs.Errors {
+		kinds = append(kinds, e.Kind)
+	}
+	assert.Equal(t, []flagz.FlagErrorKind{
+		flagz.FlagErrorParse, flagz.FlagErrorValidation, flagz.FlagErrorNotFound, flagz.FlagErrorNotFound,
+		flagz.FlagErrorValidation,
+	}, kinds)
+	assert.Len(t, errs.OfKind(flagz.FlagErrorNotFound), 2)
+	assert.Len(t, errs.OfKind(flagz.FlagErrorParse, flagz.FlagErrorValidation), 3)
+	assert.NotContains(t, errs.Error(), "x\"", "secret values must stay redacted")
+	assert.Contains(t, errs.Error(), "encountered 5 errors while parsing flags from test")
+
+	var err error = errs
+	assert.True(t, errors.Is(err, flagz.ErrFlagNotFound), "errors.Is must match any of the flag errors")
+	var validation *flagz.ValidationError
+	assert.True(t, errors.As(err, &validation), "errors.As must match any of the flag errors")
+	var flagErr *flagz.FlagError
+	require.True(t, errors.As(err, &flagErr))
+	assert.Equal(t, "some_int", flagErr.Flag)
+	assert.Equal(t, "parse", flagErr.Kind.String())
+}
+
+func TestDynValues_ReturnTypedErrors(t *testing.T) {
+	set := flag.NewFlagSet("errors_test", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_int", 5, "dynamic int")
+	dynInt.WithValidator(flagz.ValidateDynInt64Range(0, 10))
+	dynJSON := flagz.DynJSON(set, "some_json", &struct{}{}, "dynamic json")
+	dynJSON.WithMaxSize(10)
+
+	var parseErr *flagz.ParseError
+	var validationErr *flagz.ValidationError
+	assert.True(t, errors.As(dynInt.Set("not_a_number"), &parseErr), "unparsable values must return a ParseError")
+	assert.False(t, errors.As(dynInt.Set("11"), &parseErr), "rejected values must not return a ParseError")
+	assert.True(t, errors.As(dynInt.Set("11"), &validationErr), "rejected values must return a ValidationError")
+	assert.True(t, errors.As(dynJSON.Set(`{"a": "very long"}`), &parseErr), "oversized values must return a ParseError")
+	assert.True(t, errors.As(set.Set("some_int", "x"), &parseErr), "errors must be kept through FlagSet.Set")
+}
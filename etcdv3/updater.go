@@ -0,0 +1,549 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package etcdv3 provides an Updater that syncs FlagSet state with keys under a prefix of the etcd v3 API.
+//
+// Unlike the v2 `watcher`, which reads the whole directory in a single response, the initial read is done in pages
+// of ranged reads pinned to a single revision, and flags are applied page by page. Trees with thousands of flags
+// therefore stay within the etcd response size limits.
+
+package etcdv3
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultPageSize   = 500
+	watchRetryBackoff = 1 * time.Second
+	ackTimeout        = 5 * time.Second
+	ackPollInterval   = 100 * time.Millisecond
+)
+
+func init() {
+	flagz.RegisterUpdater("etcdv3", newFromURL)
+}
+
+// Minimum logger interface needed.
+// Default "log" and "logrus" should support these.
+type loggerCompatible interface {
+	Printf(format string, v ...interface{})
+}
+
+// page is a single ranged read of keys under the prefix.
+type page struct {
+	kvs      []*mvccpb.KeyValue
+	more     bool
+	revision int64
+}
+
+// Updater syncs flag values from keys under an etcd v3 prefix into a given FlagSet, with each key named after a flag.
+// Keys with `/`-separated paths are mapped onto namespaces, e.g. `cache/ttl` onto the flag `cache.ttl` (see
+// `flagz.Namespace`). Flags may be overridden on single instances by keys under `<flag name>/__hosts/<instance ID>`, see
+// `flagz.InstanceOverridesDir`.
+type Updater struct {
+	*flagz.UpdaterTracker
+	flagSet  *flag.FlagSet
+	watcher  clientv3.Watcher
+	logger   loggerCompatible
+	prefix   string
+	pageSize int64
+	// signingKeys are the keys of the signatures values must carry, see `WithSigningKeys`.
+	signingKeys [][]byte
+	// decrypter decrypts encrypted values, see `WithDecrypter`.
+	decrypter flagz.Decrypter
+	// scheduler applies scheduled values, see `WithScheduler`.
+	scheduler *flagz.Scheduler
+	// instanceID decides whether the Updater applies canary values, see `WithInstanceID`.
+	instanceID string
+	overrides  *flagz.InstanceOverrides
+	// ackPrefix is the prefix of the keys of acks, see `WithAcks`.
+	ackPrefix string
+	// tracer traces the stages of applying values, see `WithTracer`.
+	tracer flagz.UpdateTracer
+	// queueCapacity and queuePolicy configure the queue of updates pending to be applied, see `WithUpdateQueue`.
+	queueCapacity int
+	queuePolicy   flagz.QueuePolicy
+	// putAck writes an ack key.
+	putAck func(ctx context.Context, key string, value string) error
+	// readPage reads up to `limit` keys in [`from`, end of prefix) at `revision` (0 for the latest one).
+	readPage func(ctx context.Context, from string, limit int64, revision int64) (*page, error)
+
+	// lifecycle serializes the lifecycle transitions, see `flagz.UpdaterState`.
+	lifecycle sync.Mutex
+	cancel    context.CancelFunc
+	// done is closed when the watching go routine exits.
+	done chan struct{}
+
+	// mu guards the revision, and serializes full reads with applying updates on the go routine of the update queue.
+	mu       sync.Mutex
+	revision int64
+}
+
+// New constructs a new Updater reading keys under `prefix` through `kv` and watching them through `watcher`, which
+// are usually the same `*clientv3.Client`.
+func New(set *flag.FlagSet, kv clientv3.KV, watcher clientv3.Watcher, prefix string, logger loggerCompatible) (*Updater, error) {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+	u := &Updater{
+		UpdaterTracker: flagz.NewUpdaterTracker(),
+		flagSet:        set,
+		watcher:        watcher,
+		logger:         logger,
+		prefix:         prefix,
+		pageSize:       defaultPageSize,
+		instanceID:     flagz.DefaultInstanceID(),
+		overrides:      flagz.NewInstanceOverrides(),
+		tracer:         flagz.NopUpdateTracer(),
+	}
+	u.readPage = func(ctx context.Context, from string, limit int64, revision int64) (*page, error) {
+		opts := []clientv3.OpOption{
+			clientv3.WithRange(clientv3.GetPrefixRangeEnd(prefix)),
+			clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+			clientv3.WithLimit(limit),
+		}
+		if revision != 0 {
+			opts = append(opts, clientv3.WithRev(revision))
+		}
+		resp, err := kv.Get(ctx, from, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &page{kvs: resp.Kvs, more: resp.More, revision: resp.Header.Revision}, nil
+	}
+	u.putAck = func(ctx context.Context, key string, value string) error {
+		_, err := kv.Put(ctx, key, value)
+		return err
+	}
+	return u, nil
+}
+
+// WithPageSize sets the maximum number of keys read in a single request. Defaults to 500.
+func (u *Updater) WithPageSize(keys int64) *Updater {
+	u.pageSize = keys
+	return u
+}
+
+// WithSigningKeys makes the Updater only apply values signed with any of `keys`, see `flagz.SignFlagValue`, so that
+// a compromised etcd writer can't inject arbitrary values. Unsigned and badly signed values are rejected and
+// reported in the Status.
+func (u *Updater) WithSigningKeys(keys ...[]byte) *Updater {
+	u.signingKeys = keys
+	return u
+}
+
+// WithDecrypter makes the Updater decrypt values with the `flagz.EncryptedValuePrefix` before setting them, so that
+// secrets can be stored encrypted in etcd, see `flagz.DynSecret`. Values that fail to decrypt are rejected. Signatures
+// (see `WithSigningKeys`) cover the encrypted values.
+func (u *Updater) WithDecrypter(decrypter flagz.Decrypter) *Updater {
+	u.decrypter = decrypter
+	return u
+}
+
+// WithScheduler makes the Updater hand values with the `flagz.ScheduledValuePrefix` to `scheduler`, which sets them as
+// their activation windows open and close. Writing an unscheduled value of a flag cancels its schedule. Signatures and
+// encryption (see `WithSigningKeys` and `WithDecrypter`) cover the whole scheduled value.
+func (u *Updater) WithScheduler(scheduler *flagz.Scheduler) *Updater {
+	u.scheduler = scheduler
+	return u
+}
+
+// WithInstanceID sets the ID of the instance hashed to decide whether the Updater applies values with the
+// `flagz.CanaryValuePrefix`, and whose overrides it applies. Defaults to `flagz.DefaultInstanceID`, the host name.
+func (u *Updater) WithInstanceID(instanceID string) *Updater {
+	u.instanceID = instanceID
+	return u
+}
+
+// WithAcks makes the Updater write a `flagz.UpdateAck` to `<prefix>/<flag name>/<instance ID>` after applying each
+// update, so that push tooling can block until a quorum of instances confirmed a change with `WaitForAcks`. The
+// prefix must not be under the watched one.
+func (u *Updater) WithAcks(prefix string) *Updater {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+	u.ackPrefix = prefix
+	return u
+}
+
+// WithTracer makes the Updater trace the stages of reading and applying values with `tracer`, see
+// `flagz.UpdateTracer`. Revisions are etcd revisions.
+func (u *Updater) WithTracer(tracer flagz.UpdateTracer) *Updater {
+	u.tracer = tracer
+	return u
+}
+
+// WithUpdateQueue makes the Updater apply updates on a separate go routine, queueing up to `capacity` updates read
+// from etcd and handling more according to `policy`, see `flagz.UpdateQueue`. Updates dropped with
+// `flagz.QueueDropOldest` are logged, and applied again only by the next full read. Disabled (zero) by default,
+// applying updates as they are read.
+func (u *Updater) WithUpdateQueue(capacity int, policy flagz.QueuePolicy) *Updater {
+	u.queueCapacity = capacity
+	u.queuePolicy = policy
+	return u
+}
+
+// Initialize performs the initial read of etcd and sets all flags (dynamic and static) into FlagSet.
+func (u *Updater) Initialize() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.CheckTransition(flagz.UpdaterInitialized); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ctx, end := u.tracer.StartStage(context.Background(), flagz.InitializeStage, "", "")
+	err := u.readAllFlags(ctx, false /* onlyDynamic */)
+	end(err)
+	if err != nil {
+		return err
+	}
+	return u.Transition(flagz.UpdaterInitialized)
+}
+
+// Start kicks off the go routine that syncs dynamic flags from etcd to FlagSet.
+// After a `Stop` it can be called again, to continue watching from the last applied revision.
+func (u *Updater) Start() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.Transition(flagz.UpdaterWatching); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
+	u.done = make(chan struct{})
+	u.mu.Lock()
+	revision := u.revision
+	u.mu.Unlock()
+	go u.watchForUpdates(ctx, u.done, revision)
+	return nil
+}
+
+// Stop stops the auto-updating go-routine and waits for it to exit. Stopping an Updater that isn't watching is a
+// no-op.
+func (u *Updater) Stop() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if u.State() != flagz.UpdaterWatching {
+		return nil
+	}
+	u.logger.Printf("flagz: stopping")
+	u.cancel()
+	<-u.done
+	return u.Transition(flagz.UpdaterStopped)
+}
+
+// readAllFlags reads all keys in pages pinned to the revision of the first one, applying each page as it arrives.
+func (u *Updater) readAllFlags(ctx context.Context, onlyDynamic bool) error {
+	errs := &flagz.FlagErrors{Source: "etcd"}
+	u.overrides.Reset()
+	from := u.prefix
+	revision := int64(0)
+	for {
+		p, err := u.readPage(ctx, from, u.pageSize, revision)
+		if err != nil {
+			return fmt.Errorf("flagz: reading etcd keys from %q: %v", from, err)
+		}
+		if revision == 0 {
+			revision = p.revision
+		}
+		for _, kv := range p.kvs {
+			flagName, override, err := u.keyToFlagName(string(kv.Key))
+			if err != nil {
+				u.logger.Printf("flagz: ignoring: %v", err)
+				continue
+			}
+			// keys are sorted, so the global value of a flag is set before its override.
+			err = u.setFlag(ctx, string(kv.Key), flagName, override, string(kv.Value), revision, onlyDynamic)
+			if err != nil && !flagz.IsSkippedUpdateError(err) {
+				errs.Add(flagName, err)
+			}
+		}
+		if !p.more || len(p.kvs) == 0 {
+			break
+		}
+		// continue right after the last key of the page.
+		from = string(p.kvs[len(p.kvs)-1].Key) + "\x00"
+	}
+	u.revision = revision
+	u.RecordRevision(strconv.FormatInt(revision, 10))
+	return errs.ErrorOrNil()
+}
+
+func (u *Updater) setFlag(ctx context.Context, key string, flagName string, override bool, value string,
+	revision int64, onlyDynamic bool) error {
+	flag := u.flagSet.Lookup(flagName)
+	if flag == nil {
+		return flagz.ErrFlagNotFound
+	}
+	if onlyDynamic && !flagz.IsFlagDynamic(flag) {
+		return flagz.ErrFlagNotDynamic
+	}
+	if !override && !u.overrides.SetGlobal(flagName, value) {
+		return flagz.ErrFlagOverridden
+	}
+	shownRevision := strconv.FormatInt(revision, 10)
+	_, endValidate := u.tracer.StartStage(ctx, flagz.ValidateStage, flagName, shownRevision)
+	value, err := u.unwrappedValue(flagName, value)
+	endValidate(err)
+	if err != nil {
+		return err
+	}
+	_, endApply := u.tracer.StartStage(ctx, flagz.ApplyStage, flagName, shownRevision)
+	err = u.applyValue(ctx, key, flagName, value, shownRevision)
+	endApply(err)
+	if override && (err == nil || errors.Is(err, flagz.ErrFlagPinned)) {
+		// rejected overrides don't shadow the global value, so the flag keeps following it.
+		u.overrides.SetOverride(flagName)
+	}
+	return err
+}
+
+// unwrappedValue returns the value carried by the envelopes of `value`: its signature, encryption and canary.
+func (u *Updater) unwrappedValue(flagName string, value string) (string, error) {
+	value, err := u.verifiedValue(flagName, value)
+	if err != nil {
+		return "", err
+	}
+	if u.decrypter != nil {
+		if value, err = flagz.DecryptFlagValue(u.decrypter, value); err != nil {
+			return "", err
+		}
+	}
+	return flagz.CanaryFlagValue(u.instanceID, value)
+}
+
+// applyValue sets the unwrapped `value` of `flagName` read from `key` at `revision`, or schedules it.
+func (u *Updater) applyValue(ctx context.Context, key string, flagName string, value string, revision string) error {
+	if u.scheduler != nil {
+		if flagz.IsScheduledValue(value) {
+			scheduled, err := flagz.ParseScheduledValue(value)
+			if err != nil {
+				return err
+			}
+			return u.scheduler.Schedule(flagName, scheduled)
+		}
+		u.scheduler.Cancel(flagName)
+	}
+	// do not call flag.Value.Set, instead go through flagSet.Set (via SetFlagFromSource) to change "changed" state.
+	info := flagz.UpdateInfo{FlagName: flagName, Source: "etcd", Key: key, Revision: revision}
+	ctx = flagz.NewUpdateContext(ctx, info)
+	return flagz.SetFlagFromSourceCtx(ctx, u.flagSet, flagName, value, "etcd")
+}
+
+func (u *Updater) watchForUpdates(ctx context.Context, done chan struct{}, revision int64) {
+	defer close(done)
+	var queue *flagz.UpdateQueue
+	if u.queueCapacity > 0 {
+		queue = flagz.NewUpdateQueue(u.queueCapacity, u.queuePolicy)
+		applied := make(chan struct{})
+		go func() {
+			defer close(applied)
+			queue.Run()
+		}()
+		// apply the pending updates before exiting.
+		defer func() {
+			queue.Close()
+			<-applied
+		}()
+	}
+	u.logger.Printf("flagz: watcher started")
+	for {
+		watchCtx, watchCancel := context.WithCancel(ctx)
+		watchCh := u.watcher.Watch(watchCtx, u.prefix, clientv3.WithPrefix(), clientv3.WithRev(revision+1))
+		for resp := range watchCh {
+			if err := resp.Err(); err == rpctypes.ErrCompacted {
+				// Our revision is out of the etcd history. Reread everything and continue from the new revision.
+				u.logger.Printf("flagz: handling etcd compaction by re-reading everything: %v", err)
+				u.mu.Lock()
+				err = u.readAllFlags(ctx, true /* onlyDynamic */)
+				revision = u.revision
+				u.mu.Unlock()
+				u.RecordSync(err)
+				break
+			} else if err != nil {
+				u.logger.Printf("flagz: etcd watch error, restarting watching: %v", err)
+				u.RecordSync(err)
+				break
+			}
+			u.RecordSync(nil)
+			for _, event := range resp.Events {
+				revision = event.Kv.ModRevision
+				if queue == nil {
+					u.applyEvent(ctx, event)
+					continue
+				}
+				event := event
+				apply := func() { u.applyQueuedEvent(ctx, event) }
+				if key, dropped := queue.Push(string(event.Kv.Key), apply); dropped {
+					u.logger.Printf("flagz: dropped pending update of key=%v, because the update queue is full", key)
+				}
+			}
+			u.mu.Lock()
+			u.revision = revision
+			u.mu.Unlock()
+			u.RecordRevision(strconv.FormatInt(revision, 10))
+		}
+		watchCancel()
+		select {
+		case <-ctx.Done():
+			u.logger.Printf("flagz: watcher exited")
+			return
+		case <-time.After(watchRetryBackoff):
+		}
+	}
+}
+
+// applyQueuedEvent applies an event on the go routine of the update queue, serialized with full reads.
+func (u *Updater) applyQueuedEvent(ctx context.Context, event *clientv3.Event) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.applyEvent(ctx, event)
+}
+
+// applyEvent applies `event` with `ctx` of the watching go routine, cancelled by `Stop`.
+func (u *Updater) applyEvent(ctx context.Context, event *clientv3.Event) {
+	flagName, override, err := u.keyToFlagName(string(event.Kv.Key))
+	ctx, end := u.tracer.StartStage(ctx, flagz.WatchEventStage, flagName,
+		strconv.FormatInt(event.Kv.ModRevision, 10))
+	if err != nil {
+		u.logger.Printf("flagz: ignoring %v at revision=%v", err, event.Kv.ModRevision)
+		end(err)
+		return
+	}
+	value := string(event.Kv.Value)
+	if event.Type == mvccpb.DELETE && override {
+		// the override was removed, restore the global value.
+		global, ok := u.overrides.RemoveOverride(flagName)
+		if !ok {
+			u.logger.Printf("flagz: removed override of flag=%v without a global value at revision=%v", flagName,
+				event.Kv.ModRevision)
+			end(nil)
+			return
+		}
+		override, value = false, global
+	} else if event.Type == mvccpb.DELETE {
+		u.logger.Printf("flagz: ignoring deletion of flag=%v at revision=%v", flagName, event.Kv.ModRevision)
+		end(nil)
+		return
+	}
+	shownValue := value
+	if verified, verifyErr := u.verifiedValue(flagName, value); verifyErr == nil {
+		shownValue = verified
+	}
+	shownValue = flagz.RedactFlagValue(u.flagSet.Lookup(flagName), shownValue)
+	err = u.setFlag(ctx, string(event.Kv.Key), flagName, override, value, event.Kv.ModRevision,
+		/*onlyDynamic*/ true)
+	defer end(err)
+	if flagz.IsSkippedUpdateError(err) {
+		// held values of pinned flags aren't live, so they are neither reported as updated nor acknowledged.
+		u.logger.Printf("flagz: ignoring updating flag=%v at revision=%v, because of: %v", flagName, event.Kv.ModRevision, err)
+	} else if err != nil {
+		u.logger.Printf("flagz: failed updating flag=%v at revision=%v, because of: %v", flagName, event.Kv.ModRevision, err)
+		u.RecordUpdate(flagName, shownValue, err)
+	} else {
+		u.logger.Printf("flagz: updated flag=%v to value=%v at revision=%v", flagName, shownValue, event.Kv.ModRevision)
+		u.RecordUpdate(flagName, shownValue, nil)
+		u.writeAck(flagName, value, event.Kv.ModRevision)
+	}
+}
+
+// writeAck acknowledges applying `value` of flag `flagName` at `revision`, if acks are enabled.
+func (u *Updater) writeAck(flagName string, value string, revision int64) {
+	if u.ackPrefix == "" {
+		return
+	}
+	ack := &flagz.UpdateAck{
+		Instance: u.instanceID,
+		Flag:     flagName,
+		Index:    uint64(revision),
+		Checksum: flagz.ValueChecksum(value),
+		Time:     time.Now(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ackTimeout)
+	defer cancel()
+	if err := u.putAck(ctx, u.ackPrefix+flagName+"/"+u.instanceID, ack.Encode()); err != nil {
+		u.logger.Printf("flagz: failed writing ack of flag=%v at revision=%v, because of: %v", flagName, revision, err)
+	}
+}
+
+// WaitForAcks blocks until `quorum` instances acknowledged (see `WithAcks`) the update of flag `flagName` at
+// `revision` (e.g. the revision of the response to writing it) with a value of `checksum` (see `flagz.ValueChecksum`,
+// or empty to match any value), or a later update. It returns the confirming acks, and the error of `ctx` if it is
+// done first.
+func WaitForAcks(ctx context.Context, kv clientv3.KV, ackPrefix string, flagName string, revision int64,
+	checksum string, quorum int) ([]*flagz.UpdateAck, error) {
+	if !strings.HasSuffix(ackPrefix, "/") {
+		ackPrefix = ackPrefix + "/"
+	}
+	for {
+		confirming := []*flagz.UpdateAck{}
+		resp, err := kv.Get(ctx, ackPrefix+flagName+"/", clientv3.WithPrefix())
+		if err == nil {
+			for _, ackKv := range resp.Kvs {
+				ack, err := flagz.ParseUpdateAck(string(ackKv.Value))
+				if err == nil && ack.Confirms(flagName, uint64(revision), checksum) {
+					confirming = append(confirming, ack)
+				}
+			}
+			if len(confirming) >= quorum {
+				return confirming, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return confirming, ctx.Err()
+		case <-time.After(ackPollInterval):
+		}
+	}
+}
+
+// verifiedValue returns the value carried by the signed envelope `value` if signing keys are set, and `value` itself
+// otherwise.
+func (u *Updater) verifiedValue(flagName string, value string) (string, error) {
+	if len(u.signingKeys) == 0 {
+		return value, nil
+	}
+	return flagz.VerifyFlagValue(u.signingKeys, flagName, value)
+}
+
+func (u *Updater) keyToFlagName(key string) (flagName string, override bool, err error) {
+	if !strings.HasPrefix(key, u.prefix) {
+		return "", false, fmt.Errorf("key '%v' doesn't start with prefix '%v'", key, u.prefix)
+	}
+	truncated := strings.TrimPrefix(key, u.prefix)
+	if name, instanceID, ok := flagz.ParseOverrideKey(truncated); ok {
+		if instanceID != u.instanceID {
+			return "", false, fmt.Errorf("key '%v' overrides a flag on another instance", key)
+		}
+		return name, true, nil
+	}
+	name, ok := flagz.KeyPathToFlagName(truncated)
+	if !ok {
+		return "", false, fmt.Errorf("key '%v' doesn't name a flag under prefix '%v'", key, u.prefix)
+	}
+	return name, false, nil
+}
+
+// newFromURL constructs an Updater from an `etcdv3://host:port/prefix` URL, connecting to the etcd endpoint.
+func newFromURL(flagSet *flag.FlagSet, source *url.URL, logger flagz.Logger) (flagz.Updater, error) {
+	client, err := clientv3.New(clientv3.Config{Endpoints: []string{source.Host}, DialTimeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("flagz: creating etcd client: %v", err)
+	}
+	return New(flagSet, client, client, source.Path, logger)
+}
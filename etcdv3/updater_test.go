@@ -0,0 +1,461 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package etcdv3
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+const prefix = "/flagz/test/"
+
+// fakeStore is an in-memory key space serving ranged reads the way etcd does.
+type fakeStore struct {
+	kvs      map[string]string
+	revision int64
+	reads    []int64 // revisions requested by each read.
+}
+
+func (f *fakeStore) readPage(ctx context.Context, from string, limit int64, revision int64) (*page, error) {
+	f.reads = append(f.reads, revision)
+	keys := []string{}
+	for key := range f.kvs {
+		if key >= from && key < clientv3.GetPrefixRangeEnd(prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	p := &page{revision: f.revision}
+	for i, key := range keys {
+		if int64(i) == limit {
+			p.more = true
+			break
+		}
+		p.kvs = append(p.kvs, &mvccpb.KeyValue{Key: []byte(key), Value: []byte(f.kvs[key]), ModRevision: f.revision})
+	}
+	return p, nil
+}
+
+// fakeWatcher serves watches from a channel fed by the test.
+type fakeWatcher struct {
+	responses chan clientv3.WatchResponse
+}
+
+func (f *fakeWatcher) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	out := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case resp := <-f.responses:
+				out <- resp
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (f *fakeWatcher) Close() error { return nil }
+
+func newTestUpdater(t *testing.T, store *fakeStore, watcher *fakeWatcher) (*Updater, *flag.FlagSet) {
+	set := flag.NewFlagSet("etcdv3_test", flag.ContinueOnError)
+	u, err := New(set, nil, watcher, prefix, &testingLog{T: t})
+	require.NoError(t, err)
+	u.readPage = store.readPage
+	return u.WithPageSize(2), set
+}
+
+func TestInitializeReadsAllPagesAtOneRevision(t *testing.T) {
+	store := &fakeStore{revision: 42, kvs: map[string]string{
+		prefix + "a": "1", prefix + "b": "2", prefix + "c": "3", prefix + "d": "4", prefix + "e": "5",
+		prefix + "nested/f": "6",
+	}}
+	u, set := newTestUpdater(t, store, &fakeWatcher{})
+	for _, name := range []string{"a", "b", "c", "d", "e", "nested.f"} {
+		set.Int64(name, 0, "test flag")
+	}
+	require.NoError(t, u.Initialize())
+	for _, name := range []string{"a", "b", "c", "d", "e", "nested.f"} {
+		assert.True(t, set.Lookup(name).Changed, "flag %v from all pages must be set", name)
+	}
+	assert.Equal(t, []int64{0, 42, 42}, store.reads, "pages after the first must be pinned to its revision")
+	assert.Equal(t, "42", u.Status().Revision)
+	assert.Error(t, u.Initialize(), "initialize must only work once")
+}
+
+func TestInitializeErrorsOnUnknownFlags(t *testing.T) {
+	store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "a": "1", prefix + "unknown": "2", prefix + "c": "3"}}
+	u, set := newTestUpdater(t, store, &fakeWatcher{})
+	set.Int64("a", 0, "test flag")
+	set.Int64("c", 0, "test flag")
+	err := u.Initialize()
+	require.Error(t, err, "unknown flags must be reported")
+	flagErrs, ok := err.(*flagz.FlagErrors)
+	require.True(t, ok, "initialization errors must be typed")
+	require.Len(t, flagErrs.Errors, 1)
+	assert.Equal(t, "unknown", flagErrs.Errors[0].Flag)
+	assert.Equal(t, flagz.FlagErrorNotFound, flagErrs.Errors[0].Kind)
+	assert.True(t, set.Lookup("c").Changed, "flags on later pages must still be applied")
+}
+
+func TestWatchAppliesDynamicUpdates(t *testing.T) {
+	store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "dyn": "1"}}
+	watcher := &fakeWatcher{responses: make(chan clientv3.WatchResponse)}
+	u, set := newTestUpdater(t, store, watcher)
+	dynInt := flagz.DynInt64(set, "dyn", 0, "dynamic int")
+	set.Int64("static", 5, "static int")
+	require.NoError(t, u.Initialize())
+	require.NoError(t, u.Start())
+
+	watcher.responses <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn"), Value: []byte("7"), ModRevision: 2}},
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "static"), Value: []byte("8"), ModRevision: 3}},
+	}}
+	event := <-u.Events()
+	assert.Equal(t, "dyn", event.FlagName)
+	assert.EqualValues(t, 7, dynInt.Get(), "dynamic flags must be updated")
+	assert.Equal(t, "5", set.Lookup("static").Value.String(), "static flags must not be updated")
+	assert.Eventually(t, func() bool { return u.Status().Revision == "3" }, time.Second, 10*time.Millisecond)
+
+	store.kvs[prefix+"dyn"] = "9"
+	store.revision = 10
+	watcher.responses <- clientv3.WatchResponse{CompactRevision: 5}
+	assert.Eventually(t, func() bool { return dynInt.Get() == 9 }, time.Second, 10*time.Millisecond,
+		"compaction must re-read everything")
+	require.NoError(t, u.Stop())
+	assert.False(t, u.Status().Running)
+}
+
+func TestWatchTracesUpdateStages(t *testing.T) {
+	store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "dyn": "1"}}
+	watcher := &fakeWatcher{responses: make(chan clientv3.WatchResponse)}
+	u, set := newTestUpdater(t, store, watcher)
+	flagz.DynInt64(set, "dyn", 0, "dynamic int")
+	tracer := &recordingTracer{}
+	u.WithTracer(tracer)
+	require.NoError(t, u.Initialize())
+	require.NoError(t, u.Start())
+	defer u.Stop()
+
+	watcher.responses <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn"), Value: []byte("nope"), ModRevision: 2}},
+	}}
+	<-u.Events()
+	require.Eventually(t, func() bool { return len(tracer.stages()) == 6 }, time.Second, time.Millisecond)
+	stages := tracer.stages()
+	assert.Equal(t, []string{"validate dyn@1", "apply dyn@1", "initialize @"}, stages[:3])
+	assert.Equal(t, []string{"validate dyn@2", "apply dyn@2", "watch_event dyn@2"}, stages[3:])
+}
+
+func TestWatchAppliesQueuedUpdates(t *testing.T) {
+	store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "dyn": "1"}}
+	watcher := &fakeWatcher{responses: make(chan clientv3.WatchResponse)}
+	u, set := newTestUpdater(t, store, watcher)
+	dynInt := flagz.DynInt64(set, "dyn", 0, "dynamic int")
+	u.WithUpdateQueue(1, flagz.QueueDropOldest)
+	require.NoError(t, u.Initialize())
+	require.NoError(t, u.Start())
+
+	events := []*clientv3.Event{}
+	for i := int64(2); i <= 10; i++ {
+		events = append(events, &clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn"),
+			Value: []byte(strconv.FormatInt(i, 10)), ModRevision: i}})
+	}
+	watcher.responses <- clientv3.WatchResponse{Events: events}
+	assert.Eventually(t, func() bool { return dynInt.Get() == 10 }, time.Second, time.Millisecond,
+		"the last update must be applied")
+	require.NoError(t, u.Stop())
+}
+
+func TestValidatorsGetTheKeyOfUpdates(t *testing.T) {
+	store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "dyn": "1"}}
+	watcher := &fakeWatcher{responses: make(chan clientv3.WatchResponse)}
+	u, set := newTestUpdater(t, store, watcher)
+	keys := make(chan string, 2)
+	flagz.DynInt64(set, "dyn", 0, "dynamic int").WithValidatorCtx(func(ctx context.Context, value int64) error {
+		info, _ := flagz.UpdateInfoFromContext(ctx)
+		keys <- info.Source + " " + info.Key
+		return nil
+	})
+	require.NoError(t, u.Initialize())
+	assert.Equal(t, "etcd "+prefix+"dyn", <-keys, "validators must get the key of the update")
+}
+
+// recordingTracer records the stages ended by an Updater with their revisions, in the order they end.
+type recordingTracer struct {
+	mu    sync.Mutex
+	ended []string
+}
+
+func (r *recordingTracer) StartStage(ctx context.Context, stage flagz.UpdateStage, flagName string,
+	revision string) (context.Context, func(err error)) {
+	return ctx, func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.ended = append(r.ended, string(stage)+" "+flagName+"@"+revision)
+	}
+}
+
+func (r *recordingTracer) stages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.ended...)
+}
+
+func TestStopIsIdempotentAndWatchingRestarts(t *testing.T) {
+	store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "dyn": "1"}}
+	watcher := &fakeWatcher{responses: make(chan clientv3.WatchResponse)}
+	u, set := newTestUpdater(t, store, watcher)
+	dynInt := flagz.DynInt64(set, "dyn", 0, "dynamic int")
+	require.NoError(t, u.Initialize())
+	require.NoError(t, u.Stop(), "stopping before starting must be a no-op")
+	require.NoError(t, u.Start())
+	assert.Error(t, u.Start(), "starting twice must fail")
+	require.NoError(t, u.Stop())
+	require.NoError(t, u.Stop(), "stopping twice must be a no-op")
+	assert.False(t, u.Status().Running)
+
+	require.NoError(t, u.Start(), "a stopped updater must be restartable")
+	watcher.responses <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn"), Value: []byte("3"), ModRevision: 2}},
+	}}
+	<-u.Events()
+	assert.EqualValues(t, 3, dynInt.Get(), "a restarted updater must apply updates")
+	require.NoError(t, u.Stop())
+}
+
+type testingLog struct {
+	T *testing.T
+}
+
+func (tl *testingLog) Printf(format string, v ...interface{}) {
+	tl.T.Logf(format+"\n", v...)
+}
+
+func TestWatchRejectsUnsignedValues(t *testing.T) {
+	key := []byte("secret")
+	store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "dyn": flagz.SignFlagValue(key, "dyn", "1")}}
+	watcher := &fakeWatcher{responses: make(chan clientv3.WatchResponse)}
+	u, set := newTestUpdater(t, store, watcher)
+	u.WithSigningKeys(key)
+	dynInt := flagz.DynInt64(set, "dyn", 0, "dynamic int")
+	require.NoError(t, u.Initialize())
+	assert.EqualValues(t, 1, dynInt.Get(), "signed values must be applied")
+	require.NoError(t, u.Start())
+	defer u.Stop()
+
+	watcher.responses <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn"), Value: []byte("7"), ModRevision: 2}},
+	}}
+	event := <-u.Events()
+	assert.Equal(t, flagz.ErrUnsignedValue, event.Err)
+	assert.EqualValues(t, 1, dynInt.Get(), "unsigned values must not be applied")
+
+	watcher.responses <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn"), Value: []byte(flagz.SignFlagValue(key, "dyn", "8")), ModRevision: 3}},
+	}}
+	event = <-u.Events()
+	assert.NoError(t, event.Err)
+	assert.Equal(t, "8", event.Value, "events must show the value without its signature")
+	assert.EqualValues(t, 8, dynInt.Get())
+}
+
+func TestInitializeDecryptsValues(t *testing.T) {
+	a, err := flagz.NewAESGCM(make([]byte, 16))
+	require.NoError(t, err)
+	encrypted, err := a.EncryptFlagValue("hunter2")
+	require.NoError(t, err)
+	store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "password": encrypted, prefix + "plain": "foo"}}
+	u, set := newTestUpdater(t, store, &fakeWatcher{})
+	u.WithDecrypter(a)
+	password := flagz.DynSecret(set, "password", "", "dynamic secret")
+	plain := flagz.DynString(set, "plain", "", "dynamic string")
+	require.NoError(t, u.Initialize())
+	assert.Equal(t, "hunter2", password.Get())
+	assert.Equal(t, "foo", plain.Get(), "unencrypted values must be set as they are")
+}
+
+func TestWatchSchedulesValues(t *testing.T) {
+	sv := &flagz.ScheduledValue{Value: "2", Otherwise: "1", Start: time.Now().Add(100 * time.Millisecond)}
+	scheduled, err := sv.Encode()
+	require.NoError(t, err)
+	store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "dyn": scheduled}}
+	watcher := &fakeWatcher{responses: make(chan clientv3.WatchResponse)}
+	u, set := newTestUpdater(t, store, watcher)
+	scheduler := flagz.NewScheduler(set, &testingLog{T: t})
+	defer scheduler.Stop()
+	u.WithScheduler(scheduler)
+	dynInt := flagz.DynInt64(set, "dyn", 0, "dynamic int")
+	require.NoError(t, u.Initialize())
+	assert.EqualValues(t, 1, dynInt.Get(), "values outside of their window must be set to otherwise")
+	assert.Eventually(t, func() bool { return dynInt.Get() == 2 }, time.Second, 10*time.Millisecond,
+		"values must be set when their window opens")
+
+	require.NoError(t, u.Start())
+	defer u.Stop()
+	sv.Start = time.Now().Add(200 * time.Millisecond)
+	sv.Value = "3"
+	scheduled, err = sv.Encode()
+	require.NoError(t, err)
+	watcher.responses <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn"), Value: []byte(scheduled), ModRevision: 2}},
+	}}
+	<-u.Events()
+	assert.EqualValues(t, 1, dynInt.Get())
+	watcher.responses <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn"), Value: []byte("4"), ModRevision: 3}},
+	}}
+	<-u.Events()
+	assert.EqualValues(t, 4, dynInt.Get(), "unscheduled values must be set immediately")
+	_, pending := scheduler.NextChange("dyn")
+	assert.False(t, pending, "unscheduled values must cancel schedules")
+}
+
+func TestInitializeAppliesCanaryValuesOnSelectedInstances(t *testing.T) {
+	canary := &flagz.CanaryValue{Percentage: 50, Value: "2"}
+	encoded, err := canary.Encode()
+	require.NoError(t, err)
+	var in, out string
+	for i := 0; in == "" || out == ""; i++ {
+		if instance := strconv.Itoa(i); canary.InCanary(instance) {
+			in = instance
+		} else {
+			out = instance
+		}
+	}
+	for instance, expected := range map[string]int64{in: 2, out: 1} {
+		store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "dyn": encoded}}
+		u, set := newTestUpdater(t, store, &fakeWatcher{})
+		u.WithInstanceID(instance)
+		dynInt := flagz.DynInt64(set, "dyn", 1, "dynamic int")
+		require.NoError(t, u.Initialize(), "instances outside of the canary must not fail")
+		assert.Equal(t, expected, dynInt.Get())
+	}
+}
+
+func TestWatchAppliesOverridesOfThisInstance(t *testing.T) {
+	store := &fakeStore{revision: 1, kvs: map[string]string{
+		prefix + "dyn":                    "1",
+		prefix + "dyn/__hosts/frontend-1": "2",
+		prefix + "dyn/__hosts/frontend-2": "3",
+	}}
+	watcher := &fakeWatcher{responses: make(chan clientv3.WatchResponse)}
+	u, set := newTestUpdater(t, store, watcher)
+	u.WithInstanceID("frontend-1")
+	dynInt := flagz.DynInt64(set, "dyn", 0, "dynamic int")
+	require.NoError(t, u.Initialize())
+	assert.EqualValues(t, 2, dynInt.Get(), "overrides of this instance must win over the global value")
+	require.NoError(t, u.Start())
+	defer u.Stop()
+
+	watcher.responses <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn"), Value: []byte("4"), ModRevision: 2}},
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn/__hosts/frontend-2"), Value: []byte("5"), ModRevision: 3}},
+		{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn/__hosts/frontend-1"), ModRevision: 4}},
+	}}
+	event := <-u.Events()
+	assert.NoError(t, event.Err)
+	assert.Equal(t, "4", event.Value, "removing the override must restore the latest global value")
+	assert.EqualValues(t, 4, dynInt.Get())
+
+	watcher.responses <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn/__hosts/frontend-1"), Value: []byte("6"), ModRevision: 5}},
+	}}
+	<-u.Events()
+	assert.EqualValues(t, 6, dynInt.Get(), "new overrides must be applied")
+}
+
+func TestWatchIgnoresRejectedOverrides(t *testing.T) {
+	store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "dyn": "1"}}
+	watcher := &fakeWatcher{responses: make(chan clientv3.WatchResponse)}
+	u, set := newTestUpdater(t, store, watcher)
+	u.WithInstanceID("frontend-1")
+	dynInt := flagz.DynInt64(set, "dyn", 0, "dynamic int")
+	require.NoError(t, u.Initialize())
+	require.NoError(t, u.Start())
+	defer u.Stop()
+
+	watcher.responses <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn/__hosts/frontend-1"), Value: []byte("x"), ModRevision: 2}},
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn"), Value: []byte("3"), ModRevision: 3}},
+	}}
+	assert.Error(t, (<-u.Events()).Err, "overrides failing to parse must be reported")
+	assert.NoError(t, (<-u.Events()).Err)
+	assert.EqualValues(t, 3, dynInt.Get(), "overrides failing to parse must not shadow the global value")
+}
+
+// fakeAckKV serves the acks written by an Updater to `WaitForAcks`.
+type fakeAckKV struct {
+	mu   sync.Mutex
+	acks map[string]string
+}
+
+func (f *fakeAckKV) put(ctx context.Context, key string, value string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.acks[key] = value
+	return nil
+}
+
+func (f *fakeAckKV) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &clientv3.GetResponse{Header: &clientv3.ResponseHeader{}}
+	for ackKey, value := range f.acks {
+		if strings.HasPrefix(ackKey, key) {
+			resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(ackKey), Value: []byte(value)})
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeAckKV) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	return nil, f.put(ctx, key, val)
+}
+
+func TestWatchWritesAcks(t *testing.T) {
+	store := &fakeStore{revision: 1, kvs: map[string]string{prefix + "dyn": "1"}}
+	watcher := &fakeWatcher{responses: make(chan clientv3.WatchResponse)}
+	acks := &fakeAckKV{acks: map[string]string{}}
+	u, set := newTestUpdater(t, store, watcher)
+	u.WithAcks("/flagz/acks").WithInstanceID("frontend-1")
+	u.putAck = acks.put
+	flagz.DynInt64(set, "dyn", 0, "dynamic int")
+	require.NoError(t, u.Initialize())
+	require.NoError(t, u.Start())
+	defer u.Stop()
+
+	watcher.responses <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte(prefix + "dyn"), Value: []byte("7"), ModRevision: 2}},
+	}}
+	<-u.Events()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	confirming, err := WaitForAcks(ctx, acks, "/flagz/acks", "dyn", 2, flagz.ValueChecksum("7"), 1)
+	require.NoError(t, err)
+	require.Len(t, confirming, 1)
+	assert.Equal(t, "frontend-1", confirming[0].Instance)
+	assert.EqualValues(t, 2, confirming[0].Index)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = WaitForAcks(ctx, acks, "/flagz/acks", "dyn", 2, flagz.ValueChecksum("7"), 2)
+	assert.Equal(t, context.DeadlineExceeded, err, "waiting must time out without a quorum")
+	_, err = WaitForAcks(ctx, acks, "/flagz/acks", "dyn", 3, "", 1)
+	assert.Equal(t, context.DeadlineExceeded, err, "acks of earlier updates must not confirm later ones")
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+)
+
+// Names of the attributes of EvalContext fields, see `EvalContext.Attribute`.
+const (
+	UserIDAttribute = "user_id"
+	RegionAttribute = "region"
+	TenantAttribute = "tenant"
+)
+
+// EvalContext describes whom a feature flag is evaluated for, e.g. the user of the request being served, so that
+// features can be targeted at some users, regions or tenants while the flags are still driven by simple values in the
+// backend.
+type EvalContext struct {
+	UserID string
+	Region string
+	Tenant string
+	// Attributes holds any other attributes targeting decisions can be based on.
+	Attributes map[string]string
+}
+
+// Attribute returns the attribute `name`: the field of the `UserIDAttribute`, `RegionAttribute` and
+// `TenantAttribute`, and the entry of Attributes otherwise. It is empty for missing attributes.
+func (c *EvalContext) Attribute(name string) string {
+	if c == nil {
+		return ""
+	}
+	switch name {
+	case UserIDAttribute:
+		return c.UserID
+	case RegionAttribute:
+		return c.Region
+	case TenantAttribute:
+		return c.Tenant
+	}
+	return c.Attributes[name]
+}
+
+// FeatureFlag is implemented by flags (and combinations of them) that decide whether a feature is enabled for an
+// EvalContext, e.g. `DynBool`, `DynPercentage` and `InSet`. A nil EvalContext stands for an unknown caller.
+type FeatureFlag interface {
+	EnabledIn(ec *EvalContext) bool
+}
+
+// FeatureFlagFunc allows the use of ordinary functions as a FeatureFlag.
+type FeatureFlagFunc func(ec *EvalContext) bool
+
+// EnabledIn calls f(ec).
+func (f FeatureFlagFunc) EnabledIn(ec *EvalContext) bool {
+	return f(ec)
+}
+
+type evalContextKey struct{}
+
+// WithEvalContext returns a copy of `ctx` carrying `ec`, e.g. set by a middleware from the authenticated request, so
+// that `Enabled` can be called deep in the request handling.
+func WithEvalContext(ctx context.Context, ec *EvalContext) context.Context {
+	return context.WithValue(ctx, evalContextKey{}, ec)
+}
+
+// EvalContextFrom returns the EvalContext carried by `ctx`, or nil if there is none.
+func EvalContextFrom(ctx context.Context) *EvalContext {
+	ec, _ := ctx.Value(evalContextKey{}).(*EvalContext)
+	return ec
+}
+
+// Enabled tells whether `feature` is enabled for the EvalContext carried by `ctx`.
+func Enabled(ctx context.Context, feature FeatureFlag) bool {
+	return feature.EnabledIn(EvalContextFrom(ctx))
+}
+
+// InSet returns a FeatureFlag enabled for EvalContexts whose `attribute` is in `set`, e.g. to enable a feature for a
+// list of tenants.
+func InSet(attribute string, set *DynStringSetValue) FeatureFlag {
+	return FeatureFlagFunc(func(ec *EvalContext) bool {
+		value := ec.Attribute(attribute)
+		return value != "" && set.Contains(value)
+	})
+}
+
+// AllOf returns a FeatureFlag enabled only if all of `features` are, e.g. a percentage of users in some regions.
+func AllOf(features ...FeatureFlag) FeatureFlag {
+	return FeatureFlagFunc(func(ec *EvalContext) bool {
+		for _, feature := range features {
+			if !feature.EnabledIn(ec) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// AnyOf returns a FeatureFlag enabled if any of `features` is, e.g. for a list of tenants and a percentage of others.
+func AnyOf(features ...FeatureFlag) FeatureFlag {
+	return FeatureFlagFunc(func(ec *EvalContext) bool {
+		for _, feature := range features {
+			if feature.EnabledIn(ec) {
+				return true
+			}
+		}
+		return false
+	})
+}
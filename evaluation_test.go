@@ -0,0 +1,44 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalContext_Attribute(t *testing.T) {
+	ec := &flagz.EvalContext{UserID: "u1", Region: "eu", Tenant: "acme", Attributes: map[string]string{"plan": "pro"}}
+	assert.Equal(t, "u1", ec.Attribute(flagz.UserIDAttribute))
+	assert.Equal(t, "eu", ec.Attribute(flagz.RegionAttribute))
+	assert.Equal(t, "acme", ec.Attribute(flagz.TenantAttribute))
+	assert.Equal(t, "pro", ec.Attribute("plan"))
+	assert.Equal(t, "", ec.Attribute("missing"))
+	assert.Equal(t, "", (*flagz.EvalContext)(nil).Attribute(flagz.UserIDAttribute), "nil contexts have no attributes")
+}
+
+func TestEnabled_TargetsEvalContexts(t *testing.T) {
+	set := flag.NewFlagSet("evaluation_test", flag.ContinueOnError)
+	killSwitch := flagz.DynBool(set, "some_kill_switch", true, "dynamic bool")
+	regions := flagz.DynStringSet(set, "some_regions", []string{"eu"}, "dynamic set")
+	rollout := flagz.DynPercentage(set, "some_rollout", 0, "dynamic percentage").WithBucketBy(flagz.TenantAttribute)
+	feature := flagz.AllOf(killSwitch, flagz.AnyOf(flagz.InSet(flagz.RegionAttribute, regions), rollout))
+
+	eu := flagz.WithEvalContext(context.Background(), &flagz.EvalContext{Region: "eu", Tenant: "acme"})
+	us := flagz.WithEvalContext(context.Background(), &flagz.EvalContext{Region: "us", Tenant: "acme"})
+	assert.True(t, flagz.Enabled(eu, feature), "targeted regions must be enabled")
+	assert.False(t, flagz.Enabled(us, feature), "other regions must not be enabled at 0%")
+	assert.False(t, flagz.Enabled(context.Background(), feature), "unknown callers must not be enabled")
+
+	set.Set("some_rollout", "100")
+	assert.True(t, flagz.Enabled(us, feature), "all tenants must be enabled at 100%")
+	assert.True(t, flagz.Enabled(context.Background(), feature), "unknown callers must be enabled at 100%")
+
+	set.Set("some_kill_switch", "false")
+	assert.False(t, flagz.Enabled(eu, feature), "the kill switch must disable the feature for everyone")
+}
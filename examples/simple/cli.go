@@ -24,8 +24,14 @@ var (
 )
 
 func main() {
-	myFlagSet.Parse(os.Args[1:])
 	logger := log.New(os.Stderr, "wr ", log.LstdFlags)
+	if ok, err := flagz.RunDocsSubcommand(myFlagSet, os.Args[1:], os.Stdout); ok {
+		if err != nil {
+			logger.Fatalf("Failed writing flag docs %v", err)
+		}
+		return
+	}
+	myFlagSet.Parse(os.Args[1:])
 
 	client, err := etcd.New(etcd.Config{Endpoints: []string{"http://localhost:2379"}})
 	if err != nil {
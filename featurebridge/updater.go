@@ -0,0 +1,242 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package featurebridge provides an Updater that maps selected flags of a feature-flag service (e.g. LaunchDarkly via
+// the OpenFeature SDK) onto local dynamic flags, so hot paths read cheap atomic values instead of calling the vendor
+// SDK on every request.
+
+package featurebridge
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultPollInterval = 30 * time.Second
+	defaultEvalTimeout  = 5 * time.Second
+)
+
+// Minimum logger interface needed.
+// Default "log" and "logrus" should support these.
+type loggerCompatible interface {
+	Printf(format string, v ...interface{})
+}
+
+// Evaluator resolves the value of a remote feature flag as a string that is parseable by the local flag.
+//
+// An OpenFeature client can be adapted with a few lines, e.g.:
+//
+//	featurebridge.EvaluatorFunc(func(ctx context.Context, key string, def string) (string, error) {
+//		return ofClient.StringValue(ctx, key, def, openfeature.EvaluationContext{})
+//	})
+type Evaluator interface {
+	StringValue(ctx context.Context, remoteKey string, defaultValue string) (string, error)
+}
+
+// EvaluatorFunc is an adapter allowing the use of ordinary functions as an Evaluator.
+type EvaluatorFunc func(ctx context.Context, remoteKey string, defaultValue string) (string, error)
+
+// StringValue calls f(ctx, remoteKey, defaultValue).
+func (f EvaluatorFunc) StringValue(ctx context.Context, remoteKey string, defaultValue string) (string, error) {
+	return f(ctx, remoteKey, defaultValue)
+}
+
+// Updater periodically evaluates the mapped remote flags and applies changed values to the local FlagSet.
+//
+// Evaluations happen without any per-request context, so only process-global flag values can be bridged. To react to
+// remote changes quicker than the poll interval, call `Refresh` from the SDK's configuration change event handler.
+type Updater struct {
+	*flagz.UpdaterTracker
+	flagSet      *flag.FlagSet
+	logger       loggerCompatible
+	evaluator    Evaluator
+	pollInterval time.Duration
+	evalTimeout  time.Duration
+
+	// lifecycle serializes the lifecycle transitions, see `flagz.UpdaterState`.
+	lifecycle sync.Mutex
+	cancel    context.CancelFunc
+	// done is closed when the polling go routine exits.
+	done chan struct{}
+
+	mu         sync.Mutex
+	mapping    map[string]string // local flag name -> remote key
+	lastValues map[string]string
+	refresh    chan struct{}
+}
+
+// New constructs a new Updater using `evaluator` to resolve remote flag values.
+func New(flagSet *flag.FlagSet, evaluator Evaluator, logger loggerCompatible) *Updater {
+	return &Updater{
+		UpdaterTracker: flagz.NewUpdaterTracker(),
+		flagSet:        flagSet,
+		logger:         logger,
+		evaluator:      evaluator,
+		pollInterval:   defaultPollInterval,
+		evalTimeout:    defaultEvalTimeout,
+		mapping:        make(map[string]string),
+		lastValues:     make(map[string]string),
+		refresh:        make(chan struct{}, 1),
+	}
+}
+
+// Map binds the remote flag `remoteKey` to the local flag `flagName`. It must be called before Initialize.
+func (u *Updater) Map(remoteKey string, flagName string) *Updater {
+	u.mu.Lock()
+	u.mapping[flagName] = remoteKey
+	u.mu.Unlock()
+	return u
+}
+
+// WithPollInterval sets how often the remote flags are evaluated. Defaults to 30s.
+func (u *Updater) WithPollInterval(interval time.Duration) *Updater {
+	u.pollInterval = interval
+	return u
+}
+
+// Initialize evaluates all mapped remote flags and sets them (dynamic and static) into the FlagSet.
+// Evaluations are done with the current local value as the default, so an unreachable service or an unknown remote
+// flag leave the local flag intact. Only values that fail to parse or validate are returned as errors.
+func (u *Updater) Initialize() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.CheckTransition(flagz.UpdaterInitialized); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.evaluateAll(context.Background(), false /* dynamicOnly */); err != nil {
+		return err
+	}
+	return u.Transition(flagz.UpdaterInitialized)
+}
+
+// Start kicks off the go routine that periodically re-evaluates the remote flags.
+func (u *Updater) Start() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.Transition(flagz.UpdaterWatching); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
+	u.done = make(chan struct{})
+	go u.pollForUpdates(ctx, u.done)
+	return nil
+}
+
+// Stop stops the auto-updating go-routine and waits for it to exit. Stopping an Updater that isn't polling is a no-op.
+func (u *Updater) Stop() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if u.State() != flagz.UpdaterWatching {
+		return nil
+	}
+	u.cancel()
+	<-u.done
+	return u.Transition(flagz.UpdaterStopped)
+}
+
+// Refresh asks the polling go-routine to re-evaluate the remote flags immediately.
+// It is safe to call from SDK event handlers, as it never blocks.
+func (u *Updater) Refresh() {
+	select {
+	case u.refresh <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
+}
+
+func (u *Updater) pollForUpdates(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	u.logger.Printf("flagz: feature bridge poller started")
+	ticker := time.NewTicker(u.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-u.refresh:
+		case <-ctx.Done():
+			u.logger.Printf("flagz: feature bridge poller exited")
+			return
+		}
+		u.mu.Lock()
+		err := u.evaluateAll(ctx, true /* dynamicOnly */)
+		u.mu.Unlock()
+		if err != nil {
+			u.logger.Printf("flagz: feature bridge refresh yielded errors: %v", err)
+		}
+		u.RecordSync(err)
+	}
+}
+
+// evaluateAll resolves all mapped flags and applies the changed ones. Must be called under `mu`.
+func (u *Updater) evaluateAll(ctx context.Context, dynamicOnly bool) error {
+	names := make([]string, 0, len(u.mapping))
+	for name := range u.mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := &flagz.FlagErrors{Source: "remote flag evaluation"}
+	for _, name := range names {
+		err := u.evaluate(ctx, name, u.mapping[name], dynamicOnly)
+		if (errors.Is(err, flagz.ErrFlagNotDynamic) && dynamicOnly) || errors.Is(err, flagz.ErrFlagPinned) {
+			continue
+		} else if err != nil {
+			errs.Add(name, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+func (u *Updater) evaluate(ctx context.Context, flagName string, remoteKey string, dynamicOnly bool) error {
+	flag := u.flagSet.Lookup(flagName)
+	if flag == nil {
+		return flagz.ErrFlagNotFound
+	}
+	if dynamicOnly && !flagz.IsFlagDynamic(flag) {
+		return flagz.ErrFlagNotDynamic
+	}
+	evalCtx, cancel := context.WithTimeout(ctx, u.evalTimeout)
+	defer cancel()
+	value, err := u.evaluator.StringValue(evalCtx, remoteKey, flag.Value.String())
+	if err != nil {
+		// evaluation errors (unknown remote flag, service unreachable) keep the local value, same as SDK defaults.
+		u.logger.Printf("flagz: keeping flag=%v, evaluating remote flag %v failed: %v", flagName, remoteKey, err)
+		return nil
+	}
+	if last, ok := u.lastValues[flagName]; ok && last == value {
+		return nil
+	}
+	if value == flag.Value.String() {
+		// the remote value matches (or defaulted to) the local one, no need to churn notifiers.
+		u.lastValues[flagName] = value
+		return nil
+	}
+	shownValue := flagz.RedactFlagValue(flag, value)
+	// do not call flag.Value.Set, instead go through flagSet.Set (via SetFlagFromSource) to change "changed" state.
+	if err := flagz.SetFlagFromSourceCtx(ctx, u.flagSet, flagName, value, "featurebridge"); errors.Is(err, flagz.ErrFlagPinned) {
+		// held until the flag is unpinned, which applies it.
+		u.logger.Printf("flagz: holding update of pinned flag=%v until it is unpinned", flagName)
+		u.lastValues[flagName] = value
+		return err
+	} else if err != nil {
+		if dynamicOnly {
+			u.RecordUpdate(flagName, shownValue, err)
+		}
+		return err
+	}
+	u.lastValues[flagName] = value
+	if dynamicOnly {
+		u.logger.Printf("flagz: updated flag=%v to value=%v from remote flag %v", flagName, shownValue, remoteKey)
+		u.RecordUpdate(flagName, shownValue, nil)
+	}
+	return nil
+}
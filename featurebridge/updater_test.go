@@ -0,0 +1,129 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package featurebridge_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/featurebridge"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type updaterTestSuite struct {
+	suite.Suite
+
+	remote *fakeEvaluator
+
+	flagSet   *flag.FlagSet
+	staticInt *int32
+	dynInt    *flagz.DynInt64Value
+	dynString *flagz.DynStringValue
+
+	updater *featurebridge.Updater
+}
+
+func (s *updaterTestSuite) SetupTest() {
+	s.remote = &fakeEvaluator{values: map[string]string{"remote-int": "1234", "remote-dynint": "10001"}}
+
+	s.flagSet = flag.NewFlagSet("updater_test", flag.ContinueOnError)
+	s.dynInt = flagz.DynInt64(s.flagSet, "some_dynint", 1, "dynamic int for testing")
+	s.dynString = flagz.DynString(s.flagSet, "some_dynstring", "local_default", "dynamic string for testing")
+	s.staticInt = s.flagSet.Int32("some_int", 1, "static int for testing")
+
+	s.updater = featurebridge.New(s.flagSet, s.remote, &testingLog{T: s.T()}).
+		Map("remote-int", "some_int").
+		Map("remote-dynint", "some_dynint").
+		Map("remote-not-defined", "some_dynstring").
+		WithPollInterval(10 * time.Second)
+}
+
+func (s *updaterTestSuite) TearDownTest() {
+	s.updater.Stop()
+	time.Sleep(50 * time.Millisecond)
+}
+
+func (s *updaterTestSuite) TestInitializeSetsValues() {
+	require.NoError(s.T(), s.updater.Initialize(), "initialize should not return errors on good flags")
+	assert.EqualValues(s.T(), 1234, *s.staticInt, "staticInt should be set from the remote flag")
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "dynInt should be set from the remote flag")
+	assert.Equal(s.T(), "local_default", s.dynString.Get(), "undefined remote flags must keep the local value")
+	assert.False(s.T(), s.flagSet.Lookup("some_dynstring").Changed, "undefined remote flags must not mark flags changed")
+}
+
+func (s *updaterTestSuite) TestInitializeFailsOnEvaluationErrors() {
+	s.remote.set("remote-dynint", "not_an_int")
+	require.Error(s.T(), s.updater.Initialize(), "initialize should return errors on bad values")
+}
+
+func (s *updaterTestSuite) TestRefreshAppliesOnlyDynamicChanges() {
+	require.NoError(s.T(), s.updater.Initialize())
+	require.NoError(s.T(), s.updater.Start())
+	s.remote.set("remote-dynint", "20002")
+	s.remote.set("remote-int", "4321")
+	s.updater.Refresh()
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, 20002,
+		func() interface{} { return s.dynInt.Get() },
+		"some_dynint value should change after refresh")
+	assert.EqualValues(s.T(), 1234, *s.staticInt, "static flags must not be updated dynamically")
+}
+
+var _ flagz.Updater = &featurebridge.Updater{}
+
+func TestUpdaterSuite(t *testing.T) {
+	suite.Run(t, &updaterTestSuite{})
+}
+
+type fakeEvaluator struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (f *fakeEvaluator) StringValue(ctx context.Context, remoteKey string, defaultValue string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if v, ok := f.values[remoteKey]; ok {
+		return v, nil
+	}
+	return defaultValue, fmt.Errorf("flag %v not found", remoteKey)
+}
+
+func (f *fakeEvaluator) set(key string, value string) {
+	f.mu.Lock()
+	f.values[key] = value
+	f.mu.Unlock()
+}
+
+type assertFunc func(expected, actual interface{}) bool
+type getter func() interface{}
+
+// eventually tries a given Assert function 5 times over the period of time.
+func eventually(t *testing.T, duration time.Duration,
+	af assertFunc, expected interface{}, actual getter, msgFmt string, msgArgs ...interface{}) {
+	increment := duration / 5
+	for i := 0; i < 5; i++ {
+		time.Sleep(increment)
+		if af(expected, actual()) {
+			return
+		}
+	}
+	t.Fatalf(msgFmt, msgArgs...)
+}
+
+// Abstraction that allows us to pass the *testing.T as a logger to the updater.
+type testingLog struct {
+	T *testing.T
+}
+
+func (tl *testingLog) Printf(format string, v ...interface{}) {
+	tl.T.Logf(format+"\n", v...)
+}
@@ -0,0 +1,273 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package flagzchaos randomly changes dynamic flags at runtime, to shake out code that caches flag values unsafely or
+// breaks on changes in the middle of a request. It is meant for staging environments, never for production.
+
+package flagzchaos
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultAttempts = 10
+
+	// Source is recorded (see `flagz.FlagSource`) as the origin of the values set by the Monkey.
+	Source = "flagzchaos"
+)
+
+// ErrNoFlags is returned by `Mutate` if none of the flags can be changed.
+var ErrNoFlags = errors.New("flagzchaos: no dynamic flags to change")
+
+// Generator returns a random candidate value for flag `f`, in the form taken by its `Set`. Candidates rejected by the
+// flag's validator are discarded and a new one is generated.
+type Generator func(r *rand.Rand, f *flag.Flag) string
+
+// Monkey changes a random dynamic flag of a FlagSet every interval.
+//
+// Values are generated by the Generator configured for the flag, or by the default one of its type. Booleans are
+// flipped, numbers and durations are picked around their current value, and percentages anywhere in their range.
+// Flags of other types (strings, JSON, lists) are only changed if a Generator is configured for them with
+// `WithGenerator` or `WithValues`. Validators are respected: the Monkey only ever sets values that the flag accepts.
+//
+// The values flags had before the first change are restored by `Stop`.
+type Monkey struct {
+	flagSet    *flag.FlagSet
+	logger     flagz.Logger
+	interval   time.Duration
+	attempts   int
+	filter     func(f *flag.Flag) bool
+	generators map[string]Generator
+
+	mu        sync.Mutex
+	rand      *rand.Rand
+	originals map[string]original
+	done      chan bool
+	stopped   chan bool
+}
+
+type original struct {
+	value  string
+	source string
+}
+
+// New constructs a Monkey changing the dynamic flags of `flagSet`.
+func New(flagSet *flag.FlagSet, logger flagz.Logger) *Monkey {
+	return &Monkey{
+		flagSet:    flagSet,
+		logger:     logger,
+		interval:   defaultInterval,
+		attempts:   defaultAttempts,
+		generators: make(map[string]Generator),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		originals:  make(map[string]original),
+	}
+}
+
+// WithInterval sets how often a flag is changed after `Start`.
+func (m *Monkey) WithInterval(interval time.Duration) *Monkey {
+	m.interval = interval
+	return m
+}
+
+// WithSeed makes the sequence of changes reproducible.
+func (m *Monkey) WithSeed(seed int64) *Monkey {
+	m.rand = rand.New(rand.NewSource(seed))
+	return m
+}
+
+// WithAttempts sets how many candidate values are generated for a flag before giving up on changing it, if they are
+// all rejected by its validator.
+func (m *Monkey) WithAttempts(attempts int) *Monkey {
+	m.attempts = attempts
+	return m
+}
+
+// WithFlagFilter limits the changes to the dynamic flags for which `filter` returns true.
+func (m *Monkey) WithFlagFilter(filter func(f *flag.Flag) bool) *Monkey {
+	m.filter = filter
+	return m
+}
+
+// WithGenerator sets the Generator of values of flag `name`, replacing the default one of its type.
+// The value the flag had before its first change is restored by setting its `String`, so flags whose `String` doesn't
+// parse back (e.g. string slices) are not restored correctly.
+func (m *Monkey) WithGenerator(name string, generator Generator) *Monkey {
+	m.generators[name] = generator
+	return m
+}
+
+// WithValues makes flag `name` change between the given values. See `WithGenerator`.
+func (m *Monkey) WithValues(name string, values ...string) *Monkey {
+	return m.WithGenerator(name, func(r *rand.Rand, f *flag.Flag) string {
+		return values[r.Intn(len(values))]
+	})
+}
+
+// Start kicks off the go routine changing a random flag every interval.
+func (m *Monkey) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done != nil {
+		return fmt.Errorf("flagzchaos: already started")
+	}
+	m.done = make(chan bool)
+	m.stopped = make(chan bool)
+	go m.mutateForever(m.done, m.stopped)
+	return nil
+}
+
+// Stop stops changing flags, waiting for a change in progress, and restores the values they had before the first change.
+func (m *Monkey) Stop() error {
+	m.mu.Lock()
+	if m.done == nil {
+		m.mu.Unlock()
+		return fmt.Errorf("flagzchaos: not started")
+	}
+	close(m.done)
+	stopped := m.stopped
+	m.done = nil
+	m.mu.Unlock()
+	<-stopped
+	return m.Restore()
+}
+
+// Mutate changes a random flag right away, returning its name and new value.
+func (m *Monkey) Mutate() (name string, value string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	candidates := []*flag.Flag{}
+	for _, f := range flagz.DynamicFlags(m.flagSet) {
+		if m.generator(f) != nil && (m.filter == nil || m.filter(f)) {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", "", ErrNoFlags
+	}
+	f := candidates[m.rand.Intn(len(candidates))]
+	previous := original{value: f.Value.String(), source: flagz.FlagSource(f)}
+	generator := m.generator(f)
+	for i := 0; i < m.attempts; i++ {
+		value = generator(m.rand, f)
+		if err = flagz.SetFlagFromSource(m.flagSet, f.Name, value, Source); err == nil {
+			if _, ok := m.originals[f.Name]; !ok {
+				m.originals[f.Name] = previous
+			}
+			return f.Name, flagz.RedactFlagValue(f, value), nil
+		}
+	}
+	return f.Name, "", fmt.Errorf("flagzchaos: no valid value of flag %v after %d attempts: %w", f.Name, m.attempts, err)
+}
+
+// Restore sets all changed flags back to the values they had before their first change.
+func (m *Monkey) Restore() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	errs := &flagz.FlagErrors{Source: Source}
+	for name, previous := range m.originals {
+		if err := flagz.SetFlagFromSource(m.flagSet, name, previous.value, previous.source); err != nil {
+			errs.Add(name, err)
+		}
+		delete(m.originals, name)
+	}
+	return errs.ErrorOrNil()
+}
+
+func (m *Monkey) mutateForever(done chan bool, stopped chan bool) {
+	defer close(stopped)
+	m.logger.Printf("flagzchaos: changing a random dynamic flag every %v", m.interval)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			name, value, err := m.Mutate()
+			if err != nil {
+				m.logger.Printf("flagzchaos: %v", err)
+				continue
+			}
+			m.logger.Printf("flagzchaos: changed flag %v to %q", name, value)
+		}
+	}
+}
+
+func (m *Monkey) generator(f *flag.Flag) Generator {
+	if generator, ok := m.generators[f.Name]; ok {
+		return generator
+	}
+	switch f.Value.(type) {
+	case *flagz.DynBoolValue:
+		return generateBool
+	case *flagz.DynInt64Value:
+		return generateInt64
+	case *flagz.DynFloat64Value:
+		return generateFloat64
+	case *flagz.DynDurationValue:
+		return generateDuration
+	case *flagz.DynPercentageValue:
+		return generatePercentage
+	}
+	return nil
+}
+
+func generateBool(r *rand.Rand, f *flag.Flag) string {
+	return strconv.FormatBool(!f.Value.(*flagz.DynBoolValue).Get())
+}
+
+// generateInt64 picks a value within the magnitude of the current one (or at least 10) around it.
+func generateInt64(r *rand.Rand, f *flag.Flag) string {
+	current := f.Value.(*flagz.DynInt64Value).Get()
+	spread := current
+	if spread < 0 {
+		spread = -spread
+	}
+	// keep clear of overflows for values close to the limits of int64 (the negation of MinInt64 stays negative).
+	if spread < 0 || spread > math.MaxInt64/4 {
+		spread = math.MaxInt64 / 4
+		if current > 0 {
+			current = math.MaxInt64 / 2
+		} else {
+			current = -math.MaxInt64 / 2
+		}
+	} else if spread < 10 {
+		spread = 10
+	}
+	return strconv.FormatInt(current-spread+r.Int63n(2*spread+1), 10)
+}
+
+// generateFloat64 picks a value between zero and twice the current one (or one).
+func generateFloat64(r *rand.Rand, f *flag.Flag) string {
+	current := f.Value.(*flagz.DynFloat64Value).Get()
+	if current == 0 {
+		current = 1
+	}
+	return strconv.FormatFloat(2*current*r.Float64(), 'g', -1, 64)
+}
+
+// generatePercentage picks any percentage, as rollouts must work at all of them.
+func generatePercentage(r *rand.Rand, f *flag.Flag) string {
+	return strconv.FormatFloat(100*r.Float64(), 'f', 2, 64)
+}
+
+// generateDuration picks a duration between zero and twice the current one (or a second).
+func generateDuration(r *rand.Rand, f *flag.Flag) string {
+	current := f.Value.(*flagz.DynDurationValue).Get()
+	if current <= 0 || current > math.MaxInt64/4 {
+		current = time.Second
+	}
+	return time.Duration(r.Int63n(2*int64(current) + 1)).String()
+}
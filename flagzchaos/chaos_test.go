@@ -0,0 +1,96 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzchaos_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/flagzchaos"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonkey_RespectsValidatorsAndRestores(t *testing.T) {
+	set := flag.NewFlagSet("flagzchaos", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 5, "dynamic int")
+	dynInt.WithValidator(flagz.ValidateDynInt64Range(0, 10))
+	dynBool := flagz.DynBool(set, "some_dynbool", false, "dynamic bool")
+	dynString := flagz.DynString(set, "some_dynstring", "foo", "dynamic string")
+	dynPercentage := flagz.DynPercentage(set, "some_dynpercentage", 5, "dynamic percentage")
+	set.Int64("some_int", 1, "static int")
+	monkey := flagzchaos.New(set, &testingLog{T: t}).WithSeed(42)
+
+	changed := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		name, _, err := monkey.Mutate()
+		require.NoError(t, err)
+		changed[name] = true
+		assert.True(t, dynInt.Get() >= 0 && dynInt.Get() <= 10, "values must pass validators")
+		assert.Equal(t, flagzchaos.Source, flagz.FlagSource(set.Lookup(name)))
+	}
+	assert.Equal(t, map[string]bool{"some_dynint": true, "some_dynbool": true, "some_dynpercentage": true}, changed,
+		"only dynamic flags with generators must change")
+	assert.Equal(t, "foo", dynString.Get())
+
+	require.NoError(t, monkey.Restore())
+	assert.EqualValues(t, 5, dynInt.Get())
+	assert.False(t, dynBool.Get())
+	assert.EqualValues(t, 5, dynPercentage.Get())
+}
+
+func TestMonkey_UsesConfiguredGeneratorsAndFilter(t *testing.T) {
+	set := flag.NewFlagSet("flagzchaos", flag.ContinueOnError)
+	dynString := flagz.DynString(set, "some_dynstring", "foo", "dynamic string")
+	flagz.DynBool(set, "some_dynbool", false, "dynamic bool")
+	monkey := flagzchaos.New(set, &testingLog{T: t}).
+		WithValues("some_dynstring", "bar", "baz").
+		WithFlagFilter(func(f *flag.Flag) bool { return f.Name != "some_dynbool" })
+
+	name, value, err := monkey.Mutate()
+	require.NoError(t, err)
+	assert.Equal(t, "some_dynstring", name)
+	assert.Contains(t, []string{"bar", "baz"}, value)
+	assert.Equal(t, value, dynString.Get())
+}
+
+func TestMonkey_GivesUpOnRejectedValues(t *testing.T) {
+	set := flag.NewFlagSet("flagzchaos", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 5, "dynamic int")
+	dynInt.WithValidator(func(int64) error { return errors.New("never") })
+	monkey := flagzchaos.New(set, &testingLog{T: t}).WithAttempts(3)
+
+	_, _, err := monkey.Mutate()
+	var validation *flagz.ValidationError
+	assert.True(t, errors.As(err, &validation), "the last rejection must be returned")
+	assert.EqualValues(t, 5, dynInt.Get())
+
+	_, _, err = flagzchaos.New(flag.NewFlagSet("empty", flag.ContinueOnError), &testingLog{T: t}).Mutate()
+	assert.Equal(t, flagzchaos.ErrNoFlags, err)
+}
+
+func TestMonkey_StartChangesFlagsUntilStopped(t *testing.T) {
+	set := flag.NewFlagSet("flagzchaos", flag.ContinueOnError)
+	dynBool := flagz.DynBool(set, "some_dynbool", false, "dynamic bool")
+	monkey := flagzchaos.New(set, &testingLog{T: t}).WithInterval(time.Millisecond)
+
+	require.NoError(t, monkey.Start())
+	assert.Error(t, monkey.Start(), "starting twice must fail")
+	require.Eventually(t, func() bool { return flagz.FlagSource(set.Lookup("some_dynbool")) == flagzchaos.Source },
+		time.Second, time.Millisecond)
+	require.NoError(t, monkey.Stop())
+	assert.False(t, dynBool.Get(), "stopping must restore the original values")
+	assert.Error(t, monkey.Stop(), "stopping twice must fail")
+}
+
+type testingLog struct {
+	T *testing.T
+}
+
+func (tl *testingLog) Printf(format string, v ...interface{}) {
+	tl.T.Logf(format+"\n", v...)
+}
@@ -0,0 +1,291 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package flagzgrpc provides gRPC server and client interceptors applying per-method policies (timeouts, rate limits,
+// denials and verbose logging) read from a dynamic flag, so that RPC policy changes propagate through the Updaters
+// (e.g. etcd) without bespoke glue in every service.
+
+package flagzgrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AnyMethod is the method name of the service-wide policies in `Policies.Methods`, e.g. `/pkg.Service/*`.
+const AnyMethod = "*"
+
+// Duration is a `time.Duration` in the JSON of Policies, e.g. "250ms".
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"250ms\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MethodPolicy is the policy of calls of a gRPC method.
+type MethodPolicy struct {
+	// Timeout bounds the deadline of calls, keeping earlier deadlines of the caller. Zero keeps the caller's deadline.
+	Timeout Duration `json:"timeout,omitempty"`
+	// RateLimit is the number of calls per second admitted by each instance, with calls beyond it rejected with
+	// `ResourceExhausted`. Zero is unlimited.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	// Deny rejects all calls with `PermissionDenied`, e.g. to shed a broken or abused method.
+	Deny bool `json:"deny,omitempty"`
+	// Verbose logs every call with its code and duration.
+	Verbose bool `json:"verbose,omitempty"`
+}
+
+// Policies is the value of a `DynPolicies` flag, e.g.:
+//
+//	{"default": {"timeout": "5s"},
+//	 "methods": {"/pkg.Service/*": {"verbose": true}, "/pkg.Service/Get": {"deny": true}}}
+type Policies struct {
+	// Methods are the policies of full method names, or of all methods of a service with the `AnyMethod` name.
+	Methods map[string]*MethodPolicy `json:"methods,omitempty"`
+	// Default is the policy of methods without one.
+	Default *MethodPolicy `json:"default,omitempty"`
+}
+
+// PolicyOf returns the policy of `fullMethod` (e.g. `/pkg.Service/Method`): its own, or the one of its service, or the
+// Default. It never returns nil.
+func (p *Policies) PolicyOf(fullMethod string) *MethodPolicy {
+	if policy, ok := p.Methods[fullMethod]; ok && policy != nil {
+		return policy
+	}
+	if i := strings.LastIndex(fullMethod, "/"); i > 0 {
+		if policy, ok := p.Methods[fullMethod[:i+1]+AnyMethod]; ok && policy != nil {
+			return policy
+		}
+	}
+	if p.Default != nil {
+		return p.Default
+	}
+	return &MethodPolicy{}
+}
+
+// Validate checks that the policies have no negative timeouts or rate limits, and that methods are full method names.
+func (p *Policies) Validate() error {
+	policies := map[string]*MethodPolicy{"default": p.Default}
+	for method, policy := range p.Methods {
+		if !strings.HasPrefix(method, "/") || strings.Count(method, "/") != 2 {
+			return fmt.Errorf("method %q must be a full method name like /pkg.Service/Method", method)
+		}
+		policies[method] = policy
+	}
+	for method, policy := range policies {
+		if policy == nil {
+			continue
+		}
+		if policy.Timeout < 0 {
+			return fmt.Errorf("policy of %v: timeout must not be negative", method)
+		}
+		if policy.RateLimit < 0 {
+			return fmt.Errorf("policy of %v: rate limit must not be negative", method)
+		}
+	}
+	return nil
+}
+
+// DynPolicies creates a `flagz.DynJSON` flag holding Policies, validated with `Policies.Validate`, to be read by an
+// Interceptor.
+func DynPolicies(flagSet *flag.FlagSet, name string, value *Policies, usage string) *flagz.DynJSONValue {
+	dynValue := flagz.DynJSON(flagSet, name, value, usage)
+	dynValue.WithValidator(func(value interface{}) error {
+		return value.(*Policies).Validate()
+	})
+	return dynValue
+}
+
+// Interceptor applies the Policies of a `DynPolicies` flag to gRPC calls, always reading their current value.
+type Interceptor struct {
+	policies *flagz.DynJSONValue
+	logger   flagz.Logger
+
+	mu       sync.Mutex
+	limiters map[string]*rateLimiter
+}
+
+// New constructs an Interceptor applying the Policies of `policies`, logging verbose calls to `logger`.
+func New(policies *flagz.DynJSONValue, logger flagz.Logger) *Interceptor {
+	return &Interceptor{policies: policies, logger: logger, limiters: make(map[string]*rateLimiter)}
+}
+
+// UnaryServerInterceptor applies the policies to unary calls handled by a server.
+func (i *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		policy := i.policyOf(info.FullMethod)
+		if err := i.admit(info.FullMethod, policy); err != nil {
+			return nil, err
+		}
+		if policy.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(policy.Timeout))
+			defer cancel()
+		}
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		i.logCall("server", info.FullMethod, policy, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor applies the policies to streams handled by a server. Timeouts bound the whole stream.
+func (i *Interceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		policy := i.policyOf(info.FullMethod)
+		if err := i.admit(info.FullMethod, policy); err != nil {
+			return err
+		}
+		if policy.Timeout > 0 {
+			ctx, cancel := context.WithTimeout(stream.Context(), time.Duration(policy.Timeout))
+			defer cancel()
+			stream = &serverStream{ServerStream: stream, ctx: ctx}
+		}
+		start := time.Now()
+		err := handler(srv, stream)
+		i.logCall("server", info.FullMethod, policy, start, err)
+		return err
+	}
+}
+
+// UnaryClientInterceptor applies the policies to unary calls made by a client, failing denied and rate-limited calls
+// without sending them.
+func (i *Interceptor) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy := i.policyOf(method)
+		if err := i.admit(method, policy); err != nil {
+			return err
+		}
+		if policy.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(policy.Timeout))
+			defer cancel()
+		}
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		i.logCall("client", method, policy, start, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor applies the denials and rate limits of the policies to streams opened by a client, and logs
+// the opening of streams of verbose methods. Timeouts don't apply, as the stream outlives the call opening it.
+func (i *Interceptor) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		policy := i.policyOf(method)
+		if err := i.admit(method, policy); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		i.logCall("client", method, policy, start, err)
+		return stream, err
+	}
+}
+
+func (i *Interceptor) policyOf(fullMethod string) *MethodPolicy {
+	policies, _ := i.policies.Get().(*Policies)
+	if policies == nil {
+		return &MethodPolicy{}
+	}
+	return policies.PolicyOf(fullMethod)
+}
+
+// admit returns the status error of calls of `fullMethod` rejected by `policy`.
+func (i *Interceptor) admit(fullMethod string, policy *MethodPolicy) error {
+	if policy.Deny {
+		return status.Errorf(codes.PermissionDenied, "flagzgrpc: method %v is denied by policy", fullMethod)
+	}
+	if policy.RateLimit > 0 && !i.limiter(fullMethod).allow(policy.RateLimit, time.Now()) {
+		return status.Errorf(codes.ResourceExhausted, "flagzgrpc: method %v exceeded its rate limit of %v/s",
+			fullMethod, policy.RateLimit)
+	}
+	return nil
+}
+
+func (i *Interceptor) limiter(fullMethod string) *rateLimiter {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	limiter, ok := i.limiters[fullMethod]
+	if !ok {
+		limiter = &rateLimiter{}
+		i.limiters[fullMethod] = limiter
+	}
+	return limiter
+}
+
+func (i *Interceptor) logCall(side string, fullMethod string, policy *MethodPolicy, start time.Time, err error) {
+	if policy.Verbose {
+		i.logger.Printf("flagzgrpc: %v call of method=%v code=%v duration=%v", side, fullMethod, status.Code(err),
+			time.Now().Sub(start))
+	}
+}
+
+// serverStream overrides the context of a ServerStream, e.g. with a timeout.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// rateLimiter is a token bucket holding up to a second of calls, refilled at the rate passed to `allow`, so that
+// changes of the rate take effect immediately.
+type rateLimiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) allow(rate float64, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else if elapsed := now.Sub(l.last).Seconds(); elapsed > 0 {
+		l.tokens += elapsed * rate
+	}
+	if l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
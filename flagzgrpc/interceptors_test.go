@@ -0,0 +1,129 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzgrpc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz/flagzgrpc"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	getMethod  = "/pkg.Service/Get"
+	listMethod = "/pkg.Service/List"
+)
+
+func newInterceptor(t *testing.T, policies string) (*flagzgrpc.Interceptor, *flag.FlagSet) {
+	set := flag.NewFlagSet("flagzgrpc", flag.ContinueOnError)
+	dynPolicies := flagzgrpc.DynPolicies(set, "rpc_policies", &flagzgrpc.Policies{}, "RPC policies")
+	require.NoError(t, set.Set("rpc_policies", policies))
+	return flagzgrpc.New(dynPolicies, &testingLog{T: t}), set
+}
+
+func callUnary(i *flagzgrpc.Interceptor, method string) (time.Time, error) {
+	var deadline time.Time
+	_, err := i.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			deadline, _ = ctx.Deadline()
+			return nil, nil
+		})
+	return deadline, err
+}
+
+func TestPolicies_PolicyOf(t *testing.T) {
+	policies := &flagzgrpc.Policies{
+		Methods: map[string]*flagzgrpc.MethodPolicy{
+			getMethod:          {Deny: true},
+			"/pkg.Service/*":   {Verbose: true},
+			"/other.Service/*": nil,
+		},
+		Default: &flagzgrpc.MethodPolicy{RateLimit: 10},
+	}
+	assert.True(t, policies.PolicyOf(getMethod).Deny, "methods must get their own policy")
+	assert.True(t, policies.PolicyOf(listMethod).Verbose, "methods must get the policy of their service")
+	assert.EqualValues(t, 10, policies.PolicyOf("/other.Service/Get").RateLimit, "others must get the default")
+	assert.NotNil(t, (&flagzgrpc.Policies{}).PolicyOf(getMethod))
+}
+
+func TestDynPolicies_Validates(t *testing.T) {
+	set := flag.NewFlagSet("flagzgrpc", flag.ContinueOnError)
+	flagzgrpc.DynPolicies(set, "rpc_policies", &flagzgrpc.Policies{}, "RPC policies")
+	assert.NoError(t, set.Set("rpc_policies", `{"methods": {"/pkg.Service/Get": {"timeout": "250ms"}}}`))
+	assert.Error(t, set.Set("rpc_policies", `{"methods": {"Get": {"deny": true}}}`))
+	assert.Error(t, set.Set("rpc_policies", `{"default": {"rate_limit": -1}}`))
+	assert.Error(t, set.Set("rpc_policies", `{"default": {"timeout": "soon"}}`))
+}
+
+func TestUnaryServerInterceptor_AppliesCurrentPolicies(t *testing.T) {
+	i, set := newInterceptor(t, `{"methods": {"/pkg.Service/Get": {"deny": true}}}`)
+	_, err := callUnary(i, getMethod)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = callUnary(i, listMethod)
+	assert.NoError(t, err, "other methods must not be denied")
+
+	require.NoError(t, set.Set("rpc_policies", `{"default": {"timeout": "1m", "verbose": true}}`))
+	deadline, err := callUnary(i, getMethod)
+	assert.NoError(t, err, "changes of the flag must apply to the next calls")
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second, "timeouts must set deadlines")
+}
+
+func TestUnaryServerInterceptor_RateLimits(t *testing.T) {
+	i, _ := newInterceptor(t, `{"methods": {"/pkg.Service/Get": {"rate_limit": 1}}}`)
+	_, err := callUnary(i, getMethod)
+	assert.NoError(t, err)
+	_, err = callUnary(i, getMethod)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "calls beyond the rate limit must be rejected")
+	_, err = callUnary(i, listMethod)
+	assert.NoError(t, err, "rate limits must be per method")
+}
+
+func TestStreamServerInterceptor_BoundsStreams(t *testing.T) {
+	i, _ := newInterceptor(t, `{"default": {"timeout": "1m"}}`)
+	var deadline time.Time
+	err := i.StreamServerInterceptor()(nil, &fakeServerStream{ctx: context.Background()},
+		&grpc.StreamServerInfo{FullMethod: listMethod}, func(srv interface{}, stream grpc.ServerStream) error {
+			deadline, _ = stream.Context().Deadline()
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.False(t, deadline.IsZero(), "timeouts must bound the stream")
+}
+
+func TestUnaryClientInterceptor_FailsDeniedCallsLocally(t *testing.T) {
+	i, _ := newInterceptor(t, `{"methods": {"/pkg.Service/*": {"deny": true}}}`)
+	invoked := false
+	err := i.UnaryClientInterceptor()(context.Background(), getMethod, nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+			opts ...grpc.CallOption) error {
+			invoked = true
+			return nil
+		})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.False(t, invoked, "denied calls must not be sent")
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+type testingLog struct {
+	T *testing.T
+}
+
+func (tl *testingLog) Printf(format string, v ...interface{}) {
+	tl.T.Logf(format+"\n", v...)
+}
@@ -0,0 +1,95 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package flagzhttp provides net/http middleware driven by dynamic flags (feature gates, maintenance mode, request body
+// size limits and timeouts), reading the current values of the flags on every request so that HTTP services are
+// tunable at runtime without any glue code.
+
+package flagzhttp
+
+import (
+	"net/http"
+
+	"github.com/mwitkow/go-flagz"
+)
+
+const defaultMaintenanceMessage = "Service is under maintenance, please try again later.\n"
+
+// Middleware wraps an http.Handler.
+type Middleware func(http.Handler) http.Handler
+
+// Chain applies `middleware` to `handler`, the first one being the outermost.
+func Chain(handler http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// FeatureGate serves requests only while `enabled` is true, and responds with `404 Not Found` otherwise, as if the
+// handler didn't exist.
+func FeatureGate(enabled *flagz.DynBoolValue) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if !enabled.Get() {
+				http.NotFound(resp, req)
+				return
+			}
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+// MaintenanceMode responds with `503 Service Unavailable` and the current value of `message` (or a default message if
+// it is nil or empty) while `enabled` is true, and serves requests otherwise.
+func MaintenanceMode(enabled *flagz.DynBoolValue, message *flagz.DynStringValue) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if !enabled.Get() {
+				next.ServeHTTP(resp, req)
+				return
+			}
+			body := defaultMaintenanceMessage
+			if message != nil && message.Get() != "" {
+				body = message.Get()
+			}
+			resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			resp.Header().Set("Retry-After", "120")
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			resp.Write([]byte(body))
+		})
+	}
+}
+
+// MaxBodySize limits the size of request bodies to the current value of `limit` in bytes, with zero or less being
+// unlimited. Requests declaring larger bodies are rejected with `413 Request Entity Too Large`, and reads of larger
+// bodies fail past the limit.
+func MaxBodySize(limit *flagz.DynInt64Value) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			maxBytes := limit.Get()
+			if maxBytes > 0 {
+				if req.ContentLength > maxBytes {
+					http.Error(resp, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				req.Body = http.MaxBytesReader(resp, req.Body, maxBytes)
+			}
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
+
+// Timeout bounds the handling of requests to the current value of `timeout`, with zero or less being unbounded.
+// Requests timing out get a `503 Service Unavailable`, see `http.TimeoutHandler`.
+func Timeout(timeout *flagz.DynDurationValue) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			if d := timeout.Get(); d > 0 {
+				http.TimeoutHandler(next, d, "request timed out").ServeHTTP(resp, req)
+				return
+			}
+			next.ServeHTTP(resp, req)
+		})
+	}
+}
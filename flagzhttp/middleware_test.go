@@ -0,0 +1,99 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzhttp_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/flagzhttp"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var okHandler = http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+	if _, err := ioutil.ReadAll(req.Body); err != nil {
+		http.Error(resp, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp.Write([]byte("ok"))
+})
+
+func serve(handler http.Handler, body string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest("POST", "/some/path", strings.NewReader(body)))
+	return resp
+}
+
+func TestFeatureGate(t *testing.T) {
+	set := flag.NewFlagSet("flagzhttp", flag.ContinueOnError)
+	enabled := flagz.DynBool(set, "new_api", false, "enables the new API")
+	handler := flagzhttp.FeatureGate(enabled)(okHandler)
+	assert.Equal(t, http.StatusNotFound, serve(handler, "").Code)
+	require.NoError(t, set.Set("new_api", "true"))
+	assert.Equal(t, http.StatusOK, serve(handler, "").Code, "enabling the flag must open the gate")
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	set := flag.NewFlagSet("flagzhttp", flag.ContinueOnError)
+	enabled := flagz.DynBool(set, "maintenance", false, "maintenance mode")
+	message := flagz.DynString(set, "maintenance_message", "", "message shown in maintenance mode")
+	handler := flagzhttp.MaintenanceMode(enabled, message)(okHandler)
+	assert.Equal(t, http.StatusOK, serve(handler, "").Code)
+
+	require.NoError(t, set.Set("maintenance", "true"))
+	resp := serve(handler, "")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Contains(t, resp.Body.String(), "maintenance", "the default message must be shown")
+	assert.NotEmpty(t, resp.Header().Get("Retry-After"))
+	require.NoError(t, set.Set("maintenance_message", "Back at 10:00 UTC"))
+	assert.Equal(t, "Back at 10:00 UTC", serve(handler, "").Body.String())
+}
+
+func TestMaxBodySize(t *testing.T) {
+	set := flag.NewFlagSet("flagzhttp", flag.ContinueOnError)
+	limit := flagz.DynInt64(set, "max_body_bytes", 0, "maximum size of request bodies")
+	handler := flagzhttp.MaxBodySize(limit)(okHandler)
+	assert.Equal(t, http.StatusOK, serve(handler, "0123456789").Code, "zero must be unlimited")
+
+	require.NoError(t, set.Set("max_body_bytes", "5"))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(handler, "0123456789").Code)
+	assert.Equal(t, http.StatusOK, serve(handler, "01234").Code)
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/some/path", strings.NewReader("0123456789"))
+	req.ContentLength = -1
+	handler.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "reads past the limit must fail for bodies of unknown size")
+}
+
+func TestTimeout(t *testing.T) {
+	set := flag.NewFlagSet("flagzhttp", flag.ContinueOnError)
+	timeout := flagz.DynDuration(set, "request_timeout", 0, "timeout of requests")
+	slowHandler := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+			resp.Write([]byte("ok"))
+		case <-req.Context().Done():
+		}
+	})
+	handler := flagzhttp.Chain(slowHandler, flagzhttp.Timeout(timeout))
+	assert.Equal(t, http.StatusOK, serve(handler, "").Code, "zero must be unbounded")
+	require.NoError(t, set.Set("request_timeout", "10ms"))
+	assert.Equal(t, http.StatusServiceUnavailable, serve(handler, "").Code)
+}
+
+func TestChain_AppliesOutermostFirst(t *testing.T) {
+	set := flag.NewFlagSet("flagzhttp", flag.ContinueOnError)
+	gate := flagz.DynBool(set, "new_api", false, "enables the new API")
+	maintenance := flagz.DynBool(set, "maintenance", true, "maintenance mode")
+	handler := flagzhttp.Chain(okHandler, flagzhttp.MaintenanceMode(maintenance, nil), flagzhttp.FeatureGate(gate))
+	assert.Equal(t, http.StatusServiceUnavailable, serve(handler, "").Code)
+}
@@ -0,0 +1,63 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package flagzlog provides adapters implementing `flagz.Logger` for zap, zerolog and log/slog, turning the `key=value`
+// pairs of the messages of the Updaters into structured fields, `Dyn*Level` flags changing the level of each
+// library at runtime, and samplers of each library following the rates of a `flagz.DynSamplingRate`.
+
+package flagzlog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field is a `key=value` pair of a message, e.g. `flag=foo` of "flagz: updated flag=foo to value=bar".
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Severity is how bad a message is, as guessed from its text by `ParseMessage`.
+type Severity int
+
+const (
+	// InfoSeverity is the severity of regular messages, e.g. of updated flags.
+	InfoSeverity Severity = iota
+	// WarnSeverity is the severity of messages of ignored updates.
+	WarnSeverity
+	// ErrorSeverity is the severity of messages of failures and errors.
+	ErrorSeverity
+)
+
+// ParseMessage formats a `Printf` call and splits it into the message and its `key=value` fields, which are kept in the
+// message too so that it reads the same as with a plain logger. The severity is Error for messages mentioning failures
+// or errors, Warn for ignored updates, and Info otherwise.
+func ParseMessage(format string, v ...interface{}) (string, Severity, []Field) {
+	msg := fmt.Sprintf(format, v...)
+	var fields []Field
+	for _, word := range strings.Fields(msg) {
+		i := strings.Index(word, "=")
+		if i <= 0 || i == len(word)-1 {
+			continue
+		}
+		key := word[:i]
+		if strings.ContainsAny(key, "\"'()[]{}:") {
+			continue
+		}
+		fields = append(fields, Field{Key: key, Value: strings.TrimRight(word[i+1:], ",;:")})
+	}
+	return msg, severityOf(msg), fields
+}
+
+func severityOf(msg string) Severity {
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "fail") || strings.Contains(lower, "error"):
+		return ErrorSeverity
+	case strings.Contains(lower, "ignoring"):
+		return WarnSeverity
+	default:
+		return InfoSeverity
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzlog_test
+
+import (
+	"testing"
+
+	"github.com/mwitkow/go-flagz/flagzlog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMessage(t *testing.T) {
+	msg, severity, fields := flagzlog.ParseMessage("flagz: updated flag=%v to value=%v at revision=%v", "foo", "bar", 3)
+	assert.Equal(t, "flagz: updated flag=foo to value=bar at revision=3", msg)
+	assert.Equal(t, flagzlog.InfoSeverity, severity)
+	assert.Equal(t, []flagzlog.Field{{"flag", "foo"}, {"value", "bar"}, {"revision", "3"}}, fields)
+
+	_, severity, fields = flagzlog.ParseMessage("flagz: ignoring updating flag=%v, because of: %v", "foo", "reasons")
+	assert.Equal(t, flagzlog.WarnSeverity, severity)
+	assert.Equal(t, []flagzlog.Field{{"flag", "foo"}}, fields, "trailing punctuation must be trimmed")
+
+	_, severity, fields = flagzlog.ParseMessage("flagz: git sync failed: %v", "x == y")
+	assert.Equal(t, flagzlog.ErrorSeverity, severity)
+	assert.Empty(t, fields, "words without keys or values aren't fields")
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzlog
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+)
+
+// SlogLogger is a `flagz.Logger` logging to a slog.Logger.
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// Slog constructs a `flagz.Logger` logging to `logger`, with the fields of messages as string attributes.
+func Slog(logger *slog.Logger) *SlogLogger {
+	return &SlogLogger{logger: logger}
+}
+
+// Printf implements `flagz.Logger`.
+func (l *SlogLogger) Printf(format string, v ...interface{}) {
+	msg, severity, fields := ParseMessage(format, v...)
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		attrs = append(attrs, slog.String(f.Key, f.Value))
+	}
+	level := slog.LevelInfo
+	switch severity {
+	case ErrorSeverity:
+		level = slog.LevelError
+	case WarnSeverity:
+		level = slog.LevelWarn
+	}
+	l.logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// DynSlogLevel creates a `flagz.DynString` flag holding the name of a slog level (e.g. "DEBUG" or "WARN+2"),
+// defaulting to the current level of `levelVar` and setting it on every change.
+func DynSlogLevel(flagSet *flag.FlagSet, name string, levelVar *slog.LevelVar, usage string) *flagz.DynStringValue {
+	dynValue := flagz.DynString(flagSet, name, levelVar.Level().String(), usage)
+	dynValue.WithValidator(func(value string) error {
+		var level slog.Level
+		return level.UnmarshalText([]byte(value))
+	})
+	dynValue.WithNotifier(func(oldValue string, newValue string) {
+		var level slog.Level
+		if level.UnmarshalText([]byte(newValue)) == nil {
+			levelVar.Set(level)
+		}
+	})
+	return dynValue
+}
+
+// SampledSlogHandler wraps `handler` to only handle the records sampled with the latest rates of `rate`, by the
+// lowercase name of their level, e.g. `1,debug:0.01` handles 1% of the debug records and all others.
+func SampledSlogHandler(handler slog.Handler, rate *flagz.DynSamplingRateValue) slog.Handler {
+	return &sampledSlogHandler{Handler: handler, rate: rate}
+}
+
+type sampledSlogHandler struct {
+	slog.Handler
+	rate *flagz.DynSamplingRateValue
+}
+
+func (h *sampledSlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if !h.rate.Sample(strings.ToLower(record.Level.String())) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *sampledSlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sampledSlogHandler{Handler: h.Handler.WithAttrs(attrs), rate: h.rate}
+}
+
+func (h *sampledSlogHandler) WithGroup(name string) slog.Handler {
+	return &sampledSlogHandler{Handler: h.Handler.WithGroup(name), rate: h.rate}
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/flagzlog"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := slog.NewJSONHandler(buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	flagzlog.Slog(slog.New(handler)).Printf("flagz: updated flag=%v to value=%v", "foo", "bar")
+	entry := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, map[string]interface{}{
+		"level": "INFO",
+		"msg":   "flagz: updated flag=foo to value=bar",
+		"flag":  "foo",
+		"value": "bar",
+	}, entry)
+}
+
+func TestDynSlogLevel(t *testing.T) {
+	set := flag.NewFlagSet("flagzlog", flag.ContinueOnError)
+	levelVar := &slog.LevelVar{}
+	dynLevel := flagzlog.DynSlogLevel(set, "log_level", levelVar, "log level")
+	assert.Equal(t, "INFO", dynLevel.Get())
+	assert.Error(t, set.Set("log_level", "loud"))
+	require.NoError(t, set.Set("log_level", "warn+2"))
+	assert.Eventually(t, func() bool { return levelVar.Level() == slog.LevelWarn+2 }, time.Second, time.Millisecond)
+}
+
+func TestSampledSlogHandler(t *testing.T) {
+	set := flag.NewFlagSet("flagzlog", flag.ContinueOnError)
+	rate := flagz.DynSamplingRate(set, "log_sampling", flagz.SamplingRates{Overall: 1}, "log sampling")
+	buf := &bytes.Buffer{}
+	handler := slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	logger := slog.New(flagzlog.SampledSlogHandler(handler, rate)).With("component", "test")
+	require.NoError(t, set.Set("log_sampling", "1,warn:0"))
+	logger.Warn("dropped")
+	logger.Debug("kept")
+	assert.NotContains(t, buf.String(), "dropped")
+	assert.Contains(t, buf.String(), "msg=kept component=test")
+}
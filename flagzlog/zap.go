@@ -0,0 +1,76 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzlog
+
+import (
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ZapLogger is a `flagz.Logger` logging to a zap.Logger.
+type ZapLogger struct {
+	logger *zap.Logger
+}
+
+// Zap constructs a `flagz.Logger` logging to `logger`, with the fields of messages as string fields.
+func Zap(logger *zap.Logger) *ZapLogger {
+	return &ZapLogger{logger: logger}
+}
+
+// Printf implements `flagz.Logger`.
+func (l *ZapLogger) Printf(format string, v ...interface{}) {
+	msg, severity, fields := ParseMessage(format, v...)
+	zapFields := make([]zap.Field, 0, len(fields))
+	for _, f := range fields {
+		zapFields = append(zapFields, zap.String(f.Key, f.Value))
+	}
+	switch severity {
+	case ErrorSeverity:
+		l.logger.Error(msg, zapFields...)
+	case WarnSeverity:
+		l.logger.Warn(msg, zapFields...)
+	default:
+		l.logger.Info(msg, zapFields...)
+	}
+}
+
+// DynZapLevel creates a `flagz.DynString` flag holding the name of a zap level (e.g. "debug" or "warn"), defaulting to
+// the current level of `level` and setting it on every change.
+func DynZapLevel(flagSet *flag.FlagSet, name string, level zap.AtomicLevel, usage string) *flagz.DynStringValue {
+	dynValue := flagz.DynString(flagSet, name, level.String(), usage)
+	dynValue.WithValidator(func(value string) error {
+		_, err := zapcore.ParseLevel(value)
+		return err
+	})
+	dynValue.WithNotifier(func(oldValue string, newValue string) {
+		if parsed, err := zapcore.ParseLevel(newValue); err == nil {
+			level.SetLevel(parsed)
+		}
+	})
+	return dynValue
+}
+
+// SampledZapCore wraps `core` to only write the entries sampled with the latest rates of `rate`, by the name of their
+// level, e.g. `1,debug:0.01` writes 1% of the debug entries and all others.
+func SampledZapCore(core zapcore.Core, rate *flagz.DynSamplingRateValue) zapcore.Core {
+	return &sampledZapCore{Core: core, rate: rate}
+}
+
+type sampledZapCore struct {
+	zapcore.Core
+	rate *flagz.DynSamplingRateValue
+}
+
+func (c *sampledZapCore) With(fields []zapcore.Field) zapcore.Core {
+	return &sampledZapCore{Core: c.Core.With(fields), rate: c.rate}
+}
+
+func (c *sampledZapCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(entry.Level) || !c.rate.Sample(entry.Level.String()) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
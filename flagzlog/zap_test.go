@@ -0,0 +1,51 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzlog_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/flagzlog"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestZap(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	flagzlog.Zap(zap.New(core)).Printf("flagz: failed updating flag=%v, because of: %v", "foo", "bad value")
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	assert.Equal(t, zapcore.ErrorLevel, entry.Level)
+	assert.Equal(t, "flagz: failed updating flag=foo, because of: bad value", entry.Message)
+	assert.Equal(t, map[string]interface{}{"flag": "foo"}, entry.ContextMap())
+}
+
+func TestDynZapLevel(t *testing.T) {
+	set := flag.NewFlagSet("flagzlog", flag.ContinueOnError)
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	dynLevel := flagzlog.DynZapLevel(set, "log_level", level, "log level")
+	assert.Equal(t, "info", dynLevel.Get())
+	assert.Error(t, set.Set("log_level", "loud"))
+	require.NoError(t, set.Set("log_level", "debug"))
+	assert.Eventually(t, func() bool { return level.Level() == zapcore.DebugLevel }, time.Second, time.Millisecond)
+}
+
+func TestSampledZapCore(t *testing.T) {
+	set := flag.NewFlagSet("flagzlog", flag.ContinueOnError)
+	rate := flagz.DynSamplingRate(set, "log_sampling", flagz.SamplingRates{Overall: 1}, "log sampling")
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(flagzlog.SampledZapCore(core, rate)).With(zap.String("component", "test"))
+	logger.Debug("kept")
+	require.NoError(t, set.Set("log_sampling", "1,debug:0"))
+	logger.Debug("dropped")
+	logger.Info("kept")
+	require.Equal(t, 2, logs.Len())
+	assert.Equal(t, map[string]interface{}{"component": "test"}, logs.All()[1].ContextMap())
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzlog
+
+import (
+	"github.com/mwitkow/go-flagz"
+	"github.com/rs/zerolog"
+	flag "github.com/spf13/pflag"
+)
+
+// ZerologLogger is a `flagz.Logger` logging to a zerolog.Logger.
+type ZerologLogger struct {
+	logger zerolog.Logger
+}
+
+// Zerolog constructs a `flagz.Logger` logging to `logger`, with the fields of messages as string fields.
+func Zerolog(logger zerolog.Logger) *ZerologLogger {
+	return &ZerologLogger{logger: logger}
+}
+
+// Printf implements `flagz.Logger`.
+func (l *ZerologLogger) Printf(format string, v ...interface{}) {
+	msg, severity, fields := ParseMessage(format, v...)
+	var event *zerolog.Event
+	switch severity {
+	case ErrorSeverity:
+		event = l.logger.Error()
+	case WarnSeverity:
+		event = l.logger.Warn()
+	default:
+		event = l.logger.Info()
+	}
+	for _, f := range fields {
+		event = event.Str(f.Key, f.Value)
+	}
+	event.Msg(msg)
+}
+
+// DynZerologLevel creates a `flagz.DynString` flag holding the name of a zerolog level (e.g. "debug" or "warn"),
+// setting `zerolog.SetGlobalLevel` to `value` and to every change.
+func DynZerologLevel(flagSet *flag.FlagSet, name string, value zerolog.Level, usage string) *flagz.DynStringValue {
+	zerolog.SetGlobalLevel(value)
+	dynValue := flagz.DynString(flagSet, name, value.String(), usage)
+	dynValue.WithValidator(func(value string) error {
+		_, err := zerolog.ParseLevel(value)
+		return err
+	})
+	dynValue.WithNotifier(func(oldValue string, newValue string) {
+		if parsed, err := zerolog.ParseLevel(newValue); err == nil {
+			zerolog.SetGlobalLevel(parsed)
+		}
+	})
+	return dynValue
+}
+
+// ZerologSampler returns a zerolog.Sampler sampling events with the latest rates of `rate`, by the name of their level,
+// e.g. `1,debug:0.01` logs 1% of the debug events and all others. Use it with `zerolog.Logger.Sample`.
+func ZerologSampler(rate *flagz.DynSamplingRateValue) zerolog.Sampler {
+	return zerologSampler{rate: rate}
+}
+
+type zerologSampler struct {
+	rate *flagz.DynSamplingRateValue
+}
+
+func (s zerologSampler) Sample(level zerolog.Level) bool {
+	return s.rate.Sample(level.String())
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/flagzlog"
+	"github.com/rs/zerolog"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZerolog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	flagzlog.Zerolog(zerolog.New(buf)).Printf("flagz: ignoring deletion of flag=%v at revision=%v", "foo", 7)
+	entry := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, map[string]interface{}{
+		"level":    "warn",
+		"message":  "flagz: ignoring deletion of flag=foo at revision=7",
+		"flag":     "foo",
+		"revision": "7",
+	}, entry)
+}
+
+func TestDynZerologLevel(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	set := flag.NewFlagSet("flagzlog", flag.ContinueOnError)
+	flagzlog.DynZerologLevel(set, "log_level", zerolog.WarnLevel, "log level")
+	assert.Equal(t, zerolog.WarnLevel, zerolog.GlobalLevel(), "the default must be applied")
+	assert.Error(t, set.Set("log_level", "loud"))
+	require.NoError(t, set.Set("log_level", "debug"))
+	assert.Eventually(t, func() bool { return zerolog.GlobalLevel() == zerolog.DebugLevel }, time.Second,
+		time.Millisecond)
+}
+
+func TestZerologSampler(t *testing.T) {
+	set := flag.NewFlagSet("flagzlog", flag.ContinueOnError)
+	rate := flagz.DynSamplingRate(set, "log_sampling", flagz.SamplingRates{Overall: 1}, "log sampling")
+	buf := &bytes.Buffer{}
+	logger := zerolog.New(buf).Sample(flagzlog.ZerologSampler(rate))
+	require.NoError(t, set.Set("log_sampling", "1,debug:0"))
+	logger.Debug().Msg("dropped")
+	logger.Info().Msg("kept")
+	assert.Equal(t, `{"level":"info","message":"kept"}`+"\n", buf.String())
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzotel
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mwitkow/go-flagz"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Sampler is an OpenTelemetry sampler sampling by the trace ID with the latest rate of a `flagz.DynSamplingRate`, like
+// `sdktrace.TraceIDRatioBased` does with a fixed one, so trace volume can be dialed at runtime.
+type Sampler struct {
+	rate       *flagz.DynSamplingRateValue
+	categoryOf func(sdktrace.SamplingParameters) string
+}
+
+// NewSampler constructs a Sampler with the rates of `rate` by span name, e.g. `0.01,checkout:0.5` samples 1% of the
+// root spans and half of the ones named "checkout". Wrap it in `sdktrace.ParentBased` so that child spans follow the
+// decision of their parents.
+func NewSampler(rate *flagz.DynSamplingRateValue) *Sampler {
+	return &Sampler{rate: rate, categoryOf: func(p sdktrace.SamplingParameters) string { return p.Name }}
+}
+
+// WithCategory replaces the span name as the category of the spans, e.g. with the value of an attribute.
+func (s *Sampler) WithCategory(categoryOf func(sdktrace.SamplingParameters) string) *Sampler {
+	s.categoryOf = categoryOf
+	return s
+}
+
+// ShouldSample implements `sdktrace.Sampler`.
+func (s *Sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	rate := s.rate.Rate(s.categoryOf(p))
+	// the same comparison of the low 63 bits of the trace ID as `sdktrace.TraceIDRatioBased`, so that services sampling
+	// with the same rate agree on which traces to sample.
+	decision := sdktrace.Drop
+	if rate >= 1 || binary.BigEndian.Uint64(p.TraceID[8:16])>>1 < uint64(rate*(1<<63)) {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+// Description implements `sdktrace.Sampler`.
+func (s *Sampler) Description() string {
+	return fmt.Sprintf("FlagzSampler{%v}", s.rate.String())
+}
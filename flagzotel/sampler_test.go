@@ -0,0 +1,68 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzotel_test
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/flagzotel"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func sampledCount(sampler sdktrace.Sampler, name string) int {
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		p := sdktrace.SamplingParameters{ParentContext: context.Background(), Name: name}
+		binary.BigEndian.PutUint64(p.TraceID[8:], uint64(i)*0x9e3779b97f4a7c15)
+		if sampler.ShouldSample(p).Decision == sdktrace.RecordAndSample {
+			sampled++
+		}
+	}
+	return sampled
+}
+
+func TestSampler_FollowsLatestRates(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	rate := flagz.DynSamplingRate(set, "some_sampling", flagz.SamplingRates{Overall: 0.1}, "Use it or lose it")
+	sampler := flagzotel.NewSampler(rate)
+	assert.InDelta(t, 100, sampledCount(sampler, "checkout"), 30)
+
+	require.NoError(t, set.Set("some_sampling", "0,checkout:1"))
+	assert.Equal(t, 1000, sampledCount(sampler, "checkout"), "changes must apply to the next spans")
+	assert.Equal(t, 0, sampledCount(sampler, "healthz"))
+	assert.Equal(t, "FlagzSampler{0,checkout:1}", sampler.Description())
+}
+
+func TestSampler_AgreesWithTraceIDRatioBased(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	rate := flagz.DynSamplingRate(set, "some_sampling", flagz.SamplingRates{Overall: 0.25}, "Use it or lose it")
+	sampler := flagzotel.NewSampler(rate).WithCategory(func(sdktrace.SamplingParameters) string { return "" })
+	reference := sdktrace.TraceIDRatioBased(0.25)
+	for i := 0; i < 1000; i++ {
+		p := sdktrace.SamplingParameters{ParentContext: context.Background()}
+		binary.BigEndian.PutUint64(p.TraceID[8:], uint64(i)*0x9e3779b97f4a7c15)
+		assert.Equal(t, reference.ShouldSample(p).Decision, sampler.ShouldSample(p).Decision)
+	}
+}
+
+func TestSampler_KeepsTraceStateOfParent(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	rate := flagz.DynSamplingRate(set, "some_sampling", flagz.SamplingRates{Overall: 1}, "Use it or lose it")
+	state, err := trace.ParseTraceState("vendor=value")
+	require.NoError(t, err)
+	parent := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceState: state,
+	}))
+	result := flagzotel.NewSampler(rate).ShouldSample(sdktrace.SamplingParameters{ParentContext: parent})
+	assert.Equal(t, "vendor=value", result.Tracestate.String())
+}
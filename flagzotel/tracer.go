@@ -0,0 +1,102 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package flagzotel provides a `flagz.UpdateTracer` emitting OpenTelemetry spans and metrics for the stages of the
+// update pipeline of Updaters (initialization, watch events, validation, applying and rolling back values), so that the
+// latency of changes from the source to the flags of every instance is observable end-to-end.
+//
+// Spans and metrics carry the `flagz.revision` of the source (e.g. the etcd revision), which correlates them with the
+// spans of the writers of the changes, such as push tooling.
+//
+// Its Sampler samples traces with the latest rates of a `flagz.DynSamplingRate`.
+
+package flagzotel
+
+import (
+	"context"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer and meter of the Tracer.
+const InstrumentationName = "github.com/mwitkow/go-flagz/flagzotel"
+
+const (
+	// FlagKey is the attribute of the name of the flag of a stage, missing for stages of all flags.
+	FlagKey = attribute.Key("flagz.flag")
+	// StageKey is the attribute of the `flagz.UpdateStage` of a metric.
+	StageKey = attribute.Key("flagz.stage")
+	// RevisionKey is the attribute of the backend-specific revision of the source of a span.
+	RevisionKey = attribute.Key("flagz.revision")
+	// OutcomeKey is the attribute of the outcome of a stage, one of "ok", "skipped" and "rejected".
+	OutcomeKey = attribute.Key("flagz.outcome")
+)
+
+// Tracer is a `flagz.UpdateTracer` emitting a span named `flagz.<stage>` for every stage, recording their duration in
+// the `flagz.update.stage.duration` histogram and counting the outcomes of watch events in the `flagz.updates` counter.
+type Tracer struct {
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	updates  metric.Int64Counter
+}
+
+// New constructs a Tracer emitting spans through `tracerProvider` and metrics through `meterProvider`, e.g. the
+// global `otel.GetTracerProvider()` and `otel.GetMeterProvider()`.
+func New(tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider) (*Tracer, error) {
+	meter := meterProvider.Meter(InstrumentationName)
+	duration, err := meter.Float64Histogram("flagz.update.stage.duration", metric.WithUnit("s"),
+		metric.WithDescription("Duration of the stages of applying flag values from the source of an Updater."))
+	if err != nil {
+		return nil, err
+	}
+	updates, err := meter.Int64Counter("flagz.updates",
+		metric.WithDescription("Changes of flags watched by an Updater, by outcome."))
+	if err != nil {
+		return nil, err
+	}
+	return &Tracer{tracer: tracerProvider.Tracer(InstrumentationName), duration: duration, updates: updates}, nil
+}
+
+// StartStage implements `flagz.UpdateTracer`.
+func (t *Tracer) StartStage(ctx context.Context, stage flagz.UpdateStage, flagName string,
+	revision string) (context.Context, func(err error)) {
+	attrs := []attribute.KeyValue{StageKey.String(string(stage))}
+	if flagName != "" {
+		attrs = append(attrs, FlagKey.String(flagName))
+	}
+	start := time.Now()
+	ctx, span := t.tracer.Start(ctx, "flagz."+string(stage), trace.WithAttributes(attrs...),
+		trace.WithAttributes(RevisionKey.String(revision)))
+	return ctx, func(err error) {
+		outcome := outcomeOf(err)
+		span.SetAttributes(OutcomeKey.String(outcome))
+		if outcome == "rejected" {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else if err != nil {
+			span.AddEvent("skipped", trace.WithAttributes(attribute.String("reason", err.Error())))
+		}
+		span.End()
+		metricAttrs := metric.WithAttributes(append(attrs, OutcomeKey.String(outcome))...)
+		t.duration.Record(ctx, time.Since(start).Seconds(), metricAttrs)
+		if stage == flagz.WatchEventStage {
+			t.updates.Add(ctx, 1, metricAttrs)
+		}
+	}
+}
+
+func outcomeOf(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case flagz.IsSkippedUpdateError(err):
+		return "skipped"
+	default:
+		return "rejected"
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagzotel_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/flagzotel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTracer(t *testing.T) (*flagzotel.Tracer, *tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	tracer, err := flagzotel.New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	require.NoError(t, err)
+	return tracer, spans, reader
+}
+
+func TestTracer_NestsStageSpans(t *testing.T) {
+	tracer, spans, _ := newTracer(t)
+	ctx, endEvent := tracer.StartStage(context.Background(), flagz.WatchEventStage, "some_dynint", "42")
+	_, endApply := tracer.StartStage(ctx, flagz.ApplyStage, "some_dynint", "42")
+	endApply(errors.New("bad value"))
+	endEvent(flagz.ErrNotInCanary)
+
+	ended := spans.Ended()
+	require.Len(t, ended, 2)
+	apply, event := ended[0], ended[1]
+	assert.Equal(t, "flagz.apply", apply.Name())
+	assert.Equal(t, event.SpanContext().SpanID(), apply.Parent().SpanID(), "stages must nest in their watch event")
+	assert.Equal(t, codes.Error, apply.Status().Code, "rejected values must fail their span")
+	assert.Contains(t, apply.Attributes(), flagzotel.RevisionKey.String("42"))
+	assert.Contains(t, event.Attributes(), flagzotel.OutcomeKey.String("skipped"))
+	assert.Equal(t, codes.Unset, event.Status().Code, "skipped values must not fail their span")
+}
+
+func TestTracer_RecordsMetrics(t *testing.T) {
+	tracer, _, reader := newTracer(t)
+	_, end := tracer.StartStage(context.Background(), flagz.WatchEventStage, "some_dynint", "42")
+	end(nil)
+	_, end = tracer.StartStage(context.Background(), flagz.InitializeStage, "", "")
+	end(nil)
+
+	metrics := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &metrics))
+	require.Len(t, metrics.ScopeMetrics, 1)
+	byName := map[string]metricdata.Aggregation{}
+	for _, m := range metrics.ScopeMetrics[0].Metrics {
+		byName[m.Name] = m.Data
+	}
+	updates := byName["flagz.updates"].(metricdata.Sum[int64])
+	require.Len(t, updates.DataPoints, 1, "only watch events must be counted")
+	assert.EqualValues(t, 1, updates.DataPoints[0].Value)
+	flagName, _ := updates.DataPoints[0].Attributes.Value(flagzotel.FlagKey)
+	assert.Equal(t, attribute.StringValue("some_dynint"), flagName)
+	durations := byName["flagz.update.stage.duration"].(metricdata.Histogram[float64])
+	assert.Len(t, durations.DataPoints, 2, "durations must be recorded per stage")
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagztest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+)
+
+// UpdateGoldenEnv is the environment variable that makes `AssertFlagInventory` rewrite golden files instead of
+// comparing against them, e.g. `FLAGZ_UPDATE_GOLDEN=1 go test ./...` after an intended change of flags.
+const UpdateGoldenEnv = "FLAGZ_UPDATE_GOLDEN"
+
+// FlagInventory serializes the names, types, defaults and markers (dynamic, secret, deprecated) of all flags of
+// `flagSet`, one flag per line in the order of their names. Defaults of secret flags are redacted.
+//
+// The output only depends on the definitions of flags, not their current values, so it can be checked in as a golden
+// file.
+func FlagInventory(flagSet *flag.FlagSet) string {
+	buf := &bytes.Buffer{}
+	flagSet.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(buf, "%s type=%s default=%q", f.Name, f.Value.Type(), flagz.RedactFlagValue(f, f.DefValue))
+		if f.Shorthand != "" {
+			fmt.Fprintf(buf, " shorthand=%s", f.Shorthand)
+		}
+		if flagz.IsFlagDynamic(f) {
+			buf.WriteString(" dynamic")
+		}
+		if flagz.IsFlagSecret(f) {
+			buf.WriteString(" secret")
+		}
+		if f.Deprecated != "" {
+			buf.WriteString(" deprecated")
+		}
+		buf.WriteString("\n")
+	})
+	return buf.String()
+}
+
+// AssertFlagInventory compares the `FlagInventory` of `flagSet` against the golden file at `path`, failing the test
+// with the added and removed lines if they differ. This makes removals of flags and changes of their defaults or types
+// show up in code review as changes of the golden file.
+//
+// If `UpdateGoldenEnv` is set, the golden file is (re)written instead.
+func AssertFlagInventory(t testing.TB, flagSet *flag.FlagSet, path string) {
+	t.Helper()
+	actual := FlagInventory(flagSet)
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("flagztest: creating directory of golden file: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatalf("flagztest: writing golden file: %v", err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("flagztest: reading golden file (run with %s=1 to create it): %v", UpdateGoldenEnv, err)
+	}
+	if diff := inventoryDiff(string(expected), actual); diff != "" {
+		t.Errorf("flagztest: flags differ from golden file %v (run with %s=1 to update it):\n%s",
+			path, UpdateGoldenEnv, diff)
+	}
+}
+
+// inventoryDiff lists the lines removed from `expected` and added in `actual`, prefixed with "-" and "+".
+func inventoryDiff(expected string, actual string) string {
+	expectedLines := lineSet(expected)
+	actualLines := lineSet(actual)
+	buf := &bytes.Buffer{}
+	for _, line := range strings.Split(expected, "\n") {
+		if _, ok := actualLines[line]; !ok && line != "" {
+			fmt.Fprintf(buf, "- %s\n", line)
+		}
+	}
+	for _, line := range strings.Split(actual, "\n") {
+		if _, ok := expectedLines[line]; !ok && line != "" {
+			fmt.Fprintf(buf, "+ %s\n", line)
+		}
+	}
+	return buf.String()
+}
+
+func lineSet(text string) map[string]struct{} {
+	out := make(map[string]struct{})
+	for _, line := range strings.Split(text, "\n") {
+		out[line] = struct{}{}
+	}
+	return out
+}
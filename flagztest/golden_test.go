@@ -0,0 +1,69 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagztest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/flagztest"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlagInventory_IsDeterministic(t *testing.T) {
+	set := flag.NewFlagSet("flagztest", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_dynint", 5, "dynamic int")
+	set.StringP("some_string", "s", "foo", "static string")
+	flagz.DynString(set, "some_password", "hunter2", "secret string")
+	flagz.MarkFlagSecret(set.Lookup("some_password"))
+	set.Bool("some_old_bool", false, "deprecated bool")
+	set.MarkDeprecated("some_old_bool", "use something else")
+	set.Set("some_dynint", "7")
+
+	expected := "some_dynint type=dyn_int64 default=\"5\" dynamic\n" +
+		"some_old_bool type=bool default=\"false\" deprecated\n" +
+		"some_password type=dyn_string default=\"" + flagz.RedactedValue + "\" dynamic secret\n" +
+		"some_string type=string default=\"foo\" shorthand=s\n"
+	assert.Equal(t, expected, flagztest.FlagInventory(set), "current values must not change the inventory")
+}
+
+func TestAssertFlagInventory_ReportsChangedFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "flags.golden")
+	set := flag.NewFlagSet("flagztest", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_dynint", 5, "dynamic int")
+	set.String("some_string", "foo", "static string")
+
+	t.Setenv(flagztest.UpdateGoldenEnv, "1")
+	flagztest.AssertFlagInventory(t, set, path)
+	golden, err := ioutil.ReadFile(path)
+	require.NoError(t, err, "updating must create the golden file")
+	assert.Equal(t, flagztest.FlagInventory(set), string(golden))
+
+	t.Setenv(flagztest.UpdateGoldenEnv, "")
+	flagztest.AssertFlagInventory(t, set, path)
+
+	changed := flag.NewFlagSet("flagztest", flag.ContinueOnError)
+	flagz.DynInt64(changed, "some_dynint", 6, "dynamic int")
+	recorder := &recordingTB{TB: t}
+	flagztest.AssertFlagInventory(recorder, changed, path)
+	require.Len(t, recorder.errors, 1)
+	assert.Contains(t, recorder.errors[0], "- some_dynint type=dyn_int64 default=\"5\" dynamic\n")
+	assert.Contains(t, recorder.errors[0], "- some_string type=string default=\"foo\"\n")
+	assert.Contains(t, recorder.errors[0], "+ some_dynint type=dyn_int64 default=\"6\" dynamic\n")
+}
+
+// recordingTB records errors instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,18 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagztest
+
+import (
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+)
+
+// SyncNotifiersForTest makes the notifiers of all dynamic flags run synchronously in `Set` for the duration of the
+// test, see `flagz.SetSyncNotifiers`. As the mode is global, tests using it must not run in parallel with tests
+// relying on asynchronous notifiers.
+func SyncNotifiersForTest(t testing.TB) {
+	flagz.SetSyncNotifiers(true)
+	t.Cleanup(func() { flagz.SetSyncNotifiers(false) })
+}
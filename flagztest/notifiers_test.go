@@ -0,0 +1,29 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagztest_test
+
+import (
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/flagztest"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncNotifiersForTest_NotifiesBeforeSetReturns(t *testing.T) {
+	set := flag.NewFlagSet("flagztest", flag.ContinueOnError)
+	dynString := flagz.DynString(set, "some_string", "a", "dynamic string")
+	notified := ""
+	dynString.WithNotifier(func(oldValue string, newValue string) {
+		notified = newValue
+	})
+
+	t.Run("sync", func(t *testing.T) {
+		flagztest.SyncNotifiersForTest(t)
+		require.NoError(t, set.Set("some_string", "b"))
+		assert.Equal(t, "b", notified, "the notifier must have run when Set returns")
+	})
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagztest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+)
+
+// SetForTest sets flag `name` of `flagSet` to `value` for the duration of the test, restoring the previous value (and
+// "changed" state) when it finishes. The test fails right away if the flag doesn't exist or rejects the value.
+func SetForTest(t testing.TB, flagSet *flag.FlagSet, name string, value string) {
+	t.Helper()
+	SetAllForTest(t, flagSet, map[string]string{name: value})
+}
+
+// SetAllForTest sets multiple flags of `flagSet` for the duration of the test, in the order of their names, restoring
+// all of their previous values when it finishes. See `SetForTest`.
+func SetAllForTest(t testing.TB, flagSet *flag.FlagSet, values map[string]string) {
+	t.Helper()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := flagSet.Lookup(name)
+		if f == nil {
+			t.Fatalf("flagztest: flag %q not found", name)
+		}
+		restore := snapshotFlag(flagSet, f)
+		if err := flagSet.Set(name, values[name]); err != nil {
+			t.Fatalf("flagztest: setting flag %q for test: %v", name, err)
+		}
+		t.Cleanup(func() {
+			if err := restore(); err != nil {
+				t.Errorf("flagztest: restoring flag %q after test: %v", f.Name, err)
+			}
+		})
+	}
+}
+
+// snapshotFlag returns a function restoring the current value and "changed" state of `f`.
+func snapshotFlag(flagSet *flag.FlagSet, f *flag.Flag) func() error {
+	changed := f.Changed
+	var set func() error
+	switch v := f.Value.(type) {
+	case *flagz.DynStringSliceValue:
+		// the String of lists isn't in the CSV form their Set takes.
+		previous := csvString(v.Get())
+		set = func() error { return flagSet.Set(f.Name, previous) }
+	case *flagz.DynStringSetValue:
+		elements := []string{}
+		for element := range v.Get() {
+			elements = append(elements, element)
+		}
+		sort.Strings(elements)
+		previous := csvString(elements)
+		set = func() error { return flagSet.Set(f.Name, previous) }
+	case flag.SliceValue:
+		// the Set of pflag slices appends to values set before.
+		previous := v.GetSlice()
+		set = func() error { return v.Replace(previous) }
+	default:
+		previous := f.Value.String()
+		set = func() error { return flagSet.Set(f.Name, previous) }
+	}
+	return func() error {
+		err := set()
+		f.Changed = changed
+		return err
+	}
+}
+
+func csvString(elements []string) string {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	w.Write(elements)
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,38 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagztest_test
+
+import (
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/flagztest"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetForTest_RestoresPreviousValues(t *testing.T) {
+	set := flag.NewFlagSet("flagztest", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 1, "dynamic int")
+	dynSlice := flagz.DynStringSlice(set, "some_slice", []string{"a", "b"}, "dynamic slice")
+	staticInt := set.Int64("some_int", 1, "static int")
+	staticSlice := set.StringSlice("some_static_slice", []string{"x"}, "static slice")
+
+	t.Run("overrides", func(t *testing.T) {
+		flagztest.SetForTest(t, set, "some_dynint", "5")
+		flagztest.SetAllForTest(t, set, map[string]string{"some_slice": "c,\"d,e\"", "some_int": "7", "some_static_slice": "y"})
+		assert.EqualValues(t, 5, dynInt.Get())
+		assert.Equal(t, []string{"c", "d,e"}, dynSlice.Get())
+		assert.Equal(t, []string{"y"}, *staticSlice)
+		assert.EqualValues(t, 7, *staticInt)
+		// overriding the same flag twice must restore the original value.
+		flagztest.SetForTest(t, set, "some_dynint", "6")
+	})
+
+	assert.EqualValues(t, 1, dynInt.Get(), "values must be restored after the test")
+	assert.Equal(t, []string{"a", "b"}, dynSlice.Get(), "values must be restored after the test")
+	assert.EqualValues(t, 1, *staticInt, "values must be restored after the test")
+	assert.Equal(t, []string{"x"}, *staticSlice, "values must be restored after the test")
+	assert.False(t, set.Lookup("some_dynint").Changed, "changed state must be restored after the test")
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package flagztest provides helpers for testing code driven by dynamic flags, without running any of the real
+// backends.
+
+package flagztest
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+)
+
+// Updater is an in-memory `flagz.Updater` for tests. Values pushed with `Set` or `SetAll` before `Initialize` are
+// applied to all flags by it, and values pushed while watching are applied to dynamic flags right away, on the calling
+// go routine, so tests can assert on their effects without waiting.
+type Updater struct {
+	*flagz.UpdaterTracker
+	flagSet *flag.FlagSet
+
+	mu       sync.Mutex
+	values   map[string]string
+	revision int
+}
+
+// New constructs an Updater of `flagSet` without any values.
+func New(flagSet *flag.FlagSet) *Updater {
+	return &Updater{
+		UpdaterTracker: flagz.NewUpdaterTracker(),
+		flagSet:        flagSet,
+		values:         make(map[string]string),
+	}
+}
+
+// Initialize sets all values pushed so far into the FlagSet, both dynamic and static.
+func (u *Updater) Initialize() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.CheckTransition(flagz.UpdaterInitialized); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(u.values))
+	for name := range u.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := &flagz.FlagErrors{Source: "flagztest"}
+	for _, name := range names {
+		if err := u.setFlag(name, u.values[name], false /* dynamicOnly */); err != nil {
+			errs.Add(name, err)
+		}
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		return err
+	}
+	return u.Transition(flagz.UpdaterInitialized)
+}
+
+// Start makes the Updater apply the values pushed from now on to dynamic flags.
+func (u *Updater) Start() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.Transition(flagz.UpdaterWatching)
+}
+
+// Stop makes the Updater only store the values pushed from now on. Stopping an Updater that isn't watching is a no-op.
+func (u *Updater) Stop() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.State() != flagz.UpdaterWatching {
+		return nil
+	}
+	return u.Transition(flagz.UpdaterStopped)
+}
+
+// Set pushes a new value of flag `name`, as if it changed in a real backend. While watching, it is applied to the
+// flag and the error of applying it (e.g. `flagz.ErrFlagNotDynamic` or a `*flagz.ValidationError`) is returned, and
+// recorded in the Status and Events like the real backends do.
+func (u *Updater) Set(name string, value string) error {
+	err := u.SetAll(map[string]string{name: value})
+	if errs, ok := err.(*flagz.FlagErrors); ok {
+		return errs.Errors[0].Err
+	}
+	return err
+}
+
+// SetAll pushes new values of multiple flags in one revision, applying them in the order of their names. While
+// watching, it returns a `*flagz.FlagErrors` of the values that couldn't be applied. See `Set`.
+func (u *Updater) SetAll(values map[string]string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.revision++
+	u.RecordRevision(strconv.Itoa(u.revision))
+	names := make([]string, 0, len(values))
+	for name, value := range values {
+		u.values[name] = value
+		names = append(names, name)
+	}
+	if u.State() != flagz.UpdaterWatching {
+		return nil
+	}
+	sort.Strings(names)
+	errs := &flagz.FlagErrors{Source: "flagztest"}
+	for _, name := range names {
+		value := values[name]
+		shownValue := flagz.RedactFlagValue(u.flagSet.Lookup(name), value)
+		err := u.setFlag(name, value, true /* dynamicOnly */)
+		if err != nil {
+			errs.Add(name, err)
+		}
+		if !errors.Is(err, flagz.ErrFlagNotDynamic) && !errors.Is(err, flagz.ErrFlagPinned) {
+			u.RecordUpdate(name, shownValue, err)
+		}
+	}
+	u.RecordSync(nil)
+	return errs.ErrorOrNil()
+}
+
+// Values returns a copy of all the values pushed so far.
+func (u *Updater) Values() map[string]string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	out := make(map[string]string, len(u.values))
+	for name, value := range u.values {
+		out[name] = value
+	}
+	return out
+}
+
+func (u *Updater) setFlag(name string, value string, dynamicOnly bool) error {
+	f := u.flagSet.Lookup(name)
+	if f == nil {
+		return flagz.ErrFlagNotFound
+	}
+	if dynamicOnly && !flagz.IsFlagDynamic(f) {
+		return flagz.ErrFlagNotDynamic
+	}
+	// do not call flag.Value.Set, instead go through flagSet.Set (via SetFlagFromSource) to change "changed" state.
+	return flagz.SetFlagFromSource(u.flagSet, name, value, "flagztest")
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagztest_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/flagztest"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdater_ImplementsUpdater(t *testing.T) {
+	var _ flagz.Updater = flagztest.New(flag.NewFlagSet("flagztest", flag.ContinueOnError))
+}
+
+func TestUpdater_InitializesAllFlags(t *testing.T) {
+	set := flag.NewFlagSet("flagztest", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 1, "dynamic int")
+	staticInt := set.Int64("some_int", 1, "static int")
+	u := flagztest.New(set)
+	require.NoError(t, u.SetAll(map[string]string{"some_dynint": "2", "some_int": "3"}))
+	assert.EqualValues(t, 1, dynInt.Get(), "values must not be applied before Initialize")
+
+	require.NoError(t, u.Initialize())
+	assert.EqualValues(t, 2, dynInt.Get())
+	assert.EqualValues(t, 3, *staticInt, "static flags must be set on Initialize")
+	assert.Equal(t, "flagztest", flagz.FlagSource(set.Lookup("some_int")))
+	assert.Error(t, u.Initialize(), "initialize must only work once")
+}
+
+func TestUpdater_InitializeReportsBadValues(t *testing.T) {
+	set := flag.NewFlagSet("flagztest", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_dynint", 1, "dynamic int")
+	u := flagztest.New(set)
+	u.SetAll(map[string]string{"some_dynint": "not_a_number", "no_such_flag": "1"})
+	err := u.Initialize()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, flagz.ErrFlagNotFound))
+	assert.Equal(t, flagz.UpdaterNew, u.State(), "a failed Initialize must not change the state")
+}
+
+func TestUpdater_AppliesPushedValuesWhileWatching(t *testing.T) {
+	set := flag.NewFlagSet("flagztest", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 1, "dynamic int")
+	dynInt.WithValidator(flagz.ValidateDynInt64Range(0, 10))
+	staticInt := set.Int64("some_int", 1, "static int")
+	u := flagztest.New(set)
+	require.NoError(t, u.Initialize())
+	require.NoError(t, u.Start())
+
+	require.NoError(t, u.Set("some_dynint", "5"))
+	assert.EqualValues(t, 5, dynInt.Get(), "pushed values must be applied right away")
+	event := <-u.Events()
+	assert.Equal(t, "some_dynint", event.FlagName)
+	assert.Equal(t, "1", event.Revision)
+
+	var validationErr *flagz.ValidationError
+	assert.True(t, errors.As(u.Set("some_dynint", "50"), &validationErr), "rejected values must be returned")
+	assert.EqualValues(t, 5, dynInt.Get(), "rejected values must not be applied")
+	assert.Equal(t, flagz.ErrFlagNotDynamic, u.Set("some_int", "5"))
+	assert.EqualValues(t, 1, *staticInt, "static flags must not be updated while watching")
+	assert.EqualValues(t, 1, u.Status().UpdateErrors)
+
+	require.NoError(t, u.Stop())
+	require.NoError(t, u.Set("some_dynint", "7"))
+	assert.EqualValues(t, 5, dynInt.Get(), "values pushed while stopped must not be applied")
+	assert.Equal(t, "7", u.Values()["some_dynint"], "values pushed while stopped must be kept")
+}
@@ -0,0 +1,375 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package gitrepo provides an Updater that syncs FlagSet state with flag files committed to a git repository.
+
+package gitrepo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	defaultBranch       = "master"
+	defaultPollInterval = 30 * time.Second
+)
+
+func init() {
+	for _, transport := range []string{"https", "ssh", "file"} {
+		flagz.RegisterUpdater("git+"+transport, newFromURL)
+	}
+}
+
+// Minimum logger interface needed.
+// Default "log" and "logrus" should support these.
+type loggerCompatible interface {
+	Printf(format string, v ...interface{})
+}
+
+// Updater syncs flag values from files in a git repository into a given FlagSet.
+//
+// Each file in the configured directory of the repository is named after a flag and contains its value, the same
+// layout as used by the `configmap` package. The repository is cloned into a local checkout directory and polled for
+// new commits, on which only the files that changed between the applied and the new commit are re-applied.
+type Updater struct {
+	*flagz.UpdaterTracker
+	flagSet      *flag.FlagSet
+	logger       loggerCompatible
+	repoURL      string
+	checkoutDir  string
+	branch       string
+	subPath      string
+	pollInterval time.Duration
+	writers      flagz.WriterAllowlist
+
+	// lifecycle serializes the lifecycle transitions, see `flagz.UpdaterState`.
+	lifecycle sync.Mutex
+	cancel    context.CancelFunc
+	// done is closed when the polling go routine exits.
+	done chan struct{}
+
+	mu            sync.Mutex
+	appliedCommit string
+	trigger       chan struct{}
+}
+
+// New constructs a new Updater that will clone `repoURL` into `checkoutDir`.
+func New(flagSet *flag.FlagSet, repoURL string, checkoutDir string, logger loggerCompatible) (*Updater, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("flagz: git binary not available: %v", err)
+	}
+	return &Updater{
+		UpdaterTracker: flagz.NewUpdaterTracker(),
+		flagSet:        flagSet,
+		logger:         logger,
+		repoURL:        repoURL,
+		checkoutDir:    checkoutDir,
+		branch:         defaultBranch,
+		pollInterval:   defaultPollInterval,
+		trigger:        make(chan struct{}, 1),
+	}, nil
+}
+
+// WithBranch sets the branch of the repository that is tracked. Defaults to `master`.
+func (u *Updater) WithBranch(branch string) *Updater {
+	u.branch = branch
+	return u
+}
+
+// WithSubPath sets the directory, relative to the repository root, that holds the flag files of this service.
+func (u *Updater) WithSubPath(subPath string) *Updater {
+	u.subPath = strings.Trim(subPath, "/")
+	return u
+}
+
+// WithPollInterval sets how often the remote is checked for new commits. Defaults to 30s.
+func (u *Updater) WithPollInterval(interval time.Duration) *Updater {
+	u.pollInterval = interval
+	return u
+}
+
+// WithWriterAllowlist makes the Updater only apply flag files whose last commit was authored by writers allowed by
+// `writers`, identified by the author's email. Files of other authors are rejected and reported in the Status, and
+// the flags keep their current values.
+func (u *Updater) WithWriterAllowlist(writers flagz.WriterAllowlist) *Updater {
+	u.writers = writers
+	return u
+}
+
+// Initialize clones (or fetches) the repository and sets all flags (dynamic and static) from the flag files.
+func (u *Updater) Initialize() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.CheckTransition(flagz.UpdaterInitialized); err != nil {
+		return err
+	}
+	if err := u.ensureCheckout(); err != nil {
+		return fmt.Errorf("flagz: git updater initialization: %v", err)
+	}
+	commit, err := u.git("rev-parse", "HEAD")
+	if err != nil {
+		return fmt.Errorf("flagz: git updater initialization: %v", err)
+	}
+	if err := u.readAll(context.Background(), commit, false /* dynamicOnly */); err != nil {
+		return err
+	}
+	u.setAppliedCommit(commit)
+	return u.Transition(flagz.UpdaterInitialized)
+}
+
+// Start kicks off the go routine that polls the repository for new commits.
+// After a `Stop` it can be called again, to continue from the applied commit.
+func (u *Updater) Start() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.Transition(flagz.UpdaterWatching); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
+	u.done = make(chan struct{})
+	go u.pollForUpdates(ctx, u.done)
+	return nil
+}
+
+// Stop stops the auto-updating go-routine and waits for it to exit. Stopping an Updater that isn't polling is a no-op.
+func (u *Updater) Stop() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if u.State() != flagz.UpdaterWatching {
+		return nil
+	}
+	u.cancel()
+	<-u.done
+	return u.Transition(flagz.UpdaterStopped)
+}
+
+// AppliedCommit returns the SHA of the commit whose flag values are currently applied to the FlagSet.
+// It is empty until Initialize succeeds.
+func (u *Updater) AppliedCommit() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.appliedCommit
+}
+
+// Trigger asks the polling go-routine to check for new commits immediately, without waiting for the poll interval.
+func (u *Updater) Trigger() {
+	select {
+	case u.trigger <- struct{}{}:
+	default:
+		// a sync is already pending
+	}
+}
+
+// WebhookHandler is an `http.HandlerFunc` that can be registered as the push webhook of the git hosting service.
+// Any POST to it triggers an immediate sync.
+func (u *Updater) WebhookHandler(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		resp.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	u.Trigger()
+	resp.WriteHeader(http.StatusAccepted)
+}
+
+func (u *Updater) setAppliedCommit(commit string) {
+	u.mu.Lock()
+	u.appliedCommit = commit
+	u.mu.Unlock()
+	u.RecordRevision(commit)
+}
+
+func (u *Updater) pollForUpdates(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	u.logger.Printf("flagz: git poller started")
+	ticker := time.NewTicker(u.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-u.trigger:
+		case <-ctx.Done():
+			u.logger.Printf("flagz: git poller exited")
+			return
+		}
+		err := u.sync(ctx)
+		if err != nil {
+			u.logger.Printf("flagz: git sync failed: %v", err)
+		}
+		u.RecordSync(err)
+	}
+}
+
+// sync fetches the tracked branch and applies the flag files that changed since the applied commit.
+func (u *Updater) sync(ctx context.Context) error {
+	oldCommit := u.AppliedCommit()
+	if _, err := u.git("fetch", "--quiet", "origin", u.branch); err != nil {
+		return err
+	}
+	newCommit, err := u.git("rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return err
+	}
+	if newCommit == oldCommit {
+		return nil
+	}
+	diffArgs := []string{"diff", "--name-only", "--no-renames", oldCommit, newCommit}
+	if u.subPath != "" {
+		diffArgs = append(diffArgs, "--", u.subPath)
+	}
+	changed, err := u.git(diffArgs...)
+	if err != nil {
+		return err
+	}
+	if _, err := u.git("reset", "--quiet", "--hard", newCommit); err != nil {
+		return err
+	}
+	u.logger.Printf("flagz: applying git commit %v (was %v)", newCommit, oldCommit)
+	for _, file := range strings.Split(changed, "\n") {
+		if file == "" || path.Dir(file) != u.dirOrDot() {
+			// only direct children of subPath are flag files
+			continue
+		}
+		flagName := path.Base(file)
+		if _, err := os.Stat(path.Join(u.checkoutDir, file)); os.IsNotExist(err) {
+			u.logger.Printf("flagz: flag file %v was removed at commit %v, keeping current value", flagName, newCommit)
+			continue
+		}
+		if err := u.readFlagFile(ctx, file, newCommit, true); errors.Is(err, flagz.ErrFlagPinned) {
+			u.logger.Printf("flagz: holding update of pinned flag=%v at commit %v until it is unpinned", flagName, newCommit)
+		} else if err != nil {
+			u.logger.Printf("flagz: failed setting flag %s at commit %v: %v", flagName, newCommit, err.Error())
+			if !errors.Is(err, flagz.ErrFlagNotDynamic) && !errors.Is(err, flagz.ErrFlagNotFound) {
+				u.RecordUpdate(flagName, "", err)
+			}
+		} else {
+			u.logger.Printf("flagz: updated flag=%v at commit %v", flagName, newCommit)
+			f := u.flagSet.Lookup(flagName)
+			u.RecordUpdate(flagName, flagz.RedactFlagValue(f, f.Value.String()), nil)
+		}
+	}
+	u.setAppliedCommit(newCommit)
+	return nil
+}
+
+func (u *Updater) ensureCheckout() error {
+	if _, err := os.Stat(path.Join(u.checkoutDir, ".git")); err == nil {
+		if _, err := u.git("fetch", "--quiet", "origin", u.branch); err != nil {
+			return err
+		}
+		_, err := u.git("reset", "--quiet", "--hard", "FETCH_HEAD")
+		return err
+	}
+	cmd := exec.Command("git", "clone", "--quiet", "--branch", u.branch, "--single-branch", u.repoURL, u.checkoutDir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git clone failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (u *Updater) readAll(ctx context.Context, commit string, dynamicOnly bool) error {
+	files, err := ioutil.ReadDir(path.Join(u.checkoutDir, u.subPath))
+	if err != nil {
+		return fmt.Errorf("flagz: git updater initialization: %v", err)
+	}
+	errs := &flagz.FlagErrors{Source: "git repository"}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		if err := u.readFlagFile(ctx, path.Join(u.subPath, f.Name()), commit, dynamicOnly); err != nil {
+			if (errors.Is(err, flagz.ErrFlagNotDynamic) && dynamicOnly) || errors.Is(err, flagz.ErrFlagPinned) {
+				// ignore
+			} else {
+				errs.Add(f.Name(), err)
+			}
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// readFlagFile sets the flag named after `file`, relative to the repository root, from its content at `commit`.
+func (u *Updater) readFlagFile(ctx context.Context, file string, commit string, dynamicOnly bool) error {
+	flagName := path.Base(file)
+	flag := u.flagSet.Lookup(flagName)
+	if flag == nil {
+		return flagz.ErrFlagNotFound
+	}
+	if dynamicOnly && !flagz.IsFlagDynamic(flag) {
+		return flagz.ErrFlagNotDynamic
+	}
+	if u.writers != nil {
+		author, err := u.git("log", "-1", "--format=%ae", commit, "--", file)
+		if err != nil {
+			return err
+		}
+		if err := u.writers.CheckWriter(flagName, author); err != nil {
+			return err
+		}
+	}
+	content, err := ioutil.ReadFile(path.Join(u.checkoutDir, file))
+	if err != nil {
+		return err
+	}
+	// do not call flag.Value.Set, instead go through flagSet.Set (via SetFlagFromSource) to change "changed" state.
+	return flagz.SetFlagFromSourceCtx(ctx, u.flagSet, flagName, strings.TrimRight(string(content), "\n"), "git")
+}
+
+func (u *Updater) dirOrDot() string {
+	if u.subPath == "" {
+		return "."
+	}
+	return u.subPath
+}
+
+func (u *Updater) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = u.checkoutDir
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %v failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// newFromURL constructs an Updater from a `git+<transport>://` URL, e.g.
+// `git+https://github.com/org/flags.git?checkout_dir=/var/lib/flagz&branch=main&subpath=prod`. The `checkout_dir`
+// query parameter is required, `branch` and `subpath` are optional.
+func newFromURL(flagSet *flag.FlagSet, source *url.URL, logger flagz.Logger) (flagz.Updater, error) {
+	query := source.Query()
+	checkoutDir := query.Get("checkout_dir")
+	if checkoutDir == "" {
+		return nil, fmt.Errorf("flagz: git updater source needs a checkout_dir query parameter")
+	}
+	repoURL := *source
+	repoURL.Scheme = strings.TrimPrefix(source.Scheme, "git+")
+	repoURL.RawQuery = ""
+	u, err := New(flagSet, repoURL.String(), checkoutDir, logger)
+	if err != nil {
+		return nil, err
+	}
+	if branch := query.Get("branch"); branch != "" {
+		u.WithBranch(branch)
+	}
+	if subPath := query.Get("subpath"); subPath != "" {
+		u.WithSubPath(subPath)
+	}
+	return u, nil
+}
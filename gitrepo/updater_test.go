@@ -0,0 +1,197 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package gitrepo_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/gitrepo"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	flagsSubPath = "services/test"
+)
+
+type updaterTestSuite struct {
+	suite.Suite
+
+	tempDir   string
+	originDir string
+
+	flagSet   *flag.FlagSet
+	staticInt *int32
+	dynInt    *flagz.DynInt64Value
+
+	updater *gitrepo.Updater
+}
+
+func (s *updaterTestSuite) SetupTest() {
+	var err error
+	s.tempDir, err = ioutil.TempDir("", "gitrepo_test")
+	require.NoError(s.T(), err, "failed creating temp directory for testing")
+	s.originDir = path.Join(s.tempDir, "origin")
+	require.NoError(s.T(), os.MkdirAll(path.Join(s.originDir, flagsSubPath), 0755))
+	s.runGit("init", "--quiet")
+	s.runGit("checkout", "--quiet", "-b", "master")
+	s.commitFlags(map[string]string{"some_dynint": "10001\n", "some_int": "1234\n"})
+
+	s.flagSet = flag.NewFlagSet("updater_test", flag.ContinueOnError)
+	s.dynInt = flagz.DynInt64(s.flagSet, "some_dynint", 1, "dynamic int for testing")
+	s.staticInt = s.flagSet.Int32("some_int", 1, "static int for testing")
+
+	s.updater, err = gitrepo.New(s.flagSet, s.originDir, path.Join(s.tempDir, "checkout"), &testingLog{T: s.T()})
+	require.NoError(s.T(), err, "creating a git updater must not fail")
+	s.updater.WithSubPath(flagsSubPath).WithPollInterval(10 * time.Second)
+}
+
+func (s *updaterTestSuite) TearDownTest() {
+	s.updater.Stop()
+	require.NoError(s.T(), os.RemoveAll(s.tempDir), "clearing up the test dir must not fail")
+}
+
+func (s *updaterTestSuite) runGit(args ...string) string {
+	return s.runGitAs("test@example.com", args...)
+}
+
+func (s *updaterTestSuite) runGitAs(email string, args ...string) string {
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=" + email}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = s.originDir
+	out, err := cmd.CombinedOutput()
+	require.NoError(s.T(), err, "git %v must not fail: %s", args, out)
+	return string(out)
+}
+
+func (s *updaterTestSuite) commitFlags(files map[string]string) string {
+	return s.commitFlagsAs("test@example.com", files)
+}
+
+func (s *updaterTestSuite) commitFlagsAs(email string, files map[string]string) string {
+	for name, content := range files {
+		err := ioutil.WriteFile(path.Join(s.originDir, flagsSubPath, name), []byte(content), 0644)
+		require.NoError(s.T(), err, "writing flag file must not fail")
+	}
+	s.runGit("add", "--all")
+	s.runGitAs(email, "commit", "--quiet", "-m", "flag change")
+	return s.runGit("rev-parse", "HEAD")
+}
+
+func (s *updaterTestSuite) TestInitializeSetsValues() {
+	require.NoError(s.T(), s.updater.Initialize(), "the updater initialize should not return errors on good flags")
+	assert.EqualValues(s.T(), 1234, *s.staticInt, "staticInt should be set from the repo")
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "dynInt should be set from the repo")
+	assert.Len(s.T(), s.updater.AppliedCommit(), 40, "applied commit must be a full SHA")
+}
+
+func (s *updaterTestSuite) TestInitializeFailsOnBadFormedFlag() {
+	s.commitFlags(map[string]string{"some_int": "not_an_int"})
+	require.Error(s.T(), s.updater.Initialize(), "the updater initialize should return error on bad flags")
+}
+
+func (s *updaterTestSuite) TestDynamicUpdatesPropagateOnTrigger() {
+	require.NoError(s.T(), s.updater.Initialize())
+	require.NoError(s.T(), s.updater.Start())
+	newCommit := s.commitFlags(map[string]string{"some_dynint": "20002\n", "some_int": "4321\n"})
+	s.updater.Trigger()
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, 20002,
+		func() interface{} { return s.dynInt.Get() },
+		"some_dynint value should change to the value from the new commit")
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, newCommit[:40],
+		func() interface{} { return s.updater.AppliedCommit() },
+		"applied commit should move to the new commit")
+	assert.EqualValues(s.T(), 1234, *s.staticInt, "static flags must not be updated dynamically")
+}
+
+func (s *updaterTestSuite) TestRejectsFilesOfUnknownWriters() {
+	s.updater.WithWriterAllowlist(flagz.WriterAllowlist{
+		"some_dynint":   {"test@example.com", "ops@example.com"},
+		flagz.AnyWriter: {"test@example.com"},
+	})
+	require.NoError(s.T(), s.updater.Initialize())
+	require.NoError(s.T(), s.updater.Start())
+
+	s.commitFlagsAs("mallory@example.com", map[string]string{"some_dynint": "20002\n"})
+	s.updater.Trigger()
+	event := <-s.updater.Events()
+	var notAllowed *flagz.WriterNotAllowedError
+	require.True(s.T(), errors.As(event.Err, &notAllowed), "changes of unknown writers must be reported")
+	assert.Equal(s.T(), "mallory@example.com", notAllowed.Writer)
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "changes of unknown writers must not be applied")
+
+	s.commitFlagsAs("ops@example.com", map[string]string{"some_dynint": "30003\n"})
+	s.updater.Trigger()
+	event = <-s.updater.Events()
+	assert.NoError(s.T(), event.Err)
+	assert.EqualValues(s.T(), 30003, s.dynInt.Get(), "changes of allowed writers must be applied")
+}
+
+func (s *updaterTestSuite) TestInitializeRejectsFilesOfUnknownWriters() {
+	s.updater.WithWriterAllowlist(flagz.WriterAllowlist{"some_int": {"ops@example.com"}})
+	err := s.updater.Initialize()
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "some_int")
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "files of flags without an entry must be applied")
+	assert.EqualValues(s.T(), 1, *s.staticInt, "files of unknown writers must not be applied")
+}
+
+func (s *updaterTestSuite) TestStopIsIdempotentAndPollingRestarts() {
+	require.NoError(s.T(), s.updater.Initialize())
+	require.NoError(s.T(), s.updater.Stop(), "stopping before starting must be a no-op")
+	require.NoError(s.T(), s.updater.Start())
+	assert.Error(s.T(), s.updater.Start(), "starting twice must fail")
+	require.NoError(s.T(), s.updater.Stop())
+	require.NoError(s.T(), s.updater.Stop(), "stopping twice must be a no-op")
+	assert.False(s.T(), s.updater.Status().Running)
+
+	require.NoError(s.T(), s.updater.Start(), "a stopped updater must be restartable")
+	s.commitFlags(map[string]string{"some_dynint": "20002\n"})
+	s.updater.Trigger()
+	<-s.updater.Events()
+	assert.EqualValues(s.T(), 20002, s.dynInt.Get(), "a restarted updater must apply updates")
+}
+
+func TestUpdaterSuite(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("git binary not available: %v", err)
+	}
+	suite.Run(t, &updaterTestSuite{})
+}
+
+type assertFunc func(expected, actual interface{}) bool
+type getter func() interface{}
+
+// eventually tries a given Assert function 5 times over the period of time.
+func eventually(t *testing.T, duration time.Duration,
+	af assertFunc, expected interface{}, actual getter, msgFmt string, msgArgs ...interface{}) {
+	increment := duration / 5
+	for i := 0; i < 5; i++ {
+		time.Sleep(increment)
+		if af(expected, actual()) {
+			return
+		}
+	}
+	t.Fatalf(msgFmt, msgArgs...)
+}
+
+// Abstraction that allows us to pass the *testing.T as a logger to the updater.
+type testingLog struct {
+	T *testing.T
+}
+
+func (tl *testingLog) Printf(format string, v ...interface{}) {
+	tl.T.Logf(format+"\n", v...)
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"bytes"
+	"sort"
+
+	flag "github.com/spf13/pflag"
+)
+
+// GroupAnnotation is the pflag annotation holding the usage group of a flag, see `SetFlagGroup`.
+const GroupAnnotation = "group"
+
+// SetFlagGroup puts the flag in usage `group`, e.g. "Cache", under which `FlagUsagesByGroup` lists it. The group is a
+// plain pflag annotation, so it also shows up as a tag of the flag on the status endpoint.
+func SetFlagGroup(f *flag.Flag, group string) {
+	if f.Annotations == nil {
+		f.Annotations = make(map[string][]string)
+	}
+	f.Annotations[GroupAnnotation] = []string{group}
+}
+
+// FlagGroup returns the usage group of the flag set with `SetFlagGroup`, or an empty string if it has none.
+func FlagGroup(f *flag.Flag) string {
+	if group := f.Annotations[GroupAnnotation]; len(group) > 0 {
+		return group[0]
+	}
+	return ""
+}
+
+// FlagUsagesByGroup returns the usages of the flags of `flagSet` like `FlagSet.FlagUsages`, in sections per usage
+// group in the order of their names, headed by the group name. Flags without a group come first, without a heading.
+// Use it in the `Usage` of the FlagSet so that dynamic flags are listed next to the static flags of their group.
+func FlagUsagesByGroup(flagSet *flag.FlagSet) string {
+	groups := make(map[string]*flag.FlagSet)
+	flagSet.VisitAll(func(f *flag.Flag) {
+		group := FlagGroup(f)
+		if _, ok := groups[group]; !ok {
+			groups[group] = flag.NewFlagSet(group, flag.ContinueOnError)
+		}
+		groups[group].AddFlag(f)
+	})
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := &bytes.Buffer{}
+	for _, name := range names {
+		usages := groups[name].FlagUsages()
+		if usages == "" {
+			// all flags of the group are hidden.
+			continue
+		}
+		if name != "" {
+			if buf.Len() > 0 {
+				buf.WriteString("\n")
+			}
+			buf.WriteString(name + ":\n")
+		}
+		buf.WriteString(usages)
+	}
+	return buf.String()
+}
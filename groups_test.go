@@ -0,0 +1,48 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynConstructors_AcceptShorthands(t *testing.T) {
+	set := flag.NewFlagSet("shorthand", flag.ContinueOnError)
+	verbose := flagz.DynBoolP(set, "verbose", "v", false, "verbose logging")
+	workers := flagz.DynInt64P(set, "workers", "w", 1, "number of workers")
+	require.NoError(t, set.Parse([]string{"-v", "-w", "4"}))
+	assert.True(t, verbose.Get())
+	assert.EqualValues(t, 4, workers.Get())
+	assert.True(t, flagz.IsFlagDynamic(set.ShorthandLookup("w")), "shorthand variants must be dynamic")
+	assert.Contains(t, set.FlagUsages(), "-w, --workers")
+}
+
+func TestFlagUsagesByGroup(t *testing.T) {
+	set := flag.NewFlagSet("groups", flag.ContinueOnError)
+	flagz.DynDuration(set, "cache_ttl", 0, "TTL of cache entries")
+	set.Int("cache_size", 10, "size of the cache")
+	flagz.DynString(set, "log_level", "info", "log level")
+	set.Int("port", 8080, "port to listen on")
+	flagz.SetFlagGroup(set.Lookup("cache_ttl"), "Cache")
+	flagz.SetFlagGroup(set.Lookup("cache_size"), "Cache")
+	flagz.SetFlagGroup(set.Lookup("log_level"), "Logging")
+	assert.Equal(t, "Cache", flagz.FlagGroup(set.Lookup("cache_ttl")))
+	assert.Equal(t, "", flagz.FlagGroup(set.Lookup("port")))
+
+	usages := flagz.FlagUsagesByGroup(set)
+	port := strings.Index(usages, "--port")
+	cache := strings.Index(usages, "Cache:\n")
+	cacheTTL := strings.Index(usages, "--cache_ttl")
+	logging := strings.Index(usages, "Logging:\n")
+	logLevel := strings.Index(usages, "--log_level")
+	assert.True(t, port >= 0 && port < cache, "ungrouped flags must come first:\n%s", usages)
+	assert.True(t, cache < cacheTTL && cacheTTL < logging && logging < logLevel, "groups must be in order:\n%s", usages)
+	assert.Contains(t, usages, "--cache_size")
+}
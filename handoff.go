@@ -0,0 +1,134 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// HandoffSource is the source recorded by `AdoptHandoff` for the values it sets, see `FlagSource`.
+	HandoffSource = "handoff"
+	// HandoffEnv is the environment variable passing the state handed off by `WriteHandoffFile` to the new process,
+	// read by `AdoptHandoffFromEnv`: either the path of the file, or `fd:<number>` for an inherited file descriptor.
+	HandoffEnv = "FLAGZ_HANDOFF"
+
+	handoffVersion = 1
+)
+
+type handoffJSON struct {
+	Version int               `json:"version"`
+	Time    time.Time         `json:"time"`
+	Flags   []handoffFlagJSON `json:"flags"`
+}
+
+type handoffFlagJSON struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Source is where the value came from in the old process, see `SetFlagFromSource`.
+	Source string `json:"source"`
+}
+
+// WriteHandoff writes the state of the dynamic flags of `flagSet` to `writer` on shutdown of a process being replaced
+// by a new binary, which adopts it with `AdoptHandoff` before its Updaters finish `Initialize`, so that graceful
+// restarts don't briefly run with stale defaults.
+//
+// Only the values set through `SetFlagFromSource` (by Updaters, the flagz endpoints, etc.) are handed off, so that the
+// defaults and command line of the new binary still apply to the other flags. Values of flags marked as secret aren't
+// handed off, and come from the Updaters of the new process.
+func WriteHandoff(flagSet *flag.FlagSet, writer io.Writer) error {
+	state := &handoffJSON{Version: handoffVersion, Time: time.Now(), Flags: []handoffFlagJSON{}}
+	for _, f := range DynamicFlags(flagSet) {
+		source := FlagSource(f)
+		if source == "" || IsFlagSecret(f) {
+			continue
+		}
+		state.Flags = append(state.Flags, handoffFlagJSON{Name: f.Name, Value: f.Value.String(), Source: source})
+	}
+	if err := json.NewEncoder(writer).Encode(state); err != nil {
+		return fmt.Errorf("flagz: writing handoff: %v", err)
+	}
+	return nil
+}
+
+// WriteHandoffFile writes the state of the dynamic flags of `flagSet` to a new temporary file, see `WriteHandoff`,
+// and returns its path, to be passed to the new process in the HandoffEnv environment variable.
+func WriteHandoffFile(flagSet *flag.FlagSet) (string, error) {
+	file, err := ioutil.TempFile("", "flagz-handoff-")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if err := WriteHandoff(flagSet, file); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// AdoptHandoff sets the dynamic flags of `flagSet` to the state written by `WriteHandoff` in the old process, to be
+// called before the Updaters of the new process are initialized, which then apply their more recent values.
+//
+// All values are applied, even if some fail; their failures (including values of flags that are unknown or static in
+// the new binary) are returned as a `*FlagErrors`.
+func AdoptHandoff(flagSet *flag.FlagSet, reader io.Reader) error {
+	state := &handoffJSON{}
+	if err := json.NewDecoder(reader).Decode(state); err != nil {
+		return fmt.Errorf("flagz: decoding handoff: %v", err)
+	}
+	if state.Version != handoffVersion {
+		return fmt.Errorf("flagz: unsupported handoff version %d", state.Version)
+	}
+	errs := &FlagErrors{Source: HandoffSource}
+	for _, hf := range state.Flags {
+		f := flagSet.Lookup(hf.Name)
+		if f == nil {
+			errs.Add(hf.Name, ErrFlagNotFound)
+			continue
+		}
+		if !IsFlagDynamic(f) {
+			errs.Add(hf.Name, ErrFlagNotDynamic)
+			continue
+		}
+		if err := SetFlagFromSource(flagSet, hf.Name, hf.Value, HandoffSource); err != nil {
+			errs.Add(hf.Name, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// AdoptHandoffFromEnv adopts the state handed off in the file or file descriptor of the HandoffEnv environment
+// variable, see `AdoptHandoff`, and removes the file. It does nothing if the variable isn't set, e.g. on a cold start.
+func AdoptHandoffFromEnv(flagSet *flag.FlagSet) error {
+	location := os.Getenv(HandoffEnv)
+	if location == "" {
+		return nil
+	}
+	var file *os.File
+	if strings.HasPrefix(location, "fd:") {
+		fd, err := strconv.Atoi(strings.TrimPrefix(location, "fd:"))
+		if err != nil || fd < 0 {
+			return fmt.Errorf("flagz: bad handoff file descriptor %q", location)
+		}
+		file = os.NewFile(uintptr(fd), "flagz-handoff")
+	} else {
+		opened, err := os.Open(location)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(location)
+		file = opened
+	}
+	defer file.Close()
+	return AdoptHandoff(flagSet, file)
+}
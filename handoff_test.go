@@ -0,0 +1,81 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func handoffFlagSet() (*flag.FlagSet, *flagz.DynInt64Value, *flagz.DynStringValue, *flagz.DynSecretValue) {
+	set := flag.NewFlagSet("handoff", flag.ContinueOnError)
+	someInt := flagz.DynInt64(set, "some_int", 1, "Some int")
+	someString := flagz.DynString(set, "some_string", "foo", "Some string")
+	secret := flagz.DynSecret(set, "some_secret", "hunter2", "Some secret")
+	return set, someInt, someString, secret
+}
+
+func TestHandoff_AdoptsValuesOfSources(t *testing.T) {
+	oldSet, _, _, _ := handoffFlagSet()
+	require.NoError(t, flagz.SetFlagFromSource(oldSet, "some_int", "2", "etcd"))
+	require.NoError(t, oldSet.Set("some_string", "bar"))
+	require.NoError(t, flagz.SetFlagFromSource(oldSet, "some_secret", "swordfish", "etcd"))
+	state := &bytes.Buffer{}
+	require.NoError(t, flagz.WriteHandoff(oldSet, state))
+	assert.NotContains(t, state.String(), "swordfish", "secrets must not be handed off")
+
+	newSet, someInt, someString, secret := handoffFlagSet()
+	require.NoError(t, flagz.AdoptHandoff(newSet, state))
+	assert.Equal(t, int64(2), someInt.Get(), "values of sources must be adopted")
+	assert.Equal(t, flagz.HandoffSource, flagz.FlagSource(newSet.Lookup("some_int")))
+	assert.Equal(t, "foo", someString.Get(), "values set in other ways must not be handed off")
+	assert.Equal(t, "hunter2", secret.Get())
+}
+
+func TestHandoff_ReportsFlagsMissingInTheNewBinary(t *testing.T) {
+	oldSet, _, _, _ := handoffFlagSet()
+	flagz.DynBool(oldSet, "removed_bool", false, "Removed in the new binary")
+	require.NoError(t, flagz.SetFlagFromSource(oldSet, "removed_bool", "true", "etcd"))
+	require.NoError(t, flagz.SetFlagFromSource(oldSet, "some_int", "2", "etcd"))
+	state := &bytes.Buffer{}
+	require.NoError(t, flagz.WriteHandoff(oldSet, state))
+
+	newSet, someInt, _, _ := handoffFlagSet()
+	err := flagz.AdoptHandoff(newSet, state)
+	require.Error(t, err)
+	errs, ok := err.(*flagz.FlagErrors)
+	require.True(t, ok, "failures must be returned as FlagErrors")
+	require.Len(t, errs.Errors, 1)
+	assert.Equal(t, "removed_bool", errs.Errors[0].Flag)
+	assert.Equal(t, int64(2), someInt.Get(), "the other values must still be adopted")
+
+	assert.Error(t, flagz.AdoptHandoff(newSet, bytes.NewBufferString(`{"version": 42}`)), "unknown versions must fail")
+}
+
+func TestAdoptHandoffFromEnv(t *testing.T) {
+	newSet, someInt, _, _ := handoffFlagSet()
+	os.Unsetenv(flagz.HandoffEnv)
+	assert.NoError(t, flagz.AdoptHandoffFromEnv(newSet), "cold starts must adopt nothing")
+
+	oldSet, _, _, _ := handoffFlagSet()
+	require.NoError(t, flagz.SetFlagFromSource(oldSet, "some_int", "2", "etcd"))
+	path, err := flagz.WriteHandoffFile(oldSet)
+	require.NoError(t, err)
+	defer os.Remove(path)
+	os.Setenv(flagz.HandoffEnv, path)
+	defer os.Unsetenv(flagz.HandoffEnv)
+	require.NoError(t, flagz.AdoptHandoffFromEnv(newSet))
+	assert.Equal(t, int64(2), someInt.Get())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "the handoff file must be removed once adopted")
+
+	os.Setenv(flagz.HandoffEnv, "fd:notanumber")
+	assert.Error(t, flagz.AdoptHandoffFromEnv(newSet))
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultMaxConsecutiveErrors = 5
+)
+
+// UpdaterHealth judges whether an Updater is keeping the flags in sync with their source, for use in health checks
+// of orchestration systems, so that instances whose flag sync is broken for too long get restarted.
+type UpdaterHealth struct {
+	updater              Updater
+	maxConsecutiveErrors int
+	maxSyncAge           time.Duration
+}
+
+// NewUpdaterHealth creates a health check for `updater`.
+func NewUpdaterHealth(updater Updater) *UpdaterHealth {
+	return &UpdaterHealth{updater: updater, maxConsecutiveErrors: defaultMaxConsecutiveErrors}
+}
+
+// WithMaxConsecutiveErrors sets after how many consecutive failed syncs the Updater is unhealthy. Defaults to 5, zero
+// disables the condition.
+func (h *UpdaterHealth) WithMaxConsecutiveErrors(count int) *UpdaterHealth {
+	h.maxConsecutiveErrors = count
+	return h
+}
+
+// WithMaxSyncAge makes the Updater unhealthy if it hasn't successfully synced for longer than `age`. Disabled by
+// default, as watch-based Updaters (e.g. etcd) only sync when something changes. For polling Updaters a few poll
+// intervals is a sensible value.
+func (h *UpdaterHealth) WithMaxSyncAge(age time.Duration) *UpdaterHealth {
+	h.maxSyncAge = age
+	return h
+}
+
+// Check returns nil if the Updater is healthy, or an error describing why it isn't. The signature fits the checker
+// functions of common `healthz` libraries.
+func (h *UpdaterHealth) Check() error {
+	status := h.updater.Status()
+	if !status.Initialized {
+		return fmt.Errorf("flagz: updater not initialized")
+	}
+	if !status.Running {
+		return fmt.Errorf("flagz: updater not running")
+	}
+	if h.maxConsecutiveErrors > 0 && status.ConsecutiveErrors >= h.maxConsecutiveErrors {
+		return fmt.Errorf("flagz: updater failed %d consecutive syncs, last error: %v", status.ConsecutiveErrors, status.LastError)
+	}
+	if h.maxSyncAge > 0 && time.Since(status.LastSync) > h.maxSyncAge {
+		return fmt.Errorf("flagz: updater hasn't synced since %v", status.LastSync.Format(time.RFC3339))
+	}
+	return nil
+}
+
+type updaterHealthJSON struct {
+	Healthy           bool   `json:"healthy"`
+	Reason            string `json:"reason,omitempty"`
+	State             string `json:"state"`
+	Initialized       bool   `json:"initialized"`
+	Running           bool   `json:"running"`
+	Revision          string `json:"revision,omitempty"`
+	LastSync          string `json:"last_sync,omitempty"`
+	LastUpdate        string `json:"last_update,omitempty"`
+	LastError         string `json:"last_error,omitempty"`
+	ConsecutiveErrors int    `json:"consecutive_errors"`
+}
+
+// ServeHTTP implements `http.Handler`, responding with the Updater's status as JSON and a 200 status code if it is
+// healthy or 503 if it isn't.
+func (h *UpdaterHealth) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	status := h.updater.Status()
+	out := &updaterHealthJSON{
+		Healthy:           true,
+		State:             status.State.String(),
+		Initialized:       status.Initialized,
+		Running:           status.Running,
+		Revision:          status.Revision,
+		ConsecutiveErrors: status.ConsecutiveErrors,
+	}
+	if err := h.Check(); err != nil {
+		out.Healthy = false
+		out.Reason = err.Error()
+	}
+	if !status.LastSync.IsZero() {
+		out.LastSync = status.LastSync.Format(time.RFC3339)
+	}
+	if !status.LastUpdate.IsZero() {
+		out.LastUpdate = status.LastUpdate.Format(time.RFC3339)
+	}
+	if status.LastError != nil {
+		out.LastError = status.LastError.Error()
+	}
+	body, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		resp.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Add("Content-Type", "application/json")
+	if out.Healthy {
+		resp.WriteHeader(http.StatusOK)
+	} else {
+		resp.WriteHeader(http.StatusServiceUnavailable)
+	}
+	resp.Write(body)
+}
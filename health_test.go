@@ -0,0 +1,54 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdaterHealth_Check(t *testing.T) {
+	u := &fakeUpdater{UpdaterTracker: flagz.NewUpdaterTracker()}
+	health := flagz.NewUpdaterHealth(u).WithMaxConsecutiveErrors(2)
+	assert.Error(t, health.Check(), "uninitialized updaters must be unhealthy")
+	u.MarkInitialized()
+	assert.Error(t, health.Check(), "stopped updaters must be unhealthy")
+	u.MarkRunning(true)
+	assert.NoError(t, health.Check())
+
+	u.RecordSync(fmt.Errorf("etcd unavailable"))
+	assert.NoError(t, health.Check(), "a single failed sync must be tolerated")
+	u.RecordSync(fmt.Errorf("etcd unavailable"))
+	assert.Error(t, health.Check(), "too many consecutive failed syncs must be unhealthy")
+	u.RecordSync(nil)
+	assert.NoError(t, health.Check(), "a successful sync must reset the error count")
+
+	health.WithMaxSyncAge(10 * time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Error(t, health.Check(), "stale updaters must be unhealthy")
+}
+
+func TestUpdaterHealth_ServeHTTP(t *testing.T) {
+	u := &fakeUpdater{UpdaterTracker: flagz.NewUpdaterTracker()}
+	health := flagz.NewUpdaterHealth(u)
+	resp := httptest.NewRecorder()
+	health.ServeHTTP(resp, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code, "unhealthy updaters must fail the health check")
+
+	u.MarkInitialized()
+	u.MarkRunning(true)
+	u.RecordRevision("rev1")
+	resp = httptest.NewRecorder()
+	health.ServeHTTP(resp, nil)
+	require.Equal(t, http.StatusOK, resp.Code, "healthy updaters must pass the health check")
+	assert.Contains(t, resp.Body.String(), `"revision": "rev1"`)
+	assert.Contains(t, resp.Body.String(), `"state": "watching"`)
+}
@@ -5,6 +5,9 @@ package monitoring
 
 import (
 	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mwitkow/go-flagz"
 	"github.com/prometheus/client_golang/prometheus"
@@ -63,3 +66,108 @@ func (cc *flagSetCollector) Collect(c chan<- prometheus.Metric) {
 		hex.EncodeToString(checksum),
 	)
 }
+
+type updaterCollector struct {
+	updater    flagz.Updater
+	updates    *prometheus.Desc
+	errors     *prometheus.Desc
+	lastUpdate *prometheus.Desc
+}
+
+// NewUpdaterCollector returns a Prometheus collector exporting `flagz_updates_total` and `flagz_update_errors_total`
+// counters of an Updater, together with the `flagz_last_update_timestamp_seconds` of its last applied update.
+// Comparing these across instances allows alerting on stalled rollouts.
+func NewUpdaterCollector(name string, updater flagz.Updater) prometheus.Collector {
+	labels := prometheus.Labels{"updater": name}
+	return &updaterCollector{
+		updater: updater,
+		updates: prometheus.NewDesc(
+			"flagz_updates_total",
+			"Number of dynamic flag updates applied by the flagz Updater.",
+			nil, labels,
+		),
+		errors: prometheus.NewDesc(
+			"flagz_update_errors_total",
+			"Number of dynamic flag updates rejected by the flagz Updater.",
+			nil, labels,
+		),
+		lastUpdate: prometheus.NewDesc(
+			"flagz_last_update_timestamp_seconds",
+			"Unix time of the last dynamic flag update applied by the flagz Updater, 0 if there was none.",
+			nil, labels,
+		),
+	}
+}
+
+func (uc *updaterCollector) Describe(c chan<- *prometheus.Desc) {
+	c <- uc.updates
+	c <- uc.errors
+	c <- uc.lastUpdate
+}
+
+func (uc *updaterCollector) Collect(c chan<- prometheus.Metric) {
+	status := uc.updater.Status()
+	lastUpdate := 0.0
+	if !status.LastUpdate.IsZero() {
+		lastUpdate = float64(status.LastUpdate.UnixNano()) / 1e9
+	}
+	c <- prometheus.MustNewConstMetric(uc.updates, prometheus.CounterValue, float64(status.Updates))
+	c <- prometheus.MustNewConstMetric(uc.errors, prometheus.CounterValue, float64(status.UpdateErrors))
+	c <- prometheus.MustNewConstMetric(uc.lastUpdate, prometheus.GaugeValue, lastUpdate)
+}
+
+type flagValueCollector struct {
+	desc      *prometheus.Desc
+	flagSet   *flag.FlagSet
+	flagNames []string
+}
+
+// NewFlagValueCollector returns a Prometheus collector exporting the current values of the selected flags as
+// `flagz_value` gauges. Numeric and boolean flags are exported as-is, durations in seconds. Flags that don't exist or
+// hold a non-numeric value are skipped, and so are flags marked with `flagz.MarkFlagSecret`.
+func NewFlagValueCollector(name string, flagSet *flag.FlagSet, flagNames ...string) prometheus.Collector {
+	return &flagValueCollector{
+		desc: prometheus.NewDesc(
+			"flagz_value",
+			"The current numeric value of a flag in the provided flagz FlagSet.",
+			[]string{"flag"},
+			prometheus.Labels{"set": name},
+		),
+		flagSet:   flagSet,
+		flagNames: flagNames,
+	}
+}
+
+func (fc *flagValueCollector) Describe(c chan<- *prometheus.Desc) {
+	c <- fc.desc
+}
+
+func (fc *flagValueCollector) Collect(c chan<- prometheus.Metric) {
+	for _, name := range fc.flagNames {
+		f := fc.flagSet.Lookup(name)
+		if f == nil || flagz.IsFlagSecret(f) {
+			continue
+		}
+		value, ok := numericValue(f)
+		if !ok {
+			continue
+		}
+		c <- prometheus.MustNewConstMetric(fc.desc, prometheus.GaugeValue, value, name)
+	}
+}
+
+func numericValue(f *flag.Flag) (float64, bool) {
+	str := f.Value.String()
+	if strings.Contains(f.Value.Type(), "duration") {
+		d, err := time.ParseDuration(str)
+		return d.Seconds(), err == nil
+	}
+	if b, err := strconv.ParseBool(str); err == nil && strings.Contains(f.Value.Type(), "bool") {
+		if b {
+			return 1, true
+		}
+		return 0, true
+	}
+	v, err := strconv.ParseFloat(str, 64)
+	return v, err == nil
+}
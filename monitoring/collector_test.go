@@ -70,6 +70,33 @@ func (s *monitoringTestSuite) TestChangesOnDynamic() {
 	require.Contains(s.T(), equalLines[0], "static")
 }
 
+func (s *monitoringTestSuite) TestExportsUpdaterCounters() {
+	updater := &fakeUpdater{UpdaterTracker: flagz.NewUpdaterTracker()}
+	prometheus.MustRegister(monitoring.NewUpdaterCollector(s.setName, updater))
+	updater.RecordUpdate("some_dyn_int", "1", nil)
+	updater.RecordUpdate("some_dyn_int", "2", nil)
+	updater.RecordUpdate("some_dyn_int", "bad", fmt.Errorf("bad value"))
+
+	out := strings.Join(s.fetchPrometheusLines(s.setName), "")
+	require.Contains(s.T(), out, `flagz_updates_total{updater="`+s.setName+`"} 2`)
+	require.Contains(s.T(), out, `flagz_update_errors_total{updater="`+s.setName+`"} 1`)
+	require.Contains(s.T(), out, `flagz_last_update_timestamp_seconds{updater="`+s.setName+`"}`)
+}
+
+func (s *monitoringTestSuite) TestExportsNumericFlagValues() {
+	flagz.DynInt64(s.flagSet, "some_dyn_secret_int", 4242, "Something secret")
+	flagz.MarkFlagSecret(s.flagSet.Lookup("some_dyn_secret_int"))
+	prometheus.MustRegister(monitoring.NewFlagValueCollector(s.setName, s.flagSet, "some_dyn_int", "some_static_float",
+		"some_dyn_string", "some_dyn_secret_int", "no_such_flag"))
+	s.flagSet.Set("some_dyn_int", "707070")
+
+	out := strings.Join(s.fetchPrometheusLines(s.setName), "")
+	require.Contains(s.T(), out, `flagz_value{flag="some_dyn_int",set="`+s.setName+`"} 707070`)
+	require.Contains(s.T(), out, `flagz_value{flag="some_static_float",set="`+s.setName+`"} 3.14`)
+	require.NotContains(s.T(), out, "some_dyn_string", "non-numeric flags must be skipped")
+	require.NotContains(s.T(), out, "some_dyn_secret_int", "secret flags must be skipped")
+}
+
 func (s *monitoringTestSuite) fetchPrometheusLines(setName string) []string {
 	resp := httptest.NewRecorder()
 	req, err := http.NewRequest("GET", "/", nil)
@@ -102,3 +129,11 @@ func findEqualStrings(set1 []string, set2 []string) []string {
 	}
 	return ret
 }
+
+type fakeUpdater struct {
+	*flagz.UpdaterTracker
+}
+
+func (f *fakeUpdater) Initialize() error { return nil }
+func (f *fakeUpdater) Start() error      { return nil }
+func (f *fakeUpdater) Stop() error       { return nil }
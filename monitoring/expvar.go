@@ -0,0 +1,31 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package monitoring
+
+import (
+	"expvar"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+)
+
+// PublishExpvar publishes the current values of all dynamic flags of the FlagSet as an `expvar` map under `name`, so
+// they're served on `/debug/vars`. Values of flags marked with `flagz.MarkFlagSecret` are redacted.
+// Values are read on every access, and like `expvar.Publish` this code panics if `name` is already published.
+func PublishExpvar(name string, flagSet *flag.FlagSet) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return dynamicFlagValues(flagSet)
+	}))
+}
+
+func dynamicFlagValues(flagSet *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	flagSet.VisitAll(func(f *flag.Flag) {
+		if !flagz.IsFlagDynamic(f) {
+			return
+		}
+		values[f.Name] = flagz.RedactFlagValue(f, f.Value.String())
+	})
+	return values
+}
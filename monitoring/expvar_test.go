@@ -0,0 +1,33 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package monitoring_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/monitoring"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishExpvar_PublishesDynamicFlags(t *testing.T) {
+	set := flag.NewFlagSet("expvar_test", flag.ContinueOnError)
+	set.String("some_static_string", "trolololo", "Some static string text")
+	flagz.DynInt64(set, "some_dyn_int", 1337, "Something dynamic")
+	flagz.DynString(set, "some_dyn_password", "hunter2", "Something secret")
+	flagz.MarkFlagSecret(set.Lookup("some_dyn_password"))
+	monitoring.PublishExpvar("flagz_expvar_test", set)
+
+	set.Set("some_dyn_int", "707070")
+	values := map[string]string{}
+	require.NoError(t, json.Unmarshal([]byte(expvar.Get("flagz_expvar_test").String()), &values))
+	assert.Equal(t, map[string]string{
+		"some_dyn_int":      "707070",
+		"some_dyn_password": flagz.RedactedValue,
+	}, values, "only dynamic flags must be published, with secrets redacted")
+}
@@ -0,0 +1,127 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// NamespaceSeparator separates the namespaces in flag names, e.g. `cache.ttl`. Updaters of hierarchical backends map
+// nested directories onto it, e.g. the etcd key `cache/ttl` onto the flag `cache.ttl`, see `KeyPathToFlagName`.
+const NamespaceSeparator = "."
+
+// FlagNamespace registers flags under a common prefix of their names, so that modules name their flags consistently
+// without repeating the prefix. See `Namespace`.
+type FlagNamespace struct {
+	flagSet *flag.FlagSet
+	prefix  string
+}
+
+// Namespace returns a FlagNamespace registering flags of `flagSet` under `prefix`, e.g. "cache.", so that
+// `Namespace(flagSet, "cache.").DynDuration("ttl", ...)` registers the flag `cache.ttl`. A missing trailing
+// NamespaceSeparator is added.
+func Namespace(flagSet *flag.FlagSet, prefix string) *FlagNamespace {
+	if prefix != "" && !strings.HasSuffix(prefix, NamespaceSeparator) {
+		prefix += NamespaceSeparator
+	}
+	return &FlagNamespace{flagSet: flagSet, prefix: prefix}
+}
+
+// Namespace returns a FlagNamespace nested in this one, e.g. `cache.l1.` for "l1." in `cache.`.
+func (n *FlagNamespace) Namespace(prefix string) *FlagNamespace {
+	return Namespace(n.flagSet, n.prefix+prefix)
+}
+
+// Prefix returns the prefix of the names of flags in the namespace, ending with NamespaceSeparator.
+func (n *FlagNamespace) Prefix() string {
+	return n.prefix
+}
+
+// FlagSet returns the FlagSet the flags of the namespace are registered in.
+func (n *FlagNamespace) FlagSet() *flag.FlagSet {
+	return n.flagSet
+}
+
+// Name returns the full name of flag `name` of the namespace, e.g. for constructors without a method here:
+// `flagz.DynRules(ns.FlagSet(), ns.Name("rules"), ...)`.
+func (n *FlagNamespace) Name(name string) string {
+	return n.prefix + name
+}
+
+// Lookup returns the flag `name` of the namespace, or nil if there is none.
+func (n *FlagNamespace) Lookup(name string) *flag.Flag {
+	return n.flagSet.Lookup(n.Name(name))
+}
+
+// DynBool registers a `DynBool` flag in the namespace.
+func (n *FlagNamespace) DynBool(name string, value bool, usage string) *DynBoolValue {
+	return DynBool(n.flagSet, n.Name(name), value, usage)
+}
+
+// DynDuration registers a `DynDuration` flag in the namespace.
+func (n *FlagNamespace) DynDuration(name string, value time.Duration, usage string) *DynDurationValue {
+	return DynDuration(n.flagSet, n.Name(name), value, usage)
+}
+
+// DynFloat64 registers a `DynFloat64` flag in the namespace.
+func (n *FlagNamespace) DynFloat64(name string, value float64, usage string) *DynFloat64Value {
+	return DynFloat64(n.flagSet, n.Name(name), value, usage)
+}
+
+// DynInt64 registers a `DynInt64` flag in the namespace.
+func (n *FlagNamespace) DynInt64(name string, value int64, usage string) *DynInt64Value {
+	return DynInt64(n.flagSet, n.Name(name), value, usage)
+}
+
+// DynJSON registers a `DynJSON` flag in the namespace.
+func (n *FlagNamespace) DynJSON(name string, value interface{}, usage string) *DynJSONValue {
+	return DynJSON(n.flagSet, n.Name(name), value, usage)
+}
+
+// DynPercentage registers a `DynPercentage` flag in the namespace.
+func (n *FlagNamespace) DynPercentage(name string, value float64, usage string) *DynPercentageValue {
+	return DynPercentage(n.flagSet, n.Name(name), value, usage)
+}
+
+// DynSecret registers a `DynSecret` flag in the namespace.
+func (n *FlagNamespace) DynSecret(name string, value string, usage string) *DynSecretValue {
+	return DynSecret(n.flagSet, n.Name(name), value, usage)
+}
+
+// DynString registers a `DynString` flag in the namespace.
+func (n *FlagNamespace) DynString(name string, value string, usage string) *DynStringValue {
+	return DynString(n.flagSet, n.Name(name), value, usage)
+}
+
+// DynStringSet registers a `DynStringSet` flag in the namespace.
+func (n *FlagNamespace) DynStringSet(name string, value []string, usage string) *DynStringSetValue {
+	return DynStringSet(n.flagSet, n.Name(name), value, usage)
+}
+
+// DynStringSlice registers a `DynStringSlice` flag in the namespace.
+func (n *FlagNamespace) DynStringSlice(name string, value []string, usage string) *DynStringSliceValue {
+	return DynStringSlice(n.flagSet, n.Name(name), value, usage)
+}
+
+// KeyPathToFlagName maps a `/`-separated key path, relative to the path or prefix of an Updater, onto the name of the
+// flag, joining nested directories with NamespaceSeparator, e.g. `cache/l1/ttl` onto `cache.l1.ttl`. Paths with empty
+// segments or segments reserved by flagz (starting with `__`, e.g. `flagz.InstanceOverridesDir`) name no flag.
+func KeyPathToFlagName(path string) (string, bool) {
+	segments := strings.Split(path, "/")
+	for _, segment := range segments {
+		if segment == "" || strings.HasPrefix(segment, "__") {
+			return "", false
+		}
+	}
+	return strings.Join(segments, NamespaceSeparator), true
+}
+
+// FlagNameToKeyPath is the inverse of `KeyPathToFlagName`, mapping the name of a flag onto its key path relative to the
+// path or prefix of an Updater, e.g. `cache.l1.ttl` onto `cache/l1/ttl`.
+func FlagNameToKeyPath(name string) string {
+	return strings.Replace(name, NamespaceSeparator, "/", -1)
+}
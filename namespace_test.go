@@ -0,0 +1,54 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespace_RegistersUnderPrefix(t *testing.T) {
+	set := flag.NewFlagSet("namespace", flag.ContinueOnError)
+	cache := flagz.Namespace(set, "cache")
+	assert.Equal(t, "cache.", cache.Prefix(), "the separator must be added")
+	ttl := cache.DynDuration("ttl", time.Second, "cache TTL")
+	l1 := cache.Namespace("l1.")
+	l1.DynInt64("size", 10, "L1 size")
+
+	require.NotNil(t, set.Lookup("cache.ttl"))
+	require.NotNil(t, set.Lookup("cache.l1.size"), "nested namespaces must extend the prefix")
+	assert.Equal(t, set.Lookup("cache.l1.size"), l1.Lookup("size"))
+	assert.True(t, flagz.IsFlagDynamic(set.Lookup("cache.ttl")))
+	assert.Equal(t, "cache.l1.rules", l1.Name("rules"))
+	assert.Equal(t, set, l1.FlagSet())
+
+	require.NoError(t, set.Set("cache.ttl", "5s"))
+	assert.Equal(t, 5*time.Second, ttl.Get())
+}
+
+func TestKeyPathToFlagName(t *testing.T) {
+	name, ok := flagz.KeyPathToFlagName("cache/l1/size")
+	assert.True(t, ok)
+	assert.Equal(t, "cache.l1.size", name)
+	name, ok = flagz.KeyPathToFlagName("some_flag")
+	assert.True(t, ok)
+	assert.Equal(t, "some_flag", name)
+	for _, path := range []string{"", "cache/", "/size", "cache//size", "cache/__hosts", "__global"} {
+		_, ok := flagz.KeyPathToFlagName(path)
+		assert.False(t, ok, "path %v must not name a flag", path)
+	}
+}
+
+func TestFlagNameToKeyPath(t *testing.T) {
+	assert.Equal(t, "cache/l1/size", flagz.FlagNameToKeyPath("cache.l1.size"))
+	assert.Equal(t, "some_flag", flagz.FlagNameToKeyPath("some_flag"))
+	name, ok := flagz.KeyPathToFlagName(flagz.FlagNameToKeyPath("cache.ttl"))
+	assert.True(t, ok)
+	assert.Equal(t, "cache.ttl", name, "the key path must map back onto the flag")
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	normalizersMu       sync.RWMutex
+	flagNormalizers     = make(map[*flag.Flag][]Normalizer)
+	flagSetNormalizers  = make(map[*flag.FlagSet][]Normalizer)
+	byteUnitsNormalizer = ExpandUnits(ByteUnits)
+)
+
+// ByteUnits are the units of sizes in bytes understood by `ExpandUnits`, e.g. "64KiB" or "1.5GB".
+var ByteUnits = map[string]float64{
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// Normalizer transforms the raw input of a flag before it is parsed and validated, e.g. to trim the trailing newline
+// of a value copy-pasted into etcd. An error rejects the input as a ParseError.
+type Normalizer func(input string) (string, error)
+
+// AddFlagNormalizers makes `SetFlagFromSource` (i.e. all Updaters, the flagz endpoints and `LoadFromFile`) pass the
+// inputs of the flag through `normalizers` in order, after the ones of its FlagSet (see `AddFlagSetNormalizers`).
+// Values set in other ways, e.g. from the command line, aren't normalized.
+func AddFlagNormalizers(f *flag.Flag, normalizers ...Normalizer) {
+	normalizersMu.Lock()
+	defer normalizersMu.Unlock()
+	flagNormalizers[f] = append(flagNormalizers[f], normalizers...)
+}
+
+// AddFlagSetNormalizers is like `AddFlagNormalizers` for all flags of `flagSet`, including the ones defined later.
+func AddFlagSetNormalizers(flagSet *flag.FlagSet, normalizers ...Normalizer) {
+	normalizersMu.Lock()
+	defer normalizersMu.Unlock()
+	flagSetNormalizers[flagSet] = append(flagSetNormalizers[flagSet], normalizers...)
+}
+
+// NormalizeFlagValue returns `input` passed through the normalizers of flag `f` of `flagSet`.
+func NormalizeFlagValue(flagSet *flag.FlagSet, f *flag.Flag, input string) (string, error) {
+	normalizersMu.RLock()
+	normalizers := append(append([]Normalizer(nil), flagSetNormalizers[flagSet]...), flagNormalizers[f]...)
+	normalizersMu.RUnlock()
+	for _, normalize := range normalizers {
+		normalized, err := normalize(input)
+		if err != nil {
+			return "", err
+		}
+		input = normalized
+	}
+	return input, nil
+}
+
+// TrimSpace is a Normalizer removing leading and trailing white space, including newlines.
+func TrimSpace(input string) (string, error) {
+	return strings.TrimSpace(input), nil
+}
+
+// StripQuotes is a Normalizer removing a pair of double, single or back quotes around the input, e.g. of values
+// copied from YAML or shell scripts.
+func StripQuotes(input string) (string, error) {
+	if len(input) < 2 {
+		return input, nil
+	}
+	if first := input[0]; (first == '"' || first == '\'' || first == '`') && input[len(input)-1] == first {
+		return input[1 : len(input)-1], nil
+	}
+	return input, nil
+}
+
+// NormalizeBool is a Normalizer of boolean inputs, lowercasing them and turning "yes", "on", "no" and "off" into
+// "true" and "false". Other inputs are kept as they are, for the flag to reject.
+func NormalizeBool(input string) (string, error) {
+	switch lower := strings.ToLower(input); lower {
+	case "yes", "on":
+		return "true", nil
+	case "no", "off":
+		return "false", nil
+	case "true", "false", "t", "f":
+		return lower, nil
+	}
+	return input, nil
+}
+
+// ExpandByteUnits is a Normalizer expanding sizes with ByteUnits, e.g. "64KiB" into "65536", see `ExpandUnits`.
+func ExpandByteUnits(input string) (string, error) {
+	return byteUnitsNormalizer(input)
+}
+
+// ExpandUnits returns a Normalizer expanding numbers with a unit suffix of `units` into the integer they stand for,
+// e.g. "1.5k" into "1500" with a `k` unit of 1000, for flags of integers. Inputs without a known unit are kept as they
+// are; numbers with one that don't expand into an integer are rejected.
+func ExpandUnits(units map[string]float64) Normalizer {
+	suffixes := make([]string, 0, len(units))
+	for suffix := range units {
+		suffixes = append(suffixes, suffix)
+	}
+	// longest first, so that "KiB" isn't taken for "B".
+	sort.Slice(suffixes, func(i, j int) bool {
+		if len(suffixes[i]) != len(suffixes[j]) {
+			return len(suffixes[i]) > len(suffixes[j])
+		}
+		return suffixes[i] < suffixes[j]
+	})
+	return func(input string) (string, error) {
+		for _, suffix := range suffixes {
+			if !strings.HasSuffix(input, suffix) {
+				continue
+			}
+			number, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(input, suffix)), 64)
+			if err != nil {
+				continue
+			}
+			expanded := number * units[suffix]
+			if expanded != math.Trunc(expanded) || math.Abs(expanded) >= 1<<63 {
+				return "", fmt.Errorf("%q doesn't expand into an integer", input)
+			}
+			return strconv.FormatInt(int64(expanded), 10), nil
+		}
+		return input, nil
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetFlagFromSource_NormalizesValues(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_size", 1, "Use it or lose it")
+	flagz.DynBool(set, "some_bool", false, "Use it or lose it")
+	flagz.DynString(set, "some_string", "foo", "Use it or lose it")
+	flagz.AddFlagSetNormalizers(set, flagz.TrimSpace, flagz.StripQuotes)
+	flagz.AddFlagNormalizers(set.Lookup("some_size"), flagz.ExpandByteUnits)
+	flagz.AddFlagNormalizers(set.Lookup("some_bool"), flagz.NormalizeBool)
+
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_size", "\"64KiB\"\n", "etcd"))
+	assert.Equal(t, "65536", set.Lookup("some_size").Value.String())
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_bool", " Yes\n", "etcd"))
+	assert.Equal(t, "true", set.Lookup("some_bool").Value.String())
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_string", "'bar'\r\n", "etcd"))
+	assert.Equal(t, "bar", set.Lookup("some_string").Value.String())
+
+	err := flagz.SetFlagFromSource(set, "some_size", "1.5B", "etcd")
+	require.Error(t, err, "sizes that don't expand into an integer must be rejected")
+	var parseErr *flagz.ParseError
+	assert.True(t, errors.As(err, &parseErr), "normalizer errors must be parse errors")
+	assert.Equal(t, "65536", set.Lookup("some_size").Value.String())
+}
+
+func TestNormalizers(t *testing.T) {
+	for _, tc := range []struct {
+		normalizer flagz.Normalizer
+		input      string
+		expected   string
+	}{
+		{flagz.TrimSpace, " \tfoo bar\n", "foo bar"},
+		{flagz.StripQuotes, `"foo"`, "foo"},
+		{flagz.StripQuotes, "`foo`", "foo"},
+		{flagz.StripQuotes, `"foo'`, `"foo'`},
+		{flagz.StripQuotes, `"`, `"`},
+		{flagz.NormalizeBool, "TRUE", "true"},
+		{flagz.NormalizeBool, "Off", "false"},
+		{flagz.NormalizeBool, "maybe", "maybe"},
+		{flagz.ExpandByteUnits, "2MiB", "2097152"},
+		{flagz.ExpandByteUnits, "1.5 GB", "1500000000"},
+		{flagz.ExpandByteUnits, "1024", "1024"},
+		{flagz.ExpandByteUnits, "lotsGB", "lotsGB"},
+		{flagz.ExpandUnits(map[string]float64{"k": 1e3, "M": 1e6}), "-2k", "-2000"},
+	} {
+		normalized, err := tc.normalizer(tc.input)
+		require.NoError(t, err, "input %q", tc.input)
+		assert.Equal(t, tc.expected, normalized, "input %q", tc.input)
+	}
+}
+
+func TestSetFlagFromSource_RedactsSecretsInNormalizerErrors(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_pin", 1234, "Use it or lose it")
+	flagz.MarkFlagSecret(set.Lookup("some_pin"))
+	flagz.AddFlagNormalizers(set.Lookup("some_pin"), flagz.ExpandByteUnits)
+	err := flagz.SetFlagFromSource(set, "some_pin", "12.34B", "etcd")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "12.34", "rejected secret values must not leak into errors")
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// OverflowPolicy decides what a NotifierPool does with notifications when its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes `Set` wait until the queue has room, slowing down updates to the pace of the notifiers.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop drops the notification, counting it in `Dropped`.
+	OverflowDrop
+	// OverflowSpawn runs the notification in a new go-routine, as done without a pool.
+	OverflowSpawn
+)
+
+// NotifierPool runs the notifiers of dynamic flags on a bounded number of go-routines, so that bursts of updates
+// (e.g. many etcd writes) don't create unbounded concurrency. Install it with `SetNotifierPool`.
+//
+// Notifications are queued in the order of updates, but with more than one worker notifiers of the same flag may run
+// concurrently and finish out of order. Use a single worker to serialize all notifiers.
+type NotifierPool struct {
+	tasks   chan func()
+	policy  OverflowPolicy
+	dropped uint64
+	wg      sync.WaitGroup
+}
+
+// NewNotifierPool starts `workers` go-routines running notifications from a queue of `queueSize` pending ones.
+func NewNotifierPool(workers int, queueSize int, policy OverflowPolicy) *NotifierPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &NotifierPool{tasks: make(chan func(), queueSize), policy: policy}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Go runs `notification` on one of the workers, or according to the OverflowPolicy if the queue is full.
+func (p *NotifierPool) Go(notification func()) {
+	select {
+	case p.tasks <- notification:
+		return
+	default:
+	}
+	switch p.policy {
+	case OverflowDrop:
+		atomic.AddUint64(&p.dropped, 1)
+	case OverflowSpawn:
+		go notification()
+	default:
+		p.tasks <- notification
+	}
+}
+
+// Dropped returns the number of notifications dropped because of a full queue.
+func (p *NotifierPool) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Close stops the workers after they run all queued notifications. The pool must not be used afterwards, so
+// uninstall it with `SetNotifierPool(nil)` first.
+func (p *NotifierPool) Close() {
+	close(p.tasks)
+	p.wg.Wait()
+}
+
+func (p *NotifierPool) work() {
+	defer p.wg.Done()
+	for notification := range p.tasks {
+		notification()
+	}
+}
+
+var (
+	notifierPool  atomic.Value // holds a *NotifierPool, nil for a go-routine per notification.
+	syncNotifiers int32        // 1 if notifiers run synchronously, see SetSyncNotifiers.
+	notifierCtx   atomic.Value // holds a notifierContext, the parent set with SetNotifierContext.
+)
+
+type notifierContext struct {
+	ctx context.Context
+}
+
+// SetNotifierPool makes the notifiers of all dynamic flags run on `pool`. A nil `pool` restores the default of running
+// each notification in a new go-routine.
+func SetNotifierPool(pool *NotifierPool) {
+	notifierPool.Store(pool)
+}
+
+// SetSyncNotifiers makes the notifiers of all dynamic flags run synchronously, before `Set` returns and in the order of
+// the updates of each flag, taking precedence over the pool set with `SetNotifierPool`. It is meant for tests asserting
+// on the effects of notifiers without sleeping, see `flagztest.SyncNotifiersForTest`.
+//
+// Notifiers running synchronously must not `Set` the flag they are notified of, as that would deadlock.
+func SetSyncNotifiers(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&syncNotifiers, v)
+}
+
+// RunNotifier runs `notification` asynchronously, on the pool set with `SetNotifierPool` if any, or synchronously
+// if enabled with `SetSyncNotifiers`.
+// It is used by dynamic values (including the ones in sub-packages) instead of `go` statements.
+func RunNotifier(notification func()) {
+	if atomic.LoadInt32(&syncNotifiers) == 1 {
+		notification()
+		return
+	}
+	if pool, _ := notifierPool.Load().(*NotifierPool); pool != nil {
+		pool.Go(notification)
+		return
+	}
+	go notification()
+}
+
+// SetNotifierContext makes `ctx` the parent of the contexts of all notifiers set with `WithNotifierCtx`, e.g. a context
+// cancelled on shutdown of the process. A nil `ctx` restores the default of `context.Background()`.
+func SetNotifierContext(ctx context.Context) {
+	notifierCtx.Store(notifierContext{ctx: ctx})
+}
+
+// RunNotifierCtx runs `notification` of `value` like `RunNotifier`, with a context that is done once the context of the
+// update being set by `SetFlagFromSourceCtx` (e.g. the one of an Updater, cancelled by `Stop`) or the one set with
+// `SetNotifierContext` is done, or after `timeout` if it is positive, so that long-running reactions to changes
+// (e.g. rebuilding connection pools) are cancelled on shutdown instead of leaking go-routines.
+// It is used by dynamic values (including the ones in sub-packages) instead of `go` statements.
+func RunNotifierCtx(value flag.Value, timeout time.Duration, notification func(ctx context.Context)) {
+	parent, ok := updateContext(value)
+	if !ok {
+		parent = context.Background()
+	}
+	RunNotifier(func() {
+		ctx, cancel := context.WithCancel(parent)
+		defer cancel()
+		if nc, _ := notifierCtx.Load().(notifierContext); nc.ctx != nil {
+			stop := context.AfterFunc(nc.ctx, cancel)
+			defer stop()
+		}
+		if timeout > 0 {
+			var cancelTimeout context.CancelFunc
+			ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+			defer cancelTimeout()
+		}
+		notification(ctx)
+	})
+}
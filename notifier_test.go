@@ -0,0 +1,143 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifierPool_RunsDynamicFlagNotifiers(t *testing.T) {
+	pool := NewNotifierPool(1, 100, OverflowBlock)
+	SetNotifierPool(pool)
+	defer SetNotifierPool(nil)
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 13371337, "Use it or lose it")
+	var seen []int64
+	dynFlag.WithNotifier(func(oldVal int64, newVal int64) {
+		seen = append(seen, newVal)
+	})
+	for _, value := range []string{"1", "2", "3"} {
+		require.NoError(t, set.Set("some_int_1", value))
+	}
+	SetNotifierPool(nil)
+	pool.Close()
+	assert.Equal(t, []int64{1, 2, 3}, seen, "a single worker must run notifications in order")
+}
+
+func TestNotifierPool_OverflowDrop(t *testing.T) {
+	pool := NewNotifierPool(1, 1, OverflowDrop)
+	defer pool.Close()
+	block := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		pool.Go(func() { <-block })
+	}
+	close(block)
+	assert.True(t, pool.Dropped() >= 3, "notifications beyond the running and queued one must be dropped")
+}
+
+func TestNotifierPool_OverflowSpawn(t *testing.T) {
+	pool := NewNotifierPool(1, 0, OverflowSpawn)
+	defer pool.Close()
+	block := make(chan struct{})
+	done := make(chan struct{}, 2)
+	pool.Go(func() {
+		<-block
+		done <- struct{}{}
+	})
+	pool.Go(func() { done <- struct{}{} })
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		assert.Fail(t, "overflowing notification must run in a new go-routine")
+	}
+	close(block)
+	<-done
+	assert.EqualValues(t, 0, pool.Dropped())
+}
+
+func TestSetSyncNotifiers_RunsNotifiersBeforeSetReturns(t *testing.T) {
+	SetSyncNotifiers(true)
+	defer SetSyncNotifiers(false)
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynInt64(set, "some_int_1", 13371337, "Use it or lose it")
+	var seen []int64
+	dynFlag.WithNotifier(func(oldVal int64, newVal int64) {
+		seen = append(seen, oldVal, newVal)
+	})
+	require.NoError(t, set.Set("some_int_1", "1"))
+	assert.Equal(t, []int64{13371337, 1}, seen, "the notifier must have run when Set returns")
+	require.NoError(t, set.Set("some_int_1", "2"))
+	assert.Equal(t, []int64{13371337, 1, 1, 2}, seen, "notifiers must run in the order of updates")
+}
+
+func TestRunNotifierCtx_CancelsOnStopOfTheSource(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	done := make(chan error, 1)
+	sources := make(chan string, 1)
+	DynInt64(set, "some_int", 1, "Some int").WithNotifierCtx(func(ctx context.Context, oldValue int64, newValue int64) {
+		info, _ := UpdateInfoFromContext(ctx)
+		sources <- info.Source
+		<-ctx.Done()
+		done <- ctx.Err()
+	}, 0)
+	lifecycle, stop := context.WithCancel(context.Background())
+	require.NoError(t, SetFlagFromSourceCtx(lifecycle, set, "some_int", "2", "etcd"))
+	assert.Equal(t, "etcd", <-sources, "notifiers must get the UpdateInfo of the update")
+	stop()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "stopping the source must cancel the notifier")
+	}
+}
+
+func TestRunNotifierCtx_TimesOut(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	done := make(chan error, 1)
+	DynString(set, "some_string", "foo", "Some string").WithNotifierCtx(
+		func(ctx context.Context, oldValue string, newValue string) {
+			<-ctx.Done()
+			done <- ctx.Err()
+		}, 5*time.Millisecond)
+	require.NoError(t, set.Set("some_string", "bar"))
+	select {
+	case err := <-done:
+		assert.Equal(t, context.DeadlineExceeded, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "notifiers must time out")
+	}
+}
+
+func TestSetNotifierContext_CancelsNotifiersOnShutdown(t *testing.T) {
+	shutdown, cancel := context.WithCancel(context.Background())
+	SetNotifierContext(shutdown)
+	defer SetNotifierContext(nil)
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	DynBool(set, "some_bool", false, "Some bool").WithNotifierCtx(func(ctx context.Context, oldValue bool, newValue bool) {
+		close(started)
+		<-ctx.Done()
+		done <- ctx.Err()
+	}, time.Minute)
+	require.NoError(t, SetFlagFromSource(set, "some_bool", "true", "endpoint"))
+	<-started
+	cancel()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "shutting down must cancel the notifier")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"strings"
+	"sync"
+)
+
+// InstanceOverridesDir is the key segment under the key of a flag holding values that override it on single instances,
+// e.g. `/flagz/app/log_level/__hosts/frontend-1`, so that e.g. verbose logging can be enabled on one instance for
+// debugging. Instances are identified by the same instance ID as for canaries, see `DefaultInstanceID`.
+const InstanceOverridesDir = "__hosts"
+
+// ParseOverrideKey returns the flag name and instance ID of `key`, relative to the path or prefix of an Updater, if it
+// is a per-instance override in the form of `<flag name>/__hosts/<instance ID>`. The flag name may be a path of nested
+// directories, see `KeyPathToFlagName`.
+func ParseOverrideKey(key string) (flagName string, instanceID string, ok bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) < 3 || parts[len(parts)-2] != InstanceOverridesDir || parts[len(parts)-1] == "" {
+		return "", "", false
+	}
+	if flagName, ok = KeyPathToFlagName(strings.Join(parts[:len(parts)-2], "/")); !ok {
+		return "", "", false
+	}
+	return flagName, parts[len(parts)-1], true
+}
+
+// InstanceOverrides tracks the flags overridden on an instance by an Updater, and the global values they have, so that
+// global updates don't replace the overrides and the global values are restored once the overrides are removed.
+type InstanceOverrides struct {
+	mu         sync.Mutex
+	globals    map[string]string
+	overridden map[string]bool
+}
+
+// NewInstanceOverrides creates an InstanceOverrides without any flags.
+func NewInstanceOverrides() *InstanceOverrides {
+	o := &InstanceOverrides{}
+	o.Reset()
+	return o
+}
+
+// Reset forgets all flags, e.g. before a full read of the backend.
+func (o *InstanceOverrides) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.globals = make(map[string]string)
+	o.overridden = make(map[string]bool)
+}
+
+// SetGlobal records the global value of flag `name`, returning whether it should be applied, i.e. whether the flag
+// isn't overridden.
+func (o *InstanceOverrides) SetGlobal(name string, value string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.globals[name] = value
+	return !o.overridden[name]
+}
+
+// SetOverride records that flag `name` is overridden on this instance.
+func (o *InstanceOverrides) SetOverride(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.overridden[name] = true
+}
+
+// RemoveOverride records that the override of flag `name` was removed, returning the global value to restore, if
+// there is one.
+func (o *InstanceOverrides) RemoveOverride(name string) (string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.overridden, name)
+	global, ok := o.globals[name]
+	return global, ok
+}
+
+// IsOverridden tells whether flag `name` is overridden on this instance.
+func (o *InstanceOverrides) IsOverridden(name string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.overridden[name]
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOverrideKey(t *testing.T) {
+	name, instanceID, ok := flagz.ParseOverrideKey("log_level/__hosts/frontend-1")
+	assert.True(t, ok)
+	assert.Equal(t, "log_level", name)
+	assert.Equal(t, "frontend-1", instanceID)
+	name, _, ok = flagz.ParseOverrideKey("cache/ttl/__hosts/frontend-1")
+	assert.True(t, ok)
+	assert.Equal(t, "cache.ttl", name, "nested directories must map onto namespaces")
+	for _, key := range []string{"log_level", "log_level/__hosts", "log_level/__hosts/", "log_level/hosts/a", "/__hosts/a",
+		"log_level/__hosts/a/b", "cache//ttl/__hosts/a", "__hosts/__hosts/a"} {
+		_, _, ok := flagz.ParseOverrideKey(key)
+		assert.False(t, ok, "key %v must not be an override", key)
+	}
+}
+
+func TestInstanceOverrides(t *testing.T) {
+	o := flagz.NewInstanceOverrides()
+	assert.True(t, o.SetGlobal("log_level", "info"), "global values of flags without overrides must be applied")
+	o.SetOverride("log_level")
+	assert.True(t, o.IsOverridden("log_level"))
+	assert.False(t, o.SetGlobal("log_level", "warn"), "global values of overridden flags must not be applied")
+	global, ok := o.RemoveOverride("log_level")
+	assert.True(t, ok)
+	assert.Equal(t, "warn", global, "the latest global value must be restored")
+
+	o.SetOverride("verbose")
+	_, ok = o.RemoveOverride("verbose")
+	assert.False(t, ok, "flags without global values must have none to restore")
+	o.SetOverride("log_level")
+	o.Reset()
+	assert.False(t, o.IsOverridden("log_level"))
+}
@@ -0,0 +1,187 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+// PeerChecker decides whether `DiffWithPeer` may fetch the flags of the instance at `peer`, protecting the handler
+// from being used to make requests to arbitrary hosts. Returning an error rejects the request.
+type PeerChecker func(req *http.Request, peer *url.URL) error
+
+// WithPeerChecker enables the `DiffWithPeer` handler for the peers approved by `checker`.
+func (e *StatusEndpoint) WithPeerChecker(checker PeerChecker) *StatusEndpoint {
+	e.peerChecker = checker
+	return e
+}
+
+// WithPeerClient sets the HTTP client used by `DiffWithPeer` to fetch flags of peers, e.g. to add authentication.
+// Defaults to a client with a 5s timeout.
+func (e *StatusEndpoint) WithPeerClient(client *http.Client) *StatusEndpoint {
+	e.peerClient = client
+	return e
+}
+
+// DiffWithPeer provides a `http.HandlerFunc` (e.g. for `/debug/flagz/diff`) that compares the dynamic flags of this
+// instance with the ones of another instance, whose JSON flag endpoint (`ListFlags` or `ServeHTTP`) is passed in the
+// `peer` URL query parameter, e.g. `http://other-instance:8080/debug/flagz`. Only flags whose values differ, or that exist on one side only, are listed.
+// HTML is served to browsers, JSON otherwise or whenever `format=json` is requested.
+//
+// The handler rejects all requests unless enabled through `WithPeerChecker`.
+func (e *StatusEndpoint) DiffWithPeer(resp http.ResponseWriter, req *http.Request) {
+	if e.peerChecker == nil {
+		http.Error(resp, "flagz: diffing with peers is not enabled", http.StatusForbidden)
+		return
+	}
+	peer, err := url.Parse(req.URL.Query().Get("peer"))
+	if err != nil || peer.Host == "" || (peer.Scheme != "http" && peer.Scheme != "https") {
+		http.Error(resp, "flagz: peer must be an absolute http(s) URL", http.StatusBadRequest)
+		return
+	}
+	if err := e.peerChecker(req, peer); err != nil {
+		http.Error(resp, fmt.Sprintf("flagz: peer not allowed: %v", err), http.StatusForbidden)
+		return
+	}
+	peerFlags, err := e.fetchPeerFlags(peer)
+	if err != nil {
+		http.Error(resp, fmt.Sprintf("flagz: failed fetching flags of peer: %v", err), http.StatusBadGateway)
+		return
+	}
+	localReq := &http.Request{URL: &url.URL{RawQuery: "type=dynamic"}}
+	diff := diffFlagSets(e.collectFlags(localReq), peerFlags)
+	diff.Peer = peer.String()
+	if requestIsBrowser(req) && req.URL.Query().Get("format") != "json" {
+		resp.Header().Add("Content-Type", "text/html")
+		resp.WriteHeader(http.StatusOK)
+		if err := flagzDiffTemplate.Execute(resp, diff); err != nil {
+			e.logf("flagz: bad diff template evaluation: %v", err)
+		}
+		return
+	}
+	out, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		resp.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Add("Content-Type", "application/json")
+	resp.WriteHeader(http.StatusOK)
+	resp.Write(out)
+}
+
+func (e *StatusEndpoint) fetchPeerFlags(peer *url.URL) (*flagSetJSON, error) {
+	peerURL := *peer
+	if query := peerURL.Query(); query.Get("format") == "" {
+		// makes `ServeHTTP` peers respond with JSON too.
+		query.Set("format", "json")
+		peerURL.RawQuery = query.Encode()
+	}
+	peerReq, err := http.NewRequest("GET", peerURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	peerReq.Header.Set("Accept", "application/json")
+	peerResp, err := e.peerClient.Do(peerReq)
+	if err != nil {
+		return nil, err
+	}
+	defer peerResp.Body.Close()
+	if peerResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer responded with status %v", peerResp.Status)
+	}
+	peerFlags := &flagSetJSON{}
+	if err := json.NewDecoder(peerResp.Body).Decode(peerFlags); err != nil {
+		return nil, fmt.Errorf("peer responded with bad flags JSON: %v", err)
+	}
+	return peerFlags, nil
+}
+
+type flagSetDiffJSON struct {
+	Peer  string          `json:"peer"`
+	Flags []*flagDiffJSON `json:"flags"`
+}
+
+type flagDiffJSON struct {
+	Name        string `json:"name"`
+	LocalValue  string `json:"local_value"`
+	PeerValue   string `json:"peer_value"`
+	LocalSource string `json:"local_source,omitempty"`
+	PeerSource  string `json:"peer_source,omitempty"`
+	// LocalMissing and PeerMissing are set if the dynamic flag doesn't exist on the given side.
+	LocalMissing bool `json:"local_missing,omitempty"`
+	PeerMissing  bool `json:"peer_missing,omitempty"`
+}
+
+func diffFlagSets(local *flagSetJSON, peer *flagSetJSON) *flagSetDiffJSON {
+	diffs := make(map[string]*flagDiffJSON)
+	for _, fj := range local.Flags {
+		diffs[fj.Name] = &flagDiffJSON{Name: fj.Name, LocalValue: fj.CurrentValue, LocalSource: fj.Source, PeerMissing: true}
+	}
+	for _, fj := range peer.Flags {
+		if !fj.IsDynamic {
+			continue
+		}
+		diff, ok := diffs[fj.Name]
+		if !ok {
+			diff = &flagDiffJSON{Name: fj.Name, LocalMissing: true}
+			diffs[fj.Name] = diff
+		}
+		diff.PeerValue = fj.CurrentValue
+		diff.PeerSource = fj.Source
+		diff.PeerMissing = false
+	}
+	names := make([]string, 0, len(diffs))
+	for name, diff := range diffs {
+		if !diff.LocalMissing && !diff.PeerMissing && diff.LocalValue == diff.PeerValue {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := &flagSetDiffJSON{Flags: []*flagDiffJSON{}}
+	for _, name := range names {
+		out.Flags = append(out.Flags, diffs[name])
+	}
+	return out
+}
+
+var (
+	// values come from the peer, and are escaped by html/template.
+	flagzDiffTemplate = template.Must(template.New("flagz_diff").Parse(
+		`
+<html><head>
+<title>Flagz Diff</title>
+<link href="https://maxcdn.bootstrapcdn.com/bootstrap/3.3.4/css/bootstrap.css" rel="stylesheet">
+</head>
+<body>
+<div class="container-fluid">
+<div class="col-md-10 col-md-offset-1">
+	<h1>Flagz Diff</h1>
+	<p>
+	Dynamic flags differing between this instance and <code>{{ .Peer }}</code> (<a href="?format=json&peer={{ .Peer }}">JSON</a>).
+	</p>
+	{{ if .Flags }}
+	<table class="table table-striped">
+	  <tr><th>Flag</th><th>This instance</th><th>Peer</th></tr>
+	  {{ range $flag := .Flags }}
+	  <tr>
+	    <td><code>{{ $flag.Name }}</code></td>
+	    <td>{{ if not $flag.LocalMissing }}<pre style="font-size: 8pt">{{ $flag.LocalValue }}</pre><small>{{ $flag.LocalSource }}</small>{{ else }}<span class="label label-default">missing</span>{{ end }}</td>
+	    <td>{{ if not $flag.PeerMissing }}<pre style="font-size: 8pt">{{ $flag.PeerValue }}</pre><small>{{ $flag.PeerSource }}</small>{{ else }}<span class="label label-default">missing</span>{{ end }}</td>
+	  </tr>
+	  {{ end }}
+	</table>
+	{{ else }}
+	<p><span class="label label-success">identical</span> All dynamic flags match.</p>
+	{{ end }}
+</div></div>
+</body>
+</html>
+`))
+)
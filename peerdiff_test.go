@@ -0,0 +1,93 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type peerDiffTestSuite struct {
+	suite.Suite
+	local    *flag.FlagSet
+	peer     *flag.FlagSet
+	server   *httptest.Server
+	endpoint *StatusEndpoint
+}
+
+func TestPeerDiffTestSuite(t *testing.T) {
+	suite.Run(t, &peerDiffTestSuite{})
+}
+
+func (s *peerDiffTestSuite) SetupTest() {
+	s.local = flag.NewFlagSet("local", flag.ContinueOnError)
+	s.peer = flag.NewFlagSet("peer", flag.ContinueOnError)
+	for _, set := range []*flag.FlagSet{s.local, s.peer} {
+		set.String("some_static_string", "foo", "Some static string text")
+		DynInt64(set, "some_dyn_int", 1, "Some dynamic int text")
+		DynString(set, "some_dyn_string", "foo", "Some dynamic string text")
+	}
+	DynString(s.local, "some_local_only", "foo", "Some dynamic string text")
+	s.peer.Set("some_static_string", "bar")
+	SetFlagFromSource(s.peer, "some_dyn_int", "2", "etcd")
+
+	s.server = httptest.NewServer(NewStatusEndpoint(s.peer))
+	s.endpoint = NewStatusEndpoint(s.local).WithPeerChecker(func(req *http.Request, peer *url.URL) error {
+		if peer.Host != s.server.Listener.Addr().String() {
+			return fmt.Errorf("unknown peer")
+		}
+		return nil
+	})
+}
+
+func (s *peerDiffTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *peerDiffTestSuite) diff(peer string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/debug/flagz/diff?peer="+url.QueryEscape(peer), nil)
+	resp := httptest.NewRecorder()
+	s.endpoint.DiffWithPeer(resp, req)
+	return resp
+}
+
+func (s *peerDiffTestSuite) TestListsDifferingDynamicFlags() {
+	resp := s.diff(s.server.URL)
+	require.Equal(s.T(), http.StatusOK, resp.Code, "diff must succeed: %v", resp.Body.String())
+	diff := &flagSetDiffJSON{}
+	require.NoError(s.T(), json.Unmarshal(resp.Body.Bytes(), diff))
+	require.Len(s.T(), diff.Flags, 2, "only differing dynamic flags must be listed")
+	assert.Equal(s.T(), &flagDiffJSON{Name: "some_dyn_int", LocalValue: "1", PeerValue: "2", PeerSource: "etcd"}, diff.Flags[0])
+	assert.Equal(s.T(), &flagDiffJSON{Name: "some_local_only", LocalValue: "foo", PeerMissing: true}, diff.Flags[1])
+}
+
+func (s *peerDiffTestSuite) TestRendersHTML() {
+	req, _ := http.NewRequest("GET", "/debug/flagz/diff?peer="+url.QueryEscape(s.server.URL), nil)
+	req.Header.Set("Accept", "text/html")
+	resp := httptest.NewRecorder()
+	s.endpoint.DiffWithPeer(resp, req)
+	require.Equal(s.T(), http.StatusOK, resp.Code)
+	assert.Contains(s.T(), resp.Body.String(), "<code>some_dyn_int</code>")
+	assert.Contains(s.T(), resp.Body.String(), "missing")
+}
+
+func (s *peerDiffTestSuite) TestRejectsPeers() {
+	assert.Equal(s.T(), http.StatusForbidden, s.diff("http://metadata.internal/").Code, "peers must be checked")
+	assert.Equal(s.T(), http.StatusBadRequest, s.diff("/relative").Code, "peers must be absolute URLs")
+	assert.Equal(s.T(), http.StatusBadGateway, s.diff(s.server.URL+"/../nothing?format=html").Code, "bad peer responses must be reported")
+
+	disabled := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/debug/flagz/diff?peer="+url.QueryEscape(s.server.URL), nil)
+	NewStatusEndpoint(s.local).DiffWithPeer(disabled, req)
+	assert.Equal(s.T(), http.StatusForbidden, disabled.Code, "diffing must be disabled by default")
+}
@@ -0,0 +1,87 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	pinsMu sync.Mutex
+	pins   = make(map[*flag.Flag]*HeldUpdate)
+
+	// manualSources are the sources of `SetFlagFromSource` of changes made by operators, which may change pinned flags.
+	manualSources = map[string]bool{"endpoint": true, "grpc": true}
+)
+
+// HeldUpdate is the last value of a pinned flag set by an Updater, applied when the flag is unpinned.
+type HeldUpdate struct {
+	Time   time.Time `json:"time"`
+	Value  string    `json:"value"`
+	Source string    `json:"source"`
+}
+
+// PinFlag makes the current value of `f` stick: values set by Updaters (e.g. from etcd) are held instead of applied,
+// until `UnpinFlag` applies the last one of them. Flags are pinned through the status endpoint (`pin=true` of
+// `SetFlag`) while mitigating incidents in which the central configuration is itself the problem. Changes made
+// through the flagz endpoints still apply.
+func PinFlag(f *flag.Flag) {
+	pinsMu.Lock()
+	defer pinsMu.Unlock()
+	if _, pinned := pins[f]; !pinned {
+		pins[f] = nil
+	}
+}
+
+// IsFlagPinned checks whether the flag was pinned with `PinFlag`.
+func IsFlagPinned(f *flag.Flag) bool {
+	pinsMu.Lock()
+	defer pinsMu.Unlock()
+	_, pinned := pins[f]
+	return pinned
+}
+
+// FlagHeldUpdate returns the last update of the pinned flag `f` held since it was pinned, if any.
+func FlagHeldUpdate(f *flag.Flag) (HeldUpdate, bool) {
+	pinsMu.Lock()
+	defer pinsMu.Unlock()
+	if held := pins[f]; held != nil {
+		return *held, true
+	}
+	return HeldUpdate{}, false
+}
+
+// UnpinFlag clears the pin of flag `name` of `flagSet`, and applies the update held while it was pinned, if any. It
+// returns ErrFlagNotFound for unknown flags, and the error of applying the held update.
+func UnpinFlag(flagSet *flag.FlagSet, name string) error {
+	f := flagSet.Lookup(name)
+	if f == nil {
+		return ErrFlagNotFound
+	}
+	pinsMu.Lock()
+	held := pins[f]
+	delete(pins, f)
+	pinsMu.Unlock()
+	if held == nil {
+		return nil
+	}
+	return SetFlagFromSource(flagSet, f.Name, held.Value, held.Source)
+}
+
+// holdUpdate holds the update of `f` to `value` by `source` if `f` is pinned and the source isn't a manual one.
+func holdUpdate(f *flag.Flag, value string, source string) bool {
+	if manualSources[source] {
+		return false
+	}
+	pinsMu.Lock()
+	defer pinsMu.Unlock()
+	if _, pinned := pins[f]; !pinned {
+		return false
+	}
+	pins[f] = &HeldUpdate{Time: time.Now(), Value: value, Source: source}
+	return true
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinFlag_HoldsUpdaterValuesUntilUnpinned(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := flagz.DynInt64(set, "some_int", 1, "Some int")
+	f := set.Lookup("some_int")
+	flagz.PinFlag(f)
+	assert.True(t, flagz.IsFlagPinned(f))
+
+	assert.Equal(t, flagz.ErrFlagPinned, flagz.SetFlagFromSource(set, "some_int", "2", "etcd"))
+	assert.Equal(t, int64(1), value.Get(), "values of updaters must be held while the flag is pinned")
+	held, ok := flagz.FlagHeldUpdate(f)
+	require.True(t, ok, "the update must be held")
+	assert.Equal(t, "2", held.Value)
+	assert.Equal(t, "etcd", held.Source)
+
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_int", "3", "endpoint"))
+	assert.Equal(t, int64(3), value.Get(), "changes through the endpoint must apply to pinned flags")
+
+	require.NoError(t, flagz.UnpinFlag(set, "some_int"))
+	assert.False(t, flagz.IsFlagPinned(f))
+	assert.Equal(t, int64(2), value.Get(), "unpinning must apply the held value")
+	assert.Equal(t, "etcd", flagz.FlagSource(f))
+	_, ok = flagz.FlagHeldUpdate(f)
+	assert.False(t, ok, "no update must be held after unpinning")
+
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_int", "4", "etcd"))
+	assert.Equal(t, int64(4), value.Get(), "values of updaters must apply to unpinned flags")
+}
+
+func TestUnpinFlag_Errors(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_int", 1, "Some int")
+	assert.Equal(t, flagz.ErrFlagNotFound, flagz.UnpinFlag(set, "no_such_flag"))
+	assert.NoError(t, flagz.UnpinFlag(set, "some_int"), "unpinning flags that aren't pinned must be a no-op")
+
+	flagz.PinFlag(set.Lookup("some_int"))
+	assert.Equal(t, flagz.ErrFlagPinned, flagz.SetFlagFromSource(set, "some_int", "notanint", "etcd"),
+		"held values aren't parsed")
+	assert.Error(t, flagz.UnpinFlag(set, "some_int"), "held values failing to parse must be returned")
+	assert.False(t, flagz.IsFlagPinned(set.Lookup("some_int")), "the pin must be cleared regardless")
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package protoflagz
+
+import (
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	defaultTypeURLPrefix = "type.googleapis.com/"
+)
+
+// AnyRegistry resolves the types of `google.protobuf.Any` fields in DynProto3 values, see `WithAnyResolver`.
+//
+// Only the registered types resolve, which makes the registry double as an allowlist of the implementations that
+// can be plugged into polymorphic config messages (e.g. the matcher types of a policy). It resolves no extensions.
+type AnyRegistry struct {
+	mu    sync.RWMutex
+	types map[string]protoreflect.MessageType
+}
+
+// NewAnyRegistry creates an empty registry.
+func NewAnyRegistry() *AnyRegistry {
+	return &AnyRegistry{types: make(map[string]protoreflect.MessageType)}
+}
+
+// Register adds the type of `msg` under its default type URL, `type.googleapis.com/<full message name>`.
+func (r *AnyRegistry) Register(msg proto.Message) *AnyRegistry {
+	return r.RegisterURL(defaultTypeURLPrefix+string(msg.ProtoReflect().Descriptor().FullName()), msg)
+}
+
+// RegisterURL adds the type of `msg` under a custom `typeURL`, e.g. `type.example.com/matchers.Prefix`.
+func (r *AnyRegistry) RegisterURL(typeURL string, msg proto.Message) *AnyRegistry {
+	r.mu.Lock()
+	r.types[typeURL] = msg.ProtoReflect().Type()
+	r.mu.Unlock()
+	return r
+}
+
+// FindMessageByURL implements `protoregistry.MessageTypeResolver`, returning the type registered under `typeURL`.
+// Bare message names are accepted as shorthands of the default type URL.
+func (r *AnyRegistry) FindMessageByURL(typeURL string) (protoreflect.MessageType, error) {
+	if !strings.Contains(typeURL, "/") {
+		typeURL = defaultTypeURLPrefix + typeURL
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	typ, ok := r.types[typeURL]
+	if !ok {
+		return nil, protoregistry.NotFound
+	}
+	return typ, nil
+}
+
+// FindMessageByName implements `protoregistry.MessageTypeResolver`, for types registered under their default type URL.
+func (r *AnyRegistry) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	return r.FindMessageByURL(defaultTypeURLPrefix + string(name))
+}
+
+// FindExtensionByName implements `protoregistry.ExtensionTypeResolver`, never finding anything.
+func (r *AnyRegistry) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return nil, protoregistry.NotFound
+}
+
+// FindExtensionByNumber implements `protoregistry.ExtensionTypeResolver`, never finding anything.
+func (r *AnyRegistry) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return nil, protoregistry.NotFound
+}
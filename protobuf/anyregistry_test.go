@@ -0,0 +1,52 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package protoflagz
+
+import (
+	"testing"
+
+	"github.com/mwitkow/go-flagz/protobuf/testdata"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAnyRegistry_Resolve(t *testing.T) {
+	registry := NewAnyRegistry().
+		Register(&mwitkow_testproto.PrefixMatcher{}).
+		RegisterURL("type.example.com/matchers.Some", &mwitkow_testproto.SomeMsg{})
+
+	typ, err := registry.FindMessageByURL("type.googleapis.com/mwitkow.testproto.PrefixMatcher")
+	require.NoError(t, err)
+	assert.IsType(t, &mwitkow_testproto.PrefixMatcher{}, typ.New().Interface())
+	typ, err = registry.FindMessageByURL("type.example.com/matchers.Some")
+	require.NoError(t, err)
+	assert.IsType(t, &mwitkow_testproto.SomeMsg{}, typ.New().Interface())
+
+	_, err = registry.FindMessageByURL("type.googleapis.com/mwitkow.testproto.SomePolicy")
+	assert.Error(t, err, "unregistered types must not resolve, even if globally known")
+}
+
+func TestDynProto3_SetAnyWithRegistry(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3(set, "some_policy", &mwitkow_testproto.SomePolicy{}, "Use it or lose it")
+	dynFlag.WithAnyResolver(NewAnyRegistry().RegisterURL("type.example.com/matchers.Some", &mwitkow_testproto.SomeMsg{}))
+
+	input := `{"name": "foo", "matcher": {"@type": "type.example.com/matchers.Some", "someString": "bar"}}`
+	require.NoError(t, set.Set("some_policy", input), "registered Any types must resolve")
+	policy := dynFlag.Get().(*mwitkow_testproto.SomePolicy)
+	matcher := &mwitkow_testproto.SomeMsg{}
+	require.NoError(t, proto.Unmarshal(policy.Matcher.Value, matcher))
+	assert.Equal(t, "bar", matcher.SomeString)
+	assert.Contains(t, dynFlag.String(), `"bar"`, "Any fields must be marshaled using the resolver")
+	assert.NotContains(t, dynFlag.String(), "ERR", "Any fields must be marshaled using the resolver")
+
+	err := set.Set("some_policy", `{"matcher": {"@type": "type.example.com/matchers.Unknown"}}`)
+	assert.Error(t, err, "unregistered Any types must be rejected")
+	assert.True(t, proto.Equal(policy, dynFlag.Get()), "value must not change after bad update")
+
+	textInput := TextFormatPrefix + `matcher { [type.example.com/matchers.Some] { some_string: "baz" } }`
+	require.NoError(t, set.Set("some_policy", textInput), "registered Any types must resolve in text format")
+}
@@ -0,0 +1,422 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package protoflagz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// DynProto3List creates a `Flag` that is backed by a list of Proto3-generated messages of the same type, which is
+// safe to change dynamically at runtime as a whole, e.g. a list of policy entries.
+// Inputs are JSON arrays of JSONPB encoded messages, e.g. `[{"some_string": "foo"}, {"some_string": "bar"}]`.
+// The `elem` must be a pointer to a generated message struct, and is only used for its type.
+func DynProto3List(flagSet *flag.FlagSet, name string, elem proto.Message, value []proto.Message, usage string) *DynProto3ListValue {
+	return DynProto3ListP(flagSet, name, "", elem, value, usage)
+}
+
+// DynProto3ListP is like DynProto3List, but accepts a shorthand letter that can be used after a single dash.
+func DynProto3ListP(flagSet *flag.FlagSet, name string, shorthand string, elem proto.Message, value []proto.Message,
+	usage string) *DynProto3ListValue {
+	dynValue := &DynProto3ListValue{ptr: unsafe.Pointer(&value), structType: messageStructType(elem)}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	flagz.MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynProto3ListValue is a flag-related list of proto3 messages value wrapper.
+type DynProto3ListValue struct {
+	lastChanged int64 // unix nanos, first to keep it 64-bit aligned for atomics.
+
+	structType      reflect.Type
+	ptr             unsafe.Pointer
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func([]proto.Message) error
+	validatorCtx    func(context.Context, []proto.Message) error
+	notifier        func(oldValue []proto.Message, newValue []proto.Message)
+	notifierCtx     func(ctx context.Context, oldValue []proto.Message, newValue []proto.Message)
+	notifierTimeout time.Duration
+	anyResolver     AnyResolver
+	maxSize         int
+	stringCache     flagz.StringCache
+}
+
+// Get retrieves the value in a thread-safe manner.
+// The returned list and its messages are shared by all callers and must not be modified.
+func (d *DynProto3ListValue) Get() []proto.Message {
+	p := (*[]proto.Message)(atomic.LoadPointer(&d.ptr))
+	return *p
+}
+
+// Set updates the value from a JSON array of JSONPB messages in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, or any of the messages doesn't pass its
+// protoc-gen-validate constraints, or the resulting list doesn't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynProto3ListValue) Set(input string) error {
+	if d.maxSize > 0 && len(input) > d.maxSize {
+		return &flagz.ParseError{Err: fmt.Errorf("value of %d bytes exceeds the maximum of %d bytes", len(input), d.maxSize)}
+	}
+	raws := []json.RawMessage{}
+	if err := json.Unmarshal([]byte(input), &raws); err != nil {
+		return &flagz.ParseError{Err: err}
+	}
+	val := make([]proto.Message, 0, len(raws))
+	for i, raw := range raws {
+		msg, err := unmarshalJSONMessage(d.structType, d.anyResolver, raw)
+		if err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+		val = append(val, msg)
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := flagz.RunValidatorCtx(d, validate); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
+	atomic.StoreInt64(&d.lastChanged, time.Now().UnixNano())
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*[]proto.Message)(oldPtr)
+		if d.notifier != nil {
+			flagz.RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			flagz.RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynProto3ListValue) WithValidator(validator func([]proto.Message) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and `flagz.UpdateInfo` of the update (see `flagz.SetFlagFromSourceCtx`), e.g. for bounded
+// external checks.
+func (d *DynProto3ListValue) WithValidatorCtx(validator func(ctx context.Context, value []proto.Message) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `flagz.ValidateAll`.
+func (d *DynProto3ListValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := flagz.RunValidatorCtx(d, validate); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `flagz.SetNotifierPool`.
+func (d *DynProto3ListValue) WithNotifier(notifier func(oldValue []proto.Message, newValue []proto.Message)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `flagz.RunNotifierCtx`.
+func (d *DynProto3ListValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue []proto.Message, newValue []proto.Message), timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// WithAnyResolver sets the resolver of the types of `google.protobuf.Any` fields, see `DynProto3Value.WithAnyResolver`.
+func (d *DynProto3ListValue) WithAnyResolver(resolver AnyResolver) {
+	d.anyResolver = resolver
+}
+
+// WithMaxSize rejects inputs longer than `bytes` before they're parsed.
+func (d *DynProto3ListValue) WithMaxSize(bytes int) {
+	d.maxSize = bytes
+}
+
+// LastChanged returns the time the value was last successfully set, or a zero Time if it was never set.
+func (d *DynProto3ListValue) LastChanged() time.Time {
+	return unixNanosToTime(atomic.LoadInt64(&d.lastChanged))
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynProto3ListValue) Type() string {
+	return "dyn_proto3_list_json"
+}
+
+// String returns the canonical string representation of the type.
+// In this case it returns a JSON array of the JSONPB representations of the messages, cached until the value changes.
+func (d *DynProto3ListValue) String() string {
+	p := atomic.LoadPointer(&d.ptr)
+	return d.stringCache.Get(p, func() string {
+		out := &bytes.Buffer{}
+		out.WriteString("[")
+		for i, msg := range *(*[]proto.Message)(p) {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			if err := marshalJSONMessage(out, d.anyResolver, msg); err != nil {
+				return "ERR"
+			}
+		}
+		out.WriteString("]")
+		return out.String()
+	})
+}
+
+// DynProto3Map creates a `Flag` that is backed by a map of string keys to Proto3-generated messages of the same type,
+// which is safe to change dynamically at runtime as a whole, e.g. per-tenant policies.
+// Inputs are JSON objects with JSONPB encoded message values, e.g. `{"tenant_a": {"some_string": "foo"}}`.
+// The `elem` must be a pointer to a generated message struct, and is only used for its type.
+func DynProto3Map(flagSet *flag.FlagSet, name string, elem proto.Message, value map[string]proto.Message, usage string) *DynProto3MapValue {
+	return DynProto3MapP(flagSet, name, "", elem, value, usage)
+}
+
+// DynProto3MapP is like DynProto3Map, but accepts a shorthand letter that can be used after a single dash.
+func DynProto3MapP(flagSet *flag.FlagSet, name string, shorthand string, elem proto.Message,
+	value map[string]proto.Message, usage string) *DynProto3MapValue {
+	dynValue := &DynProto3MapValue{ptr: unsafe.Pointer(&value), structType: messageStructType(elem)}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	flagz.MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynProto3MapValue is a flag-related map of proto3 messages value wrapper.
+type DynProto3MapValue struct {
+	lastChanged int64 // unix nanos, first to keep it 64-bit aligned for atomics.
+
+	structType      reflect.Type
+	ptr             unsafe.Pointer
+	setMu           sync.Mutex // serializes validating and storing new values in `Set`.
+	validator       func(map[string]proto.Message) error
+	validatorCtx    func(context.Context, map[string]proto.Message) error
+	notifier        func(oldValue map[string]proto.Message, newValue map[string]proto.Message)
+	notifierCtx     func(ctx context.Context, oldValue map[string]proto.Message, newValue map[string]proto.Message)
+	notifierTimeout time.Duration
+	anyResolver     AnyResolver
+	maxSize         int
+	stringCache     flagz.StringCache
+}
+
+// Get retrieves the value in a thread-safe manner.
+// The returned map and its messages are shared by all callers and must not be modified.
+func (d *DynProto3MapValue) Get() map[string]proto.Message {
+	p := (*map[string]proto.Message)(atomic.LoadPointer(&d.ptr))
+	return *p
+}
+
+// Set updates the value from a JSON object of JSONPB messages in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, or any of the messages doesn't pass its
+// protoc-gen-validate constraints, or the resulting map doesn't pass an optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynProto3MapValue) Set(input string) error {
+	if d.maxSize > 0 && len(input) > d.maxSize {
+		return &flagz.ParseError{Err: fmt.Errorf("value of %d bytes exceeds the maximum of %d bytes", len(input), d.maxSize)}
+	}
+	raws := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(input), &raws); err != nil {
+		return &flagz.ParseError{Err: err}
+	}
+	val := make(map[string]proto.Message, len(raws))
+	for key, raw := range raws {
+		msg, err := unmarshalJSONMessage(d.structType, d.anyResolver, raw)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", key, err)
+		}
+		val[key] = msg
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(val); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, val) }
+		if err := flagz.RunValidatorCtx(d, validate); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&val))
+	atomic.StoreInt64(&d.lastChanged, time.Now().UnixNano())
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := *(*map[string]proto.Message)(oldPtr)
+		if d.notifier != nil {
+			flagz.RunNotifier(func() { d.notifier(oldVal, val) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, val) }
+			flagz.RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynProto3MapValue) WithValidator(validator func(map[string]proto.Message) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and `flagz.UpdateInfo` of the update (see `flagz.SetFlagFromSourceCtx`), e.g. for bounded
+// external checks.
+func (d *DynProto3MapValue) WithValidatorCtx(
+	validator func(ctx context.Context, value map[string]proto.Message) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `flagz.ValidateAll`.
+func (d *DynProto3MapValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := flagz.RunValidatorCtx(d, validate); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `flagz.SetNotifierPool`.
+func (d *DynProto3MapValue) WithNotifier(notifier func(oldValue map[string]proto.Message, newValue map[string]proto.Message)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `flagz.RunNotifierCtx`.
+func (d *DynProto3MapValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue map[string]proto.Message, newValue map[string]proto.Message),
+	timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// WithAnyResolver sets the resolver of the types of `google.protobuf.Any` fields, see `DynProto3Value.WithAnyResolver`.
+func (d *DynProto3MapValue) WithAnyResolver(resolver AnyResolver) {
+	d.anyResolver = resolver
+}
+
+// WithMaxSize rejects inputs longer than `bytes` before they're parsed.
+func (d *DynProto3MapValue) WithMaxSize(bytes int) {
+	d.maxSize = bytes
+}
+
+// LastChanged returns the time the value was last successfully set, or a zero Time if it was never set.
+func (d *DynProto3MapValue) LastChanged() time.Time {
+	return unixNanosToTime(atomic.LoadInt64(&d.lastChanged))
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynProto3MapValue) Type() string {
+	return "dyn_proto3_map_json"
+}
+
+// String returns the canonical string representation of the type.
+// In this case it returns a JSON object, ordered by key, of the JSONPB representations of the messages, cached until
+// the value changes.
+func (d *DynProto3MapValue) String() string {
+	p := atomic.LoadPointer(&d.ptr)
+	return d.stringCache.Get(p, func() string {
+		return marshalMessageMap(*(*map[string]proto.Message)(p), d.anyResolver)
+	})
+}
+
+func marshalMessageMap(val map[string]proto.Message, resolver AnyResolver) string {
+	keys := make([]string, 0, len(val))
+	for key := range val {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := &bytes.Buffer{}
+	out.WriteString("{")
+	for i, key := range keys {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		encodedKey, _ := json.Marshal(key)
+		out.Write(encodedKey)
+		out.WriteString(":")
+		if err := marshalJSONMessage(out, resolver, val[key]); err != nil {
+			return "ERR"
+		}
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+func messageStructType(elem proto.Message) reflect.Type {
+	reflectVal := reflect.ValueOf(elem)
+	if reflectVal.Kind() != reflect.Ptr || reflectVal.Elem().Kind() != reflect.Struct {
+		panic("DynProto3 element must be a pointer to a struct")
+	}
+	return reflectVal.Type().Elem()
+}
+
+func unmarshalJSONMessage(structType reflect.Type, resolver AnyResolver, raw []byte) (proto.Message, error) {
+	msg := reflect.New(structType).Interface().(proto.Message)
+	if err := (protojson.UnmarshalOptions{Resolver: resolver}).Unmarshal(raw, msg); err != nil {
+		return nil, &flagz.ParseError{Err: err}
+	}
+	if v, ok := msg.(pgvValidator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, &flagz.ValidationError{Err: err}
+		}
+	}
+	return msg, nil
+}
+
+func marshalJSONMessage(out *bytes.Buffer, resolver AnyResolver, msg proto.Message) error {
+	encoded, err := protojson.MarshalOptions{UseProtoNames: true, Resolver: resolver}.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	// protojson randomizes its whitespace, compact it for a stable representation.
+	return json.Compact(out, encoded)
+}
+
+func unixNanosToTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
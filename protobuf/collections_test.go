@@ -0,0 +1,98 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package protoflagz
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/protobuf/testdata"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDynProto3Constructors_AcceptShorthands(t *testing.T) {
+	set := flag.NewFlagSet("shorthand", flag.ContinueOnError)
+	msg := DynProto3P(set, "some_proto3", "p", defaultProto3, "Use it or lose it")
+	list := DynProto3ListP(set, "some_list", "l", &mwitkow_testproto.SomeMsg{}, nil, "Use it or lose it")
+	byKey := DynProto3MapP(set, "some_map", "m", &mwitkow_testproto.SomeMsg{}, nil, "Use it or lose it")
+	require.NoError(t, set.Parse([]string{"-p", someProto3JsonPbValue, "-l", "[" + someProto3JsonPbValue + "]",
+		"-m", `{"foo": ` + someProto3JsonPbValue + "}"}))
+	assertProtoEqual(t, someProto3Expected, msg.Get(), "the message must be set through its shorthand")
+	require.Len(t, list.Get(), 1)
+	assertProtoEqual(t, someProto3Expected, list.Get()[0], "the list must be set through its shorthand")
+	assertProtoEqual(t, someProto3Expected, byKey.Get()["foo"], "the map must be set through its shorthand")
+	for _, shorthand := range []string{"p", "l", "m"} {
+		assert.True(t, flagz.IsFlagDynamic(set.ShorthandLookup(shorthand)), "shorthand variants must be dynamic")
+	}
+}
+
+func TestDynProto3List_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3List(set, "some_list", &mwitkow_testproto.SomeMsg{}, []proto.Message{defaultProto3}, "Use it or lose it")
+	assert.True(t, flagz.IsFlagDynamic(set.Lookup("some_list")))
+	require.Len(t, dynFlag.Get(), 1)
+	assertProtoEqual(t, defaultProto3, dynFlag.Get()[0], "value must be default after create")
+
+	err := set.Set("some_list", "["+someProto3JsonPbValue+`, {"some_string": "second"}]`)
+	require.NoError(t, err, "setting value must succeed")
+	require.Len(t, dynFlag.Get(), 2)
+	assertProtoEqual(t, someProto3Expected, dynFlag.Get()[0], "first element must be set")
+	assert.Equal(t, "second", dynFlag.Get()[1].(*mwitkow_testproto.SomeMsg).SomeString)
+	assert.Equal(t, `[{"some_string":"wolololo","some_enum":"OPT_2","some_map":{"foo":1337}},{"some_string":"second"}]`, dynFlag.String())
+	assert.False(t, dynFlag.LastChanged().IsZero())
+
+	assert.Error(t, set.Set("some_list", `[{"some_string": "ok"}, {"no_such_field": 1}]`), "bad elements must be rejected")
+	assert.Len(t, dynFlag.Get(), 2, "rejected values must not be stored")
+}
+
+func TestDynProto3List_ValidatesElements(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3List(set, "some_list", &mwitkow_testproto.PrefixMatcher{}, []proto.Message{}, "Use it or lose it")
+	dynFlag.WithValidator(func(val []proto.Message) error {
+		if len(val) > 2 {
+			return fmt.Errorf("too many matchers")
+		}
+		return nil
+	})
+	assert.Error(t, dynFlag.Set(`[{"prefix": "ok"}, {"prefix": ""}]`), "protoc-gen-validate constraints must be checked for every element")
+	assert.Error(t, dynFlag.Set(`[{"prefix": "a"}, {"prefix": "b"}, {"prefix": "c"}]`), "validator must be checked")
+	assert.NoError(t, dynFlag.Set(`[{"prefix": "a"}, {"prefix": "b"}]`))
+}
+
+func TestDynProto3Map_SetAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3Map(set, "some_map", &mwitkow_testproto.SomeMsg{}, map[string]proto.Message{"default": defaultProto3}, "Use it or lose it")
+	assertProtoEqual(t, defaultProto3, dynFlag.Get()["default"], "value must be default after create")
+
+	err := set.Set("some_map", `{"b": {"some_string": "second"}, "a": `+someProto3JsonPbOrigValue+`}`)
+	require.NoError(t, err, "setting value must succeed")
+	require.Len(t, dynFlag.Get(), 2)
+	assertProtoEqual(t, someProto3Expected, dynFlag.Get()["a"], "values must be set")
+	assert.Equal(t, `{"a":{"some_string":"wolololo","some_enum":"OPT_2","some_map":{"foo":1337}},"b":{"some_string":"second"}}`, dynFlag.String(), "keys must be ordered")
+
+	assert.Error(t, set.Set("some_map", `{"a": ["not", "a", "message"]}`), "bad values must be rejected")
+	assert.Len(t, dynFlag.Get(), 2, "rejected values must not be stored")
+}
+
+func TestDynProto3Map_Notifier(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	waitCh := make(chan bool, 1)
+	dynFlag := DynProto3Map(set, "some_map", &mwitkow_testproto.SomeMsg{}, map[string]proto.Message{}, "Use it or lose it")
+	dynFlag.WithNotifier(func(oldVal map[string]proto.Message, newVal map[string]proto.Message) {
+		assert.Len(t, oldVal, 0)
+		assert.Len(t, newVal, 1)
+		waitCh <- true
+	})
+	require.NoError(t, dynFlag.Set(`{"a": {}}`))
+	select {
+	case <-time.After(5 * time.Millisecond):
+		assert.Fail(t, "failed to trigger notifier")
+	case <-waitCh:
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package protoflagz
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	flag "github.com/spf13/pflag"
+	"google.golang.org/protobuf/proto"
+)
+
+// DynProto3FromFile creates a DynProto3 flag whose default value is read from the file at `path`, so that large
+// default configs can live in reviewed files rather than Go literals. The format is picked by the file extension:
+// `.json` for JSONPB, `.textpb`, `.txtpb`, `.pbtxt` or `.textproto` for the proto text format.
+// The `value` is only used as the type of the message.
+func DynProto3FromFile(flagSet *flag.FlagSet, name string, value proto.Message, path string, usage string) (*DynProto3Value, error) {
+	var format Format
+	switch filepath.Ext(path) {
+	case ".json":
+		format = FormatJSON
+	case ".textpb", ".txtpb", ".pbtxt", ".textproto":
+		format = FormatText
+	default:
+		return nil, fmt.Errorf("protoflagz: unknown format of default file %v", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DynProto3FromBytes(flagSet, name, value, format, data, usage)
+}
+
+// DynProto3FromBytes creates a DynProto3 flag whose default value is decoded from `data` in the given format, e.g.
+// a file embedded in the binary. The `value` is only used as the type of the message.
+func DynProto3FromBytes(flagSet *flag.FlagSet, name string, value proto.Message, format Format, data []byte, usage string) (*DynProto3Value, error) {
+	decoder := &DynProto3Value{defaultFormat: format}
+	defaultValue := value.ProtoReflect().New().Interface()
+	if err := decoder.unmarshal(string(data), defaultValue); err != nil {
+		return nil, fmt.Errorf("protoflagz: bad default value of flag %v: %v", name, err)
+	}
+	if v, ok := defaultValue.(pgvValidator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, fmt.Errorf("protoflagz: bad default value of flag %v: %v", name, err)
+		}
+	}
+	return DynProto3(flagSet, name, defaultValue, usage), nil
+}
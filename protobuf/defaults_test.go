@@ -0,0 +1,39 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package protoflagz
+
+import (
+	"testing"
+
+	"github.com/mwitkow/go-flagz/protobuf/testdata"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynProto3FromFile(t *testing.T) {
+	for _, path := range []string{"testdata/defaults/some_msg.textpb", "testdata/defaults/some_msg.json"} {
+		set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+		dynFlag, err := DynProto3FromFile(set, "some_proto3_1", &mwitkow_testproto.SomeMsg{}, path, "Use it or lose it")
+		require.NoError(t, err, "reading defaults from %v must succeed", path)
+		assertProtoEqual(t, someProto3Expected, dynFlag.Get(), "default must be read from "+path)
+		assert.Equal(t, dynFlag.String(), set.Lookup("some_proto3_1").DefValue, "default must be reflected in the flag")
+	}
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	_, err := DynProto3FromFile(set, "some_proto3_1", &mwitkow_testproto.SomeMsg{}, "testdata/defaults/missing.json", "")
+	assert.Error(t, err, "missing files must fail")
+	_, err = DynProto3FromFile(set, "some_proto3_1", &mwitkow_testproto.SomeMsg{}, "testdata/test_proto3.proto", "")
+	assert.Error(t, err, "unknown extensions must fail")
+	assert.Nil(t, set.Lookup("some_proto3_1"), "failed flags must not be registered")
+}
+
+func TestDynProto3FromBytes(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	_, err := DynProto3FromBytes(set, "some_matcher", &mwitkow_testproto.PrefixMatcher{}, FormatJSON, []byte(`{"prefix": ""}`), "")
+	assert.Error(t, err, "defaults must pass generated constraints")
+	dynFlag, err := DynProto3FromBytes(set, "some_matcher", &mwitkow_testproto.PrefixMatcher{}, FormatText, []byte(`prefix: "/api"`), "")
+	require.NoError(t, err)
+	assert.Equal(t, "/api", dynFlag.Get().(*mwitkow_testproto.PrefixMatcher).Prefix)
+}
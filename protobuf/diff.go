@@ -0,0 +1,77 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package protoflagz
+
+import (
+	"bytes"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ChangedFieldPaths returns the paths of fields (e.g. `tls.cert_file`) that differ between two messages of the same
+// type, in field number order. Singular message fields are compared field by field, while repeated and map fields are
+// reported as a whole.
+func ChangedFieldPaths(oldValue proto.Message, newValue proto.Message) []string {
+	paths := []string{}
+	diffMessages("", oldValue.ProtoReflect(), newValue.ProtoReflect(), &paths)
+	return paths
+}
+
+func diffMessages(prefix string, a protoreflect.Message, b protoreflect.Message, paths *[]string) {
+	fields := a.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		path := prefix + string(fd.Name())
+		hasA, hasB := a.Has(fd), b.Has(fd)
+		if !hasA && !hasB {
+			continue
+		}
+		if fd.Message() != nil && !fd.IsList() && !fd.IsMap() && hasA && hasB {
+			diffMessages(path+".", a.Get(fd).Message(), b.Get(fd).Message(), paths)
+			continue
+		}
+		if hasA != hasB || !fieldValuesEqual(fd, a.Get(fd), b.Get(fd)) {
+			*paths = append(*paths, path)
+		}
+	}
+}
+
+func fieldValuesEqual(fd protoreflect.FieldDescriptor, a protoreflect.Value, b protoreflect.Value) bool {
+	switch {
+	case fd.IsList():
+		la, lb := a.List(), b.List()
+		if la.Len() != lb.Len() {
+			return false
+		}
+		for i := 0; i < la.Len(); i++ {
+			if !singularValuesEqual(fd, la.Get(i), lb.Get(i)) {
+				return false
+			}
+		}
+		return true
+	case fd.IsMap():
+		ma, mb := a.Map(), b.Map()
+		if ma.Len() != mb.Len() {
+			return false
+		}
+		equal := true
+		ma.Range(func(key protoreflect.MapKey, va protoreflect.Value) bool {
+			equal = mb.Has(key) && singularValuesEqual(fd.MapValue(), va, mb.Get(key))
+			return equal
+		})
+		return equal
+	}
+	return singularValuesEqual(fd, a, b)
+}
+
+func singularValuesEqual(fd protoreflect.FieldDescriptor, a protoreflect.Value, b protoreflect.Value) bool {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return proto.Equal(a.Message().Interface(), b.Message().Interface())
+	case protoreflect.BytesKind:
+		return bytes.Equal(a.Bytes(), b.Bytes())
+	}
+	return a.Interface() == b.Interface()
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package protoflagz
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz/protobuf/testdata"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestChangedFieldPaths(t *testing.T) {
+	assert.Empty(t, ChangedFieldPaths(defaultProto3, proto.Clone(defaultProto3)), "equal messages must have no changes")
+	assert.Equal(t, []string{"some_string", "some_enum", "some_map"}, ChangedFieldPaths(defaultProto3, someProto3Expected))
+
+	changedMap := proto.Clone(defaultProto3).(*mwitkow_testproto.SomeMsg)
+	changedMap.SomeMap["one"] = 2
+	assert.Equal(t, []string{"some_map"}, ChangedFieldPaths(defaultProto3, changedMap), "maps must be compared by value")
+
+	policy := &mwitkow_testproto.SomePolicy{Name: "foo"}
+	withMatcher := &mwitkow_testproto.SomePolicy{Name: "foo", Matcher: &anypb.Any{TypeUrl: "type.example.com/a"}}
+	assert.Equal(t, []string{"matcher"}, ChangedFieldPaths(policy, withMatcher), "set messages must be reported whole")
+	otherMatcher := &mwitkow_testproto.SomePolicy{Name: "foo", Matcher: &anypb.Any{TypeUrl: "type.example.com/b"}}
+	assert.Equal(t, []string{"matcher.type_url"}, ChangedFieldPaths(withMatcher, otherMatcher), "nested messages must be diffed by field")
+}
+
+func TestDynProto3_FiresDiffNotifier(t *testing.T) {
+	waitCh := make(chan []string, 1)
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
+	dynFlag.WithDiffNotifier(func(oldVal proto.Message, newVal proto.Message, changedPaths []string) {
+		assertProtoEqual(t, defaultProto3, oldVal, "old value in notify must match previous value")
+		waitCh <- changedPaths
+	})
+	require.NoError(t, set.Set("some_proto3_1", `{"some_string": "somevalue", "some_map": {"one": 1}, "some_enum": "OPT_2"}`))
+	select {
+	case <-time.After(50 * time.Millisecond):
+		assert.Fail(t, "failed to trigger diff notifier")
+	case changedPaths := <-waitCh:
+		assert.Equal(t, []string{"some_enum"}, changedPaths, "only the changed fields must be passed")
+	}
+}
@@ -4,70 +4,180 @@
 package protoflagz
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
 	"reflect"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"strings"
 
-	"github.com/golang/protobuf/jsonpb"
-	"github.com/golang/protobuf/proto"
 	"github.com/mwitkow/go-flagz"
 	flag "github.com/spf13/pflag"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
+// Format is an encoding of DynProto3 values accepted by `Set`.
+type Format int
+
+const (
+	// FormatAuto picks the format of each input, see `AutoFormat`.
+	FormatAuto Format = iota
+	// FormatJSON is the JSONPB encoding, accepting both original and JSON field names.
+	FormatJSON
+	// FormatText is the proto text format.
+	FormatText
+	// FormatBinary is the binary proto encoding.
+	FormatBinary
+	// FormatBase64Binary is the standard base64 encoding of the binary proto encoding.
+	FormatBase64Binary
+)
+
+const (
+	// JSONPrefix marks `Set` inputs in the JSONPB encoding, e.g. `json:{"some_string": "foo"}`.
+	JSONPrefix = "json:"
+	// TextFormatPrefix marks `Set` inputs in the proto text format, e.g. `textpb:some_string: "foo"`.
+	TextFormatPrefix = "textpb:"
+	// Base64BinaryPrefix marks `Set` inputs in base64 encoded binary proto encoding, e.g. `b64pb:CgNmb28=`.
+	Base64BinaryPrefix = "b64pb:"
+)
+
+var formatPrefixes = []struct {
+	prefix string
+	format Format
+}{
+	{JSONPrefix, FormatJSON},
+	{TextFormatPrefix, FormatText},
+	{Base64BinaryPrefix, FormatBase64Binary},
+}
+
+// AutoFormat returns the format FormatAuto picks for `input`: FormatJSON for inputs enclosed in braces, FormatBinary
+// for all others.
+func AutoFormat(input string) Format {
+	if trimmed := strings.TrimSpace(input); strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}") {
+		return FormatJSON
+	}
+	return FormatBinary
+}
+
+// AnyResolver resolves the types of `google.protobuf.Any` fields and extensions, e.g. `protoregistry.GlobalTypes` or an
+// `AnyRegistry`.
+type AnyResolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
 // DynProto3 creates a `Flag` that is backed by an arbitrary Proto3-generated datastructure which is safe to change
-// dynamically at runtime either through JSONPB encoding or Proto encoding.
-// The `value` must be a pointer to a struct that is JSONPB/Proto (un)marshallable.
+// dynamically at runtime. Inputs are in the format marked by their prefix (`json:`, `textpb:` or `b64pb:`), or
+// without one in the default format, which is FormatAuto (JSONPB or binary) unless changed with `WithDefaultFormat`.
+// The `value` must be a pointer to a generated message struct.
 // New values based on the default constructor of `value` type will be created on each update.
 func DynProto3(flagSet *flag.FlagSet, name string, value proto.Message, usage string) *DynProto3Value {
+	return DynProto3P(flagSet, name, "", value, usage)
+}
+
+// DynProto3P is like DynProto3, but accepts a shorthand letter that can be used after a single dash.
+func DynProto3P(flagSet *flag.FlagSet, name string, shorthand string, value proto.Message, usage string) *DynProto3Value {
 	reflectVal := reflect.ValueOf(value)
 	if reflectVal.Kind() != reflect.Ptr || reflectVal.Elem().Kind() != reflect.Struct {
 		panic("DynJSON value must be a pointer to a struct")
 	}
-	dynValue := &DynProto3Value{ptr: unsafe.Pointer(reflectVal.Pointer()), structType: reflectVal.Type().Elem()}
-	flag := flagSet.VarPF(dynValue, name, "", usage)
+	dynValue := &DynProto3Value{ptr: unsafe.Pointer(&storedMessage{msg: value}), structType: reflectVal.Type().Elem()}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
 	flagz.MarkFlagDynamic(flag)
 	return dynValue
 }
 
 // DynJSONValue is a flag-related JSON struct value wrapper.
 type DynProto3Value struct {
-	structType reflect.Type
-	ptr        unsafe.Pointer
-	validator  func(proto.Message) error
-	notifier   func(oldValue proto.Message, newValue proto.Message)
+	lastChanged int64 // unix nanos, first to keep it 64-bit aligned for atomics.
+
+	structType      reflect.Type
+	ptr             unsafe.Pointer // *storedMessage
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`.
+	validator       func(proto.Message) error
+	validatorCtx    func(context.Context, proto.Message) error
+	notifier        func(oldValue proto.Message, newValue proto.Message)
+	notifierCtx     func(ctx context.Context, oldValue proto.Message, newValue proto.Message)
+	notifierTimeout time.Duration
+	diffNotifier    func(oldValue proto.Message, newValue proto.Message, changedPaths []string)
+	anyResolver     AnyResolver
+	defaultFormat   Format
+	strictUnknown   bool
+	maxSize         int
+
+	stringCache flagz.StringCache
+	prettyCache flagz.StringCache
 }
 
 // Get retrieves the value in its original JSON struct type in a thread-safe manner.
+// The returned message is shared by all callers and must not be modified, use `GetCopy` for that.
 func (d *DynProto3Value) Get() proto.Message {
-	return d.unsafeToStoredType(atomic.LoadPointer(&d.ptr)).(proto.Message)
+	return (*storedMessage)(atomic.LoadPointer(&d.ptr)).msg
+}
+
+// GetCopy retrieves a deep copy of the value in a thread-safe manner, which the caller may freely modify.
+func (d *DynProto3Value) GetCopy() proto.Message {
+	return proto.Clone(d.Get())
 }
 
 // Set updates the value from a string representation in a thread-safe manner.
-// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass an
-// optional validator.
+// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass its
+// protoc-gen-validate constraints (if the message has a generated `Validate` method) or an optional validator.
 // If a notifier is set on the value, it will be invoked in a separate go-routine.
 func (d *DynProto3Value) Set(input string) error {
+	if d.maxSize > 0 && len(input) > d.maxSize {
+		return &flagz.ParseError{Err: fmt.Errorf("value of %d bytes exceeds the maximum of %d bytes", len(input), d.maxSize)}
+	}
 	someStruct := reflect.New(d.structType).Interface().(proto.Message)
-	if strings.HasPrefix(strings.TrimSpace(input), "{") && strings.HasSuffix(strings.TrimSpace(input), "}") {
-		if err := jsonpb.UnmarshalString(input, someStruct); err != nil {
-			return err
-		}
-	} else {
-		if err := proto.Unmarshal([]byte(input), someStruct); err != nil {
-			return err
+	if err := d.unmarshal(input, someStruct); err != nil {
+		return &flagz.ParseError{Err: err}
+	}
+	if d.strictUnknown {
+		if err := checkNoUnknownFields("", someStruct.ProtoReflect()); err != nil {
+			return &flagz.ParseError{Err: err}
 		}
 	}
 
+	if v, ok := someStruct.(pgvValidator); ok {
+		if err := v.Validate(); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
 	if d.validator != nil {
 		if err := d.validator(someStruct); err != nil {
-			return err
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, someStruct) }
+		if err := flagz.RunValidatorCtx(d, validate); err != nil {
+			return &flagz.ValidationError{Err: err}
 		}
 	}
-	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(reflect.ValueOf(someStruct).Pointer()))
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&storedMessage{msg: someStruct}))
+	atomic.StoreInt64(&d.lastChanged, time.Now().UnixNano())
+	oldValue := (*storedMessage)(oldPtr).msg
 	if d.notifier != nil {
-		go d.notifier(d.unsafeToStoredType(oldPtr).(proto.Message), someStruct)
+		flagz.RunNotifier(func() { d.notifier(oldValue, someStruct) })
+	}
+	if d.notifierCtx != nil {
+		notify := func(ctx context.Context) { d.notifierCtx(ctx, oldValue, someStruct) }
+		flagz.RunNotifierCtx(d, d.notifierTimeout, notify)
+	}
+	if d.diffNotifier != nil {
+		flagz.RunNotifier(func() {
+			d.diffNotifier(oldValue, someStruct, ChangedFieldPaths(oldValue, someStruct))
+		})
 	}
 	return nil
 }
@@ -79,12 +189,91 @@ func (d *DynProto3Value) WithValidator(validator func(proto.Message) error) {
 	d.validator = validator
 }
 
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and `flagz.UpdateInfo` of the update (see `flagz.SetFlagFromSourceCtx`), e.g. for bounded
+// external checks.
+func (d *DynProto3Value) WithValidatorCtx(validator func(ctx context.Context, value proto.Message) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `flagz.ValidateAll`.
+func (d *DynProto3Value) Validate() error {
+	if v, ok := d.Get().(pgvValidator); ok {
+		if err := v.Validate(); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := flagz.RunValidatorCtx(d, validate); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
 // WithNotifier adds a function is called every time a new value is successfully set.
-// Each notifier is executed in a new go-routine.
+// Each notifier is executed in a new go-routine, or on the pool set with `flagz.SetNotifierPool`.
 func (d *DynProto3Value) WithNotifier(notifier func(oldValue proto.Message, newValue proto.Message)) {
 	d.notifier = notifier
 }
 
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `flagz.RunNotifierCtx`.
+func (d *DynProto3Value) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue proto.Message, newValue proto.Message), timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// WithDiffNotifier adds a function that is called every time a new value is successfully set, with the paths of the
+// fields that changed (see `ChangedFieldPaths`), so it can react only to changes it cares about.
+// Each notifier is executed in a new go-routine, or on the pool set with `flagz.SetNotifierPool`.
+func (d *DynProto3Value) WithDiffNotifier(notifier func(oldValue proto.Message, newValue proto.Message, changedPaths []string)) {
+	d.diffNotifier = notifier
+}
+
+// WithStrictUnknownFields rejects inputs with fields unknown to the message type in every format, so typos and values
+// meant for newer binaries are caught (and e.g. rolled back by the etcd watcher) rather than silently ignored.
+// JSONPB and text inputs with unknown fields are always rejected, this additionally rejects binary inputs, which
+// otherwise keep unknown fields.
+func (d *DynProto3Value) WithStrictUnknownFields() {
+	d.strictUnknown = true
+}
+
+// WithMaxSize rejects inputs longer than `bytes` before they're parsed, protecting memory and parsing time from
+// accidentally huge values.
+func (d *DynProto3Value) WithMaxSize(bytes int) {
+	d.maxSize = bytes
+}
+
+// WithDefaultFormat sets the format of `Set` inputs without a format prefix. Defaults to FormatAuto, which accepts
+// both the output of `String` and the binary encoding. Binary inputs enclosed in braces need the FormatBinary default.
+func (d *DynProto3Value) WithDefaultFormat(format Format) {
+	d.defaultFormat = format
+}
+
+// WithAnyResolver sets the resolver of the types of `google.protobuf.Any` fields and extensions in all input formats
+// and the JSONPB outputs, e.g. an `AnyRegistry`. By default types are resolved from `protoregistry.GlobalTypes`.
+func (d *DynProto3Value) WithAnyResolver(resolver AnyResolver) {
+	d.anyResolver = resolver
+}
+
+// LastChanged returns the time the value was last successfully set, or a zero Time if it was never set.
+func (d *DynProto3Value) LastChanged() time.Time {
+	nanos := atomic.LoadInt64(&d.lastChanged)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
 // Type is an indicator of what this flag represents.
 func (d *DynProto3Value) Type() string {
 	return "dyn_proto3_json"
@@ -92,27 +281,99 @@ func (d *DynProto3Value) Type() string {
 
 // PrettyString returns a nicely structured representation of the type.
 // In this case it returns a pretty-printed JSON.
+// The output is cached until the value changes.
 func (d *DynProto3Value) PrettyString() string {
-	m := &jsonpb.Marshaler{Indent: "  ", OrigName: true}
-	out, err := m.MarshalToString(d.Get())
-	if err != nil {
-		return "ERR"
-	}
-	return string(out)
+	p := atomic.LoadPointer(&d.ptr)
+	return d.prettyCache.Get(p, func() string {
+		m := protojson.MarshalOptions{Multiline: true, Indent: "  ", UseProtoNames: true, Resolver: d.anyResolver}
+		out, err := m.Marshal((*storedMessage)(p).msg)
+		if err != nil {
+			return "ERR"
+		}
+		return string(out)
+	})
 }
 
 // String returns the canonical string representation of the type.
-// In this case it returns the JSONPB representation of the object.
+// In this case it returns the JSONPB representation of the object, cached until the value changes.
 func (d *DynProto3Value) String() string {
-	m := &jsonpb.Marshaler{OrigName: true}
-	out, err := m.MarshalToString(d.Get())
-	if err != nil {
-		return "ERR"
+	p := atomic.LoadPointer(&d.ptr)
+	return d.stringCache.Get(p, func() string {
+		m := protojson.MarshalOptions{UseProtoNames: true, Resolver: d.anyResolver}
+		out, err := m.Marshal((*storedMessage)(p).msg)
+		if err != nil {
+			return "ERR"
+		}
+		return string(out)
+	})
+}
+
+func (d *DynProto3Value) unmarshal(input string, msg proto.Message) error {
+	format := d.defaultFormat
+	for _, p := range formatPrefixes {
+		if strings.HasPrefix(input, p.prefix) {
+			format = p.format
+			input = strings.TrimPrefix(input, p.prefix)
+			break
+		}
+	}
+	if format == FormatAuto {
+		format = AutoFormat(input)
 	}
-	return string(out)
+	switch format {
+	case FormatJSON:
+		return protojson.UnmarshalOptions{Resolver: d.anyResolver}.Unmarshal([]byte(input), msg)
+	case FormatText:
+		return prototext.UnmarshalOptions{Resolver: d.anyResolver}.Unmarshal([]byte(input), msg)
+	case FormatBinary:
+		return proto.UnmarshalOptions{Resolver: d.anyResolver}.Unmarshal([]byte(input), msg)
+	case FormatBase64Binary:
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(input))
+		if err != nil {
+			return err
+		}
+		return proto.UnmarshalOptions{Resolver: d.anyResolver}.Unmarshal(raw, msg)
+	}
+	return fmt.Errorf("protoflagz: unknown format %v", format)
+}
+
+func checkNoUnknownFields(prefix string, m protoreflect.Message) error {
+	if len(m.GetUnknown()) > 0 && prefix == "" {
+		return fmt.Errorf("protoflagz: unknown fields in %v", m.Descriptor().FullName())
+	} else if len(m.GetUnknown()) > 0 {
+		return fmt.Errorf("protoflagz: unknown fields in field %v", strings.TrimSuffix(prefix, "."))
+	}
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		path := prefix + string(fd.Name()) + "."
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+					err = checkNoUnknownFields(path, mv.Message())
+					return err == nil
+				})
+			}
+		case fd.IsList():
+			if fd.Message() != nil {
+				for i := 0; i < v.List().Len() && err == nil; i++ {
+					err = checkNoUnknownFields(path, v.List().Get(i).Message())
+				}
+			}
+		case fd.Message() != nil:
+			err = checkNoUnknownFields(path, v.Message())
+		}
+		return err == nil
+	})
+	return err
+}
+
+// pgvValidator is implemented by messages with constraints generated by protoc-gen-validate.
+type pgvValidator interface {
+	Validate() error
 }
 
-func (d *DynProto3Value) unsafeToStoredType(p unsafe.Pointer) interface{} {
-	n := reflect.NewAt(d.structType, p)
-	return n.Interface()
+// storedMessage boxes the stored message, so that reads are an atomic pointer load without any reflection.
+type storedMessage struct {
+	msg proto.Message
 }
@@ -4,17 +4,18 @@
 package protoflagz
 
 import (
+	"encoding/base64"
 	"testing"
 
 	"fmt"
 	"time"
 
-	"github.com/golang/protobuf/proto"
 	"github.com/mwitkow/go-flagz"
 	"github.com/mwitkow/go-flagz/protobuf/testdata"
 	flag "github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -38,32 +39,32 @@ func TestDynProto3_SetJSONPBAndGet(t *testing.T) {
 	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
 	dynFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
 
-	assert.EqualValues(t, defaultProto3, dynFlag.Get(), "value must be default after create")
+	assertProtoEqual(t, defaultProto3, dynFlag.Get(), "value must be default after create")
 
 	err := set.Set("some_proto3_1", someProto3JsonPbValue)
 	assert.NoError(t, err, "setting value using JSONPB names must succeed")
-	assert.EqualValues(t, someProto3Expected, dynFlag.Get(), "value must be set after update")
+	assertProtoEqual(t, someProto3Expected, dynFlag.Get(), "value must be set after update")
 
 	err = set.Set("some_proto3_1", someProto3JsonPbOrigValue)
 	assert.NoError(t, err, "setting value using original field namesmust succeed")
-	assert.EqualValues(t, someProto3Expected, dynFlag.Get(), "value must be set after update")
+	assertProtoEqual(t, someProto3Expected, dynFlag.Get(), "value must be set after update")
 }
 
 func TestDynProto3_SetJsonPBOrigNameAndGet(t *testing.T) {
 	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
 	dynFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
 
-	assert.EqualValues(t, defaultProto3, dynFlag.Get(), "value must be default after create")
+	assertProtoEqual(t, defaultProto3, dynFlag.Get(), "value must be default after create")
 
 	err := set.Set("some_proto3_1", someProto3JsonPbOrigValue)
 	assert.NoError(t, err, "setting value using original field namesmust succeed")
-	assert.EqualValues(t, someProto3Expected, dynFlag.Get(), "value must be set after update")
+	assertProtoEqual(t, someProto3Expected, dynFlag.Get(), "value must be set after update")
 }
 
 func TestDynProto3_SetProtoAndGet(t *testing.T) {
 	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
 	dynFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
-	assert.EqualValues(t, defaultProto3, dynFlag.Get(), "value must be default after create")
+	assertProtoEqual(t, defaultProto3, dynFlag.Get(), "value must be default after create")
 
 	//t.Logf("In test: %v", string(someProto3Proto))
 	something := &mwitkow_testproto.SomeMsg{}
@@ -71,7 +72,104 @@ func TestDynProto3_SetProtoAndGet(t *testing.T) {
 
 	err := set.Set("some_proto3_1", string(someProto3Proto))
 	assert.NoError(t, err, "setting value using proto3 binary encoding must succeed")
-	assert.EqualValues(t, someProto3Expected, dynFlag.Get(), "value must be set after update")
+	assertProtoEqual(t, someProto3Expected, dynFlag.Get(), "value must be set after update")
+}
+
+func TestDynProto3_SetWithFormatPrefixes(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
+	dynFlag.WithDefaultFormat(FormatBinary)
+
+	require.NoError(t, set.Set("some_proto3_1", JSONPrefix+someProto3JsonPbValue), "json: prefix must select JSONPB")
+	assertProtoEqual(t, someProto3Expected, dynFlag.Get(), "value must be set after update")
+
+	require.NoError(t, set.Set("some_proto3_1", Base64BinaryPrefix+base64.StdEncoding.EncodeToString(someProto3Proto)),
+		"b64pb: prefix must select base64 binary")
+	assertProtoEqual(t, someProto3Expected, dynFlag.Get(), "value must be set after update")
+
+	// binary proto starting with '{' (an empty group of unknown field 15) must not be mistaken for JSON.
+	braceProto, err := proto.Marshal(&mwitkow_testproto.SomeMsg{SomeString: "}"})
+	require.NoError(t, err)
+	braceProto = append([]byte{'{', '|'}, braceProto...)
+	require.NoError(t, set.Set("some_proto3_1", string(braceProto)), "binary input starting with a brace must parse as binary")
+	assert.Equal(t, "}", dynFlag.Get().(*mwitkow_testproto.SomeMsg).SomeString)
+}
+
+func TestDynProto3_SetTextFormatAndGet(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
+
+	err := set.Set("some_proto3_1", TextFormatPrefix+`some_string: "wolololo"
+some_enum: OPT_2
+some_map { key: "foo" value: 1337 }
+`)
+	assert.NoError(t, err, "setting value using proto text format must succeed")
+	assertProtoEqual(t, someProto3Expected, dynFlag.Get(), "value must be set after update")
+
+	assert.Error(t, set.Set("some_proto3_1", TextFormatPrefix+`no_such_field: 1`), "bad text format must be rejected")
+	assertProtoEqual(t, someProto3Expected, dynFlag.Get(), "value must not change after bad update")
+}
+
+func TestDynProto3_GetCopyIsIsolated(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
+	require.NoError(t, set.Set("some_proto3_1", someProto3JsonPbValue))
+
+	copied := dynFlag.GetCopy().(*mwitkow_testproto.SomeMsg)
+	assertProtoEqual(t, someProto3Expected, copied, "copy must equal the value")
+	copied.SomeString = "mutated"
+	copied.SomeMap["foo"] = 1
+	assertProtoEqual(t, someProto3Expected, dynFlag.Get(), "mutating the copy must not change the value")
+}
+
+func TestDynProto3_StringFollowsChanges(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
+	before := dynFlag.String()
+	assert.Equal(t, before, dynFlag.String(), "cached string must be stable")
+	assert.Contains(t, dynFlag.PrettyString(), `"somevalue"`)
+
+	require.NoError(t, dynFlag.Set(someProto3JsonPbValue))
+	assert.NotEqual(t, before, dynFlag.String(), "string must change with the value")
+	assert.Contains(t, dynFlag.String(), `"wolololo"`)
+	assert.Contains(t, dynFlag.PrettyString(), `"wolololo"`, "pretty string must change with the value")
+}
+
+func TestDynProto3_RejectsUnknownFields(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
+	assert.Error(t, set.Set("some_proto3_1", `{"some_strnig": "typo"}`), "unknown JSONPB fields must be rejected")
+
+	// field 15 is unknown to SomeMsg.
+	unknownProto := append([]byte{120, 1}, someProto3Proto...)
+	require.NoError(t, set.Set("some_proto3_1", Base64BinaryPrefix+base64.StdEncoding.EncodeToString(unknownProto)),
+		"unknown binary fields must be kept by default")
+	dynFlag.WithStrictUnknownFields()
+	assert.Error(t, set.Set("some_proto3_1", Base64BinaryPrefix+base64.StdEncoding.EncodeToString(unknownProto)),
+		"unknown binary fields must be rejected in strict mode")
+	assert.NoError(t, set.Set("some_proto3_1", Base64BinaryPrefix+base64.StdEncoding.EncodeToString(someProto3Proto)))
+}
+
+func TestDynProto3_RejectsOversizedInput(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
+	dynFlag.WithMaxSize(len(someProto3JsonPbValue))
+	assert.NoError(t, set.Set("some_proto3_1", someProto3JsonPbValue), "values within the limit must be accepted")
+	assert.Error(t, set.Set("some_proto3_1", someProto3JsonPbValue+" "), "oversized values must be rejected")
+}
+
+func TestDynProto3_ValidatesDefault(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
+	assert.NoError(t, dynFlag.Validate(), "values without a validator must pass")
+	dynFlag.WithValidator(func(msg proto.Message) error {
+		if msg.(*mwitkow_testproto.SomeMsg).SomeEnum != mwitkow_testproto.SomeEnum_OPT_2 {
+			return fmt.Errorf("only OPT_2 is allowed")
+		}
+		return nil
+	})
+	assert.Error(t, dynFlag.Validate(), "a default failing the validator must be reported")
+	assert.Error(t, flagz.ValidateAll(set), "a default failing the validator must be reported")
 }
 
 func TestDynProto3_IsMarkedDynamic(t *testing.T) {
@@ -100,11 +198,26 @@ func TestDynProto3_FiresValidators(t *testing.T) {
 	assert.Error(t, set.Set("some_proto3_1", `{}`), "error from validator when value out of range")
 }
 
+func TestDynProto3_EnforcesGeneratedValidate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	userValidatorCalled := false
+	dynFlag := DynProto3(set, "some_matcher", &mwitkow_testproto.PrefixMatcher{Prefix: "/"}, "Use it or lose it")
+	dynFlag.WithValidator(func(proto.Message) error {
+		userValidatorCalled = true
+		return nil
+	})
+
+	assert.Error(t, set.Set("some_matcher", `{"prefix": ""}`), "constraints of the generated Validate must be enforced")
+	assert.False(t, userValidatorCalled, "user validators must only see values passing the generated constraints")
+	assert.NoError(t, set.Set("some_matcher", `{"prefix": "/api"}`))
+	assert.True(t, userValidatorCalled, "user validators must still be called")
+}
+
 func TestDynProto3_FiresNotifier(t *testing.T) {
 	waitCh := make(chan bool, 1)
 	notifier := func(oldVal proto.Message, newVal proto.Message) {
-		assert.EqualValues(t, defaultProto3, oldVal, "old value in notify must match previous value")
-		assert.EqualValues(t, someProto3Expected, newVal, "new value in notify must match set value")
+		assertProtoEqual(t, defaultProto3, oldVal, "old value in notify must match previous value")
+		assertProtoEqual(t, someProto3Expected, newVal, "new value in notify must match set value")
 		waitCh <- true
 	}
 
@@ -117,3 +230,22 @@ func TestDynProto3_FiresNotifier(t *testing.T) {
 	case <-waitCh:
 	}
 }
+
+func assertProtoEqual(t *testing.T, expected proto.Message, actual proto.Message, msg string) {
+	assert.True(t, proto.Equal(expected, actual), "%v: expected %v, got %v", msg, expected, actual)
+}
+
+func TestDynProto3_GetDoesNotAllocate(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
+	assert.EqualValues(t, 0, testing.AllocsPerRun(100, func() { value.Get() }))
+}
+
+func Benchmark_Proto3_Dyn_Get(b *testing.B) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := DynProto3(set, "some_proto3_1", defaultProto3, "Use it or lose it")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = value.Get().(*mwitkow_testproto.SomeMsg).SomeString
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package gogoflagz provides dynamic flags backed by gogo/protobuf generated messages, which don't implement the
+// `google.golang.org/protobuf` APIs needed by `protoflagz.DynProto3`.
+//
+// Inputs are accepted in the same formats, selected by the same prefixes, as in `protoflagz`.
+
+package gogoflagz
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/protobuf"
+	flag "github.com/spf13/pflag"
+)
+
+// DynGogoProto creates a `Flag` that is backed by a gogo/protobuf generated message which is safe to change
+// dynamically at runtime, see `protoflagz.DynProto3` for the accepted inputs.
+// The `value` must be a pointer to a generated message struct.
+func DynGogoProto(flagSet *flag.FlagSet, name string, value proto.Message, usage string) *DynGogoProtoValue {
+	return DynGogoProtoP(flagSet, name, "", value, usage)
+}
+
+// DynGogoProtoP is like DynGogoProto, but accepts a shorthand letter that can be used after a single dash.
+func DynGogoProtoP(flagSet *flag.FlagSet, name string, shorthand string, value proto.Message, usage string) *DynGogoProtoValue {
+	reflectVal := reflect.ValueOf(value)
+	if reflectVal.Kind() != reflect.Ptr || reflectVal.Elem().Kind() != reflect.Struct {
+		panic("DynGogoProto value must be a pointer to a struct")
+	}
+	dynValue := &DynGogoProtoValue{ptr: unsafe.Pointer(&storedMessage{msg: value}), structType: reflectVal.Type().Elem()}
+	flag := flagSet.VarPF(dynValue, name, shorthand, usage)
+	flagz.MarkFlagDynamic(flag)
+	return dynValue
+}
+
+// DynGogoProtoValue is a flag-related gogo/protobuf message value wrapper.
+type DynGogoProtoValue struct {
+	lastChanged int64 // unix nanos, first to keep it 64-bit aligned for atomics.
+
+	structType      reflect.Type
+	ptr             unsafe.Pointer // *storedMessage
+	setMu           sync.Mutex     // serializes validating and storing new values in `Set`.
+	validator       func(proto.Message) error
+	validatorCtx    func(context.Context, proto.Message) error
+	notifier        func(oldValue proto.Message, newValue proto.Message)
+	notifierCtx     func(ctx context.Context, oldValue proto.Message, newValue proto.Message)
+	notifierTimeout time.Duration
+	defaultFormat   protoflagz.Format
+	maxSize         int
+}
+
+// Get retrieves the value in its original message type in a thread-safe manner.
+// The returned message is shared by all callers and must not be modified, use `GetCopy` for that.
+func (d *DynGogoProtoValue) Get() proto.Message {
+	return (*storedMessage)(atomic.LoadPointer(&d.ptr)).msg
+}
+
+// GetCopy retrieves a deep copy of the value in a thread-safe manner, which the caller may freely modify.
+func (d *DynGogoProtoValue) GetCopy() proto.Message {
+	return proto.Clone(d.Get())
+}
+
+// Set updates the value from a string representation in a thread-safe manner.
+// This operation may return an error if the provided `input` doesn't parse, or the resulting value doesn't pass an
+// optional validator.
+// If a notifier is set on the value, it will be invoked in a separate go-routine.
+func (d *DynGogoProtoValue) Set(input string) error {
+	if d.maxSize > 0 && len(input) > d.maxSize {
+		return &flagz.ParseError{Err: fmt.Errorf("value of %d bytes exceeds the maximum of %d bytes", len(input), d.maxSize)}
+	}
+	someStruct := reflect.New(d.structType).Interface().(proto.Message)
+	if err := d.unmarshal(input, someStruct); err != nil {
+		return &flagz.ParseError{Err: err}
+	}
+	d.setMu.Lock()
+	defer d.setMu.Unlock()
+	if d.validator != nil {
+		if err := d.validator(someStruct); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, someStruct) }
+		if err := flagz.RunValidatorCtx(d, validate); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	oldPtr := atomic.SwapPointer(&d.ptr, unsafe.Pointer(&storedMessage{msg: someStruct}))
+	atomic.StoreInt64(&d.lastChanged, time.Now().UnixNano())
+	if d.notifier != nil || d.notifierCtx != nil {
+		oldVal := (*storedMessage)(oldPtr).msg
+		if d.notifier != nil {
+			flagz.RunNotifier(func() { d.notifier(oldVal, someStruct) })
+		}
+		if d.notifierCtx != nil {
+			notify := func(ctx context.Context) { d.notifierCtx(ctx, oldVal, someStruct) }
+			flagz.RunNotifierCtx(d, d.notifierTimeout, notify)
+		}
+	}
+	return nil
+}
+
+// WithValidator adds a function that checks values before they're set.
+// Any error returned by the validator will lead to the value being rejected.
+// Validators are executed on the same go-routine as the call to `Set`.
+func (d *DynGogoProtoValue) WithValidator(validator func(proto.Message) error) {
+	d.validator = validator
+}
+
+// WithValidatorCtx adds a function that checks values before they're set, like `WithValidator`, with a context
+// carrying the deadline and `flagz.UpdateInfo` of the update (see `flagz.SetFlagFromSourceCtx`), e.g. for bounded
+// external checks.
+func (d *DynGogoProtoValue) WithValidatorCtx(validator func(ctx context.Context, value proto.Message) error) {
+	d.validatorCtx = validator
+}
+
+// Validate checks the current value against the validator, e.g. to make sure that the default passes it. See
+// `flagz.ValidateAll`.
+func (d *DynGogoProtoValue) Validate() error {
+	if d.validator != nil {
+		if err := d.validator(d.Get()); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	if d.validatorCtx != nil {
+		validate := func(ctx context.Context) error { return d.validatorCtx(ctx, d.Get()) }
+		if err := flagz.RunValidatorCtx(d, validate); err != nil {
+			return &flagz.ValidationError{Err: err}
+		}
+	}
+	return nil
+}
+
+// WithNotifier adds a function is called every time a new value is successfully set.
+// Each notifier is executed in a new go-routine, or on the pool set with `flagz.SetNotifierPool`.
+func (d *DynGogoProtoValue) WithNotifier(notifier func(oldValue proto.Message, newValue proto.Message)) {
+	d.notifier = notifier
+}
+
+// WithNotifierCtx adds a function called like the one of `WithNotifier`, with a context that is done once the
+// source of the update stops or after `timeout` if it is positive, see `flagz.RunNotifierCtx`.
+func (d *DynGogoProtoValue) WithNotifierCtx(
+	notifier func(ctx context.Context, oldValue proto.Message, newValue proto.Message), timeout time.Duration) {
+	d.notifierCtx = notifier
+	d.notifierTimeout = timeout
+}
+
+// WithMaxSize rejects inputs longer than `bytes` before they're parsed.
+func (d *DynGogoProtoValue) WithMaxSize(bytes int) {
+	d.maxSize = bytes
+}
+
+// WithDefaultFormat sets the format of `Set` inputs without a format prefix. Defaults to `protoflagz.FormatAuto`.
+func (d *DynGogoProtoValue) WithDefaultFormat(format protoflagz.Format) {
+	d.defaultFormat = format
+}
+
+// LastChanged returns the time the value was last successfully set, or a zero Time if it was never set.
+func (d *DynGogoProtoValue) LastChanged() time.Time {
+	nanos := atomic.LoadInt64(&d.lastChanged)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// Type is an indicator of what this flag represents.
+func (d *DynGogoProtoValue) Type() string {
+	return "dyn_proto3_json"
+}
+
+// PrettyString returns a nicely structured representation of the type.
+// In this case it returns a pretty-printed JSON.
+func (d *DynGogoProtoValue) PrettyString() string {
+	m := &jsonpb.Marshaler{Indent: "  ", OrigName: true}
+	out, err := m.MarshalToString(d.Get())
+	if err != nil {
+		return "ERR"
+	}
+	return out
+}
+
+// String returns the canonical string representation of the type.
+// In this case it returns the JSONPB representation of the object.
+func (d *DynGogoProtoValue) String() string {
+	m := &jsonpb.Marshaler{OrigName: true}
+	out, err := m.MarshalToString(d.Get())
+	if err != nil {
+		return "ERR"
+	}
+	return out
+}
+
+func (d *DynGogoProtoValue) unmarshal(input string, msg proto.Message) error {
+	format := d.defaultFormat
+	for prefix, prefixFormat := range map[string]protoflagz.Format{
+		protoflagz.JSONPrefix:         protoflagz.FormatJSON,
+		protoflagz.TextFormatPrefix:   protoflagz.FormatText,
+		protoflagz.Base64BinaryPrefix: protoflagz.FormatBase64Binary,
+	} {
+		if strings.HasPrefix(input, prefix) {
+			format = prefixFormat
+			input = strings.TrimPrefix(input, prefix)
+			break
+		}
+	}
+	if format == protoflagz.FormatAuto {
+		format = protoflagz.AutoFormat(input)
+	}
+	switch format {
+	case protoflagz.FormatJSON:
+		return jsonpb.Unmarshal(bytes.NewReader([]byte(input)), msg)
+	case protoflagz.FormatText:
+		return proto.UnmarshalText(input, msg)
+	case protoflagz.FormatBinary:
+		return proto.Unmarshal([]byte(input), msg)
+	case protoflagz.FormatBase64Binary:
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(input))
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(raw, msg)
+	}
+	return fmt.Errorf("gogoflagz: unknown format %v", format)
+}
+
+// storedMessage boxes the stored message, so that reads are an atomic pointer load without any reflection.
+type storedMessage struct {
+	msg proto.Message
+}
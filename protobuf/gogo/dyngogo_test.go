@@ -0,0 +1,70 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package gogoflagz
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/protobuf"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMsg mimics a gogo/protobuf generated message, which only implements the legacy message interface.
+type testMsg struct {
+	SomeString string           `protobuf:"bytes,1,opt,name=some_string,json=someString,proto3" json:"some_string,omitempty"`
+	SomeInts   []int64          `protobuf:"varint,2,rep,packed,name=some_ints,json=someInts,proto3" json:"some_ints,omitempty"`
+	SomeMap    map[string]int32 `protobuf:"bytes,3,rep,name=some_map,json=someMap,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3" json:"some_map,omitempty"`
+}
+
+func (m *testMsg) Reset()         { *m = testMsg{} }
+func (m *testMsg) String() string { return proto.CompactTextString(m) }
+func (*testMsg) ProtoMessage()    {}
+
+var (
+	defaultMsg  = &testMsg{SomeString: "default"}
+	expectedMsg = &testMsg{SomeString: "wolololo", SomeInts: []int64{1, 2}, SomeMap: map[string]int32{"foo": 1337}}
+)
+
+func TestDynGogoProto_SetAllFormats(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynGogoProto(set, "some_gogo", defaultMsg, "Use it or lose it")
+	assert.True(t, flagz.IsFlagDynamic(set.Lookup("some_gogo")))
+	assert.EqualValues(t, defaultMsg, dynFlag.Get(), "value must be default after create")
+
+	require.NoError(t, set.Set("some_gogo", `{"someString": "wolololo", "some_ints": [1, 2], "someMap": {"foo": 1337}}`))
+	assert.EqualValues(t, expectedMsg, dynFlag.Get(), "JSONPB must be accepted by default")
+
+	require.NoError(t, set.Set("some_gogo", protoflagz.TextFormatPrefix+`some_string: "text"`))
+	assert.Equal(t, "text", dynFlag.Get().(*testMsg).SomeString, "text format must be accepted")
+
+	raw, err := proto.Marshal(expectedMsg)
+	require.NoError(t, err)
+	require.NoError(t, set.Set("some_gogo", protoflagz.Base64BinaryPrefix+base64.StdEncoding.EncodeToString(raw)))
+	assert.EqualValues(t, expectedMsg, dynFlag.Get(), "base64 binary must be accepted")
+	assert.Contains(t, dynFlag.String(), `"some_string":"wolololo"`, "string must be JSONPB with original names")
+
+	assert.Error(t, set.Set("some_gogo", `{"some_strnig": "typo"}`), "unknown fields must be rejected")
+	assert.False(t, dynFlag.LastChanged().IsZero())
+}
+
+func TestDynGogoProtoP_AcceptsShorthand(t *testing.T) {
+	set := flag.NewFlagSet("shorthand", flag.ContinueOnError)
+	dynFlag := DynGogoProtoP(set, "some_gogo", "g", defaultMsg, "Use it or lose it")
+	require.NoError(t, set.Parse([]string{"-g", `{"someString": "wolololo", "some_ints": [1, 2], "someMap": {"foo": 1337}}`}))
+	assert.EqualValues(t, expectedMsg, dynFlag.Get())
+	assert.True(t, flagz.IsFlagDynamic(set.ShorthandLookup("g")), "shorthand variants must be dynamic")
+}
+
+func TestDynGogoProto_GetCopyIsIsolated(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynFlag := DynGogoProto(set, "some_gogo", expectedMsg, "Use it or lose it")
+	copied := dynFlag.GetCopy().(*testMsg)
+	copied.SomeMap["foo"] = 1
+	assert.EqualValues(t, 1337, dynFlag.Get().(*testMsg).SomeMap["foo"], "mutating the copy must not change the value")
+}
@@ -0,0 +1,142 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package protoflagz
+
+import (
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// MessageJSONSchema returns the JSON Schema (draft-07) of the JSONPB encoding of messages described by `md`, using
+// the original proto field names as output by `DynProto3Value.String`.
+// Messages are put in `definitions` and referenced by their full name, so recursive messages are supported.
+func MessageJSONSchema(md protoreflect.MessageDescriptor) map[string]interface{} {
+	definitions := map[string]interface{}{}
+	schema := messageSchemaRef(md, definitions)
+	schema["$schema"] = jsonSchemaDraft
+	schema["definitions"] = definitions
+	return schema
+}
+
+// JSONSchema returns the JSON Schema of the JSONPB inputs, see `MessageJSONSchema`.
+func (d *DynProto3Value) JSONSchema() map[string]interface{} {
+	return MessageJSONSchema(structTypeDescriptor(d.structType))
+}
+
+// JSONSchema returns the JSON Schema of the inputs, an array of JSONPB messages.
+func (d *DynProto3ListValue) JSONSchema() map[string]interface{} {
+	schema := MessageJSONSchema(structTypeDescriptor(d.structType))
+	return map[string]interface{}{
+		"$schema":     schema["$schema"],
+		"definitions": schema["definitions"],
+		"type":        "array",
+		"items":       map[string]interface{}{"$ref": schema["$ref"]},
+	}
+}
+
+// JSONSchema returns the JSON Schema of the inputs, an object of JSONPB messages.
+func (d *DynProto3MapValue) JSONSchema() map[string]interface{} {
+	schema := MessageJSONSchema(structTypeDescriptor(d.structType))
+	return map[string]interface{}{
+		"$schema":              schema["$schema"],
+		"definitions":          schema["definitions"],
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"$ref": schema["$ref"]},
+	}
+}
+
+func structTypeDescriptor(structType reflect.Type) protoreflect.MessageDescriptor {
+	return reflect.New(structType).Interface().(proto.Message).ProtoReflect().Descriptor()
+}
+
+func messageSchemaRef(md protoreflect.MessageDescriptor, definitions map[string]interface{}) map[string]interface{} {
+	if schema := wellKnownTypeSchema(md); schema != nil {
+		return schema
+	}
+	name := string(md.FullName())
+	if _, ok := definitions[name]; !ok {
+		properties := map[string]interface{}{}
+		object := map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+		// registered before the fields, so that recursive references terminate.
+		definitions[name] = object
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			fd := fields.Get(i)
+			properties[string(fd.Name())] = fieldSchema(fd, definitions)
+		}
+	}
+	return map[string]interface{}{"$ref": "#/definitions/" + name}
+}
+
+func fieldSchema(fd protoreflect.FieldDescriptor, definitions map[string]interface{}) map[string]interface{} {
+	switch {
+	case fd.IsMap():
+		return map[string]interface{}{"type": "object", "additionalProperties": singularSchema(fd.MapValue(), definitions)}
+	case fd.IsList():
+		return map[string]interface{}{"type": "array", "items": singularSchema(fd, definitions)}
+	}
+	return singularSchema(fd, definitions)
+}
+
+func singularSchema(fd protoreflect.FieldDescriptor, definitions map[string]interface{}) map[string]interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]interface{}{"type": "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]interface{}{"type": "integer"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// JSONPB encodes 64-bit integers as strings, but accepts both.
+		return map[string]interface{}{"type": []string{"integer", "string"}}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return map[string]interface{}{"type": "number"}
+	case protoreflect.StringKind:
+		return map[string]interface{}{"type": "string"}
+	case protoreflect.BytesKind:
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		names := make([]string, 0, values.Len())
+		for i := 0; i < values.Len(); i++ {
+			names = append(names, string(values.Get(i).Name()))
+		}
+		return map[string]interface{}{"type": "string", "enum": names}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageSchemaRef(fd.Message(), definitions)
+	}
+	return map[string]interface{}{}
+}
+
+func wellKnownTypeSchema(md protoreflect.MessageDescriptor) map[string]interface{} {
+	switch md.FullName() {
+	case "google.protobuf.Any":
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{"@type": map[string]interface{}{"type": "string"}}, "required": []string{"@type"}}
+	case "google.protobuf.Timestamp":
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case "google.protobuf.Duration", "google.protobuf.FieldMask":
+		return map[string]interface{}{"type": "string"}
+	case "google.protobuf.Struct", "google.protobuf.Empty":
+		return map[string]interface{}{"type": "object"}
+	case "google.protobuf.ListValue":
+		return map[string]interface{}{"type": "array"}
+	case "google.protobuf.Value":
+		return map[string]interface{}{}
+	case "google.protobuf.BoolValue":
+		return map[string]interface{}{"type": "boolean"}
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value":
+		return map[string]interface{}{"type": "integer"}
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return map[string]interface{}{"type": []string{"integer", "string"}}
+	case "google.protobuf.FloatValue", "google.protobuf.DoubleValue":
+		return map[string]interface{}{"type": "number"}
+	case "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return map[string]interface{}{"type": "string"}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package protoflagz
+
+import (
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/protobuf/testdata"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDynProto3_JSONSchema(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynProto3(set, "some_proto", &mwitkow_testproto.SomePolicy{}, "Use it or lose it")
+
+	schema := flagz.FlagJSONSchema(set.Lookup("some_proto"))
+	require.NotNil(t, schema, "DynProto3 must provide a schema")
+	assert.Equal(t, "#/definitions/mwitkow.testproto.SomePolicy", schema["$ref"])
+	definitions := schema["definitions"].(map[string]interface{})
+	policy := definitions["mwitkow.testproto.SomePolicy"].(map[string]interface{})
+	assert.Equal(t, false, policy["additionalProperties"], "unknown fields are rejected by JSONPB")
+	properties := policy["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string"}, properties["name"])
+	assert.Contains(t, properties["matcher"].(map[string]interface{})["required"], "@type", "Any must require its type")
+}
+
+func TestDynProto3_JSONSchemaFields(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynProto3(set, "some_proto", &mwitkow_testproto.SomeMsg{}, "Use it or lose it")
+
+	schema := flagz.FlagJSONSchema(set.Lookup("some_proto"))
+	msg := schema["definitions"].(map[string]interface{})["mwitkow.testproto.SomeMsg"].(map[string]interface{})
+	properties := msg["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string", "enum": []string{"OPT_1", "OPT_2"}}, properties["some_enum"])
+	assert.Equal(t, map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "integer"}}, properties["some_map"])
+}
+
+func TestDynProto3ListAndMap_JSONSchema(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynProto3List(set, "some_list", &mwitkow_testproto.SomeMsg{}, []proto.Message{}, "Use it or lose it")
+	DynProto3Map(set, "some_map", &mwitkow_testproto.SomeMsg{}, map[string]proto.Message{}, "Use it or lose it")
+
+	listSchema := flagz.FlagJSONSchema(set.Lookup("some_list"))
+	assert.Equal(t, "array", listSchema["type"])
+	assert.Equal(t, map[string]interface{}{"$ref": "#/definitions/mwitkow.testproto.SomeMsg"}, listSchema["items"])
+	mapSchema := flagz.FlagJSONSchema(set.Lookup("some_map"))
+	assert.Equal(t, "object", mapSchema["type"])
+	assert.Contains(t, mapSchema["definitions"], "mwitkow.testproto.SomeMsg")
+}
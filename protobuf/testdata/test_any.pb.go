@@ -0,0 +1,183 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: test_any.proto
+
+package mwitkow_testproto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	anypb "google.golang.org/protobuf/types/known/anypb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// SomePolicy has a pluggable matcher, resolved through a type registry.
+type SomePolicy struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Matcher       *anypb.Any             `protobuf:"bytes,2,opt,name=matcher,proto3" json:"matcher,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SomePolicy) Reset() {
+	*x = SomePolicy{}
+	mi := &file_test_any_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SomePolicy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SomePolicy) ProtoMessage() {}
+
+func (x *SomePolicy) ProtoReflect() protoreflect.Message {
+	mi := &file_test_any_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SomePolicy.ProtoReflect.Descriptor instead.
+func (*SomePolicy) Descriptor() ([]byte, []int) {
+	return file_test_any_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SomePolicy) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SomePolicy) GetMatcher() *anypb.Any {
+	if x != nil {
+		return x.Matcher
+	}
+	return nil
+}
+
+type PrefixMatcher struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PrefixMatcher) Reset() {
+	*x = PrefixMatcher{}
+	mi := &file_test_any_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PrefixMatcher) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PrefixMatcher) ProtoMessage() {}
+
+func (x *PrefixMatcher) ProtoReflect() protoreflect.Message {
+	mi := &file_test_any_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PrefixMatcher.ProtoReflect.Descriptor instead.
+func (*PrefixMatcher) Descriptor() ([]byte, []int) {
+	return file_test_any_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PrefixMatcher) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+var File_test_any_proto protoreflect.FileDescriptor
+
+const file_test_any_proto_rawDesc = "" +
+	"\n" +
+	"\x0etest_any.proto\x12\x11mwitkow.testproto\x1a\x19google/protobuf/any.proto\"P\n" +
+	"\n" +
+	"SomePolicy\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12.\n" +
+	"\amatcher\x18\x02 \x01(\v2\x14.google.protobuf.AnyR\amatcher\"'\n" +
+	"\rPrefixMatcher\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefixBAZ?github.com/mwitkow/go-flagz/protobuf/testdata;mwitkow_testprotob\x06proto3"
+
+var (
+	file_test_any_proto_rawDescOnce sync.Once
+	file_test_any_proto_rawDescData []byte
+)
+
+func file_test_any_proto_rawDescGZIP() []byte {
+	file_test_any_proto_rawDescOnce.Do(func() {
+		file_test_any_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_test_any_proto_rawDesc), len(file_test_any_proto_rawDesc)))
+	})
+	return file_test_any_proto_rawDescData
+}
+
+var file_test_any_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_test_any_proto_goTypes = []any{
+	(*SomePolicy)(nil),    // 0: mwitkow.testproto.SomePolicy
+	(*PrefixMatcher)(nil), // 1: mwitkow.testproto.PrefixMatcher
+	(*anypb.Any)(nil),     // 2: google.protobuf.Any
+}
+var file_test_any_proto_depIdxs = []int32{
+	2, // 0: mwitkow.testproto.SomePolicy.matcher:type_name -> google.protobuf.Any
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_test_any_proto_init() }
+func file_test_any_proto_init() {
+	if File_test_any_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_test_any_proto_rawDesc), len(file_test_any_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_test_any_proto_goTypes,
+		DependencyIndexes: file_test_any_proto_depIdxs,
+		MessageInfos:      file_test_any_proto_msgTypes,
+	}.Build()
+	File_test_any_proto = out.File
+	file_test_any_proto_goTypes = nil
+	file_test_any_proto_depIdxs = nil
+}
@@ -0,0 +1,20 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package mwitkow_testproto
+
+import (
+	"fmt"
+)
+
+// Validate mimics the method generated by protoc-gen-validate for a `(validate.rules).string.min_len = 1` rule on
+// `prefix`.
+func (m *PrefixMatcher) Validate() error {
+	if m == nil {
+		return nil
+	}
+	if len(m.GetPrefix()) < 1 {
+		return fmt.Errorf("invalid PrefixMatcher.Prefix: value length must be at least 1 runes")
+	}
+	return nil
+}
@@ -1,30 +1,25 @@
-// Code generated by protoc-gen-go.
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
 // source: test_proto3.proto
-// DO NOT EDIT!
 
-/*
-Package mwitkow_testproto is a generated protocol buffer package.
-
-It is generated from these files:
-	test_proto3.proto
-
-It has these top-level messages:
-	SomeMsg
-*/
 package mwitkow_testproto
 
-import proto "github.com/golang/protobuf/proto"
-import fmt "fmt"
-import math "math"
-
-// Reference imports to suppress errors if they are not otherwise used.
-var _ = proto.Marshal
-var _ = fmt.Errorf
-var _ = math.Inf
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the proto package it is being compiled against.
-const _ = proto.ProtoPackageIsVersion1
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
 
 type SomeEnum int32
 
@@ -33,57 +28,172 @@ const (
 	SomeEnum_OPT_2 SomeEnum = 1
 )
 
-var SomeEnum_name = map[int32]string{
-	0: "OPT_1",
-	1: "OPT_2",
-}
-var SomeEnum_value = map[string]int32{
-	"OPT_1": 0,
-	"OPT_2": 1,
+// Enum value maps for SomeEnum.
+var (
+	SomeEnum_name = map[int32]string{
+		0: "OPT_1",
+		1: "OPT_2",
+	}
+	SomeEnum_value = map[string]int32{
+		"OPT_1": 0,
+		"OPT_2": 1,
+	}
+)
+
+func (x SomeEnum) Enum() *SomeEnum {
+	p := new(SomeEnum)
+	*p = x
+	return p
 }
 
 func (x SomeEnum) String() string {
-	return proto.EnumName(SomeEnum_name, int32(x))
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (SomeEnum) Descriptor() protoreflect.EnumDescriptor {
+	return file_test_proto3_proto_enumTypes[0].Descriptor()
+}
+
+func (SomeEnum) Type() protoreflect.EnumType {
+	return &file_test_proto3_proto_enumTypes[0]
+}
+
+func (x SomeEnum) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use SomeEnum.Descriptor instead.
+func (SomeEnum) EnumDescriptor() ([]byte, []int) {
+	return file_test_proto3_proto_rawDescGZIP(), []int{0}
 }
-func (SomeEnum) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
 
 type SomeMsg struct {
-	SomeString string           `protobuf:"bytes,1,opt,name=some_string,json=someString" json:"some_string,omitempty"`
-	SomeEnum   SomeEnum         `protobuf:"varint,2,opt,name=some_enum,json=someEnum,enum=mwitkow.testproto.SomeEnum" json:"some_enum,omitempty"`
-	SomeMap    map[string]int32 `protobuf:"bytes,3,rep,name=some_map,json=someMap" json:"some_map,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SomeString    string                 `protobuf:"bytes,1,opt,name=some_string,json=someString,proto3" json:"some_string,omitempty"`
+	SomeEnum      SomeEnum               `protobuf:"varint,2,opt,name=some_enum,json=someEnum,proto3,enum=mwitkow.testproto.SomeEnum" json:"some_enum,omitempty"`
+	SomeMap       map[string]int32       `protobuf:"bytes,3,rep,name=some_map,json=someMap,proto3" json:"some_map,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SomeMsg) Reset() {
+	*x = SomeMsg{}
+	mi := &file_test_proto3_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SomeMsg) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SomeMsg) ProtoMessage() {}
+
+func (x *SomeMsg) ProtoReflect() protoreflect.Message {
+	mi := &file_test_proto3_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
 }
 
-func (m *SomeMsg) Reset()                    { *m = SomeMsg{} }
-func (m *SomeMsg) String() string            { return proto.CompactTextString(m) }
-func (*SomeMsg) ProtoMessage()               {}
-func (*SomeMsg) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+// Deprecated: Use SomeMsg.ProtoReflect.Descriptor instead.
+func (*SomeMsg) Descriptor() ([]byte, []int) {
+	return file_test_proto3_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SomeMsg) GetSomeString() string {
+	if x != nil {
+		return x.SomeString
+	}
+	return ""
+}
+
+func (x *SomeMsg) GetSomeEnum() SomeEnum {
+	if x != nil {
+		return x.SomeEnum
+	}
+	return SomeEnum_OPT_1
+}
 
-func (m *SomeMsg) GetSomeMap() map[string]int32 {
-	if m != nil {
-		return m.SomeMap
+func (x *SomeMsg) GetSomeMap() map[string]int32 {
+	if x != nil {
+		return x.SomeMap
 	}
 	return nil
 }
 
-func init() {
-	proto.RegisterType((*SomeMsg)(nil), "mwitkow.testproto.SomeMsg")
-	proto.RegisterEnum("mwitkow.testproto.SomeEnum", SomeEnum_name, SomeEnum_value)
-}
-
-var fileDescriptor0 = []byte{
-	// 220 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0x12, 0x2c, 0x49, 0x2d, 0x2e,
-	0x89, 0x2f, 0x28, 0xca, 0x2f, 0xc9, 0x37, 0xd6, 0x03, 0x53, 0x42, 0x82, 0xb9, 0xe5, 0x99, 0x25,
-	0xd9, 0xf9, 0xe5, 0x7a, 0x20, 0x29, 0xb0, 0x90, 0xd2, 0x13, 0x46, 0x2e, 0xf6, 0xe0, 0xfc, 0xdc,
-	0x54, 0xdf, 0xe2, 0x74, 0x21, 0x79, 0x2e, 0xee, 0x62, 0x20, 0x33, 0xbe, 0xb8, 0xa4, 0x28, 0x33,
-	0x2f, 0x5d, 0x82, 0x51, 0x81, 0x51, 0x83, 0x33, 0x88, 0x0b, 0x24, 0x14, 0x0c, 0x16, 0x11, 0xb2,
-	0xe0, 0xe2, 0x04, 0x2b, 0x48, 0xcd, 0x2b, 0xcd, 0x95, 0x60, 0x02, 0x4a, 0xf3, 0x19, 0x49, 0xeb,
-	0x61, 0x98, 0xa9, 0x07, 0x32, 0xcf, 0x15, 0xa8, 0x24, 0x88, 0xa3, 0x18, 0xca, 0x12, 0x72, 0xe2,
-	0x02, 0xb3, 0xe3, 0x73, 0x13, 0x0b, 0x24, 0x98, 0x15, 0x98, 0x35, 0xb8, 0x8d, 0xd4, 0x71, 0x68,
-	0x04, 0x3a, 0x04, 0x42, 0x27, 0x16, 0xb8, 0xe6, 0x95, 0x14, 0x55, 0x06, 0xb1, 0x17, 0x43, 0x78,
-	0x52, 0x56, 0x5c, 0x3c, 0xc8, 0x12, 0x42, 0x02, 0x5c, 0xcc, 0xd9, 0xa9, 0x95, 0x50, 0x67, 0x82,
-	0x98, 0x42, 0x22, 0x5c, 0xac, 0x65, 0x89, 0x39, 0xa5, 0xa9, 0x60, 0xb7, 0xb1, 0x06, 0x41, 0x38,
-	0x56, 0x4c, 0x16, 0x8c, 0x5a, 0x0a, 0x5c, 0x1c, 0x30, 0x57, 0x09, 0x71, 0x72, 0xb1, 0xfa, 0x07,
-	0x84, 0xc4, 0x1b, 0x0a, 0x30, 0xc0, 0x98, 0x46, 0x02, 0x8c, 0x49, 0x6c, 0x90, 0x90, 0x02, 0x04,
-	0x00, 0x00, 0xff, 0xff, 0x2f, 0xf1, 0x31, 0x8c, 0x37, 0x01, 0x00, 0x00,
+var File_test_proto3_proto protoreflect.FileDescriptor
+
+const file_test_proto3_proto_rawDesc = "" +
+	"\n" +
+	"\x11test_proto3.proto\x12\x11mwitkow.testproto\"\xe4\x01\n" +
+	"\aSomeMsg\x12\x1f\n" +
+	"\vsome_string\x18\x01 \x01(\tR\n" +
+	"someString\x128\n" +
+	"\tsome_enum\x18\x02 \x01(\x0e2\x1b.mwitkow.testproto.SomeEnumR\bsomeEnum\x12B\n" +
+	"\bsome_map\x18\x03 \x03(\v2'.mwitkow.testproto.SomeMsg.SomeMapEntryR\asomeMap\x1a:\n" +
+	"\fSomeMapEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01* \n" +
+	"\bSomeEnum\x12\t\n" +
+	"\x05OPT_1\x10\x00\x12\t\n" +
+	"\x05OPT_2\x10\x01BAZ?github.com/mwitkow/go-flagz/protobuf/testdata;mwitkow_testprotob\x06proto3"
+
+var (
+	file_test_proto3_proto_rawDescOnce sync.Once
+	file_test_proto3_proto_rawDescData []byte
+)
+
+func file_test_proto3_proto_rawDescGZIP() []byte {
+	file_test_proto3_proto_rawDescOnce.Do(func() {
+		file_test_proto3_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_test_proto3_proto_rawDesc), len(file_test_proto3_proto_rawDesc)))
+	})
+	return file_test_proto3_proto_rawDescData
+}
+
+var file_test_proto3_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_test_proto3_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_test_proto3_proto_goTypes = []any{
+	(SomeEnum)(0),   // 0: mwitkow.testproto.SomeEnum
+	(*SomeMsg)(nil), // 1: mwitkow.testproto.SomeMsg
+	nil,             // 2: mwitkow.testproto.SomeMsg.SomeMapEntry
+}
+var file_test_proto3_proto_depIdxs = []int32{
+	0, // 0: mwitkow.testproto.SomeMsg.some_enum:type_name -> mwitkow.testproto.SomeEnum
+	2, // 1: mwitkow.testproto.SomeMsg.some_map:type_name -> mwitkow.testproto.SomeMsg.SomeMapEntry
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_test_proto3_proto_init() }
+func file_test_proto3_proto_init() {
+	if File_test_proto3_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_test_proto3_proto_rawDesc), len(file_test_proto3_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_test_proto3_proto_goTypes,
+		DependencyIndexes: file_test_proto3_proto_depIdxs,
+		EnumInfos:         file_test_proto3_proto_enumTypes,
+		MessageInfos:      file_test_proto3_proto_msgTypes,
+	}.Build()
+	File_test_proto3_proto = out.File
+	file_test_proto3_proto_goTypes = nil
+	file_test_proto3_proto_depIdxs = nil
 }
@@ -0,0 +1,133 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"sync"
+)
+
+// QueuePolicy decides what an UpdateQueue does with updates pushed while it is full.
+type QueuePolicy int
+
+const (
+	// QueueBlock makes `Push` wait until the queue has room, slowing down reading from the source to the pace of
+	// applying updates.
+	QueueBlock QueuePolicy = iota
+	// QueueDropOldest drops the oldest pending update to make room, counting it in `Dropped`.
+	QueueDropOldest
+	// QueueCoalesce replaces the pending update of the same key (e.g. the same flag) by the pushed one at any time,
+	// counting it in `Coalesced`, so that the queue holds at most one update per key. Updates of other keys pushed
+	// while it is full wait, like with QueueBlock.
+	QueueCoalesce
+)
+
+// UpdateQueue is a bounded queue of the updates read from the source of an Updater pending to be applied, decoupling
+// reading from applying, so that a flood of changes can neither exhaust memory nor starve the go-routines of the
+// application. Updates are applied in the order they are pushed, one at a time, by `Run`.
+type UpdateQueue struct {
+	capacity int
+	policy   QueuePolicy
+
+	mu        sync.Mutex
+	changed   *sync.Cond
+	pending   []queuedUpdate
+	closed    bool
+	dropped   uint64
+	coalesced uint64
+}
+
+type queuedUpdate struct {
+	key   string
+	apply func()
+}
+
+// NewUpdateQueue creates an UpdateQueue of up to `capacity` pending updates (at least one), handling more according
+// to `policy`.
+func NewUpdateQueue(capacity int, policy QueuePolicy) *UpdateQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	q := &UpdateQueue{capacity: capacity, policy: policy}
+	q.changed = sync.NewCond(&q.mu)
+	return q
+}
+
+// Push queues `apply`, the update of `key`, returning the key of the update dropped to make room with
+// QueueDropOldest, and whether one was dropped. Updates pushed after `Close` are dropped.
+func (q *UpdateQueue) Push(key string, apply func()) (droppedKey string, dropped bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	defer q.changed.Broadcast()
+	if q.policy == QueueCoalesce {
+		for i := range q.pending {
+			if q.pending[i].key == key {
+				q.pending[i].apply = apply
+				q.coalesced++
+				return "", false
+			}
+		}
+	}
+	if q.policy == QueueDropOldest && len(q.pending) >= q.capacity {
+		droppedKey, dropped = q.pending[0].key, true
+		q.pending = q.pending[1:]
+		q.dropped++
+	}
+	for !q.closed && len(q.pending) >= q.capacity {
+		q.changed.Wait()
+	}
+	if q.closed {
+		q.dropped++
+		return key, true
+	}
+	q.pending = append(q.pending, queuedUpdate{key: key, apply: apply})
+	return droppedKey, dropped
+}
+
+// Run applies the pushed updates until the queue is closed and all pending updates are applied.
+func (q *UpdateQueue) Run() {
+	for {
+		q.mu.Lock()
+		for !q.closed && len(q.pending) == 0 {
+			q.changed.Wait()
+		}
+		if len(q.pending) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		update := q.pending[0]
+		q.pending = q.pending[1:]
+		q.changed.Broadcast()
+		q.mu.Unlock()
+		update.apply()
+	}
+}
+
+// Close makes `Run` return once the pending updates are applied, and unblocks waiting calls to `Push`.
+func (q *UpdateQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.changed.Broadcast()
+	q.mu.Unlock()
+}
+
+// Len returns the number of pending updates.
+func (q *UpdateQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Dropped returns the number of updates dropped, with QueueDropOldest or after `Close`.
+func (q *UpdateQueue) Dropped() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Coalesced returns the number of pending updates replaced with QueueCoalesce.
+func (q *UpdateQueue) Coalesced() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.coalesced
+}
@@ -0,0 +1,93 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// appliedLog records the updates applied by an UpdateQueue.
+type appliedLog struct {
+	mu      sync.Mutex
+	applied []string
+}
+
+func (l *appliedLog) update(name string) func() {
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.applied = append(l.applied, name)
+	}
+}
+
+func (l *appliedLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.applied...)
+}
+
+func runQueue(q *flagz.UpdateQueue) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run()
+	}()
+	q.Close()
+	<-done
+}
+
+func TestUpdateQueue_DropOldest(t *testing.T) {
+	q := flagz.NewUpdateQueue(2, flagz.QueueDropOldest)
+	log := &appliedLog{}
+	q.Push("a", log.update("a1"))
+	q.Push("b", log.update("b1"))
+	key, dropped := q.Push("c", log.update("c1"))
+	assert.True(t, dropped)
+	assert.Equal(t, "a", key, "the oldest update must be dropped")
+	assert.Equal(t, 2, q.Len())
+	assert.EqualValues(t, 1, q.Dropped())
+	runQueue(q)
+	assert.Equal(t, []string{"b1", "c1"}, log.get(), "pending updates must be applied in order before Run returns")
+}
+
+func TestUpdateQueue_Coalesce(t *testing.T) {
+	q := flagz.NewUpdateQueue(2, flagz.QueueCoalesce)
+	log := &appliedLog{}
+	q.Push("a", log.update("a1"))
+	q.Push("b", log.update("b1"))
+	_, dropped := q.Push("a", log.update("a2"))
+	assert.False(t, dropped, "updates of pending keys must be coalesced even when full")
+	assert.EqualValues(t, 1, q.Coalesced())
+	runQueue(q)
+	assert.Equal(t, []string{"a2", "b1"}, log.get(), "coalesced updates must keep the position of the first one")
+}
+
+func TestUpdateQueue_BlocksUntilThereIsRoom(t *testing.T) {
+	q := flagz.NewUpdateQueue(1, flagz.QueueBlock)
+	log := &appliedLog{}
+	q.Push("a", log.update("a1"))
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		q.Push("b", log.update("b1"))
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("pushing to a full queue must block")
+	case <-time.After(20 * time.Millisecond):
+	}
+	go q.Run()
+	<-pushed
+	require.Eventually(t, func() bool { return len(log.get()) == 2 }, time.Second, time.Millisecond)
+	q.Close()
+
+	_, dropped := q.Push("c", log.update("c1"))
+	assert.True(t, dropped, "updates pushed after closing must be dropped")
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	flag "github.com/spf13/pflag"
+)
+
+// UpdaterFactory constructs an Updater syncing `flagSet` from the source described by `source`.
+type UpdaterFactory func(flagSet *flag.FlagSet, source *url.URL, logger Logger) (Updater, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]UpdaterFactory)
+)
+
+// RegisterUpdater makes an Updater backend available under the URL `scheme`, similar to `database/sql` drivers.
+// Backend packages call it from their `init`, so importing them (possibly for side effects only) is enough to make
+// their scheme usable in `NewUpdater`. It panics if the scheme is registered twice.
+func RegisterUpdater(scheme string, factory UpdaterFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if factory == nil {
+		panic("flagz: RegisterUpdater factory is nil")
+	}
+	if _, dup := factories[scheme]; dup {
+		panic("flagz: RegisterUpdater called twice for scheme " + scheme)
+	}
+	factories[scheme] = factory
+}
+
+// RegisteredUpdaters returns a sorted list of the schemes of all registered Updater backends.
+func RegisteredUpdaters() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	schemes := make([]string, 0, len(factories))
+	for scheme := range factories {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// NewUpdater constructs an Updater for a source URL, e.g. `file:///etc/myapp/flags.conf` or
+// `etcd://localhost:2379/flagz/myapp`, using the backend registered for the URL's scheme.
+func NewUpdater(flagSet *flag.FlagSet, source string, logger Logger) (Updater, error) {
+	sourceURL, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("flagz: bad updater source: %v", err)
+	}
+	factoriesMu.RLock()
+	factory, ok := factories[sourceURL.Scheme]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("flagz: no updater registered for scheme %q (forgotten import?)", sourceURL.Scheme)
+	}
+	return factory(flagSet, sourceURL, logger)
+}
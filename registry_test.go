@@ -0,0 +1,50 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeUpdater struct {
+	*flagz.UpdaterTracker
+	source *url.URL
+}
+
+func (f *fakeUpdater) Initialize() error { return nil }
+func (f *fakeUpdater) Start() error      { return nil }
+func (f *fakeUpdater) Stop() error       { return nil }
+
+func init() {
+	// schemes can only be registered once per process, same as the backends do it in their init.
+	flagz.RegisterUpdater("registrytest", func(flagSet *flag.FlagSet, source *url.URL, logger flagz.Logger) (flagz.Updater, error) {
+		return &fakeUpdater{UpdaterTracker: flagz.NewUpdaterTracker(), source: source}, nil
+	})
+}
+
+func TestNewUpdater_UsesRegisteredFactory(t *testing.T) {
+	assert.Contains(t, flagz.RegisteredUpdaters(), "registrytest")
+
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	u, err := flagz.NewUpdater(set, "registrytest://somehost/some/path?opt=1", nil)
+	require.NoError(t, err, "registered schemes must be constructible")
+	require.IsType(t, &fakeUpdater{}, u)
+	assert.Equal(t, "/some/path", u.(*fakeUpdater).source.Path, "the parsed source must be passed to the factory")
+
+	assert.Panics(t, func() {
+		flagz.RegisterUpdater("registrytest", func(*flag.FlagSet, *url.URL, flagz.Logger) (flagz.Updater, error) { return nil, nil })
+	}, "registering a scheme twice must panic")
+}
+
+func TestNewUpdater_FailsOnUnknownScheme(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	_, err := flagz.NewUpdater(set, "nosuchscheme:///foo", nil)
+	assert.Error(t, err, "unregistered schemes must be rejected")
+}
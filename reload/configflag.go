@@ -0,0 +1,58 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package reload
+
+import (
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DefaultWatchInterval is how often the Updaters of `ConfigFileFlag` check their config files for changes.
+const DefaultWatchInterval = 5 * time.Second
+
+// ConfigFileFlag registers a flag `name` (e.g. `--config`) in `flagSet` holding the path of a config file, whose
+// `name = value` lines populate the other flags of `flagSet` through the Updater returned by `ConfigFileValue.Updater`:
+// all flags on initialization, and dynamic flags whenever the file changes.
+//
+// The file is the lowest layer of precedence: flags set on the command line or by other Updaters (e.g. etcd) keep
+// their values, see `Updater.WithLowestPrecedence`.
+func ConfigFileFlag(flagSet *flag.FlagSet, name string, usage string) *ConfigFileValue {
+	value := &ConfigFileValue{flagSet: flagSet}
+	flagSet.VarP(value, name, "", usage)
+	return value
+}
+
+// ConfigFileValue is the value of a `ConfigFileFlag`, the path of the config file.
+type ConfigFileValue struct {
+	flagSet *flag.FlagSet
+	path    string
+}
+
+// Set sets the path of the config file, e.g. when parsing the command line.
+func (c *ConfigFileValue) Set(path string) error {
+	c.path = path
+	return nil
+}
+
+// String returns the path of the config file.
+func (c *ConfigFileValue) String() string {
+	return c.path
+}
+
+// Type is an indicator of what this flag represents.
+func (c *ConfigFileValue) Type() string {
+	return "string"
+}
+
+// Updater constructs the Updater of the config file, with the lowest precedence and reloading whenever the file
+// changes (checked every DefaultWatchInterval, and on SIGHUP). It must be called after parsing the command line, and
+// reads nothing if no config file was given.
+func (c *ConfigFileValue) Updater(logger loggerCompatible) *Updater {
+	u := New(c.flagSet, logger).WithLowestPrecedence().WithWatchInterval(DefaultWatchInterval)
+	if c.path != "" {
+		u.WithConfigFile(c.path)
+	}
+	return u
+}
@@ -0,0 +1,41 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package reload_test
+
+import (
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/reload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *updaterTestSuite) TestConfigFileFlagHasLowestPrecedence() {
+	config := reload.ConfigFileFlag(s.flagSet, "config", "path of the config file")
+	require.NoError(s.T(), s.flagSet.Parse([]string{"--config", s.configFile, "--some_int=5"}))
+	assert.Equal(s.T(), s.configFile, config.String())
+
+	u := config.Updater(&testingLog{T: s.T()}).WithWatchInterval(10 * time.Millisecond)
+	require.NoError(s.T(), u.Initialize())
+	assert.EqualValues(s.T(), 5, *s.staticInt, "command line values must win over the config file")
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "dynInt should be read from the config file")
+	require.NoError(s.T(), u.Start())
+	defer u.Stop()
+
+	require.NoError(s.T(), flagz.SetFlagFromSource(s.flagSet, "some_dynstring", "from_etcd", "etcd"))
+	s.writeConfig("some_dynint = 20002\nsome_dynstring = from_file\n")
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, 20002,
+		func() interface{} { return s.dynInt.Get() },
+		"some_dynint value should change after the config file changed")
+	assert.Equal(s.T(), "from_etcd", s.dynString.Get(), "values of other updaters must win over the config file")
+}
+
+func (s *updaterTestSuite) TestConfigFileFlagWithoutPathReadsNothing() {
+	config := reload.ConfigFileFlag(s.flagSet, "config", "path of the config file")
+	require.NoError(s.T(), s.flagSet.Parse([]string{}))
+	require.NoError(s.T(), config.Updater(&testingLog{T: s.T()}).Initialize())
+	assert.EqualValues(s.T(), 1, s.dynInt.Get(), "flags must keep their defaults")
+}
@@ -0,0 +1,367 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package reload provides an Updater with classic reload semantics: a config file and/or environment variables are
+// re-read on SIGHUP (or a user-provided trigger) and the differences are applied to dynamic flags.
+
+package reload
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+)
+
+// updaterSource is the source of values set by the Updater, see `flagz.FlagSource`.
+const updaterSource = "reload"
+
+func init() {
+	flagz.RegisterUpdater("file", newFromURL)
+}
+
+// Minimum logger interface needed.
+// Default "log" and "logrus" should support these.
+type loggerCompatible interface {
+	Printf(format string, v ...interface{})
+}
+
+// Updater re-reads flag values from a config file and the environment whenever it is triggered.
+//
+// The config file consists of `flag_name = value` lines. Empty lines and lines starting with `#` are ignored.
+// Environment variables are matched by upper-casing the flag name, replacing `-` and `.` with `_` and prepending the
+// configured prefix, e.g. `MYAPP_SOME_FLAG` for the flag `some_flag` and the prefix `MYAPP_`. Values from the
+// environment take precedence over the ones from the config file.
+type Updater struct {
+	*flagz.UpdaterTracker
+	flagSet    *flag.FlagSet
+	logger     loggerCompatible
+	configFile string
+	envPrefix  string
+	useEnv     bool
+	trigger    <-chan struct{}
+	// lowestPrecedence skips flags set by other sources, see `WithLowestPrecedence`.
+	lowestPrecedence bool
+	watchInterval    time.Duration
+
+	// lifecycle serializes the lifecycle transitions, see `flagz.UpdaterState`.
+	lifecycle sync.Mutex
+	cancel    context.CancelFunc
+	signals   chan os.Signal
+	// done is closed when the reloading go routine exits.
+	done chan struct{}
+
+	mu         sync.Mutex
+	lastValues map[string]string
+	lastStat   os.FileInfo
+}
+
+// New constructs a new Updater. At least one of `WithConfigFile` or `WithEnvPrefix` should be used to configure
+// what is being read.
+func New(flagSet *flag.FlagSet, logger loggerCompatible) *Updater {
+	return &Updater{
+		UpdaterTracker: flagz.NewUpdaterTracker(),
+		flagSet:        flagSet,
+		logger:         logger,
+		lastValues:     make(map[string]string),
+	}
+}
+
+// WithConfigFile sets the path of the config file that is read on every reload.
+func (u *Updater) WithConfigFile(path string) *Updater {
+	u.configFile = path
+	return u
+}
+
+// WithEnvPrefix enables reading flag values from environment variables starting with `prefix`.
+func (u *Updater) WithEnvPrefix(prefix string) *Updater {
+	u.envPrefix = prefix
+	u.useEnv = true
+	return u
+}
+
+// WithTrigger makes the Updater reload whenever a value is received on `trigger`, instead of on SIGHUP.
+func (u *Updater) WithTrigger(trigger <-chan struct{}) *Updater {
+	u.trigger = trigger
+	return u
+}
+
+// WithLowestPrecedence makes the Updater skip flags whose current value was set by another source (e.g. the etcd
+// watcher, see `flagz.FlagSource`) or on the command line, so that its values sit below those layers in precedence,
+// whichever of them is initialized first.
+func (u *Updater) WithLowestPrecedence() *Updater {
+	u.lowestPrecedence = true
+	return u
+}
+
+// WithWatchInterval makes the started Updater check the config file for changes every `interval`, and reload when its
+// modification time or size changes, in addition to SIGHUP (or the trigger).
+func (u *Updater) WithWatchInterval(interval time.Duration) *Updater {
+	u.watchInterval = interval
+	return u
+}
+
+// Initialize performs the initial read and sets all flags (dynamic and static) into the FlagSet.
+func (u *Updater) Initialize() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.CheckTransition(flagz.UpdaterInitialized); err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.reload(context.Background(), false /* dynamicOnly */); err != nil {
+		return err
+	}
+	return u.Transition(flagz.UpdaterInitialized)
+}
+
+// Start kicks off the go routine that waits for SIGHUP (or the trigger) and reloads dynamic flags.
+func (u *Updater) Start() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if err := u.Transition(flagz.UpdaterWatching); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
+	u.done = make(chan struct{})
+	trigger := u.trigger
+	if trigger == nil {
+		u.signals = make(chan os.Signal, 1)
+		signal.Notify(u.signals, syscall.SIGHUP)
+		trigger = signalTrigger(ctx, u.signals)
+	}
+	go u.waitForReloads(ctx, u.done, trigger)
+	return nil
+}
+
+// Stop stops the reloading go-routine and waits for it to exit. Stopping an Updater that isn't started is a no-op.
+func (u *Updater) Stop() error {
+	u.lifecycle.Lock()
+	defer u.lifecycle.Unlock()
+	if u.State() != flagz.UpdaterWatching {
+		return nil
+	}
+	if u.signals != nil {
+		signal.Stop(u.signals)
+		u.signals = nil
+	}
+	u.cancel()
+	<-u.done
+	return u.Transition(flagz.UpdaterStopped)
+}
+
+// Reload re-reads the sources and applies changed values to dynamic flags, same as receiving a SIGHUP.
+func (u *Updater) Reload() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.reload(context.Background(), true /* dynamicOnly */)
+}
+
+func (u *Updater) waitForReloads(ctx context.Context, done chan struct{}, trigger <-chan struct{}) {
+	defer close(done)
+	u.logger.Printf("flagz: waiting for reload triggers")
+	var ticks <-chan time.Time
+	if u.watchInterval > 0 && u.configFile != "" {
+		ticker := time.NewTicker(u.watchInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	for {
+		select {
+		case _, ok := <-trigger:
+			if !ok {
+				return
+			}
+			u.logger.Printf("flagz: reloading flags")
+			u.reloadAndRecord(ctx)
+		case <-ticks:
+			if u.configFileChanged() {
+				u.logger.Printf("flagz: config file %v changed, reloading flags", u.configFile)
+				u.reloadAndRecord(ctx)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (u *Updater) reloadAndRecord(ctx context.Context) {
+	u.mu.Lock()
+	err := u.reload(ctx, true /* dynamicOnly */)
+	u.mu.Unlock()
+	if err != nil {
+		u.logger.Printf("flagz: reload yielded errors: %v", err.Error())
+	}
+	u.RecordSync(err)
+}
+
+// configFileChanged tells whether the modification time or size of the config file changed since the last reload.
+func (u *Updater) configFileChanged() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	stat, err := os.Stat(u.configFile)
+	if err != nil || u.lastStat == nil {
+		return err == nil
+	}
+	return !stat.ModTime().Equal(u.lastStat.ModTime()) || stat.Size() != u.lastStat.Size()
+}
+
+func (u *Updater) reload(ctx context.Context, dynamicOnly bool) error {
+	values, err := u.readValues()
+	if err != nil {
+		return fmt.Errorf("flagz: reload: %v", err)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := &flagz.FlagErrors{Source: "config file and environment"}
+	for _, name := range names {
+		value := values[name]
+		if last, ok := u.lastValues[name]; ok && last == value {
+			continue
+		}
+		if u.lowestPrecedence && u.setElsewhere(name) {
+			continue
+		}
+		shownValue := flagz.RedactFlagValue(u.flagSet.Lookup(name), value)
+		if err := u.setFlag(ctx, name, value, dynamicOnly); err != nil {
+			if errors.Is(err, flagz.ErrFlagNotDynamic) && dynamicOnly {
+				u.logger.Printf("flagz: ignoring change of non-dynamic flag=%v until restart", name)
+			} else if errors.Is(err, flagz.ErrFlagPinned) {
+				// held until the flag is unpinned, which applies it.
+				u.logger.Printf("flagz: holding update of pinned flag=%v until it is unpinned", name)
+				u.lastValues[name] = value
+			} else {
+				errs.Add(name, err)
+				if dynamicOnly {
+					u.RecordUpdate(name, shownValue, err)
+				}
+			}
+			continue
+		}
+		u.lastValues[name] = value
+		if dynamicOnly {
+			u.logger.Printf("flagz: updated flag=%v to value=%v", name, shownValue)
+			u.RecordUpdate(name, shownValue, nil)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+func (u *Updater) readValues() (map[string]string, error) {
+	values := make(map[string]string)
+	if u.configFile != "" {
+		// stat before reading, so that changes while reading are picked up by the next check.
+		stat, err := os.Stat(u.configFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := readConfigFile(u.configFile, values); err != nil {
+			return nil, err
+		}
+		u.lastStat = stat
+	}
+	if u.useEnv {
+		u.flagSet.VisitAll(func(f *flag.Flag) {
+			if value, ok := os.LookupEnv(envVarName(u.envPrefix, f.Name)); ok {
+				values[f.Name] = value
+			}
+		})
+	}
+	return values, nil
+}
+
+func (u *Updater) setFlag(ctx context.Context, flagName string, value string, dynamicOnly bool) error {
+	flag := u.flagSet.Lookup(flagName)
+	if flag == nil {
+		return flagz.ErrFlagNotFound
+	}
+	if dynamicOnly && !flagz.IsFlagDynamic(flag) {
+		return flagz.ErrFlagNotDynamic
+	}
+	// do not call flag.Value.Set, instead go through flagSet.Set (via SetFlagFromSource) to change "changed" state.
+	return flagz.SetFlagFromSourceCtx(ctx, u.flagSet, flagName, value, updaterSource)
+}
+
+// setElsewhere tells whether flag `name` was set by another source than this Updater, or on the command line.
+func (u *Updater) setElsewhere(name string) bool {
+	f := u.flagSet.Lookup(name)
+	if f == nil || !f.Changed {
+		return false
+	}
+	return flagz.FlagSource(f) != updaterSource
+}
+
+func readConfigFile(path string, values map[string]string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%v:%d: expected 'name = value', got %q", path, lineNo, line)
+		}
+		values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return scanner.Err()
+}
+
+func envVarName(prefix string, flagName string) string {
+	return prefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(flagName))
+}
+
+func signalTrigger(ctx context.Context, signals <-chan os.Signal) <-chan struct{} {
+	trigger := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-signals:
+				select {
+				case trigger <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return trigger
+}
+
+// newFromURL constructs an Updater from a `file:///path/to/flags.conf` URL. The optional `env_prefix` query parameter
+// enables reading environment variables as well, e.g. `file:///etc/myapp.conf?env_prefix=MYAPP_`.
+func newFromURL(flagSet *flag.FlagSet, source *url.URL, logger flagz.Logger) (flagz.Updater, error) {
+	u := New(flagSet, logger)
+	if source.Path != "" {
+		u.WithConfigFile(source.Path)
+	}
+	if prefix, ok := source.Query()["env_prefix"]; ok {
+		u.WithEnvPrefix(prefix[0])
+	}
+	return u, nil
+}
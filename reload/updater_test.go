@@ -0,0 +1,200 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package reload_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/reload"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type updaterTestSuite struct {
+	suite.Suite
+
+	tempDir    string
+	configFile string
+	trigger    chan struct{}
+
+	flagSet   *flag.FlagSet
+	staticInt *int32
+	dynInt    *flagz.DynInt64Value
+	dynString *flagz.DynStringValue
+
+	updater *reload.Updater
+}
+
+func (s *updaterTestSuite) SetupTest() {
+	var err error
+	s.tempDir, err = ioutil.TempDir("", "reload_test")
+	require.NoError(s.T(), err, "failed creating temp directory for testing")
+	s.configFile = path.Join(s.tempDir, "flags.conf")
+	s.writeConfig("# test config\nsome_int = 1234\nsome_dynint=10001\n\n")
+
+	s.flagSet = flag.NewFlagSet("updater_test", flag.ContinueOnError)
+	s.dynInt = flagz.DynInt64(s.flagSet, "some_dynint", 1, "dynamic int for testing")
+	s.dynString = flagz.DynString(s.flagSet, "some_dynstring", "default", "dynamic string for testing")
+	s.staticInt = s.flagSet.Int32("some_int", 1, "static int for testing")
+
+	s.trigger = make(chan struct{})
+	s.updater = reload.New(s.flagSet, &testingLog{T: s.T()}).WithConfigFile(s.configFile).WithTrigger(s.trigger)
+}
+
+func (s *updaterTestSuite) TearDownTest() {
+	s.updater.Stop()
+	os.Unsetenv("RELOADTEST_SOME_DYNSTRING")
+	require.NoError(s.T(), os.RemoveAll(s.tempDir), "clearing up the test dir must not fail")
+}
+
+func (s *updaterTestSuite) writeConfig(content string) {
+	require.NoError(s.T(), ioutil.WriteFile(s.configFile, []byte(content), 0644), "writing config must not fail")
+}
+
+func (s *updaterTestSuite) TestInitializeSetsValues() {
+	require.NoError(s.T(), s.updater.Initialize(), "initialize should not return errors on good flags")
+	assert.EqualValues(s.T(), 1234, *s.staticInt, "staticInt should be read from the config file")
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "dynInt should be read from the config file")
+}
+
+func (s *updaterTestSuite) TestInitializeFailsOnBadConfigLine() {
+	s.writeConfig("some_int 1234\n")
+	require.Error(s.T(), s.updater.Initialize(), "initialize should reject malformed lines")
+}
+
+func (s *updaterTestSuite) TestEnvironmentOverridesFile() {
+	os.Setenv("RELOADTEST_SOME_DYNSTRING", "from_env")
+	s.updater.WithEnvPrefix("RELOADTEST_")
+	require.NoError(s.T(), s.updater.Initialize())
+	assert.Equal(s.T(), "from_env", s.dynString.Get(), "dynString should be read from the environment")
+}
+
+func (s *updaterTestSuite) TestTriggerAppliesOnlyDynamicChanges() {
+	require.NoError(s.T(), s.updater.Initialize())
+	require.NoError(s.T(), s.updater.Start())
+	s.writeConfig("some_int = 4321\nsome_dynint = 20002\n")
+	s.trigger <- struct{}{}
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, 20002,
+		func() interface{} { return s.dynInt.Get() },
+		"some_dynint value should change after the trigger")
+	assert.EqualValues(s.T(), 1234, *s.staticInt, "static flags must not be reloaded")
+}
+
+func (s *updaterTestSuite) TestStatusAndEventsReflectReloads() {
+	require.NoError(s.T(), s.updater.Initialize())
+	require.NoError(s.T(), s.updater.Start())
+	status := s.updater.Status()
+	assert.True(s.T(), status.Initialized && status.Running, "status should reflect the started updater")
+
+	s.writeConfig("some_dynint = 20002\nsome_dynstring = bar\n")
+	s.trigger <- struct{}{}
+	select {
+	case event := <-s.updater.Events():
+		assert.Equal(s.T(), "some_dynint", event.FlagName, "events should be published in flag name order")
+		assert.Equal(s.T(), "20002", event.Value)
+		assert.NoError(s.T(), event.Err)
+	case <-time.After(1 * time.Second):
+		s.T().Fatalf("no update event was published after the trigger")
+	}
+	s.updater.Stop()
+	assert.False(s.T(), s.updater.Status().Running, "status should reflect the stopped updater")
+}
+
+func (s *updaterTestSuite) TestEventsRedactSecrets() {
+	flagz.MarkFlagSecret(s.flagSet.Lookup("some_dynstring"))
+	require.NoError(s.T(), s.updater.Initialize())
+	require.NoError(s.T(), s.updater.Start())
+	s.writeConfig("some_dynstring = hunter2\n")
+	s.trigger <- struct{}{}
+	select {
+	case event := <-s.updater.Events():
+		assert.Equal(s.T(), flagz.RedactedValue, event.Value, "secret values must not be published")
+	case <-time.After(1 * time.Second):
+		s.T().Fatalf("no update event was published after the trigger")
+	}
+	assert.Equal(s.T(), "hunter2", s.dynString.Get(), "secret flags must still be set")
+}
+
+func (s *updaterTestSuite) TestConstructedFromRegistry() {
+	os.Setenv("RELOADTEST_SOME_DYNSTRING", "from_env")
+	u, err := flagz.NewUpdater(s.flagSet, "file://"+s.configFile+"?env_prefix=RELOADTEST_", &testingLog{T: s.T()})
+	require.NoError(s.T(), err, "the file scheme should be registered")
+	require.NoError(s.T(), u.Initialize())
+	assert.EqualValues(s.T(), 10001, s.dynInt.Get(), "dynInt should be read from the config file")
+	assert.Equal(s.T(), "from_env", s.dynString.Get(), "dynString should be read from the environment")
+}
+
+func (s *updaterTestSuite) TestSighupReloads() {
+	u := reload.New(s.flagSet, &testingLog{T: s.T()}).WithConfigFile(s.configFile)
+	require.NoError(s.T(), u.Initialize())
+	require.NoError(s.T(), u.Start())
+	defer u.Stop()
+	s.writeConfig("some_dynint = 30003\n")
+	require.NoError(s.T(), syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	eventually(s.T(), 1*time.Second,
+		assert.ObjectsAreEqualValues, 30003,
+		func() interface{} { return s.dynInt.Get() },
+		"some_dynint value should change after SIGHUP")
+}
+
+func (s *updaterTestSuite) TestStopCancelsNotifiersOfUpdates() {
+	done := make(chan error, 1)
+	s.dynInt.WithNotifierCtx(func(ctx context.Context, oldValue int64, newValue int64) {
+		if newValue == 30003 {
+			<-ctx.Done()
+			done <- ctx.Err()
+		}
+	}, 0)
+	require.NoError(s.T(), s.updater.Initialize())
+	require.NoError(s.T(), s.updater.Start())
+	s.writeConfig("some_dynint = 30003\n")
+	s.trigger <- struct{}{}
+	<-s.updater.Events()
+	require.NoError(s.T(), s.updater.Stop())
+	select {
+	case err := <-done:
+		assert.Equal(s.T(), context.Canceled, err)
+	case <-time.After(1 * time.Second):
+		s.T().Fatalf("stopping the updater must cancel the notifiers of its updates")
+	}
+}
+
+func TestUpdaterSuite(t *testing.T) {
+	suite.Run(t, &updaterTestSuite{})
+}
+
+type assertFunc func(expected, actual interface{}) bool
+type getter func() interface{}
+
+// eventually tries a given Assert function 5 times over the period of time.
+func eventually(t *testing.T, duration time.Duration,
+	af assertFunc, expected interface{}, actual getter, msgFmt string, msgArgs ...interface{}) {
+	increment := duration / 5
+	for i := 0; i < 5; i++ {
+		time.Sleep(increment)
+		if af(expected, actual()) {
+			return
+		}
+	}
+	t.Fatalf(msgFmt, msgArgs...)
+}
+
+// Abstraction that allows us to pass the *testing.T as a logger to the updater.
+type testingLog struct {
+	T *testing.T
+}
+
+func (tl *testingLog) Printf(format string, v ...interface{}) {
+	tl.T.Logf(format+"\n", v...)
+}
@@ -0,0 +1,226 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package rollout automates staged rollouts of flag changes on top of the canary values and update acknowledgements
+// of the etcd updaters: a change is written as a canary of a growing percentage of instances, each stage waiting for
+// acks and health signals, and is then either promoted to the whole fleet or rolled back to the previous value.
+
+package rollout
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/watcher"
+	"golang.org/x/net/context"
+)
+
+const defaultAckTimeout = 1 * time.Minute
+
+// ErrNoPreviousValue is returned by `Run` for flags without a value in the Store, as there is nothing to roll back to.
+var ErrNoPreviousValue = errors.New("rollout: flag has no value to roll back to")
+
+// DefaultStages roll a change out to 1%, 10% and 50% of the instances, soaking for 5 minutes each, before promoting it.
+var DefaultStages = []Stage{
+	{Percentage: 1, Soak: 5 * time.Minute},
+	{Percentage: 10, Soak: 5 * time.Minute},
+	{Percentage: 50, Soak: 5 * time.Minute},
+	{Percentage: 100},
+}
+
+// Store reads and writes the raw values of flags in a backend watched by Updaters with acks enabled.
+type Store interface {
+	// Read returns the current value of flag `name`, or an empty string if it has none.
+	Read(ctx context.Context, name string) (string, error)
+	// Write stores `value` of flag `name`, returning the index (or revision) of the write.
+	Write(ctx context.Context, name string, value string) (uint64, error)
+	// WaitForAcks blocks until `quorum` instances acknowledged the write of `value` of flag `name` at `index`.
+	WaitForAcks(ctx context.Context, name string, index uint64, value string, quorum int) error
+}
+
+// Stage of a rollout, applying the change on a Percentage of the instances.
+type Stage struct {
+	// Percentage of instances applying the change, see `flagz.CanaryValue`. Stages of 100% write the plain value.
+	Percentage float64
+	// Acks is the number of instances that must acknowledge the write of the stage, whether they are in the canary or
+	// not. Zero doesn't wait for acks.
+	Acks int
+	// Soak is how long the stage runs before its health is checked.
+	Soak time.Duration
+}
+
+// HealthCheck checks the health signals of the fleet at the end of a stage, e.g. error rates of the canaries. Returning
+// an error rolls the change back.
+type HealthCheck func(ctx context.Context, flagName string, stage Stage) error
+
+// Rollout rolls changes out through its stages, see `Run`.
+type Rollout struct {
+	store      Store
+	logger     flagz.Logger
+	stages     []Stage
+	health     HealthCheck
+	ackTimeout time.Duration
+}
+
+// New constructs a Rollout writing to `store`, with the `DefaultStages`.
+func New(store Store, logger flagz.Logger) *Rollout {
+	return &Rollout{store: store, logger: logger, stages: DefaultStages, ackTimeout: defaultAckTimeout}
+}
+
+// WithStages replaces the `DefaultStages`. A final stage of 100% is added if the last one is less, so that runs
+// always end with the change promoted to the whole fleet.
+func (r *Rollout) WithStages(stages ...Stage) *Rollout {
+	if len(stages) == 0 || stages[len(stages)-1].Percentage < 100 {
+		stages = append(stages, Stage{Percentage: 100})
+	}
+	r.stages = stages
+	return r
+}
+
+// WithHealthCheck sets the check of the health of the fleet at the end of each stage.
+func (r *Rollout) WithHealthCheck(health HealthCheck) *Rollout {
+	r.health = health
+	return r
+}
+
+// WithAckTimeout sets how long each stage waits for its acks before the change is rolled back. Defaults to a minute.
+func (r *Rollout) WithAckTimeout(timeout time.Duration) *Rollout {
+	r.ackTimeout = timeout
+	return r
+}
+
+// Run rolls `value` of flag `flagName` out through the stages. Any failure of a stage (a write, missing acks, or the
+// health check) rolls the flag back to its previous value, returning the error of the stage. Cancelling `ctx` rolls
+// the flag back too.
+func (r *Rollout) Run(ctx context.Context, flagName string, value string) error {
+	previous, err := r.store.Read(ctx, flagName)
+	if err != nil {
+		return fmt.Errorf("rollout: reading flag %v: %v", flagName, err)
+	}
+	if previous == "" {
+		return ErrNoPreviousValue
+	}
+	if flagz.IsCanaryValue(previous) {
+		return fmt.Errorf("rollout: flag %v has a canary value, another rollout may be in progress", flagName)
+	}
+	for i, stage := range r.stages {
+		if err := r.runStage(ctx, flagName, value, previous, stage); err != nil {
+			r.logger.Printf("rollout: stage %d (%v%%) of flag=%v failed, rolling back: %v", i, stage.Percentage,
+				flagName, err)
+			// the rollback must happen even if `ctx` was cancelled.
+			if _, rollbackErr := r.store.Write(context.Background(), flagName, previous); rollbackErr != nil {
+				return fmt.Errorf("rollout: stage %d of flag %v failed: %v, and rolling back failed: %v", i, flagName,
+					err, rollbackErr)
+			}
+			return fmt.Errorf("rollout: stage %d of flag %v failed: %v", i, flagName, err)
+		}
+		r.logger.Printf("rollout: stage %d (%v%%) of flag=%v succeeded", i, stage.Percentage, flagName)
+	}
+	return nil
+}
+
+func (r *Rollout) runStage(ctx context.Context, flagName string, value string, previous string, stage Stage) error {
+	written := value
+	if stage.Percentage < 100 {
+		canary := &flagz.CanaryValue{Percentage: stage.Percentage, Value: value, Otherwise: previous}
+		var err error
+		if written, err = canary.Encode(); err != nil {
+			return err
+		}
+	}
+	index, err := r.store.Write(ctx, flagName, written)
+	if err != nil {
+		return fmt.Errorf("writing: %v", err)
+	}
+	if stage.Acks > 0 {
+		ackCtx, cancel := context.WithTimeout(ctx, r.ackTimeout)
+		defer cancel()
+		if err := r.store.WaitForAcks(ackCtx, flagName, index, written, stage.Acks); err != nil {
+			return fmt.Errorf("waiting for %d acks: %v", stage.Acks, err)
+		}
+	}
+	select {
+	case <-time.After(stage.Soak):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if r.health != nil {
+		if err := r.health(ctx, flagName, stage); err != nil {
+			return fmt.Errorf("health check: %v", err)
+		}
+	}
+	return nil
+}
+
+// EtcdStore is a Store of the etcd v2 tree of a `watcher.Watcher`, with acks enabled `WithAcks`.
+type EtcdStore struct {
+	keys    etcd.KeysAPI
+	path    string
+	ackPath string
+}
+
+// NewEtcdStore constructs an EtcdStore of the flags under `path`, acknowledged under `ackPath`.
+func NewEtcdStore(keys etcd.KeysAPI, path string, ackPath string) *EtcdStore {
+	return &EtcdStore{keys: keys, path: path, ackPath: ackPath}
+}
+
+// Read implements Store.
+func (s *EtcdStore) Read(ctx context.Context, name string) (string, error) {
+	key, err := s.valueKey(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.keys.Get(ctx, key, nil)
+	if etcdErr, ok := err.(etcd.Error); ok && etcdErr.Code == etcd.ErrorCodeKeyNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return resp.Node.Value, nil
+}
+
+// Write implements Store.
+func (s *EtcdStore) Write(ctx context.Context, name string, value string) (uint64, error) {
+	key, err := s.valueKey(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.keys.Set(ctx, key, value, nil)
+	if err != nil {
+		return 0, err
+	}
+	return resp.Node.ModifiedIndex, nil
+}
+
+// WaitForAcks implements Store.
+func (s *EtcdStore) WaitForAcks(ctx context.Context, name string, index uint64, value string, quorum int) error {
+	_, err := watcher.WaitForAcks(ctx, s.keys, s.ackPath, name, index, flagz.ValueChecksum(value), quorum)
+	return err
+}
+
+// valueKey returns the key holding the global value of flag `name`: `<flag key>/__global` if the flag has instance
+// overrides, which turn its key into a directory (see `watcher.Watcher`), and the flag key itself otherwise.
+func (s *EtcdStore) valueKey(ctx context.Context, name string) (string, error) {
+	key := s.key(name)
+	resp, err := s.keys.Get(ctx, key, nil)
+	if etcdErr, ok := err.(etcd.Error); ok && etcdErr.Code == etcd.ErrorCodeKeyNotFound {
+		return key, nil
+	} else if err != nil {
+		return "", err
+	}
+	if resp.Node.Dir {
+		return key + "/" + watcher.GlobalValueKey, nil
+	}
+	return key, nil
+}
+
+// key returns the flag key of flag `name`, with namespaces mapped onto directories, see `flagz.KeyPathToFlagName`.
+func (s *EtcdStore) key(name string) string {
+	if len(s.path) > 0 && s.path[len(s.path)-1] == '/' {
+		return s.path + flagz.FlagNameToKeyPath(name)
+	}
+	return s.path + "/" + flagz.FlagNameToKeyPath(name)
+}
@@ -0,0 +1,194 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package rollout_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/rollout"
+	"github.com/mwitkow/go-flagz/watcher"
+	"github.com/mwitkow/go-flagz/watcher/etcdtest"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+const prefix = "/flagz/test/"
+
+func TestRollout_PromotesThroughStages(t *testing.T) {
+	store := newFakeStore(map[string]string{"some_flag": "old"})
+	var checked []float64
+	r := rollout.New(store, &testingLog{T: t}).
+		WithStages(rollout.Stage{Percentage: 10, Acks: 1}, rollout.Stage{Percentage: 50}).
+		WithHealthCheck(func(ctx context.Context, flagName string, stage rollout.Stage) error {
+			checked = append(checked, stage.Percentage)
+			return nil
+		})
+	require.NoError(t, r.Run(context.Background(), "some_flag", "new"))
+
+	require.Len(t, store.writes, 3, "a final stage of 100% must be added")
+	canary, err := flagz.ParseCanaryValue(store.writes[0])
+	require.NoError(t, err)
+	assert.Equal(t, &flagz.CanaryValue{Percentage: 10, Value: "new", Otherwise: "old"}, canary)
+	canary, err = flagz.ParseCanaryValue(store.writes[1])
+	require.NoError(t, err)
+	assert.EqualValues(t, 50, canary.Percentage)
+	assert.Equal(t, "new", store.writes[2], "the last stage must write the plain value")
+	assert.Equal(t, []float64{10, 50, 100}, checked)
+	assert.Equal(t, []string{store.writes[0]}, store.waited, "only stages with Acks must wait for them")
+}
+
+func TestRollout_RollsBackOnFailedHealthCheck(t *testing.T) {
+	store := newFakeStore(map[string]string{"some_flag": "old"})
+	r := rollout.New(store, &testingLog{T: t}).
+		WithStages(rollout.Stage{Percentage: 10}, rollout.Stage{Percentage: 50}).
+		WithHealthCheck(func(ctx context.Context, flagName string, stage rollout.Stage) error {
+			if stage.Percentage == 50 {
+				return errors.New("error rate too high")
+			}
+			return nil
+		})
+	err := r.Run(context.Background(), "some_flag", "new")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "error rate too high")
+	assert.Len(t, store.writes, 3)
+	assert.Equal(t, "old", store.values["some_flag"], "the flag must be rolled back")
+}
+
+func TestRollout_RollsBackOnMissingAcks(t *testing.T) {
+	store := newFakeStore(map[string]string{"some_flag": "old"})
+	store.ackErr = context.DeadlineExceeded
+	r := rollout.New(store, &testingLog{T: t}).WithStages(rollout.Stage{Percentage: 10, Acks: 3})
+	require.Error(t, r.Run(context.Background(), "some_flag", "new"))
+	assert.Equal(t, "old", store.values["some_flag"], "the flag must be rolled back")
+}
+
+func TestRollout_RollsBackOnCancellation(t *testing.T) {
+	store := newFakeStore(map[string]string{"some_flag": "old"})
+	r := rollout.New(store, &testingLog{T: t}).WithStages(rollout.Stage{Percentage: 10, Soak: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, r.Run(ctx, "some_flag", "new"))
+	assert.Equal(t, "old", store.values["some_flag"], "the flag must be rolled back")
+}
+
+func TestRollout_RefusesFlagsItCannotRollBack(t *testing.T) {
+	inProgress, err := (&flagz.CanaryValue{Percentage: 10, Value: "new"}).Encode()
+	require.NoError(t, err)
+	store := newFakeStore(map[string]string{"canaried_flag": inProgress})
+	r := rollout.New(store, &testingLog{T: t})
+	assert.Equal(t, rollout.ErrNoPreviousValue, r.Run(context.Background(), "missing_flag", "new"))
+	assert.Error(t, r.Run(context.Background(), "canaried_flag", "new"))
+	assert.Empty(t, store.writes)
+}
+
+func TestEtcdStore_RollsOutToWatchers(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"some_dynint", "1", nil)
+	var dynInts []*flagz.DynInt64Value
+	for _, instance := range []string{"frontend-1", "frontend-2"} {
+		set := flag.NewFlagSet(instance, flag.ContinueOnError)
+		dynInts = append(dynInts, flagz.DynInt64(set, "some_dynint", 0, "dynamic int"))
+		w, err := watcher.New(set, keys, prefix, &testingLog{T: t})
+		require.NoError(t, err)
+		w.WithAcks("/flagz/acks", time.Minute).WithInstanceID(instance)
+		require.NoError(t, w.Initialize())
+		require.NoError(t, w.Start())
+		defer w.Stop()
+	}
+
+	store := rollout.NewEtcdStore(keys, prefix, "/flagz/acks")
+	r := rollout.New(store, &testingLog{T: t}).
+		WithStages(rollout.Stage{Percentage: 50, Acks: 2}, rollout.Stage{Percentage: 100, Acks: 2}).
+		WithAckTimeout(time.Second)
+	require.NoError(t, r.Run(ctx, "some_dynint", "2"))
+	for _, dynInt := range dynInts {
+		assert.EqualValues(t, 2, dynInt.Get(), "all instances must apply the promoted value")
+	}
+	value, err := store.Read(ctx, "some_dynint")
+	require.NoError(t, err)
+	assert.Equal(t, "2", value)
+}
+
+func TestEtcdStore_WritesKeysOfNamespacesAndOverriddenFlags(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"cache/ttl", "1s", nil)
+	keys.Set(ctx, prefix+"some_dynint/__global", "1", nil)
+	keys.Set(ctx, prefix+"some_dynint/__hosts/frontend-1", "5", nil)
+	store := rollout.NewEtcdStore(keys, prefix, "/flagz/acks")
+
+	value, err := store.Read(ctx, "cache.ttl")
+	require.NoError(t, err)
+	assert.Equal(t, "1s", value, "namespaces must be read from nested keys")
+	_, err = store.Write(ctx, "cache.ttl", "2s")
+	require.NoError(t, err)
+	resp, err := keys.Get(ctx, prefix+"cache/ttl", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "2s", resp.Node.Value, "namespaces must be written to nested keys")
+
+	value, err = store.Read(ctx, "some_dynint")
+	require.NoError(t, err)
+	assert.Equal(t, "1", value, "global values of overridden flags must be read")
+	_, err = store.Write(ctx, "some_dynint", "2")
+	require.NoError(t, err)
+	resp, err = keys.Get(ctx, prefix+"some_dynint/__global", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "2", resp.Node.Value, "global values of overridden flags must be written")
+	resp, err = keys.Get(ctx, prefix+"some_dynint/__hosts/frontend-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "5", resp.Node.Value, "overrides must be kept")
+}
+
+// fakeStore is an in-memory Store, acknowledging all writes unless ackErr is set.
+type fakeStore struct {
+	mu     sync.Mutex
+	values map[string]string
+	writes []string
+	waited []string
+	ackErr error
+}
+
+func newFakeStore(values map[string]string) *fakeStore {
+	return &fakeStore{values: values}
+}
+
+func (s *fakeStore) Read(ctx context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[name], nil
+}
+
+func (s *fakeStore) Write(ctx context.Context, name string, value string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[name] = value
+	s.writes = append(s.writes, value)
+	return uint64(len(s.writes)), nil
+}
+
+func (s *fakeStore) WaitForAcks(ctx context.Context, name string, index uint64, value string, quorum int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if uint64(len(s.writes)) != index || s.writes[index-1] != value {
+		return fmt.Errorf("waiting for acks of write %d, which isn't the last one", index)
+	}
+	s.waited = append(s.waited, value)
+	return s.ackErr
+}
+
+type testingLog struct {
+	T *testing.T
+}
+
+func (tl *testingLog) Printf(format string, v ...interface{}) {
+	tl.T.Logf(format+"\n", v...)
+}
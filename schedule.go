@@ -0,0 +1,390 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// ScheduledValuePrefix marks values annotated with an activation schedule, followed by the JSON of a
+	// ScheduledValue, e.g. `sched:{"value":"true","otherwise":"false","cron":"0 2 * * 6","duration":"2h"}`.
+	ScheduledValuePrefix = "sched:"
+
+	// SchedulerSource is recorded (see `FlagSource`) as the origin of the values set by a Scheduler.
+	SchedulerSource = "scheduler"
+
+	// cronSearchLimit bounds the search for the next time matching a cron expression, e.g. `0 0 30 2 *`.
+	cronSearchLimit = 5 * 366 * 24 * time.Hour
+)
+
+// ScheduledValue is a flag value that only takes effect during an activation window, so a change written today can
+// take effect at a planned time. Schedules are evaluated against absolute times (cron expressions in UTC), so every
+// instance applies the change at the same moment, within the skew of their clocks.
+//
+// The window is [Start, End), either bound being optional, further narrowed to the periods of Duration starting at
+// the times matching Cron if it is set.
+type ScheduledValue struct {
+	// Value is set when the window opens.
+	Value string
+	// Otherwise is set when the window closes. If empty, the flag keeps whatever value it has outside of the window.
+	Otherwise string
+	Start     time.Time
+	End       time.Time
+	// Cron is a standard 5 field (minute, hour, day of month, month, day of week) cron expression, evaluated in UTC.
+	Cron     string
+	Duration time.Duration
+
+	cron *cronSchedule
+}
+
+type scheduledValueJSON struct {
+	Value     string    `json:"value"`
+	Otherwise string    `json:"otherwise,omitempty"`
+	Start     time.Time `json:"start,omitempty"`
+	End       time.Time `json:"end,omitempty"`
+	Cron      string    `json:"cron,omitempty"`
+	Duration  string    `json:"duration,omitempty"`
+}
+
+// IsScheduledValue tells whether `value` carries a ScheduledValue.
+func IsScheduledValue(value string) bool {
+	return strings.HasPrefix(value, ScheduledValuePrefix)
+}
+
+// ParseScheduledValue parses a value with the `ScheduledValuePrefix`, as produced by `ScheduledValue.Encode`.
+func ParseScheduledValue(value string) (*ScheduledValue, error) {
+	if !IsScheduledValue(value) {
+		return nil, fmt.Errorf("scheduled value must start with %q", ScheduledValuePrefix)
+	}
+	wire := &scheduledValueJSON{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(value, ScheduledValuePrefix)), wire); err != nil {
+		return nil, fmt.Errorf("parsing scheduled value: %v", err)
+	}
+	sv := &ScheduledValue{Value: wire.Value, Otherwise: wire.Otherwise, Start: wire.Start, End: wire.End, Cron: wire.Cron}
+	if wire.Duration != "" {
+		duration, err := time.ParseDuration(wire.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("parsing scheduled value duration: %v", err)
+		}
+		sv.Duration = duration
+	}
+	if err := sv.compile(); err != nil {
+		return nil, err
+	}
+	return sv, nil
+}
+
+// Encode returns the value to write to a backend for the ScheduledValue.
+func (s *ScheduledValue) Encode() (string, error) {
+	if err := s.compile(); err != nil {
+		return "", err
+	}
+	wire := &scheduledValueJSON{Value: s.Value, Otherwise: s.Otherwise, Start: s.Start, End: s.End, Cron: s.Cron}
+	if s.Duration != 0 {
+		wire.Duration = s.Duration.String()
+	}
+	out, err := json.Marshal(wire)
+	if err != nil {
+		return "", err
+	}
+	return ScheduledValuePrefix + string(out), nil
+}
+
+func (s *ScheduledValue) compile() error {
+	if !s.Start.IsZero() && !s.End.IsZero() && !s.End.After(s.Start) {
+		return fmt.Errorf("scheduled value must end after it starts")
+	}
+	if s.Cron == "" {
+		if s.Duration != 0 {
+			return fmt.Errorf("scheduled value duration needs a cron expression")
+		}
+		return nil
+	}
+	if s.Duration <= 0 {
+		return fmt.Errorf("scheduled value cron expression needs a positive duration")
+	}
+	cron, err := parseCron(s.Cron)
+	if err != nil {
+		return err
+	}
+	s.cron = cron
+	return nil
+}
+
+// Active tells whether `t` falls within the activation window.
+func (s *ScheduledValue) Active(t time.Time) bool {
+	if (!s.Start.IsZero() && t.Before(s.Start)) || (!s.End.IsZero() && !t.Before(s.End)) {
+		return false
+	}
+	if s.cron == nil {
+		return true
+	}
+	// the window of the first time matching after `t - Duration` covers `t` if that time isn't after `t`.
+	fire, ok := s.cron.next(t.Add(-s.Duration))
+	return ok && !fire.After(t)
+}
+
+// ValueAt returns the value the flag should have at `t`, and false if it should keep its value.
+func (s *ScheduledValue) ValueAt(t time.Time) (string, bool) {
+	if s.Active(t) {
+		return s.Value, true
+	}
+	return s.Otherwise, s.Otherwise != ""
+}
+
+// NextChange returns the first time after `t` at which the activation window may open or close, and false if it never
+// will again.
+func (s *ScheduledValue) NextChange(t time.Time) (time.Time, bool) {
+	var next time.Time
+	consider := func(candidate time.Time) {
+		if candidate.After(t) && (next.IsZero() || candidate.Before(next)) {
+			next = candidate
+		}
+	}
+	if !s.End.IsZero() && !t.Before(s.End) {
+		return time.Time{}, false
+	}
+	consider(s.Start)
+	consider(s.End)
+	if s.cron != nil {
+		from := t
+		if s.Start.After(t) {
+			from = s.Start
+		}
+		if fire, ok := s.cron.next(from.Add(-s.Duration)); ok {
+			if fire.After(from) {
+				consider(fire)
+			} else {
+				consider(fire.Add(s.Duration))
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Scheduler applies ScheduledValues to the flags of a FlagSet as their activation windows open and close. Updaters
+// hand it the scheduled values they read, see `watcher.WithScheduler`.
+type Scheduler struct {
+	flagSet *flag.FlagSet
+	logger  Logger
+
+	mu      sync.Mutex
+	entries map[string]*scheduledEntry
+	stopped bool
+}
+
+type scheduledEntry struct {
+	value *ScheduledValue
+	timer *time.Timer
+	next  time.Time
+}
+
+// NewScheduler creates a Scheduler of the flags of `flagSet`, logging the values it applies to `logger`.
+func NewScheduler(flagSet *flag.FlagSet, logger Logger) *Scheduler {
+	return &Scheduler{flagSet: flagSet, logger: logger, entries: make(map[string]*scheduledEntry)}
+}
+
+// Schedule replaces the schedule of flag `name` with `sv`, immediately setting the value for the current time (if any)
+// and returning the error of setting it.
+func (s *Scheduler) Schedule(name string, sv *ScheduledValue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return fmt.Errorf("flagz: scheduler is stopped")
+	}
+	if s.flagSet.Lookup(name) == nil {
+		return ErrFlagNotFound
+	}
+	s.cancelLocked(name)
+	now := time.Now()
+	if value, ok := sv.ValueAt(now); ok {
+		if err := SetFlagFromSource(s.flagSet, name, value, SchedulerSource); err != nil && !errors.Is(err, ErrFlagPinned) {
+			return err
+		}
+	}
+	entry := &scheduledEntry{value: sv}
+	s.entries[name] = entry
+	s.armLocked(name, entry, now)
+	return nil
+}
+
+// Cancel drops the schedule of flag `name`, e.g. because an unscheduled value was written for it. The flag keeps its
+// current value.
+func (s *Scheduler) Cancel(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancelLocked(name)
+}
+
+// NextChange returns the next time the schedule of flag `name` may change its value, and false if there is none.
+func (s *Scheduler) NextChange(name string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[name]
+	if !ok || entry.timer == nil {
+		return time.Time{}, false
+	}
+	return entry.next, true
+}
+
+// Stop cancels all schedules. Flags keep their current values.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name := range s.entries {
+		s.cancelLocked(name)
+	}
+	s.stopped = true
+}
+
+func (s *Scheduler) cancelLocked(name string) {
+	if entry, ok := s.entries[name]; ok {
+		if entry.timer != nil {
+			entry.timer.Stop()
+		}
+		delete(s.entries, name)
+	}
+}
+
+func (s *Scheduler) armLocked(name string, entry *scheduledEntry, now time.Time) {
+	next, ok := entry.value.NextChange(now)
+	if !ok {
+		entry.timer = nil
+		return
+	}
+	entry.next = next
+	entry.timer = time.AfterFunc(next.Sub(now), func() { s.fire(name, entry) })
+}
+
+func (s *Scheduler) fire(name string, entry *scheduledEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[name] != entry {
+		// replaced or cancelled after the timer fired.
+		return
+	}
+	now := time.Now()
+	if now.Before(entry.next) {
+		// timers may fire marginally early, the window is evaluated at the planned time.
+		now = entry.next
+	}
+	if value, ok := entry.value.ValueAt(now); ok && s.flagSet.Lookup(name).Value.String() != value {
+		if err := SetFlagFromSource(s.flagSet, name, value, SchedulerSource); err != nil {
+			if errors.Is(err, ErrFlagPinned) {
+				s.logger.Printf("flagz: holding update of pinned flag=%v until it is unpinned", name)
+			} else {
+				s.logger.Printf("flagz: failed applying scheduled value of flag=%v, because of: %v", name, err)
+			}
+		} else {
+			s.logger.Printf("flagz: applied scheduled value of flag=%v to value=%v", name,
+				RedactFlagValue(s.flagSet.Lookup(name), value))
+		}
+	}
+	s.armLocked(name, entry, now)
+}
+
+// cronSchedule is a parsed cron expression, with the matching values of each field as bits.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar tell whether a field is unrestricted, as a day matches either restricted day field.
+	domStar, dowStar bool
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+	c := &cronSchedule{domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	var err error
+	for i, field := range []struct {
+		bits     *uint64
+		min, max int
+	}{{&c.minute, 0, 59}, {&c.hour, 0, 23}, {&c.dom, 1, 31}, {&c.month, 1, 12}, {&c.dow, 0, 7}} {
+		if *field.bits, err = parseCronField(fields[i], field.min, field.max); err != nil {
+			return nil, fmt.Errorf("cron expression %q: %v", expr, err)
+		}
+	}
+	// both 0 and 7 are Sunday.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[idx+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			rangePart = part[:idx]
+		}
+		low, high := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("bad value in %q", part)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("bad value in %q", part)
+				}
+			} else if step != 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q not in [%v, %v] range", part, min, max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// next returns the first time strictly after `t` matching the cron expression.
+func (c *cronSchedule) next(t time.Time) (time.Time, bool) {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,148 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func utc(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestScheduledValue_EncodeAndParse(t *testing.T) {
+	sv := &flagz.ScheduledValue{Value: "true", Otherwise: "false", Start: utc("2026-10-15T02:00:00Z"), Cron: "0 2 * * 6",
+		Duration: 2 * time.Hour}
+	encoded, err := sv.Encode()
+	require.NoError(t, err)
+	assert.True(t, flagz.IsScheduledValue(encoded))
+	parsed, err := flagz.ParseScheduledValue(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, sv.Value, parsed.Value)
+	assert.Equal(t, sv.Otherwise, parsed.Otherwise)
+	assert.True(t, sv.Start.Equal(parsed.Start))
+	assert.Equal(t, sv.Duration, parsed.Duration)
+
+	for _, input := range []string{
+		`true`,
+		`sched:{"value": "1", "start": "2026-10-15T02:00:00Z", "end": "2026-10-15T01:00:00Z"}`,
+		`sched:{"value": "1", "cron": "0 2 * * *"}`,
+		`sched:{"value": "1", "duration": "1h"}`,
+		`sched:{"value": "1", "cron": "0 2 * *", "duration": "1h"}`,
+		`sched:{"value": "1", "cron": "60 2 * * *", "duration": "1h"}`,
+		`sched:{"value": "1", "cron": "0 2 * * */0", "duration": "1h"}`,
+	} {
+		_, err := flagz.ParseScheduledValue(input)
+		assert.Error(t, err, "value %v must be rejected", input)
+	}
+}
+
+func TestScheduledValue_TimeWindow(t *testing.T) {
+	sv, err := flagz.ParseScheduledValue(
+		`sched:{"value": "on", "start": "2026-10-15T02:00:00Z", "end": "2026-10-15T04:00:00Z"}`)
+	require.NoError(t, err)
+	_, ok := sv.ValueAt(utc("2026-10-15T01:59:59Z"))
+	assert.False(t, ok, "flags must keep their values outside of windows without otherwise")
+	value, ok := sv.ValueAt(utc("2026-10-15T02:00:00Z"))
+	assert.True(t, ok)
+	assert.Equal(t, "on", value)
+	assert.False(t, sv.Active(utc("2026-10-15T04:00:00Z")), "windows must not include their end")
+
+	next, ok := sv.NextChange(utc("2026-10-14T12:00:00Z"))
+	assert.True(t, ok)
+	assert.Equal(t, utc("2026-10-15T02:00:00Z"), next)
+	next, _ = sv.NextChange(utc("2026-10-15T03:00:00Z"))
+	assert.Equal(t, utc("2026-10-15T04:00:00Z"), next)
+	_, ok = sv.NextChange(utc("2026-10-15T04:00:00Z"))
+	assert.False(t, ok, "closed windows must never change again")
+}
+
+func TestScheduledValue_CronWindow(t *testing.T) {
+	// from 02:00 to 04:00 UTC every Saturday, starting from the 17th of October 2026.
+	sv, err := flagz.ParseScheduledValue(
+		`sched:{"value": "on", "otherwise": "off", "start": "2026-10-17T00:00:00Z", "cron": "0 2 * * 6", "duration": "2h"}`)
+	require.NoError(t, err)
+	assert.False(t, sv.Active(utc("2026-10-10T03:00:00Z")), "windows before the start must not be active")
+	assert.False(t, sv.Active(utc("2026-10-16T03:00:00Z")), "other days must not be active")
+	assert.True(t, sv.Active(utc("2026-10-17T02:00:00Z")))
+	assert.True(t, sv.Active(utc("2026-10-24T03:59:00Z")))
+	value, _ := sv.ValueAt(utc("2026-10-24T04:00:00Z"))
+	assert.Equal(t, "off", value)
+
+	next, _ := sv.NextChange(utc("2026-10-10T03:00:00Z"))
+	assert.Equal(t, utc("2026-10-17T00:00:00Z"), next, "the start must be the next change")
+	next, _ = sv.NextChange(utc("2026-10-17T00:00:00Z"))
+	assert.Equal(t, utc("2026-10-17T02:00:00Z"), next)
+	next, _ = sv.NextChange(utc("2026-10-17T02:30:00Z"))
+	assert.Equal(t, utc("2026-10-17T04:00:00Z"), next)
+	next, _ = sv.NextChange(utc("2026-10-17T04:00:00Z"))
+	assert.Equal(t, utc("2026-10-24T02:00:00Z"), next)
+}
+
+func TestScheduledValue_CronFields(t *testing.T) {
+	// every 15 minutes of 09:00-10:59 on the 1st of the month and on Sundays.
+	sv, err := flagz.ParseScheduledValue(`sched:{"value": "on", "cron": "*/15 9-10 1 * 7", "duration": "1m"}`)
+	require.NoError(t, err)
+	assert.True(t, sv.Active(utc("2026-11-01T10:45:30Z")))
+	assert.True(t, sv.Active(utc("2026-10-18T09:15:00Z")), "either restricted day field must match")
+	assert.False(t, sv.Active(utc("2026-10-18T09:16:00Z")))
+	assert.False(t, sv.Active(utc("2026-10-18T11:00:00Z")))
+	assert.False(t, sv.Active(utc("2026-10-19T09:00:00Z")))
+}
+
+func TestScheduler_AppliesWindows(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_int_1", 0, "Use it or lose it")
+	scheduler := flagz.NewScheduler(set, &testingLog{T: t})
+	defer scheduler.Stop()
+	now := time.Now()
+	sv := &flagz.ScheduledValue{Value: "2", Otherwise: "1", Start: now.Add(100 * time.Millisecond),
+		End: now.Add(300 * time.Millisecond)}
+	require.NoError(t, scheduler.Schedule("some_int_1", sv))
+	assert.EqualValues(t, 1, dynInt.Get(), "the value for the current time must be set immediately")
+	next, ok := scheduler.NextChange("some_int_1")
+	assert.True(t, ok)
+	assert.True(t, next.Equal(sv.Start))
+
+	assert.Eventually(t, func() bool { return dynInt.Get() == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, flagz.SchedulerSource, flagz.FlagSource(set.Lookup("some_int_1")))
+	assert.Eventually(t, func() bool { return dynInt.Get() == 1 }, time.Second, 5*time.Millisecond)
+	_, ok = scheduler.NextChange("some_int_1")
+	assert.False(t, ok, "closed windows must not be pending")
+
+	assert.Equal(t, flagz.ErrFlagNotFound, scheduler.Schedule("missing", sv))
+	assert.Error(t, scheduler.Schedule("some_int_1", &flagz.ScheduledValue{Value: "nope"}))
+}
+
+func TestScheduler_Cancel(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_int_1", 0, "Use it or lose it")
+	scheduler := flagz.NewScheduler(set, &testingLog{T: t})
+	sv := &flagz.ScheduledValue{Value: "2", Start: time.Now().Add(50 * time.Millisecond)}
+	require.NoError(t, scheduler.Schedule("some_int_1", sv))
+	scheduler.Cancel("some_int_1")
+	time.Sleep(100 * time.Millisecond)
+	assert.EqualValues(t, 0, dynInt.Get(), "cancelled schedules must not be applied")
+
+	scheduler.Stop()
+	assert.Error(t, scheduler.Schedule("some_int_1", sv), "stopped schedulers must not accept schedules")
+}
+
+type testingLog struct {
+	T *testing.T
+}
+
+func (tl *testingLog) Printf(format string, v ...interface{}) {
+	tl.T.Logf(format+"\n", v...)
+}
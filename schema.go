@@ -0,0 +1,100 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchemaProvider is implemented by flag values taking structured JSON inputs (e.g. `DynJSON` and `DynProto3`),
+// so that admin UIs can render structured editors and validate inputs client-side.
+type JSONSchemaProvider interface {
+	// JSONSchema returns the JSON Schema (draft-07) of the inputs accepted by `Set`.
+	JSONSchema() map[string]interface{}
+}
+
+// FlagJSONSchema returns the JSON Schema of the inputs of `f`, or nil if its value doesn't describe them.
+func FlagJSONSchema(f *flag.Flag) map[string]interface{} {
+	if p, ok := f.Value.(JSONSchemaProvider); ok {
+		return p.JSONSchema()
+	}
+	return nil
+}
+
+// JSONSchema returns the JSON Schema of the inputs, generated from the Go type of the value and its `json` tags.
+func (d *DynJSONValue) JSONSchema() map[string]interface{} {
+	schema := GoTypeJSONSchema(d.structType)
+	schema["$schema"] = jsonSchemaDraft
+	return schema
+}
+
+// GoTypeJSONSchema returns the JSON Schema of the JSON encoding of values of type `t`, as done by `encoding/json`.
+// Interfaces and types implementing `json.Marshaler` accept any value. Recursive types aren't supported.
+func GoTypeJSONSchema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(reflect.TypeOf((*json.Marshaler)(nil)).Elem()) {
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return GoTypeJSONSchema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": GoTypeJSONSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": GoTypeJSONSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		addStructProperties(t, properties)
+		return map[string]interface{}{"type": "object", "properties": properties}
+	}
+	return map[string]interface{}{}
+}
+
+func addStructProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			// fields of embedded structs are promoted, as done by encoding/json.
+			addStructProperties(fieldType, properties)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = GoTypeJSONSchema(field.Type)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"testing"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+type schemaEmbedded struct {
+	Promoted bool `json:"promoted"`
+}
+
+type schemaTestStruct struct {
+	schemaEmbedded
+	Name     string            `json:"name,omitempty"`
+	Count    int64             `json:"count"`
+	Ratio    *float64          `json:"ratio"`
+	Tags     []string          `json:"tags"`
+	Limits   map[string]uint32 `json:"limits"`
+	Raw      []byte            `json:"raw"`
+	Deadline time.Time         `json:"deadline"`
+	Skipped  string            `json:"-"`
+	Untagged string
+	hidden   string
+}
+
+func TestDynJSON_JSONSchema(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	DynJSON(set, "some_json", &schemaTestStruct{}, "Use it or lose it")
+	set.String("some_string", "", "Static string")
+
+	schema := FlagJSONSchema(set.Lookup("some_json"))
+	assert.Equal(t, jsonSchemaDraft, schema["$schema"])
+	assert.Equal(t, "object", schema["type"])
+	assert.Equal(t, map[string]interface{}{
+		"promoted": map[string]interface{}{"type": "boolean"},
+		"name":     map[string]interface{}{"type": "string"},
+		"count":    map[string]interface{}{"type": "integer"},
+		"ratio":    map[string]interface{}{"type": "number"},
+		"tags":     map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		"limits":   map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "integer"}},
+		"raw":      map[string]interface{}{"type": "string", "contentEncoding": "base64"},
+		"deadline": map[string]interface{}{"type": "string", "format": "date-time"},
+		"Untagged": map[string]interface{}{"type": "string"},
+	}, schema["properties"])
+
+	assert.Nil(t, FlagJSONSchema(set.Lookup("some_string")), "flags without structured inputs have no schema")
+}
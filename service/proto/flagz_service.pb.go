@@ -0,0 +1,814 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: flagz_service.proto
+
+package flagz_service
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Flag struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Name        string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Description string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	// Type of the flag's value, e.g. `dyn_int64` or `string`.
+	Type         string `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	CurrentValue string `protobuf:"bytes,4,opt,name=current_value,json=currentValue,proto3" json:"current_value,omitempty"`
+	DefaultValue string `protobuf:"bytes,5,opt,name=default_value,json=defaultValue,proto3" json:"default_value,omitempty"`
+	IsDynamic    bool   `protobuf:"varint,6,opt,name=is_dynamic,json=isDynamic,proto3" json:"is_dynamic,omitempty"`
+	IsChanged    bool   `protobuf:"varint,7,opt,name=is_changed,json=isChanged,proto3" json:"is_changed,omitempty"`
+	// Time of the last change, only known for dynamic flags that were set after creation.
+	LastChanged   *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=last_changed,json=lastChanged,proto3" json:"last_changed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Flag) Reset() {
+	*x = Flag{}
+	mi := &file_flagz_service_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Flag) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Flag) ProtoMessage() {}
+
+func (x *Flag) ProtoReflect() protoreflect.Message {
+	mi := &file_flagz_service_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Flag.ProtoReflect.Descriptor instead.
+func (*Flag) Descriptor() ([]byte, []int) {
+	return file_flagz_service_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Flag) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Flag) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Flag) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Flag) GetCurrentValue() string {
+	if x != nil {
+		return x.CurrentValue
+	}
+	return ""
+}
+
+func (x *Flag) GetDefaultValue() string {
+	if x != nil {
+		return x.DefaultValue
+	}
+	return ""
+}
+
+func (x *Flag) GetIsDynamic() bool {
+	if x != nil {
+		return x.IsDynamic
+	}
+	return false
+}
+
+func (x *Flag) GetIsChanged() bool {
+	if x != nil {
+		return x.IsChanged
+	}
+	return false
+}
+
+func (x *Flag) GetLastChanged() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastChanged
+	}
+	return nil
+}
+
+type ListFlagsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OnlyDynamic   bool                   `protobuf:"varint,1,opt,name=only_dynamic,json=onlyDynamic,proto3" json:"only_dynamic,omitempty"`
+	OnlyChanged   bool                   `protobuf:"varint,2,opt,name=only_changed,json=onlyChanged,proto3" json:"only_changed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFlagsRequest) Reset() {
+	*x = ListFlagsRequest{}
+	mi := &file_flagz_service_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFlagsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFlagsRequest) ProtoMessage() {}
+
+func (x *ListFlagsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_flagz_service_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFlagsRequest.ProtoReflect.Descriptor instead.
+func (*ListFlagsRequest) Descriptor() ([]byte, []int) {
+	return file_flagz_service_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListFlagsRequest) GetOnlyDynamic() bool {
+	if x != nil {
+		return x.OnlyDynamic
+	}
+	return false
+}
+
+func (x *ListFlagsRequest) GetOnlyChanged() bool {
+	if x != nil {
+		return x.OnlyChanged
+	}
+	return false
+}
+
+type ListFlagsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Flags []*Flag                `protobuf:"bytes,1,rep,name=flags,proto3" json:"flags,omitempty"`
+	// FNV32 checksum of all flag values, same as on the `/debug/flagz` endpoint.
+	Checksum      string `protobuf:"bytes,2,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFlagsResponse) Reset() {
+	*x = ListFlagsResponse{}
+	mi := &file_flagz_service_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFlagsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFlagsResponse) ProtoMessage() {}
+
+func (x *ListFlagsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_flagz_service_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFlagsResponse.ProtoReflect.Descriptor instead.
+func (*ListFlagsResponse) Descriptor() ([]byte, []int) {
+	return file_flagz_service_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListFlagsResponse) GetFlags() []*Flag {
+	if x != nil {
+		return x.Flags
+	}
+	return nil
+}
+
+func (x *ListFlagsResponse) GetChecksum() string {
+	if x != nil {
+		return x.Checksum
+	}
+	return ""
+}
+
+type GetFlagRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetFlagRequest) Reset() {
+	*x = GetFlagRequest{}
+	mi := &file_flagz_service_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetFlagRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFlagRequest) ProtoMessage() {}
+
+func (x *GetFlagRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_flagz_service_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFlagRequest.ProtoReflect.Descriptor instead.
+func (*GetFlagRequest) Descriptor() ([]byte, []int) {
+	return file_flagz_service_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetFlagRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type SetFlagRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetFlagRequest) Reset() {
+	*x = SetFlagRequest{}
+	mi := &file_flagz_service_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetFlagRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetFlagRequest) ProtoMessage() {}
+
+func (x *SetFlagRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_flagz_service_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetFlagRequest.ProtoReflect.Descriptor instead.
+func (*SetFlagRequest) Descriptor() ([]byte, []int) {
+	return file_flagz_service_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SetFlagRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SetFlagRequest) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type SetFlagResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Flag          *Flag                  `protobuf:"bytes,1,opt,name=flag,proto3" json:"flag,omitempty"`
+	PreviousValue string                 `protobuf:"bytes,2,opt,name=previous_value,json=previousValue,proto3" json:"previous_value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetFlagResponse) Reset() {
+	*x = SetFlagResponse{}
+	mi := &file_flagz_service_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetFlagResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetFlagResponse) ProtoMessage() {}
+
+func (x *SetFlagResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_flagz_service_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetFlagResponse.ProtoReflect.Descriptor instead.
+func (*SetFlagResponse) Descriptor() ([]byte, []int) {
+	return file_flagz_service_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SetFlagResponse) GetFlag() *Flag {
+	if x != nil {
+		return x.Flag
+	}
+	return nil
+}
+
+func (x *SetFlagResponse) GetPreviousValue() string {
+	if x != nil {
+		return x.PreviousValue
+	}
+	return ""
+}
+
+type WatchFlagsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Names of the flags to watch, all flags if empty.
+	Names         []string `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchFlagsRequest) Reset() {
+	*x = WatchFlagsRequest{}
+	mi := &file_flagz_service_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchFlagsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchFlagsRequest) ProtoMessage() {}
+
+func (x *WatchFlagsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_flagz_service_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchFlagsRequest.ProtoReflect.Descriptor instead.
+func (*WatchFlagsRequest) Descriptor() ([]byte, []int) {
+	return file_flagz_service_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *WatchFlagsRequest) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+type FlagChange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Flag          *Flag                  `protobuf:"bytes,1,opt,name=flag,proto3" json:"flag,omitempty"`
+	PreviousValue string                 `protobuf:"bytes,2,opt,name=previous_value,json=previousValue,proto3" json:"previous_value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlagChange) Reset() {
+	*x = FlagChange{}
+	mi := &file_flagz_service_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlagChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlagChange) ProtoMessage() {}
+
+func (x *FlagChange) ProtoReflect() protoreflect.Message {
+	mi := &file_flagz_service_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlagChange.ProtoReflect.Descriptor instead.
+func (*FlagChange) Descriptor() ([]byte, []int) {
+	return file_flagz_service_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *FlagChange) GetFlag() *Flag {
+	if x != nil {
+		return x.Flag
+	}
+	return nil
+}
+
+func (x *FlagChange) GetPreviousValue() string {
+	if x != nil {
+		return x.PreviousValue
+	}
+	return ""
+}
+
+var File_flagz_service_proto protoreflect.FileDescriptor
+
+const file_flagz_service_proto_rawDesc = "" +
+	"\n" +
+	"\x13flagz_service.proto\x12\rflagz.service\x1a\x1fgoogle/protobuf/timestamp.proto\"\x97\x02\n" +
+	"\x04Flag\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12#\n" +
+	"\rcurrent_value\x18\x04 \x01(\tR\fcurrentValue\x12#\n" +
+	"\rdefault_value\x18\x05 \x01(\tR\fdefaultValue\x12\x1d\n" +
+	"\n" +
+	"is_dynamic\x18\x06 \x01(\bR\tisDynamic\x12\x1d\n" +
+	"\n" +
+	"is_changed\x18\a \x01(\bR\tisChanged\x12=\n" +
+	"\flast_changed\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\vlastChanged\"X\n" +
+	"\x10ListFlagsRequest\x12!\n" +
+	"\fonly_dynamic\x18\x01 \x01(\bR\vonlyDynamic\x12!\n" +
+	"\fonly_changed\x18\x02 \x01(\bR\vonlyChanged\"Z\n" +
+	"\x11ListFlagsResponse\x12)\n" +
+	"\x05flags\x18\x01 \x03(\v2\x13.flagz.service.FlagR\x05flags\x12\x1a\n" +
+	"\bchecksum\x18\x02 \x01(\tR\bchecksum\"$\n" +
+	"\x0eGetFlagRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\":\n" +
+	"\x0eSetFlagRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\"a\n" +
+	"\x0fSetFlagResponse\x12'\n" +
+	"\x04flag\x18\x01 \x01(\v2\x13.flagz.service.FlagR\x04flag\x12%\n" +
+	"\x0eprevious_value\x18\x02 \x01(\tR\rpreviousValue\")\n" +
+	"\x11WatchFlagsRequest\x12\x14\n" +
+	"\x05names\x18\x01 \x03(\tR\x05names\"\\\n" +
+	"\n" +
+	"FlagChange\x12'\n" +
+	"\x04flag\x18\x01 \x01(\v2\x13.flagz.service.FlagR\x04flag\x12%\n" +
+	"\x0eprevious_value\x18\x02 \x01(\tR\rpreviousValue2\xb4\x02\n" +
+	"\fFlagzService\x12N\n" +
+	"\tListFlags\x12\x1f.flagz.service.ListFlagsRequest\x1a .flagz.service.ListFlagsResponse\x12=\n" +
+	"\aGetFlag\x12\x1d.flagz.service.GetFlagRequest\x1a\x13.flagz.service.Flag\x12H\n" +
+	"\aSetFlag\x12\x1d.flagz.service.SetFlagRequest\x1a\x1e.flagz.service.SetFlagResponse\x12K\n" +
+	"\n" +
+	"WatchFlags\x12 .flagz.service.WatchFlagsRequest\x1a\x19.flagz.service.FlagChange0\x01B9Z7github.com/mwitkow/go-flagz/service/proto;flagz_serviceb\x06proto3"
+
+var (
+	file_flagz_service_proto_rawDescOnce sync.Once
+	file_flagz_service_proto_rawDescData []byte
+)
+
+func file_flagz_service_proto_rawDescGZIP() []byte {
+	file_flagz_service_proto_rawDescOnce.Do(func() {
+		file_flagz_service_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_flagz_service_proto_rawDesc), len(file_flagz_service_proto_rawDesc)))
+	})
+	return file_flagz_service_proto_rawDescData
+}
+
+var file_flagz_service_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_flagz_service_proto_goTypes = []any{
+	(*Flag)(nil),                  // 0: flagz.service.Flag
+	(*ListFlagsRequest)(nil),      // 1: flagz.service.ListFlagsRequest
+	(*ListFlagsResponse)(nil),     // 2: flagz.service.ListFlagsResponse
+	(*GetFlagRequest)(nil),        // 3: flagz.service.GetFlagRequest
+	(*SetFlagRequest)(nil),        // 4: flagz.service.SetFlagRequest
+	(*SetFlagResponse)(nil),       // 5: flagz.service.SetFlagResponse
+	(*WatchFlagsRequest)(nil),     // 6: flagz.service.WatchFlagsRequest
+	(*FlagChange)(nil),            // 7: flagz.service.FlagChange
+	(*timestamppb.Timestamp)(nil), // 8: google.protobuf.Timestamp
+}
+var file_flagz_service_proto_depIdxs = []int32{
+	8, // 0: flagz.service.Flag.last_changed:type_name -> google.protobuf.Timestamp
+	0, // 1: flagz.service.ListFlagsResponse.flags:type_name -> flagz.service.Flag
+	0, // 2: flagz.service.SetFlagResponse.flag:type_name -> flagz.service.Flag
+	0, // 3: flagz.service.FlagChange.flag:type_name -> flagz.service.Flag
+	1, // 4: flagz.service.FlagzService.ListFlags:input_type -> flagz.service.ListFlagsRequest
+	3, // 5: flagz.service.FlagzService.GetFlag:input_type -> flagz.service.GetFlagRequest
+	4, // 6: flagz.service.FlagzService.SetFlag:input_type -> flagz.service.SetFlagRequest
+	6, // 7: flagz.service.FlagzService.WatchFlags:input_type -> flagz.service.WatchFlagsRequest
+	2, // 8: flagz.service.FlagzService.ListFlags:output_type -> flagz.service.ListFlagsResponse
+	0, // 9: flagz.service.FlagzService.GetFlag:output_type -> flagz.service.Flag
+	5, // 10: flagz.service.FlagzService.SetFlag:output_type -> flagz.service.SetFlagResponse
+	7, // 11: flagz.service.FlagzService.WatchFlags:output_type -> flagz.service.FlagChange
+	8, // [8:12] is the sub-list for method output_type
+	4, // [4:8] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_flagz_service_proto_init() }
+func file_flagz_service_proto_init() {
+	if File_flagz_service_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_flagz_service_proto_rawDesc), len(file_flagz_service_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_flagz_service_proto_goTypes,
+		DependencyIndexes: file_flagz_service_proto_depIdxs,
+		MessageInfos:      file_flagz_service_proto_msgTypes,
+	}.Build()
+	File_flagz_service_proto = out.File
+	file_flagz_service_proto_goTypes = nil
+	file_flagz_service_proto_depIdxs = nil
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// FlagzServiceClient is the client API for FlagzService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type FlagzServiceClient interface {
+	// ListFlags returns all flags of the process, optionally filtered.
+	ListFlags(ctx context.Context, in *ListFlagsRequest, opts ...grpc.CallOption) (*ListFlagsResponse, error)
+	// GetFlag returns a single flag by name.
+	GetFlag(ctx context.Context, in *GetFlagRequest, opts ...grpc.CallOption) (*Flag, error)
+	// SetFlag changes the value of a dynamic flag of the process.
+	SetFlag(ctx context.Context, in *SetFlagRequest, opts ...grpc.CallOption) (*SetFlagResponse, error)
+	// WatchFlags streams changes of flag values as they happen, until the call is cancelled.
+	WatchFlags(ctx context.Context, in *WatchFlagsRequest, opts ...grpc.CallOption) (FlagzService_WatchFlagsClient, error)
+}
+
+type flagzServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFlagzServiceClient(cc grpc.ClientConnInterface) FlagzServiceClient {
+	return &flagzServiceClient{cc}
+}
+
+func (c *flagzServiceClient) ListFlags(ctx context.Context, in *ListFlagsRequest, opts ...grpc.CallOption) (*ListFlagsResponse, error) {
+	out := new(ListFlagsResponse)
+	err := c.cc.Invoke(ctx, "/flagz.service.FlagzService/ListFlags", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *flagzServiceClient) GetFlag(ctx context.Context, in *GetFlagRequest, opts ...grpc.CallOption) (*Flag, error) {
+	out := new(Flag)
+	err := c.cc.Invoke(ctx, "/flagz.service.FlagzService/GetFlag", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *flagzServiceClient) SetFlag(ctx context.Context, in *SetFlagRequest, opts ...grpc.CallOption) (*SetFlagResponse, error) {
+	out := new(SetFlagResponse)
+	err := c.cc.Invoke(ctx, "/flagz.service.FlagzService/SetFlag", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *flagzServiceClient) WatchFlags(ctx context.Context, in *WatchFlagsRequest, opts ...grpc.CallOption) (FlagzService_WatchFlagsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_FlagzService_serviceDesc.Streams[0], "/flagz.service.FlagzService/WatchFlags", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &flagzServiceWatchFlagsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FlagzService_WatchFlagsClient interface {
+	Recv() (*FlagChange, error)
+	grpc.ClientStream
+}
+
+type flagzServiceWatchFlagsClient struct {
+	grpc.ClientStream
+}
+
+func (x *flagzServiceWatchFlagsClient) Recv() (*FlagChange, error) {
+	m := new(FlagChange)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FlagzServiceServer is the server API for FlagzService service.
+type FlagzServiceServer interface {
+	// ListFlags returns all flags of the process, optionally filtered.
+	ListFlags(context.Context, *ListFlagsRequest) (*ListFlagsResponse, error)
+	// GetFlag returns a single flag by name.
+	GetFlag(context.Context, *GetFlagRequest) (*Flag, error)
+	// SetFlag changes the value of a dynamic flag of the process.
+	SetFlag(context.Context, *SetFlagRequest) (*SetFlagResponse, error)
+	// WatchFlags streams changes of flag values as they happen, until the call is cancelled.
+	WatchFlags(*WatchFlagsRequest, FlagzService_WatchFlagsServer) error
+}
+
+// UnimplementedFlagzServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedFlagzServiceServer struct {
+}
+
+func (*UnimplementedFlagzServiceServer) ListFlags(context.Context, *ListFlagsRequest) (*ListFlagsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFlags not implemented")
+}
+func (*UnimplementedFlagzServiceServer) GetFlag(context.Context, *GetFlagRequest) (*Flag, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFlag not implemented")
+}
+func (*UnimplementedFlagzServiceServer) SetFlag(context.Context, *SetFlagRequest) (*SetFlagResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetFlag not implemented")
+}
+func (*UnimplementedFlagzServiceServer) WatchFlags(*WatchFlagsRequest, FlagzService_WatchFlagsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchFlags not implemented")
+}
+
+func RegisterFlagzServiceServer(s *grpc.Server, srv FlagzServiceServer) {
+	s.RegisterService(&_FlagzService_serviceDesc, srv)
+}
+
+func _FlagzService_ListFlags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFlagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FlagzServiceServer).ListFlags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/flagz.service.FlagzService/ListFlags",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FlagzServiceServer).ListFlags(ctx, req.(*ListFlagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FlagzService_GetFlag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetFlagRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FlagzServiceServer).GetFlag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/flagz.service.FlagzService/GetFlag",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FlagzServiceServer).GetFlag(ctx, req.(*GetFlagRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FlagzService_SetFlag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetFlagRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FlagzServiceServer).SetFlag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/flagz.service.FlagzService/SetFlag",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FlagzServiceServer).SetFlag(ctx, req.(*SetFlagRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FlagzService_WatchFlags_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchFlagsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FlagzServiceServer).WatchFlags(m, &flagzServiceWatchFlagsServer{stream})
+}
+
+type FlagzService_WatchFlagsServer interface {
+	Send(*FlagChange) error
+	grpc.ServerStream
+}
+
+type flagzServiceWatchFlagsServer struct {
+	grpc.ServerStream
+}
+
+func (x *flagzServiceWatchFlagsServer) Send(m *FlagChange) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _FlagzService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "flagz.service.FlagzService",
+	HandlerType: (*FlagzServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListFlags",
+			Handler:    _FlagzService_ListFlags_Handler,
+		},
+		{
+			MethodName: "GetFlag",
+			Handler:    _FlagzService_GetFlag_Handler,
+		},
+		{
+			MethodName: "SetFlag",
+			Handler:    _FlagzService_SetFlag_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchFlags",
+			Handler:       _FlagzService_WatchFlags_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "flagz_service.proto",
+}
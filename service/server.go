@@ -0,0 +1,260 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package service provides a gRPC FlagzService implementation that exposes the flags of the running process, see
+// `proto/flagz_service.proto` for the API.
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	pb "github.com/mwitkow/go-flagz/service/proto"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultWatchInterval = 1 * time.Second
+)
+
+// Authorizer decides whether the call of `fullMethod` (e.g. `/flagz.service.FlagzService/SetFlag`) may access the
+// flag `flagName`, which is empty for ListFlags and WatchFlags of all flags.
+//
+// The caller's identity is expected to be in `ctx`, e.g. put there by the server's authentication interceptor, or
+// available through `peer` and `metadata`. Returning a gRPC status error passes it to the caller as is, any other
+// error is returned as `PermissionDenied`.
+type Authorizer func(ctx context.Context, fullMethod string, flagName string) error
+
+// Server implements `FlagzServiceServer` for a given FlagSet.
+type Server struct {
+	pb.UnimplementedFlagzServiceServer
+
+	flagSet       *flag.FlagSet
+	authorizer    Authorizer
+	writeAuth     flagz.WriteAuthorizer
+	auditSink     flagz.AuditSink
+	actor         func(ctx context.Context) string
+	watchInterval time.Duration
+	logger        flagz.Logger
+}
+
+// New constructs a Server exposing `flagSet`. Without an Authorizer (see `WithAuthorizer`) all reads are allowed and
+// all SetFlag calls are rejected.
+func New(flagSet *flag.FlagSet) *Server {
+	return &Server{flagSet: flagSet, watchInterval: defaultWatchInterval}
+}
+
+// WithAuthorizer sets the function checking access of every call, enabling SetFlag for the calls it allows.
+func (s *Server) WithAuthorizer(authorizer Authorizer) *Server {
+	s.authorizer = authorizer
+	return s
+}
+
+// WithWriteAuthorizer sets the `flagz.WriteAuthorizer` approving every SetFlag call with the actor (see `WithActor`),
+// flag name and proposed value, enabling SetFlag for the calls it allows. If an Authorizer is set as well, calls must
+// pass both. Rejections are returned as `PermissionDenied`, unless they are gRPC status errors.
+func (s *Server) WithWriteAuthorizer(authorizer flagz.WriteAuthorizer) *Server {
+	s.writeAuth = authorizer
+	return s
+}
+
+// WithAuditSink records every change made through SetFlag to `sink`.
+func (s *Server) WithAuditSink(sink flagz.AuditSink) *Server {
+	s.auditSink = sink
+	return s
+}
+
+// WithActor sets the function identifying the caller in the audit records and `flagz.WriteRequest`s, e.g. from the
+// identity put in `ctx` by the authentication interceptor. Defaults to the caller's peer address.
+func (s *Server) WithActor(actor func(ctx context.Context) string) *Server {
+	s.actor = actor
+	return s
+}
+
+// WithLogger logs failures of auditing the changes made through SetFlag to `logger`.
+func (s *Server) WithLogger(logger flagz.Logger) *Server {
+	s.logger = logger
+	return s
+}
+
+// WithWatchInterval sets how often WatchFlags checks the FlagSet for changes. Defaults to 1s.
+func (s *Server) WithWatchInterval(interval time.Duration) *Server {
+	s.watchInterval = interval
+	return s
+}
+
+// ListFlags returns all flags of the FlagSet, optionally filtered.
+func (s *Server) ListFlags(ctx context.Context, req *pb.ListFlagsRequest) (*pb.ListFlagsResponse, error) {
+	if err := s.authorize(ctx, "ListFlags", ""); err != nil {
+		return nil, err
+	}
+	resp := &pb.ListFlagsResponse{Checksum: fmt.Sprintf("%x", flagz.ChecksumFlagSet(s.flagSet, nil))}
+	s.flagSet.VisitAll(func(f *flag.Flag) {
+		if req.OnlyDynamic && !flagz.IsFlagDynamic(f) {
+			return
+		}
+		if req.OnlyChanged && !f.Changed {
+			return
+		}
+		resp.Flags = append(resp.Flags, flagToProto(f))
+	})
+	return resp, nil
+}
+
+// GetFlag returns a single flag of the FlagSet.
+func (s *Server) GetFlag(ctx context.Context, req *pb.GetFlagRequest) (*pb.Flag, error) {
+	if err := s.authorize(ctx, "GetFlag", req.Name); err != nil {
+		return nil, err
+	}
+	f := s.flagSet.Lookup(req.Name)
+	if f == nil {
+		return nil, status.Errorf(codes.NotFound, "flag %q not found", req.Name)
+	}
+	return flagToProto(f), nil
+}
+
+// SetFlag changes the value of a dynamic flag of the FlagSet, going through the flag's validators.
+func (s *Server) SetFlag(ctx context.Context, req *pb.SetFlagRequest) (*pb.SetFlagResponse, error) {
+	if s.authorizer == nil && s.writeAuth == nil {
+		return nil, status.Errorf(codes.PermissionDenied, "setting flags is not enabled")
+	}
+	if err := s.authorize(ctx, "SetFlag", req.Name); err != nil {
+		return nil, err
+	}
+	f := s.flagSet.Lookup(req.Name)
+	if f == nil {
+		return nil, status.Errorf(codes.NotFound, "flag %q not found", req.Name)
+	}
+	if !flagz.IsFlagDynamic(f) {
+		return nil, status.Errorf(codes.FailedPrecondition, "flag %q is not dynamic", req.Name)
+	}
+	if flagz.IsFlagWriteLocked(f) {
+		return nil, status.Errorf(codes.PermissionDenied, "flag %q is write locked", req.Name)
+	}
+	if flagz.IsFlagImmutable(f) {
+		return nil, status.Errorf(codes.PermissionDenied, "flag %q is immutable", req.Name)
+	}
+	if s.writeAuth != nil {
+		writeReq := flagz.WriteRequest{Actor: s.actorOf(ctx), FlagName: req.Name, Value: req.Value, Source: "grpc"}
+		if err := s.writeAuth.AuthorizeWrite(ctx, writeReq); err != nil {
+			return nil, toPermissionDenied(err)
+		}
+	}
+	previous := f.Value.String()
+	// do not call flag.Value.Set, instead go through flagSet.Set (via SetFlagFromSource) to change "changed" state.
+	updateCtx := flagz.NewUpdateContext(ctx, flagz.UpdateInfo{FlagName: req.Name, Source: "grpc"})
+	if err := flagz.SetFlagFromSourceCtx(updateCtx, s.flagSet, req.Name, req.Value, "grpc"); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad value for flag %q: %v", req.Name, err)
+	}
+	if s.auditSink != nil {
+		err := s.auditSink.Audit(flagz.NewAuditRecord(f, previous, s.actorOf(ctx), "grpc"))
+		if err != nil && s.logger != nil {
+			s.logger.Printf("flagz: failed auditing change of flag=%v: %v", req.Name, err)
+		}
+	}
+	return &pb.SetFlagResponse{Flag: flagToProto(f), PreviousValue: flagz.RedactFlagValue(f, previous)}, nil
+}
+
+// WatchFlags streams changes of the requested flags until the call is cancelled.
+func (s *Server) WatchFlags(req *pb.WatchFlagsRequest, stream pb.FlagzService_WatchFlagsServer) error {
+	for _, name := range req.Names {
+		if err := s.authorize(stream.Context(), "WatchFlags", name); err != nil {
+			return err
+		}
+		if s.flagSet.Lookup(name) == nil {
+			return status.Errorf(codes.NotFound, "flag %q not found", name)
+		}
+	}
+	if len(req.Names) == 0 {
+		if err := s.authorize(stream.Context(), "WatchFlags", ""); err != nil {
+			return err
+		}
+	}
+	lastValues := s.watchedValues(req.Names)
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return nil
+		}
+		for name, value := range s.watchedValues(req.Names) {
+			previous, ok := lastValues[name]
+			if ok && previous == value {
+				continue
+			}
+			lastValues[name] = value
+			f := s.flagSet.Lookup(name)
+			if err := stream.Send(&pb.FlagChange{Flag: flagToProto(f), PreviousValue: flagz.RedactFlagValue(f, previous)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) watchedValues(names []string) map[string]string {
+	values := make(map[string]string)
+	if len(names) == 0 {
+		s.flagSet.VisitAll(func(f *flag.Flag) {
+			values[f.Name] = f.Value.String()
+		})
+	}
+	for _, name := range names {
+		values[name] = s.flagSet.Lookup(name).Value.String()
+	}
+	return values
+}
+
+func (s *Server) authorize(ctx context.Context, method string, flagName string) error {
+	if s.authorizer == nil {
+		return nil
+	}
+	return toPermissionDenied(s.authorizer(ctx, "/flagz.service.FlagzService/"+method, flagName))
+}
+
+// toPermissionDenied returns gRPC status errors as they are, and any other error as `PermissionDenied`.
+func toPermissionDenied(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Errorf(codes.PermissionDenied, "%v", err)
+}
+
+func (s *Server) actorOf(ctx context.Context) string {
+	if s.actor != nil {
+		return s.actor(ctx)
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+func flagToProto(f *flag.Flag) *pb.Flag {
+	p := &pb.Flag{
+		Name:         f.Name,
+		Description:  f.Usage,
+		Type:         f.Value.Type(),
+		CurrentValue: flagz.RedactFlagValue(f, f.Value.String()),
+		DefaultValue: flagz.RedactFlagValue(f, f.DefValue),
+		IsDynamic:    flagz.IsFlagDynamic(f),
+		IsChanged:    f.Changed,
+	}
+	if lc, ok := f.Value.(interface {
+		LastChanged() time.Time
+	}); ok && !lc.LastChanged().IsZero() {
+		p.LastChanged = timestamppb.New(lc.LastChanged())
+	}
+	return p
+}
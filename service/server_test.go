@@ -0,0 +1,190 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package service_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/service"
+	pb "github.com/mwitkow/go-flagz/service/proto"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type serverTestSuite struct {
+	suite.Suite
+
+	flagSet *flag.FlagSet
+	dynInt  *flagz.DynInt64Value
+	audits  chan flagz.AuditRecord
+
+	server *grpc.Server
+	conn   *grpc.ClientConn
+	client pb.FlagzServiceClient
+}
+
+func (s *serverTestSuite) SetupTest() {
+	s.flagSet = flag.NewFlagSet("server_test", flag.ContinueOnError)
+	s.flagSet.Int32("some_int", 1, "static int for testing")
+	s.dynInt = flagz.DynInt64(s.flagSet, "some_dynint", 1, "dynamic int for testing")
+	s.dynInt.WithValidator(flagz.ValidateDynInt64Range(0, 100))
+	flagz.DynString(s.flagSet, "some_password", "hunter2", "secret string for testing")
+	flagz.MarkFlagSecret(s.flagSet.Lookup("some_password"))
+
+	s.audits = make(chan flagz.AuditRecord, 10)
+	impl := service.New(s.flagSet).WithWatchInterval(10 * time.Millisecond).WithAuditSink(
+		flagz.AuditSinkFunc(func(r flagz.AuditRecord) error {
+			s.audits <- r
+			return nil
+		})).WithActor(
+		func(ctx context.Context) string {
+			md, _ := metadata.FromIncomingContext(ctx)
+			return md["user"][0]
+		}).WithAuthorizer(
+		func(ctx context.Context, fullMethod string, flagName string) error {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if fullMethod == "/flagz.service.FlagzService/SetFlag" && len(md["user"]) == 0 {
+				return fmt.Errorf("anonymous writes are not allowed")
+			}
+			return nil
+		})
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(s.T(), err, "must be able to allocate a port for the server")
+	s.server = grpc.NewServer()
+	pb.RegisterFlagzServiceServer(s.server, impl)
+	go s.server.Serve(listener)
+
+	s.conn, err = grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(s.T(), err, "must be able to dial the server")
+	s.client = pb.NewFlagzServiceClient(s.conn)
+}
+
+func (s *serverTestSuite) TearDownTest() {
+	s.conn.Close()
+	s.server.Stop()
+}
+
+func (s *serverTestSuite) TestListFlagsRedactsSecrets() {
+	resp, err := s.client.ListFlags(context.Background(), &pb.ListFlagsRequest{OnlyDynamic: true})
+	require.NoError(s.T(), err)
+	require.Len(s.T(), resp.Flags, 2, "only dynamic flags must be listed")
+	assert.Equal(s.T(), "some_dynint", resp.Flags[0].Name)
+	assert.Equal(s.T(), "dyn_int64", resp.Flags[0].Type)
+	assert.Equal(s.T(), flagz.RedactedValue, resp.Flags[1].CurrentValue, "secret values must be redacted")
+	assert.NotEmpty(s.T(), resp.Checksum)
+}
+
+func (s *serverTestSuite) TestGetFlag() {
+	f, err := s.client.GetFlag(context.Background(), &pb.GetFlagRequest{Name: "some_int"})
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "1", f.CurrentValue)
+	_, err = s.client.GetFlag(context.Background(), &pb.GetFlagRequest{Name: "no_such_flag"})
+	assert.Equal(s.T(), codes.NotFound, status.Code(err))
+}
+
+func (s *serverTestSuite) TestSetFlag() {
+	_, err := s.client.SetFlag(context.Background(), &pb.SetFlagRequest{Name: "some_dynint", Value: "5"})
+	assert.Equal(s.T(), codes.PermissionDenied, status.Code(err), "authorizer must be consulted")
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "user", "admin")
+	resp, err := s.client.SetFlag(ctx, &pb.SetFlagRequest{Name: "some_dynint", Value: "5"})
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "1", resp.PreviousValue)
+	assert.Equal(s.T(), "5", resp.Flag.CurrentValue)
+	assert.NotNil(s.T(), resp.Flag.LastChanged, "last change time must be set")
+	assert.EqualValues(s.T(), 5, s.dynInt.Get())
+	audit := <-s.audits
+	assert.Equal(s.T(), "admin", audit.Actor, "changes must be attributed to the caller")
+	assert.Equal(s.T(), "1", audit.OldValue)
+	assert.Equal(s.T(), "5", audit.NewValue)
+	assert.Equal(s.T(), "grpc", audit.Source)
+
+	_, err = s.client.SetFlag(ctx, &pb.SetFlagRequest{Name: "some_dynint", Value: "500"})
+	assert.Equal(s.T(), codes.InvalidArgument, status.Code(err), "validators must be applied")
+	_, err = s.client.SetFlag(ctx, &pb.SetFlagRequest{Name: "some_int", Value: "5"})
+	assert.Equal(s.T(), codes.FailedPrecondition, status.Code(err), "static flags must not be settable")
+	flagz.MarkFlagWriteLocked(s.flagSet.Lookup("some_password"))
+	_, err = s.client.SetFlag(ctx, &pb.SetFlagRequest{Name: "some_password", Value: "hunter3"})
+	assert.Equal(s.T(), codes.PermissionDenied, status.Code(err), "write locked flags must not be settable")
+	assert.Empty(s.T(), s.audits, "rejected changes must not be audited")
+}
+
+func (s *serverTestSuite) TestSetFlagDisabledWithoutAuthorizer() {
+	_, err := service.New(s.flagSet).SetFlag(context.Background(), &pb.SetFlagRequest{Name: "some_dynint", Value: "5"})
+	assert.Equal(s.T(), codes.PermissionDenied, status.Code(err))
+}
+
+func (s *serverTestSuite) TestSetFlagConsultsWriteAuthorizer() {
+	requests := []flagz.WriteRequest{}
+	impl := service.New(s.flagSet).
+		WithActor(func(ctx context.Context) string { return "admin" }).
+		WithWriteAuthorizer(flagz.WriteAuthorizerFunc(func(ctx context.Context, req flagz.WriteRequest) error {
+			requests = append(requests, req)
+			switch req.Value {
+			case "13":
+				return fmt.Errorf("unlucky values are not allowed")
+			case "14":
+				return status.Errorf(codes.Unauthenticated, "who are you")
+			}
+			return nil
+		}))
+	_, err := impl.SetFlag(context.Background(), &pb.SetFlagRequest{Name: "some_dynint", Value: "5"})
+	require.NoError(s.T(), err, "the write authorizer alone must enable SetFlag")
+	assert.EqualValues(s.T(), 5, s.dynInt.Get())
+	assert.Equal(s.T(), []flagz.WriteRequest{{Actor: "admin", FlagName: "some_dynint", Value: "5", Source: "grpc"}}, requests)
+
+	_, err = impl.SetFlag(context.Background(), &pb.SetFlagRequest{Name: "some_dynint", Value: "13"})
+	assert.Equal(s.T(), codes.PermissionDenied, status.Code(err), "rejections must be returned as PermissionDenied")
+	_, err = impl.SetFlag(context.Background(), &pb.SetFlagRequest{Name: "some_dynint", Value: "14"})
+	assert.Equal(s.T(), codes.Unauthenticated, status.Code(err), "status errors must be returned as they are")
+	assert.EqualValues(s.T(), 5, s.dynInt.Get(), "rejected changes must not be applied")
+}
+
+func (s *serverTestSuite) TestSetFlagPassesCallContextToValidators() {
+	var info flagz.UpdateInfo
+	var users []string
+	s.dynInt.WithValidatorCtx(func(ctx context.Context, value int64) error {
+		info, _ = flagz.UpdateInfoFromContext(ctx)
+		md, _ := metadata.FromIncomingContext(ctx)
+		users = md["user"]
+		return nil
+	})
+	impl := service.New(s.flagSet).WithWriteAuthorizer(flagz.WriteAuthorizerFunc(
+		func(ctx context.Context, req flagz.WriteRequest) error { return nil }))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user", "admin"))
+	_, err := impl.SetFlag(ctx, &pb.SetFlagRequest{Name: "some_dynint", Value: "5"})
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), flagz.UpdateInfo{FlagName: "some_dynint", Source: "grpc"}, info)
+	assert.Equal(s.T(), []string{"admin"}, users, "validators must get the context of the call")
+}
+
+func (s *serverTestSuite) TestWatchFlagsStreamsChanges() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := s.client.WatchFlags(ctx, &pb.WatchFlagsRequest{Names: []string{"some_dynint"}})
+	require.NoError(s.T(), err)
+	time.Sleep(50 * time.Millisecond) // let the server take the initial snapshot.
+	require.NoError(s.T(), s.dynInt.Set("42"))
+	change, err := stream.Recv()
+	require.NoError(s.T(), err, "a change must be streamed")
+	assert.Equal(s.T(), "some_dynint", change.Flag.Name)
+	assert.Equal(s.T(), "42", change.Flag.CurrentValue)
+	assert.Equal(s.T(), "1", change.PreviousValue)
+}
+
+func TestServerSuite(t *testing.T) {
+	suite.Run(t, &serverTestSuite{})
+}
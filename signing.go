@@ -0,0 +1,62 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const signedValuePrefix = "hmac-sha256:"
+
+var (
+	// ErrUnsignedValue is returned by `VerifyFlagValue` for values that aren't signed envelopes.
+	ErrUnsignedValue = errors.New("value is not signed")
+	// ErrBadSignature is returned by `VerifyFlagValue` for values whose signature doesn't match any of the keys.
+	ErrBadSignature = errors.New("value signature doesn't match")
+)
+
+// SignFlagValue wraps `value` of flag `name` in an envelope carrying its HMAC-SHA256 under `key`, in the form of
+// `hmac-sha256:<signature>:<value>`. Writers of backends that verify signatures (e.g. `watcher.WithSigningKeys`) must
+// store the envelopes instead of plain values.
+//
+// The signature covers the flag name, so a signed value of one flag can't be replayed as the value of another.
+func SignFlagValue(key []byte, name string, value string) string {
+	return signedValuePrefix + base64.RawURLEncoding.EncodeToString(flagValueMAC(key, name, value)) + ":" + value
+}
+
+// VerifyFlagValue checks the envelope produced by `SignFlagValue` for flag `name` against any of `keys`, returning the
+// value it carries. Accepting multiple keys allows rotating them without downtime: sign with the new key only after
+// all readers know it.
+func VerifyFlagValue(keys [][]byte, name string, envelope string) (string, error) {
+	if !strings.HasPrefix(envelope, signedValuePrefix) {
+		return "", ErrUnsignedValue
+	}
+	parts := strings.SplitN(strings.TrimPrefix(envelope, signedValuePrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", ErrUnsignedValue
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrBadSignature
+	}
+	for _, key := range keys {
+		if hmac.Equal(signature, flagValueMAC(key, name, parts[1])) {
+			return parts[1], nil
+		}
+	}
+	return "", ErrBadSignature
+}
+
+func flagValueMAC(key []byte, name string, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	// flag names don't contain NUL bytes, so it separates the name from the value unambiguously.
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
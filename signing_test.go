@@ -0,0 +1,32 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyFlagValue_AcceptsOnlyValidSignatures(t *testing.T) {
+	oldKey, newKey := []byte("old"), []byte("new")
+	envelope := flagz.SignFlagValue(oldKey, "some_flag", "a:b")
+
+	value, err := flagz.VerifyFlagValue([][]byte{newKey, oldKey}, "some_flag", envelope)
+	require.NoError(t, err, "any of the keys must be accepted")
+	assert.Equal(t, "a:b", value)
+
+	_, err = flagz.VerifyFlagValue([][]byte{newKey}, "some_flag", envelope)
+	assert.Equal(t, flagz.ErrBadSignature, err, "values signed with unknown keys must be rejected")
+	_, err = flagz.VerifyFlagValue([][]byte{oldKey}, "other_flag", envelope)
+	assert.Equal(t, flagz.ErrBadSignature, err, "signed values must not be replayable to other flags")
+	_, err = flagz.VerifyFlagValue([][]byte{oldKey}, "some_flag", envelope+"c")
+	assert.Equal(t, flagz.ErrBadSignature, err, "tampered values must be rejected")
+	_, err = flagz.VerifyFlagValue([][]byte{oldKey}, "some_flag", "a:b")
+	assert.Equal(t, flagz.ErrUnsignedValue, err)
+	_, err = flagz.VerifyFlagValue([][]byte{oldKey}, "some_flag", "hmac-sha256:nocolon")
+	assert.Equal(t, flagz.ErrUnsignedValue, err)
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = make(map[*flag.Flag]string)
+)
+
+// SetFlagFromSource sets the value of a flag and records `source` (e.g. "etcd" or "configmap") as the origin of the
+// current value. Like `FlagSet.Set` it updates the "changed" state, which `Flag.Value.Set` doesn't.
+// Errors of flags marked as secret don't contain the rejected value, so that they can be safely logged.
+// Values of pinned flags from sources other than the flagz endpoints are held instead, returning ErrFlagPinned, see
+// `PinFlag`. Applied changes of dynamic flags are recorded in the ChangeLog set with `SetChangeLog`, if any. Changes
+// of flags marked with `MarkFlagImmutable` are rejected once they have a value. Values are normalized first, see
+// `AddFlagNormalizers`.
+// Validators set with `WithValidatorCtx` get a context of DefaultValidatorTimeout, see `SetFlagFromSourceCtx`.
+func SetFlagFromSource(flagSet *flag.FlagSet, name string, value string, source string) error {
+	return SetFlagFromSourceCtx(context.Background(), flagSet, name, value, source)
+}
+
+func setFlagFromSource(ctx context.Context, flagSet *flag.FlagSet, name string, value string, source string) error {
+	f := flagSet.Lookup(name)
+	if f == nil {
+		return flagSet.Set(name, value)
+	}
+	value, err := NormalizeFlagValue(flagSet, f, value)
+	if err != nil {
+		return redactSetError(f, &ParseError{Err: err})
+	}
+	if IsFlagImmutable(f) && f.Changed && f.Value.String() != canonicalValue(f, value) {
+		return &ValidationError{Err: ErrFlagImmutable}
+	}
+	if holdUpdate(f, value, source) {
+		return ErrFlagPinned
+	}
+	if err := flagSet.Set(name, value); err != nil {
+		return redactSetError(f, err)
+	}
+	sourcesMu.Lock()
+	sources[f] = source
+	sourcesMu.Unlock()
+	recordChange(ctx, f, source)
+	return nil
+}
+
+// canonicalValue returns `value` of `f` in the format its Value prints it, e.g. "1s" for "1000ms" of durations, so that
+// the same value in another format isn't taken for a change. Values of other types are returned as they are.
+func canonicalValue(f *flag.Flag, value string) string {
+	switch f.Value.Type() {
+	case "bool", "dyn_bool":
+		if v, err := strconv.ParseBool(value); err == nil {
+			return strconv.FormatBool(v)
+		}
+	case "duration", "dyn_duration":
+		if v, err := time.ParseDuration(value); err == nil {
+			return v.String()
+		}
+	case "int", "int8", "int16", "int32", "int64", "dyn_int64":
+		if v, err := strconv.ParseInt(value, 0, 64); err == nil {
+			return strconv.FormatInt(v, 10)
+		}
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		if v, err := strconv.ParseUint(value, 0, 64); err == nil {
+			return strconv.FormatUint(v, 10)
+		}
+	case "float64", "dyn_float64":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	}
+	return value
+}
+
+// redactSetError replaces `err` of setting a flag marked as secret by one without the rejected value.
+func redactSetError(f *flag.Flag, err error) error {
+	if !IsFlagSecret(f) {
+		return err
+	}
+	redacted := fmt.Errorf("invalid argument %v for %q flag", RedactedValue, f.Name)
+	var validation *ValidationError
+	if errors.As(err, &validation) {
+		return &ValidationError{Err: redacted}
+	}
+	return redacted
+}
+
+// FlagSource returns the source recorded by `SetFlagFromSource` for the current value of the flag.
+// It is empty for flags set in any other way, e.g. from the command line.
+func FlagSource(f *flag.Flag) string {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	return sources[f]
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetFlagFromSource_RecordsSource(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_int_1", 13371337, "Use it or lose it")
+	require.NoError(t, set.Parse([]string{"--some_int_1", "1"}))
+	assert.Equal(t, "", flagz.FlagSource(set.Lookup("some_int_1")), "command line values must have no source")
+
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_int_1", "2", "etcd"))
+	assert.Equal(t, "etcd", flagz.FlagSource(set.Lookup("some_int_1")))
+	assert.True(t, set.Lookup("some_int_1").Changed, "changed state must be updated")
+
+	assert.Error(t, flagz.SetFlagFromSource(set, "some_int_1", "bad", "configmap"))
+	assert.Equal(t, "etcd", flagz.FlagSource(set.Lookup("some_int_1")), "rejected values must not change the source")
+}
+
+func TestSetFlagFromSource_RedactsSecretsInErrors(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_pin", 1234, "Use it or lose it")
+	flagz.MarkFlagSecret(set.Lookup("some_pin"))
+	err := flagz.SetFlagFromSource(set, "some_pin", "12x4", "etcd")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "12x4", "rejected secret values must not leak into errors")
+}
+
+func TestSetFlagFromSource_RejectsChangesOfImmutableFlags(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	set.String("data_dir", "/tmp", "Use it or lose it")
+	flagz.DynString(set, "some_dyn_dir", "/tmp", "Use it or lose it")
+	flagz.MarkFlagImmutable(set.Lookup("data_dir"))
+	flagz.MarkFlagImmutable(set.Lookup("some_dyn_dir"))
+	require.NoError(t, set.Parse([]string{"--data_dir", "/var/data"}))
+
+	err := flagz.SetFlagFromSource(set, "data_dir", "/var/other", "etcd")
+	require.Error(t, err, "changes of values set on the command line must be rejected")
+	assert.True(t, errors.Is(err, flagz.ErrFlagImmutable))
+	assert.Equal(t, flagz.FlagErrorValidation, flagz.NewFlagError("data_dir", err).Kind)
+	assert.Equal(t, "/var/data", set.Lookup("data_dir").Value.String())
+	assert.NoError(t, flagz.SetFlagFromSource(set, "data_dir", "/var/data", "etcd"), "the same value must be accepted")
+
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_dyn_dir", "/var/dyn", "etcd"), "the first value must be set")
+	assert.Error(t, flagz.SetFlagFromSource(set, "some_dyn_dir", "/var/other", "endpoint"))
+	assert.Equal(t, "/var/dyn", set.Lookup("some_dyn_dir").Value.String())
+}
+
+func TestSetFlagFromSource_AcceptsImmutableValuesInOtherFormats(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	set.Duration("some_timeout", time.Second, "Use it or lose it")
+	set.Bool("some_bool", false, "Use it or lose it")
+	flagz.DynInt64(set, "some_dyn_int", 1, "Use it or lose it")
+	for _, name := range []string{"some_timeout", "some_bool", "some_dyn_int"} {
+		flagz.MarkFlagImmutable(set.Lookup(name))
+	}
+	require.NoError(t, set.Parse([]string{"--some_timeout", "1s", "--some_bool", "--some_dyn_int", "16"}))
+
+	assert.NoError(t, flagz.SetFlagFromSource(set, "some_timeout", "1000ms", "etcd"), "the same duration must be accepted")
+	assert.NoError(t, flagz.SetFlagFromSource(set, "some_bool", "1", "etcd"), "the same bool must be accepted")
+	assert.NoError(t, flagz.SetFlagFromSource(set, "some_dyn_int", "0x10", "etcd"), "the same int must be accepted")
+	err := flagz.SetFlagFromSource(set, "some_timeout", "2s", "etcd")
+	assert.True(t, errors.Is(err, flagz.ErrFlagImmutable), "other values must still be rejected")
+	assert.Equal(t, "1s", set.Lookup("some_timeout").Value.String())
+}
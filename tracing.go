@@ -0,0 +1,57 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"errors"
+)
+
+// UpdateStage is a stage of the pipeline of Updaters applying values from their source, traced by an UpdateTracer.
+type UpdateStage string
+
+const (
+	// InitializeStage is the initial read of all flags by `Updater.Initialize`.
+	InitializeStage UpdateStage = "initialize"
+	// WatchEventStage is the handling of a single change of a flag watched by an Updater, from receiving it until it
+	// is applied or rejected.
+	WatchEventStage UpdateStage = "watch_event"
+	// ValidateStage is the checking and unwrapping of a value before it is applied: its signature, decryption and
+	// canary envelope.
+	ValidateStage UpdateStage = "validate"
+	// ApplyStage is the setting of a value on its flag, including parsing and the validator of the flag.
+	ApplyStage UpdateStage = "apply"
+	// RollbackStage is the rolling back of a rejected value in the source.
+	RollbackStage UpdateStage = "rollback"
+)
+
+// UpdateTracer traces the stages of the update pipeline of Updaters, e.g. with OpenTelemetry (see `flagzotel`), so
+// that the latency between changes in the source and flags being applied is observable.
+type UpdateTracer interface {
+	// StartStage starts tracing `stage` of `flagName` (empty for stages of all flags, e.g. InitializeStage) at the
+	// backend-specific `revision` of the source, returning the context of its nested stages and a function to call
+	// with the outcome of the stage when it ends. Rejections the Updaters just skip (e.g. `ErrNotInCanary`) are passed
+	// as errors too.
+	StartStage(ctx context.Context, stage UpdateStage, flagName string, revision string) (context.Context, func(err error))
+}
+
+// NopUpdateTracer returns an UpdateTracer that traces nothing, the default of Updaters.
+func NopUpdateTracer() UpdateTracer {
+	return nopUpdateTracer{}
+}
+
+type nopUpdateTracer struct{}
+
+func (nopUpdateTracer) StartStage(ctx context.Context, stage UpdateStage, flagName string,
+	revision string) (context.Context, func(err error)) {
+	return ctx, func(error) {}
+}
+
+// IsSkippedUpdateError returns true for errors of values that Updaters skip rather than reject: missing values, values
+// of static flags while watching, canary values not targeting this instance and values of flags overridden on this
+// instance, and values of pinned flags held until they are unpinned. The errors may be wrapped, e.g. by `pflag`.
+func IsSkippedUpdateError(err error) bool {
+	return errors.Is(err, ErrNoValue) || errors.Is(err, ErrFlagNotDynamic) || errors.Is(err, ErrNotInCanary) ||
+		errors.Is(err, ErrFlagOverridden) || errors.Is(err, ErrFlagPinned)
+}
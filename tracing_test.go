@@ -0,0 +1,33 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/stretchr/testify/assert"
+)
+
+type tracingKey struct{}
+
+func TestNopUpdateTracer(t *testing.T) {
+	ctx := context.WithValue(context.Background(), tracingKey{}, "value")
+	stageCtx, end := flagz.NopUpdateTracer().StartStage(ctx, flagz.ApplyStage, "some_flag", "1")
+	assert.Equal(t, ctx, stageCtx, "the context must be passed through")
+	end(errors.New("some error"))
+}
+
+func TestIsSkippedUpdateError(t *testing.T) {
+	assert.True(t, flagz.IsSkippedUpdateError(flagz.ErrNotInCanary))
+	assert.True(t, flagz.IsSkippedUpdateError(flagz.ErrFlagOverridden))
+	assert.True(t, flagz.IsSkippedUpdateError(flagz.ErrFlagPinned), "held values of pinned flags are skipped")
+	assert.True(t, flagz.IsSkippedUpdateError(fmt.Errorf("flag some_dynint: %w", flagz.ErrFlagPinned)),
+		"wrapped errors are skipped too")
+	assert.False(t, flagz.IsSkippedUpdateError(flagz.ErrFlagNotFound), "unknown flags are errors")
+	assert.False(t, flagz.IsSkippedUpdateError(nil))
+}
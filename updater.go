@@ -0,0 +1,250 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	updateEventsBufferSize = 64
+)
+
+// Logger is the minimum logger interface needed by Updaters.
+// Default "log" and "logrus" should support these.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Updater is the common surface of all backends that sync flag values from an external source into a FlagSet.
+//
+// All backends in sub-packages implement it, so applications can pick (or compose) sources without depending on the
+// specifics of each of them.
+type Updater interface {
+	// Initialize performs the initial read of the source and sets all flags (dynamic and static) into the FlagSet.
+	Initialize() error
+	// Start kicks off the go routine that syncs dynamic flags from the source.
+	Start() error
+	// Stop stops the syncing go routine.
+	Stop() error
+	// Status returns a snapshot of the current state of the Updater.
+	Status() UpdaterStatus
+	// Events returns the channel on which flag updates applied (or rejected) by the syncing go routine are published.
+	Events() <-chan UpdateEvent
+}
+
+// UpdaterState is the lifecycle state of an Updater: New → Initialized → Watching ⇄ Stopped.
+type UpdaterState int
+
+const (
+	// UpdaterNew is the state of an Updater before a successful Initialize.
+	UpdaterNew UpdaterState = iota
+	// UpdaterInitialized is the state of an Updater after a successful Initialize, before the first Start.
+	UpdaterInitialized
+	// UpdaterWatching is the state of an Updater while its syncing go routine is running.
+	UpdaterWatching
+	// UpdaterStopped is the state of an Updater after Stop, from which it can be started again.
+	UpdaterStopped
+)
+
+var (
+	updaterStateNames = map[UpdaterState]string{
+		UpdaterNew:         "new",
+		UpdaterInitialized: "initialized",
+		UpdaterWatching:    "watching",
+		UpdaterStopped:     "stopped",
+	}
+	// updaterTransitions lists the states each state can move to.
+	updaterTransitions = map[UpdaterState][]UpdaterState{
+		UpdaterNew:         {UpdaterInitialized},
+		UpdaterInitialized: {UpdaterWatching},
+		UpdaterWatching:    {UpdaterStopped},
+		UpdaterStopped:     {UpdaterWatching},
+	}
+)
+
+func (s UpdaterState) String() string {
+	if name, ok := updaterStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("UpdaterState(%d)", int(s))
+}
+
+// CanTransition returns true if an Updater in state `s` can move to state `to`.
+func (s UpdaterState) CanTransition(to UpdaterState) bool {
+	for _, allowed := range updaterTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdaterStatus is a point-in-time snapshot of the state of an Updater.
+type UpdaterStatus struct {
+	// State is the lifecycle state of the Updater.
+	State UpdaterState
+	// Initialized is true once Initialize succeeded.
+	Initialized bool
+	// Running is true while the syncing go routine is started.
+	Running bool
+	// Revision is the backend-specific version of the last applied state (e.g. etcd index or git commit).
+	Revision string
+	// LastSync is the time of the last successful sync with the source, regardless of whether anything changed.
+	LastSync time.Time
+	// LastUpdate is the time a flag was last successfully updated by the Updater.
+	LastUpdate time.Time
+	// LastError is the last error encountered while syncing, nil if the last sync succeeded.
+	LastError error
+	// ConsecutiveErrors is the number of syncs that failed since the last successful one.
+	ConsecutiveErrors int
+	// Updates is the number of dynamic flag updates successfully applied.
+	Updates uint64
+	// UpdateErrors is the number of dynamic flag updates rejected, e.g. because of bad values.
+	UpdateErrors uint64
+}
+
+// UpdateEvent describes a single dynamic flag update attempted by an Updater.
+type UpdateEvent struct {
+	Time     time.Time
+	FlagName string
+	Value    string
+	Revision string
+	// Err is set if the value was rejected, e.g. it failed to parse or validate.
+	Err error
+}
+
+// UpdaterTracker keeps the Status and Events of an Updater. Backends embed it to implement these methods.
+//
+// Events are delivered on a buffered channel and dropped if nobody consumes them, so a slow consumer never blocks
+// flag updates.
+type UpdaterTracker struct {
+	mu     sync.Mutex
+	status UpdaterStatus
+	events chan UpdateEvent
+}
+
+// NewUpdaterTracker creates a tracker for a new, uninitialized Updater.
+func NewUpdaterTracker() *UpdaterTracker {
+	return &UpdaterTracker{events: make(chan UpdateEvent, updateEventsBufferSize)}
+}
+
+// Status returns a snapshot of the current state of the Updater.
+func (t *UpdaterTracker) Status() UpdaterStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+// Events returns the channel on which flag updates are published.
+func (t *UpdaterTracker) Events() <-chan UpdateEvent {
+	return t.events
+}
+
+// State returns the current lifecycle state of the Updater.
+func (t *UpdaterTracker) State() UpdaterState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status.State
+}
+
+// CheckTransition returns an error if the Updater can't move from its current state to `to`. Backends call it before
+// doing the work of a transition, and `Transition` once that work succeeded.
+func (t *UpdaterTracker) CheckTransition(to UpdaterState) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return checkTransition(t.status.State, to)
+}
+
+// Transition moves the Updater to state `to`, returning an error and staying in the current state if that transition
+// isn't allowed.
+func (t *UpdaterTracker) Transition(to UpdaterState) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := checkTransition(t.status.State, to); err != nil {
+		return err
+	}
+	t.setState(to)
+	return nil
+}
+
+func checkTransition(from UpdaterState, to UpdaterState) error {
+	if !from.CanTransition(to) {
+		return fmt.Errorf("flagz: updater can't go from %v to %v", from, to)
+	}
+	return nil
+}
+
+// setState moves to `state`, keeping the `Initialized` and `Running` fields in sync. Must be called with `mu` held.
+func (t *UpdaterTracker) setState(state UpdaterState) {
+	t.status.State = state
+	t.status.Running = state == UpdaterWatching
+	if state == UpdaterInitialized {
+		t.status.Initialized = true
+		t.status.LastSync = time.Now()
+		t.status.LastError = nil
+		t.status.ConsecutiveErrors = 0
+	}
+}
+
+// MarkInitialized records a successful Initialize, moving to UpdaterInitialized. Unlike `Transition` it isn't guarded.
+func (t *UpdaterTracker) MarkInitialized() {
+	t.mu.Lock()
+	t.setState(UpdaterInitialized)
+	t.mu.Unlock()
+}
+
+// MarkRunning records whether the syncing go routine is running, moving to UpdaterWatching or UpdaterStopped. Unlike
+// `Transition` it isn't guarded.
+func (t *UpdaterTracker) MarkRunning(running bool) {
+	t.mu.Lock()
+	if running {
+		t.setState(UpdaterWatching)
+	} else {
+		t.setState(UpdaterStopped)
+	}
+	t.mu.Unlock()
+}
+
+// RecordRevision records the backend-specific version of the state being applied.
+func (t *UpdaterTracker) RecordRevision(revision string) {
+	t.mu.Lock()
+	t.status.Revision = revision
+	t.mu.Unlock()
+}
+
+// RecordSync records the outcome of a sync with the source: nil for a successful one, otherwise the error that isn't
+// related to a single flag, e.g. the source being unreachable.
+func (t *UpdaterTracker) RecordSync(err error) {
+	t.mu.Lock()
+	t.status.LastError = err
+	if err != nil {
+		t.status.ConsecutiveErrors++
+	} else {
+		t.status.LastSync = time.Now()
+		t.status.ConsecutiveErrors = 0
+	}
+	t.mu.Unlock()
+}
+
+// RecordUpdate records the outcome of updating `flagName` to `value` and publishes it as an UpdateEvent.
+func (t *UpdaterTracker) RecordUpdate(flagName string, value string, err error) {
+	t.mu.Lock()
+	event := UpdateEvent{Time: time.Now(), FlagName: flagName, Value: value, Revision: t.status.Revision, Err: err}
+	if err != nil {
+		t.status.LastError = err
+		t.status.UpdateErrors++
+	} else {
+		t.status.LastUpdate = event.Time
+		t.status.Updates++
+	}
+	t.mu.Unlock()
+	select {
+	case t.events <- event:
+	default:
+		// nobody is consuming events, drop it.
+	}
+}
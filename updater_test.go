@@ -0,0 +1,88 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdaterTracker_TracksStatus(t *testing.T) {
+	tracker := flagz.NewUpdaterTracker()
+	assert.False(t, tracker.Status().Initialized, "a new tracker must not be initialized")
+	tracker.MarkInitialized()
+	tracker.MarkRunning(true)
+	tracker.RecordRevision("rev1")
+	status := tracker.Status()
+	assert.True(t, status.Initialized)
+	assert.True(t, status.Running)
+	assert.Equal(t, "rev1", status.Revision)
+	assert.True(t, status.LastUpdate.IsZero(), "no update happened yet")
+
+	tracker.RecordUpdate("some_flag", "bad", fmt.Errorf("bad value"))
+	assert.Error(t, tracker.Status().LastError, "rejected updates must be reflected in the last error")
+	tracker.RecordUpdate("some_flag", "good", nil)
+	assert.False(t, tracker.Status().LastUpdate.IsZero(), "successful updates must be reflected in the last update")
+	assert.EqualValues(t, 1, tracker.Status().Updates, "successful updates must be counted")
+	assert.EqualValues(t, 1, tracker.Status().UpdateErrors, "rejected updates must be counted")
+}
+
+func TestUpdaterTracker_GuardsStateTransitions(t *testing.T) {
+	tracker := flagz.NewUpdaterTracker()
+	assert.Equal(t, flagz.UpdaterNew, tracker.State())
+	assert.Error(t, tracker.Transition(flagz.UpdaterWatching), "an uninitialized updater must not start watching")
+	assert.Error(t, tracker.CheckTransition(flagz.UpdaterStopped), "an uninitialized updater must not stop")
+	require.NoError(t, tracker.CheckTransition(flagz.UpdaterInitialized))
+	assert.Equal(t, flagz.UpdaterNew, tracker.State(), "checking a transition must not make it")
+
+	require.NoError(t, tracker.Transition(flagz.UpdaterInitialized))
+	assert.Error(t, tracker.Transition(flagz.UpdaterInitialized), "initializing twice must fail")
+	require.NoError(t, tracker.Transition(flagz.UpdaterWatching))
+	assert.True(t, tracker.Status().Running)
+	assert.Error(t, tracker.Transition(flagz.UpdaterWatching), "starting twice must fail")
+	require.NoError(t, tracker.Transition(flagz.UpdaterStopped))
+	status := tracker.Status()
+	assert.Equal(t, flagz.UpdaterStopped, status.State)
+	assert.Equal(t, "stopped", status.State.String())
+	assert.True(t, status.Initialized, "stopped updaters stay initialized")
+	assert.False(t, status.Running)
+	require.NoError(t, tracker.Transition(flagz.UpdaterWatching), "stopped updaters must be restartable")
+}
+
+func TestUpdaterTracker_PublishesEvents(t *testing.T) {
+	tracker := flagz.NewUpdaterTracker()
+	tracker.RecordRevision("rev2")
+	tracker.RecordUpdate("some_flag", "1337", nil)
+	event := <-tracker.Events()
+	assert.Equal(t, "some_flag", event.FlagName)
+	assert.Equal(t, "1337", event.Value)
+	assert.Equal(t, "rev2", event.Revision, "events must carry the revision they were applied at")
+	assert.NoError(t, event.Err)
+}
+
+func TestUpdaterTracker_DropsEventsWithoutConsumer(t *testing.T) {
+	tracker := flagz.NewUpdaterTracker()
+	for i := 0; i < 1000; i++ {
+		tracker.RecordUpdate("some_flag", fmt.Sprintf("%d", i), nil)
+	}
+	require.NotEmpty(t, tracker.Events(), "buffered events must be kept")
+}
+
+func TestUpdaterTracker_CountsConsecutiveSyncErrors(t *testing.T) {
+	tracker := flagz.NewUpdaterTracker()
+	tracker.MarkInitialized()
+	initialSync := tracker.Status().LastSync
+	assert.False(t, initialSync.IsZero(), "initialization must count as a sync")
+	tracker.RecordSync(fmt.Errorf("unreachable"))
+	tracker.RecordSync(fmt.Errorf("unreachable"))
+	assert.Equal(t, 2, tracker.Status().ConsecutiveErrors)
+	assert.Equal(t, initialSync, tracker.Status().LastSync, "failed syncs must not move the last sync")
+	tracker.RecordSync(nil)
+	assert.Equal(t, 0, tracker.Status().ConsecutiveErrors, "successful syncs must reset the error count")
+	assert.NoError(t, tracker.Status().LastError)
+}
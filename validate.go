@@ -0,0 +1,31 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	flag "github.com/spf13/pflag"
+)
+
+// ValidatedValue is implemented by all dynamic values, checking their current value against their validator.
+type ValidatedValue interface {
+	Validate() error
+}
+
+// ValidateAll checks the current values of all dynamic flags of `flagSet` against their validators, returning a
+// `*FlagErrors` listing the ones that don't pass.
+//
+// Validators only run on `Set`, so a default violating the flag's own constraints would otherwise only show up on the
+// first dynamic update. Call it at startup, after registering all flags and their validators and parsing the command
+// line, to fail fast instead.
+func ValidateAll(flagSet *flag.FlagSet) error {
+	errs := &FlagErrors{Source: "current values"}
+	for _, f := range DynamicFlags(flagSet) {
+		if v, ok := f.Value.(ValidatedValue); ok {
+			if err := v.Validate(); err != nil {
+				errs.Add(f.Name, err)
+			}
+		}
+	}
+	return errs.ErrorOrNil()
+}
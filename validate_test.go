@@ -0,0 +1,44 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAll_ReportsDefaultsFailingValidators(t *testing.T) {
+	set := flag.NewFlagSet("validate_test", flag.ContinueOnError)
+	flagz.DynInt64(set, "good_int", 5, "dynamic int").WithValidator(flagz.ValidateDynInt64Range(0, 10))
+	flagz.DynInt64(set, "bad_int", 50, "dynamic int").WithValidator(flagz.ValidateDynInt64Range(0, 10))
+	flagz.DynDuration(set, "bad_duration", time.Hour, "dynamic duration").WithValidator(func(d time.Duration) error {
+		if d > time.Minute {
+			return errors.New("too long")
+		}
+		return nil
+	})
+	flagz.DynString(set, "no_validator", "", "dynamic string")
+	set.Int64("static_int", 50, "static int")
+
+	err := flagz.ValidateAll(set)
+	require.Error(t, err, "defaults failing their validators must be reported")
+	flagErrs, ok := err.(*flagz.FlagErrors)
+	require.True(t, ok, "validation errors must be typed")
+	names := []string{}
+	for _, e := range flagErrs.Errors {
+		names = append(names, e.Flag)
+		assert.Equal(t, flagz.FlagErrorValidation, e.Kind)
+	}
+	assert.Equal(t, []string{"bad_duration", "bad_int"}, names)
+
+	require.NoError(t, set.Set("bad_int", "7"))
+	require.NoError(t, set.Set("bad_duration", "1s"))
+	assert.NoError(t, flagz.ValidateAll(set), "fixed values must pass")
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// DefaultValidatorTimeout bounds the validators set with `WithValidatorCtx` of updates whose context has no deadline,
+// including values set without a context, e.g. from the command line.
+const DefaultValidatorTimeout = 5 * time.Second
+
+var (
+	updateContextsMu sync.Mutex
+	updateContexts   = make(map[flag.Value]context.Context)
+	updateLocks      = make(map[flag.Value]*sync.Mutex)
+)
+
+// UpdateInfo describes the update being validated by the validators set with `WithValidatorCtx`.
+type UpdateInfo struct {
+	FlagName string
+	// Source is where the update comes from, see `SetFlagFromSource`. It is empty for values set in other ways, e.g.
+	// from the command line.
+	Source string
+	// Key is the backend-specific key of the update, e.g. the etcd key, if any.
+	Key string
+	// Revision is the backend-specific revision of the update, e.g. the etcd index, if any.
+	Revision string
+}
+
+type updateInfoKey struct{}
+
+// NewUpdateContext returns a copy of `ctx` carrying `info`, e.g. for Updaters to pass the key of an update to
+// `SetFlagFromSourceCtx`.
+func NewUpdateContext(ctx context.Context, info UpdateInfo) context.Context {
+	return context.WithValue(ctx, updateInfoKey{}, info)
+}
+
+// UpdateInfoFromContext returns the UpdateInfo carried by the context of validators, if any.
+func UpdateInfoFromContext(ctx context.Context) (UpdateInfo, bool) {
+	info, ok := ctx.Value(updateInfoKey{}).(UpdateInfo)
+	return info, ok
+}
+
+// SetFlagFromSourceCtx is like `SetFlagFromSource`, but passes `ctx` to the validators of the flag set with
+// `WithValidatorCtx`, along with an UpdateInfo of the flag and `source` unless `ctx` already carries one. Updates with
+// a context of the same flag are serialized. As `ctx` is also the parent of the contexts of notifiers set with
+// `WithNotifierCtx`, it should live as long as the source, e.g. until the Updater is stopped.
+func SetFlagFromSourceCtx(ctx context.Context, flagSet *flag.FlagSet, name string, value string, source string) error {
+	f := flagSet.Lookup(name)
+	if f == nil || reflect.ValueOf(f.Value).Kind() != reflect.Ptr {
+		return setFlagFromSource(ctx, flagSet, name, value, source)
+	}
+	if _, ok := UpdateInfoFromContext(ctx); !ok {
+		ctx = NewUpdateContext(ctx, UpdateInfo{FlagName: f.Name, Source: source})
+	}
+	updateContextsMu.Lock()
+	lock, ok := updateLocks[f.Value]
+	if !ok {
+		lock = &sync.Mutex{}
+		updateLocks[f.Value] = lock
+	}
+	updateContextsMu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+	updateContextsMu.Lock()
+	updateContexts[f.Value] = ctx
+	updateContextsMu.Unlock()
+	defer func() {
+		updateContextsMu.Lock()
+		delete(updateContexts, f.Value)
+		updateContextsMu.Unlock()
+	}()
+	return setFlagFromSource(ctx, flagSet, name, value, source)
+}
+
+// RunValidatorCtx runs `validate`, a validator of `value` set with `WithValidatorCtx`, with the context of the update
+// being set by `SetFlagFromSourceCtx`, or a new one. Contexts without a deadline get one of DefaultValidatorTimeout.
+// It is used by dynamic values (including the ones in sub-packages) in `Set` and `Validate`.
+func RunValidatorCtx(value flag.Value, validate func(ctx context.Context) error) error {
+	ctx, ok := updateContext(value)
+	if !ok {
+		ctx = context.Background()
+	}
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultValidatorTimeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return validate(ctx)
+}
+
+// updateContext returns the context of the update of `value` being set by `SetFlagFromSourceCtx`, if any.
+func updateContext(value flag.Value) (context.Context, bool) {
+	updateContextsMu.Lock()
+	defer updateContextsMu.Unlock()
+	ctx, ok := updateContexts[value]
+	return ctx, ok
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mwitkow/go-flagz"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithValidatorCtx_GetsUpdateInfoAndDeadline(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	var infos []flagz.UpdateInfo
+	flagz.DynString(set, "some_host", "localhost", "Some host").
+		WithValidatorCtx(func(ctx context.Context, value string) error {
+			_, hasDeadline := ctx.Deadline()
+			assert.True(t, hasDeadline, "validators must be bounded")
+			info, _ := flagz.UpdateInfoFromContext(ctx)
+			infos = append(infos, info)
+			if value == "unresolvable" {
+				return errors.New("no such host")
+			}
+			return nil
+		})
+
+	require.NoError(t, flagz.SetFlagFromSource(set, "some_host", "example.com", "etcd"))
+	ctx := flagz.NewUpdateContext(context.Background(), flagz.UpdateInfo{FlagName: "some_host", Source: "etcd",
+		Key: "/flagz/some_host"})
+	require.NoError(t, flagz.SetFlagFromSourceCtx(ctx, set, "some_host", "example.org", "etcd"))
+	require.NoError(t, set.Set("some_host", "example.net"))
+	require.Equal(t, []flagz.UpdateInfo{
+		{FlagName: "some_host", Source: "etcd"},
+		{FlagName: "some_host", Source: "etcd", Key: "/flagz/some_host"},
+		{},
+	}, infos)
+
+	var validationErr *flagz.ValidationError
+	assert.True(t, errors.As(flagz.SetFlagFromSource(set, "some_host", "unresolvable", "etcd"), &validationErr),
+		"values rejected by the validator must fail validation")
+	assert.Equal(t, "example.net", set.Lookup("some_host").Value.String())
+}
+
+func TestWithValidatorCtx_HonorsCancellation(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	value := flagz.DynInt64(set, "some_int", 1, "Some int")
+	value.WithValidatorCtx(func(ctx context.Context, value int64) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	err := flagz.SetFlagFromSourceCtx(ctx, set, "some_int", "2", "etcd")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "validators must honor the deadline of the update")
+	assert.Equal(t, int64(1), value.Get())
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, flagz.SetFlagFromSourceCtx(cancelled, set, "some_int", "2", "etcd"),
+		"updates with a cancelled context must be rejected")
+}
+
+func TestWithValidatorCtx_ChecksDefaults(t *testing.T) {
+	set := flag.NewFlagSet("foobar", flag.ContinueOnError)
+	flagz.DynDuration(set, "some_duration", 0, "Some duration").
+		WithValidatorCtx(func(ctx context.Context, value time.Duration) error {
+			if value <= 0 {
+				return errors.New("must be positive")
+			}
+			return nil
+		})
+	assert.Error(t, flagz.ValidateAll(set), "defaults must be checked by the validators with a context")
+}
@@ -0,0 +1,317 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+// Package etcdtest provides an in-memory etcd (v2) `KeysAPI` for testing the Watcher and other code using etcd, with
+// injectable errors, without running an etcd binary.
+
+package etcdtest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	etcd "github.com/coreos/etcd/client"
+	"golang.org/x/net/context"
+)
+
+// KeysAPI is an in-memory implementation of `etcd.KeysAPI`, keeping the history of changes for its watchers.
+//
+// Errors injected with `InjectGetError` and `InjectWatchError` are returned by the next calls, in order, before any
+// real result. `ClearHistory` makes watchers behind the current index fail with `EventIndexCleared`, like etcd does
+// once they fall out of its event log.
+type KeysAPI struct {
+	mu           sync.Mutex
+	index        uint64
+	leaves       map[string]*etcd.Node
+	history      []*etcd.Response
+	clearedIndex uint64
+	changed      chan struct{} // closed and replaced on every change, waking up watchers.
+
+	getErrors   []error
+	watchErrors []error
+}
+
+// New constructs an empty KeysAPI.
+func New() *KeysAPI {
+	return &KeysAPI{leaves: make(map[string]*etcd.Node), changed: make(chan struct{})}
+}
+
+// InjectGetError makes a future call of Get return `err`.
+func (k *KeysAPI) InjectGetError(err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.getErrors = append(k.getErrors, err)
+}
+
+// InjectWatchError makes a future call of `Next` of any of the watchers return `err`, e.g. an `*etcd.ClusterError`.
+func (k *KeysAPI) InjectWatchError(err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.watchErrors = append(k.watchErrors, err)
+	k.notify()
+}
+
+// ClearHistory drops the history of changes, so that watchers behind the current index fail with `EventIndexCleared`.
+func (k *KeysAPI) ClearHistory() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.history = nil
+	k.clearedIndex = k.index
+	k.notify()
+}
+
+// Index returns the index of the last change.
+func (k *KeysAPI) Index() uint64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.index
+}
+
+// Get returns the leaf or directory at `key`, sorting the children of directories by key if `opts.Sort` is set.
+func (k *KeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.getErrors) > 0 {
+		err := k.getErrors[0]
+		k.getErrors = k.getErrors[1:]
+		return nil, err
+	}
+	if opts == nil {
+		opts = &etcd.GetOptions{}
+	}
+	key = normalizeKey(key)
+	if node, ok := k.leaves[key]; ok {
+		return &etcd.Response{Action: "get", Node: copyNode(node), Index: k.index}, nil
+	}
+	node := k.dirNode(key, opts.Recursive, opts.Sort)
+	if node == nil {
+		return nil, k.errorf(etcd.ErrorCodeKeyNotFound, key, "Key not found")
+	}
+	return &etcd.Response{Action: "get", Node: node, Index: k.index}, nil
+}
+
+// Set stores `value` at `key`, checking `opts.PrevIndex`, `opts.PrevValue` and `opts.PrevExist` if they are set.
+func (k *KeysAPI) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if opts == nil {
+		opts = &etcd.SetOptions{}
+	}
+	key = normalizeKey(key)
+	prev, exists := k.leaves[key]
+	action := "set"
+	switch {
+	case opts.PrevExist == etcd.PrevNoExist && exists:
+		return nil, k.errorf(etcd.ErrorCodeNodeExist, key, "Key already exists")
+	case opts.PrevExist == etcd.PrevExist && !exists:
+		return nil, k.errorf(etcd.ErrorCodeKeyNotFound, key, "Key not found")
+	case opts.PrevIndex != 0 || opts.PrevValue != "":
+		if !exists {
+			return nil, k.errorf(etcd.ErrorCodeKeyNotFound, key, "Key not found")
+		}
+		if (opts.PrevIndex != 0 && prev.ModifiedIndex != opts.PrevIndex) ||
+			(opts.PrevValue != "" && prev.Value != opts.PrevValue) {
+			return nil, k.errorf(etcd.ErrorCodeTestFailed, key, "Compare failed")
+		}
+		action = "compareAndSwap"
+	case opts.PrevExist == etcd.PrevNoExist:
+		action = "create"
+	case opts.PrevExist == etcd.PrevExist:
+		action = "update"
+	}
+	k.index++
+	node := &etcd.Node{Key: key, Value: value, CreatedIndex: k.index, ModifiedIndex: k.index}
+	if exists {
+		node.CreatedIndex = prev.CreatedIndex
+	}
+	k.leaves[key] = node
+	return k.record(action, node, prev), nil
+}
+
+// Delete removes the leaf at `key`, checking `opts.PrevIndex` and `opts.PrevValue` if they are set.
+func (k *KeysAPI) Delete(ctx context.Context, key string, opts *etcd.DeleteOptions) (*etcd.Response, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if opts == nil {
+		opts = &etcd.DeleteOptions{}
+	}
+	key = normalizeKey(key)
+	prev, exists := k.leaves[key]
+	if !exists {
+		return nil, k.errorf(etcd.ErrorCodeKeyNotFound, key, "Key not found")
+	}
+	action := "delete"
+	if opts.PrevIndex != 0 || opts.PrevValue != "" {
+		if (opts.PrevIndex != 0 && prev.ModifiedIndex != opts.PrevIndex) ||
+			(opts.PrevValue != "" && prev.Value != opts.PrevValue) {
+			return nil, k.errorf(etcd.ErrorCodeTestFailed, key, "Compare failed")
+		}
+		action = "compareAndDelete"
+	}
+	k.index++
+	delete(k.leaves, key)
+	node := &etcd.Node{Key: key, CreatedIndex: prev.CreatedIndex, ModifiedIndex: k.index}
+	return k.record(action, node, prev), nil
+}
+
+// Create stores `value` at `key` if it doesn't exist yet.
+func (k *KeysAPI) Create(ctx context.Context, key, value string) (*etcd.Response, error) {
+	return k.Set(ctx, key, value, &etcd.SetOptions{PrevExist: etcd.PrevNoExist})
+}
+
+// CreateInOrder stores `value` under `dir` at a key named after the index of the change.
+func (k *KeysAPI) CreateInOrder(ctx context.Context, dir, value string, opts *etcd.CreateInOrderOptions) (*etcd.Response, error) {
+	k.mu.Lock()
+	key := fmt.Sprintf("%s/%020d", normalizeKey(dir), k.index+1)
+	k.mu.Unlock()
+	return k.Create(ctx, key, value)
+}
+
+// Update stores `value` at `key` if it already exists.
+func (k *KeysAPI) Update(ctx context.Context, key, value string) (*etcd.Response, error) {
+	return k.Set(ctx, key, value, &etcd.SetOptions{PrevExist: etcd.PrevExist})
+}
+
+// Watcher returns a watcher of the changes of `key` (and of the keys under it if `opts.Recursive` is set) after
+// `opts.AfterIndex`, or after the current index if it isn't set.
+func (k *KeysAPI) Watcher(key string, opts *etcd.WatcherOptions) etcd.Watcher {
+	if opts == nil {
+		opts = &etcd.WatcherOptions{}
+	}
+	afterIndex := opts.AfterIndex
+	if afterIndex == 0 {
+		afterIndex = k.Index()
+	}
+	return &watcher{keys: k, key: normalizeKey(key), recursive: opts.Recursive, afterIndex: afterIndex}
+}
+
+type watcher struct {
+	keys       *KeysAPI
+	key        string
+	recursive  bool
+	afterIndex uint64
+}
+
+// Next returns the next change after the last one returned, blocking until it happens or `ctx` is done.
+func (w *watcher) Next(ctx context.Context) (*etcd.Response, error) {
+	for {
+		resp, changed, err := w.keys.next(w)
+		if resp != nil || err != nil {
+			return resp, err
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// next returns the next change matching `w`, an error, or the channel signalling the next change if there are none.
+func (k *KeysAPI) next(w *watcher) (*etcd.Response, <-chan struct{}, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.watchErrors) > 0 {
+		err := k.watchErrors[0]
+		k.watchErrors = k.watchErrors[1:]
+		return nil, nil, err
+	}
+	if w.afterIndex < k.clearedIndex {
+		return nil, nil, k.errorf(etcd.ErrorCodeEventIndexCleared, w.key, "The event in requested index is outdated and cleared")
+	}
+	for _, resp := range k.history {
+		if resp.Index <= w.afterIndex || !w.matches(resp.Node.Key) {
+			continue
+		}
+		w.afterIndex = resp.Index
+		return resp, nil, nil
+	}
+	return nil, k.changed, nil
+}
+
+func (w *watcher) matches(key string) bool {
+	return key == w.key || (w.recursive && strings.HasPrefix(key, strings.TrimSuffix(w.key, "/")+"/"))
+}
+
+// record appends a change to the history and wakes up watchers. Must be called with `mu` held.
+func (k *KeysAPI) record(action string, node *etcd.Node, prev *etcd.Node) *etcd.Response {
+	resp := &etcd.Response{Action: action, Node: copyNode(node), Index: k.index}
+	if prev != nil {
+		resp.PrevNode = copyNode(prev)
+	}
+	k.history = append(k.history, resp)
+	k.notify()
+	return resp
+}
+
+// notify wakes up watchers. Must be called with `mu` held.
+func (k *KeysAPI) notify() {
+	close(k.changed)
+	k.changed = make(chan struct{})
+}
+
+// dirNode builds the directory node of `key` out of the leaves under it, or returns nil if there are none. Must be
+// called with `mu` held.
+func (k *KeysAPI) dirNode(key string, recursive bool, sorted bool) *etcd.Node {
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	dir := &etcd.Node{Key: key, Dir: true}
+	children := map[string]*etcd.Node{}
+	found := false
+	for leafKey, leaf := range k.leaves {
+		if !strings.HasPrefix(leafKey, prefix) {
+			continue
+		}
+		found = true
+		rest := strings.TrimPrefix(leafKey, prefix)
+		if !strings.Contains(rest, "/") {
+			children[leafKey] = copyNode(leaf)
+			continue
+		}
+		childKey := prefix + rest[:strings.Index(rest, "/")]
+		if _, ok := children[childKey]; !ok {
+			if recursive {
+				children[childKey] = k.dirNode(childKey, recursive, sorted)
+			} else {
+				children[childKey] = &etcd.Node{Key: childKey, Dir: true}
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	for _, child := range children {
+		dir.Nodes = append(dir.Nodes, child)
+	}
+	if sorted {
+		sort.Sort(nodesByKey(dir.Nodes))
+	}
+	return dir
+}
+
+// errorf returns an etcd error at the current index. Must be called with `mu` held.
+func (k *KeysAPI) errorf(code int, key string, message string) error {
+	return etcd.Error{Code: code, Message: message, Cause: key, Index: k.index}
+}
+
+func normalizeKey(key string) string {
+	if !strings.HasPrefix(key, "/") {
+		key = "/" + key
+	}
+	if key != "/" {
+		key = strings.TrimSuffix(key, "/")
+	}
+	return key
+}
+
+func copyNode(node *etcd.Node) *etcd.Node {
+	c := *node
+	return &c
+}
+
+type nodesByKey etcd.Nodes
+
+func (n nodesByKey) Len() int           { return len(n) }
+func (n nodesByKey) Less(i, j int) bool { return n[i].Key < n[j].Key }
+func (n nodesByKey) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
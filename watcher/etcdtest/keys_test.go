@@ -0,0 +1,395 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package etcdtest_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	etcd "github.com/coreos/etcd/client"
+	"github.com/mwitkow/go-flagz"
+	"github.com/mwitkow/go-flagz/watcher"
+	"github.com/mwitkow/go-flagz/watcher/etcdtest"
+	flag "github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+const prefix = "/flagz/test/"
+
+func TestKeysAPI_GetSetDeleteAndWatch(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	_, err := keys.Get(ctx, prefix, nil)
+	assert.True(t, isEtcdError(err, etcd.ErrorCodeKeyNotFound), "missing keys must fail like etcd")
+
+	w := keys.Watcher(prefix, &etcd.WatcherOptions{Recursive: true})
+	_, err = keys.Set(ctx, prefix+"b", "2", nil)
+	require.NoError(t, err)
+	_, err = keys.Set(ctx, prefix+"a", "1", nil)
+	require.NoError(t, err)
+	_, err = keys.Set(ctx, prefix+"nested/c", "3", nil)
+	require.NoError(t, err)
+
+	resp, err := keys.Get(ctx, prefix, &etcd.GetOptions{Recursive: true, Sort: true})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, resp.Index)
+	require.Len(t, resp.Node.Nodes, 3)
+	assert.Equal(t, prefix+"a", resp.Node.Nodes[0].Key, "children must be sorted")
+	assert.True(t, resp.Node.Nodes[2].Dir, "nested keys must be in directories")
+	assert.Equal(t, "3", resp.Node.Nodes[2].Nodes[0].Value, "recursive gets must return nested keys")
+
+	_, err = keys.Set(ctx, prefix+"a", "10", &etcd.SetOptions{PrevIndex: 1})
+	assert.True(t, isEtcdError(err, etcd.ErrorCodeTestFailed), "compare-and-swap of a stale index must fail")
+	_, err = keys.Delete(ctx, prefix+"a", &etcd.DeleteOptions{PrevIndex: 2})
+	require.NoError(t, err)
+
+	for _, expected := range []string{"set", "set", "set", "compareAndDelete"} {
+		event, err := w.Next(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, expected, event.Action)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = w.Next(timeoutCtx)
+	assert.Equal(t, context.DeadlineExceeded, err, "watchers must block until the next change")
+
+	keys.ClearHistory()
+	_, err = keys.Watcher(prefix, &etcd.WatcherOptions{AfterIndex: 1, Recursive: true}).Next(ctx)
+	assert.True(t, isEtcdError(err, etcd.ErrorCodeEventIndexCleared), "watchers behind the history must fail")
+}
+
+func TestKeysAPI_InjectsErrors(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	injected := errors.New("injected")
+	keys.InjectGetError(injected)
+	_, err := keys.Get(ctx, prefix, nil)
+	assert.Equal(t, injected, err)
+	keys.InjectWatchError(injected)
+	_, err = keys.Watcher(prefix, nil).Next(ctx)
+	assert.Equal(t, injected, err)
+}
+
+func TestWatcher_RecoversFromEtcdErrors(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"some_dynint", "1", nil)
+	set := flag.NewFlagSet("etcdtest", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 0, "dynamic int")
+	dynInt.WithValidator(flagz.ValidateDynInt64Range(0, 100))
+	w, err := watcher.New(set, keys, prefix, &testingLog{T: t})
+	require.NoError(t, err)
+	require.NoError(t, w.Initialize())
+	assert.EqualValues(t, 1, dynInt.Get())
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	keys.InjectWatchError(&etcd.ClusterError{Errors: []error{errors.New("unreachable")}})
+	keys.Set(ctx, prefix+"some_dynint", "2", nil)
+	require.Eventually(t, func() bool { return dynInt.Get() == 2 }, time.Second, time.Millisecond,
+		"the watcher must retry after a cluster error")
+	assert.Equal(t, 0, w.Status().ConsecutiveErrors, "errors must be cleared after a successful sync")
+
+	keys.Set(ctx, prefix+"some_dynint", "300", nil)
+	require.Eventually(t, func() bool {
+		resp, err := keys.Get(ctx, prefix+"some_dynint", nil)
+		return err == nil && resp.Node.Value == "2"
+	}, time.Second, time.Millisecond, "rejected values must be rolled back in etcd")
+
+	w.Stop()
+	keys.Set(ctx, prefix+"some_dynint", "3", nil)
+	keys.ClearHistory()
+	require.NoError(t, w.Start())
+	require.Eventually(t, func() bool { return dynInt.Get() == 3 }, 2*time.Second, time.Millisecond,
+		"the watcher must re-read everything after the index was cleared")
+}
+
+func TestWatcher_RollsBackUnsignedValues(t *testing.T) {
+	key := []byte("secret")
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"some_dynint", flagz.SignFlagValue(key, "some_dynint", "1"), nil)
+	set := flag.NewFlagSet("etcdtest", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 0, "dynamic int")
+	w, err := watcher.New(set, keys, prefix, &testingLog{T: t})
+	require.NoError(t, err)
+	w.WithSigningKeys(key)
+	require.NoError(t, w.Initialize())
+	assert.EqualValues(t, 1, dynInt.Get(), "signed values must be applied")
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	keys.Set(ctx, prefix+"some_dynint", "2", nil)
+	event := <-w.Events()
+	assert.Equal(t, flagz.ErrUnsignedValue, event.Err)
+	assert.EqualValues(t, 1, dynInt.Get(), "unsigned values must not be applied")
+	require.Eventually(t, func() bool {
+		resp, err := keys.Get(ctx, prefix+"some_dynint", nil)
+		return err == nil && resp.Node.Value == flagz.SignFlagValue(key, "some_dynint", "1")
+	}, time.Second, time.Millisecond, "unsigned values must be rolled back")
+	event = <-w.Events()
+	assert.Equal(t, "1", event.Value, "the rolled back value must be applied again")
+
+	keys.Set(ctx, prefix+"some_dynint", flagz.SignFlagValue(key, "some_dynint", "3"), nil)
+	event = <-w.Events()
+	assert.NoError(t, event.Err)
+	assert.Equal(t, "3", event.Value, "events must show the value without its signature")
+	assert.EqualValues(t, 3, dynInt.Get())
+}
+
+func TestWatcher_SchedulesValues(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"some_dynint", "1", nil)
+	set := flag.NewFlagSet("etcdtest", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 0, "dynamic int")
+	scheduler := flagz.NewScheduler(set, &testingLog{T: t})
+	defer scheduler.Stop()
+	w, err := watcher.New(set, keys, prefix, &testingLog{T: t})
+	require.NoError(t, err)
+	w.WithScheduler(scheduler)
+	require.NoError(t, w.Initialize())
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	scheduled, err := (&flagz.ScheduledValue{Value: "5", Start: time.Now().Add(100 * time.Millisecond)}).Encode()
+	require.NoError(t, err)
+	keys.Set(ctx, prefix+"some_dynint", scheduled, nil)
+	event := <-w.Events()
+	assert.NoError(t, event.Err)
+	assert.EqualValues(t, 1, dynInt.Get(), "scheduled values must not be applied before their window")
+	require.Eventually(t, func() bool { return dynInt.Get() == 5 }, time.Second, time.Millisecond,
+		"scheduled values must be applied when their window opens")
+}
+
+func TestWatcher_IgnoresCanaryValuesOfOtherInstances(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"some_dynint", "1", nil)
+	set := flag.NewFlagSet("etcdtest", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 0, "dynamic int")
+	w, err := watcher.New(set, keys, prefix, &testingLog{T: t})
+	require.NoError(t, err)
+	canary := &flagz.CanaryValue{Percentage: 50, Value: "2"}
+	instance := "frontend-0"
+	for i := 1; canary.InCanary(instance); i++ {
+		instance = fmt.Sprintf("frontend-%d", i)
+	}
+	w.WithInstanceID(instance)
+	require.NoError(t, w.Initialize())
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	encoded, err := canary.Encode()
+	require.NoError(t, err)
+	keys.Set(ctx, prefix+"some_dynint", encoded, nil)
+	keys.Set(ctx, prefix+"some_dynint", "3", nil)
+	event := <-w.Events()
+	assert.NoError(t, event.Err)
+	assert.Equal(t, "3", event.Value, "canary values of other instances must not be recorded as updates")
+	assert.EqualValues(t, 3, dynInt.Get())
+	resp, err := keys.Get(ctx, prefix+"some_dynint", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "3", resp.Node.Value, "canary values of other instances must not be rolled back")
+}
+
+func TestWatcher_AppliesOverridesOfThisInstance(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"some_dynint/__global", "1", nil)
+	keys.Set(ctx, prefix+"some_dynint/__hosts/frontend-1", "2", nil)
+	keys.Set(ctx, prefix+"some_dynint/__hosts/frontend-2", "3", nil)
+	keys.Set(ctx, prefix+"other_dynint", "4", nil)
+	set := flag.NewFlagSet("etcdtest", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 0, "dynamic int")
+	otherInt := flagz.DynInt64(set, "other_dynint", 0, "dynamic int")
+	w, err := watcher.New(set, keys, prefix, &testingLog{T: t})
+	require.NoError(t, err)
+	w.WithInstanceID("frontend-1")
+	require.NoError(t, w.Initialize())
+	assert.EqualValues(t, 2, dynInt.Get(), "overrides of this instance must win over the global value")
+	assert.EqualValues(t, 4, otherInt.Get(), "flags without overrides must keep their plain keys")
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	keys.Set(ctx, prefix+"some_dynint/__global", "5", nil)
+	keys.Delete(ctx, prefix+"some_dynint/__hosts/frontend-1", nil)
+	event := <-w.Events()
+	assert.NoError(t, event.Err)
+	assert.Equal(t, "5", event.Value, "removing the override must restore the latest global value")
+	assert.EqualValues(t, 5, dynInt.Get())
+}
+
+func TestWatcher_MapsNestedDirectoriesOntoNamespaces(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"cache/ttl", "1", nil)
+	keys.Set(ctx, prefix+"cache/l1/size/__global", "2", nil)
+	keys.Set(ctx, prefix+"cache/l1/size/__hosts/frontend-1", "3", nil)
+	set := flag.NewFlagSet("etcdtest", flag.ContinueOnError)
+	cache := flagz.Namespace(set, "cache.")
+	ttl := cache.DynInt64("ttl", 0, "dynamic int")
+	size := cache.Namespace("l1.").DynInt64("size", 0, "dynamic int")
+	w, err := watcher.New(set, keys, prefix, &testingLog{T: t})
+	require.NoError(t, err)
+	w.WithInstanceID("frontend-1")
+	require.NoError(t, w.Initialize())
+	assert.EqualValues(t, 1, ttl.Get())
+	assert.EqualValues(t, 3, size.Get(), "overrides of nested flags must be applied")
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	keys.Set(ctx, prefix+"cache/ttl", "4", nil)
+	event := <-w.Events()
+	assert.NoError(t, event.Err)
+	assert.Equal(t, "cache.ttl", event.FlagName)
+	assert.EqualValues(t, 4, ttl.Get())
+}
+
+func TestWatcher_AppliesKeysOfAliasesToRenamedFlags(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"old_dynint", "1", nil)
+	set := flag.NewFlagSet("etcdtest", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "new_dynint", 0, "dynamic int")
+	require.NoError(t, flagz.AliasFlag(set, "old_dynint", "new_dynint", &testingLog{T: t}))
+	w, err := watcher.New(set, keys, prefix, &testingLog{T: t})
+	require.NoError(t, err)
+	require.NoError(t, w.Initialize())
+	assert.EqualValues(t, 1, dynInt.Get())
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	keys.Set(ctx, prefix+"old_dynint", "2", nil)
+	event := <-w.Events()
+	assert.NoError(t, event.Err)
+	assert.EqualValues(t, 2, dynInt.Get(), "updates of keys of old names must be applied to the renamed flag")
+}
+
+func TestWatcher_WritesAcks(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"some_dynint", "1", nil)
+	set := flag.NewFlagSet("etcdtest", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_dynint", 0, "dynamic int")
+	for _, instance := range []string{"frontend-1", "frontend-2"} {
+		w, err := watcher.New(set, keys, prefix, &testingLog{T: t})
+		require.NoError(t, err)
+		w.WithAcks("/flagz/acks", time.Minute).WithInstanceID(instance)
+		require.NoError(t, w.Initialize())
+		require.NoError(t, w.Start())
+		defer w.Stop()
+	}
+
+	resp, err := keys.Set(ctx, prefix+"some_dynint", "2", nil)
+	require.NoError(t, err)
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	acks, err := watcher.WaitForAcks(waitCtx, keys, "/flagz/acks", "some_dynint", resp.Node.ModifiedIndex,
+		flagz.ValueChecksum("2"), 2)
+	require.NoError(t, err, "both instances must acknowledge the update")
+	assert.Len(t, acks, 2)
+
+	waitCtx, cancel = context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_, err = watcher.WaitForAcks(waitCtx, keys, "/flagz/acks", "some_dynint", resp.Node.ModifiedIndex,
+		flagz.ValueChecksum("3"), 1)
+	assert.Equal(t, context.DeadlineExceeded, err, "acks of other values must not confirm the update")
+}
+
+func TestWatcher_TracesUpdateStages(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"some_dynint", "1", nil)
+	set := flag.NewFlagSet("etcdtest", flag.ContinueOnError)
+	flagz.DynInt64(set, "some_dynint", 0, "dynamic int")
+	tracer := &recordingTracer{}
+	w, err := watcher.New(set, keys, prefix, &testingLog{T: t})
+	require.NoError(t, err)
+	w.WithTracer(tracer)
+	require.NoError(t, w.Initialize())
+	assert.Equal(t, []string{"validate some_dynint: <nil>", "apply some_dynint: <nil>", "initialize : <nil>"},
+		tracer.stages(), "initialization must trace every flag")
+	require.NoError(t, w.Start())
+	defer w.Stop()
+
+	tracer.reset()
+	keys.Set(ctx, prefix+"some_dynint", "nope", nil)
+	<-w.Events()
+	// the rolled back value is applied again after these.
+	require.Eventually(t, func() bool { return len(tracer.stages()) >= 4 }, time.Second, time.Millisecond)
+	stages := tracer.stages()
+	assert.Equal(t, "validate some_dynint: <nil>", stages[0])
+	assert.Contains(t, stages[1], "apply some_dynint: ", "rejected values must fail their apply stage")
+	assert.NotEqual(t, "apply some_dynint: <nil>", stages[1])
+	assert.Equal(t, "rollback some_dynint: <nil>", stages[2], "rollbacks must be traced within the watch event")
+	assert.Contains(t, stages[3], "watch_event some_dynint: ")
+}
+
+func TestWatcher_AppliesQueuedUpdates(t *testing.T) {
+	keys := etcdtest.New()
+	ctx := context.Background()
+	keys.Set(ctx, prefix+"some_dynint", "0", nil)
+	set := flag.NewFlagSet("etcdtest", flag.ContinueOnError)
+	dynInt := flagz.DynInt64(set, "some_dynint", 0, "dynamic int")
+	dynString := flagz.DynString(set, "some_dynstring", "", "dynamic string")
+	w, err := watcher.New(set, keys, prefix, &testingLog{T: t})
+	require.NoError(t, err)
+	w.WithUpdateQueue(1, flagz.QueueCoalesce)
+	require.NoError(t, w.Initialize())
+	require.NoError(t, w.Start())
+
+	for i := 1; i <= 20; i++ {
+		keys.Set(ctx, prefix+"some_dynint", fmt.Sprint(i), nil)
+		keys.Set(ctx, prefix+"some_dynstring", fmt.Sprint("v", i), nil)
+	}
+	require.Eventually(t, func() bool { return dynInt.Get() == 20 && dynString.Get() == "v20" }, time.Second,
+		time.Millisecond, "the last values must be applied")
+	require.NoError(t, w.Stop())
+}
+
+// recordingTracer records the stages ended by an Updater, in the order they end.
+type recordingTracer struct {
+	mu    sync.Mutex
+	ended []string
+}
+
+func (r *recordingTracer) StartStage(ctx context.Context, stage flagz.UpdateStage, flagName string,
+	revision string) (context.Context, func(err error)) {
+	return ctx, func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.ended = append(r.ended, fmt.Sprintf("%v %v: %v", stage, flagName, err))
+	}
+}
+
+func (r *recordingTracer) stages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.ended...)
+}
+
+func (r *recordingTracer) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ended = nil
+}
+
+func isEtcdError(err error, code int) bool {
+	etcdErr, ok := err.(etcd.Error)
+	return ok && etcdErr.Code == code
+}
+
+type testingLog struct {
+	T *testing.T
+}
+
+func (tl *testingLog) Printf(format string, v ...interface{}) {
+	tl.T.Logf(format+"\n", v...)
+}
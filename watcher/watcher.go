@@ -6,9 +6,13 @@
 package watcher
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	etcd "github.com/coreos/etcd/client"
@@ -17,22 +21,76 @@ import (
 	"golang.org/x/net/context"
 )
 
-var (
-	errNoValue        = fmt.Errorf("no value in Node")
-	errFlagNotDynamic = fmt.Errorf("flag is not dynamic")
+// GlobalValueKey is the key under the directory of a flag with per-instance overrides that holds its global value, see
+// `Watcher`.
+const GlobalValueKey = "__global"
+
+const (
+	ackTimeout      = 5 * time.Second
+	ackPollInterval = 100 * time.Millisecond
 )
 
+func init() {
+	flagz.RegisterUpdater("etcd", newFromURL)
+}
+
 // Watcher syncs updates from etcd into a given FlagSet.
+//
+// Flags are named by the keys under the etcd path, with nested directories mapped onto namespaces, e.g. the key
+// `cache/ttl` sets the flag `cache.ttl` (see `flagz.Namespace`). Flags may be overridden on single instances by keys
+// under `<flag key>/__hosts/<instance ID>`, see `flagz.InstanceOverridesDir`. Flags with overrides keep their global
+// value in `<flag key>/__global` then, since keys of etcd v2 values can't have children.
 type Watcher struct {
+	*flagz.UpdaterTracker
 	client    etcd.Client
 	etcdKeys  etcd.KeysAPI
 	flagSet   *flag.FlagSet
 	logger    loggerCompatible
 	etcdPath  string
 	lastIndex uint64
-	watching  bool
 	context   context.Context
 	cancel    context.CancelFunc
+
+	// mu serializes the lifecycle transitions, see `flagz.UpdaterState`.
+	mu sync.Mutex
+	// done is closed when the watching go routine exits.
+	done chan struct{}
+
+	// keyFlags caches the outcome of resolving etcd keys to flags, so that updates of high-churn keys and of keys not
+	// naming flags skip the string handling and FlagSet lookups. It is reset on every full read.
+	keyFlags map[string]keyFlag
+
+	coalesceWindow time.Duration
+	signingKeys    [][]byte
+	decrypter      flagz.Decrypter
+	scheduler      *flagz.Scheduler
+	instanceID     string
+	overrides      *flagz.InstanceOverrides
+	ackPath        string
+	ackTTL         time.Duration
+	tracer         flagz.UpdateTracer
+	queueCapacity  int
+	queuePolicy    flagz.QueuePolicy
+
+	// applyMu serializes applying updates and full reads, which run on different go routines with an update queue.
+	applyMu sync.Mutex
+}
+
+// coalescedUpdate is the last of a burst of events of a key, with the first one of the burst, see `WithCoalesceWindow`.
+type coalescedUpdate struct {
+	first     *etcd.Response
+	last      *etcd.Response
+	coalesced int
+}
+
+// keyFlag is the flag named by an etcd key, or the error why it doesn't name one.
+type keyFlag struct {
+	key  string
+	name string
+	flag *flag.Flag
+	err  error
+	// override is set for keys overriding the flag on this instance, see `flagz.InstanceOverridesDir`.
+	override bool
 }
 
 // Minimum logger interface needed.
@@ -47,100 +105,251 @@ func New(set *flag.FlagSet, keysApi etcd.KeysAPI, etcdPath string, logger logger
 		etcdPath = etcdPath + "/"
 	}
 	u := &Watcher{
-		flagSet:   set,
-		etcdKeys:  keysApi,
-		etcdPath:  etcdPath,
-		logger:    logger,
-		lastIndex: 0,
-		watching:  false,
+		UpdaterTracker: flagz.NewUpdaterTracker(),
+		flagSet:        set,
+		etcdKeys:       keysApi,
+		etcdPath:       etcdPath,
+		logger:         logger,
+		lastIndex:      0,
+		keyFlags:       make(map[string]keyFlag),
+		instanceID:     flagz.DefaultInstanceID(),
+		overrides:      flagz.NewInstanceOverrides(),
+		tracer:         flagz.NopUpdateTracer(),
 	}
 	u.context, u.cancel = context.WithCancel(context.Background())
 	return u, nil
 }
 
+// WithCoalesceWindow makes the watcher collect the events following an event for `window`, and apply only the last
+// value of each key of the burst, cutting validator and notifier churn during bulk pushes. Rejected values are rolled
+// back to the value before the burst. Disabled (zero) by default.
+func (u *Watcher) WithCoalesceWindow(window time.Duration) *Watcher {
+	u.coalesceWindow = window
+	return u
+}
+
+// WithSigningKeys makes the watcher only apply values signed with any of `keys`, see `flagz.SignFlagValue`, so that
+// a compromised etcd writer can't inject arbitrary values. Unsigned and badly signed values are rejected and rolled
+// back, like values failing validation.
+func (u *Watcher) WithSigningKeys(keys ...[]byte) *Watcher {
+	u.signingKeys = keys
+	return u
+}
+
+// WithDecrypter makes the watcher decrypt values with the `flagz.EncryptedValuePrefix` before setting them, so that
+// secrets can be stored encrypted in etcd, see `flagz.DynSecret`. Values that fail to decrypt are rejected and rolled
+// back. Signatures (see `WithSigningKeys`) cover the encrypted values.
+func (u *Watcher) WithDecrypter(decrypter flagz.Decrypter) *Watcher {
+	u.decrypter = decrypter
+	return u
+}
+
+// WithScheduler makes the watcher hand values with the `flagz.ScheduledValuePrefix` to `scheduler`, which sets them as
+// their activation windows open and close. Writing an unscheduled value of a flag cancels its schedule. Signatures and
+// encryption (see `WithSigningKeys` and `WithDecrypter`) cover the whole scheduled value.
+func (u *Watcher) WithScheduler(scheduler *flagz.Scheduler) *Watcher {
+	u.scheduler = scheduler
+	return u
+}
+
+// WithInstanceID sets the ID of the instance hashed to decide whether the watcher applies values with the
+// `flagz.CanaryValuePrefix`, and whose overrides it applies (see `flagz.InstanceOverridesDir`). Defaults to
+// `flagz.DefaultInstanceID`, the host name.
+func (u *Watcher) WithInstanceID(instanceID string) *Watcher {
+	u.instanceID = instanceID
+	return u
+}
+
+// WithAcks makes the watcher write a `flagz.UpdateAck` to `<path>/<flag name>/<instance ID>` after applying each
+// update, expiring after `ttl` (if non-zero), so that push tooling can block until a quorum of instances confirmed a
+// change with `WaitForAcks`. The path must not be under the watched etcd path.
+func (u *Watcher) WithAcks(path string, ttl time.Duration) *Watcher {
+	if !strings.HasSuffix(path, "/") {
+		path = path + "/"
+	}
+	u.ackPath = path
+	u.ackTTL = ttl
+	return u
+}
+
+// WithTracer makes the watcher trace the stages of reading and applying values with `tracer`, see
+// `flagz.UpdateTracer`. Revisions are etcd indexes.
+func (u *Watcher) WithTracer(tracer flagz.UpdateTracer) *Watcher {
+	u.tracer = tracer
+	return u
+}
+
+// WithUpdateQueue makes the watcher apply updates on a separate go routine, queueing up to `capacity` updates read from
+// etcd and handling more according to `policy`, see `flagz.UpdateQueue`. Updates dropped with `flagz.QueueDropOldest`
+// are logged, and applied again only by the next full read. Disabled (zero) by default, applying updates as they are
+// read.
+func (u *Watcher) WithUpdateQueue(capacity int, policy flagz.QueuePolicy) *Watcher {
+	u.queueCapacity = capacity
+	u.queuePolicy = policy
+	return u
+}
+
 // Initialize performs the initial read of etcd and sets all flags (dynamic and static) into FlagSet.
 func (u *Watcher) Initialize() error {
-	if u.lastIndex != 0 {
-		return fmt.Errorf("flagz: already initialized.")
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.CheckTransition(flagz.UpdaterInitialized); err != nil {
+		return err
 	}
-	return u.readAllFlags( /* onlyDynamic */ false)
+	ctx, end := u.tracer.StartStage(u.context, flagz.InitializeStage, "", "")
+	err := u.readAllFlags(ctx, false /* onlyDynamic */)
+	end(err)
+	if err != nil {
+		return err
+	}
+	return u.Transition(flagz.UpdaterInitialized)
 }
 
 // Start kicks off the go routine that syncs dynamic flags from etcd to FlagSet.
+// After a `Stop` it can be called again, to continue watching from the last applied etcd index.
 func (u *Watcher) Start() error {
-	if u.lastIndex == 0 {
-		return fmt.Errorf("flagz: not initialized")
-	}
-	if u.watching {
-		return fmt.Errorf("flagz: already watching")
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.Transition(flagz.UpdaterWatching); err != nil {
+		return err
 	}
-	u.watching = true
-	go u.watchForUpdates()
+	u.context, u.cancel = context.WithCancel(context.Background())
+	u.done = make(chan struct{})
+	go u.watchForUpdates(u.done)
 	return nil
 }
 
-// Stops the auto-updating go-routine.
+// Stop stops the auto-updating go-routine and waits for it to exit. Stopping a Watcher that isn't watching is a no-op.
 func (u *Watcher) Stop() error {
-	if !u.watching {
-		return fmt.Errorf("flagz: not watching")
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.State() != flagz.UpdaterWatching {
+		return nil
 	}
 	u.logger.Printf("flagz: stopping")
 	u.cancel()
-	return nil
+	<-u.done
+	return u.Transition(flagz.UpdaterStopped)
 }
 
-func (u *Watcher) readAllFlags(onlyDynamic bool) error {
-	resp, err := u.etcdKeys.Get(u.context, u.etcdPath, &etcd.GetOptions{Recursive: true, Sort: true})
+func (u *Watcher) readAllFlags(ctx context.Context, onlyDynamic bool) error {
+	u.applyMu.Lock()
+	defer u.applyMu.Unlock()
+	resp, err := u.etcdKeys.Get(ctx, u.etcdPath, &etcd.GetOptions{Recursive: true, Sort: true})
 	if err != nil {
 		return err
 	}
 	u.lastIndex = resp.Index
-	errorStrings := []string{}
-	for _, node := range resp.Node.Nodes {
-		flagName, err := u.nodeToFlagName(node)
-		if err != nil {
-			u.logger.Printf("flagz: ignoring: %v", err)
+	u.RecordRevision(strconv.FormatUint(u.lastIndex, 10))
+	// flags may have been added to the FlagSet since the last read.
+	u.keyFlags = make(map[string]keyFlag, len(resp.Node.Nodes))
+	u.overrides.Reset()
+	errs := &flagz.FlagErrors{Source: "etcd"}
+	// leaves are sorted, so the global value of a flag is set before its override.
+	for _, node := range leafNodes(resp.Node.Nodes) {
+		kf := u.nodeToFlag(node)
+		if kf.err != nil {
+			u.logger.Printf("flagz: ignoring: %v", kf.err)
 			continue
 		}
-		if err := u.setFlag(flagName, node.Value, onlyDynamic); err != nil && err != errNoValue {
-			errorStrings = append(errorStrings, err.Error())
+		err := u.setFlag(ctx, kf, node.Value, resp.Index, onlyDynamic)
+		if err != nil && !flagz.IsSkippedUpdateError(err) {
+			errs.Add(kf.name, err)
 		}
 	}
-	if len(errorStrings) > 0 {
-		return fmt.Errorf("flagz: encountered %d errors while parsing flags from etcd: \n  %v",
-			len(errorStrings), strings.Join(errorStrings, "\n"))
-	}
-	return nil
+	return errs.ErrorOrNil()
 }
 
-func (u *Watcher) setFlag(flagName string, value string, onlyDynamic bool) error {
+func (u *Watcher) setFlag(ctx context.Context, kf keyFlag, value string, index uint64, onlyDynamic bool) error {
 	if value == "" {
-		return errNoValue
+		return flagz.ErrNoValue
+	}
+	if kf.flag == nil {
+		return flagz.ErrFlagNotFound
+	}
+	if onlyDynamic && !flagz.IsFlagDynamic(kf.flag) {
+		return flagz.ErrFlagNotDynamic
 	}
-	flag := u.flagSet.Lookup(flagName)
-	if flag == nil {
-		return fmt.Errorf("flag=%v was not found", flagName)
+	if !kf.override && !u.overrides.SetGlobal(kf.name, value) {
+		return flagz.ErrFlagOverridden
+	}
+	revision := strconv.FormatUint(index, 10)
+	_, endValidate := u.tracer.StartStage(ctx, flagz.ValidateStage, kf.name, revision)
+	value, err := u.unwrappedValue(kf.name, value)
+	endValidate(err)
+	if err != nil {
+		return err
 	}
-	if onlyDynamic && !flagz.IsFlagDynamic(flag) {
-		return errFlagNotDynamic
+	_, endApply := u.tracer.StartStage(ctx, flagz.ApplyStage, kf.name, revision)
+	err = u.applyValue(ctx, kf.key, kf.name, value, revision)
+	endApply(err)
+	if kf.override && (err == nil || errors.Is(err, flagz.ErrFlagPinned)) {
+		// rejected overrides don't shadow the global value, so the flag keeps following it.
+		u.overrides.SetOverride(kf.name)
 	}
-	// do not call flag.Value.Set, instead go through flagSet.Set to change "changed" state.
-	return u.flagSet.Set(flagName, value)
+	return err
 }
 
-func (u *Watcher) watchForUpdates() error {
+// unwrappedValue returns the value carried by the envelopes of `value`: its signature, encryption and canary.
+func (u *Watcher) unwrappedValue(flagName string, value string) (string, error) {
+	value, err := u.verifiedValue(flagName, value)
+	if err != nil {
+		return "", err
+	}
+	if u.decrypter != nil {
+		if value, err = flagz.DecryptFlagValue(u.decrypter, value); err != nil {
+			return "", err
+		}
+	}
+	return flagz.CanaryFlagValue(u.instanceID, value)
+}
+
+// applyValue sets the unwrapped `value` of `flagName` read from `key` at `revision`, or schedules it.
+func (u *Watcher) applyValue(ctx context.Context, key string, flagName string, value string, revision string) error {
+	if u.scheduler != nil {
+		if flagz.IsScheduledValue(value) {
+			scheduled, err := flagz.ParseScheduledValue(value)
+			if err != nil {
+				return err
+			}
+			return u.scheduler.Schedule(flagName, scheduled)
+		}
+		u.scheduler.Cancel(flagName)
+	}
+	// do not call flag.Value.Set, instead go through flagSet.Set (via SetFlagFromSource) to change "changed" state.
+	info := flagz.UpdateInfo{FlagName: flagName, Source: "etcd", Key: key, Revision: revision}
+	ctx = flagz.NewUpdateContext(ctx, info)
+	return flagz.SetFlagFromSourceCtx(ctx, u.flagSet, flagName, value, "etcd")
+}
+
+func (u *Watcher) watchForUpdates(done chan struct{}) {
+	defer close(done)
 	// We need to implement our own watcher because the one in go-etcd doesn't handle errorcode 400 and 401.
 	// See https://github.com/coreos/etcd/blob/master/Documentation/errorcode.md
 	// And https://coreos.com/etcd/docs/2.0.8/api.html#waiting-for-a-change
 	watcher := u.etcdKeys.Watcher(u.etcdPath, &etcd.WatcherOptions{AfterIndex: u.lastIndex, Recursive: true})
+	var queue *flagz.UpdateQueue
+	if u.queueCapacity > 0 {
+		queue = flagz.NewUpdateQueue(u.queueCapacity, u.queuePolicy)
+		applied := make(chan struct{})
+		go func() {
+			defer close(applied)
+			queue.Run()
+		}()
+		// apply the pending updates before exiting.
+		defer func() {
+			queue.Close()
+			<-applied
+		}()
+	}
 	u.logger.Printf("flagz: watcher started")
-	for u.watching {
+	for u.context.Err() == nil {
 		resp, err := watcher.Next(u.context)
 		if etcdErr, ok := err.(etcd.Error); ok && etcdErr.Code == etcd.ErrorCodeEventIndexCleared {
 			// Our index is out of the Etcd Log. Reread everything and reset index.
 			u.logger.Printf("flagz: handling Etcd Index error by re-reading everything: %v", err)
-			time.Sleep(200 * time.Millisecond)
-			u.readAllFlags( /* onlyDynamic */ true)
+			u.sleep(200 * time.Millisecond)
+			u.readAllFlags(u.context, true /* onlyDynamic */)
 			watcher = u.etcdKeys.Watcher(u.etcdPath, &etcd.WatcherOptions{AfterIndex: u.lastIndex, Recursive: true})
 			continue
 		} else if clusterErr, ok := err.(*etcd.ClusterError); ok {
@@ -150,7 +359,8 @@ func (u *Watcher) watchForUpdates() error {
 				break
 			}
 			u.logger.Printf("flagz: etcd ClusterError. Will retry. %v", clusterErr.Detail())
-			time.Sleep(100 * time.Millisecond)
+			u.RecordSync(err)
+			u.sleep(100 * time.Millisecond)
 			continue
 		} else if err == context.DeadlineExceeded {
 			u.logger.Printf("flagz: deadline exceeded which watching for changes, continuing watching")
@@ -159,62 +369,257 @@ func (u *Watcher) watchForUpdates() error {
 			break
 		} else if err != nil {
 			u.logger.Printf("flagz: wicked etcd error. Restarting watching after some time. %v", err)
+			u.RecordSync(err)
 			// Etcd started dropping watchers, or is re-electing. Give it some time.
 			randOffsetMs := int(500 * rand.Float32())
-			time.Sleep(1*time.Second + time.Duration(randOffsetMs)*time.Millisecond)
+			u.sleep(1*time.Second + time.Duration(randOffsetMs)*time.Millisecond)
 			continue
 		}
-		u.lastIndex = resp.Node.ModifiedIndex
-		flagName, err := u.nodeToFlagName(resp.Node)
+		for _, update := range u.collectBurst(watcher, resp) {
+			u.lastIndex = update.last.Node.ModifiedIndex
+			u.RecordRevision(strconv.FormatUint(u.lastIndex, 10))
+			u.RecordSync(nil)
+			if queue == nil {
+				u.applyUpdate(update)
+				continue
+			}
+			update := update
+			if key, dropped := queue.Push(update.last.Node.Key, func() { u.applyUpdate(update) }); dropped {
+				u.logger.Printf("flagz: dropped pending update of key=%v, because the update queue is full", key)
+			}
+		}
+	}
+	u.logger.Printf("flagz: watcher exited")
+}
+
+// sleep waits for `duration`, returning early if the Watcher is stopped.
+func (u *Watcher) sleep(duration time.Duration) {
+	select {
+	case <-time.After(duration):
+	case <-u.context.Done():
+	}
+}
+
+// collectBurst returns the updates of `first` and of the events following it within the coalescing window, with the
+// events of each key coalesced into the last one, in the order of the first event of each key.
+func (u *Watcher) collectBurst(watcher etcd.Watcher, first *etcd.Response) []*coalescedUpdate {
+	updates := []*coalescedUpdate{{first: first, last: first}}
+	if u.coalesceWindow <= 0 {
+		return updates
+	}
+	byKey := map[string]*coalescedUpdate{first.Node.Key: updates[0]}
+	ctx, cancel := context.WithTimeout(u.context, u.coalesceWindow)
+	defer cancel()
+	for {
+		// errors other than the window passing are returned again by the next call to Next of the main loop.
+		resp, err := watcher.Next(ctx)
 		if err != nil {
-			u.logger.Printf("flagz: ignoring %v at etcdindex=%v", err, u.lastIndex)
-			continue
+			return updates
 		}
-		err = u.setFlag(flagName, resp.Node.Value /*onlyDynamic*/, true)
-		if err == errNoValue {
-			u.logger.Printf("flagz: ignoring action=%v on flag=%v at etcdindex=%v", resp.Action, flagName, u.lastIndex)
+		if update, ok := byKey[resp.Node.Key]; ok {
+			update.last = resp
+			update.coalesced++
 			continue
-		} else if err == errFlagNotDynamic {
-			u.logger.Printf("flagz: ignoring updating flag=%v at etcdindex=%v, because of: %v", flagName, u.lastIndex, err)
-		} else if err != nil {
-			u.logger.Printf("flagz: failed updating flag=%v at etcdindex=%v, because of: %v", flagName, u.lastIndex, err)
-			u.rollbackEtcdValue(flagName, resp)
-		} else {
-			u.logger.Printf("flagz: updated flag=%v to value=%v at etcdindex=%v", flagName, resp.Node.Value, u.lastIndex)
 		}
+		update := &coalescedUpdate{first: resp, last: resp}
+		byKey[resp.Node.Key] = update
+		updates = append(updates, update)
+	}
+}
+
+func (u *Watcher) applyUpdate(update *coalescedUpdate) {
+	u.applyMu.Lock()
+	defer u.applyMu.Unlock()
+	resp := update.last
+	index := resp.Node.ModifiedIndex
+	kf := u.nodeToFlag(resp.Node)
+	ctx, end := u.tracer.StartStage(u.context, flagz.WatchEventStage, kf.name, strconv.FormatUint(index, 10))
+	if kf.err != nil {
+		u.logger.Printf("flagz: ignoring %v at etcdindex=%v", kf.err, index)
+		end(kf.err)
+		return
+	}
+	flagName := kf.name
+	if update.coalesced > 0 {
+		u.logger.Printf("flagz: coalesced %d earlier updates of flag=%v into etcdindex=%v", update.coalesced, flagName, index)
+	}
+	value := resp.Node.Value
+	if kf.override && value == "" {
+		// the override was removed, restore the global value.
+		global, ok := u.overrides.RemoveOverride(flagName)
+		if !ok {
+			u.logger.Printf("flagz: removed override of flag=%v without a global value at etcdindex=%v", flagName,
+				index)
+			end(nil)
+			return
+		}
+		kf, value = keyFlag{key: kf.key, name: flagName, flag: kf.flag}, global
+	}
+	err := u.setFlag(ctx, kf, value, index /*onlyDynamic*/, true)
+	defer end(err)
+	shownValue := value
+	if verified, verifyErr := u.verifiedValue(flagName, shownValue); verifyErr == nil {
+		shownValue = verified
+	}
+	shownValue = flagz.RedactFlagValue(kf.flag, shownValue)
+	if errors.Is(err, flagz.ErrNoValue) {
+		u.logger.Printf("flagz: ignoring action=%v on flag=%v at etcdindex=%v", resp.Action, flagName, index)
+	} else if flagz.IsSkippedUpdateError(err) {
+		// held values of pinned flags aren't live, so they are neither reported as updated nor acknowledged.
+		u.logger.Printf("flagz: ignoring updating flag=%v at etcdindex=%v, because of: %v", flagName, index, err)
+	} else if err != nil {
+		u.logger.Printf("flagz: failed updating flag=%v at etcdindex=%v, because of: %v", flagName, index, err)
+		u.RecordUpdate(flagName, shownValue, err)
+		// roll back to the value before the burst, the one that was last applied.
+		u.rollbackEtcdValue(ctx, flagName, resp.Node, update.first.PrevNode)
+	} else {
+		u.logger.Printf("flagz: updated flag=%v to value=%v at etcdindex=%v", flagName, shownValue, index)
+		u.RecordUpdate(flagName, shownValue, nil)
+		u.writeAck(flagName, value, index)
 	}
-	u.logger.Printf("flagz: watcher exited")
-	return nil
 }
 
-func (u *Watcher) rollbackEtcdValue(flagName string, resp *etcd.Response) {
+// writeAck acknowledges applying `value` of flag `flagName` at `index`, if acks are enabled.
+func (u *Watcher) writeAck(flagName string, value string, index uint64) {
+	if u.ackPath == "" {
+		return
+	}
+	ack := &flagz.UpdateAck{
+		Instance: u.instanceID,
+		Flag:     flagName,
+		Index:    index,
+		Checksum: flagz.ValueChecksum(value),
+		Time:     time.Now(),
+	}
+	ctx, cancel := context.WithTimeout(u.context, ackTimeout)
+	defer cancel()
+	key := u.ackPath + flagName + "/" + u.instanceID
+	if _, err := u.etcdKeys.Set(ctx, key, ack.Encode(), &etcd.SetOptions{TTL: u.ackTTL}); err != nil {
+		u.logger.Printf("flagz: failed writing ack of flag=%v at etcdindex=%v, because of: %v", flagName, index, err)
+	}
+}
+
+func (u *Watcher) rollbackEtcdValue(ctx context.Context, flagName string, node *etcd.Node, prevNode *etcd.Node) {
+	ctx, end := u.tracer.StartStage(ctx, flagz.RollbackStage, flagName, strconv.FormatUint(node.ModifiedIndex, 10))
 	var err error
-	if resp.PrevNode != nil {
+	if prevNode != nil {
 		// It's just a new value that's wrong, roll back to prevNode value atomically.
-		_, err = u.etcdKeys.Set(u.context, resp.Node.Key, resp.PrevNode.Value, &etcd.SetOptions{PrevIndex: u.lastIndex})
+		_, err = u.etcdKeys.Set(ctx, node.Key, prevNode.Value, &etcd.SetOptions{PrevIndex: node.ModifiedIndex})
 	} else {
-		_, err = u.etcdKeys.Delete(u.context, resp.Node.Key, &etcd.DeleteOptions{PrevIndex: u.lastIndex})
+		_, err = u.etcdKeys.Delete(ctx, node.Key, &etcd.DeleteOptions{PrevIndex: node.ModifiedIndex})
 	}
 	if etcdErr, ok := err.(etcd.Error); ok && etcdErr.Code == etcd.ErrorCodeTestFailed {
 		// Someone probably rolled it back in the meantime.
 		u.logger.Printf("flagz: rolled back flag=%v was changed by someone else. All good.", flagName)
+		end(nil)
 	} else if err != nil {
 		u.logger.Printf("flagz: rolling back flagz=%v failed: %v", flagName, err)
+		end(err)
 	} else {
+		end(nil)
 		u.logger.Printf("flagz: rolled back flagz=%v to correct state. All good.", flagName)
 	}
 }
 
-func (u *Watcher) nodeToFlagName(node *etcd.Node) (string, error) {
+// verifiedValue returns the value carried by the signed envelope `value` if signing keys are set, and `value` itself
+// otherwise.
+func (u *Watcher) verifiedValue(flagName string, value string) (string, error) {
+	if len(u.signingKeys) == 0 {
+		return value, nil
+	}
+	return flagz.VerifyFlagValue(u.signingKeys, flagName, value)
+}
+
+// nodeToFlag resolves the flag named by the key of `node`, caching the outcome for the key until the next full read.
+func (u *Watcher) nodeToFlag(node *etcd.Node) keyFlag {
 	if node.Dir {
-		return "", fmt.Errorf("key '%v' is a directory entry", node.Key)
+		return keyFlag{err: fmt.Errorf("key '%v' is a directory entry", node.Key)}
 	}
-	if !strings.HasPrefix(node.Key, u.etcdPath) {
-		return "", fmt.Errorf("key '%v' doesn't start with etcd path '%v'", node.Key, u.etcdPath)
+	if kf, ok := u.keyFlags[node.Key]; ok {
+		return kf
 	}
+	kf := keyFlag{key: node.Key}
 	truncated := strings.TrimPrefix(node.Key, u.etcdPath)
-	if strings.Count(truncated, "/") > 0 {
-		return "", fmt.Errorf("key '%v' isn't a direct leaf of etcd path '%v'", node.Key, u.etcdPath)
+	overrideName, instanceID, isOverride := flagz.ParseOverrideKey(truncated)
+	if !strings.HasPrefix(node.Key, u.etcdPath) {
+		kf.err = fmt.Errorf("key '%v' doesn't start with etcd path '%v'", node.Key, u.etcdPath)
+	} else if isOverride && instanceID == u.instanceID {
+		kf.name = overrideName
+		kf.flag = u.flagSet.Lookup(overrideName)
+		kf.override = true
+	} else if isOverride {
+		kf.err = fmt.Errorf("key '%v' overrides a flag on another instance", node.Key)
+	} else if name, ok := flagz.KeyPathToFlagName(strings.TrimSuffix(truncated, "/"+GlobalValueKey)); ok {
+		kf.name = name
+		kf.flag = u.flagSet.Lookup(name)
+	} else {
+		kf.err = fmt.Errorf("key '%v' doesn't name a flag under etcd path '%v'", node.Key, u.etcdPath)
+	}
+	u.keyFlags[node.Key] = kf
+	return kf
+}
+
+// WaitForAcks blocks until `quorum` instances acknowledged (see `WithAcks`) the update of flag `flagName` at `index`
+// (e.g. the index of the response to writing it) with a value of `checksum` (see `flagz.ValueChecksum`, or empty to
+// match any value), or a later update. It returns the confirming acks, and the error of `ctx` if it is done first.
+func WaitForAcks(ctx context.Context, keysApi etcd.KeysAPI, ackPath string, flagName string, index uint64,
+	checksum string, quorum int) ([]*flagz.UpdateAck, error) {
+	if !strings.HasSuffix(ackPath, "/") {
+		ackPath = ackPath + "/"
+	}
+	for {
+		acks, err := readAcks(ctx, keysApi, ackPath+flagName)
+		confirming := []*flagz.UpdateAck{}
+		for _, ack := range acks {
+			if ack.Confirms(flagName, index, checksum) {
+				confirming = append(confirming, ack)
+			}
+		}
+		if err == nil && len(confirming) >= quorum {
+			return confirming, nil
+		}
+		select {
+		case <-ctx.Done():
+			return confirming, ctx.Err()
+		case <-time.After(ackPollInterval):
+		}
+	}
+}
+
+func readAcks(ctx context.Context, keysApi etcd.KeysAPI, dir string) ([]*flagz.UpdateAck, error) {
+	resp, err := keysApi.Get(ctx, dir, &etcd.GetOptions{Recursive: true})
+	if etcdErr, ok := err.(etcd.Error); ok && etcdErr.Code == etcd.ErrorCodeKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	acks := []*flagz.UpdateAck{}
+	for _, node := range resp.Node.Nodes {
+		if ack, err := flagz.ParseUpdateAck(node.Value); err == nil {
+			acks = append(acks, ack)
+		}
+	}
+	return acks, nil
+}
+
+// leafNodes returns the nodes that aren't directories in `nodes` and all directories in it, in order.
+func leafNodes(nodes etcd.Nodes) etcd.Nodes {
+	var leaves etcd.Nodes
+	for _, node := range nodes {
+		if node.Dir {
+			leaves = append(leaves, leafNodes(node.Nodes)...)
+		} else {
+			leaves = append(leaves, node)
+		}
+	}
+	return leaves
+}
+
+// newFromURL constructs a Watcher from an `etcd://host:port/etcd/path` URL, connecting to the etcd endpoint over HTTP.
+func newFromURL(flagSet *flag.FlagSet, source *url.URL, logger flagz.Logger) (flagz.Updater, error) {
+	client, err := etcd.New(etcd.Config{Endpoints: []string{"http://" + source.Host}})
+	if err != nil {
+		return nil, fmt.Errorf("flagz: creating etcd client: %v", err)
 	}
-	return truncated, nil
+	return New(flagSet, etcd.NewKeysAPI(client), source.Path, logger)
 }
@@ -170,6 +170,59 @@ func (s *watcherTestSuite) Test_DynamicUpdate_WroteBadSubdirectory() {
 		"writing a bad directory shouldn't inhibit the watcher")
 }
 
+func (s *watcherTestSuite) Test_DynamicUpdate_RollsBackRepeatedUnknownFlags() {
+	someInt := flagz.DynInt64(s.flagSet, "someint", 1337, "some int usage")
+	require.NoError(s.T(), s.watcher.Initialize())
+	require.NoError(s.T(), s.watcher.Start())
+
+	// The second write of the key goes through the cached lookup of the first one.
+	for _, value := range []string{"first", "second"} {
+		s.setFlagzValue("unknownflag", value)
+		eventually(s.T(), 1*time.Second, assert.ObjectsAreEqualValues, "",
+			func() interface{} { return s.getFlagzValue("unknownflag") },
+			"unknown flags must be rolled back")
+	}
+	s.setFlagzValue("someint", "7331")
+	eventually(s.T(), 1*time.Second, assert.ObjectsAreEqualValues, 7331,
+		func() interface{} { return someInt.Get() },
+		"known flags must still be updated")
+}
+
+func (s *watcherTestSuite) Test_DynamicUpdate_CoalescesBursts() {
+	someInt := flagz.DynInt64(s.flagSet, "someint", 1337, "some int usage")
+	notifications := make(chan int64, 10)
+	someInt.WithNotifier(func(oldValue int64, newValue int64) { notifications <- newValue })
+	s.watcher.WithCoalesceWindow(300 * time.Millisecond)
+	require.NoError(s.T(), s.watcher.Initialize())
+	require.NoError(s.T(), s.watcher.Start())
+
+	for _, value := range []string{"1", "2", "3", "4"} {
+		s.setFlagzValue("someint", value)
+	}
+	eventually(s.T(), 2*time.Second, assert.ObjectsAreEqualValues, 4,
+		func() interface{} { return someInt.Get() },
+		"the last value of the burst must be applied")
+	time.Sleep(100 * time.Millisecond)
+	assert.True(s.T(), len(notifications) < 4, "values of the burst must be coalesced")
+}
+
+func (s *watcherTestSuite) Test_StopIsIdempotentAndWatchingRestarts() {
+	someInt := flagz.DynInt64(s.flagSet, "someint", 1337, "some int usage")
+	require.NoError(s.T(), s.watcher.Initialize())
+	require.NoError(s.T(), s.watcher.Start())
+	require.Error(s.T(), s.watcher.Start(), "starting twice must fail")
+	require.NoError(s.T(), s.watcher.Stop())
+	require.NoError(s.T(), s.watcher.Stop(), "stopping twice must be a no-op")
+	assert.False(s.T(), s.watcher.Status().Running)
+
+	// Changes made while stopped are picked up after restarting.
+	s.setFlagzValue("someint", "2016")
+	require.NoError(s.T(), s.watcher.Start(), "watcher must be restartable")
+	eventually(s.T(), 1*time.Second, assert.ObjectsAreEqualValues, 2016,
+		func() interface{} { return someInt.Get() },
+		"restarted watcher must apply updates")
+}
+
 func (s *watcherTestSuite) Test_DynamicUpdate_DoesntUpdateNonDynamicFlags() {
 	someInt := flagz.DynInt64(s.flagSet, "someint", 1337, "some int usage")
 	someString := s.flagSet.String("somestring", "initial_value", "some int usage")
@@ -0,0 +1,45 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz
+
+import (
+	"fmt"
+)
+
+// AnyWriter matches all writers in a WriterAllowlist, and as a flag name, it sets the writers of all flags that have
+// no entry of their own.
+const AnyWriter = "*"
+
+// WriterAllowlist maps flag names to the identities of writers allowed to change them in a backend, for backends
+// that know who wrote a value (e.g. the author of a commit).
+//
+// Flags without an entry may be changed by the writers of the `AnyWriter` entry if there is one, and by anyone
+// otherwise.
+type WriterAllowlist map[string][]string
+
+// CheckWriter returns a `*WriterNotAllowedError` if `writer` may not change flag `name`.
+func (a WriterAllowlist) CheckWriter(name string, writer string) error {
+	writers, ok := a[name]
+	if !ok {
+		if writers, ok = a[AnyWriter]; !ok {
+			return nil
+		}
+	}
+	for _, allowed := range writers {
+		if allowed == writer || allowed == AnyWriter {
+			return nil
+		}
+	}
+	return &WriterNotAllowedError{Flag: name, Writer: writer}
+}
+
+// WriterNotAllowedError is returned by Updaters for values written by writers outside of their WriterAllowlist.
+type WriterNotAllowedError struct {
+	Flag   string
+	Writer string
+}
+
+func (e *WriterNotAllowedError) Error() string {
+	return fmt.Sprintf("writer %q is not allowed to change flag %v", e.Writer, e.Flag)
+}
@@ -0,0 +1,23 @@
+// Copyright 2016 Michal Witkowski. All Rights Reserved.
+// See LICENSE for licensing terms.
+
+package flagz_test
+
+import (
+	"testing"
+
+	"github.com/mwitkow/go-flagz"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterAllowlist_CheckWriter(t *testing.T) {
+	allowlist := flagz.WriterAllowlist{"some_flag": {"alice"}, "open_flag": {flagz.AnyWriter}}
+	assert.NoError(t, allowlist.CheckWriter("some_flag", "alice"))
+	assert.Equal(t, &flagz.WriterNotAllowedError{Flag: "some_flag", Writer: "bob"}, allowlist.CheckWriter("some_flag", "bob"))
+	assert.NoError(t, allowlist.CheckWriter("open_flag", "bob"))
+	assert.NoError(t, allowlist.CheckWriter("other_flag", "bob"), "flags without entries must be open without a default")
+
+	allowlist[flagz.AnyWriter] = []string{"alice"}
+	assert.NoError(t, allowlist.CheckWriter("other_flag", "alice"))
+	assert.Error(t, allowlist.CheckWriter("other_flag", "bob"), "flags without entries must use the default")
+}